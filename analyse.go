@@ -7,16 +7,26 @@
 package main
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"path"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/evolution-gaming/ease/internal/analysis"
 	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/perm"
 	"github.com/evolution-gaming/ease/internal/tools"
+	"github.com/evolution-gaming/ease/internal/video"
 	"github.com/evolution-gaming/ease/internal/vqm"
 )
 
@@ -31,6 +41,46 @@ type AnalyseApp struct {
 	flSrcReport string
 	// Output directory for analysis results
 	flOutDir string
+	// Number of concurrent analysis workers
+	flJobs int
+	// Create combined dashboard plot flag
+	flDashboard bool
+	// Create only combined dashboard plot (no per metric plots) flag
+	flDashboardOnly bool
+	// Annotate per-frame plots with jitter flag
+	flJitter bool
+	// Frame rate source for mapping timestamps to frames
+	flFrameRate string
+	// Zip file to package report and analysis results into
+	flBundle string
+	// Include libvmaf per frame result JSONs into bundle flag
+	flBundleVQM bool
+	// Create VMAF CDF comparison plot of all schemes flag
+	flSchemeCDF bool
+	// Create VMAF and bitrate correlation plot flag
+	flCorrelate bool
+	// Calculate PSNR and SSIM missing from libvmaf results flag
+	flFillMetrics bool
+	// Write frame type distribution stats flag
+	flFrameTypes bool
+	// Per frame metrics export format, empty means no export
+	flFrameMetrics string
+	// Create per scene VMAF ranking flag
+	flSceneVMAF bool
+	// PNG compression level of plot images
+	flPNGCompression string
+	// Skip encodes already analysed flag
+	flResume bool
+	// Skip encodes without VQM results flag
+	flExcludeFailed bool
+	// Decimal places of metrics in CSV output
+	flPrecision metricPrecision
+	// Per metric plots to create
+	flPlots plotSet
+	// Plot style file
+	flStyle string
+	// Plot options loaded from plot style file
+	styleOpts []analysis.PlotOption
 }
 
 // CreateAnalyseCommand will create Commander instace from AnalyseApp.
@@ -40,13 +90,35 @@ stage. Report file is provided via -report flag and it is mandatory.
 
 Examples:
 
-  ease analyse -report encode_report.json -out-dir results`
+  ease analyse -report encode_report.json -out-dir results
+  ease analyse -report encode_report.json -out-dir results -bundle results.zip`
 
 	app := &AnalyseApp{
-		fs: flag.NewFlagSet("analyse", flag.ContinueOnError),
+		fs:          flag.NewFlagSet("analyse", flag.ContinueOnError),
+		flPrecision: defaultMetricPrecision,
+		flPlots:     allPlots,
 	}
 	app.fs.StringVar(&app.flSrcReport, "report", "", "Encoding report file as source for analysis (output from encoding stage)")
-	app.fs.StringVar(&app.flOutDir, "out-dir", "", "Output directory to store results")
+	app.fs.StringVar(&app.flOutDir, "out-dir", "", "Output directory to store results, {date} and {runid} placeholders are expanded")
+	app.fs.BoolVar(&app.flDashboard, "dashboard", false, "Also create combined dashboard plot for each encode")
+	app.fs.BoolVar(&app.flDashboardOnly, "dashboard-only", false, "Create only combined dashboard plot for each encode (no per metric plots)")
+	app.fs.Var(plotSetFlag{&app.flPlots}, "plots", "Comma separated list of per metric plots to create for each encode: bitrate, vmaf, psnr, ms-ssim")
+	app.fs.BoolVar(&app.flJitter, "jitter", false, "Annotate per-frame VQM plots with jitter (mean absolute difference between consecutive frames)")
+	app.fs.BoolVar(&app.flCorrelate, "correlate", false, "Also create VMAF and per-second bitrate correlation plot on shared timeline for each encode")
+	app.fs.BoolVar(&app.flFillMetrics, "fill-metrics", false, "Calculate PSNR and SSIM via separate ffmpeg pass when missing from libvmaf results")
+	app.fs.BoolVar(&app.flFrameTypes, "frame-types", false, "Also write frame type (I/P/B) distribution and I-frame interval stats JSON for each encode (requires decoding video)")
+	app.fs.StringVar(&app.flFrameMetrics, "frame-metrics", "", "Also export per frame metrics of each encode in given format: csv, jsonl (JSON Lines)")
+	app.fs.BoolVar(&app.flSceneVMAF, "scene-vmaf", false, "Also write per scene mean VMAF table (worst scene first) and plot for each encode with scene cuts detected (see encode -scene-cuts)")
+	app.fs.BoolVar(&app.flSchemeCDF, "scheme-cdf", false, "Also create VMAF CDF plot comparing all encoding schemes")
+	app.fs.StringVar(&app.flPNGCompression, "png-compression", analysis.PNGCompressionDefault, "PNG compression level of plot images (default, none, speed, best), best trades CPU for smaller files")
+	app.fs.StringVar(&app.flStyle, "style", "", "Plot style JSON file (theme, colors, fonts, legend) applied to all plots")
+	app.fs.StringVar(&app.flFrameRate, "frame-rate", video.FrameRateAuto, "Frame rate source for mapping timestamps to frames: auto, base (r_frame_rate), avg (avg_frame_rate)")
+	app.fs.StringVar(&app.flBundle, "bundle", "", "Also package report and analysis results into given zip file")
+	app.fs.BoolVar(&app.flBundleVQM, "bundle-vqm", false, "Include libvmaf per frame result JSONs into zip file given via -bundle")
+	app.fs.IntVar(&app.flJobs, "jobs", runtime.NumCPU(), "Number of encodes to analyse concurrently")
+	app.fs.BoolVar(&app.flResume, "resume", false, "Skip encodes whose analysis results already exist in -out-dir, to complete interrupted or partially failed analysis")
+	app.fs.BoolVar(&app.flExcludeFailed, "exclude-failed", false, "Skip encodes without VQM results (failed encode or VQM measurement) instead of failing analysis")
+	app.fs.Var(metricPrecisionFlag{&app.flPrecision}, "precision", "Decimal places of metrics in per frame metrics and per scene VMAF CSVs as KEY=PLACES list (keys: vmaf, psnr, ms-ssim), e.g. vmaf=3")
 	app.fs.Usage = func() {
 		printSubCommandUsage(longHelp, app.fs)
 	}
@@ -89,6 +161,48 @@ func (a *AnalyseApp) init(args []string) error {
 		}
 	}
 
+	a.flOutDir = expandDirTemplate(a.flOutDir, time.Now())
+
+	if !video.IsFrameRateSource(a.flFrameRate) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid frame rate source: %s", a.flFrameRate),
+		}
+	}
+
+	if a.flBundleVQM && a.flBundle == "" {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "option -bundle-vqm requires -bundle",
+		}
+	}
+
+	if !analysis.IsPNGCompression(a.flPNGCompression) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid PNG compression: %s", a.flPNGCompression),
+		}
+	}
+
+	if a.flFrameMetrics != "" && !isFrameMetricsFormat(a.flFrameMetrics) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid -frame-metrics format: %s", a.flFrameMetrics),
+		}
+	}
+
+	if a.flJobs < 1 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "option -jobs should be positive",
+		}
+	}
+
 	// Report file should exist.
 	if _, err := os.Stat(a.flSrcReport); err != nil {
 		a.Help()
@@ -98,6 +212,19 @@ func (a *AnalyseApp) init(args []string) error {
 		}
 	}
 
+	if a.flStyle != "" {
+		style, err := plotStyle(a.fs, a.flStyle)
+		if err == nil {
+			a.styleOpts, err = style.Options()
+		}
+		if err != nil {
+			return &AppError{
+				exitCode: 2,
+				msg:      err.Error(),
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -117,6 +244,11 @@ func (a *AnalyseApp) Run(args []string) error {
 
 	// Extract data to work with.
 	srcData := extractSourceData(r)
+	if a.flExcludeFailed {
+		for _, f := range excludeWithoutVqm(srcData) {
+			logging.Infof("Excluding %s from analysis, no VQM results", f)
+		}
+	}
 	d, err := json.MarshalIndent(srcData, "", "  ")
 	if err != nil {
 		return &AppError{
@@ -126,95 +258,616 @@ func (a *AnalyseApp) Run(args []string) error {
 	}
 	logging.Debugf("Analysis for:\n%s", d)
 
-	// TODO: this is a good place to do goroutines iterate over sources and do stuff.
+	// Only encodes missing analysis results are analysed when resuming,
+	// cross-encode results (e.g. scheme CDF) are still made of all encodes.
+	pending := srcData
+	if a.flResume {
+		pending = make(map[string]sourceData, len(srcData))
+		for k, v := range srcData {
+			if a.analysed(v) {
+				logging.Infof("Analysis of %s already done, skipping", v.CompressedFile)
+				continue
+			}
+			pending[k] = v
+		}
+	}
 
-	for _, v := range srcData {
-		// Create separate dir for results.
-		base := path.Base(v.CompressedFile)
-		base = strings.TrimSuffix(base, path.Ext(base))
-		logging.Infof("Analysing %s", v.CompressedFile)
-		resDir := path.Join(a.flOutDir, base)
-		if err := os.MkdirAll(resDir, os.FileMode(0o755)); err != nil {
-			return &AppError{
-				msg:      fmt.Sprintf("failed creating directory: %s", err),
-				exitCode: 1,
+	// Fail early rather than midway through plotting.
+	if err := checkVqmResultFiles(pending); err != nil {
+		return &AppError{exitCode: 1, msg: err.Error()}
+	}
+
+	// Analyse sources concurrently with bounded number of workers, each
+	// source has it's own result directory so plot files do not collide.
+	jobs := make(chan sourceData)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []string
+	for i := 0; i < a.flJobs; i++ {
+		// With multiple workers prefix output with worker ID, so that
+		// interleaved messages are attributable.
+		var logger logging.Logger
+		if a.flJobs > 1 {
+			logger = logging.WithField("worker", i+1)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range jobs {
+				if err := a.analyseSource(v, logger); err != nil {
+					logger.Infof("Analysis of %s failed: %s", v.CompressedFile, err)
+					mu.Lock()
+					errs = append(errs, err.Error())
+					mu.Unlock()
+				}
 			}
+		}()
+	}
+	for _, v := range pending {
+		jobs <- v
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return &AppError{
+			msg:      fmt.Sprintf("analysis had %d error(s):\n%s", len(errs), strings.Join(errs, "\n")),
+			exitCode: 1,
 		}
+	}
 
-		compressedFile := v.CompressedFile
-		vqmFile := v.VqmResultFile
-		// In case compressed and VQM result file path in not absolute we assume
-		// it must be relative to WorkDir.
-		if !path.IsAbs(compressedFile) {
-			compressedFile = path.Join(v.WorkDir, compressedFile)
+	if a.flSchemeCDF {
+		cdfPlot := path.Join(a.flOutDir, "vmaf_cdf_by_scheme.png")
+		cdfOpts := append(a.styleOpts[:len(a.styleOpts):len(a.styleOpts)], analysis.WithPNGCompression(a.flPNGCompression))
+		if err := writeSchemeCDF(srcData, cdfPlot, cdfOpts...); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
 		}
-		if !path.IsAbs(vqmFile) {
-			vqmFile = path.Join(v.WorkDir, vqmFile)
+		logging.Infof("Scheme VMAF CDF plot done: %s", cdfPlot)
+	}
+
+	if a.flBundle != "" {
+		var skip func(string) bool
+		if !a.flBundleVQM {
+			skip = isVqmJSON
+		}
+		if err := writeBundle(a.flBundle, a.flSrcReport, a.flOutDir, skip); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
 		}
-		bitratePlot := path.Join(resDir, base+"_bitrate.png")
-		vmafPlot := path.Join(resDir, base+"_vmaf.png")
-		psnrPlot := path.Join(resDir, base+"_psnr.png")
-		msssimPlot := path.Join(resDir, base+"_ms-ssim.png")
+		logging.Infof("Results bundle written to %s", a.flBundle)
+	}
 
-		jsonFd, err := os.Open(vqmFile)
-		if err != nil {
-			return &AppError{
-				msg:      fmt.Sprintf("failed opening VQM file: %s", err),
-				exitCode: 1,
+	return nil
+}
+
+// resultBase returns base name and result directory of analysis artifacts for
+// single encoded file.
+func (a *AnalyseApp) resultBase(v sourceData) (base, resDir string) {
+	base = path.Base(v.CompressedFile)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	return base, path.Join(a.flOutDir, base)
+}
+
+// analysed reports whether all analysis artifacts for single encoded file
+// (given current flags) already exist and are not empty.
+func (a *AnalyseApp) analysed(v sourceData) bool {
+	base, resDir := a.resultBase(v)
+	exists := func(names ...string) bool {
+		for _, n := range names {
+			if fi, err := os.Stat(path.Join(resDir, n)); err == nil && fi.Size() > 0 {
+				return true
 			}
 		}
+		return false
+	}
 
-		var frameMetrics vqm.FrameMetrics
-		err = frameMetrics.FromFfmpegVMAF(jsonFd)
-		// Close jsonFd file descriptor at earliest convenience. Should avoid use of defer
-		// in loop in this case.
-		jsonFd.Close()
+	if v.VqmResultFile == "" || !exists(path.Base(v.vqmFile())) {
+		return false
+	}
+	var want []string
+	if a.flFrameTypes {
+		want = append(want, base+"_frame_types.json")
+	}
+	if a.flFrameMetrics != "" {
+		want = append(want, base+"_frame_metrics."+a.flFrameMetrics)
+	}
+	if a.flCorrelate {
+		want = append(want, base+"_correlate.png")
+	}
+	if a.flSceneVMAF && len(v.SceneCuts) > 0 {
+		want = append(want, base+"_scenes.csv", base+"_scenes.png")
+	}
+	if a.flDashboard || a.flDashboardOnly {
+		want = append(want, base+"_dashboard.png")
+	}
+	if !a.flDashboardOnly {
+		if a.flPlots.Bitrate {
+			want = append(want, base+"_bitrate.png")
+		}
+		if a.flPlots.VMAF {
+			want = append(want, base+"_vmaf.png")
+		}
+		if a.flPlots.PSNR {
+			want = append(want, base+"_psnr.png")
+		}
+	}
+	for _, n := range want {
+		if !exists(n) {
+			return false
+		}
+	}
+	// SSIM plot replaces MS-SSIM plot when MS-SSIM is missing.
+	return a.flDashboardOnly || !a.flPlots.MS_SSIM || exists(base+"_ms-ssim.png", base+"_ssim.png")
+}
+
+// analyseSource will create analysis artifacts (plots) for single encoded file.
+func (a *AnalyseApp) analyseSource(v sourceData, logger logging.Logger) error {
+	// Create separate dir for results.
+	base, resDir := a.resultBase(v)
+	logger.Infof("Analysing %s", v.CompressedFile)
+	if err := perm.MkdirAll(resDir); err != nil {
+		return fmt.Errorf("failed creating directory: %w", err)
+	}
+
+	if v.VqmResultFile == "" {
+		return fmt.Errorf("no VQM result file for %s (removed via -keep-vqm-json=false?)", v.CompressedFile)
+	}
+	compressedFile := v.CompressedFile
+	vqmFile := v.vqmFile()
+	// In case compressed file path in not absolute we assume it must be
+	// relative to WorkDir.
+	if !path.IsAbs(compressedFile) {
+		compressedFile = path.Join(v.WorkDir, compressedFile)
+	}
+	bitratePlot := path.Join(resDir, base+"_bitrate.png")
+	vmafPlot := path.Join(resDir, base+"_vmaf.png")
+	psnrPlot := path.Join(resDir, base+"_psnr.png")
+	msssimPlot := path.Join(resDir, base+"_ms-ssim.png")
+
+	// Keep raw libvmaf result along with plots for auditing.
+	vqmCopy := path.Join(resDir, path.Base(vqmFile))
+	if err := copyFile(vqmFile, vqmCopy); err != nil {
+		return fmt.Errorf("failed copying VQM file: %w", err)
+	}
+
+	jsonFd, err := os.Open(vqmFile)
+	if err != nil {
+		return fmt.Errorf("failed opening VQM file: %w", err)
+	}
+
+	var frameMetrics vqm.FrameMetrics
+	err = frameMetrics.FromFfmpegVMAFWithAliases(jsonFd, v.FieldAliases)
+	jsonFd.Close()
+	if err != nil {
+		return fmt.Errorf("failed converting to FrameMetrics: %w", err)
+	}
+
+	var vmafs, psnrs, msssims []float64
+	for _, v := range frameMetrics {
+		vmafs = append(vmafs, v.VMAF)
+		psnrs = append(psnrs, v.PSNR)
+		msssims = append(msssims, v.MS_SSIM)
+	}
+
+	// Missing metrics are only filled in when they are going to be plotted.
+	dashboard := a.flDashboard || a.flDashboardOnly
+	fillPSNR := allZero(psnrs) && (dashboard || (a.flPlots.PSNR && !a.flDashboardOnly))
+	fillSSIM := allZero(msssims) && (dashboard || (a.flPlots.MS_SSIM && !a.flDashboardOnly))
+	ssimMetric, ssimPlot := "MS-SSIM", msssimPlot
+	if a.flFillMetrics && (fillPSNR || fillSSIM) {
+		sourceFile := v.SourceFile
+		if !path.IsAbs(sourceFile) {
+			sourceFile = path.Join(v.WorkDir, sourceFile)
+		}
+		psnr, ssim, err := vqm.MeasurePSNRSSIM(compressedFile, sourceFile, v.VMAFGeometry)
 		if err != nil {
-			return &AppError{
-				msg:      fmt.Sprintf("failed converting to FrameMetrics: %s", err),
-				exitCode: 1,
-			}
+			return fmt.Errorf("failed calculating missing metrics: %w", err)
+		}
+		if fillPSNR {
+			psnrs = psnr
+			logger.Infof("PSNR missing from %s, calculated via ffmpeg psnr filter", vqmFile)
 		}
+		// MS-SSIM is not available as ffmpeg filter, so plain SSIM is
+		// plotted instead.
+		if fillSSIM {
+			msssims = ssim
+			ssimMetric, ssimPlot = "SSIM", path.Join(resDir, base+"_ssim.png")
+			logger.Infof("MS-SSIM missing from %s, SSIM calculated via ffmpeg ssim filter", vqmFile)
+		}
+	}
+
+	plotOpts := append(a.styleOpts[:len(a.styleOpts):len(a.styleOpts)], analysis.WithPNGCompression(a.flPNGCompression))
 
-		var vmafs, psnrs, msssims []float64
-		for _, v := range frameMetrics {
-			vmafs = append(vmafs, v.VMAF)
-			psnrs = append(psnrs, v.PSNR)
-			msssims = append(msssims, v.MS_SSIM)
+	var frameStats []analysis.FrameStat
+	if dashboard || a.flCorrelate {
+		frameStats, err = analysis.GetFrameStats(compressedFile)
+		if err != nil {
+			return fmt.Errorf("failed getting frame stats: %w", err)
 		}
+	}
 
-		if err := analysis.MultiPlotBitrate(compressedFile, bitratePlot); err != nil {
-			return &AppError{
-				msg:      fmt.Sprintf("failed creating bitrate plot: %s", err),
-				exitCode: 1,
-			}
+	if a.flFrameTypes {
+		frameTypesFile := path.Join(resDir, base+"_frame_types.json")
+		if err := writeFrameTypesFile(compressedFile, frameTypesFile); err != nil {
+			return err
 		}
-		logging.Infof("Bitrate plot done: %s", bitratePlot)
+		logger.Infof("Frame type stats done: %s", frameTypesFile)
+	}
 
-		if err := analysis.MultiPlotVqm(vmafs, "VMAF", base, vmafPlot); err != nil {
-			return &AppError{
-				msg:      fmt.Sprintf("failed creating VMAF multiplot: %s", err),
-				exitCode: 1,
-			}
+	if a.flFrameMetrics != "" {
+		frameMetricsFile := path.Join(resDir, base+"_frame_metrics."+a.flFrameMetrics)
+		if err := writeFrameMetricsFile(frameMetrics, a.flFrameMetrics, frameMetricsFile, a.flPrecision); err != nil {
+			return err
 		}
-		logging.Infof("VMAF multi-plot done: %s", vmafPlot)
+		logger.Infof("Per frame metrics export done: %s", frameMetricsFile)
+	}
 
-		if err := analysis.MultiPlotVqm(psnrs, "PSNR", base, psnrPlot); err != nil {
-			return &AppError{
-				msg:      fmt.Sprintf("failed creating PSNR multiplot: %s", err),
-				exitCode: 1,
-			}
+	// Scene cuts are timestamps, map them to frames of compressed file.
+	var cutFrames []float64
+	if len(v.SceneCuts) > 0 && (a.flSceneVMAF || (!a.flDashboardOnly && a.flPlots.VMAF)) {
+		vmeta, err := tools.FfprobeExtractMetadata(compressedFile)
+		if err != nil {
+			return fmt.Errorf("failed getting video metadata: %w", err)
 		}
-		logging.Infof("PSNR multi-plot done: %s", psnrPlot)
+		fps, err := vmeta.FrameRateFrom(a.flFrameRate)
+		if err != nil {
+			return fmt.Errorf("failed getting frame rate: %w", err)
+		}
+		cutFrames = sceneCutFrames(v.SceneCuts, fps)
+	}
 
-		if err := analysis.MultiPlotVqm(msssims, "MS-SSIM", base, msssimPlot); err != nil {
-			return &AppError{
-				msg:      fmt.Sprintf("failed creating MS-SSIM multiplot: %s", err),
-				exitCode: 1,
+	if a.flSceneVMAF {
+		if len(cutFrames) == 0 {
+			logger.Infof("No scene cuts for %s, per scene VMAF skipped (see encode -scene-cuts)", v.CompressedFile)
+		} else {
+			scenesFile := path.Join(resDir, base+"_scenes.csv")
+			scenesPlot := path.Join(resDir, base+"_scenes.png")
+			if err := writeSceneVMAF(frameMetrics, cutFrames, a.flPrecision.VMAF, base, scenesFile, scenesPlot, plotOpts...); err != nil {
+				return err
 			}
+			logger.Infof("Per scene VMAF done: %s, %s", scenesFile, scenesPlot)
+		}
+	}
+
+	if a.flCorrelate {
+		correlatePlot := path.Join(resDir, base+"_correlate.png")
+		if err := analysis.SaveCorrelatePlot(vmafs, frameStats, "VMAF", base, correlatePlot, plotOpts...); err != nil {
+			return fmt.Errorf("failed creating correlation plot: %w", err)
 		}
-		logging.Infof("MS-SSIM multi-plot done: %s", msssimPlot)
+		logger.Infof("Correlation plot done: %s", correlatePlot)
 	}
 
+	if dashboard {
+		dashboardPlot := path.Join(resDir, base+"_dashboard.png")
+		data := analysis.DashboardData{
+			Title:      base,
+			FrameStats: frameStats,
+			VMAF:       vmafs,
+			PSNR:       psnrs,
+			MS_SSIM:    msssims,
+			SSIMMetric: ssimMetric,
+		}
+		if err := analysis.CreateDashboard(data, dashboardPlot, plotOpts...); err != nil {
+			return fmt.Errorf("failed creating dashboard plot: %w", err)
+		}
+		logger.Infof("Dashboard plot done: %s", dashboardPlot)
+	}
+	if a.flDashboardOnly {
+		return nil
+	}
+
+	if a.flPlots.Bitrate {
+		if err := analysis.MultiPlotBitrate(compressedFile, bitratePlot, plotOpts...); err != nil {
+			return fmt.Errorf("failed creating bitrate plot: %w", err)
+		}
+		logger.Infof("Bitrate plot done: %s", bitratePlot)
+	}
+
+	vmafOpts := plotOpts[:len(plotOpts):len(plotOpts)]
+	psnrOpts := plotOpts[:len(plotOpts):len(plotOpts)]
+	msssimOpts := plotOpts[:len(plotOpts):len(plotOpts)]
+	if a.flJitter {
+		vmafOpts = append(vmafOpts, analysis.WithJitter(vqm.Jitter(vmafs)))
+		psnrOpts = append(psnrOpts, analysis.WithJitter(vqm.Jitter(psnrs)))
+		msssimOpts = append(msssimOpts, analysis.WithJitter(vqm.Jitter(msssims)))
+	}
+	if len(cutFrames) > 0 {
+		vmafOpts = append(vmafOpts, analysis.WithMarkers(cutFrames))
+		logger.Infof("%d scene cuts marked on VMAF plot", len(v.SceneCuts))
+	}
+	if a.flPlots.VMAF {
+		if err := analysis.MultiPlotVqm(vmafs, "VMAF", base, vmafPlot, vmafOpts...); err != nil {
+			return fmt.Errorf("failed creating VMAF multiplot: %w", err)
+		}
+		logger.Infof("VMAF multi-plot done: %s", vmafPlot)
+	}
+
+	if a.flPlots.PSNR {
+		if err := analysis.MultiPlotVqm(psnrs, "PSNR", base, psnrPlot, psnrOpts...); err != nil {
+			return fmt.Errorf("failed creating PSNR multiplot: %w", err)
+		}
+		logger.Infof("PSNR multi-plot done: %s", psnrPlot)
+	}
+
+	if a.flPlots.MS_SSIM {
+		if err := analysis.MultiPlotVqm(msssims, ssimMetric, base, ssimPlot, msssimOpts...); err != nil {
+			return fmt.Errorf("failed creating %s multiplot: %w", ssimMetric, err)
+		}
+		logger.Infof("%s multi-plot done: %s", ssimMetric, ssimPlot)
+	}
+
+	return nil
+}
+
+// writeSchemeCDF will create VMAF CDF plot with a line per encoding scheme,
+// per frame VMAF values of all encodes within scheme are pooled together.
+func writeSchemeCDF(srcData map[string]sourceData, outFile string, opts ...analysis.PlotOption) error {
+	series, err := schemeVMAFs(srcData)
+	if err != nil {
+		return err
+	}
+	if err := analysis.SaveMultiCDFPlot(series, "VMAF", "VMAF CDF by scheme", outFile, opts...); err != nil {
+		return fmt.Errorf("failed creating scheme CDF plot: %w", err)
+	}
 	return nil
 }
+
+// schemeVMAFs will load per frame VMAF values from VQM result files and group
+// them by encoding scheme name.
+func schemeVMAFs(srcData map[string]sourceData) (map[string][]float64, error) {
+	series := make(map[string][]float64)
+	for _, v := range srcData {
+		if v.VqmResultFile == "" {
+			return nil, fmt.Errorf("no VQM result file for %s", v.CompressedFile)
+		}
+		vqmFile := v.vqmFile()
+		fm, err := loadFrameMetrics(vqmFile, v.FieldAliases)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading VQM file %s: %w", vqmFile, err)
+		}
+		for _, m := range fm {
+			series[v.Name] = append(series[v.Name], m.VMAF)
+		}
+	}
+	return series, nil
+}
+
+// writeFrameTypesFile will write frame type distribution stats of video file
+// as JSON into outFile.
+func writeFrameTypesFile(videoFile, outFile string) error {
+	frames, err := analysis.GetFrameTypes(videoFile)
+	if err != nil {
+		return fmt.Errorf("failed getting frame types: %w", err)
+	}
+	d, err := json.MarshalIndent(analysis.NewFrameTypeStats(frames), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed marshaling frame type stats: %w", err)
+	}
+	w, err := perm.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("failed creating frame type stats file: %w", err)
+	}
+	if _, err := w.Write(d); err != nil {
+		w.Close()
+		return fmt.Errorf("failed writing frame type stats file: %w", err)
+	}
+	return w.Close()
+}
+
+// writeSceneVMAF will write per scene mean VMAF ranking (worst scene first) as
+// CSV with VMAF rounded to given decimal places into outFile and per scene VMAF
+// bar chart into plotFile.
+func writeSceneVMAF(fm vqm.FrameMetrics, cutFrames []float64, places int, title, outFile, plotFile string, opts ...analysis.PlotOption) error {
+	cuts := make([]int, len(cutFrames))
+	for i, v := range cutFrames {
+		cuts[i] = int(v)
+	}
+	scenes := fm.SceneVMAF(cuts)
+
+	sceneVMAFs := make([]float64, len(scenes))
+	for i, s := range scenes {
+		sceneVMAFs[i] = s.VMAF
+	}
+	if err := analysis.SaveSceneVMAFPlot(sceneVMAFs, title, plotFile, opts...); err != nil {
+		return fmt.Errorf("failed creating per scene VMAF plot: %w", err)
+	}
+
+	vqm.RankScenes(scenes)
+	w, err := perm.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("failed creating per scene VMAF file: %w", err)
+	}
+	if err := writeSceneRanking(w, scenes, places); err != nil {
+		w.Close()
+		return fmt.Errorf("failed writing per scene VMAF file: %w", err)
+	}
+	return w.Close()
+}
+
+// writeSceneRanking will write ranked scenes as CSV to w, VMAF is rounded to
+// given decimal places.
+func writeSceneRanking(w io.Writer, scenes []vqm.SceneMetric, places int) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"Rank", "Scene", "StartFrame", "EndFrame", "VMAF", "MinVMAF"}); err != nil {
+		return err
+	}
+	for i, s := range scenes {
+		row := []string{
+			strconv.Itoa(i + 1),
+			strconv.Itoa(s.Scene),
+			strconv.Itoa(s.StartFrame),
+			strconv.Itoa(s.EndFrame),
+			formatFloat(s.VMAF, places),
+			formatFloat(s.MinVMAF, places),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Per frame metrics export formats.
+const (
+	frameMetricsCSV   = "csv"
+	frameMetricsJSONL = "jsonl"
+)
+
+// isFrameMetricsFormat reports whether f is a valid per frame metrics export
+// format.
+func isFrameMetricsFormat(f string) bool {
+	return f == frameMetricsCSV || f == frameMetricsJSONL
+}
+
+// writeFrameMetricsFile will export per frame metrics into file in given
+// format, CSV metrics are formatted with given precision.
+func writeFrameMetricsFile(fm vqm.FrameMetrics, format, outFile string, p metricPrecision) error {
+	w, err := perm.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("failed creating per frame metrics file: %w", err)
+	}
+	switch format {
+	case frameMetricsCSV:
+		err = fm.ToCSV(w, p.vqm())
+	case frameMetricsJSONL:
+		err = fm.ToJSONLines(w)
+	default:
+		err = fmt.Errorf("unsupported format %s", format)
+	}
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("failed writing per frame metrics file: %w", err)
+	}
+	return w.Close()
+}
+
+// plotSet is a set of per metric plots created for each encode.
+type plotSet struct {
+	Bitrate bool
+	VMAF    bool
+	PSNR    bool
+	MS_SSIM bool
+}
+
+// allPlots is default plot set.
+var allPlots = plotSet{Bitrate: true, VMAF: true, PSNR: true, MS_SSIM: true}
+
+// parsePlotSet will parse comma separated list of plot names (e.g.
+// "bitrate,vmaf"), at least one plot should be given.
+func parsePlotSet(s string) (plotSet, error) {
+	var p plotSet
+	for _, item := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(item)) {
+		case "bitrate":
+			p.Bitrate = true
+		case "vmaf":
+			p.VMAF = true
+		case "psnr":
+			p.PSNR = true
+		// SSIM plot replaces MS-SSIM plot when MS-SSIM is missing, so both
+		// names select it.
+		case "ms-ssim", "ms_ssim", "ssim":
+			p.MS_SSIM = true
+		default:
+			return p, fmt.Errorf("unknown plot %q, should be one of: bitrate, vmaf, psnr, ms-ssim", item)
+		}
+	}
+	return p, nil
+}
+
+// String returns comma separated list of plot names in the set.
+func (p plotSet) String() string {
+	var names []string
+	for _, v := range []struct {
+		name string
+		on   bool
+	}{
+		{"bitrate", p.Bitrate},
+		{"vmaf", p.VMAF},
+		{"psnr", p.PSNR},
+		{"ms-ssim", p.MS_SSIM},
+	} {
+		if v.on {
+			names = append(names, v.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// plotSetFlag is a flag.Value for plot set.
+type plotSetFlag struct {
+	plots *plotSet
+}
+
+func (f plotSetFlag) String() string {
+	if f.plots == nil {
+		return ""
+	}
+	return f.plots.String()
+}
+
+func (f plotSetFlag) Set(s string) error {
+	p, err := parsePlotSet(s)
+	if err != nil {
+		return err
+	}
+	*f.plots = p
+	return nil
+}
+
+// allZero reports whether all values are zero, e.g. metric was not computed.
+func allZero(values []float64) bool {
+	for _, v := range values {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkVqmResultFiles will check that VQM result files of all encoded files
+// are present, all problems are reported in a single error.
+func checkVqmResultFiles(srcData map[string]sourceData) error {
+	var problems []string
+	for _, v := range srcData {
+		if v.VqmResultFile == "" {
+			problems = append(problems, fmt.Sprintf("no VQM result file for %s (removed via -keep-vqm-json=false?)", v.CompressedFile))
+			continue
+		}
+		if _, err := os.Stat(v.vqmFile()); err != nil {
+			problems = append(problems, fmt.Sprintf("VQM result file for %s: %s", v.CompressedFile, err))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	// Map iteration order is random, keep error message stable.
+	sort.Strings(problems)
+	return fmt.Errorf("missing VQM result files:\n%s", strings.Join(problems, "\n"))
+}
+
+// excludeWithoutVqm will remove encodes without existing VQM result file (e.g.
+// failed encode or VQM measurement) from srcData, so that they are not
+// analysed. Compressed files of excluded encodes are returned sorted.
+func excludeWithoutVqm(srcData map[string]sourceData) (excluded []string) {
+	for k, v := range srcData {
+		if v.VqmResultFile != "" {
+			if _, err := os.Stat(v.vqmFile()); err == nil {
+				continue
+			}
+		}
+		excluded = append(excluded, v.CompressedFile)
+		delete(srcData, k)
+	}
+	sort.Strings(excluded)
+	return excluded
+}
+
+// sceneCutFrames converts scene cut timestamps (in seconds) to frame numbers.
+func sceneCutFrames(sceneCuts []float64, fps float64) []float64 {
+	frames := make([]float64, len(sceneCuts))
+	for i, v := range sceneCuts {
+		frames[i] = math.Round(v * fps)
+	}
+	return frames
+}
@@ -9,16 +9,15 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/evolution-gaming/ease/internal/analysis"
 	"github.com/evolution-gaming/ease/internal/logging"
-	"gonum.org/v1/plot"
-	"gonum.org/v1/plot/vg"
-	"gonum.org/v1/plot/vg/draw"
-	"gonum.org/v1/plot/vg/vgimg"
+	"github.com/evolution-gaming/ease/internal/perm"
 )
 
 // Make sure BitrateApp implements Commander interface.
@@ -32,6 +31,36 @@ type BitrateApp struct {
 	flInFile string
 	// Plot output file
 	flOutFile string
+	// Legend position and offsets
+	flLegend      string
+	flLegendXOffs float64
+	flLegendYOffs float64
+	// Bitrate and frame size units
+	flUnits string
+	// X axis tick interval in seconds
+	flTickInterval float64
+	// Bitrate computation mode
+	flMode string
+	// Multi-plot tile layout
+	flLayoutRows int
+	flLayoutCols int
+	// Plot color theme
+	flTheme string
+	// Print frame type distribution stats flag
+	flFrameTypes bool
+	// PNG compression level of plot images
+	flPNGCompression string
+	// Per second bitrate CSV output file
+	flCSVFile string
+	// Target rate (Kbps) and buffer size (Kbits) of cumulative bits plot
+	flCumulativeRate   float64
+	flCumulativeBuffer float64
+	// Logarithmic bitrate axis flag
+	flLogScale bool
+	// Plot font flags
+	flFont fontFlags
+	// Plot style file
+	flStyle string
 }
 
 // CreateBitrateCommand will create Commander instance from BitrateApp.
@@ -42,6 +71,22 @@ func CreateBitrateCommand() Commander {
 	}
 	app.fs.StringVar(&app.flInFile, "i", "", "Input video file (mandatory)")
 	app.fs.StringVar(&app.flOutFile, "o", "", "File to save plot to")
+	app.fs.StringVar(&app.flLegend, "legend", analysis.LegendTop, "Legend position (top, bottom, none)")
+	app.fs.Float64Var(&app.flLegendXOffs, "legend-x-offset", -10, "Legend horizontal offset in points")
+	app.fs.Float64Var(&app.flLegendYOffs, "legend-y-offset", -10, "Legend vertical offset in points")
+	app.fs.StringVar(&app.flUnits, "units", analysis.UnitsAuto, "Bitrate and frame size units (auto, kilo, mega)")
+	app.fs.StringVar(&app.flMode, "mode", analysis.BitrateModeSecond, "Bitrate computation mode: second (1s buckets), gop (per GOP average), window (1s sliding window)")
+	app.fs.Var(layoutFlag{&app.flLayoutRows, &app.flLayoutCols}, "layout", "Multi-plot tile layout as ROWSxCOLS, e.g. 1x2 (default 2x1)")
+	app.fs.StringVar(&app.flTheme, "theme", analysis.ThemeLight, "Plot color theme (light, dark)")
+	app.fs.StringVar(&app.flPNGCompression, "png-compression", analysis.PNGCompressionDefault, "PNG compression level of plot images (default, none, speed, best), best trades CPU for smaller files")
+	app.fs.BoolVar(&app.flFrameTypes, "frame-types", false, "Also print frame type (I/P/B) distribution and I-frame interval stats (requires decoding video)")
+	app.fs.Float64Var(&app.flTickInterval, "tick-interval", 0, "Time axis tick interval in seconds (default is picked based on duration)")
+	app.fs.StringVar(&app.flCSVFile, "csv", "", "Also write per second bitrate (total, I-frame, P-frame) in Kbps to CSV file")
+	app.fs.Float64Var(&app.flCumulativeRate, "cumulative-rate", 0, "Also plot cumulative bits against given constant rate in Kbps (leaky bucket compliance), plot is saved next to -o with _cumulative suffix")
+	app.fs.Float64Var(&app.flCumulativeBuffer, "cumulative-buffer", 0, "Leaky bucket size in Kbits for -cumulative-rate (default is one second at given rate)")
+	app.fs.BoolVar(&app.flLogScale, "log", false, "Use logarithmic bitrate axis, useful when bitrate peaks dwarf the baseline")
+	app.flFont.register(app.fs)
+	app.fs.StringVar(&app.flStyle, "style", "", "Plot style JSON file (theme, colors, fonts, legend), flags given explicitly take precedence")
 
 	app.fs.Usage = func() {
 		printSubCommandUsage(longHelp, app.fs)
@@ -66,6 +111,77 @@ func (a *BitrateApp) Run(args []string) error {
 		}
 	}
 
+	if !analysis.IsLegendPosition(a.flLegend) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid legend position: %s", a.flLegend),
+		}
+	}
+
+	if !analysis.IsUnits(a.flUnits) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid units: %s", a.flUnits),
+		}
+	}
+
+	if !analysis.IsBitrateMode(a.flMode) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid bitrate mode: %s", a.flMode),
+		}
+	}
+
+	if !analysis.IsTheme(a.flTheme) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid theme: %s", a.flTheme),
+		}
+	}
+
+	if !analysis.IsPNGCompression(a.flPNGCompression) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid PNG compression: %s", a.flPNGCompression),
+		}
+	}
+
+	if a.flTickInterval < 0 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "option -tick-interval should not be negative",
+		}
+	}
+
+	if a.flCumulativeRate < 0 || a.flCumulativeBuffer < 0 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "options -cumulative-rate and -cumulative-buffer should not be negative",
+		}
+	}
+
+	style, err := plotStyle(a.fs, a.flStyle)
+	if err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      err.Error(),
+		}
+	}
+	styleOpts, err := style.Options()
+	if err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      err.Error(),
+		}
+	}
+
 	if a.flOutFile == "" {
 		base := path.Base(a.flInFile)
 		base = strings.TrimSuffix(base, path.Ext(base))
@@ -73,14 +189,69 @@ func (a *BitrateApp) Run(args []string) error {
 	}
 
 	logging.Infof("Output will be written to:\n\t%s\n", a.flOutFile)
-	err := run(a.flInFile, a.flOutFile)
-	if err != nil {
+	opts := append([]analysis.PlotOption{
+		analysis.WithUnits(a.flUnits),
+		analysis.WithTickInterval(a.flTickInterval),
+		analysis.WithBitrateMode(a.flMode),
+		analysis.WithLogScale(a.flLogScale),
+		analysis.WithLayout(a.flLayoutRows, a.flLayoutCols),
+		analysis.WithPNGCompression(a.flPNGCompression),
+	}, styleOpts...)
+	if err := run(a.flInFile, a.flOutFile, opts...); err != nil {
 		return &AppError{
 			exitCode: 1,
 			msg:      err.Error(),
 		}
 	}
 
+	if a.flCumulativeRate > 0 {
+		cumulativeFile := strings.TrimSuffix(a.flOutFile, path.Ext(a.flOutFile)) + "_cumulative.png"
+		logging.Infof("Cumulative bits plot will be written to:\n\t%s\n", cumulativeFile)
+		opts := append([]analysis.PlotOption{
+			analysis.WithBufferSize(a.flCumulativeBuffer),
+			analysis.WithUnits(a.flUnits),
+			analysis.WithTickInterval(a.flTickInterval),
+			analysis.WithPNGCompression(a.flPNGCompression),
+		}, styleOpts...)
+		if err := writeCumulativeBitsPlot(a.flInFile, cumulativeFile, a.flCumulativeRate, opts...); err != nil {
+			return &AppError{
+				exitCode: 1,
+				msg:      err.Error(),
+			}
+		}
+	}
+
+	if a.flCSVFile != "" {
+		logging.Infof("Bitrate CSV will be written to:\n\t%s\n", a.flCSVFile)
+		if err := writeBitrateCSV(a.flInFile, a.flCSVFile); err != nil {
+			return &AppError{
+				exitCode: 1,
+				msg:      err.Error(),
+			}
+		}
+	}
+
+	if a.flFrameTypes {
+		frames, err := analysis.GetFrameTypes(a.flInFile)
+		if err != nil {
+			return &AppError{
+				exitCode: 1,
+				msg:      fmt.Sprintf("failed getting frame types: %s", err),
+			}
+		}
+		stats := analysis.NewFrameTypeStats(frames)
+		write := writeFrameTypeStats
+		if porcelain {
+			write = func(w io.Writer, s analysis.FrameTypeStats) error { return writePorcelain(w, s) }
+		}
+		if err := write(os.Stdout, stats); err != nil {
+			return &AppError{
+				exitCode: 1,
+				msg:      err.Error(),
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -92,67 +263,54 @@ func (a *BitrateApp) Help() {
 	a.fs.Usage()
 }
 
-func run(videoFile, plotFile string) error {
+func run(videoFile, plotFile string, opts ...analysis.PlotOption) error {
 	if _, err := os.Stat(videoFile); os.IsNotExist(err) {
 		return fmt.Errorf("video file should exist: %w", err)
 	}
-	base := path.Base(videoFile)
 
+	return analysis.MultiPlotBitrate(videoFile, plotFile, opts...)
+}
+
+// writeBitrateCSV will write per second bitrate series of video file to CSV
+// file.
+func writeBitrateCSV(videoFile, csvFile string) error {
 	fs, err := analysis.GetFrameStats(videoFile)
 	if err != nil {
-		return fmt.Errorf("failed getting FrameStats: %w", err)
-	}
-
-	// Create a 2D slice to hold subplots. This is the state of gonum's API at this point
-	// unfortunately.
-	const rows, cols = 2, 1
-	plots := make([][]*plot.Plot, rows)
-	for i := range plots {
-		plots[i] = make([]*plot.Plot, cols)
+		return fmt.Errorf("failed getting frame stats: %w", err)
 	}
-
-	plots[0][0], err = analysis.CreateBitratePlot(fs)
+	f, err := perm.Create(csvFile)
 	if err != nil {
 		return err
 	}
-
-	plots[1][0], err = analysis.CreateFrameSizePlot(fs)
-	if err != nil {
+	defer f.Close()
+	if err := analysis.SecondBitrates(fs).ToCSV(f); err != nil {
 		return err
 	}
+	return f.Close()
+}
 
-	// Tweak titles and labels to have better layout and make plots less busy.
-	plots[0][0].Title.Text = base + "\n\nBitrate"
-	plots[0][0].X.Label.Text = ""
-	plots[1][0].Title.Text = "Frame sizes"
-
-	img := vgimg.New(vg.Centimeter*24, vg.Centimeter*14)
-	dc := draw.New(img)
-
-	t := draw.Tiles{
-		Rows: rows,
-		Cols: cols,
-		PadY: vg.Points(10),
-	}
-
-	canvases := plot.Align(plots, t, dc)
-	for j := 0; j < rows; j++ {
-		for i := 0; i < cols; i++ {
-			if plots[j][i] != nil {
-				plots[j][i].Draw(canvases[j][i])
-			}
-		}
+// writeCumulativeBitsPlot will plot cumulative bits of video file against
+// constant target rate (in Kbps) to plot file.
+func writeCumulativeBitsPlot(videoFile, plotFile string, targetRate float64, opts ...analysis.PlotOption) error {
+	fs, err := analysis.GetFrameStats(videoFile)
+	if err != nil {
+		return fmt.Errorf("failed getting frame stats: %w", err)
 	}
+	return analysis.SaveCumulativeBitsPlot(fs, targetRate, path.Base(videoFile), plotFile, opts...)
+}
 
-	w, err := os.Create(plotFile)
-	if err != nil {
-		panic(err)
+// writeFrameTypeStats will write table of frame type distribution followed by
+// I-frame interval stats.
+func writeFrameTypeStats(w io.Writer, s analysis.FrameTypeStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tCOUNT\tPERCENT\tAVG SIZE (bytes)")
+	for _, t := range s.Types {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.0f\n", t.PictType, t.Count, t.Percent, t.AvgSize)
 	}
-	defer w.Close()
-	png := vgimg.PngCanvas{Canvas: img}
-	if _, err := png.WriteTo(w); err != nil {
-		panic(err)
+	if err := tw.Flush(); err != nil {
+		return err
 	}
-
-	return nil
+	_, err := fmt.Fprintf(w, "I-frame interval (frames): mean %.2f, min %d, max %d, stddev %.2f\n",
+		s.IntervalMean, s.IntervalMin, s.IntervalMax, s.IntervalStdDev)
+	return err
 }
@@ -0,0 +1,94 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Analysis results bundle (zip archive) related functionality.
+
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+)
+
+// isVqmJSON reports whether file is a libvmaf per frame result JSON.
+func isVqmJSON(name string) bool {
+	return strings.HasSuffix(name, "vqm.json")
+}
+
+// writeBundle will package report file and all files under dir into a single
+// zip file, so results are easy to share.
+//
+// Files are streamed into zip one by one, paths in zip are relative to dir and
+// report is stored at zip root. Files for which skip returns true are left out
+// (skip can be nil).
+func writeBundle(zipFile, reportFile, dir string, skip func(name string) bool) (err error) {
+	out, err := perm.Create(zipFile)
+	if err != nil {
+		return fmt.Errorf("writeBundle() %w", err)
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("writeBundle() %w", cerr)
+		}
+	}()
+
+	zw := zip.NewWriter(out)
+	if err := addZipFile(zw, reportFile, path.Base(reportFile)); err != nil {
+		return fmt.Errorf("writeBundle() %w", err)
+	}
+
+	// Bundle may reside inside dir, it must not be added to itself.
+	zipAbs, _ := filepath.Abs(zipFile)
+	walkErr := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if abs, _ := filepath.Abs(p); abs == zipAbs {
+			return nil
+		}
+		if skip != nil && skip(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		return addZipFile(zw, p, filepath.ToSlash(rel))
+	})
+	if walkErr != nil {
+		return fmt.Errorf("writeBundle() %w", walkErr)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("writeBundle() %w", err)
+	}
+	return nil
+}
+
+// addZipFile will stream file src into zip as name.
+func addZipFile(zw *zip.Writer, src, name string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, in)
+	return err
+}
@@ -0,0 +1,71 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_writeBundle(t *testing.T) {
+	tempDir := t.TempDir()
+	reportFile := path.Join(tempDir, "report.json")
+	outDir := path.Join(tempDir, "analysis")
+	files := map[string]string{
+		reportFile: "{}",
+		path.Join(outDir, "clip01", "clip01_vmaf.png"):     "png",
+		path.Join(outDir, "clip01", "clip01_sc1_vqm.json"): "{}",
+	}
+	for f, content := range files {
+		if err := os.MkdirAll(path.Dir(f), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]struct {
+		givenSkip func(string) bool
+		want      []string
+	}{
+		"All files": {
+			want: []string{"clip01/clip01_sc1_vqm.json", "clip01/clip01_vmaf.png", "report.json"},
+		},
+		"Without VQM JSONs": {
+			givenSkip: isVqmJSON,
+			want:      []string{"clip01/clip01_vmaf.png", "report.json"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Bundle inside analysis dir should not include itself.
+			zipFile := path.Join(outDir, "bundle.zip")
+			if err := writeBundle(zipFile, reportFile, outDir, tc.givenSkip); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			zr, err := zip.OpenReader(zipFile)
+			if err != nil {
+				t.Fatalf("Unexpected error opening zip: %v", err)
+			}
+			defer zr.Close()
+			var got []string
+			for _, f := range zr.File {
+				got = append(got, f.Name)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
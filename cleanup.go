@@ -0,0 +1,82 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Removal of run artifacts after report is written, e.g. to save space in CI.
+
+package main
+
+import (
+	"os"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+)
+
+// Cleanup policies, each policy also removes what preceding one does.
+const (
+	// cleanupNone keeps all artifacts
+	cleanupNone = "none"
+	// cleanupIntermediates removes encoder output and log files and libvmaf
+	// result files
+	cleanupIntermediates = "intermediates"
+	// cleanupEncodes additionally removes compressed files
+	cleanupEncodes = "encodes"
+)
+
+// isCleanupPolicy reports whether p is a valid cleanup policy.
+func isCleanupPolicy(p string) bool {
+	switch p {
+	case cleanupNone, cleanupIntermediates, cleanupEncodes:
+		return true
+	}
+	return false
+}
+
+// cleanupFiles returns existing artifact files of report to be removed
+// according to cleanup policy, each file is listed once.
+func cleanupFiles(rep *report, policy string) []string {
+	if policy != cleanupIntermediates && policy != cleanupEncodes {
+		return nil
+	}
+	var files []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		if _, err := os.Stat(name); err == nil {
+			files = append(files, name)
+		}
+	}
+	for i := range rep.EncodingResult.RunResults {
+		r := &rep.EncodingResult.RunResults[i]
+		add(r.OutputFile)
+		add(r.LogFile)
+	}
+	for i := range rep.VQMResults {
+		add(rep.VQMResults[i].ResultFile)
+	}
+	if policy == cleanupEncodes {
+		for i := range rep.EncodingResult.RunResults {
+			add(rep.EncodingResult.RunResults[i].CompressedFile)
+		}
+	}
+	return files
+}
+
+// cleanup will remove files, in dry run mode files are only listed. Failure to
+// remove a file is logged and does not stop removal of others.
+func cleanup(files []string, dryRun bool) {
+	for _, f := range files {
+		if dryRun {
+			logging.Infof("Cleanup would remove %s", f)
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			logging.Infof("Unable to remove %s: %s", f, err)
+			continue
+		}
+		logging.Debugf("Removed %s", f)
+	}
+}
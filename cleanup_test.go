@@ -0,0 +1,82 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tests for run artifacts cleanup.
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/vqm"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_cleanupFiles(t *testing.T) {
+	dir := t.TempDir()
+	f := func(name string) string {
+		return path.Join(dir, name)
+	}
+	for _, n := range []string{"a.mp4", "a.out", "a_vqm.json", "b.mp4", "b.out"} {
+		if err := os.WriteFile(f(n), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rep := &report{
+		EncodingResult: encoding.PlanResult{RunResults: []encoding.RunResult{
+			// Log files are only written by some encoders.
+			{EncoderCmd: encoding.EncoderCmd{CompressedFile: f("a.mp4"), OutputFile: f("a.out"), LogFile: f("a.log")}},
+			{EncoderCmd: encoding.EncoderCmd{CompressedFile: f("b.mp4"), OutputFile: f("b.out"), LogFile: f("b.log")}},
+		}},
+		VQMResults: []namedVqmResult{
+			{Name: "a", Result: vqm.Result{CompressedFile: f("a.mp4"), ResultFile: f("a_vqm.json")}},
+		},
+	}
+	tests := map[string]struct {
+		policy string
+		want   []string
+	}{
+		"None": {
+			policy: cleanupNone,
+			want:   nil,
+		},
+		"Intermediates": {
+			policy: cleanupIntermediates,
+			want:   []string{f("a.out"), f("b.out"), f("a_vqm.json")},
+		},
+		"Encodes": {
+			policy: cleanupEncodes,
+			want:   []string{f("a.out"), f("b.out"), f("a_vqm.json"), f("a.mp4"), f("b.mp4")},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := cleanupFiles(rep, tc.policy)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Cleanup files mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_cleanup(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "a.out")
+	if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup([]string{file}, true)
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Expected file to be kept in dry run mode, got %v", err)
+	}
+
+	cleanup([]string{file}, false)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Expected file to be removed, got %v", err)
+	}
+}
@@ -12,9 +12,16 @@ import (
 	"io"
 	"log"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/evolution-gaming/ease/internal/analysis"
 	"github.com/evolution-gaming/ease/internal/encoding"
 	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/perm"
 	"github.com/evolution-gaming/ease/internal/vqm"
 )
 
@@ -39,6 +46,27 @@ func (e *AppError) Error() string {
 	return e.msg
 }
 
+// Exit codes of CLI application, so that scripts (e.g. CI) can branch on kind
+// of failure. Failures that do not fall into any category use exitError.
+const (
+	// exitError is general runtime error
+	exitError = 1
+	// exitUsage is invalid command line usage
+	exitUsage = 2
+	// exitBudgetExceeded means encoding time budget (-max-duration) was
+	// exceeded
+	exitBudgetExceeded = 3
+	// exitConfig means encoding plan config is invalid
+	exitConfig = 4
+	// exitEncode means one or more encodes failed
+	exitEncode = 5
+	// exitVQM means one or more VQM calculations failed
+	exitVQM = 6
+	// exitQualityGate means run completed, but failed one of quality gates
+	// (-min-vmaf, -min-speed, -golden etc.)
+	exitQualityGate = 7
+)
+
 // ExitCode returns CLI application's exit code.
 func (e *AppError) ExitCode() int {
 	return e.exitCode
@@ -92,11 +120,125 @@ func parseReportFile(fPath string) *report {
 	return &r
 }
 
+// loadReportFile will read and parse report JSON file into report type.
+//
+// Unlike parseReportFile errors are returned instead of panicking, since file
+// is user provided.
+func loadReportFile(fPath string) (*report, error) {
+	var r report
+
+	b, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil, fmt.Errorf("loadReportFile() %w", err)
+	}
+
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("loadReportFile() unmarshal %s: %w", fPath, err)
+	}
+
+	return &r, nil
+}
+
+// mergeReports will merge report cur into report prev, so that single report
+// spans multiple runs.
+//
+// Results are identified by compressed file, results from cur replace results
+// for the same compressed file in prev (e.g. scheme re-run) and such
+// duplicates are logged.
+func mergeReports(prev, cur *report) report {
+	merged := report{EncodingResult: cur.EncodingResult}
+	if !prev.EncodingResult.StartTime.IsZero() && prev.EncodingResult.StartTime.Before(cur.EncodingResult.StartTime) {
+		merged.EncodingResult.StartTime = prev.EncodingResult.StartTime
+	}
+	if prev.EncodingResult.EndTime.After(cur.EncodingResult.EndTime) {
+		merged.EncodingResult.EndTime = prev.EncodingResult.EndTime
+	}
+
+	replaced := make(map[string]bool, len(cur.EncodingResult.RunResults))
+	for i := range cur.EncodingResult.RunResults {
+		replaced[cur.EncodingResult.RunResults[i].CompressedFile] = true
+	}
+	var runResults []encoding.RunResult
+	for i := range prev.EncodingResult.RunResults {
+		v := &prev.EncodingResult.RunResults[i]
+		if replaced[v.CompressedFile] {
+			logging.Infof("Replacing previous result for %s", v.CompressedFile)
+			continue
+		}
+		runResults = append(runResults, *v)
+	}
+	merged.EncodingResult.RunResults = append(runResults, cur.EncodingResult.RunResults...)
+
+	for i := range prev.VQMResults {
+		if !replaced[prev.VQMResults[i].CompressedFile] {
+			merged.VQMResults = append(merged.VQMResults, prev.VQMResults[i])
+		}
+	}
+	merged.VQMResults = append(merged.VQMResults, cur.VQMResults...)
+
+	return merged
+}
+
+// excludeFailed will remove results of failed encodes (ones with encoding
+// errors) along with their VQM results from report, so that they do not
+// contribute zeros to statistics. With requireVQM encodes without VQM result
+// (e.g. failed VQM measurement) are considered failed as well. Compressed
+// files of excluded encodes are returned.
+func excludeFailed(r *report, requireVQM bool) (excluded []string) {
+	measured := make(map[string]bool, len(r.VQMResults))
+	for i := range r.VQMResults {
+		measured[r.VQMResults[i].CompressedFile] = true
+	}
+	failed := make(map[string]bool)
+	runResults := make([]encoding.RunResult, 0, len(r.EncodingResult.RunResults))
+	for i := range r.EncodingResult.RunResults {
+		v := &r.EncodingResult.RunResults[i]
+		if len(v.Errors) != 0 || (requireVQM && !measured[v.CompressedFile]) {
+			failed[v.CompressedFile] = true
+			excluded = append(excluded, v.CompressedFile)
+			continue
+		}
+		runResults = append(runResults, *v)
+	}
+	if len(excluded) == 0 {
+		return nil
+	}
+	r.EncodingResult.RunResults = runResults
+
+	vqmResults := make([]namedVqmResult, 0, len(r.VQMResults))
+	for i := range r.VQMResults {
+		if !failed[r.VQMResults[i].CompressedFile] {
+			vqmResults = append(vqmResults, r.VQMResults[i])
+		}
+	}
+	r.VQMResults = vqmResults
+	return excluded
+}
+
 // sourceData is a helper data structure with fields related to single encoded file.
 type sourceData struct {
+	// Name is encoding scheme name
+	Name           string
+	SourceFile     string
 	CompressedFile string
 	WorkDir        string
 	VqmResultFile  string
+	// VMAFGeometry is ffmpeg filter chain applied to both inputs before
+	// comparison
+	VMAFGeometry string
+	// SceneCuts are source scene cut timestamps (in seconds)
+	SceneCuts []float64
+	// FieldAliases are libvmaf JSON keys of metrics in VQM result file
+	FieldAliases vqm.FieldAliases
+}
+
+// vqmFile returns VQM result file path, relative path (from reports of older
+// versions) is resolved against WorkDir.
+func (sd sourceData) vqmFile() string {
+	if sd.VqmResultFile == "" || path.IsAbs(sd.VqmResultFile) {
+		return sd.VqmResultFile
+	}
+	return path.Join(sd.WorkDir, sd.VqmResultFile)
 }
 
 // extractSourceData create mapping from compressed file to sourceData.
@@ -110,8 +252,12 @@ func extractSourceData(r *report) map[string]sourceData {
 	for i := range r.EncodingResult.RunResults {
 		v := &r.EncodingResult.RunResults[i]
 		sd := s[v.CompressedFile]
+		sd.Name = v.Name
 		sd.WorkDir = v.WorkDir
+		sd.SourceFile = v.SourceFile
 		sd.CompressedFile = v.CompressedFile
+		sd.VMAFGeometry = v.VMAFGeometry
+		sd.SceneCuts = v.SceneCuts
 		s[v.CompressedFile] = sd
 	}
 
@@ -120,7 +266,325 @@ func extractSourceData(r *report) map[string]sourceData {
 		v := &r.VQMResults[i]
 		sd := s[v.CompressedFile]
 		sd.VqmResultFile = v.ResultFile
+		sd.FieldAliases = v.FieldAliases
 		s[v.CompressedFile] = sd
 	}
 	return s
 }
+
+// copyFile will copy src file to dst, dst is created with configured output
+// file permissions.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("copyFile() %w", err)
+	}
+	defer in.Close()
+
+	out, err := perm.Create(dst)
+	if err != nil {
+		return fmt.Errorf("copyFile() %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("copyFile() %w", err)
+	}
+	return out.Close()
+}
+
+// fileModeFlag is a flag.Value for octal file permissions (e.g. 0750).
+type fileModeFlag struct {
+	mode *os.FileMode
+}
+
+func (f fileModeFlag) String() string {
+	if f.mode == nil {
+		return ""
+	}
+	return fmt.Sprintf("%#o", *f.mode)
+}
+
+func (f fileModeFlag) Set(s string) error {
+	m, err := parseFileMode(s)
+	if err != nil {
+		return err
+	}
+	*f.mode = m
+	return nil
+}
+
+// parseFileMode will parse octal file permissions.
+func parseFileMode(s string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid octal permissions %q", s)
+	}
+	if m > 0o777 {
+		return 0, fmt.Errorf("permissions out of range %q", s)
+	}
+	return os.FileMode(m), nil
+}
+
+// stringListFlag is a flag.Value for a flag that can be given multiple
+// times, each occurrence adds a value.
+type stringListFlag struct {
+	values *[]string
+}
+
+func (f stringListFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f stringListFlag) Set(s string) error {
+	*f.values = append(*f.values, s)
+	return nil
+}
+
+// delimiterFlag is a flag.Value for a single character field delimiter, "tab"
+// stands for tab character.
+type delimiterFlag struct {
+	comma *rune
+}
+
+func (f delimiterFlag) String() string {
+	if f.comma == nil || *f.comma == 0 {
+		return ""
+	}
+	if *f.comma == '\t' {
+		return "tab"
+	}
+	return string(*f.comma)
+}
+
+func (f delimiterFlag) Set(s string) error {
+	c, err := parseDelimiter(s)
+	if err != nil {
+		return err
+	}
+	*f.comma = c
+	return nil
+}
+
+// parseDelimiter will parse field delimiter, valid delimiter is a single
+// character other than quote, carriage return or new line.
+func parseDelimiter(s string) (rune, error) {
+	if s == "tab" || s == `\t` {
+		return '\t', nil
+	}
+	r := []rune(s)
+	if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' || r[0] == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter %q", s)
+	}
+	return r[0], nil
+}
+
+// intListFlag is a flag.Value for comma separated list of non-negative
+// integers (e.g. frame indices).
+type intListFlag struct {
+	values *[]int
+}
+
+func (f intListFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	s := make([]string, len(*f.values))
+	for i, v := range *f.values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
+
+func (f intListFlag) Set(s string) error {
+	v, err := parseIntList(s)
+	if err != nil {
+		return err
+	}
+	*f.values = v
+	return nil
+}
+
+// parseIntList will parse comma separated list of non-negative integers.
+func parseIntList(s string) ([]int, error) {
+	var res []int
+	for _, item := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid non-negative integer %q", item)
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// layoutFlag is a flag.Value for multi-plot tile layout given as rows by
+// columns (e.g. "1x3").
+type layoutFlag struct {
+	rows, cols *int
+}
+
+func (f layoutFlag) String() string {
+	if f.rows == nil || *f.rows == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", *f.rows, *f.cols)
+}
+
+func (f layoutFlag) Set(s string) error {
+	rows, cols, err := parseLayout(s)
+	if err != nil {
+		return err
+	}
+	*f.rows, *f.cols = rows, cols
+	return nil
+}
+
+// parseLayout will parse tile layout in ROWSxCOLS form, both must be positive.
+func parseLayout(s string) (rows, cols int, err error) {
+	r, c, found := strings.Cut(strings.ToLower(s), "x")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid layout %q, should be ROWSxCOLS", s)
+	}
+	rows, errR := strconv.Atoi(r)
+	cols, errC := strconv.Atoi(c)
+	if errR != nil || errC != nil || rows < 1 || cols < 1 {
+		return 0, 0, fmt.Errorf("invalid layout %q, should be ROWSxCOLS", s)
+	}
+	return rows, cols, nil
+}
+
+// durationFlag is a flag.Value for positive duration given as Go duration
+// string (e.g. "90s" or "2h30m"). Zero value means flag is not set.
+type durationFlag struct {
+	d *time.Duration
+}
+
+func (f durationFlag) String() string {
+	if f.d == nil || *f.d == 0 {
+		return ""
+	}
+	return f.d.String()
+}
+
+func (f durationFlag) Set(s string) error {
+	d, err := parseDuration(s)
+	if err != nil {
+		return err
+	}
+	*f.d = d
+	return nil
+}
+
+// parseDuration will parse positive Go duration string.
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, should be e.g. 90s or 2h30m", s)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration %q should be positive", s)
+	}
+	return d, nil
+}
+
+// durationVar defines duration flag with given name and usage on fs, value is
+// validated to be positive and stored in p. Subcommands should use it for all
+// duration flags, so they behave consistently.
+func durationVar(fs *flag.FlagSet, p *time.Duration, name, usage string) {
+	fs.Var(durationFlag{p}, name, usage)
+}
+
+// fontFlags are plot font flags shared by plotting subcommands.
+type fontFlags struct {
+	// Font family or font file
+	family string
+	// Font sizes in points, 0 means default
+	title, label, tick float64
+}
+
+// register will register font flags in fs.
+func (f *fontFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.family, "font", analysis.FontSerif, "Plot font family (serif, sans, mono) or path to TTF/OTF font file")
+	fs.Float64Var(&f.title, "title-size", 0, "Plot title font size in points (default 12)")
+	fs.Float64Var(&f.label, "label-size", 0, "Axis label and legend font size in points (default 12)")
+	fs.Float64Var(&f.tick, "tick-size", 0, "Tick label font size in points (default 10)")
+}
+
+// plotStyle will load plot style file (if given) and overlay it with plot
+// flags of fs (theme, legend and font flags), so that plots are styled via
+// PlotStyle.Options only. Flags set explicitly on command line take precedence
+// over style file, flag defaults only fill in settings style file does not
+// set. Subcommands without some of the flags get respective settings from style
+// file alone.
+func plotStyle(fs *flag.FlagSet, styleFile string) (analysis.PlotStyle, error) {
+	var s analysis.PlotStyle
+	if styleFile != "" {
+		var err error
+		if s, err = analysis.LoadPlotStyle(styleFile); err != nil {
+			return s, err
+		}
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	// flagValue returns value of flag name in case it exists and overrides
+	// style setting, unset means style file does not set it.
+	flagValue := func(name string, unset bool) (any, bool) {
+		f := fs.Lookup(name)
+		if f == nil || !(set[name] || unset) {
+			return nil, false
+		}
+		return f.Value.(flag.Getter).Get(), true
+	}
+	for _, v := range []struct {
+		name string
+		dst  *string
+	}{
+		{"theme", &s.Theme},
+		{"legend", &s.Legend},
+		{"font", &s.Font},
+	} {
+		if val, ok := flagValue(v.name, *v.dst == ""); ok {
+			*v.dst = val.(string)
+		}
+	}
+	for _, v := range []struct {
+		name string
+		dst  *float64
+	}{
+		{"title-size", &s.TitleSize},
+		{"label-size", &s.LabelSize},
+		{"tick-size", &s.TickSize},
+	} {
+		if val, ok := flagValue(v.name, *v.dst == 0); ok {
+			*v.dst = val.(float64)
+		}
+	}
+	for _, v := range []struct {
+		name string
+		dst  **float64
+	}{
+		{"legend-x-offset", &s.LegendXOffset},
+		{"legend-y-offset", &s.LegendYOffset},
+	} {
+		if val, ok := flagValue(v.name, *v.dst == nil); ok {
+			offs := val.(float64)
+			*v.dst = &offs
+		}
+	}
+	return s, nil
+}
+
+// expandDirTemplate will expand placeholders in output directory path: {date}
+// is replaced with date (e.g. 2022-06-30) and {runid} with timestamp (e.g.
+// 20220630-154512) of t, so each run can land in a fresh directory.
+func expandDirTemplate(dir string, t time.Time) string {
+	return strings.NewReplacer(
+		"{date}", t.Format("2006-01-02"),
+		"{runid}", t.Format("20060102-150405"),
+	).Replace(dir)
+}
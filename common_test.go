@@ -7,10 +7,18 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"flag"
+	"io"
 	"os"
+	"path"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/evolution-gaming/ease/internal/analysis"
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/vqm"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -18,21 +26,29 @@ func Test_extractSourceData(t *testing.T) {
 	given := parseReportFile("testdata/encoding_artifacts/report.json")
 	want := map[string]sourceData{
 		"out/testsrc01_libx264.mp4": {
+			Name:           "libx264",
+			SourceFile:     "testdata/video/testsrc01.mp4",
 			CompressedFile: "out/testsrc01_libx264.mp4",
 			WorkDir:        "/tmp",
 			VqmResultFile:  "out/testsrc01_libx264_vqm.json",
 		},
 		"out/testsrc01_libx265.mp4": {
+			Name:           "libx265",
+			SourceFile:     "testdata/video/testsrc01.mp4",
 			CompressedFile: "out/testsrc01_libx265.mp4",
 			WorkDir:        "/tmp",
 			VqmResultFile:  "out/testsrc01_libx265_vqm.json",
 		},
 		"out/testsrc02_libx264.mp4": {
+			Name:           "libx264",
+			SourceFile:     "testdata/video/testsrc02.mp4",
 			CompressedFile: "out/testsrc02_libx264.mp4",
 			WorkDir:        "/tmp",
 			VqmResultFile:  "out/testsrc02_libx264_vqm.json",
 		},
 		"out/testsrc02_libx265.mp4": {
+			Name:           "libx265",
+			SourceFile:     "testdata/video/testsrc02.mp4",
 			CompressedFile: "out/testsrc02_libx265.mp4",
 			WorkDir:        "/tmp",
 			VqmResultFile:  "out/testsrc02_libx265_vqm.json",
@@ -77,3 +93,432 @@ func Test_report_WriteJSON(t *testing.T) {
 		t.Errorf("JSON roundtrip failed (-want +got):\n%s", diff)
 	}
 }
+
+func Test_loadReportFile(t *testing.T) {
+	t.Run("Should load report file", func(t *testing.T) {
+		got, err := loadReportFile("testdata/encoding_artifacts/report.json")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want := parseReportFile("testdata/encoding_artifacts/report.json")
+		if diff := cmp.Diff(len(want.EncodingResult.RunResults), len(got.EncodingResult.RunResults)); diff != "" {
+			t.Errorf("RunResults count mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(want.VQMResults, got.VQMResults); diff != "" {
+			t.Errorf("VQMResults mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should fail for non-existent file", func(t *testing.T) {
+		if _, err := loadReportFile("testdata/non-existent.json"); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+	t.Run("Should fail for invalid JSON", func(t *testing.T) {
+		f := path.Join(t.TempDir(), "report.json")
+		if err := os.WriteFile(f, []byte("{"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadReportFile(f); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_excludeFailed(t *testing.T) {
+	rep := &report{
+		EncodingResult: encoding.PlanResult{
+			RunResults: []encoding.RunResult{
+				{EncoderCmd: encoding.EncoderCmd{CompressedFile: "a.mp4"}},
+				{EncoderCmd: encoding.EncoderCmd{CompressedFile: "b.mp4"}, Errors: []error{errors.New("exit status 1")}},
+				{EncoderCmd: encoding.EncoderCmd{CompressedFile: "c.mp4"}},
+			},
+		},
+		VQMResults: []namedVqmResult{
+			{Result: vqm.Result{CompressedFile: "a.mp4"}},
+			{Result: vqm.Result{CompressedFile: "b.mp4"}},
+		},
+	}
+
+	if diff := cmp.Diff([]string{"b.mp4"}, excludeFailed(rep, false)); diff != "" {
+		t.Errorf("Excluded mismatch (-want +got):\n%s", diff)
+	}
+	var gotRuns, gotVQMs []string
+	for _, v := range rep.EncodingResult.RunResults {
+		gotRuns = append(gotRuns, v.CompressedFile)
+	}
+	for _, v := range rep.VQMResults {
+		gotVQMs = append(gotVQMs, v.CompressedFile)
+	}
+	if diff := cmp.Diff([]string{"a.mp4", "c.mp4"}, gotRuns); diff != "" {
+		t.Errorf("RunResults mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"a.mp4"}, gotVQMs); diff != "" {
+		t.Errorf("VQMResults mismatch (-want +got):\n%s", diff)
+	}
+	if got := excludeFailed(rep, false); got != nil {
+		t.Errorf("Expected nothing excluded, got: %v", got)
+	}
+}
+
+func Test_excludeFailedRequireVQM(t *testing.T) {
+	rep := &report{
+		EncodingResult: encoding.PlanResult{
+			RunResults: []encoding.RunResult{
+				{EncoderCmd: encoding.EncoderCmd{CompressedFile: "a.mp4"}},
+				{EncoderCmd: encoding.EncoderCmd{CompressedFile: "b.mp4"}, Errors: []error{errors.New("exit status 1")}},
+				// VQM measurement failed.
+				{EncoderCmd: encoding.EncoderCmd{CompressedFile: "c.mp4"}},
+			},
+		},
+		VQMResults: []namedVqmResult{
+			{Result: vqm.Result{CompressedFile: "a.mp4"}},
+		},
+	}
+
+	if diff := cmp.Diff([]string{"b.mp4", "c.mp4"}, excludeFailed(rep, true)); diff != "" {
+		t.Errorf("Excluded mismatch (-want +got):\n%s", diff)
+	}
+	var gotRuns []string
+	for _, v := range rep.EncodingResult.RunResults {
+		gotRuns = append(gotRuns, v.CompressedFile)
+	}
+	if diff := cmp.Diff([]string{"a.mp4"}, gotRuns); diff != "" {
+		t.Errorf("RunResults mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_mergeReports(t *testing.T) {
+	t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	runResult := func(file string) encoding.RunResult {
+		return encoding.RunResult{EncoderCmd: encoding.EncoderCmd{CompressedFile: file}}
+	}
+	vqmResult := func(file string) namedVqmResult {
+		return namedVqmResult{Result: vqm.Result{CompressedFile: file}}
+	}
+	prev := &report{
+		EncodingResult: encoding.PlanResult{
+			StartTime:  t0,
+			EndTime:    t0.Add(time.Hour),
+			RunResults: []encoding.RunResult{runResult("a.mp4"), runResult("b.mp4")},
+		},
+		VQMResults: []namedVqmResult{vqmResult("a.mp4"), vqmResult("b.mp4")},
+	}
+	cur := &report{
+		EncodingResult: encoding.PlanResult{
+			StartTime:  t0.Add(2 * time.Hour),
+			EndTime:    t0.Add(3 * time.Hour),
+			RunResults: []encoding.RunResult{runResult("b.mp4"), runResult("c.mp4")},
+		},
+		VQMResults: []namedVqmResult{vqmResult("b.mp4"), vqmResult("c.mp4")},
+	}
+
+	got := mergeReports(prev, cur)
+
+	t.Run("Should span both runs", func(t *testing.T) {
+		if diff := cmp.Diff(t0, got.EncodingResult.StartTime); diff != "" {
+			t.Errorf("StartTime mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(t0.Add(3*time.Hour), got.EncodingResult.EndTime); diff != "" {
+			t.Errorf("EndTime mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should replace duplicate results", func(t *testing.T) {
+		var gotFiles []string
+		for _, v := range got.EncodingResult.RunResults {
+			gotFiles = append(gotFiles, v.CompressedFile)
+		}
+		if diff := cmp.Diff([]string{"a.mp4", "b.mp4", "c.mp4"}, gotFiles); diff != "" {
+			t.Errorf("RunResults mismatch (-want +got):\n%s", diff)
+		}
+		gotFiles = nil
+		for _, v := range got.VQMResults {
+			gotFiles = append(gotFiles, v.CompressedFile)
+		}
+		if diff := cmp.Diff([]string{"a.mp4", "b.mp4", "c.mp4"}, gotFiles); diff != "" {
+			t.Errorf("VQMResults mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func Test_parseFileMode(t *testing.T) {
+	tests := map[string]struct {
+		given   string
+		want    os.FileMode
+		wantErr bool
+	}{
+		"With leading zero":    {given: "0750", want: 0o750},
+		"Without leading zero": {given: "022", want: 0o022},
+		"Not octal":            {given: "0789", wantErr: true},
+		"Out of range":         {given: "1777", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseFileMode(tc.given)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch, wantErr %v, got: %v", tc.wantErr, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("parseFileMode() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_parseDelimiter(t *testing.T) {
+	tests := map[string]struct {
+		given   string
+		want    rune
+		wantErr bool
+	}{
+		"Comma":          {given: ",", want: ','},
+		"Semicolon":      {given: ";", want: ';'},
+		"Tab name":       {given: "tab", want: '\t'},
+		"Tab escape":     {given: `\t`, want: '\t'},
+		"Empty":          {given: "", wantErr: true},
+		"Multiple chars": {given: ",;", wantErr: true},
+		"Quote":          {given: `"`, wantErr: true},
+		"New line":       {given: "\n", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseDelimiter(tc.given)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch, wantErr %v, got: %v", tc.wantErr, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("parseDelimiter() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_copyFile(t *testing.T) {
+	t.Run("Should copy file", func(t *testing.T) {
+		src := "testdata/encoding_artifacts/report.json"
+		dst := path.Join(t.TempDir(), "report.json")
+		if err := copyFile(src, dst); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want, _ := os.ReadFile(src)
+		got, _ := os.ReadFile(dst)
+		if !bytes.Equal(want, got) {
+			t.Error("Copied file content mismatch")
+		}
+	})
+	t.Run("Should fail for non-existent source", func(t *testing.T) {
+		if err := copyFile("testdata/non-existent.json", path.Join(t.TempDir(), "x")); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_parseIntList(t *testing.T) {
+	tests := map[string]struct {
+		given   string
+		want    []int
+		wantErr bool
+	}{
+		"Single value":    {given: "10", want: []int{10}},
+		"Multiple values": {given: "10, 250,0", want: []int{10, 250, 0}},
+		"Negative value":  {given: "10,-1", wantErr: true},
+		"Not a number":    {given: "10,x", wantErr: true},
+		"Empty list item": {given: "10,,20", wantErr: true},
+		"Empty string":    {given: "", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseIntList(tc.given)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch: wantErr=%v, got %v", tc.wantErr, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("parseIntList() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_parseLayout(t *testing.T) {
+	tests := map[string]struct {
+		given   string
+		want    []int
+		wantErr bool
+	}{
+		"Column":       {given: "3x1", want: []int{3, 1}},
+		"Grid":         {given: "2X2", want: []int{2, 2}},
+		"Zero rows":    {given: "0x3", wantErr: true},
+		"Missing cols": {given: "3x", wantErr: true},
+		"No separator": {given: "3", wantErr: true},
+		"Not a number": {given: "ax1", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rows, cols, err := parseLayout(tc.given)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch: wantErr=%v, got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want, []int{rows, cols}); diff != "" {
+				t.Errorf("parseLayout() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_parseDuration(t *testing.T) {
+	tests := map[string]struct {
+		given   string
+		want    time.Duration
+		wantErr bool
+	}{
+		"Seconds":      {given: "90s", want: 90 * time.Second},
+		"Compound":     {given: "2h30m", want: 2*time.Hour + 30*time.Minute},
+		"Zero":         {given: "0s", wantErr: true},
+		"Negative":     {given: "-1m", wantErr: true},
+		"Missing unit": {given: "90", wantErr: true},
+		"Not duration": {given: "soon", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseDuration(tc.given)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch: wantErr=%v, got %v", tc.wantErr, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("parseDuration() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_durationVar(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var d time.Duration
+	durationVar(fs, &d, "timeout", "Timeout")
+
+	if err := fs.Parse([]string{"-timeout", "1m30s"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(90*time.Second, d); diff != "" {
+		t.Errorf("Duration mismatch (-want +got):\n%s", diff)
+	}
+	if err := fs.Parse([]string{"-timeout", "-5s"}); err == nil {
+		t.Error("Expected error for negative duration, got <nil>")
+	}
+}
+
+func Test_expandDirTemplate(t *testing.T) {
+	ts := time.Date(2022, 6, 30, 15, 45, 12, 0, time.UTC)
+	tests := map[string]struct {
+		given string
+		want  string
+	}{
+		"No placeholders": {given: "results", want: "results"},
+		"Date":            {given: "results/{date}", want: "results/2022-06-30"},
+		"Run id":          {given: "out_{runid}", want: "out_20220630-154512"},
+		"Both":            {given: "{date}/{runid}", want: "2022-06-30/20220630-154512"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := expandDirTemplate(tc.given, ts)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_plotStyle(t *testing.T) {
+	styleFile := path.Join(t.TempDir(), "style.json")
+	style := `{"Theme": "dark", "Legend": "bottom", "LegendXOffset": 5, "Font": "mono", "TitleSize": 16, "Background": "#101010"}`
+	if err := os.WriteFile(styleFile, []byte(style), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	newFlagSet := func() *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.String("theme", "light", "")
+		fs.String("legend", "top", "")
+		fs.Float64("legend-x-offset", -10, "")
+		fs.Float64("legend-y-offset", -10, "")
+		var font fontFlags
+		font.register(fs)
+		return fs
+	}
+	offset := func(v float64) *float64 { return &v }
+
+	t.Run("Should take explicitly given flags over style file", func(t *testing.T) {
+		fs := newFlagSet()
+		if err := fs.Parse([]string{"-legend", "none", "-label-size", "9"}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := plotStyle(fs, styleFile)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want := analysis.PlotStyle{
+			Theme:         "dark",
+			Background:    "#101010",
+			Font:          "mono",
+			TitleSize:     16,
+			LabelSize:     9,
+			Legend:        "none",
+			LegendXOffset: offset(5),
+			LegendYOffset: offset(-10),
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Style mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should use style file alone without flags", func(t *testing.T) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		got, err := plotStyle(fs, styleFile)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want := analysis.PlotStyle{
+			Theme:         "dark",
+			Background:    "#101010",
+			Font:          "mono",
+			TitleSize:     16,
+			Legend:        "bottom",
+			LegendXOffset: offset(5),
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Style mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should use flags without style file", func(t *testing.T) {
+		got, err := plotStyle(newFlagSet(), "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want := analysis.PlotStyle{
+			Theme:         "light",
+			Font:          "serif",
+			Legend:        "top",
+			LegendXOffset: offset(-10),
+			LegendYOffset: offset(-10),
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Style mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should fail on invalid style file", func(t *testing.T) {
+		invalid := path.Join(t.TempDir(), "invalid.json")
+		if err := os.WriteFile(invalid, []byte(`{"Theme": "solarized"}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := plotStyle(newFlagSet(), invalid); err == nil {
+			t.Error("Expected error for invalid style, got <nil>")
+		}
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// ease tool's doctor subcommand implementation.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/evolution-gaming/ease/internal/tools"
+)
+
+// CreateDoctorCommand will create Commander instance from DoctorApp.
+func CreateDoctorCommand() Commander {
+	longHelp := `Subcommand "doctor" will check external dependencies (ffmpeg, ffprobe,
+libvmaf and VMAF model) and report problems along with hints how to fix them.
+
+Examples:
+
+  ease doctor`
+
+	app := &DoctorApp{
+		fs: flag.NewFlagSet("doctor", flag.ContinueOnError),
+	}
+
+	app.fs.Usage = func() {
+		printSubCommandUsage(longHelp, app.fs)
+	}
+
+	return app
+}
+
+// Make sure DoctorApp implements Commander interface.
+var _ Commander = (*DoctorApp)(nil)
+
+// DoctorApp is doctor subcommand context that implements Commander interface.
+type DoctorApp struct {
+	// FlagSet instance
+	fs *flag.FlagSet
+}
+
+func (a *DoctorApp) Name() string {
+	return a.fs.Name()
+}
+
+func (a *DoctorApp) Help() {
+	a.fs.Usage()
+}
+
+// Run is entry point to DoctorApp command execution.
+func (a *DoctorApp) Run(args []string) error {
+	if err := a.fs.Parse(args); err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      "usage error",
+		}
+	}
+
+	var failed int
+	if porcelain {
+		var results []doctorResult
+		results, failed = evalDoctorChecks(doctorChecks())
+		if err := writePorcelain(os.Stdout, results); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+	} else {
+		failed = runDoctorChecks(os.Stdout, doctorChecks())
+	}
+	if failed > 0 {
+		return &AppError{
+			exitCode: 1,
+			msg:      fmt.Sprintf("doctor found %d problem(s)", failed),
+		}
+	}
+
+	return nil
+}
+
+// doctorCheck is a single dependency check.
+type doctorCheck struct {
+	Name string
+	// Check returns details (e.g. resolved path or version) on success
+	Check func() (string, error)
+	// Hint how to fix the problem in case check fails
+	Hint string
+}
+
+// doctorChecks returns all dependency checks.
+func doctorChecks() []doctorCheck {
+	return []doctorCheck{
+		{
+			Name:  "ffmpeg",
+			Check: tools.FfmpegVersion,
+			Hint:  "install ffmpeg and make sure it is in $PATH or set FFMPEG_EXE_PATH",
+		},
+		{
+			Name:  "ffprobe",
+			Check: tools.FfprobeVersion,
+			Hint:  "install ffprobe (part of ffmpeg) and make sure it is in $PATH or set FFPROBE_EXE_PATH",
+		},
+		{
+			Name: "libvmaf",
+			Check: func() (string, error) {
+				ok, err := tools.FfmpegHasFilter("libvmaf")
+				if err != nil {
+					return "", err
+				}
+				if !ok {
+					return "", errors.New("ffmpeg has no libvmaf filter")
+				}
+				return "libvmaf filter available", nil
+			},
+			Hint: "use ffmpeg built with --enable-libvmaf",
+		},
+		{
+			Name: "VMAF model",
+			Check: func() (string, error) {
+				p, err := tools.FindLibvmafModel()
+				if err != nil {
+					return "", err
+				}
+				if err := tools.ValidateLibvmafModel(p); err != nil {
+					return "", err
+				}
+				return p, nil
+			},
+			Hint: "install (or reinstall broken) libvmaf model files or set LIBVMAF_MODEL_PATH, alternatively use -vmaf-model preset",
+		},
+	}
+}
+
+// doctorResult is a result of single dependency check.
+type doctorResult struct {
+	Name string
+	OK   bool
+	// Details of passed check
+	Details string `json:",omitempty"`
+	// Error and Hint of failed check
+	Error string `json:",omitempty"`
+	Hint  string `json:",omitempty"`
+}
+
+// evalDoctorChecks will run checks and return their results, failed is number
+// of failed checks.
+func evalDoctorChecks(checks []doctorCheck) (results []doctorResult, failed int) {
+	for _, c := range checks {
+		details, err := c.Check()
+		if err != nil {
+			failed++
+			results = append(results, doctorResult{Name: c.Name, Error: err.Error(), Hint: c.Hint})
+			continue
+		}
+		results = append(results, doctorResult{Name: c.Name, OK: true, Details: details})
+	}
+	return results, failed
+}
+
+// runDoctorChecks will run checks and write pass/fail report to w, returns
+// number of failed checks.
+func runDoctorChecks(w io.Writer, checks []doctorCheck) (failed int) {
+	results, failed := evalDoctorChecks(checks)
+	for _, r := range results {
+		if !r.OK {
+			fmt.Fprintf(w, "[FAIL] %s: %s\n       hint: %s\n", r.Name, r.Error, r.Hint)
+			continue
+		}
+		fmt.Fprintf(w, "[PASS] %s: %s\n", r.Name, r.Details)
+	}
+	return failed
+}
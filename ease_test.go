@@ -6,6 +6,9 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,7 +16,12 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/evolution-gaming/ease/internal/analysis"
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/video"
+	"github.com/evolution-gaming/ease/internal/vqm"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -36,6 +44,66 @@ func TestEncodeApp_WrongFlags(t *testing.T) {
 			givenArgs: []string{"-plan", "a/yyy"},
 			want:      "encoding plan file does not exist?",
 		},
+		"Unsupported group-by": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-group-by", "scheme"},
+			want:      "unsupported -group-by value: scheme",
+		},
+		"Report template without HTML report": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-report-template", "report.tmpl"},
+			want:      "option -report-template requires -html-report",
+		},
+		"Unsupported sort-by": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-sort-by", "size"},
+			want:      "unsupported -sort-by value: size",
+		},
+		"Negative VQM retries": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-vqm-retries", "-1"},
+			want:      "invalid -vqm-retries value: -1",
+		},
+		"VQM nice out of range": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-vqm-nice", "20"},
+			want:      "invalid -vqm-nice value: 20",
+		},
+		"Negative frame exclusion": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-vqm-exclude-leading", "-1"},
+			want:      "invalid frame exclusion",
+		},
+		"Negative VMAF interval": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-vmaf-interval", "-1"},
+			want:      "invalid -vmaf-interval value: -1",
+		},
+		"Negative VMAF bootstrap": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-vmaf-bootstrap", "-1"},
+			want:      "invalid -vmaf-bootstrap value: -1",
+		},
+		"VMAF interval with frames": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-vmaf-interval", "0.5", "-vmaf-frames", "1,2"},
+			want:      "options -vmaf-interval and -vmaf-frames are mutually exclusive",
+		},
+		"Luma exclusion out of range": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-vqm-exclude-luma", "300"},
+			want:      "invalid frame exclusion",
+		},
+		"Unsupported cleanup": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-cleanup", "all"},
+			want:      "unsupported -cleanup value: all",
+		},
+		"Invalid order": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-order", "random"},
+			want:      "invalid encoding order: random",
+		},
+		"VQM threshold without VQM": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-vqm=false", "-min-vmaf", "90"},
+			want:      "options -min-vmaf, -min-psnr and -min-ms-ssim require VQM calculation (-vqm)",
+		},
+		"Streamed results and report on stdout": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-stream-results", "-"},
+			want:      "option -stream-results - requires -report",
+		},
+		"Negative max commands": {
+			givenArgs: []string{"-plan", "testdata/encoding_artifacts/report.json", "-max-commands", "-1"},
+			want:      "invalid -max-commands value: -1",
+		},
 	}
 
 	for name, tc := range tests {
@@ -54,6 +122,36 @@ func TestEncodeApp_WrongFlags(t *testing.T) {
 	}
 }
 
+func TestEncodeApp_Run_CommandLimitBeforeOrdering(t *testing.T) {
+	outDir := t.TempDir()
+	input, err := filepath.Abs("testdata/video/testsrc01.mp4")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	plan := path.Join(outDir, "plan.json")
+	payload := fmt.Sprintf(`{
+		"OutDir": "%s",
+		"Inputs": ["%s"],
+		"Schemes": [
+			{"Name": "a", "CommandTpl": ["cp ", "%%INPUT%% ", "%%OUTPUT%%.mp4"]},
+			{"Name": "b", "CommandTpl": ["cp ", "%%INPUT%% ", "%%OUTPUT%%.mp4"]}
+		]
+	}`, outDir, input)
+	if err := os.WriteFile(plan, []byte(payload), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Ordering by cost would fail probing inputs with non-existent ffprobe.
+	t.Setenv("FFPROBE_EXE_PATH", path.Join(outDir, "non-existent-ffprobe"))
+
+	gotErr := CreateEncodeCommand().Run([]string{"-plan", plan, "-max-commands", "1", "-order", "cost-asc"})
+	if gotErr == nil {
+		t.Fatal("Error expected but got <nil>")
+	}
+	if want := "exceeds -max-commands 1"; !strings.Contains(gotErr.Error(), want) {
+		t.Errorf("Error mismatch (-want +got):\n-%s\n+%s\n", want, gotErr.Error())
+	}
+}
+
 func TestEncodeApp_Run_WithFailedVQM(t *testing.T) {
 	// Create a fake ffmpeg and modify PATH so that it's picked up first and
 	// blows up VQM calculation.
@@ -66,7 +164,7 @@ func TestEncodeApp_Run_WithFailedVQM(t *testing.T) {
 		t.Fatal("Error expected but go <nil>")
 	}
 	wantErrMsg := "VQM calculations had errors, see log for reasons"
-	wantExitCode := 1
+	wantExitCode := exitVQM
 
 	if diff := cmp.Diff(wantErrMsg, gotErr.Error()); diff != "" {
 		t.Errorf("Error message mismatch (-want +got):\n%s", diff)
@@ -85,7 +183,7 @@ func TestEncodeApp_Run_WithInvalidPlanConfigParseError(t *testing.T) {
 		t.Fatal("Error expected but go <nil>")
 	}
 	wantErrMsg := "PlanConfig not valid: validation error with reasons"
-	wantExitCode := 1
+	wantExitCode := exitConfig
 
 	if !strings.HasPrefix(gotErr.Error(), wantErrMsg) {
 		t.Errorf("Error message mismatch (-want +got):\n-%s\n+%s", wantErrMsg, gotErr.Error())
@@ -167,6 +265,22 @@ func TestAnalyseApp_WrongFlags(t *testing.T) {
 			givenArgs: []string{"-report", "a/yyy", "-out-dir", "/tmp"},
 			want:      "report file does not exist?",
 		},
+		"Non-positive -jobs flag": {
+			givenArgs: []string{"-report", "testdata/encoding_artifacts/report.json", "-out-dir", "/tmp", "-jobs", "0"},
+			want:      "option -jobs should be positive",
+		},
+		"Invalid -frame-metrics flag": {
+			givenArgs: []string{"-report", "testdata/encoding_artifacts/report.json", "-out-dir", "/tmp", "-frame-metrics", "xml"},
+			want:      "invalid -frame-metrics format: xml",
+		},
+		"Invalid -plots flag": {
+			givenArgs: []string{"-report", "testdata/encoding_artifacts/report.json", "-out-dir", "/tmp", "-plots", "bitrate,cambi"},
+			want:      "analyse usage error",
+		},
+		"Invalid -png-compression flag": {
+			givenArgs: []string{"-report", "testdata/encoding_artifacts/report.json", "-out-dir", "/tmp", "-png-compression", "max"},
+			want:      "invalid PNG compression: max",
+		},
 	}
 
 	for name, tc := range tests {
@@ -194,6 +308,67 @@ func TestAnalyseApp_WrongFlags(t *testing.T) {
 	}
 }
 
+func TestGenSampleApp_WrongFlags(t *testing.T) {
+	tests := map[string]struct {
+		// substring in Error()
+		want      string
+		givenArgs []string
+	}{
+		"Wrong flags": {
+			givenArgs: []string{"-zzz"},
+			want:      "usage error",
+		},
+		"Mandatory -o flag": {
+			givenArgs: []string{"-source", "testsrc"},
+			want:      "mandatory option -o is missing",
+		},
+		"Unsupported -source flag": {
+			givenArgs: []string{"-o", "sample.mp4", "-source", "smptebars"},
+			want:      "unsupported -source value: smptebars",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := CreateGenSampleCommand()
+			if c, ok := cmd.(*GenSampleApp); ok {
+				c.fs.SetOutput(io.Discard)
+			}
+			gotErr := cmd.Run(tc.givenArgs)
+			if !strings.Contains(gotErr.Error(), tc.want) {
+				t.Errorf("Error mismatch (-want +got):\n-%s\n+%s\n", tc.want, gotErr.Error())
+			}
+			if e, ok := gotErr.(*AppError); !ok || e.ExitCode() != 2 {
+				t.Errorf("Expected AppError with exit code 2, got: %v", gotErr)
+			}
+		})
+	}
+}
+
+func TestVQMPlotApp_AllMetrics(t *testing.T) {
+	outFile := path.Join(t.TempDir(), "plot.png")
+	err := CreateVQMPlotCommand().Run([]string{"-m", "all", "-jitter", "-i", "testdata/vqm/ffmpeg_vmaf.json", "-o", outFile})
+	if err != nil {
+		t.Fatalf("Unexpected error running vqmplot: %v", err)
+	}
+	for _, suffix := range []string{"_vmaf.png", "_psnr.png", "_ms-ssim.png"} {
+		f := strings.TrimSuffix(outFile, ".png") + suffix
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			t.Errorf("VQM plot file missing: %s", f)
+		}
+	}
+}
+
+func TestVQMPlotApp_AllMetricsWithYBounds(t *testing.T) {
+	cmd := CreateVQMPlotCommand()
+	cmd.(*VQMPlotApp).fs.SetOutput(io.Discard)
+	err := cmd.Run([]string{"-m", "all", "-ymin", "0", "-i", "testdata/vqm/ffmpeg_vmaf.json"})
+	var appErr *AppError
+	if !errors.As(err, &appErr) || appErr.exitCode != 2 {
+		t.Errorf("Expected usage error, got: %v", err)
+	}
+}
+
 // Integration tests for ease tool.
 func TestIntegration_AllSubcommands(t *testing.T) {
 	tempDir := t.TempDir()
@@ -229,6 +404,18 @@ func TestIntegration_AllSubcommands(t *testing.T) {
 		}
 	})
 
+	t.Run("Analyse with -correlate should create correlation plot", func(t *testing.T) {
+		outDir := path.Join(tempDir, "out-correlate")
+		err := CreateAnalyseCommand().Run([]string{"-report", report, "-out-dir", outDir, "-correlate"})
+		if err != nil {
+			t.Errorf("Unexpected error running analysis: %v", err)
+		}
+
+		if m, _ := filepath.Glob(fmt.Sprintf("%s/*/*correlate.png", outDir)); len(m) != 1 {
+			t.Errorf("Expecting one file for correlation plot, got: %s", m)
+		}
+	})
+
 	t.Run("Vqmplot should create plots", func(t *testing.T) {
 		var vqmFile string
 		// Need to get file with VQMs from encode stage.
@@ -250,6 +437,79 @@ func TestIntegration_AllSubcommands(t *testing.T) {
 				}
 			})
 		}
+
+		t.Run("All metrics", func(t *testing.T) {
+			outFile := path.Join(tempDir, "vqmplot_all.png")
+			err := CreateVQMPlotCommand().Run([]string{"-m", "all", "-i", vqmFile, "-o", outFile})
+			if err != nil {
+				t.Errorf("Unexpected error running vqmplot: %v", err)
+			}
+			if m, _ := filepath.Glob(path.Join(tempDir, "vqmplot_all_*.png")); len(m) != 3 {
+				t.Errorf("Expecting three VQM plot files, got: %s", m)
+			}
+		})
+
+		t.Run("Delta", func(t *testing.T) {
+			outFile := path.Join(tempDir, "vqmplot_delta.png")
+			err := CreateVQMPlotCommand().Run([]string{"-delta", "-o", outFile, vqmFile, vqmFile})
+			if err != nil {
+				t.Errorf("Unexpected error running vqmplot: %v", err)
+			}
+			if _, err := os.Stat(outFile); os.IsNotExist(err) {
+				t.Errorf("VQM delta file missing: %s", outFile)
+			}
+		})
+
+		t.Run("Dark theme", func(t *testing.T) {
+			outFile := path.Join(tempDir, "vqmplot_dark.png")
+			err := CreateVQMPlotCommand().Run([]string{"-theme", "dark", "-i", vqmFile, "-o", outFile})
+			if err != nil {
+				t.Errorf("Unexpected error running vqmplot: %v", err)
+			}
+			if _, err := os.Stat(outFile); os.IsNotExist(err) {
+				t.Errorf("VQM plot file missing: %s", outFile)
+			}
+		})
+
+		t.Run("Invalid theme", func(t *testing.T) {
+			err := CreateVQMPlotCommand().Run([]string{"-theme", "solarized", "-i", vqmFile})
+			var appErr *AppError
+			if !errors.As(err, &appErr) || appErr.exitCode != 2 {
+				t.Errorf("Expected usage error, got: %v", err)
+			}
+		})
+
+		t.Run("Invalid font", func(t *testing.T) {
+			for _, args := range [][]string{{"-font", "missing.ttf"}, {"-title-size", "-1"}} {
+				err := CreateVQMPlotCommand().Run(append(args, "-i", vqmFile))
+				var appErr *AppError
+				if !errors.As(err, &appErr) || appErr.exitCode != 2 {
+					t.Errorf("Expected usage error for %v, got: %v", args, err)
+				}
+			}
+		})
+
+		t.Run("Style", func(t *testing.T) {
+			styleFile := path.Join(tempDir, "style.json")
+			style := `{"Theme": "dark", "Palette": ["#e63946", "#3f37c9"], "Font": "sans", "TitleSize": 14}`
+			if err := os.WriteFile(styleFile, []byte(style), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			outFile := path.Join(tempDir, "vqmplot_style.png")
+			err := CreateVQMPlotCommand().Run([]string{"-style", styleFile, "-i", vqmFile, "-o", outFile})
+			if err != nil {
+				t.Errorf("Unexpected error running vqmplot: %v", err)
+			}
+			if _, err := os.Stat(outFile); os.IsNotExist(err) {
+				t.Errorf("VQM plot file missing: %s", outFile)
+			}
+
+			err = CreateVQMPlotCommand().Run([]string{"-style", path.Join(tempDir, "missing.json"), "-i", vqmFile})
+			var appErr *AppError
+			if !errors.As(err, &appErr) || appErr.exitCode != 2 {
+				t.Errorf("Expected usage error, got: %v", err)
+			}
+		})
 	})
 
 	t.Run("Bitrate should create bitrate plot", func(t *testing.T) {
@@ -271,3 +531,1152 @@ func TestIntegration_AllSubcommands(t *testing.T) {
 		}
 	})
 }
+
+func Test_vqmThresholds_check(t *testing.T) {
+	results := []namedVqmResult{
+		{Name: "good", Result: vqm.Result{
+			CompressedFile: "good.mp4",
+			Metrics:        vqm.VideoQualityMetrics{VMAF: 95, PSNR: 45, MS_SSIM: 0.99},
+		}},
+		{Name: "bad", Result: vqm.Result{
+			CompressedFile: "bad.mp4",
+			Metrics:        vqm.VideoQualityMetrics{VMAF: 70, PSNR: 30, MS_SSIM: 0.9},
+		}},
+		{Name: "gpu", Result: vqm.Result{
+			CompressedFile: "gpu.mp4",
+			Metrics:        vqm.VideoQualityMetrics{VMAF: 95, Absent: []string{"PSNR", "MS_SSIM"}},
+		}},
+	}
+	tests := map[string]struct {
+		given vqmThresholds
+		runs  []string
+		want  []string
+	}{
+		"Disabled": {
+			given: vqmThresholds{},
+			want:  nil,
+		},
+		"All pass": {
+			given: vqmThresholds{VMAF: 60},
+			want:  nil,
+		},
+		"VMAF failure": {
+			given: vqmThresholds{VMAF: 80},
+			want:  []string{"bad.mp4: VMAF 70.000 < 80.000"},
+		},
+		"Multiple metric failures": {
+			given: vqmThresholds{VMAF: 80, PSNR: 40, MS_SSIM: 0.95},
+			want: []string{
+				"bad.mp4: VMAF 70.000 < 80.000, PSNR 30.000 < 40.000, MS-SSIM 0.900 < 0.950",
+				"gpu.mp4: PSNR not measured, MS-SSIM not measured",
+			},
+		},
+		"Missing VQM result": {
+			given: vqmThresholds{VMAF: 60},
+			runs:  []string{"good.mp4", "bad.mp4", "failed.mp4"},
+			want:  []string{"failed.mp4: no VQM result"},
+		},
+		"Metric not measured": {
+			given: vqmThresholds{PSNR: 20},
+			runs:  []string{"good.mp4", "bad.mp4", "gpu.mp4"},
+			want:  []string{"gpu.mp4: PSNR not measured"},
+		},
+		"Missing VQM result with disabled thresholds": {
+			given: vqmThresholds{},
+			runs:  []string{"failed.mp4"},
+			want:  nil,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			files := tc.runs
+			if files == nil {
+				files = []string{"good.mp4", "bad.mp4"}
+			}
+			var runs []encoding.RunResult
+			for _, f := range files {
+				runs = append(runs, encoding.RunResult{EncoderCmd: encoding.EncoderCmd{CompressedFile: f}})
+			}
+			got := tc.given.check(runs, results)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Threshold failures mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_slowEncodes(t *testing.T) {
+	results := []encoding.RunResult{
+		{EncoderCmd: encoding.EncoderCmd{CompressedFile: "fast.mp4"}, AvgEncodingSpeed: 2.5},
+		{EncoderCmd: encoding.EncoderCmd{CompressedFile: "slow.mp4"}, AvgEncodingSpeed: 0.8, BelowRealtime: true},
+		{EncoderCmd: encoding.EncoderCmd{CompressedFile: "reused.mp4"}, Reused: true},
+		{EncoderCmd: encoding.EncoderCmd{CompressedFile: "failed.mp4"}, Errors: []error{errors.New("boom")}},
+	}
+	tests := map[string]struct {
+		given float64
+		want  []string
+	}{
+		"All pass": {
+			given: 0.5,
+			want:  nil,
+		},
+		"Realtime": {
+			given: 1,
+			want:  []string{"slow.mp4: speed 0.80x < 1.00x"},
+		},
+		"Faster than realtime": {
+			given: 3,
+			want:  []string{"fast.mp4: speed 2.50x < 3.00x", "slow.mp4: speed 0.80x < 3.00x"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := slowEncodes(results, tc.given)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Slow encodes mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_afterVQMHooks(t *testing.T) {
+	out := path.Join(t.TempDir(), "hook.out")
+	plan := &encoding.Plan{PlanConfig: encoding.PlanConfig{PostEncodeHook: &encoding.Hook{
+		Cmd:      fmt.Sprintf("echo $EASE_COMPRESSED_FILE $EASE_VMAF >> %s; test -n \"$EASE_VMAF\"", out),
+		AfterVQM: true,
+	}}}
+	results := []encoding.RunResult{
+		{EncoderCmd: encoding.EncoderCmd{CompressedFile: "a.mp4"}},
+		{EncoderCmd: encoding.EncoderCmd{CompressedFile: "b.mp4"}},
+		{EncoderCmd: encoding.EncoderCmd{CompressedFile: "a.mkv", RemuxOf: "a.mp4"}},
+	}
+	vqmResults := []namedVqmResult{
+		{Result: vqm.Result{CompressedFile: "a.mp4", Metrics: vqm.VideoQualityMetrics{VMAF: 93.5}}},
+	}
+
+	failed := afterVQMHooks(context.Background(), plan, results, vqmResults)
+	if diff := cmp.Diff(1, failed); diff != "" {
+		t.Errorf("Failed hooks mismatch (-want +got):\n%s", diff)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("a.mp4 93.5\nb.mp4\n", string(b)); diff != "" {
+		t.Errorf("Hook output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_createPlanFromJSONConfig_RelativePaths(t *testing.T) {
+	planDir := t.TempDir()
+	if err := os.WriteFile(path.Join(planDir, "clip01.mp4"), nil, 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	planFile := path.Join(planDir, "plan.json")
+	payload := []byte(`{
+		"OutDir": "out",
+		"Inputs": ["clip01.mp4"],
+		"Schemes": [{"Name": "sc1", "CommandTpl": ["cp %INPUT% %OUTPUT%.mp4"]}]
+	}`)
+	if err := os.WriteFile(planFile, payload, 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := createPlanFromJSONConfig(planFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{path.Join(planDir, "clip01.mp4")}, got.Inputs); diff != "" {
+		t.Errorf("Inputs mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(path.Join(planDir, "out"), got.OutDir); diff != "" {
+		t.Errorf("OutDir mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_createPlanFromJSONConfig_MultiplePlans(t *testing.T) {
+	planDir := t.TempDir()
+	for _, f := range []string{"clip01.mp4", "clip02.mp4"} {
+		if err := os.WriteFile(path.Join(planDir, f), nil, 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	plans := map[string]string{
+		"inputs.json":  `{"OutDir": "out", "Inputs": ["clip01.mp4", "clip02.mp4"]}`,
+		"schemes.json": `{"Schemes": [{"Name": "sc1", "CommandTpl": ["cp %INPUT% %OUTPUT%.mp4"]}]}`,
+		"dup.json":     `{"Inputs": ["clip01.mp4"]}`,
+	}
+	for name, payload := range plans {
+		if err := os.WriteFile(path.Join(planDir, name), []byte(payload), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	got, err := createPlanFromJSONConfig(path.Join(planDir, "inputs.json"), path.Join(planDir, "schemes.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(2, len(got.Commands)); diff != "" {
+		t.Errorf("Commands count mismatch (-want +got):\n%s", diff)
+	}
+
+	// Duplicate inputs are a warning only, each input is encoded once.
+	got, err = createPlanFromJSONConfig(
+		path.Join(planDir, "inputs.json"), path.Join(planDir, "schemes.json"), path.Join(planDir, "dup.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(2, len(got.Commands)); diff != "" {
+		t.Errorf("Commands count with duplicate inputs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_createPlanFromJSONConfig_CSVPlan(t *testing.T) {
+	planDir := t.TempDir()
+	for _, f := range []string{"clip01.mp4", "clip02.mp4"} {
+		if err := os.WriteFile(path.Join(planDir, f), nil, 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	plans := map[string]string{
+		"matrix.csv": "Input,Scheme,CommandTpl\n" +
+			"clip01.mp4,sc1,cp %INPUT% %OUTPUT%.mp4\n" +
+			"clip02.mp4,sc1,cp %INPUT% %OUTPUT%.mp4\n" +
+			"clip02.mp4,sc2,cp %INPUT% %OUTPUT%.mp4\n",
+		"settings.json": `{"OutDir": "out"}`,
+	}
+	for name, payload := range plans {
+		if err := os.WriteFile(path.Join(planDir, name), []byte(payload), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	got, err := createPlanFromJSONConfig(path.Join(planDir, "matrix.csv"), path.Join(planDir, "settings.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(3, len(got.Commands)); diff != "" {
+		t.Errorf("Commands count mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{path.Join(planDir, "clip02.mp4")}, got.Schemes[1].Inputs); diff != "" {
+		t.Errorf("Scheme inputs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_windowedMinVMAF(t *testing.T) {
+	got, err := windowedMinVMAF("testdata/vqm/ffmpeg_vmaf.json", 5, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got <= 0 || got > 100 {
+		t.Errorf("Windowed VMAF out of range: %v", got)
+	}
+
+	t.Run("Should fail for non-existent result file", func(t *testing.T) {
+		if _, err := windowedMinVMAF("testdata/vqm/non-existent.json", 5, nil); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_vmafJitter(t *testing.T) {
+	got, err := vmafJitter("testdata/vqm/ffmpeg_vmaf.json", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got < 0 || got > 100 {
+		t.Errorf("VMAF jitter out of range: %v", got)
+	}
+
+	t.Run("Should fail for non-existent result file", func(t *testing.T) {
+		if _, err := vmafJitter("testdata/vqm/non-existent.json", nil); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_tagVqmResults_Negative(t *testing.T) {
+	givenRunResults := []encoding.RunResult{
+		{EncoderCmd: encoding.EncoderCmd{Name: "sc1", CompressedFile: "non-existent/clip_sc1.mp4"}},
+	}
+	givenVqmResults := []namedVqmResult{
+		{Name: "sc1", Result: vqm.Result{CompressedFile: "non-existent/clip_sc1.mp4"}},
+	}
+
+	tagVqmResults(givenRunResults, givenVqmResults)
+
+	if givenRunResults[0].VQMTagged {
+		t.Error("Expected run result not to be marked as tagged on failure")
+	}
+}
+
+func Test_remuxVqmResults(t *testing.T) {
+	runResults := []encoding.RunResult{
+		{EncoderCmd: encoding.EncoderCmd{Name: "sc1", CompressedFile: "out/a.mp4"}},
+		{EncoderCmd: encoding.EncoderCmd{Name: "sc1", CompressedFile: "out/a.mkv", RemuxOf: "out/a.mp4"}},
+		{EncoderCmd: encoding.EncoderCmd{Name: "sc2", CompressedFile: "out/b.ts", RemuxOf: "out/b.mp4"}},
+	}
+	vqmResults := []namedVqmResult{
+		{Name: "sc1", Result: vqm.Result{
+			CompressedFile: "out/a.mp4",
+			ResultFile:     "out/a_vqm.json",
+			Metrics:        vqm.VideoQualityMetrics{VMAF: 90},
+		}},
+	}
+	// Remux of file without VQM result (out/b.mp4) should be skipped.
+	want := []namedVqmResult{
+		{Name: "sc1", Result: vqm.Result{
+			CompressedFile: "out/a.mkv",
+			ResultFile:     "out/a_vqm.json",
+			Metrics:        vqm.VideoQualityMetrics{VMAF: 90},
+		}},
+	}
+
+	got := remuxVqmResults(runResults, vqmResults)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Remux VQM results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_writeCommandsList(t *testing.T) {
+	given := []encoding.EncoderCmd{
+		{Name: "sc1", CompressedFile: "out/clip_sc1.mp4", OutputFile: "out/clip_sc1.out", Cmd: "ffmpeg -i clip.mp4 out/clip_sc1.mp4"},
+	}
+	var buf strings.Builder
+	if err := writeCommandsList(&buf, given); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if diff := cmp.Diff(2, len(lines)); diff != "" {
+		t.Fatalf("Line count mismatch (-want +got):\n%s", diff)
+	}
+	for _, want := range []string{"sc1", "out/clip_sc1.mp4", "out/clip_sc1.out", "ffmpeg -i clip.mp4 out/clip_sc1.mp4"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("Command row missing %q: %s", want, lines[1])
+		}
+	}
+}
+
+func Test_writeCommandsCSV(t *testing.T) {
+	given := []encoding.EncoderCmd{
+		{Name: "sc1", SourceFile: "clip.mp4", CompressedFile: "out/clip_sc1.mp4", Cmd: `ffmpeg -i clip.mp4 -metadata title="a, b" out/clip_sc1.mp4`},
+		{Name: "sc1", SourceFile: "clip.mp4", CompressedFile: "out/clip_sc1.mkv", Cmd: "ffmpeg -i out/clip_sc1.mp4 -c copy out/clip_sc1.mkv", RemuxOf: "out/clip_sc1.mp4"},
+	}
+	want := `name,input,output,command
+sc1,clip.mp4,out/clip_sc1.mp4,"ffmpeg -i clip.mp4 -metadata title=""a, b"" out/clip_sc1.mp4"
+sc1,clip.mp4,out/clip_sc1.mkv,ffmpeg -i out/clip_sc1.mp4 -c copy out/clip_sc1.mkv
+`
+	var buf strings.Builder
+	if err := writeCommandsCSV(&buf, given); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Commands CSV mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("Should write CSV file", func(t *testing.T) {
+		name := path.Join(t.TempDir(), "commands.csv")
+		if err := writeCommandsCSVFile(given, name); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, string(b)); diff != "" {
+			t.Errorf("Commands CSV file mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func Test_writeInputsList(t *testing.T) {
+	var buf strings.Builder
+	if err := writeInputsList(&buf, []string{"non-existent.mp4"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if diff := cmp.Diff(2, len(lines)); diff != "" {
+		t.Fatalf("Line count mismatch (-want +got):\n%s", diff)
+	}
+	// Probe failure should be reported in table rather than abort listing.
+	if !strings.HasPrefix(lines[1], "non-existent.mp4") || !strings.Contains(lines[1], "no such file") {
+		t.Errorf("Unexpected input row: %s", lines[1])
+	}
+}
+
+func Test_rdPoints(t *testing.T) {
+	given := []summaryRow{
+		{Name: "x264", Bitrate: 2000, VMAF: 90},
+		{Name: "x265", Bitrate: 1500, VMAF: 91},
+		{Name: "x264", Bitrate: 1000, VMAF: 80},
+		// Remux without VQMs.
+		{Name: "x264", Bitrate: 1010, VMAF: 0},
+	}
+	want := map[string][]analysis.RDPoint{
+		"x264": {{Bitrate: 2000, VMAF: 90}, {Bitrate: 1000, VMAF: 80}},
+		"x265": {{Bitrate: 1500, VMAF: 91}},
+	}
+
+	got := rdPoints(given)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RD points mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_rdPointsMultipleInputs(t *testing.T) {
+	given := []summaryRow{
+		{Name: "x264", SourceFile: "/src/a.y4m", Bitrate: 2000, VMAF: 90},
+		{Name: "x264", SourceFile: "/src/b.y4m", Bitrate: 1500, VMAF: 91},
+		{Name: "x264", SourceFile: "/src/a.y4m", Bitrate: 1000, VMAF: 80},
+	}
+	want := map[string][]analysis.RDPoint{
+		"x264 (a.y4m)": {{Bitrate: 2000, VMAF: 90}, {Bitrate: 1000, VMAF: 80}},
+		"x264 (b.y4m)": {{Bitrate: 1500, VMAF: 91}},
+	}
+
+	got := rdPoints(given)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RD points mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_runDoctorChecks(t *testing.T) {
+	given := []doctorCheck{
+		{Name: "good", Check: func() (string, error) { return "v1.0", nil }, Hint: "none"},
+		{Name: "bad", Check: func() (string, error) { return "", errors.New("not found") }, Hint: "install it"},
+	}
+	var buf bytes.Buffer
+
+	got := runDoctorChecks(&buf, given)
+
+	t.Run("Should count failed checks", func(t *testing.T) {
+		if diff := cmp.Diff(1, got); diff != "" {
+			t.Errorf("Failed check count mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should report checks", func(t *testing.T) {
+		for _, want := range []string{"[PASS] good: v1.0", "[FAIL] bad: not found", "hint: install it"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("Report missing %q:\n%s", want, buf.String())
+			}
+		}
+	})
+}
+
+func Test_evalDoctorChecks(t *testing.T) {
+	given := []doctorCheck{
+		{Name: "good", Check: func() (string, error) { return "v1.0", nil }, Hint: "none"},
+		{Name: "bad", Check: func() (string, error) { return "", errors.New("not found") }, Hint: "install it"},
+	}
+	want := `[
+  {
+    "Name": "good",
+    "OK": true,
+    "Details": "v1.0"
+  },
+  {
+    "Name": "bad",
+    "OK": false,
+    "Error": "not found",
+    "Hint": "install it"
+  }
+]
+`
+	results, failed := evalDoctorChecks(given)
+	if diff := cmp.Diff(1, failed); diff != "" {
+		t.Errorf("Failed check count mismatch (-want +got):\n%s", diff)
+	}
+	var buf bytes.Buffer
+	if err := writePorcelain(&buf, results); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Porcelain output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_writeLintReport(t *testing.T) {
+	t.Run("Should pass valid plan", func(t *testing.T) {
+		planFile, _ := fixPlanConfig(t)
+		pc, err := loadPlanConfig(planFile)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var buf bytes.Buffer
+		if got := writeLintReport(&buf, pc); got != 0 {
+			t.Errorf("Expected no errors, but got %d:\n%s", got, buf.String())
+		}
+	})
+	t.Run("Should report validation failures and lint issues", func(t *testing.T) {
+		pc, err := loadPlanConfig(fixPlanConfigInvalid(t))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		pc.Schemes = []encoding.Scheme{
+			{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% %OUTPUT%.mp4"},
+			{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% %OUTPUT%.mp4"},
+		}
+		var buf bytes.Buffer
+		if got := writeLintReport(&buf, pc); got == 0 {
+			t.Errorf("Expected errors, but got none:\n%s", buf.String())
+		}
+		for _, want := range []string{"[ERROR] stat", `[ERROR] Scheme name "sc1" used more than once`, "[WARN] Scheme sc1 has no -an"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("Report missing %q:\n%s", want, buf.String())
+			}
+		}
+	})
+}
+
+func Test_sceneCutFrames(t *testing.T) {
+	got := sceneCutFrames([]float64{0, 4, 9.04, 10.001}, 25)
+	if diff := cmp.Diff([]float64{0, 100, 226, 250}, got); diff != "" {
+		t.Errorf("Scene cut frames mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_writeSceneVMAF(t *testing.T) {
+	fm := vqm.FrameMetrics{{VMAF: 90}, {VMAF: 80}, {VMAF: 40}, {VMAF: 60}, {VMAF: 95}}
+	dir := t.TempDir()
+	outFile := path.Join(dir, "scenes.csv")
+	plotFile := path.Join(dir, "scenes.png")
+	if err := writeSceneVMAF(fm, []float64{2, 4}, 3, "test", outFile, plotFile); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `Rank,Scene,StartFrame,EndFrame,VMAF,MinVMAF
+1,2,2,4,50.000,40.000
+2,1,0,2,85.000,80.000
+3,3,4,5,95.000,95.000
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Scene ranking mismatch (-want +got):\n%s", diff)
+	}
+	if fi, err := os.Stat(plotFile); err != nil || fi.Size() == 0 {
+		t.Errorf("Expected non-empty plot file, got %v", err)
+	}
+}
+
+func Test_schemeVMAFs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcData := map[string]sourceData{
+		"a.mp4": {Name: "x264", CompressedFile: "a.mp4", WorkDir: wd, VqmResultFile: "testdata/vqm/ffmpeg_vmaf.json"},
+		"b.mp4": {Name: "x264", CompressedFile: "b.mp4", WorkDir: wd, VqmResultFile: "testdata/vqm/ffmpeg_vmaf.json"},
+		"c.mp4": {Name: "x265", CompressedFile: "c.mp4", VqmResultFile: path.Join(wd, "testdata/vqm/ffmpeg_vmaf.json")},
+	}
+	got, err := schemeVMAFs(srcData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 schemes, got %d", len(got))
+	}
+	if len(got["x264"]) != 2*len(got["x265"]) {
+		t.Errorf("Expected x264 VMAF values pooled from 2 encodes, got %d vs %d", len(got["x264"]), len(got["x265"]))
+	}
+
+	t.Run("Should fail without VQM result file", func(t *testing.T) {
+		_, err := schemeVMAFs(map[string]sourceData{"a.mp4": {Name: "x264", CompressedFile: "a.mp4"}})
+		if err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_writeFrameTypeStats(t *testing.T) {
+	stats := analysis.FrameTypeStats{
+		Frames: 4,
+		Types: []analysis.FrameTypeStat{
+			{PictType: "I", Count: 1, Percent: 25, AvgSize: 1000},
+			{PictType: "P", Count: 3, Percent: 75, AvgSize: 300},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeFrameTypeStats(&buf, stats); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `TYPE  COUNT  PERCENT  AVG SIZE (bytes)
+I     1      25.0     1000
+P     3      75.0     300
+I-frame interval (frames): mean 0.00, min 0, max 0, stddev 0.00
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_writeFrameMetricsFile(t *testing.T) {
+	given := vqm.FrameMetrics{{FrameNum: 0, VMAF: 97.5, PSNR: 43.8, MS_SSIM: 0.99}}
+	tests := map[string]string{
+		frameMetricsCSV:   "FrameNum,VMAF,PSNR,PSNR_CB,PSNR_CR,MS_SSIM\n0,97.50,43.80,0.00,0.00,0.9900\n",
+		frameMetricsJSONL: `{"FrameNum":0,"VMAF":97.5,"PSNR":43.8,"MS_SSIM":0.99}` + "\n",
+	}
+	for format, want := range tests {
+		t.Run(format, func(t *testing.T) {
+			outFile := path.Join(t.TempDir(), "frame_metrics."+format)
+			if err := writeFrameMetricsFile(given, format, outFile, defaultMetricPrecision); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got, err := os.ReadFile(outFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, string(got)); diff != "" {
+				t.Errorf("Per frame metrics mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_allZero(t *testing.T) {
+	tests := map[string]struct {
+		given []float64
+		want  bool
+	}{
+		"Empty":     {want: true},
+		"All zeros": {given: []float64{0, 0, 0}, want: true},
+		"Non-zero":  {given: []float64{0, 0.5, 0}, want: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, allZero(tc.given)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAnalyseApp_analysed(t *testing.T) {
+	outDir := t.TempDir()
+	v := sourceData{CompressedFile: "out/clip01_sc1.mp4", VqmResultFile: "out/clip01_sc1_vqm.json"}
+	resDir := path.Join(outDir, "clip01_sc1")
+	if err := os.Mkdir(resDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	touch := func(names ...string) {
+		for _, n := range names {
+			if err := os.WriteFile(path.Join(resDir, n), []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	a := &AnalyseApp{flOutDir: outDir, flPlots: plotSet{Bitrate: true, VMAF: true}}
+
+	touch("clip01_sc1_vqm.json", "clip01_sc1_bitrate.png", "clip01_sc1_vmaf.png")
+	if !a.analysed(v) {
+		t.Errorf("Expected analysis with selected plots to be complete")
+	}
+
+	a.flPlots = allPlots
+	touch("clip01_sc1_vqm.json", "clip01_sc1_bitrate.png", "clip01_sc1_vmaf.png", "clip01_sc1_psnr.png")
+	if a.analysed(v) {
+		t.Errorf("Expected analysis with missing MS-SSIM plot to be incomplete")
+	}
+
+	touch("clip01_sc1_ssim.png")
+	if !a.analysed(v) {
+		t.Errorf("Expected analysis with all plots to be complete")
+	}
+
+	a.flDashboard = true
+	if a.analysed(v) {
+		t.Errorf("Expected analysis with missing dashboard plot to be incomplete")
+	}
+
+	a.flDashboardOnly = true
+	touch("clip01_sc1_dashboard.png")
+	if !a.analysed(v) {
+		t.Errorf("Expected dashboard only analysis to be complete")
+	}
+}
+
+func Test_parsePlotSet(t *testing.T) {
+	got, err := parsePlotSet("Bitrate, vmaf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(plotSet{Bitrate: true, VMAF: true}, got); diff != "" {
+		t.Errorf("Plot set mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("bitrate,vmaf", got.String()); diff != "" {
+		t.Errorf("String() mismatch (-want +got):\n%s", diff)
+	}
+	for _, v := range []string{"", "vmaf,", "cambi"} {
+		if _, err := parsePlotSet(v); err == nil {
+			t.Errorf("Expected error for %q", v)
+		}
+	}
+}
+
+func Test_fieldAliasesFlag(t *testing.T) {
+	var got vqm.FieldAliases
+	f := fieldAliasesFlag{&got}
+	for _, v := range []string{"MS_SSIM=float_ms_ssim_v2", "VMAF=vmaf_v2", "MS_SSIM=ms_ssim"} {
+		if err := f.Set(v); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	want := vqm.FieldAliases{"MS_SSIM": {"float_ms_ssim_v2", "ms_ssim"}, "VMAF": {"vmaf_v2"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Field aliases mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("MS_SSIM=float_ms_ssim_v2,MS_SSIM=ms_ssim,VMAF=vmaf_v2", f.String()); diff != "" {
+		t.Errorf("String() mismatch (-want +got):\n%s", diff)
+	}
+	for _, v := range []string{"", "VMAF", "VMAF=", "SSIM=ssim"} {
+		if err := f.Set(v); err == nil {
+			t.Errorf("Expected error for %q", v)
+		}
+	}
+}
+
+func Test_loadMetricValuesWithAliases(t *testing.T) {
+	doc, err := os.ReadFile("testdata/vqm/ffmpeg_vmaf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate libvmaf version with renamed VMAF key.
+	renamed := path.Join(t.TempDir(), "renamed.json")
+	if err := os.WriteFile(renamed, bytes.ReplaceAll(doc, []byte(`"vmaf"`), []byte(`"vmaf_v2"`)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want, err := loadMetricValues("testdata/vqm/ffmpeg_vmaf.json", "VMAF", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := loadMetricValues(renamed, "VMAF", vqm.FieldAliases{"VMAF": {"vmaf_v2"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("VMAF values mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_checkVqmResultFiles(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		srcData map[string]sourceData
+		wantErr []string
+	}{
+		"Relative and absolute paths": {
+			srcData: map[string]sourceData{
+				"a.mp4": {CompressedFile: "a.mp4", WorkDir: wd, VqmResultFile: "testdata/vqm/ffmpeg_vmaf.json"},
+				"b.mp4": {CompressedFile: "b.mp4", VqmResultFile: path.Join(wd, "testdata/vqm/ffmpeg_vmaf.json")},
+			},
+		},
+		"Missing and removed result files": {
+			srcData: map[string]sourceData{
+				"a.mp4": {CompressedFile: "a.mp4", WorkDir: wd, VqmResultFile: "testdata/vqm/ffmpeg_vmaf.json"},
+				"b.mp4": {CompressedFile: "b.mp4", WorkDir: wd, VqmResultFile: "b_vqm.json"},
+				"c.mp4": {CompressedFile: "c.mp4", WorkDir: wd},
+			},
+			wantErr: []string{"VQM result file for b.mp4", "no VQM result file for c.mp4"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkVqmResultFiles(tc.srcData)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected error, but got <nil>")
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error to contain %q, got: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_excludeWithoutVqm(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcData := map[string]sourceData{
+		"a.mp4": {CompressedFile: "a.mp4", WorkDir: wd, VqmResultFile: "testdata/vqm/ffmpeg_vmaf.json"},
+		"b.mp4": {CompressedFile: "b.mp4", WorkDir: wd, VqmResultFile: "b_vqm.json"},
+		"c.mp4": {CompressedFile: "c.mp4", WorkDir: wd},
+	}
+	got := excludeWithoutVqm(srcData)
+	if diff := cmp.Diff([]string{"b.mp4", "c.mp4"}, got); diff != "" {
+		t.Errorf("Excluded mismatch (-want +got):\n%s", diff)
+	}
+	if err := checkVqmResultFiles(srcData); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func Test_checkCommandLimit(t *testing.T) {
+	plan := encoding.Plan{
+		PlanConfig: encoding.PlanConfig{
+			Inputs:  []string{"a.mp4", "b.mp4"},
+			Schemes: make([]encoding.Scheme, 2),
+		},
+		Commands: make([]encoding.EncoderCmd, 4),
+	}
+	tests := map[string]struct {
+		max       int
+		confirmed bool
+		wantErr   bool
+	}{
+		"Within limit":          {max: 4},
+		"Limit disabled":        {max: 0},
+		"Exceeds limit":         {max: 3, wantErr: true},
+		"Exceeds but confirmed": {max: 3, confirmed: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkCommandLimit(plan, tc.max, tc.confirmed)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "4 encoder commands (2 inputs x 2 schemes)") {
+				t.Errorf("Expected count and scope in error, got: %v", err)
+			}
+		})
+	}
+}
+
+func Test_checkFreeSpace(t *testing.T) {
+	tempDir := t.TempDir()
+	input := path.Join(tempDir, "input.mp4")
+	if err := os.WriteFile(input, make([]byte, 1<<20), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	plan := encoding.Plan{
+		PlanConfig: encoding.PlanConfig{
+			// Output directory is created only at run time.
+			OutDir: path.Join(tempDir, "out", "nested"),
+		},
+		Commands: []encoding.EncoderCmd{{SourceFile: input}, {SourceFile: input}},
+	}
+	tests := map[string]struct {
+		factor  float64
+		minMB   int
+		wantErr bool
+	}{
+		"Disabled":               {},
+		"Input size fits":        {factor: 1},
+		"Input size exceeds":     {factor: 1 << 40, wantErr: true},
+		"Minimum fits":           {minMB: 1},
+		"Minimum exceeds":        {minMB: 1 << 40, wantErr: true},
+		"Larger estimate counts": {factor: 1, minMB: 1 << 40, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkFreeSpace(plan, tc.factor, tc.minMB)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "not enough free space") {
+				t.Errorf("Expected free space error, got: %v", err)
+			}
+		})
+	}
+
+	t.Run("Missing input should fail", func(t *testing.T) {
+		p := plan
+		p.Commands = []encoding.EncoderCmd{{SourceFile: path.Join(tempDir, "missing.mp4")}}
+		if err := checkFreeSpace(p, 1, 0); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+// flakyMeasurer is vqm.Measurer that fails given number of times before
+// succeeding.
+type flakyMeasurer struct {
+	failures int
+	calls    int
+}
+
+func (m *flakyMeasurer) Measure() error {
+	return m.MeasureContext(context.Background())
+}
+
+func (m *flakyMeasurer) MeasureContext(ctx context.Context) error {
+	m.calls++
+	if m.calls <= m.failures {
+		return errors.New("transient failure")
+	}
+	return nil
+}
+
+func (m *flakyMeasurer) GetResult() (vqm.Result, error) {
+	return vqm.Result{}, nil
+}
+
+func Test_measureWithRetries(t *testing.T) {
+	defer func(d time.Duration) { vqmRetryBackoff = d }(vqmRetryBackoff)
+	vqmRetryBackoff = 0
+
+	tests := map[string]struct {
+		failures  int
+		retries   int
+		wantCalls int
+		wantErr   bool
+	}{
+		"No failures": {
+			failures:  0,
+			retries:   2,
+			wantCalls: 1,
+		},
+		"Recovers within retries": {
+			failures:  2,
+			retries:   2,
+			wantCalls: 3,
+		},
+		"Gives up after retries": {
+			failures:  3,
+			retries:   2,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		"No retries by default": {
+			failures:  1,
+			retries:   0,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := &flakyMeasurer{failures: tc.failures}
+			err := measureWithRetries(context.Background(), m, tc.retries, "test.mp4")
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantCalls, m.calls); diff != "" {
+				t.Errorf("Measure calls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("Should not retry when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		m := &flakyMeasurer{failures: 5}
+		if err := measureWithRetries(ctx, m, 3, "test.mp4"); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+		if m.calls != 1 {
+			t.Errorf("Expected single measure call, got %d", m.calls)
+		}
+	})
+}
+
+func Test_detectSceneCuts_Negative(t *testing.T) {
+	given := []encoding.RunResult{
+		{EncoderCmd: encoding.EncoderCmd{SourceFile: "/non/existent/source.mp4"}},
+	}
+	detectSceneCuts(given, 0.4)
+	if given[0].SceneCuts != nil {
+		t.Errorf("Expected no scene cuts, got: %v", given[0].SceneCuts)
+	}
+}
+
+func Test_checkDurations_Negative(t *testing.T) {
+	given := []encoding.RunResult{
+		{EncoderCmd: encoding.EncoderCmd{CompressedFile: "/non/existent/compressed.mp4"}, VideoDuration: 10},
+	}
+	checkDurations(given, 0.5)
+	if given[0].FrameDuration != 0 || given[0].DurationMismatch {
+		t.Errorf("Expected no duration check result, got: %v, %v", given[0].FrameDuration, given[0].DurationMismatch)
+	}
+}
+
+func Test_subsampleFor(t *testing.T) {
+	tests := map[string]struct {
+		interval, fps float64
+		want          int
+	}{
+		"24 fps":        {interval: 0.5, fps: 24, want: 12},
+		"60 fps":        {interval: 0.5, fps: 60, want: 30},
+		"NTSC rounding": {interval: 1, fps: 30000.0 / 1001, want: 30},
+		"Every frame":   {interval: 0.01, fps: 25, want: 1},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, subsampleFor(tc.interval, tc.fps)); diff != "" {
+				t.Errorf("n_subsample mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_intervalLibvmafOptions(t *testing.T) {
+	src := video.Metadata{FrameRate: "50/1", AvgFrameRate: "50/1"}
+
+	t.Run("Should create options", func(t *testing.T) {
+		got := intervalLibvmafOptions(nil, 0.2, src)
+		if diff := cmp.Diff(&vqm.LibvmafOptions{NSubsample: 10}, got); diff != "" {
+			t.Errorf("LibvmafOptions mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should keep other options", func(t *testing.T) {
+		given := &vqm.LibvmafOptions{Pool: "harmonic_mean", NSubsample: 3}
+		got := intervalLibvmafOptions(given, 0.2, src)
+		if diff := cmp.Diff(&vqm.LibvmafOptions{Pool: "harmonic_mean", NSubsample: 10}, got); diff != "" {
+			t.Errorf("LibvmafOptions mismatch (-want +got):\n%s", diff)
+		}
+		if given.NSubsample != 3 {
+			t.Errorf("Given options should not be modified: %v", given)
+		}
+	})
+	t.Run("Should keep options for unknown frame rate", func(t *testing.T) {
+		if got := intervalLibvmafOptions(nil, 0.2, video.Metadata{}); got != nil {
+			t.Errorf("Expected nil options, got: %v", got)
+		}
+	})
+}
+
+func Test_runMetadata(t *testing.T) {
+	t.Run("Should reuse known metadata without probing", func(t *testing.T) {
+		src := video.Metadata{FrameCount: 250}
+		comp := video.Metadata{FrameCount: 240}
+		r := &encoding.RunResult{
+			EncoderCmd: encoding.EncoderCmd{SourceFile: "non-existent/src.mp4", CompressedFile: "non-existent/comp.mp4"},
+			Metadata:   &comp,
+		}
+		gotSrc, gotComp, err := runMetadata(r, map[string]video.Metadata{r.SourceFile: src})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff([]video.Metadata{src, comp}, []video.Metadata{gotSrc, gotComp}); diff != "" {
+			t.Errorf("Metadata mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should fail probing non-existent source", func(t *testing.T) {
+		r := &encoding.RunResult{EncoderCmd: encoding.EncoderCmd{SourceFile: "non-existent/src.mp4"}}
+		if _, _, err := runMetadata(r, map[string]video.Metadata{}); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_resolveRotation(t *testing.T) {
+	landscape := video.Metadata{Width: 1920, Height: 1080}
+	rotated := func(m video.Metadata, r int) video.Metadata {
+		m.Rotation = r
+		return m
+	}
+	tests := map[string]struct {
+		givenSrc         video.Metadata
+		givenComp        video.Metadata
+		wantNoAutorotate bool
+		wantOk           bool
+	}{
+		"Same rotation": {
+			givenSrc:  rotated(landscape, 90),
+			givenComp: rotated(landscape, 90),
+			wantOk:    true,
+		},
+		"Rotation applied by encoder": {
+			givenSrc:  rotated(landscape, 90),
+			givenComp: video.Metadata{Width: 720, Height: 1280},
+			wantOk:    true,
+		},
+		"Rotation ignored by encoder": {
+			givenSrc:         rotated(landscape, 270),
+			givenComp:        video.Metadata{Width: 1280, Height: 720},
+			wantNoAutorotate: true,
+			wantOk:           true,
+		},
+		"Upside down can not be resolved": {
+			givenSrc:  rotated(landscape, 180),
+			givenComp: landscape,
+			wantOk:    false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotNoAutorotate, gotOk := resolveRotation(tc.givenSrc, tc.givenComp)
+			if diff := cmp.Diff(tc.wantNoAutorotate, gotNoAutorotate); diff != "" {
+				t.Errorf("noAutorotate mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantOk, gotOk); diff != "" {
+				t.Errorf("ok mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_appendHistory(t *testing.T) {
+	historyFile := path.Join(t.TempDir(), "history.jsonl")
+	given := []historyEntry{
+		{
+			Tag:  "abc123",
+			Time: time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC),
+			Plan: "plan.json",
+			aggregateSummary: aggregateSummary{
+				Encodes:          2,
+				AvgVMAF:          93.456,
+				HTotalEncodeTime: "1.5s",
+				TotalEncodeTime:  1500 * time.Millisecond,
+				TotalSize:        2048,
+			},
+		},
+		{
+			Tag:              "def456",
+			Time:             time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC),
+			Plan:             "plan.json",
+			aggregateSummary: aggregateSummary{Encodes: 1, TotalSize: 1024},
+		},
+	}
+	for _, e := range given {
+		if err := appendHistory(e, historyFile); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := readHistory(f)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(given, got, cmp.AllowUnexported(historyEntry{})); diff != "" {
+		t.Errorf("History entries mismatch (-want +got):\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	writeHistoryTable(&buf, got)
+	want := `TIME                  TAG     PLAN       ENCODES  AVG VMAF  TOTAL SIZE  ENCODE TIME
+2022-05-01T10:00:00Z  abc123  plan.json  2        93.46     2048        1.5s
+2022-05-02T10:00:00Z  def456  plan.json  1        0.00      1024        0s
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("History table mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_readHistory_Negative(t *testing.T) {
+	_, err := readHistory(strings.NewReader("{\"Tag\":\"a\"}\n\n{broken\n"))
+	if err == nil || !strings.Contains(err.Error(), "history line 3") {
+		t.Errorf("Expected error mentioning history line 3, got: %v", err)
+	}
+}
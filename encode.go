@@ -7,17 +7,30 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
 	"errors"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
+	"math"
+	"math/rand"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/evolution-gaming/ease/internal/analysis"
 	"github.com/evolution-gaming/ease/internal/encoding"
 	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/perm"
 	"github.com/evolution-gaming/ease/internal/tools"
+	"github.com/evolution-gaming/ease/internal/video"
 	"github.com/evolution-gaming/ease/internal/vqm"
 )
 
@@ -30,12 +43,74 @@ Examples:
 
   ease encode -plan plan.json -report encode_report.json`
 	app := &EncodeApp{
-		fs: flag.NewFlagSet("encode", flag.ContinueOnError),
+		fs:             flag.NewFlagSet("encode", flag.ContinueOnError),
+		flScoreWeights: defaultScoreWeights,
+		flPrecision:    defaultMetricPrecision,
 	}
-	app.fs.StringVar(&app.flPlan, "plan", "", "Encoding plan configuration file")
+	app.fs.Var(stringListFlag{&app.flPlans}, "plan", "Encoding plan configuration file, can be given multiple times to merge plan fragments")
 	app.fs.StringVar(&app.flReport, "report", "", "Encoding plan report file (default is stdout)")
+	app.fs.BoolVar(&app.flAppendReport, "append-report", false, "Merge results into existing report file given via -report instead of overwriting it")
+	app.fs.BoolVar(&app.flExcludeFailed, "exclude-failed", false, "Exclude failed encodes (and encodes without VQM results when VQMs are calculated) from report, summaries and exported metrics, so that they do not contribute zeros to statistics")
 	app.fs.BoolVar(&app.flCalculateVQM, "vqm", true, "Calculate VQMs")
+	app.fs.IntVar(&app.flVQMRetries, "vqm-retries", 0, "Number of times to retry failed VQM measurement before giving up")
+	app.fs.BoolVar(&app.flVQMProgress, "vqm-progress", false, "Show VQM measurement progress on stderr")
+	app.fs.IntVar(&app.flVQMNice, "vqm-nice", 0, "Niceness (-20..19) of VQM measurement processes independent of encoder commands' Nice, e.g. 10 for VQMs not to starve encodes (0 means normal priority)")
+	app.fs.BoolVar(&app.flVMAFCUDA, "vmaf-cuda", false, "Measure VMAF on GPU via CUDA accelerated libvmaf (libvmaf_cuda) when ffmpeg supports it, otherwise fall back to CPU")
+	app.fs.BoolVar(&app.flKeepVQMJSON, "keep-vqm-json", true, "Keep libvmaf per frame JSON result files (required by analyse subcommand)")
 	app.fs.BoolVar(&app.flDryRun, "dry-run", false, "Do not actually run, just do checks and validation")
+	app.fs.StringVar(&app.flVMAFModel, "vmaf-model", "", "libvmaf model preset (phone, 4k) or model file path (default is auto-detected model file)")
+	app.fs.IntVar(&app.flFrameCountTolerance, "frame-count-tolerance", -1, "Fail VQM if compressed and source frame counts differ by more than this number of frames (negative disables check)")
+	app.fs.Float64Var(&app.flVMAFAsymmetry, "check-vmaf-asymmetry", 0, "Also measure VMAF with source and compressed swapped and warn if difference exceeds this value (0 disables)")
+	app.fs.BoolVar(&app.flCountFrames, "count-frames", false, "Count frames exactly (slow) when listing inputs with -list-inputs")
+	app.fs.BoolVar(&app.flTagVQM, "tag-vqm", false, "Write VMAF score into compressed file's metadata (comment)")
+	app.fs.Float64Var(&app.flSceneCuts, "scene-cuts", 0, "Detect scene cuts in sources with given scene change threshold (0..1, e.g. 0.4), 0 disables")
+	app.fs.BoolVar(&app.flFrameCheck, "frame-check", false, "Detect dropped and duplicated frames by comparing source and compressed frame timestamps")
+	app.fs.Float64Var(&app.flDurationTolerance, "check-duration", 0, "Also derive compressed video duration from frame timestamps and warn if it differs from container reported duration by more than this number of seconds (0 disables)")
+	app.fs.StringVar(&app.flStreamResults, "stream-results", "", "Stream per encode results as JSON Lines to a file as they complete (\"-\" for stdout)")
+	app.fs.Var(intListFlag{&app.flVMAFFrames}, "vmaf-frames", "Comma separated list of frame indices (0 based) to measure VQMs on instead of all frames, per frame VMAF is reported")
+	app.fs.IntVar(&app.flExcludeLeading, "vqm-exclude-leading", 0, "Number of leading frames (e.g. intro) to exclude from aggregate VQMs")
+	app.fs.IntVar(&app.flExcludeTrailing, "vqm-exclude-trailing", 0, "Number of trailing frames (e.g. outro) to exclude from aggregate VQMs")
+	app.fs.Float64Var(&app.flExcludeLuma, "vqm-exclude-luma", 0, "Exclude frames with source average luma (0..255) below this value (e.g. black frames) from aggregate VQMs, 0 disables")
+	app.fs.Float64Var(&app.flVMAFInterval, "vmaf-interval", 0, "Temporal sampling interval of VQMs in seconds, converted to libvmaf n_subsample per input using it's frame rate (0 disables)")
+	app.fs.IntVar(&app.flVMAFWindow, "vmaf-window", 0, "Window size in frames for worst windowed VMAF average (0 disables)")
+	app.fs.IntVar(&app.flVMAFBootstrap, "vmaf-bootstrap", 0, "Number of bootstrap resamples of per frame VMAF for 95% confidence interval of VMAF mean (0 disables)")
+	durationVar(app.fs, &app.flMaxDuration, "max-duration", "Wall time budget for encoding (e.g. 2h), no new encodes are started once exceeded")
+	app.fs.BoolVar(&app.flWarmup, "warmup", false, "Run each encoding once before measured run to stabilize timing (warmup result is discarded)")
+	app.fs.BoolVar(&app.flDeterminismCheck, "determinism-check", false, "Run each encoding second time after measured run and report whether compressed files are byte identical")
+	app.fs.BoolVar(&app.flIntegrityCheck, "integrity-check", false, "Fully decode each compressed file after encoding and fail encodings producing corrupt files")
+	app.fs.StringVar(&app.flOrder, "order", encoding.OrderPlan, "Encoding order: plan, cost-asc (cheapest first), cost-desc (most expensive first), cost is input resolution × duration")
+	app.fs.BoolVar(&app.flReuseEncodes, "reuse-encodes", false, "Skip encoding if compressed file already exists and only calculate VQMs")
+	app.fs.BoolVar(&app.flReuseVQM, "reuse-vqm", false, "Skip VQM measurement if valid VQM result file already exists (e.g. from interrupted run) and use it instead")
+	app.fs.BoolVar(&app.flListInputs, "list-inputs", false, "List plan inputs with their metadata and exit")
+	app.fs.BoolVar(&app.flListCommands, "list-commands", false, "List expanded encoder commands with their output files and exit")
+	app.fs.StringVar(&app.flDumpPlan, "dump-plan", "", "Write effective plan with each encoder command as separate scheme into file, for re-running exactly the same encodings")
+	app.fs.StringVar(&app.flCommandsCSV, "commands-csv", "", "Write expanded encoder commands (name, input, output, command) into CSV file, e.g. for review along with -dry-run")
+	app.fs.IntVar(&app.flMaxCommands, "max-commands", defaultMaxCommands, "Refuse to run plans expanding to more encoder commands than this without -yes (0 disables limit)")
+	app.fs.BoolVar(&app.flYes, "yes", false, "Confirm running plan exceeding -max-commands")
+	app.fs.Float64Var(&app.flSpaceFactor, "space-factor", 0, "Fail before run if free space on output directory filesystem is below total size of inputs of all encoder commands multiplied by this factor (0 disables check)")
+	app.fs.IntVar(&app.flMinFreeSpace, "min-free-space", 0, "Fail before run if free space on output directory filesystem is below this number of MB (0 disables check)")
+	app.fs.BoolVar(&app.flSkipInputProbe, "skip-input-probe", false, "Do not probe inputs for video streams during validation")
+	app.fs.Float64Var(&app.flMinVQM.VMAF, "min-vmaf", 0, "Fail run if any encode's VMAF mean is below this value (0 disables check)")
+	app.fs.Float64Var(&app.flMinVQM.PSNR, "min-psnr", 0, "Fail run if any encode's PSNR mean is below this value (0 disables check)")
+	app.fs.Float64Var(&app.flMinVQM.MS_SSIM, "min-ms-ssim", 0, "Fail run if any encode's MS-SSIM mean is below this value (0 disables check)")
+	app.fs.Float64Var(&app.flMinSpeed, "min-speed", 0, "Fail run if any encode's average encoding speed (relative to realtime) is below this value (0 disables check)")
+	app.fs.StringVar(&app.flGolden, "golden", "", "Report file of a reference run, fail run if any encode's VMAF deviates from it beyond -golden-tolerance")
+	app.fs.Float64Var(&app.flGoldenTolerance, "golden-tolerance", 0.5, "Allowed VMAF deviation from golden values given via -golden")
+	app.fs.StringVar(&app.flHTMLReport, "html-report", "", "Also write HTML report of run to given file")
+	app.fs.StringVar(&app.flReportTemplate, "report-template", "", "Go html/template file to render HTML report with instead of default template (requires -html-report)")
+	app.fs.StringVar(&app.flMetricsFile, "metrics-file", "", "Write per encode metrics into file in Prometheus text exposition format (e.g. for node_exporter textfile collector)")
+	app.fs.StringVar(&app.flInfluxFile, "influx-file", "", "Write per encode metrics into file in InfluxDB line protocol")
+	app.fs.StringVar(&app.flHistory, "history", "", "Append aggregate summary of this run along with -run-tag to given history file (JSON Lines)")
+	app.fs.StringVar(&app.flRunTag, "run-tag", "", "Tag of this run (e.g. git SHA) recorded in history file given via -history")
+	app.fs.BoolVar(&app.flSummary, "summary", false, "Print summary table to stdout after run")
+	app.fs.Var(delimiterFlag{&app.flSummaryDelimiter}, "summary-delimiter", "Write summary as delimiter separated values with given delimiter (e.g. \",\", \";\" or \"tab\") instead of aligned table (implies -summary)")
+	app.fs.StringVar(&app.flGroupBy, "group-by", "", "Group summary table by: input (implies -summary)")
+	app.fs.StringVar(&app.flSortBy, "sort-by", "", "Sort summary table in ascending order by: vmaf, bitrate, speed, score or name (implies -summary, default is VMAF descending or score descending with -score-weights)")
+	app.fs.BoolVar(&app.flSortDesc, "desc", false, "Sort summary table given via -sort-by in descending order")
+	app.fs.Var(scoreWeightsFlag{&app.flScoreWeights}, "score-weights", "Weights of normalized VMAF, bitrate and speed in composite score of summary as KEY=WEIGHT list, e.g. vmaf=2,bitrate=1,speed=0.5")
+	app.fs.Var(metricPrecisionFlag{&app.flPrecision}, "precision", "Decimal places of metrics in summary and log as KEY=PLACES list (keys: vmaf, psnr, ms-ssim, bitrate, other), e.g. vmaf=3,bitrate=1")
+	app.fs.StringVar(&app.flCleanup, "cleanup", cleanupNone, "Remove artifacts after report is written: none, intermediates (encoder output/log and libvmaf result files), encodes (intermediates and compressed files)")
+	app.fs.BoolVar(&app.flCleanupDryRun, "cleanup-dry-run", false, "Only list files -cleanup would remove")
 	app.fs.Usage = func() {
 		printSubCommandUsage(longHelp, app.fs)
 	}
@@ -50,14 +125,133 @@ var _ Commander = (*EncodeApp)(nil)
 type EncodeApp struct {
 	// FlagSet instance
 	fs *flag.FlagSet
-	// Encoding plan config file flag
-	flPlan string
+	// Encoding plan config files flag
+	flPlans []string
 	// Execution report output file flag
 	flReport string
+	// Merge results into existing report flag
+	flAppendReport bool
+	// Exclude failed encodes from report flag
+	flExcludeFailed bool
 	// Calculate VQM flag
 	flCalculateVQM bool
+	// Keep libvmaf JSON result files flag
+	flKeepVQMJSON bool
+	// Artifact cleanup policy flag
+	flCleanup string
+	// List files to clean up without removing them flag
+	flCleanupDryRun bool
+	// Show VQM measurement progress flag
+	flVQMProgress bool
+	// Niceness of VQM measurement processes flag
+	flVQMNice int
+	// Use CUDA accelerated libvmaf flag
+	flVMAFCUDA bool
 	// Dry run mode flag
 	flDryRun bool
+	// Print summary table flag
+	flSummary bool
+	// Prometheus metrics output file flag
+	flMetricsFile string
+	// InfluxDB line protocol output file flag
+	flInfluxFile string
+	// HTML report output file flag
+	flHTMLReport string
+	// HTML report template file, empty means default template
+	flReportTemplate string
+	// Run history file flag
+	flHistory string
+	// Run tag recorded in history file
+	flRunTag string
+	// Summary field delimiter flag, zero means aligned table
+	flSummaryDelimiter rune
+	// Summary table grouping flag
+	flGroupBy string
+	// Summary table sort key flag
+	flSortBy string
+	// Summary table descending sort flag
+	flSortDesc bool
+	// Composite score weights flag
+	flScoreWeights scoreWeights
+	// Decimal places of metrics in summary and log flag
+	flPrecision metricPrecision
+	// Skip probing of inputs flag
+	flSkipInputProbe bool
+	// Max number of encoder commands allowed without confirmation, 0
+	// disables limit
+	flMaxCommands int
+	// Confirm exceeding max number of encoder commands flag
+	flYes bool
+	// Factor of total input size required to be free on OutDir filesystem,
+	// 0 disables check
+	flSpaceFactor float64
+	// Minimum free space (in MB) required on OutDir filesystem, 0 disables
+	// check
+	flMinFreeSpace int
+	// List inputs mode flag
+	flListInputs bool
+	// List expanded commands mode flag
+	flListCommands bool
+	// Effective plan output file flag
+	flDumpPlan string
+	// Expanded commands CSV output file flag
+	flCommandsCSV string
+	// Reuse existing compressed files flag
+	flReuseEncodes bool
+	// Reuse existing VQM result files flag
+	flReuseVQM bool
+	// Warmup run flag
+	flWarmup bool
+	// Determinism check flag
+	flDeterminismCheck bool
+	// Compressed file integrity check flag
+	flIntegrityCheck bool
+	// Wall time budget flag
+	flMaxDuration time.Duration
+	// Encoding order flag
+	flOrder string
+	// libvmaf model preset or model file flag
+	flVMAFModel string
+	// Sliding window size in frames for windowed minimum VMAF
+	flVMAFWindow int
+	// Number of bootstrap resamples for VMAF mean confidence interval
+	flVMAFBootstrap int
+	// Number of leading and trailing frames excluded from aggregate VQMs
+	flExcludeLeading  int
+	flExcludeTrailing int
+	// Source luma threshold for excluding frames from aggregate VQMs
+	flExcludeLuma float64
+	// Explicit frame indices to measure VQMs on
+	flVMAFFrames []int
+	// Temporal sampling interval of VQMs in seconds, 0 means every frame
+	flVMAFInterval float64
+	// File to stream per encode results to as JSON Lines
+	flStreamResults string
+	// Scene change threshold for scene cut detection, 0 disables detection
+	flSceneCuts float64
+	// Detect dropped and duplicated frames flag
+	flFrameCheck bool
+	// Allowed difference between container reported and frame derived
+	// durations in seconds, 0 disables check
+	flDurationTolerance float64
+	// Write VQM scores into compressed file metadata flag
+	flTagVQM bool
+	// Count input frames exactly when listing inputs flag
+	flCountFrames bool
+	// Allowed frame count difference for VQM, negative disables check
+	flFrameCountTolerance int
+	// Number of retries of failed VQM measurement
+	flVQMRetries int
+	// Max allowed difference between VMAF and reverse VMAF, 0 disables check
+	flVMAFAsymmetry float64
+	// Minimal acceptable VQM values flags
+	flMinVQM vqmThresholds
+	// Minimal acceptable average encoding speed flag
+	flMinSpeed float64
+	// Golden VMAF values report file flag
+	flGolden string
+	// Allowed deviation from golden VMAF values flag
+	flGoldenTolerance float64
 }
 
 func (a *EncodeApp) Name() string {
@@ -77,7 +271,7 @@ func (a *EncodeApp) ReportWriter() io.Writer {
 		return os.Stdout
 	}
 	// Case to write to file.
-	out, err := os.Create(a.flReport)
+	out, err := perm.Create(a.flReport)
 	if err != nil {
 		logging.Infof("Unable to create result file redirecting to stdout: %s", err)
 		return os.Stdout
@@ -95,7 +289,7 @@ func (a *EncodeApp) Init(args []string) error {
 	}
 
 	// Encoding plan config file is mandatory.
-	if a.flPlan == "" {
+	if len(a.flPlans) == 0 {
 		a.Help()
 		return &AppError{
 			exitCode: 2,
@@ -103,15 +297,173 @@ func (a *EncodeApp) Init(args []string) error {
 		}
 	}
 
-	// Encoding plan config file should exist.
-	if _, err := os.Stat(a.flPlan); err != nil {
+	// Encoding plan config files should exist.
+	for _, p := range a.flPlans {
+		if _, err := os.Stat(p); err != nil {
+			a.Help()
+			return &AppError{
+				exitCode: 2,
+				msg:      fmt.Sprintf("encoding plan file does not exist? %s", err),
+			}
+		}
+	}
+
+	if a.flSummaryDelimiter != 0 {
+		a.flSummary = true
+	}
+
+	if a.flGolden != "" && !a.flCalculateVQM {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "option -golden requires VQM calculation (-vqm)",
+		}
+	}
+
+	if a.flMinVQM.enabled() && !a.flCalculateVQM {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "options -min-vmaf, -min-psnr and -min-ms-ssim require VQM calculation (-vqm)",
+		}
+	}
+
+	if a.flAppendReport && a.flReport == "" {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "option -append-report requires -report",
+		}
+	}
+
+	if a.flVQMRetries < 0 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid -vqm-retries value: %d", a.flVQMRetries),
+		}
+	}
+
+	if a.flVQMNice < -20 || a.flVQMNice > 19 {
 		a.Help()
 		return &AppError{
 			exitCode: 2,
-			msg:      fmt.Sprintf("encoding plan file does not exist? %s", err),
+			msg:      fmt.Sprintf("invalid -vqm-nice value: %d", a.flVQMNice),
 		}
 	}
 
+	// Streamed records would be interleaved with report JSON.
+	if a.flStreamResults == "-" && a.flReport == "" {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "option -stream-results - requires -report, since report is written to stdout by default",
+		}
+	}
+
+	if a.flExcludeLeading < 0 || a.flExcludeTrailing < 0 || a.flExcludeLuma < 0 || a.flExcludeLuma > 255 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "invalid frame exclusion: frame counts should be non-negative and luma within 0..255",
+		}
+	}
+
+	if a.flVMAFInterval < 0 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid -vmaf-interval value: %g", a.flVMAFInterval),
+		}
+	}
+
+	if a.flVMAFBootstrap < 0 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid -vmaf-bootstrap value: %d", a.flVMAFBootstrap),
+		}
+	}
+
+	if a.flVMAFInterval > 0 && len(a.flVMAFFrames) != 0 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "options -vmaf-interval and -vmaf-frames are mutually exclusive",
+		}
+	}
+
+	if a.flMaxCommands < 0 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid -max-commands value: %d", a.flMaxCommands),
+		}
+	}
+
+	if a.flReportTemplate != "" && a.flHTMLReport == "" {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "option -report-template requires -html-report",
+		}
+	}
+
+	if a.flSpaceFactor < 0 || a.flMinFreeSpace < 0 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "options -space-factor and -min-free-space should not be negative",
+		}
+	}
+
+	if !isCleanupPolicy(a.flCleanup) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("unsupported -cleanup value: %s", a.flCleanup),
+		}
+	}
+
+	if !encoding.IsOrder(a.flOrder) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid encoding order: %s", a.flOrder),
+		}
+	}
+
+	switch a.flGroupBy {
+	case "":
+	case summaryGroupByInput:
+		a.flSummary = true
+	default:
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("unsupported -group-by value: %s", a.flGroupBy),
+		}
+	}
+
+	if a.flSortBy != "" {
+		if !isSummarySortKey(a.flSortBy) {
+			a.Help()
+			return &AppError{
+				exitCode: 2,
+				msg:      fmt.Sprintf("unsupported -sort-by value: %s", a.flSortBy),
+			}
+		}
+		a.flSummary = true
+	}
+
+	// Weights tuned by user make composite score the default sort key.
+	a.fs.Visit(func(f *flag.Flag) {
+		if f.Name == "score-weights" && a.flSortBy == "" {
+			a.flSortBy = summarySortScore
+			a.flSortDesc = true
+		}
+	})
+
 	return nil
 }
 
@@ -121,13 +473,87 @@ func (a *EncodeApp) Run(args []string) error {
 		return err
 	}
 
-	logging.Debugf("Encoding plan config file: %v", a.flPlan)
+	logging.Debugf("Encoding plan config files: %v", a.flPlans)
 
-	plan, err := createPlanFromJSONConfig(a.flPlan)
+	plan, err := createPlanFromJSONConfig(a.flPlans...)
 	if err != nil {
+		return &AppError{exitCode: exitConfig, msg: err.Error()}
+	}
+
+	// Guard against runaway runs from too broad input globs before any per
+	// command work (e.g. ordering by cost probes inputs), listing modes are
+	// exempt so that expanded plan can be reviewed.
+	if !a.flListInputs && !a.flListCommands {
+		if err := checkCommandLimit(plan, a.flMaxCommands, a.flYes); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+	}
+
+	// In "list inputs" mode just report inputs and their metadata.
+	if a.flListInputs {
+		var opts []tools.ProbeOption
+		if a.flCountFrames {
+			opts = append(opts, tools.WithFrameCounting())
+		}
+		if porcelain {
+			err = writePorcelain(os.Stdout, probeInputs(plan.Inputs, opts...))
+		} else {
+			err = writeInputsList(os.Stdout, plan.Inputs, opts...)
+		}
+		if err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+		return nil
+	}
+
+	if err := plan.OrderByCost(a.flOrder); err != nil {
+		return &AppError{exitCode: 1, msg: err.Error()}
+	}
+
+	if a.flDumpPlan != "" {
+		if err := writeEffectivePlan(&plan, a.flDumpPlan); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+	}
+
+	if a.flCommandsCSV != "" {
+		if err := writeCommandsCSVFile(plan.Commands, a.flCommandsCSV); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+	}
+
+	// In "list commands" mode just report what would be executed.
+	if a.flListCommands {
+		if porcelain {
+			err = writePorcelain(os.Stdout, plan.Commands)
+		} else {
+			err = writeCommandsList(os.Stdout, plan.Commands)
+		}
+		if err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+		return nil
+	}
+
+	// Running out of disk space mid-run would corrupt last output.
+	if err := checkFreeSpace(plan, a.flSpaceFactor, a.flMinFreeSpace); err != nil {
 		return &AppError{exitCode: 1, msg: err.Error()}
 	}
 
+	// Make sure all inputs are actually videos, this can be skipped for
+	// large plans as it requires probing each input.
+	if !a.flSkipInputProbe {
+		if err := plan.ProbeInputs(); err != nil {
+			ev := &encoding.PlanConfigError{}
+			if errors.As(err, &ev) {
+				logging.Debugf(
+					"PlanConfig input probe failures:\n%s",
+					strings.Join(ev.Reasons(), "\n"))
+			}
+			return &AppError{exitCode: exitConfig, msg: fmt.Sprintf("PlanConfig not valid: %s", err)}
+		}
+	}
+
 	// Check external tool dependencies - for VMAF calculations we require
 	// ffmpeg and libvmaf model file available.
 	ffmpegPath, err := tools.FfmpegPath()
@@ -135,9 +561,26 @@ func (a *EncodeApp) Run(args []string) error {
 		return &AppError{exitCode: 1, msg: fmt.Sprintf("dependency ffmpeg: %s", err)}
 	}
 
-	libvmafModelPath, err := tools.FindLibvmafModel()
-	if err != nil {
-		return &AppError{exitCode: 1, msg: fmt.Sprintf("dependency libvmaf model: %s", err)}
+	// Explicitly given libvmaf model is either a preset or a model file path,
+	// otherwise look for default model file.
+	libvmafModelPath := a.flVMAFModel
+	switch {
+	case libvmafModelPath == "":
+		libvmafModelPath, err = tools.FindLibvmafModel()
+		if err != nil {
+			return &AppError{exitCode: 1, msg: fmt.Sprintf("dependency libvmaf model: %s", err)}
+		}
+	case !vqm.IsModelPreset(libvmafModelPath):
+		if _, err := os.Stat(libvmafModelPath); err != nil {
+			return &AppError{exitCode: 1, msg: fmt.Sprintf("dependency libvmaf model: %s", err)}
+		}
+	}
+	// Broken model file would otherwise only fail VQM measurement after
+	// encoding.
+	if !vqm.IsModelPreset(libvmafModelPath) {
+		if err := tools.ValidateLibvmafModel(libvmafModelPath); err != nil {
+			return &AppError{exitCode: 1, msg: fmt.Sprintf("dependency libvmaf model: %s", err)}
+		}
 	}
 
 	// Early return in "dry run" mode.
@@ -146,62 +589,1058 @@ func (a *EncodeApp) Run(args []string) error {
 		return nil
 	}
 
-	result, err := plan.Run()
+	// Load previous report early, so that we do not find out it is broken
+	// only after lengthy run.
+	var prevReport *report
+	if a.flAppendReport {
+		if _, err := os.Stat(a.flReport); err == nil {
+			if prevReport, err = loadReportFile(a.flReport); err != nil {
+				return &AppError{exitCode: 1, msg: err.Error()}
+			}
+		}
+	}
+
+	// Load golden values early for the same reason.
+	var golden goldenVMAF
+	if a.flGolden != "" {
+		if golden, err = loadGoldenVMAF(a.flGolden); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+	}
+
+	// Parse HTML report template early for the same reason.
+	var reportTpl *template.Template
+	if a.flHTMLReport != "" {
+		if reportTpl, err = parseReportTemplate(a.flReportTemplate); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+	}
+
+	// Record everything needed to reproduce this run.
+	ffmpegVersion, err := tools.FfmpegVersion()
+	if err != nil {
+		logging.Infof("Unable to get ffmpeg version: %s", err)
+	}
+	m := newManifest(&plan, manifestTools{
+		FfmpegPath:    ffmpegPath,
+		FfmpegVersion: ffmpegVersion,
+		LibvmafModel:  libvmafModelPath,
+	})
+	if err := writeManifest(m, plan.OutDir); err != nil {
+		return &AppError{exitCode: 1, msg: err.Error()}
+	}
+
+	// Make sure encoder and VQM processes are terminated on interrupt.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var stream *resultStream
+	if a.flStreamResults != "" {
+		if stream, err = newResultStream(a.flStreamResults); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+		defer stream.Close()
+	}
+	writeRecord := func(rec resultRecord) {
+		if err := stream.Write(rec); err != nil {
+			logging.Infof("Error streaming result: %s", err)
+		}
+	}
+
+	plan.ReuseExisting = a.flReuseEncodes
+	plan.Warmup = a.flWarmup
+	plan.CheckDeterminism = a.flDeterminismCheck
+	plan.CheckIntegrity = a.flIntegrityCheck
+	plan.MaxDuration = a.flMaxDuration
+	plan.MeasureVMAF = a.searchVMAFFunc(ffmpegPath, libvmafModelPath, plan)
+
+	// Time spent in each stage of the run is logged on any return path.
+	var timer stageTimer
+	defer func() {
+		timer.end()
+		logging.Infof("Stage timings: %s", &timer)
+	}()
+	timer.begin(stageEncode)
+	result, err := plan.RunContext(ctx)
 	// Make sure to log any errors from RunResults.
 	if ur := unrollResultErrors(result.RunResults); ur != "" {
 		logging.Infof("Run had following ERRORS:\n%s", ur)
 	}
-	if err != nil {
-		return &AppError{exitCode: 1, msg: err.Error()}
+	for i := range result.RunResults {
+		if r := &result.RunResults[i]; r.BelowRealtime {
+			logging.Infof("Encoding of %s is slower than realtime (speed %.2fx)", r.CompressedFile, r.AvgEncodingSpeed)
+		}
+		if r := &result.RunResults[i]; r.LargerThanSource {
+			logging.Infof("Compressed file %s is larger than source %s, check scheme %s", r.CompressedFile, r.SourceFile, r.Name)
+		}
+	}
+	// When time budget is exceeded we still want to process and report
+	// encodes that completed.
+	budgetExceeded := errors.Is(err, encoding.ErrMaxDurationExceeded)
+	if err != nil && !budgetExceeded {
+		return &AppError{exitCode: exitEncode, msg: err.Error()}
+	}
+
+	timer.begin(stageAnalysis)
+	if a.flSceneCuts > 0 {
+		detectSceneCuts(result.RunResults, a.flSceneCuts)
+	}
+
+	if a.flFrameCheck {
+		for i := range result.RunResults {
+			r := &result.RunResults[i]
+			// Remuxed stream is identical to encoded one.
+			if r.RemuxOf != "" || len(r.Errors) != 0 {
+				continue
+			}
+			diff, err := frameTimingDiff(r.SourceFile, r.CompressedFile)
+			if err != nil {
+				logging.Infof("Frame check failed for %s: %s", r.CompressedFile, err)
+				continue
+			}
+			r.DroppedFrames, r.DuplicatedFrames = diff.Dropped, diff.Duplicated
+			if diff.Dropped != 0 || diff.Duplicated != 0 {
+				logging.Infof("Frame check for %s: %d dropped, %d duplicated frames",
+					r.CompressedFile, diff.Dropped, diff.Duplicated)
+			}
+		}
+	}
+
+	if a.flDurationTolerance > 0 {
+		checkDurations(result.RunResults, a.flDurationTolerance)
 	}
 
 	// Do VQM calculations for encoded videos.
+	timer.begin(stageVQM)
 	var vqmFailed bool = false
 	var vqmResults []namedVqmResult
 	if a.flCalculateVQM {
+		// Sources are shared between encodes, so probe each only once.
+		sourceMeta := make(map[string]video.Metadata)
 		for i := range result.RunResults {
 			r := &result.RunResults[i]
+			// Remuxed stream is identical to encoded one, VQMs are shared.
+			if r.RemuxOf != "" {
+				continue
+			}
+			// Failed encodes only get here when time budget is exceeded,
+			// there is no compressed file worth measuring.
+			if len(r.Errors) != 0 {
+				logging.Infof("Skipping VQMs for failed encode %s", r.CompressedFile)
+				writeRecord(resultRecord{RunResult: *r})
+				continue
+			}
 			resFile := strings.TrimSuffix(r.CompressedFile, filepath.Ext(r.CompressedFile)) + "_vqm.json"
-			vqmTool, err := vqm.NewFfmpegVMAF(ffmpegPath, libvmafModelPath, r.CompressedFile, r.SourceFile, resFile)
+			// Store absolute path, so that report is usable regardless of
+			// CWD of later stages. Working directory may contain spaces or
+			// other special characters, VMAF command quotes and escapes it.
+			if !filepath.IsAbs(resFile) {
+				resFile = filepath.Join(r.WorkDir, resFile)
+			}
+			modelPath := plan.VMAFModelFor(r.SourceFile, libvmafModelPath)
+			inputArgs := strings.Fields(plan.InputArgsFor(r.SourceFile))
+			vqmOpts := []vqm.FfmpegVMAFOption{
+				vqm.WithSourceInputArgs(inputArgs),
+				vqm.WithFrameCountTolerance(a.flFrameCountTolerance),
+				vqm.WithGeometry(r.VMAFGeometry),
+				vqm.WithFeatures(r.VMAFFeatures),
+				vqm.WithUpscale(r.VMAFUpscale),
+				vqm.WithFrames(a.flVMAFFrames),
+				vqm.WithExcludedFrames(a.flExcludeLeading, a.flExcludeTrailing),
+				vqm.WithLumaThreshold(a.flExcludeLuma),
+				vqm.WithNice(a.flVQMNice),
+			}
+			libvmafOpts := plan.VMAFOptions
+			var rotationOpts []vqm.FfmpegVMAFOption
+			if src, comp, err := runMetadata(r, sourceMeta, tools.WithInputArgs(inputArgs...)); err != nil {
+				logging.Debugf("Unable to get metadata for %s: %s", r.CompressedFile, err)
+			} else {
+				rotationOpts = rotationOptions(r, src, comp)
+				if diffs := src.Mismatch(comp.Color); len(diffs) > 0 {
+					logging.Infof("Color characteristics of %s and %s differ (%s), %s",
+						r.SourceFile, r.CompressedFile, strings.Join(diffs, ", "), colorAdvice(src.Color, comp.Color))
+				}
+				vqmOpts = append(vqmOpts, vqm.WithMetadata(comp, src))
+				if a.flVMAFInterval > 0 {
+					libvmafOpts = intervalLibvmafOptions(libvmafOpts, a.flVMAFInterval, src)
+				}
+			}
+			var aliases vqm.FieldAliases
+			if libvmafOpts != nil {
+				vqmOpts = append(vqmOpts, vqm.WithLibvmafOptions(*libvmafOpts))
+				aliases = libvmafOpts.FieldAliases
+			}
+			vqmOpts = append(vqmOpts, rotationOpts...)
+			if a.flVQMProgress {
+				vqmOpts = append(vqmOpts, vqm.WithProgress(os.Stderr))
+			}
+			if a.flVMAFCUDA {
+				vqmOpts = append(vqmOpts, vqm.WithCUDA())
+			}
+			vqmTool, err := vqm.NewFfmpegVMAF(ffmpegPath, modelPath, r.CompressedFile, r.SourceFile, resFile, vqmOpts...)
 			if err != nil {
 				vqmFailed = true
 				logging.Infof("Error while initializing VQM tool: %s", err)
+				writeRecord(resultRecord{RunResult: *r})
 				continue
 			}
 
-			logging.Infof("Start measuring VQMs for %s", r.CompressedFile)
-			if err = vqmTool.Measure(); err != nil {
-				vqmFailed = true
-				logging.Infof("Failed calculate VQM for %s due to error: %s", r.CompressedFile, err)
-				continue
+			if a.flReuseVQM && resumeVQM(vqmTool, resFile) {
+				logging.Infof("Reusing existing VQM result %s", resFile)
+			} else {
+				logging.Infof("Start measuring VQMs for %s", r.CompressedFile)
+				if err = measureWithRetries(ctx, vqmTool, a.flVQMRetries, r.CompressedFile); err != nil {
+					vqmFailed = true
+					logging.Infof("Failed calculate VQM for %s due to error: %s", r.CompressedFile, err)
+					writeRecord(resultRecord{RunResult: *r})
+					continue
+				}
 			}
 
 			res, err := vqmTool.GetResult()
 			if err != nil {
 				logging.Infof("Error while getting VQM result for %s: %s", r.CompressedFile, err)
 			}
+			if res.Metrics.ExcludedFrames > 0 {
+				logging.Infof("%d frames excluded from aggregate VQMs for %s", res.Metrics.ExcludedFrames, r.CompressedFile)
+			}
+			reverse := a.flVMAFAsymmetry > 0 && err == nil
+			// Reverse VMAF uses source as distorted input, where input
+			// options are not applied.
+			if reverse && len(inputArgs) > 0 {
+				logging.Infof("Skipping reverse VMAF for %s: source %s requires input options", r.CompressedFile, r.SourceFile)
+				reverse = false
+			}
+			// Lower resolution encode can not be used as reference for
+			// source, upscale is only applied to distorted input.
+			if reverse && r.VMAFUpscale != "" {
+				logging.Infof("Skipping reverse VMAF for %s: encode is upscaled for VMAF (VMAFUpscale)", r.CompressedFile)
+				reverse = false
+			}
+			if reverse {
+				var rErr error
+				reverseOpts := append(rotationOpts, vqm.WithFrames(a.flVMAFFrames), vqm.WithNice(a.flVQMNice))
+				if libvmafOpts != nil {
+					reverseOpts = append(reverseOpts, vqm.WithLibvmafOptions(*libvmafOpts))
+				}
+				res.Metrics.VMAFReverse, rErr = measureReverseVMAF(ctx, ffmpegPath, modelPath, r, reverseOpts...)
+				if rErr != nil {
+					logging.Infof("Error measuring reverse VMAF for %s: %s", r.CompressedFile, rErr)
+				} else if d := res.Metrics.VMAFAsymmetry(); d > a.flVMAFAsymmetry {
+					logging.Infof("VMAF asymmetry for %s is %.3f (VMAF %.3f, reverse VMAF %.3f), check scaling/cropping",
+						r.CompressedFile, d, res.Metrics.VMAF, res.Metrics.VMAFReverse)
+				}
+			}
+			if a.flVMAFWindow > 0 && err == nil {
+				res.Metrics.VMAFWindowedMin, err = windowedMinVMAF(res.ResultFile, a.flVMAFWindow, aliases)
+				if err != nil {
+					logging.Infof("Error calculating windowed VMAF for %s: %s", r.CompressedFile, err)
+				}
+			}
+			if a.flVMAFBootstrap > 0 && err == nil {
+				res.Metrics.VMAFMeanCILow, res.Metrics.VMAFMeanCIHigh, err = vmafMeanCI(res.ResultFile, a.flVMAFBootstrap, aliases)
+				if err != nil {
+					logging.Infof("Error bootstrapping VMAF confidence interval for %s: %s", r.CompressedFile, err)
+				}
+			}
+			// Jitter of sampled (non consecutive) frames is meaningless.
+			if len(a.flVMAFFrames) == 0 && err == nil {
+				res.Metrics.VMAFJitter, err = vmafJitter(res.ResultFile, aliases)
+				if err != nil {
+					logging.Infof("Error calculating VMAF jitter for %s: %s", r.CompressedFile, err)
+				}
+			}
+			if !a.flKeepVQMJSON && res.ResultFile != "" {
+				if err := os.Remove(res.ResultFile); err != nil {
+					logging.Infof("Unable to remove VQM result file: %s", err)
+				} else {
+					res.ResultFile = ""
+				}
+			}
 			vqmResults = append(vqmResults, namedVqmResult{Name: r.Name, Result: res})
+			writeRecord(resultRecord{RunResult: *r, VQMResult: &res})
 
-			logging.Infof("Done measuring VQMs for %s", r.CompressedFile)
+			p := a.flPrecision
+			logging.Infof("Done measuring VQMs for %s: VMAF %s, PSNR %s, MS-SSIM %s", r.CompressedFile,
+				formatFloat(res.Metrics.VMAF, p.VMAF), formatFloat(res.Metrics.PSNR, p.PSNR), formatFloat(res.Metrics.MS_SSIM, p.MS_SSIM))
+		}
+	}
+	remuxResults := remuxVqmResults(result.RunResults, vqmResults)
+	vqmResults = append(vqmResults, remuxResults...)
+	if a.flCalculateVQM {
+		// Remuxes share VQMs with their encodes, so stream them once all VQMs
+		// are done.
+		for i := range result.RunResults {
+			r := &result.RunResults[i]
+			if r.RemuxOf == "" {
+				continue
+			}
+			rec := resultRecord{RunResult: *r}
+			for j := range remuxResults {
+				if remuxResults[j].CompressedFile == r.CompressedFile {
+					rec.VQMResult = &remuxResults[j].Result
+				}
+			}
+			writeRecord(rec)
+		}
+	} else {
+		for i := range result.RunResults {
+			writeRecord(resultRecord{RunResult: result.RunResults[i]})
 		}
 	}
+	var hookFailures int
+	if plan.PostEncodeHook != nil && plan.PostEncodeHook.AfterVQM {
+		hookFailures = afterVQMHooks(ctx, &plan, result.RunResults, vqmResults)
+	}
 	if vqmFailed {
 		return &AppError{
 			msg:      "VQM calculations had errors, see log for reasons",
-			exitCode: 1,
+			exitCode: exitVQM,
 		}
 	}
 
+	if a.flTagVQM {
+		tagVqmResults(result.RunResults, vqmResults)
+	}
+
 	// Report encoding application results.
+	timer.begin(stageReport)
 	rep := report{
 		EncodingResult: result,
 		VQMResults:     vqmResults,
 	}
-	rep.WriteJSON(a.ReportWriter())
+	if prevReport != nil {
+		rep = mergeReports(prevReport, &rep)
+	}
+	// Artifacts of failed encodes are cleaned up even if they are excluded
+	// from report.
+	cleanupList := cleanupFiles(&rep, a.flCleanup)
+	if a.flExcludeFailed {
+		for _, f := range excludeFailed(&rep, a.flCalculateVQM) {
+			logging.Infof("Excluding failed encode %s from report", f)
+		}
+	}
+	reportOut := a.ReportWriter()
+	rep.WriteJSON(reportOut)
+
+	agg := newAggregateSummary(&rep)
+
+	if reportTpl != nil {
+		rows := newSummary(&rep)
+		scoreSummary(rows, a.flScoreWeights)
+		sortSummary(rows, a.flSortBy, a.flSortDesc)
+		data := htmlReportData{Run: m, Summary: agg, Rows: rows, Report: &rep}
+		if err := writeHTMLReport(reportTpl, data, a.flHTMLReport); err != nil {
+			logging.Infof("Error writing HTML report: %s", err)
+		}
+	}
+
+	if a.flMetricsFile != "" {
+		if err := writeMetricsFile(&rep, a.flMetricsFile); err != nil {
+			logging.Infof("Error writing metrics file: %s", err)
+		}
+	}
+
+	if a.flInfluxFile != "" {
+		if err := writeInfluxFile(&rep, a.flInfluxFile); err != nil {
+			logging.Infof("Error writing InfluxDB file: %s", err)
+		}
+	}
+
+	cleanup(cleanupList, a.flCleanupDryRun)
+
+	if a.flSummary {
+		write := textSummaryWriter(a.flPrecision)
+		if a.flSummaryDelimiter != 0 {
+			write = delimitedSummaryWriter(a.flSummaryDelimiter, a.flPrecision)
+		}
+		if a.flGroupBy == summaryGroupByInput {
+			inner := write
+			write = func(w io.Writer, rows []summaryRow) error {
+				return writeGroupedSummary(w, rows, inner)
+			}
+		}
+		rows := newSummary(&rep)
+		scoreSummary(rows, a.flScoreWeights)
+		sortSummary(rows, a.flSortBy, a.flSortDesc)
+		// Summary table is human readable text, structured result is the
+		// report. When report goes to stdout, table goes to stderr so that
+		// stdout stays valid JSON.
+		summaryOut := humanOutput()
+		if reportOut == os.Stdout {
+			summaryOut = os.Stderr
+		}
+		if err := write(summaryOut, rows); err != nil {
+			logging.Infof("Error writing summary: %s", err)
+		}
+	}
+
+	// Aggregate summary and history are written last, so that they include
+	// timing of the report stage.
+	timer.end()
+	agg.Stages = timer.timings
+	if err := writeAggregateSummary(agg, plan.OutDir); err != nil {
+		logging.Infof("Error writing aggregate summary: %s", err)
+	}
+
+	if a.flHistory != "" {
+		e := historyEntry{
+			Tag:              a.flRunTag,
+			Time:             rep.EncodingResult.EndTime,
+			Plan:             strings.Join(a.flPlans, ","),
+			aggregateSummary: agg,
+		}
+		if err := appendHistory(e, a.flHistory); err != nil {
+			logging.Infof("Error appending run history: %s", err)
+		}
+	}
+
+	if budgetExceeded {
+		return &AppError{
+			msg:      fmt.Sprintf("%s: %d of %d encodings done", err, len(result.RunResults), len(plan.Commands)),
+			exitCode: exitBudgetExceeded,
+		}
+	}
+
+	if hookFailures != 0 && plan.PostEncodeHook.FailRun {
+		return &AppError{
+			msg:      fmt.Sprintf("%d post-encode hook(s) failed, see log for reasons", hookFailures),
+			exitCode: 1,
+		}
+	}
+
+	// Quality gate: fail run if any of VQMs is below threshold.
+	if failures := a.flMinVQM.check(result.RunResults, vqmResults); len(failures) != 0 {
+		logging.Infof("Encodes below VQM thresholds:\n%s", strings.Join(failures, "\n"))
+		return &AppError{
+			msg:      fmt.Sprintf("%d encode(s) below VQM thresholds, see log for details", len(failures)),
+			exitCode: exitQualityGate,
+		}
+	}
+
+	// Speed gate: fail run if any encode is slower than required.
+	if a.flMinSpeed > 0 {
+		if slow := slowEncodes(result.RunResults, a.flMinSpeed); len(slow) != 0 {
+			logging.Infof("Encodes below minimum encoding speed:\n%s", strings.Join(slow, "\n"))
+			return &AppError{
+				msg:      fmt.Sprintf("%d encode(s) below minimum encoding speed, see log for details", len(slow)),
+				exitCode: exitQualityGate,
+			}
+		}
+	}
+
+	// Regression check: fail run if any VMAF deviates from golden value.
+	if golden != nil {
+		if diffs := golden.check(vqmResults, a.flGoldenTolerance); len(diffs) != 0 {
+			logging.Infof("Encodes deviating from golden VMAF:\n%s", strings.Join(diffs, "\n"))
+			return &AppError{
+				msg:      fmt.Sprintf("%d encode(s) deviate from golden VMAF, see log for details", len(diffs)),
+				exitCode: exitQualityGate,
+			}
+		}
+	}
 
 	return nil
 }
 
+// windowedMinVMAF will calculate worst VMAF average over sliding window of
+// frames from libvmaf result file.
+func windowedMinVMAF(resultFile string, window int, aliases vqm.FieldAliases) (float64, error) {
+	fm, err := loadFrameMetrics(resultFile, aliases)
+	if err != nil {
+		return 0, fmt.Errorf("windowedMinVMAF() %w", err)
+	}
+	return fm.WindowedMinVMAF(window), nil
+}
+
+// bootstrapSeed is a fixed seed of bootstrap resampling, so that confidence
+// intervals are reproducible across runs.
+const bootstrapSeed = 1
+
+// vmafMeanCI will estimate 95% confidence interval of VMAF mean by
+// bootstrapping per frame VMAF values from libvmaf result file.
+func vmafMeanCI(resultFile string, resamples int, aliases vqm.FieldAliases) (lo, hi float64, err error) {
+	fm, err := loadFrameMetrics(resultFile, aliases)
+	if err != nil {
+		return 0, 0, fmt.Errorf("vmafMeanCI() %w", err)
+	}
+	lo, hi = fm.VMAFMeanCI(resamples, rand.New(rand.NewSource(bootstrapSeed)))
+	return lo, hi, nil
+}
+
+// vmafJitter will calculate mean absolute difference between consecutive per
+// frame VMAF values from libvmaf result file.
+func vmafJitter(resultFile string, aliases vqm.FieldAliases) (float64, error) {
+	fm, err := loadFrameMetrics(resultFile, aliases)
+	if err != nil {
+		return 0, fmt.Errorf("vmafJitter() %w", err)
+	}
+	return fm.VMAFJitter(), nil
+}
+
+// loadFrameMetrics will load per frame metrics from libvmaf result file, nil
+// aliases means built-in libvmaf JSON keys only.
+func loadFrameMetrics(resultFile string, aliases vqm.FieldAliases) (vqm.FrameMetrics, error) {
+	var fm vqm.FrameMetrics
+	fd, err := os.Open(resultFile)
+	if err != nil {
+		return fm, fmt.Errorf("os.Open: %w", err)
+	}
+	defer fd.Close()
+
+	if err := fm.FromFfmpegVMAFWithAliases(fd, aliases); err != nil {
+		return fm, err
+	}
+	return fm, nil
+}
+
+// vqmRetryBackoff is delay before first retry of failed VQM measurement,
+// doubled for each next retry.
+var vqmRetryBackoff = time.Second
+
+// measureWithRetries will run VQM measurement retrying failed attempts up to
+// retries times, since libvmaf occasionally fails transiently (e.g. under
+// resource contention). Measurement is not retried once ctx is done.
+func measureWithRetries(ctx context.Context, m vqm.Measurer, retries int, name string) error {
+	backoff := vqmRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := m.MeasureContext(ctx)
+		if err == nil || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		logging.Infof("VQM measurement for %s failed (attempt %d of %d), retrying in %s: %s",
+			name, attempt+1, retries+1, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// resumeVQM will try to use existing VQM result file instead of measuring,
+// false means measurement is needed.
+func resumeVQM(m vqm.Measurer, resFile string) bool {
+	rs, ok := m.(vqm.Resumer)
+	if !ok {
+		return false
+	}
+	if err := rs.Resume(); err != nil {
+		logging.Debugf("Unable to reuse VQM result %s: %s", resFile, err)
+		return false
+	}
+	return true
+}
+
+// searchVMAFFunc returns VMAF measurement function for target VMAF search,
+// measurement setup is the same as for reported VQMs so that search target
+// matches reported VMAF. Result files of search steps are not kept.
+func (a *EncodeApp) searchVMAFFunc(ffmpegPath, libvmafModelPath string, plan encoding.Plan) encoding.VMAFFunc {
+	return func(ctx context.Context, r *encoding.RunResult) (float64, error) {
+		resFile := strings.TrimSuffix(r.CompressedFile, filepath.Ext(r.CompressedFile)) + "_vqm_search.json"
+		defer os.Remove(resFile)
+		inputArgs := strings.Fields(plan.InputArgsFor(r.SourceFile))
+		opts := []vqm.FfmpegVMAFOption{
+			vqm.WithSourceInputArgs(inputArgs),
+			vqm.WithFrameCountTolerance(a.flFrameCountTolerance),
+			vqm.WithGeometry(r.VMAFGeometry),
+			vqm.WithFeatures(r.VMAFFeatures),
+			vqm.WithUpscale(r.VMAFUpscale),
+			vqm.WithFrames(a.flVMAFFrames),
+			vqm.WithExcludedFrames(a.flExcludeLeading, a.flExcludeTrailing),
+			vqm.WithLumaThreshold(a.flExcludeLuma),
+			vqm.WithNice(a.flVQMNice),
+		}
+		libvmafOpts := plan.VMAFOptions
+		if a.flVMAFInterval > 0 {
+			if src, err := tools.FfprobeExtractMetadata(r.SourceFile, tools.WithInputArgs(inputArgs...)); err != nil {
+				logging.Infof("Unable to get metadata for %s: %s", r.SourceFile, err)
+			} else {
+				libvmafOpts = intervalLibvmafOptions(libvmafOpts, a.flVMAFInterval, src)
+			}
+		}
+		if libvmafOpts != nil {
+			opts = append(opts, vqm.WithLibvmafOptions(*libvmafOpts))
+		}
+		if a.flVMAFCUDA {
+			opts = append(opts, vqm.WithCUDA())
+		}
+		modelPath := plan.VMAFModelFor(r.SourceFile, libvmafModelPath)
+		vqmTool, err := vqm.NewFfmpegVMAF(ffmpegPath, modelPath, r.CompressedFile, r.SourceFile, resFile, opts...)
+		if err != nil {
+			return 0, err
+		}
+		if err := measureWithRetries(ctx, vqmTool, a.flVQMRetries, r.CompressedFile); err != nil {
+			return 0, err
+		}
+		res, err := vqmTool.GetResult()
+		if err != nil {
+			return 0, err
+		}
+		return res.Metrics.VMAF, nil
+	}
+}
+
+// intervalLibvmafOptions returns copy of libvmaf options with n_subsample
+// corresponding to given sampling interval (in seconds) at source's frame
+// rate, so that inputs of different frame rates are sampled with the same
+// temporal density. In case frame rate is unknown options are returned as is.
+func intervalLibvmafOptions(o *vqm.LibvmafOptions, interval float64, src video.Metadata) *vqm.LibvmafOptions {
+	fps, err := src.FrameRateFrom(video.FrameRateAuto)
+	if err != nil || fps <= 0 {
+		logging.Infof("Unable to get frame rate for -vmaf-interval, n_subsample unchanged: %v", err)
+		return o
+	}
+	var res vqm.LibvmafOptions
+	if o != nil {
+		res = *o
+		if res.NSubsample != 0 {
+			logging.Debugf("VMAFOptions NSubsample %d overridden by -vmaf-interval", res.NSubsample)
+		}
+	}
+	res.NSubsample = subsampleFor(interval, fps)
+	logging.Debugf("VQM sampling interval %gs at %.3f fps: n_subsample=%d", interval, fps, res.NSubsample)
+	return &res
+}
+
+// subsampleFor returns libvmaf n_subsample value closest to given sampling
+// interval (in seconds) at given frame rate, at least every frame.
+func subsampleFor(interval, fps float64) int {
+	n := int(math.Round(interval * fps))
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// measureReverseVMAF will measure VMAF with source and compressed files
+// swapped e.g. compressed file used as a reference.
+func measureReverseVMAF(ctx context.Context, ffmpegPath, modelPath string, r *encoding.RunResult, opts ...vqm.FfmpegVMAFOption) (float64, error) {
+	resFile := strings.TrimSuffix(r.CompressedFile, filepath.Ext(r.CompressedFile)) + "_vqm_reverse.json"
+	opts = append([]vqm.FfmpegVMAFOption{vqm.WithGeometry(r.VMAFGeometry), vqm.WithFeatures(r.VMAFFeatures)}, opts...)
+	vqmTool, err := vqm.NewFfmpegVMAF(ffmpegPath, modelPath, r.SourceFile, r.CompressedFile, resFile, opts...)
+	if err != nil {
+		return 0, err
+	}
+	if err := vqmTool.MeasureContext(ctx); err != nil {
+		return 0, err
+	}
+	res, err := vqmTool.GetResult()
+	if err != nil {
+		return 0, err
+	}
+	return res.Metrics.VMAF, nil
+}
+
+// runMetadata returns source and compressed video metadata of encoding run,
+// already known metadata is reused and only missing one is probed. Source
+// metadata is cached in sources, srcOpts are used for probing source.
+func runMetadata(r *encoding.RunResult, sources map[string]video.Metadata, srcOpts ...tools.ProbeOption) (src, comp video.Metadata, err error) {
+	src, ok := sources[r.SourceFile]
+	if !ok {
+		if src, err = tools.FfprobeExtractMetadata(r.SourceFile, srcOpts...); err != nil {
+			return src, comp, err
+		}
+		sources[r.SourceFile] = src
+	}
+	if r.Metadata != nil {
+		return src, *r.Metadata, nil
+	}
+	comp, err = tools.FfprobeExtractMetadata(r.CompressedFile)
+	return src, comp, err
+}
+
+// rotationOptions will compare rotation metadata of source and compressed
+// videos and return VQM options needed to compare them in matching
+// orientation.
+//
+// Orientation problems that can not be resolved automatically are logged.
+func rotationOptions(r *encoding.RunResult, src, comp video.Metadata) []vqm.FfmpegVMAFOption {
+	noAutorotate, ok := resolveRotation(src, comp)
+	if !ok {
+		logging.Infof("Rotation of %s (%d°) and %s (%d°) differ, VQMs might be misaligned (check VMAFGeometry)",
+			r.SourceFile, src.Rotation, r.CompressedFile, comp.Rotation)
+	}
+	if noAutorotate {
+		logging.Infof("Rotation metadata of %s ignored by encoder, comparing stored frames", r.SourceFile)
+		return []vqm.FfmpegVMAFOption{vqm.WithNoAutorotate()}
+	}
+	return nil
+}
+
+// colorAdvice returns advice on how to get valid VQMs for source and
+// compressed videos of different color characteristics. Default VMAF models
+// are trained on SDR content, so comparing HDR source to SDR (e.g. tonemapped)
+// encode gives meaningless scores.
+func colorAdvice(src, comp video.Color) string {
+	switch {
+	case src.IsHDR() && !comp.IsHDR():
+		return "VMAF of HDR source against SDR encode is invalid, compare against tonemapped source"
+	case src.IsHDR() || comp.IsHDR():
+		return "VMAF of HDR content needs HDR VMAF model (see VMAFModels) and matching color characteristics"
+	}
+	return "VQMs might be invalid, check encoder color options"
+}
+
+// resolveRotation decides how to compare source and compressed videos with
+// different rotation metadata.
+//
+// ffmpeg rotates inputs according to their rotation metadata, which is right
+// when encoder applied source's rotation (compressed display orientation
+// matches source's). In case encoder ignored source's rotation (compressed
+// display orientation matches source's stored orientation) noAutorotate is
+// true. Returned ok is false when orientation can not be resolved (e.g. 180°
+// rotation which does not change dimensions).
+func resolveRotation(src, comp video.Metadata) (noAutorotate, ok bool) {
+	if src.Rotation == comp.Rotation {
+		return false, true
+	}
+	if (src.Rotation-comp.Rotation)%180 == 0 {
+		return false, false
+	}
+	portrait := func(w, h int) bool { return h > w }
+	cw, ch := comp.DisplaySize()
+	sw, sh := src.DisplaySize()
+	switch portrait(cw, ch) {
+	case portrait(sw, sh):
+		return false, true
+	case portrait(src.Width, src.Height):
+		return true, true
+	}
+	return false, false
+}
+
+// tagVqmResults will write VQM scores into compressed files' metadata, tagged
+// run results are marked accordingly.
+//
+// Tagging failures (e.g. container not supporting metadata) are logged and
+// otherwise ignored.
+func tagVqmResults(runResults []encoding.RunResult, vqmResults []namedVqmResult) {
+	byFile := make(map[string]*encoding.RunResult, len(runResults))
+	for i := range runResults {
+		byFile[runResults[i].CompressedFile] = &runResults[i]
+	}
+	for i := range vqmResults {
+		v := &vqmResults[i]
+		tag := fmt.Sprintf("VMAF=%.2f PSNR=%.2f MS-SSIM=%.4f", v.Metrics.VMAF, v.Metrics.PSNR, v.Metrics.MS_SSIM)
+		if err := tools.FfmpegSetMetadata(v.CompressedFile, "comment", tag); err != nil {
+			logging.Infof("Unable to tag %s with VQMs: %s", v.CompressedFile, err)
+			continue
+		}
+		if r, ok := byFile[v.CompressedFile]; ok {
+			r.VQMTagged = true
+		}
+	}
+}
+
+// frameTimingDiff will compare source and compressed file frame timestamps.
+func frameTimingDiff(sourceFile, compressedFile string) (analysis.FrameTimingDiff, error) {
+	var diff analysis.FrameTimingDiff
+	srcFrames, err := analysis.GetFrameStats(sourceFile)
+	if err != nil {
+		return diff, fmt.Errorf("frameTimingDiff() source %s: %w", sourceFile, err)
+	}
+	compressedFrames, err := analysis.GetFrameStats(compressedFile)
+	if err != nil {
+		return diff, fmt.Errorf("frameTimingDiff() compressed %s: %w", compressedFile, err)
+	}
+	return analysis.CompareFrameTiming(srcFrames, compressedFrames), nil
+}
+
+// vqmThresholds holds minimal acceptable values for VQMs, zero value disables
+// check for particular metric.
+type vqmThresholds struct {
+	VMAF    float64
+	PSNR    float64
+	MS_SSIM float64
+}
+
+// enabled reports whether any of thresholds is set.
+func (t vqmThresholds) enabled() bool {
+	return t.VMAF > 0 || t.PSNR > 0 || t.MS_SSIM > 0
+}
+
+// check will return a description for each VQM result that falls below
+// thresholds. Encodes without VQM result (e.g. failed encoding or VQM
+// measurement) can not pass thresholds and are reported as failures too.
+func (t vqmThresholds) check(runs []encoding.RunResult, results []namedVqmResult) (failures []string) {
+	if !t.enabled() {
+		return nil
+	}
+	measured := make(map[string]struct{}, len(results))
+	for i := range results {
+		measured[results[i].CompressedFile] = struct{}{}
+	}
+	for i := range runs {
+		if _, ok := measured[runs[i].CompressedFile]; !ok {
+			failures = append(failures, fmt.Sprintf("%s: no VQM result", runs[i].CompressedFile))
+		}
+	}
+	for i := range results {
+		r := &results[i]
+		var reasons []string
+		for _, c := range []struct {
+			metric, label    string
+			value, threshold float64
+		}{
+			{"VMAF", "VMAF", r.Metrics.VMAF, t.VMAF},
+			{"PSNR", "PSNR", r.Metrics.PSNR, t.PSNR},
+			{"MS_SSIM", "MS-SSIM", r.Metrics.MS_SSIM, t.MS_SSIM},
+		} {
+			switch {
+			case c.threshold <= 0:
+			case r.Metrics.IsAbsent(c.metric):
+				reasons = append(reasons, fmt.Sprintf("%s not measured", c.label))
+			case c.value < c.threshold:
+				reasons = append(reasons, fmt.Sprintf("%s %.3f < %.3f", c.label, c.value, c.threshold))
+			}
+		}
+		if len(reasons) != 0 {
+			failures = append(failures, fmt.Sprintf("%s: %s", r.CompressedFile, strings.Join(reasons, ", ")))
+		}
+	}
+	return failures
+}
+
+// slowEncodes will return a description for each encoding run with average
+// encoding speed below min. Failed and reused runs have no meaningful speed and
+// are skipped.
+func slowEncodes(results []encoding.RunResult, min float64) (slow []string) {
+	for i := range results {
+		r := &results[i]
+		if len(r.Errors) != 0 || r.Reused {
+			continue
+		}
+		if r.AvgEncodingSpeed < min {
+			slow = append(slow, fmt.Sprintf("%s: speed %.2fx < %.2fx", r.CompressedFile, r.AvgEncodingSpeed, min))
+		}
+	}
+	return slow
+}
+
+// afterVQMHooks will run plan's post-encode hook for each encoding run with
+// VQMs (if measured) passed along with run result, number of failed hooks is
+// returned. Remuxes share VQMs with their encodes and are skipped.
+func afterVQMHooks(ctx context.Context, plan *encoding.Plan, results []encoding.RunResult, vqmResults []namedVqmResult) (failed int) {
+	byFile := make(map[string]vqm.Result, len(vqmResults))
+	for _, v := range vqmResults {
+		byFile[v.CompressedFile] = v.Result
+	}
+	for i := range results {
+		r := &results[i]
+		if r.RemuxOf != "" {
+			continue
+		}
+		env := encoding.HookEnv(r)
+		if v, ok := byFile[r.CompressedFile]; ok {
+			f := func(v float64) string {
+				return strconv.FormatFloat(v, 'f', -1, 64)
+			}
+			env = append(env,
+				"EASE_VMAF="+f(v.Metrics.VMAF),
+				"EASE_PSNR="+f(v.Metrics.PSNR),
+				"EASE_MS_SSIM="+f(v.Metrics.MS_SSIM),
+				"EASE_VQM_RESULT_FILE="+v.ResultFile)
+		}
+		if err := plan.RunHook(ctx, env); err != nil {
+			logging.Infof("Hook failed for %s: %s", r.CompressedFile, err)
+			failed++
+		}
+	}
+	return failed
+}
+
+// remuxVqmResults will create VQM results for remuxed files by reusing VQM
+// results of files they were remuxed from.
+func remuxVqmResults(runResults []encoding.RunResult, vqmResults []namedVqmResult) (res []namedVqmResult) {
+	byFile := make(map[string]namedVqmResult, len(vqmResults))
+	for _, v := range vqmResults {
+		byFile[v.CompressedFile] = v
+	}
+	for i := range runResults {
+		r := &runResults[i]
+		if r.RemuxOf == "" {
+			continue
+		}
+		v, ok := byFile[r.RemuxOf]
+		if !ok {
+			continue
+		}
+		v.Name = r.Name
+		v.CompressedFile = r.CompressedFile
+		res = append(res, v)
+	}
+	return res
+}
+
+// inputInfo is probed metadata of plan's input.
+type inputInfo struct {
+	Input    string
+	Metadata *video.Metadata `json:",omitempty"`
+	// Error is probe failure
+	Error string `json:",omitempty"`
+}
+
+// probeInputs will probe inputs for metadata, probe failures are recorded in
+// results rather than abort probing.
+func probeInputs(inputs []string, opts ...tools.ProbeOption) []inputInfo {
+	infos := make([]inputInfo, 0, len(inputs))
+	for _, i := range inputs {
+		vmeta, err := tools.FfprobeExtractMetadata(i, opts...)
+		if err != nil {
+			infos = append(infos, inputInfo{Input: i, Error: err.Error()})
+			continue
+		}
+		infos = append(infos, inputInfo{Input: i, Metadata: &vmeta})
+	}
+	return infos
+}
+
+// writeInputsList will write a table of inputs along with their probed metadata.
+func writeInputsList(w io.Writer, inputs []string, opts ...tools.ProbeOption) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INPUT\tCODEC\tRESOLUTION\tFRAME RATE\tDURATION (s)\tFRAMES\tERROR")
+	for _, i := range probeInputs(inputs, opts...) {
+		if i.Metadata == nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\t%s\n", i.Input, i.Error)
+			continue
+		}
+		vmeta := i.Metadata
+		fmt.Fprintf(tw, "%s\t%s\t%dx%d\t%s\t%.3f\t%d\t-\n",
+			i.Input, vmeta.CodecName, vmeta.Width, vmeta.Height, vmeta.FrameRate, vmeta.Duration, vmeta.FrameCount)
+	}
+	return tw.Flush()
+}
+
+// defaultMaxCommands is default limit of encoder commands plan can expand to
+// without explicit confirmation.
+const defaultMaxCommands = 1000
+
+// checkCommandLimit will return error if plan expands to more than max encoder
+// commands, unless confirmed. Zero max disables the check.
+func checkCommandLimit(plan encoding.Plan, max int, confirmed bool) error {
+	n := len(plan.Commands)
+	if max == 0 || n <= max {
+		return nil
+	}
+	scope := fmt.Sprintf("%d encoder commands (%d inputs x %d schemes)", n, len(plan.Inputs), len(plan.Schemes))
+	if !confirmed {
+		return fmt.Errorf("plan expands to %s which exceeds -max-commands %d, check input globs or confirm with -yes", scope, max)
+	}
+	logging.Infof("Plan expands to %s, above -max-commands %d (confirmed)", scope, max)
+	return nil
+}
+
+// checkFreeSpace will check that plan's output directory filesystem has
+// enough free space for the run. Required space is the larger of total size of
+// inputs of all encoder commands multiplied by factor and minMB megabytes, zero
+// values disable respective estimate.
+func checkFreeSpace(plan encoding.Plan, factor float64, minMB int) error {
+	if factor == 0 && minMB == 0 {
+		return nil
+	}
+	required := uint64(minMB) << 20
+	if factor > 0 {
+		var inputs int64
+		for i := range plan.Commands {
+			c := &plan.Commands[i]
+			// Remux output is a copy of encoded stream, not an encode of input.
+			if c.RemuxOf != "" {
+				continue
+			}
+			// Size of URL input is not known without fetching it.
+			if tools.IsURL(c.SourceFile) {
+				logging.Debugf("Skipping size of URL input %s in free space estimate", c.SourceFile)
+				continue
+			}
+			fi, err := os.Stat(c.SourceFile)
+			if err != nil {
+				return fmt.Errorf("checkFreeSpace() %w", err)
+			}
+			inputs += fi.Size()
+		}
+		if est := uint64(float64(inputs) * factor); est > required {
+			required = est
+		}
+	}
+	free, err := freeSpace(plan.OutDir)
+	if err != nil {
+		return fmt.Errorf("checkFreeSpace() %w", err)
+	}
+	logging.Debugf("Free space on %s filesystem %d MB, required %d MB", plan.OutDir, free>>20, required>>20)
+	if free < required {
+		return fmt.Errorf("not enough free space for output directory %s: %d MB available, %d MB required",
+			plan.OutDir, free>>20, required>>20)
+	}
+	return nil
+}
+
+// freeSpace returns space (in bytes) available to unprivileged user on
+// filesystem of dir, in case dir does not exist yet it's closest existing
+// parent is used.
+func freeSpace(dir string) (uint64, error) {
+	dir = filepath.Clean(dir)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", dir, err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// writeCommandsList writes table of expanded encoder commands along with
+// files they produce.
+func writeCommandsList(w io.Writer, cmds []encoding.EncoderCmd) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCOMPRESSED FILE\tOUTPUT FILE\tCOMMAND")
+	for i := range cmds {
+		c := &cmds[i]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Name, c.CompressedFile, c.OutputFile, c.Cmd)
+	}
+	return tw.Flush()
+}
+
+// writeCommandsCSV will write CSV of encoder commands with a row per command:
+// scheme name, input, compressed file and command line.
+func writeCommandsCSV(w io.Writer, cmds []encoding.EncoderCmd) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"name", "input", "output", "command"}); err != nil {
+		return err
+	}
+	for i := range cmds {
+		c := &cmds[i]
+		if err := cw.Write([]string{c.Name, c.SourceFile, c.CompressedFile, c.Cmd}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeCommandsCSVFile will write CSV of encoder commands into file.
+func writeCommandsCSVFile(cmds []encoding.EncoderCmd, name string) error {
+	fd, err := perm.Create(name)
+	if err != nil {
+		return fmt.Errorf("writeCommandsCSVFile() perm.Create: %w", err)
+	}
+	defer fd.Close()
+
+	if err := writeCommandsCSV(fd, cmds); err != nil {
+		return fmt.Errorf("writeCommandsCSVFile() %w", err)
+	}
+	return fd.Close()
+}
+
 // unrollResultErrors helper to unroll all errors from RunResults into a string.
 func unrollResultErrors(results []encoding.RunResult) string {
 	sb := strings.Builder{}
@@ -211,31 +1650,79 @@ func unrollResultErrors(results []encoding.RunResult) string {
 			for _, e := range rr.Errors {
 				sb.WriteString(fmt.Sprintf("%s:\n\t%s\n", rr.Name, e.Error()))
 			}
+			for _, l := range rr.OutputTail {
+				sb.WriteString(fmt.Sprintf("\t| %s\n", l))
+			}
 		}
 	}
 	return sb.String()
 }
 
-// createPlanFromJSONConfig creates a Plan instance from JSON configuration.
-func createPlanFromJSONConfig(cfgFile string) (encoding.Plan, error) {
-	var plan encoding.Plan
+// loadPlanConfig reads PlanConfig from JSON (or CSV in case of .csv
+// extension) configuration file, PlanConfig is not validated.
+func loadPlanConfig(cfgFile string) (encoding.PlanConfig, error) {
+	var pc encoding.PlanConfig
 	fd, err := os.Open(cfgFile)
 	if err != nil {
-		return plan, fmt.Errorf("cannot open conf file: %w", err)
+		return pc, fmt.Errorf("cannot open conf file: %w", err)
 	}
 	defer fd.Close()
 
 	jdoc, err := io.ReadAll(fd)
 	if err != nil {
-		return plan, fmt.Errorf("cannot read data from conf file: %w", err)
+		return pc, fmt.Errorf("cannot read data from conf file: %w", err)
 	}
 
-	pc, err := encoding.NewPlanConfigFromJSON(jdoc)
+	if strings.EqualFold(filepath.Ext(cfgFile), ".csv") {
+		pc, err = encoding.NewPlanConfigFromCSV(jdoc)
+	} else {
+		pc, err = encoding.NewPlanConfigFromJSON(jdoc)
+	}
+	if err != nil {
+		return pc, fmt.Errorf("cannot create PlanConfig: %w", err)
+	}
+	pc.OutDir = expandDirTemplate(pc.OutDir, time.Now())
+	// Relative paths in plan are relative to plan file location, this makes
+	// plans portable regardless of where ease is invoked from. Resolved paths
+	// are absolute, so that effective plan (e.g. Plan section of manifest)
+	// can be loaded back from any location.
+	baseDir, err := filepath.Abs(filepath.Dir(cfgFile))
 	if err != nil {
-		return plan, fmt.Errorf("cannot create PlanConfig: %w", err)
+		return pc, fmt.Errorf("cannot resolve conf file directory: %w", err)
 	}
+	pc.ResolvePaths(baseDir)
 
-	if ok, err := pc.IsValid(); !ok {
+	return pc, nil
+}
+
+// createPlanFromJSONConfig creates a Plan instance from JSON configuration,
+// multiple configuration files are merged into one plan before validation.
+func createPlanFromJSONConfig(cfgFiles ...string) (encoding.Plan, error) {
+	var plan encoding.Plan
+	pcs := make([]encoding.PlanConfig, 0, len(cfgFiles))
+	for _, f := range cfgFiles {
+		pc, err := loadPlanConfig(f)
+		if err != nil {
+			return plan, err
+		}
+		pcs = append(pcs, pc)
+	}
+	if len(pcs) == 0 {
+		return plan, errors.New("no encoding plan given")
+	}
+	pc := pcs[0]
+	if len(pcs) > 1 {
+		var err error
+		if pc, err = encoding.MergePlanConfigs(pcs...); err != nil {
+			return plan, fmt.Errorf("cannot merge plans: %w", err)
+		}
+	}
+
+	warnings, err := pc.Validate()
+	for _, w := range warnings {
+		logging.Infof("PlanConfig warning: %s", w)
+	}
+	if err != nil {
 		ev := &encoding.PlanConfigError{}
 		if errors.As(err, &ev) {
 			logging.Debugf(
@@ -247,3 +1734,45 @@ func createPlanFromJSONConfig(cfgFile string) (encoding.Plan, error) {
 
 	return encoding.NewPlan(pc), nil
 }
+
+// checkDurations will derive compressed videos' durations from frame
+// timestamps and flag RunResults where it differs from container reported
+// duration by more than tolerance seconds.
+func checkDurations(runResults []encoding.RunResult, tolerance float64) {
+	for i := range runResults {
+		r := &runResults[i]
+		if len(r.Errors) != 0 {
+			continue
+		}
+		fs, err := analysis.GetFrameStats(r.CompressedFile)
+		if err != nil {
+			logging.Infof("Duration check failed for %s: %s", r.CompressedFile, err)
+			continue
+		}
+		r.FrameDuration = analysis.FramesDuration(fs)
+		if math.Abs(r.FrameDuration-r.VideoDuration) > tolerance {
+			r.DurationMismatch = true
+			logging.Infof("Duration mismatch for %s: container %.3fs, frames %.3fs (possible muxing issue)",
+				r.CompressedFile, r.VideoDuration, r.FrameDuration)
+		}
+	}
+}
+
+// detectSceneCuts will detect scene cuts in sources of runResults and store
+// them in RunResults, each source is analysed only once.
+func detectSceneCuts(runResults []encoding.RunResult, threshold float64) {
+	cache := make(map[string][]float64)
+	for i := range runResults {
+		r := &runResults[i]
+		cuts, ok := cache[r.SourceFile]
+		if !ok {
+			var err error
+			if cuts, err = tools.FfmpegSceneCuts(r.SourceFile, threshold); err != nil {
+				logging.Infof("Unable to detect scene cuts in %s: %s", r.SourceFile, err)
+			}
+			logging.Debugf("Detected %d scene cuts in %s", len(cuts), r.SourceFile)
+			cache[r.SourceFile] = cuts
+		}
+		r.SceneCuts = cuts
+	}
+}
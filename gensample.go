@@ -0,0 +1,115 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// ease tool's gen-sample subcommand implementation.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/perm"
+	"github.com/evolution-gaming/ease/internal/tools"
+)
+
+// CreateGenSampleCommand will create Commander instance from GenSampleApp.
+func CreateGenSampleCommand() Commander {
+	longHelp := `Subcommand "gen-sample" will generate synthetic sample video (mezzanine) via
+ffmpeg's testsrc, testsrc2 or mandelbrot sources, so that encoding pipeline can
+be tried out without any media at hand. Sample is encoded losslessly (H.264).
+
+Examples:
+
+  ease gen-sample -o sample.mp4
+  ease gen-sample -source mandelbrot -size 1280x720 -frame-rate 30 -duration 20 -o mandelbrot.mp4`
+
+	app := &GenSampleApp{
+		fs: flag.NewFlagSet("gen-sample", flag.ContinueOnError),
+	}
+	app.fs.StringVar(&app.flOutFile, "o", "", "Output video file (mandatory)")
+	app.fs.StringVar(&app.flSource, "source", tools.SampleSourceTestsrc2, "Synthetic video source: testsrc, testsrc2, mandelbrot")
+	app.fs.StringVar(&app.flSize, "size", "1920x1080", "Frame size as WIDTHxHEIGHT")
+	app.fs.StringVar(&app.flFrameRate, "frame-rate", "25", "Frame rate, integer or rational (e.g. 30000/1001)")
+	app.fs.Float64Var(&app.flDuration, "duration", 10, "Duration in seconds")
+
+	app.fs.Usage = func() {
+		printSubCommandUsage(longHelp, app.fs)
+	}
+
+	return app
+}
+
+// Make sure GenSampleApp implements Commander interface.
+var _ Commander = (*GenSampleApp)(nil)
+
+// GenSampleApp is gen-sample subcommand context that implements Commander
+// interface.
+type GenSampleApp struct {
+	// FlagSet instance
+	fs *flag.FlagSet
+	// Output video file
+	flOutFile string
+	// Synthetic video source
+	flSource string
+	// Frame size
+	flSize string
+	// Frame rate
+	flFrameRate string
+	// Duration in seconds
+	flDuration float64
+}
+
+func (a *GenSampleApp) Name() string {
+	return a.fs.Name()
+}
+
+func (a *GenSampleApp) Help() {
+	a.fs.Usage()
+}
+
+// Run is entry point to GenSampleApp command execution.
+func (a *GenSampleApp) Run(args []string) error {
+	if err := a.fs.Parse(args); err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      "usage error",
+		}
+	}
+
+	if a.flOutFile == "" {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "mandatory option -o is missing",
+		}
+	}
+
+	if !tools.IsSampleSource(a.flSource) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("unsupported -source value: %s", a.flSource),
+		}
+	}
+
+	if err := perm.MkdirAll(filepath.Dir(a.flOutFile)); err != nil {
+		return &AppError{exitCode: 1, msg: err.Error()}
+	}
+
+	spec := tools.SampleSpec{
+		Source:    a.flSource,
+		Size:      a.flSize,
+		FrameRate: a.flFrameRate,
+		Duration:  a.flDuration,
+	}
+	if err := tools.FfmpegGenerateSample(a.flOutFile, spec); err != nil {
+		return &AppError{exitCode: 1, msg: err.Error()}
+	}
+	logging.Infof("Sample video written: %s", a.flOutFile)
+
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Global flags shared by subcommands.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+)
+
+// porcelain is set by global -porcelain (or -json) flag. In porcelain mode
+// subcommands write only structured (JSON) results to stdout, human readable
+// text (tables, reports) goes to stderr and INFO logging is off, so that ease
+// output is easy to consume in scripts.
+var porcelain bool
+
+// registerPorcelainFlag will register -porcelain flag and its -json alias in
+// fs.
+func registerPorcelainFlag(fs *flag.FlagSet) {
+	usage := "Machine-parseable mode: only structured (JSON) results on stdout, human readable text and logs on stderr"
+	fs.BoolVar(&porcelain, "porcelain", false, usage)
+	fs.BoolVar(&porcelain, "json", false, `Alias for -porcelain`)
+}
+
+// humanOutput returns writer for human readable output of subcommands, that is
+// stdout unless in porcelain mode.
+func humanOutput() io.Writer {
+	if porcelain {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// writePorcelain will write v to w as JSON document.
+func writePorcelain(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
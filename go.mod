@@ -3,8 +3,10 @@ module github.com/evolution-gaming/ease
 go 1.18
 
 require (
+	github.com/go-fonts/liberation v0.2.0
 	github.com/google/go-cmp v0.5.8
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
+	golang.org/x/image v0.0.0-20220601225756-64ec528b34cd
 	gonum.org/v1/gonum v0.11.0
 	gonum.org/v1/plot v0.11.0
 )
@@ -12,10 +14,8 @@ require (
 require (
 	git.sr.ht/~sbinet/gg v0.3.1 // indirect
 	github.com/ajstarks/svgo v0.0.0-20211024235047-1546f124cd8b // indirect
-	github.com/go-fonts/liberation v0.2.0 // indirect
 	github.com/go-latex/latex v0.0.0-20210823091927-c0d11ff05a81 // indirect
 	github.com/go-pdf/fpdf v0.6.0 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	golang.org/x/image v0.0.0-20220601225756-64ec528b34cd // indirect
 	golang.org/x/text v0.3.7 // indirect
 )
@@ -0,0 +1,56 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Comparison of VQM results to golden (previously recorded) VMAF values.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+)
+
+// goldenVMAF maps compressed file name (without directory) to expected VMAF.
+type goldenVMAF map[string]float64
+
+// loadGoldenVMAF will read golden VMAF values from report file of a previous
+// (reference) run.
+//
+// Compressed file names are used as keys, so that reports from runs with
+// different output directories can be compared.
+func loadGoldenVMAF(fPath string) (goldenVMAF, error) {
+	r, err := loadReportFile(fPath)
+	if err != nil {
+		return nil, fmt.Errorf("loadGoldenVMAF() %w", err)
+	}
+	g := make(goldenVMAF, len(r.VQMResults))
+	for i := range r.VQMResults {
+		v := &r.VQMResults[i]
+		g[path.Base(v.CompressedFile)] = v.Metrics.VMAF
+	}
+	return g, nil
+}
+
+// check will return a description for each VQM result which VMAF deviates
+// from golden value by more than tolerance.
+//
+// Results without golden value are logged and otherwise ignored.
+func (g goldenVMAF) check(results []namedVqmResult, tolerance float64) (diffs []string) {
+	for i := range results {
+		r := &results[i]
+		want, ok := g[path.Base(r.CompressedFile)]
+		if !ok {
+			logging.Infof("No golden VMAF for %s", r.CompressedFile)
+			continue
+		}
+		got := r.Metrics.VMAF
+		if math.Abs(got-want) > tolerance {
+			diffs = append(diffs, fmt.Sprintf("%s: VMAF %.3f, golden %.3f (diff %+.3f)", r.CompressedFile, got, want, got-want))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,68 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tests for comparison of VQM results to golden VMAF values.
+package main
+
+import (
+	"testing"
+
+	"github.com/evolution-gaming/ease/internal/vqm"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_loadGoldenVMAF(t *testing.T) {
+	got, err := loadGoldenVMAF("testdata/encoding_artifacts/report.json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := parseReportFile("testdata/encoding_artifacts/report.json")
+	if diff := cmp.Diff(len(r.VQMResults), len(got)); diff != "" {
+		t.Errorf("Golden values count mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("Should fail for non-existent file", func(t *testing.T) {
+		if _, err := loadGoldenVMAF("testdata/non-existent.json"); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_goldenVMAF_check(t *testing.T) {
+	golden := goldenVMAF{"clip_sc1.mp4": 95, "clip_sc2.mp4": 90}
+	given := []namedVqmResult{
+		{Result: vqm.Result{CompressedFile: "out/clip_sc1.mp4", Metrics: vqm.VideoQualityMetrics{VMAF: 94.6}}},
+		{Result: vqm.Result{CompressedFile: "out/clip_sc2.mp4", Metrics: vqm.VideoQualityMetrics{VMAF: 88}}},
+		{Result: vqm.Result{CompressedFile: "out/clip_sc3.mp4", Metrics: vqm.VideoQualityMetrics{VMAF: 10}}},
+	}
+	tests := map[string]struct {
+		tolerance float64
+		want      []string
+	}{
+		"Within tolerance": {
+			tolerance: 2,
+			want:      nil,
+		},
+		"Beyond tolerance": {
+			tolerance: 0.5,
+			want:      []string{"out/clip_sc2.mp4: VMAF 88.000, golden 90.000 (diff -2.000)"},
+		},
+		"Zero tolerance": {
+			tolerance: 0,
+			want: []string{
+				"out/clip_sc1.mp4: VMAF 94.600, golden 95.000 (diff -0.400)",
+				"out/clip_sc2.mp4: VMAF 88.000, golden 90.000 (diff -2.000)",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := golden.check(given, tc.tolerance)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Golden check mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 )
 
@@ -21,10 +22,15 @@ import (
 // simple file copy.
 func fixPlanConfig(t *testing.T) (fPath, outDir string) {
 	outDir = t.TempDir()
+	// Relative inputs are resolved relative to plan file, so use absolute path.
+	input, err := filepath.Abs("testdata/video/testsrc01.mp4")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 	payload := []byte(fmt.Sprintf(`{
 		"OutDir": "%s",
 		"Inputs": [
-			"testdata/video/testsrc01.mp4"
+			"%s"
 		],
 		"Schemes": [
 			{
@@ -32,9 +38,9 @@ func fixPlanConfig(t *testing.T) (fPath, outDir string) {
 				"CommandTpl": ["cp -v ",  "%%INPUT%% ", "%%OUTPUT%%.mp4"]
 			}
 		]
-	}`, outDir))
+	}`, outDir, input))
 	fPath = path.Join(outDir, "minimal.json")
-	err := os.WriteFile(fPath, payload, fs.FileMode(0o644))
+	err = os.WriteFile(fPath, payload, fs.FileMode(0o644))
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
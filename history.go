@@ -0,0 +1,161 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// ease tool's history subcommand implementation and run history file
+// related functionality.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+)
+
+// historyEntry is a single encoding run recorded in history file.
+type historyEntry struct {
+	// Tag is a user given run tag (e.g. git SHA)
+	Tag string
+	// Time is a time run has ended
+	Time time.Time
+	// Plan is encoding plan configuration file
+	Plan string
+	aggregateSummary
+}
+
+// appendHistory will append entry as a single line JSON document to history
+// file, file is created if it does not exist.
+func appendHistory(e historyEntry, name string) error {
+	f, err := perm.Append(name)
+	if err != nil {
+		return fmt.Errorf("appendHistory() perm.Append: %w", err)
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(e); err != nil {
+		return fmt.Errorf("appendHistory() json.Encode: %w", err)
+	}
+	return f.Close()
+}
+
+// readHistory will read history entries from JSON Lines formatted r, empty
+// lines are ignored.
+func readHistory(r io.Reader) ([]historyEntry, error) {
+	var entries []historyEntry
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var e historyEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("history line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	return entries, nil
+}
+
+// writeHistoryTable will write history entries to w as aligned table.
+func writeHistoryTable(w io.Writer, entries []historyEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tTAG\tPLAN\tENCODES\tAVG VMAF\tTOTAL SIZE\tENCODE TIME")
+	for i := range entries {
+		e := &entries[i]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.2f\t%d\t%s\n",
+			e.Time.Format(time.RFC3339), e.Tag, e.Plan, e.Encodes, e.AvgVMAF, e.TotalSize,
+			e.TotalEncodeTime.Round(time.Millisecond))
+	}
+	tw.Flush()
+}
+
+// CreateHistoryCommand will create Commander instance from HistoryApp.
+func CreateHistoryCommand() Commander {
+	longHelp := `Subcommand "history" will print run history file written by encode
+subcommand's -history option as a table, one row per run in order runs were
+recorded.
+
+Examples:
+
+  ease history -i history.jsonl`
+
+	app := &HistoryApp{
+		fs: flag.NewFlagSet("history", flag.ContinueOnError),
+	}
+	app.fs.StringVar(&app.flInFile, "i", "", "Run history file (mandatory)")
+
+	app.fs.Usage = func() {
+		printSubCommandUsage(longHelp, app.fs)
+	}
+
+	return app
+}
+
+// Make sure HistoryApp implements Commander interface.
+var _ Commander = (*HistoryApp)(nil)
+
+// HistoryApp is history subcommand context that implements Commander
+// interface.
+type HistoryApp struct {
+	// FlagSet instance
+	fs *flag.FlagSet
+	// Run history file
+	flInFile string
+}
+
+func (a *HistoryApp) Name() string {
+	return a.fs.Name()
+}
+
+func (a *HistoryApp) Help() {
+	a.fs.Usage()
+}
+
+// Run is entry point to HistoryApp command execution.
+func (a *HistoryApp) Run(args []string) error {
+	if err := a.fs.Parse(args); err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      "usage error",
+		}
+	}
+
+	if a.flInFile == "" {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "mandatory option -i is missing",
+		}
+	}
+
+	f, err := os.Open(a.flInFile)
+	if err != nil {
+		return &AppError{exitCode: 1, msg: err.Error()}
+	}
+	defer f.Close()
+
+	entries, err := readHistory(f)
+	if err != nil {
+		return &AppError{exitCode: 1, msg: err.Error()}
+	}
+	if porcelain {
+		if err := writePorcelain(os.Stdout, entries); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+		return nil
+	}
+	writeHistoryTable(os.Stdout, entries)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// HTML report of encoding run rendered from customizable template.
+
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+)
+
+// defaultReportTemplate is HTML report template used unless custom one is
+// given via -report-template.
+//
+//go:embed templates/report.html
+var defaultReportTemplate string
+
+// htmlReportData is data HTML report template is executed with.
+type htmlReportData struct {
+	// Run is run metadata: ease and tool versions, plan and encoder commands
+	Run manifest
+	// Summary is aggregate summary of run
+	Summary aggregateSummary
+	// Rows are summary rows, one per encoding run
+	Rows []summaryRow
+	// Report is full report of run (same as written via -report)
+	Report *report
+}
+
+// reportTemplateFuncs are functions available in HTML report templates in
+// addition to html/template builtins.
+var reportTemplateFuncs = template.FuncMap{
+	"base": path.Base,
+}
+
+// parseReportTemplate will parse HTML report template from file, empty name
+// means default template.
+func parseReportTemplate(name string) (*template.Template, error) {
+	text := defaultReportTemplate
+	if name != "" {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("parseReportTemplate() %w", err)
+		}
+		text = string(b)
+	}
+	t, err := template.New("report").Funcs(reportTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parseReportTemplate() %w", err)
+	}
+	return t, nil
+}
+
+// writeHTMLReport will execute HTML report template with data and write
+// result to file.
+func writeHTMLReport(t *template.Template, data htmlReportData, name string) error {
+	f, err := perm.Create(name)
+	if err != nil {
+		return fmt.Errorf("writeHTMLReport() perm.Create: %w", err)
+	}
+	defer f.Close()
+
+	if err := t.Execute(f, data); err != nil {
+		return fmt.Errorf("writeHTMLReport() %w", err)
+	}
+	return f.Close()
+}
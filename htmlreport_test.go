@@ -0,0 +1,90 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tests for HTML report.
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_writeHTMLReport(t *testing.T) {
+	rep := parseReportFile("testdata/encoding_artifacts/report.json")
+	data := htmlReportData{
+		Run:     manifest{Ease: manifestEase{Version: "v1.2.3"}},
+		Summary: newAggregateSummary(rep),
+		Rows:    newSummary(rep),
+		Report:  rep,
+	}
+	tempDir := t.TempDir()
+
+	t.Run("Default template", func(t *testing.T) {
+		tpl, err := parseReportTemplate("")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		out := path.Join(tempDir, "default.html")
+		if err := writeHTMLReport(tpl, data, out); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got := string(b)
+		for _, want := range []string{"v1.2.3", data.Rows[0].Name, path.Base(data.Rows[0].CompressedFile)} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Expected %q in HTML report", want)
+			}
+		}
+	})
+
+	t.Run("Custom template", func(t *testing.T) {
+		tplFile := path.Join(tempDir, "custom.tmpl")
+		custom := `{{range .Rows}}{{.Name}}:{{base .CompressedFile}};{{end}}`
+		if err := os.WriteFile(tplFile, []byte(custom), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		tpl, err := parseReportTemplate(tplFile)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		out := path.Join(tempDir, "custom.html")
+		if err := writeHTMLReport(tpl, data, out); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var want strings.Builder
+		for _, r := range data.Rows {
+			want.WriteString(r.Name + ":" + path.Base(r.CompressedFile) + ";")
+		}
+		if diff := cmp.Diff(want.String(), string(b)); diff != "" {
+			t.Errorf("HTML report mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Invalid template should fail", func(t *testing.T) {
+		tplFile := path.Join(tempDir, "invalid.tmpl")
+		if err := os.WriteFile(tplFile, []byte(`{{range .Rows}}`), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := parseReportTemplate(tplFile); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+
+	t.Run("Missing template should fail", func(t *testing.T) {
+		if _, err := parseReportTemplate(path.Join(tempDir, "missing.tmpl")); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
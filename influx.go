@@ -0,0 +1,93 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Encoding run metrics in InfluxDB line protocol.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+	"github.com/evolution-gaming/ease/internal/vqm"
+)
+
+// influxMeasurement is measurement name of InfluxDB line protocol points.
+const influxMeasurement = "ease"
+
+// writeInflux will write report metrics to w in InfluxDB line protocol, a point
+// per encode tagged by scheme name and input (source file base name) and
+// timestamped with run end time.
+func writeInflux(w io.Writer, r *report) error {
+	metrics := make(map[string]vqm.VideoQualityMetrics, len(r.VQMResults))
+	for i := range r.VQMResults {
+		v := &r.VQMResults[i]
+		metrics[v.CompressedFile] = v.Metrics
+	}
+
+	rows := newSummary(r)
+	// Keep output stable between runs.
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Name != rows[j].Name {
+			return rows[i].Name < rows[j].Name
+		}
+		return rows[i].SourceFile < rows[j].SourceFile
+	})
+
+	ts := r.EncodingResult.EndTime.UnixNano()
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	bw := bufio.NewWriter(w)
+	for i := range rows {
+		row := &rows[i]
+		tags := []string{influxMeasurement}
+		// Empty tag values are not allowed.
+		if row.Name != "" {
+			tags = append(tags, "scheme="+escapeInfluxTag(row.Name))
+		}
+		tags = append(tags, "input="+escapeInfluxTag(path.Base(row.SourceFile)))
+
+		var fields []string
+		// Encodes without VQMs have no quality fields.
+		if m, ok := metrics[row.CompressedFile]; ok {
+			fields = append(fields, "vmaf="+f(m.VMAF), "psnr="+f(m.PSNR), "ms_ssim="+f(m.MS_SSIM))
+		}
+		fields = append(fields,
+			"bitrate_kbps="+f(row.Bitrate),
+			fmt.Sprintf("size_bytes=%di", row.Size),
+			"encoding_speed="+f(row.Speed))
+
+		fmt.Fprintf(bw, "%s %s %d\n", strings.Join(tags, ","), strings.Join(fields, ","), ts)
+	}
+	return bw.Flush()
+}
+
+// influxTagEscaper escapes tag value as required by InfluxDB line protocol.
+var influxTagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+
+func escapeInfluxTag(s string) string {
+	return influxTagEscaper.Replace(s)
+}
+
+// writeInfluxFile will write report metrics into file in InfluxDB line
+// protocol.
+func writeInfluxFile(r *report, name string) error {
+	fd, err := perm.Create(name)
+	if err != nil {
+		return fmt.Errorf("writeInfluxFile() perm.Create: %w", err)
+	}
+	defer fd.Close()
+
+	if err := writeInflux(fd, r); err != nil {
+		return fmt.Errorf("writeInfluxFile() %w", err)
+	}
+	return fd.Close()
+}
@@ -0,0 +1,57 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tests for InfluxDB line protocol output.
+package main
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/vqm"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_writeInflux(t *testing.T) {
+	given := &report{
+		EncodingResult: encoding.PlanResult{
+			EndTime: time.Unix(1650000000, 0),
+			RunResults: []encoding.RunResult{
+				{EncoderCmd: encoding.EncoderCmd{Name: "x264", SourceFile: "/src/clip01.mp4", CompressedFile: "a.mp4"}, AvgEncodingSpeed: 2},
+				{EncoderCmd: encoding.EncoderCmd{Name: "x265 slow", SourceFile: "/src/clip,01.mp4", CompressedFile: "b.mp4"}},
+			},
+		},
+		VQMResults: []namedVqmResult{
+			{Result: vqm.Result{CompressedFile: "a.mp4", Metrics: vqm.VideoQualityMetrics{VMAF: 93.2, PSNR: 40, MS_SSIM: 0.99}}},
+		},
+	}
+	want := `ease,scheme=x264,input=clip01.mp4 vmaf=93.2,psnr=40,ms_ssim=0.99,bitrate_kbps=0,size_bytes=0i,encoding_speed=2 1650000000000000000
+ease,scheme=x265\ slow,input=clip\,01.mp4 bitrate_kbps=0,size_bytes=0i,encoding_speed=0 1650000000000000000
+`
+	var buf bytes.Buffer
+	if err := writeInflux(&buf, given); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("InfluxDB output mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("Should write InfluxDB file", func(t *testing.T) {
+		name := path.Join(t.TempDir(), "ease.influx")
+		if err := writeInfluxFile(given, name); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, string(b)); diff != "" {
+			t.Errorf("InfluxDB file mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,289 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Alternative (per GOP and sliding window) bitrate computation modes.
+
+package analysis
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+)
+
+// Bitrate computation modes.
+const (
+	// BitrateModeSecond aggregates frame sizes into 1 second buckets.
+	BitrateModeSecond = "second"
+	// BitrateModeGOP computes average bitrate of each GOP (from key frame to
+	// next key frame).
+	BitrateModeGOP = "gop"
+	// BitrateModeWindow computes bitrate over 1 second sliding window ending
+	// at each frame.
+	BitrateModeWindow = "window"
+)
+
+// IsBitrateMode reports whether m is a valid bitrate computation mode.
+func IsBitrateMode(m string) bool {
+	switch m {
+	case BitrateModeSecond, BitrateModeGOP, BitrateModeWindow:
+		return true
+	}
+	return false
+}
+
+// BitrateSeries is bitrate (in Kbps) of each 1 second bucket of video, in
+// total and split by frame type. Bucket index is a second from start of
+// video.
+type BitrateSeries struct {
+	Total  []float64
+	IFrame []float64
+	PFrame []float64
+}
+
+// SecondBitrates aggregates frame sizes into 1 second buckets (see
+// BitrateModeSecond), non-key frames are counted as P-frames.
+func SecondBitrates(frameStats []FrameStat) BitrateSeries {
+	var s BitrateSeries
+	if len(frameStats) == 0 {
+		return s
+	}
+	// Bucket count should be same as video duration in seconds.
+	n := int(math.Floor(getDuration(frameStats))) + 1
+	s.Total = make([]float64, n)
+	s.IFrame = make([]float64, n)
+	s.PFrame = make([]float64, n)
+
+	// Use normalized time e.g. deal with negative PTS.
+	minPts := minPtsTime(frameStats)
+	for _, f := range frameStats {
+		i := int(math.Floor(f.PtsTime - minPts))
+		// Convert frame size to Kbits.
+		size := float64(f.Size*8) / 1000
+		s.Total[i] += size
+		if f.KeyFrame {
+			s.IFrame[i] += size
+		} else {
+			s.PFrame[i] += size
+		}
+	}
+	return s
+}
+
+// ToCSV will write BitrateSeries as CSV with header row, one row per second.
+func (s BitrateSeries) ToCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"Second", "Total", "IFrame", "PFrame"}); err != nil {
+		return fmt.Errorf("ToCSV() write header: %w", err)
+	}
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for i := range s.Total {
+		if err := cw.Write([]string{strconv.Itoa(i), f(s.Total[i]), f(s.IFrame[i]), f(s.PFrame[i])}); err != nil {
+			return fmt.Errorf("ToCSV() write row: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("ToCSV() flush: %w", err)
+	}
+	return nil
+}
+
+// bitrateWindow is a sliding window size in seconds for BitrateModeWindow.
+const bitrateWindow = 1.0
+
+// gopBitrates calculates average bitrate (in Kbps) of each GOP, X is GOP start
+// time (normalized PTS in seconds).
+//
+// GOPs are split on key frames in decode order, GOP duration is sum of frame
+// durations.
+func gopBitrates(frameStats []FrameStat) plotter.XYs {
+	if len(frameStats) == 0 {
+		return nil
+	}
+	minPts := minPtsTime(frameStats)
+
+	var xys plotter.XYs
+	var size uint64
+	var duration float64
+	start := math.Inf(1)
+	flush := func() {
+		if duration > 0 {
+			xys = append(xys, plotter.XY{X: start - minPts, Y: float64(size*8) / 1000 / duration})
+		}
+		size, duration, start = 0, 0, math.Inf(1)
+	}
+	for i, f := range frameStats {
+		if f.KeyFrame && i > 0 {
+			flush()
+		}
+		size += f.Size
+		duration += f.DurationTime
+		start = math.Min(start, f.PtsTime)
+	}
+	flush()
+	return xys
+}
+
+// windowBitrates calculates bitrate (in Kbps) over sliding window of
+// bitrateWindow seconds ending at each frame, X is frame time (normalized PTS
+// in seconds).
+func windowBitrates(frameStats []FrameStat) plotter.XYs {
+	if len(frameStats) == 0 {
+		return nil
+	}
+	// Frames are in decode order, window is defined in presentation order.
+	frames := make([]FrameStat, len(frameStats))
+	copy(frames, frameStats)
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].PtsTime < frames[j].PtsTime })
+	minPts := frames[0].PtsTime
+
+	xys := make(plotter.XYs, len(frames))
+	var size uint64
+	lo := 0
+	for i, f := range frames {
+		size += f.Size
+		for frames[lo].PtsTime <= f.PtsTime-bitrateWindow {
+			size -= frames[lo].Size
+			lo++
+		}
+		xys[i].X = f.PtsTime - minPts
+		xys[i].Y = float64(size*8) / 1000 / bitrateWindow
+	}
+	return xys
+}
+
+// minPtsTime returns smallest PTS time of frames.
+func minPtsTime(frameStats []FrameStat) float64 {
+	min := math.Inf(1)
+	for _, f := range frameStats {
+		min = math.Min(min, f.PtsTime)
+	}
+	return min
+}
+
+// createBitrateModePlot creates a bitrate plot for per GOP or sliding window
+// bitrate computation mode.
+func createBitrateModePlot(frameStats []FrameStat, o plotOptions) (*plot.Plot, error) {
+	th := o.theme()
+	p := o.newPlot()
+	p.X.Label.Text = "Time (seconds)"
+
+	var xys plotter.XYs
+	var name string
+	switch o.bitrateMode {
+	case BitrateModeGOP:
+		xys = gopBitrates(frameStats)
+		name = "Per GOP"
+	case BitrateModeWindow:
+		xys = windowBitrates(frameStats)
+		name = fmt.Sprintf("%gs window", bitrateWindow)
+	default:
+		return p, fmt.Errorf("createBitrateModePlot() unknown bitrate mode %q", o.bitrateMode)
+	}
+	if len(xys) == 0 {
+		return p, errors.New("createBitrateModePlot() no bitrate values")
+	}
+
+	values := make([]float64, len(xys))
+	for i := range xys {
+		values[i] = xys[i].Y
+	}
+	div, prefix := o.unitScale(maxFloat64(values))
+	for i := range xys {
+		xys[i].Y /= div
+		values[i] /= div
+	}
+	p.Y.Label.Text = prefix + "bps"
+
+	var floor float64
+	if o.logScale {
+		floor = logFloor(values)
+		clampXYs(floor, xys)
+	}
+
+	line, err := plotter.NewLine(xys)
+	if err != nil {
+		return p, fmt.Errorf("createBitrateModePlot() creating new Line: %w", err)
+	}
+	line.Color = th.palette[1]
+	if o.bitrateMode == BitrateModeGOP {
+		line.StepStyle = plotter.PostStep
+	}
+
+	xMax := xys[len(xys)-1].X
+	mean := stat.Mean(values, nil)
+	max := maxFloat64(values)
+	meanLine, meanLabel := horizontalLineWithLabel(mean, 0, xMax, fmt.Sprintf("mean=%.2f %s", mean, p.Y.Label.Text))
+	maxLine, maxLabel := horizontalLineWithLabel(max, 0, xMax, fmt.Sprintf("max=%.2f %s", max, p.Y.Label.Text))
+	th.styleLabels(meanLabel)
+	th.styleLabels(maxLabel)
+
+	p.Y.Min = 0
+	p.Y.Max = max * 1.1
+	if o.logScale {
+		setLogScale(p, floor)
+	}
+	p.X.Tick.Marker = o.timeTicker()
+
+	p.Add(line, meanLine, meanLabel, maxLine, maxLabel, th.newGrid())
+
+	p.Legend.XOffs = -10
+	p.Legend.YOffs = -10
+	if o.setupLegend(p, LegendTop) {
+		p.Legend.Add(name, line)
+	}
+
+	return p, nil
+}
+
+// logFloorFraction is a fraction of smallest positive value that non-positive
+// values are clamped to on logarithmic axis.
+const logFloorFraction = 0.5
+
+// logFloor returns floor for values plotted on logarithmic axis where log of
+// zero is undefined, that is a fraction of smallest positive value (1 in case
+// there are none).
+func logFloor(series ...[]float64) float64 {
+	min := math.Inf(1)
+	for _, s := range series {
+		for _, v := range s {
+			if v > 0 && v < min {
+				min = v
+			}
+		}
+	}
+	if math.IsInf(min, 1) {
+		return 1
+	}
+	return min * logFloorFraction
+}
+
+// clampXYs will clamp Y values of xys below floor to floor.
+func clampXYs(floor float64, xys ...plotter.XYs) {
+	for _, s := range xys {
+		for i := range s {
+			if s[i].Y < floor {
+				s[i].Y = floor
+			}
+		}
+	}
+}
+
+// setLogScale will switch p's Y axis to logarithmic scale starting at floor.
+func setLogScale(p *plot.Plot, floor float64) {
+	p.Y.Scale = plot.LogScale{}
+	p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
+	p.Y.Min = floor
+}
@@ -0,0 +1,145 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+)
+
+// syntheticFrameStats fixture provides 2 GOPs of 4 frames at 4 fps, key
+// frames are 1000 bytes and other frames 250 bytes.
+func syntheticFrameStats() []FrameStat {
+	var fs []FrameStat
+	for i := 0; i < 8; i++ {
+		f := FrameStat{PtsTime: float64(i) * 0.25, DurationTime: 0.25, Size: 250}
+		if i%4 == 0 {
+			f.KeyFrame = true
+			f.Size = 1000
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+func TestSecondBitrates(t *testing.T) {
+	got := SecondBitrates(syntheticFrameStats())
+	// Duration is 2 seconds, so last bucket is empty.
+	want := BitrateSeries{
+		Total:  []float64{14, 14, 0},
+		IFrame: []float64{8, 8, 0},
+		PFrame: []float64{6, 6, 0},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBitrateSeries_ToCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := SecondBitrates(syntheticFrameStats()).ToCSV(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "Second,Total,IFrame,PFrame\n0,14,8,6\n1,14,8,6\n2,0,0,0\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("CSV mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_gopBitrates(t *testing.T) {
+	got := gopBitrates(syntheticFrameStats())
+	// (1000 + 3*250) * 8 / 1000 Kbits over 1 second.
+	want := plotter.XYs{{X: 0, Y: 14}, {X: 1, Y: 14}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_windowBitrates(t *testing.T) {
+	got := windowBitrates(syntheticFrameStats())
+	want := plotter.XYs{
+		{X: 0, Y: 8},
+		{X: 0.25, Y: 10},
+		{X: 0.5, Y: 12},
+		{X: 0.75, Y: 14},
+		// Window slides past first key frame and includes second one.
+		{X: 1, Y: 14},
+		{X: 1.25, Y: 14},
+		{X: 1.5, Y: 14},
+		{X: 1.75, Y: 14},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_CreateBitratePlot_Modes(t *testing.T) {
+	for _, mode := range []string{BitrateModeGOP, BitrateModeWindow} {
+		t.Run(mode, func(t *testing.T) {
+			got, err := CreateBitratePlot(syntheticFrameStats(), WithBitrateMode(mode))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff("Kbps", got.Y.Label.Text); diff != "" {
+				t.Errorf("Y label mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_CreateBitratePlot_LogScale(t *testing.T) {
+	// Last second has empty frames only, so zero buckets must be clamped.
+	frameStats := syntheticFrameStats()
+	for i := 8; i < 12; i++ {
+		frameStats = append(frameStats, FrameStat{PtsTime: float64(i) * 0.25, DurationTime: 0.25})
+	}
+	for _, mode := range []string{BitrateModeSecond, BitrateModeGOP, BitrateModeWindow} {
+		t.Run(mode, func(t *testing.T) {
+			got, err := CreateBitratePlot(frameStats, WithBitrateMode(mode), WithLogScale(true))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, ok := got.Y.Scale.(plot.LogScale); !ok {
+				t.Errorf("Expected logarithmic Y axis, got %T", got.Y.Scale)
+			}
+			if got.Y.Min <= 0 {
+				t.Errorf("Expected positive Y axis floor, got %v", got.Y.Min)
+			}
+			// Log scale panics on non-positive values while drawing.
+			wt, err := got.WriterTo(200, 200, "png")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, err := wt.WriteTo(io.Discard); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func Test_logFloor(t *testing.T) {
+	if diff := cmp.Diff(0.5, logFloor([]float64{0, 4, 1}, []float64{0, 2})); diff != "" {
+		t.Errorf("Floor mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(1.0, logFloor([]float64{0, 0})); diff != "" {
+		t.Errorf("Floor of zero values mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_IsBitrateMode(t *testing.T) {
+	for _, v := range []string{BitrateModeSecond, BitrateModeGOP, BitrateModeWindow} {
+		if !IsBitrateMode(v) {
+			t.Errorf("Expected %q to be valid bitrate mode", v)
+		}
+	}
+	if IsBitrateMode("vbv") {
+		t.Error("Expected \"vbv\" to be invalid bitrate mode")
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// VQM and bitrate correlation plot on shared timeline.
+
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+// DualAxisPlot is a plot with secondary Y axis on the right side.
+//
+// Gonum plot has no notion of secondary axis, so values of secondary series
+// are scaled into primary Y axis range (see ToPrimary) and plotted as usual,
+// secondary axis ticks are drawn separately in a strip reserved on the right
+// side of canvas.
+type DualAxisPlot struct {
+	*plot.Plot
+	// Secondary Y axis range and label
+	RightMin   float64
+	RightMax   float64
+	RightLabel string
+}
+
+// ToPrimary maps value from secondary Y axis range to primary Y axis range.
+func (d *DualAxisPlot) ToPrimary(v float64) float64 {
+	if d.RightMax == d.RightMin {
+		return d.Y.Min
+	}
+	return d.Y.Min + (v-d.RightMin)/(d.RightMax-d.RightMin)*(d.Y.Max-d.Y.Min)
+}
+
+// Draw draws plot with secondary Y axis to canvas.
+func (d *DualAxisPlot) Draw(c draw.Canvas) {
+	pad := vg.Points(5)
+	ticks := plot.DefaultTicks{}.Ticks(d.RightMin, d.RightMax)
+	tickSty := d.Y.Tick.Label
+	tickSty.XAlign = draw.XLeft
+	tickSty.YAlign = draw.YCenter
+	var tickW vg.Length
+	for _, t := range ticks {
+		if w := tickSty.Width(t.Label); !t.IsMinor() && w > tickW {
+			tickW = w
+		}
+	}
+	lblSty := d.Y.Label.TextStyle
+	lblSty.Rotation += math.Pi / 2
+	lblSty.XAlign = draw.XCenter
+	lblSty.YAlign = draw.YCenter
+	lblH := lblSty.Height(d.RightLabel)
+
+	// Reserve space for secondary axis, primary plot is drawn in what is left.
+	left := c
+	left.Max.X -= d.Y.Tick.Length + pad + tickW + pad + lblH + pad
+	d.Plot.Draw(left)
+
+	da := d.Plot.DataCanvas(left)
+	_, trY := d.Plot.Transforms(&da)
+	x := da.Max.X
+	c.StrokeLine2(d.Y.LineStyle, x, da.Min.Y, x, da.Max.Y)
+	for _, t := range ticks {
+		y := trY(d.ToPrimary(t.Value))
+		if t.IsMinor() {
+			c.StrokeLine2(d.Y.Tick.LineStyle, x, y, x+d.Y.Tick.Length/2, y)
+			continue
+		}
+		c.StrokeLine2(d.Y.Tick.LineStyle, x, y, x+d.Y.Tick.Length, y)
+		c.FillText(tickSty, vg.Point{X: x + d.Y.Tick.Length + pad, Y: y}, t.Label)
+	}
+	if d.RightLabel != "" {
+		c.FillText(lblSty, vg.Point{X: c.Max.X - pad - lblH/2, Y: (da.Min.Y + da.Max.Y) / 2}, d.RightLabel)
+	}
+}
+
+// vqmTimeXYs maps per-frame VQM values to frame presentation times (from 0),
+// frames are aligned on index in presentation order. In case of different
+// frame counts only frames present in both are kept.
+func vqmTimeXYs(values []float64, frameStats []FrameStat) plotter.XYs {
+	pts := normalizedPts(frameStats)
+	n := len(values)
+	if len(pts) < n {
+		n = len(pts)
+	}
+	xys := make(plotter.XYs, n)
+	for i := 0; i < n; i++ {
+		xys[i].X = pts[i]
+		xys[i].Y = values[i]
+	}
+	return xys
+}
+
+// CreateCorrelatePlot creates a plot of per-frame VQM values (left Y axis) and
+// per-second bitrate (right Y axis) on shared time X axis, to correlate e.g.
+// VMAF dips with bitrate spikes.
+//
+// VQM Y axis range defaults depend on metric (see WithYMin and WithYMax),
+// bitrate units are picked same as for bitrate plot (see WithUnits). Legend is
+// placed at the top by default.
+func CreateCorrelatePlot(values []float64, frameStats []FrameStat, metric string, opts ...PlotOption) (*DualAxisPlot, error) {
+	o := newPlotOptions(metric, opts...)
+	th := o.theme()
+	p := o.newPlot()
+	p.X.Label.Text = "Time (seconds)"
+	p.Y.Label.Text = metric
+	d := &DualAxisPlot{Plot: p}
+
+	if len(values) == 0 || len(frameStats) == 0 {
+		return d, errors.New("CreateCorrelatePlot() no data to plot")
+	}
+
+	vqmXYs := vqmTimeXYs(values, frameStats)
+	// Primary Y axis range should be known before bitrate is scaled into it.
+	_, _, yMin, yMax := plotter.XYRange(vqmXYs)
+	if !math.IsNaN(o.yMin) {
+		yMin = o.yMin
+	}
+	if !math.IsNaN(o.yMax) {
+		yMax = o.yMax
+	}
+	p.Y.Min, p.Y.Max = yMin, yMax
+
+	bitrates := SecondBitrates(frameStats).Total
+	div, prefix := o.unitScale(maxFloat64(bitrates))
+	// Leave some headroom so bitrate peaks do not stick to the top.
+	d.RightMax = maxFloat64(bitrates) / div * 1.1
+	d.RightLabel = prefix + "bps"
+	brXYs := make(plotter.XYs, len(bitrates))
+	for i, v := range bitrates {
+		brXYs[i].X = float64(i)
+		brXYs[i].Y = d.ToPrimary(v / div)
+	}
+
+	vqmLine, err := plotter.NewLine(vqmXYs)
+	if err != nil {
+		return d, fmt.Errorf("CreateCorrelatePlot() creating VQM line: %w", err)
+	}
+	vqmLine.Color = th.palette[0]
+
+	brLine, err := plotter.NewLine(brXYs)
+	if err != nil {
+		return d, fmt.Errorf("CreateCorrelatePlot() creating bitrate line: %w", err)
+	}
+	brLine.Color = th.palette[3]
+	brLine.StepStyle = plotter.PostStep
+
+	p.Add(th.newGrid(), brLine, vqmLine)
+	// Adding plotters could have widened Y axis range, restore it so that
+	// secondary axis stays aligned.
+	p.Y.Min, p.Y.Max = yMin, yMax
+	if o.setupLegend(p, LegendTop) {
+		p.Legend.Add(metric, vqmLine)
+		p.Legend.Add("Bitrate", brLine)
+	}
+	p.X.Tick.Marker = o.timeTicker()
+
+	return d, nil
+}
+
+// SaveCorrelatePlot will create VQM and bitrate correlation plot and save it to
+// a file.
+func SaveCorrelatePlot(values []float64, frameStats []FrameStat, metric, title, outFile string, opts ...PlotOption) error {
+	w, err := perm.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("SaveCorrelatePlot() error from perm.Create(): %w", err)
+	}
+	defer w.Close()
+
+	return WriteCorrelatePlot(w, values, frameStats, metric, title, opts...)
+}
+
+// WriteCorrelatePlot will create VQM and bitrate correlation plot and write it
+// as PNG to w.
+func WriteCorrelatePlot(w io.Writer, values []float64, frameStats []FrameStat, metric, title string, opts ...PlotOption) error {
+	d, err := CreateCorrelatePlot(values, frameStats, metric, opts...)
+	if err != nil {
+		return fmt.Errorf("WriteCorrelatePlot() %w", err)
+	}
+	d.Title.Text = title
+
+	img := vgimg.NewWith(
+		vgimg.UseWH(defaultPlotWidth, defaultPlotHeight*2),
+		vgimg.UseBackgroundColor(d.BackgroundColor))
+	d.Draw(draw.New(img))
+
+	if err := writePNG(w, img, opts...); err != nil {
+		return fmt.Errorf("WriteCorrelatePlot() %w", err)
+	}
+
+	return nil
+}
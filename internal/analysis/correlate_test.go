@@ -0,0 +1,91 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+)
+
+func Test_vqmTimeXYs(t *testing.T) {
+	fs := syntheticFrameStats()[:3]
+	tests := map[string]struct {
+		values []float64
+		want   plotter.XYs
+	}{
+		"Same frame count": {
+			values: []float64{90, 80, 70},
+			want:   plotter.XYs{{X: 0, Y: 90}, {X: 0.25, Y: 80}, {X: 0.5, Y: 70}},
+		},
+		"More VQM values than frames": {
+			values: []float64{90, 80, 70, 60},
+			want:   plotter.XYs{{X: 0, Y: 90}, {X: 0.25, Y: 80}, {X: 0.5, Y: 70}},
+		},
+		"Less VQM values than frames": {
+			values: []float64{90},
+			want:   plotter.XYs{{X: 0, Y: 90}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := vqmTimeXYs(tc.values, fs)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_DualAxisPlot_ToPrimary(t *testing.T) {
+	d := &DualAxisPlot{Plot: plot.New(), RightMin: 0, RightMax: 1000}
+	d.Y.Min, d.Y.Max = 0, 100
+	got := []float64{d.ToPrimary(0), d.ToPrimary(500), d.ToPrimary(1000)}
+	want := []float64{0, 50, 100}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_CreateCorrelatePlot(t *testing.T) {
+	vmafs := []float64{95, 90, 60, 92, 94, 91, 93, 95}
+
+	t.Run("Should have VMAF and bitrate axes", func(t *testing.T) {
+		got, err := CreateCorrelatePlot(vmafs, syntheticFrameStats(), "VMAF")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// VMAF has fixed 0-100 range by default.
+		if diff := cmp.Diff([]float64{0, 100}, []float64{got.Y.Min, got.Y.Max}); diff != "" {
+			t.Errorf("Y axis range mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff("Kbps", got.RightLabel); diff != "" {
+			t.Errorf("Right axis label mismatch (-want +got):\n%s", diff)
+		}
+		// Bitrate peak should be below top of secondary axis.
+		if got.RightMax <= 14 {
+			t.Errorf("Expected headroom above bitrate peak, got right axis max %v", got.RightMax)
+		}
+	})
+
+	t.Run("Should fail without data", func(t *testing.T) {
+		if _, err := CreateCorrelatePlot(nil, syntheticFrameStats(), "VMAF"); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+
+	t.Run("Should write PNG", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteCorrelatePlot(&buf, vmafs, syntheticFrameStats(), "VMAF", "Test plot title"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte("\x89PNG")) {
+			t.Errorf("Written data is not a PNG image")
+		}
+	})
+}
@@ -0,0 +1,190 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Cumulative bits plot for leaky bucket (buffer model) analysis.
+
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// cumulativeBits returns cumulative size (in Kbits) of frames in presentation
+// order, X is normalized PTS (in seconds) of frame and Y includes frame's own
+// size.
+func cumulativeBits(frameStats []FrameStat) plotter.XYs {
+	frames := make([]FrameStat, len(frameStats))
+	copy(frames, frameStats)
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].PtsTime < frames[j].PtsTime })
+	minPts := minPtsTime(frames)
+
+	xys := make(plotter.XYs, len(frames))
+	var acc float64
+	for i, f := range frames {
+		acc += float64(f.Size*8) / 1000
+		xys[i].X = f.PtsTime - minPts
+		xys[i].Y = acc
+	}
+	return xys
+}
+
+// bucketViolations checks cumulative bits against leaky bucket drained at
+// constant rate (in Kbps) with given buffer size (in Kbits). Cumulative bits
+// should stay between drain line (rate times time) and drain line shifted up
+// by buffer size.
+//
+// Overflow points are frames after which cumulative bits exceed the upper
+// bound, underflow points are frame arrivals before which drain line has
+// caught up with cumulative bits (buffer ran empty).
+func bucketViolations(cum plotter.XYs, rate, buffer float64) (overflow, underflow plotter.XYs) {
+	var before float64
+	for _, p := range cum {
+		drained := rate * p.X
+		if before < drained {
+			underflow = append(underflow, plotter.XY{X: p.X, Y: before})
+		}
+		if p.Y > drained+buffer {
+			overflow = append(overflow, p)
+		}
+		before = p.Y
+	}
+	return overflow, underflow
+}
+
+// CreateCumulativeBitsPlot creates a plot of cumulative bits over time along
+// with constant target rate (in Kbps) drain line, for visualizing leaky bucket
+// compliance. Frames overflowing or underflowing the bucket are flagged (see
+// bucketViolations), bucket size can be set via WithBufferSize option and
+// defaults to one second at target rate.
+func CreateCumulativeBitsPlot(frameStats []FrameStat, targetRate float64, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions("", opts...)
+	th := o.theme()
+	p := o.newPlot()
+	p.X.Label.Text = "Time (seconds)"
+
+	if targetRate <= 0 {
+		return p, fmt.Errorf("CreateCumulativeBitsPlot() invalid target rate %g", targetRate)
+	}
+	if len(frameStats) == 0 {
+		return p, errors.New("CreateCumulativeBitsPlot() no frames")
+	}
+	buffer := o.bufferSize
+	if buffer <= 0 {
+		buffer = targetRate
+	}
+
+	cum := cumulativeBits(frameStats)
+	overflow, underflow := bucketViolations(cum, targetRate, buffer)
+	xMax := cum[len(cum)-1].X
+	drain := plotter.XYs{{X: 0, Y: 0}, {X: xMax, Y: targetRate * xMax}}
+	upper := plotter.XYs{{X: 0, Y: buffer}, {X: xMax, Y: targetRate*xMax + buffer}}
+
+	// Scale all series to Kbits or Mbits depending on units.
+	div, prefix := o.unitScale(maxFloat64([]float64{cum[len(cum)-1].Y, upper[1].Y}))
+	for _, xys := range []plotter.XYs{cum, overflow, underflow, drain, upper} {
+		for i := range xys {
+			xys[i].Y /= div
+		}
+	}
+	p.Y.Label.Text = prefix + "bits"
+
+	cumLine, err := plotter.NewLine(cum)
+	if err != nil {
+		return p, fmt.Errorf("CreateCumulativeBitsPlot() creating cumulative Line: %w", err)
+	}
+	cumLine.Color = th.palette[1]
+	cumLine.StepStyle = plotter.PostStep
+
+	drainLine, err := plotter.NewLine(drain)
+	if err != nil {
+		return p, fmt.Errorf("CreateCumulativeBitsPlot() creating drain Line: %w", err)
+	}
+	drainLine.Color = th.palette[5]
+
+	upperLine, err := plotter.NewLine(upper)
+	if err != nil {
+		return p, fmt.Errorf("CreateCumulativeBitsPlot() creating buffer Line: %w", err)
+	}
+	upperLine.Color = th.palette[5]
+	upperLine.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+
+	p.Add(th.newGrid(), cumLine, drainLine, upperLine)
+
+	var overScatter, underScatter *plotter.Scatter
+	if len(overflow) > 0 {
+		if overScatter, err = plotter.NewScatter(overflow); err != nil {
+			return p, fmt.Errorf("CreateCumulativeBitsPlot() creating overflow Scatter: %w", err)
+		}
+		overScatter.Color = th.palette[0]
+		overScatter.Shape = draw.CircleGlyph{}
+		p.Add(overScatter)
+	}
+	if len(underflow) > 0 {
+		if underScatter, err = plotter.NewScatter(underflow); err != nil {
+			return p, fmt.Errorf("CreateCumulativeBitsPlot() creating underflow Scatter: %w", err)
+		}
+		underScatter.Color = th.palette[4]
+		underScatter.Shape = draw.CircleGlyph{}
+		p.Add(underScatter)
+	}
+
+	p.Y.Min = 0
+	p.X.Tick.Marker = o.timeTicker()
+
+	// Cumulative bits grow to the right, so legend goes to the left.
+	p.Legend.Left = true
+	p.Legend.XOffs = 10
+	p.Legend.YOffs = -10
+	if o.setupLegend(p, LegendTop) {
+		p.Legend.Add("Cumulative", cumLine)
+		p.Legend.Add(fmt.Sprintf("Drain %.0f Kbps", targetRate), drainLine)
+		p.Legend.Add(fmt.Sprintf("Buffer %.0f Kbits", buffer), upperLine)
+		if overScatter != nil {
+			p.Legend.Add(fmt.Sprintf("Overflow (%d frames)", len(overflow)), overScatter)
+		}
+		if underScatter != nil {
+			p.Legend.Add(fmt.Sprintf("Underflow (%d frames)", len(underflow)), underScatter)
+		}
+	}
+
+	return p, nil
+}
+
+// SaveCumulativeBitsPlot will create cumulative bits plot and save it to a
+// file.
+func SaveCumulativeBitsPlot(frameStats []FrameStat, targetRate float64, title, outFile string, opts ...PlotOption) error {
+	w, err := perm.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("SaveCumulativeBitsPlot() error from perm.Create(): %w", err)
+	}
+	defer w.Close()
+
+	return WriteCumulativeBitsPlot(w, frameStats, targetRate, title, opts...)
+}
+
+// WriteCumulativeBitsPlot will create cumulative bits plot and write it as PNG
+// to w.
+func WriteCumulativeBitsPlot(w io.Writer, frameStats []FrameStat, targetRate float64, title string, opts ...PlotOption) error {
+	p, err := CreateCumulativeBitsPlot(frameStats, targetRate, opts...)
+	if err != nil {
+		return fmt.Errorf("WriteCumulativeBitsPlot() %w", err)
+	}
+	p.Title.Text = title
+
+	plots := [][]*plot.Plot{{p}}
+	if err := writeMultiPlot(w, plots, defaultPlotWidth, defaultPlotHeight*2, opts...); err != nil {
+		return fmt.Errorf("WriteCumulativeBitsPlot() %w", err)
+	}
+
+	return nil
+}
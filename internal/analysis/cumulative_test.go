@@ -0,0 +1,84 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gonum.org/v1/plot/plotter"
+)
+
+func Test_cumulativeBits(t *testing.T) {
+	// Frames in decode order, cumulative bits are in presentation order.
+	fs := []FrameStat{
+		{PtsTime: 0, Size: 1000, KeyFrame: true},
+		{PtsTime: 0.5, Size: 250},
+		{PtsTime: 0.25, Size: 500},
+	}
+	got := cumulativeBits(fs)
+	want := plotter.XYs{{X: 0, Y: 8}, {X: 0.25, Y: 12}, {X: 0.5, Y: 14}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_bucketViolations(t *testing.T) {
+	// Synthetic stream is 14 Kbps with 8 Kbit key frames.
+	cum := cumulativeBits(syntheticFrameStats())
+	tests := map[string]struct {
+		rate, buffer  float64
+		wantOverflow  int
+		wantUnderflow int
+	}{
+		"Compliant":       {rate: 14, buffer: 14},
+		"Small buffer":    {rate: 14, buffer: 4, wantOverflow: 6},
+		"Rate too low":    {rate: 7, buffer: 14, wantOverflow: 4},
+		"Rate too high":   {rate: 28, buffer: 14, wantUnderflow: 6},
+		"Exactly drained": {rate: 14, buffer: 8},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			overflow, underflow := bucketViolations(cum, tc.rate, tc.buffer)
+			if diff := cmp.Diff(tc.wantOverflow, len(overflow)); diff != "" {
+				t.Errorf("Overflow count mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantUnderflow, len(underflow)); diff != "" {
+				t.Errorf("Underflow count mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_CreateCumulativeBitsPlot(t *testing.T) {
+	t.Run("Should create plot", func(t *testing.T) {
+		got, err := CreateCumulativeBitsPlot(syntheticFrameStats(), 14, WithBufferSize(4))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff("Kbits", got.Y.Label.Text); diff != "" {
+			t.Errorf("Y label mismatch (-want +got):\n%s", diff)
+		}
+		var buf bytes.Buffer
+		if err := WriteCumulativeBitsPlot(&buf, syntheticFrameStats(), 14, "test"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if buf.Len() == 0 {
+			t.Error("Expected PNG output, got none")
+		}
+	})
+	t.Run("Should fail for non-positive target rate", func(t *testing.T) {
+		if _, err := CreateCumulativeBitsPlot(syntheticFrameStats(), 0); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+	t.Run("Should fail for no frames", func(t *testing.T) {
+		if _, err := CreateCumulativeBitsPlot(nil, 1000); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Combined "dashboard" plot of all metrics for a single encode.
+
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+	"gonum.org/v1/plot"
+)
+
+// DashboardData holds all per encode data required for dashboard plot.
+type DashboardData struct {
+	// Title is dashboard title (e.g. compressed file name)
+	Title      string
+	FrameStats []FrameStat
+	VMAF       []float64
+	PSNR       []float64
+	MS_SSIM    []float64
+	// SSIMMetric is name of metric in MS_SSIM field, empty means MS-SSIM (e.g.
+	// SSIM when values come from ffmpeg ssim filter)
+	SSIMMetric string
+}
+
+// CreateDashboard will create dashboard plot and save it to a file.
+//
+// Dashboard is a single canvas with key plots tiled in a grid: bitrate, frame
+// sizes and per frame VMAF, VMAF histogram, PSNR and MS-SSIM.
+func CreateDashboard(data DashboardData, outFile string, opts ...PlotOption) error {
+	w, err := perm.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("CreateDashboard() error from perm.Create(): %w", err)
+	}
+	defer w.Close()
+
+	return WriteDashboard(w, data, opts...)
+}
+
+// WriteDashboard will create dashboard plot and write it as PNG to w, opts are
+// applied to each subplot.
+func WriteDashboard(w io.Writer, data DashboardData, opts ...PlotOption) (err error) {
+	const rows, cols = 3, 2
+	plots := make([][]*plot.Plot, rows)
+	for i := range plots {
+		plots[i] = make([]*plot.Plot, cols)
+	}
+
+	if plots[0][0], err = CreateBitratePlot(data.FrameStats, opts...); err != nil {
+		return fmt.Errorf("WriteDashboard() error creating bitrate plot: %w", err)
+	}
+	if plots[0][1], err = CreateFrameSizePlot(data.FrameStats, opts...); err != nil {
+		return fmt.Errorf("WriteDashboard() error creating frame size plot: %w", err)
+	}
+	if plots[1][0], err = CreateVqmPlot(data.VMAF, "VMAF", opts...); err != nil {
+		return fmt.Errorf("WriteDashboard() error creating VMAF plot: %w", err)
+	}
+	if plots[1][1], err = CreateHistogramPlot(data.VMAF, "VMAF", opts...); err != nil {
+		return fmt.Errorf("WriteDashboard() error creating VMAF histogram plot: %w", err)
+	}
+	if plots[2][0], err = CreateVqmPlot(data.PSNR, "PSNR", opts...); err != nil {
+		return fmt.Errorf("WriteDashboard() error creating PSNR plot: %w", err)
+	}
+	ssimMetric := "MS-SSIM"
+	if data.SSIMMetric != "" {
+		ssimMetric = data.SSIMMetric
+	}
+	if plots[2][1], err = CreateVqmPlot(data.MS_SSIM, ssimMetric, opts...); err != nil {
+		return fmt.Errorf("WriteDashboard() error creating %s plot: %w", ssimMetric, err)
+	}
+
+	// Same fixed Y ranges as in per metric plots, so that dashboards of
+	// different encodes are visually comparable.
+	for _, v := range []struct {
+		p      *plot.Plot
+		metric string
+	}{{plots[1][0], "VMAF"}, {plots[2][1], ssimMetric}} {
+		if yMin, yMax := DefaultYRange(v.metric); !math.IsNaN(yMin) {
+			v.p.Y.Min, v.p.Y.Max = yMin, yMax
+		}
+	}
+
+	plots[0][0].Title.Text = data.Title + "\n\nBitrate"
+	plots[0][1].Title.Text = "\n\nFrame sizes"
+	plots[1][0].Title.Text = "Per frame VMAF"
+	plots[1][1].Title.Text = "VMAF Histogram"
+	plots[2][0].Title.Text = "Per frame PSNR"
+	plots[2][1].Title.Text = "Per frame " + ssimMetric
+
+	if err := writeMultiPlot(w, plots, defaultPlotWidth*cols, defaultPlotHeight*rows, opts...); err != nil {
+		return fmt.Errorf("WriteDashboard() %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"bytes"
+	"path"
+	"testing"
+)
+
+// getDashboardData fixture provides DashboardData with synthetic frame stats.
+func getDashboardData() DashboardData {
+	vmafs := getVmafValues()
+	frameStats := make([]FrameStat, len(vmafs))
+	for i := range frameStats {
+		frameStats[i] = FrameStat{
+			KeyFrame:     i%25 == 0,
+			DurationTime: 0.04,
+			PtsTime:      float64(i) * 0.04,
+			Size:         1000,
+		}
+	}
+	return DashboardData{
+		Title:      "Test dashboard",
+		FrameStats: frameStats,
+		VMAF:       vmafs,
+		PSNR:       vmafs,
+		MS_SSIM:    vmafs,
+	}
+}
+
+func Test_WriteDashboard(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDashboard(&buf, getDashboardData()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Check for PNG signature.
+	if !bytes.HasPrefix(buf.Bytes(), []byte("\x89PNG")) {
+		t.Errorf("Written data is not a PNG image")
+	}
+}
+
+func Test_CreateDashboard_Negative(t *testing.T) {
+	t.Run("Should return error for non-writable output file", func(t *testing.T) {
+		outFile := path.Join(t.TempDir(), "non-existent-dir", "dashboard.png")
+		if err := CreateDashboard(getDashboardData(), outFile); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+	t.Run("Should return error for empty frame stats", func(t *testing.T) {
+		var buf bytes.Buffer
+		data := getDashboardData()
+		data.FrameStats = nil
+		if err := WriteDashboard(&buf, data); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
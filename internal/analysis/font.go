@@ -0,0 +1,98 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Plot fonts.
+
+package analysis
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font/opentype"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/font"
+	"gonum.org/v1/plot/text"
+	"gonum.org/v1/plot/vg"
+)
+
+// Builtin font families (Liberation fonts bundled with gonum plot).
+const (
+	FontSerif = "serif"
+	FontSans  = "sans"
+	FontMono  = "mono"
+)
+
+// IsFontFamily reports whether f is a builtin font family.
+func IsFontFamily(f string) bool {
+	switch f {
+	case FontSerif, FontSans, FontMono:
+		return true
+	}
+	return false
+}
+
+// RegisterFont will load TrueType or OpenType font file into gonum's font
+// registry, so that it can be used via WithFont, e.g. for branding or CJK
+// metric names. Returned typeface name is font file name without extension.
+func RegisterFont(fontFile string) (string, error) {
+	data, err := os.ReadFile(fontFile)
+	if err != nil {
+		return "", fmt.Errorf("RegisterFont() %w", err)
+	}
+	face, err := opentype.Parse(data)
+	if err != nil {
+		return "", fmt.Errorf("RegisterFont() parse %s: %w", fontFile, err)
+	}
+	name := strings.TrimSuffix(filepath.Base(fontFile), filepath.Ext(fontFile))
+	// Single face is registered as regular, lookups of other weights and
+	// styles fall back to it.
+	font.DefaultCache.Add(font.Collection{{
+		Font: font.Font{Typeface: font.Typeface(name)},
+		Face: face,
+	}})
+	return name, nil
+}
+
+// font returns plot text font according to font family option, gonum's
+// default (serif) font is default.
+func (o *plotOptions) font() font.Font {
+	switch o.fontFamily {
+	case "", FontSerif:
+		return plot.DefaultFont
+	case FontSans:
+		return font.Font{Typeface: "Liberation", Variant: "Sans"}
+	case FontMono:
+		return font.Font{Typeface: "Liberation", Variant: "Mono"}
+	}
+	return font.Font{Typeface: font.Typeface(o.fontFamily)}
+}
+
+// styleFonts will set font family and sizes of plot's title, legend and axes
+// text according to options, unset sizes keep gonum's defaults.
+func (o *plotOptions) styleFonts(p *plot.Plot) {
+	fnt := o.font()
+	set := func(sty *text.Style, size float64) {
+		sz := sty.Font.Size
+		if size > 0 {
+			sz = vg.Points(size)
+		}
+		sty.Font = font.From(fnt, sz)
+	}
+	set(&p.Title.TextStyle, o.titleSize)
+	set(&p.Legend.TextStyle, o.labelSize)
+	for _, a := range []*plot.Axis{&p.X, &p.Y} {
+		set(&a.Label.TextStyle, o.labelSize)
+		set(&a.Tick.Label, o.tickSize)
+	}
+}
+
+// newPlot creates new plot styled according to theme and font options.
+func (o *plotOptions) newPlot() *plot.Plot {
+	p := o.theme().newPlot()
+	o.styleFonts(p)
+	return p
+}
@@ -0,0 +1,91 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-fonts/liberation/liberationsansbold"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/font"
+)
+
+func Test_IsFontFamily(t *testing.T) {
+	for _, v := range []string{FontSerif, FontSans, FontMono} {
+		if !IsFontFamily(v) {
+			t.Errorf("Expected %q to be valid font family", v)
+		}
+	}
+	if IsFontFamily("comic") {
+		t.Error("Expected invalid font family to be rejected")
+	}
+}
+
+func Test_styleFonts(t *testing.T) {
+	t.Run("Defaults keep gonum styling", func(t *testing.T) {
+		want := plot.New()
+		o := newPlotOptions("")
+		got := o.newPlot()
+		if got.Title.TextStyle.Font != want.Title.TextStyle.Font ||
+			got.X.Label.TextStyle.Font != want.X.Label.TextStyle.Font ||
+			got.Y.Tick.Label.Font != want.Y.Tick.Label.Font ||
+			got.Legend.TextStyle.Font != want.Legend.TextStyle.Font {
+			t.Error("Expected default fonts to be unchanged")
+		}
+	})
+
+	t.Run("Family and sizes", func(t *testing.T) {
+		o := newPlotOptions("", WithFont(FontSans), WithFontSizes(20, 14, 0))
+		p := o.newPlot()
+		sans := font.Font{Typeface: "Liberation", Variant: "Sans"}
+		if want := font.From(sans, 20); p.Title.TextStyle.Font != want {
+			t.Errorf("Title font mismatch: want %v, got %v", want, p.Title.TextStyle.Font)
+		}
+		if want := font.From(sans, 14); p.Y.Label.TextStyle.Font != want || p.Legend.TextStyle.Font != want {
+			t.Errorf("Label font mismatch: want %v, got %v and %v", want, p.Y.Label.TextStyle.Font, p.Legend.TextStyle.Font)
+		}
+		// Unset size keeps default.
+		if want := font.From(sans, 10); p.X.Tick.Label.Font != want {
+			t.Errorf("Tick font mismatch: want %v, got %v", want, p.X.Tick.Label.Font)
+		}
+	})
+}
+
+func Test_RegisterFont(t *testing.T) {
+	dir := t.TempDir()
+	fontFile := filepath.Join(dir, "Brand.ttf")
+	if err := os.WriteFile(fontFile, liberationsansbold.TTF, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	name, err := RegisterFont(fontFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name != "Brand" {
+		t.Errorf("Typeface name mismatch: want Brand, got %s", name)
+	}
+	if !font.DefaultCache.Has(font.Font{Typeface: "Brand"}) {
+		t.Error("Expected font to be registered")
+	}
+	var buf bytes.Buffer
+	if err := WriteVqmPlot(&buf, getVmafValues(), "VMAF", "Test plot title", WithFont(name)); err != nil {
+		t.Errorf("Unexpected error plotting with registered font: %v", err)
+	}
+
+	t.Run("Negative", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid.ttf")
+		if err := os.WriteFile(invalid, []byte("not a font"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []string{invalid, filepath.Join(dir, "missing.ttf")} {
+			if _, err := RegisterFont(f); err == nil {
+				t.Errorf("Expected error for %s", f)
+			}
+		}
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Frame timing comparison between source and compressed videos.
+
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// FrameTimingDiff holds counts of source frames dropped from or duplicated in
+// compressed video.
+type FrameTimingDiff struct {
+	Dropped    int
+	Duplicated int
+}
+
+// CompareFrameTiming will detect dropped and duplicated frames by comparing
+// source and compressed video frames' PTS sequences.
+//
+// Each compressed frame is matched to the source frame nearest in time (PTS
+// normalized to start from 0). Source frames without any matching compressed
+// frame are counted as dropped, each additional compressed frame matching the
+// same source frame is counted as duplicate.
+func CompareFrameTiming(source, compressed []FrameStat) FrameTimingDiff {
+	var diff FrameTimingDiff
+	srcPts := normalizedPts(source)
+	if len(srcPts) == 0 {
+		return diff
+	}
+
+	hits := make([]int, len(srcPts))
+	for _, pts := range normalizedPts(compressed) {
+		hits[nearestIndex(srcPts, pts)]++
+	}
+	for _, h := range hits {
+		switch {
+		case h == 0:
+			diff.Dropped++
+		case h > 1:
+			diff.Duplicated += h - 1
+		}
+	}
+
+	return diff
+}
+
+// FramesDuration returns video duration derived from frames: span between
+// first and last frame PTS plus last frame's duration.
+//
+// Unlike container reported duration it is not affected by stream start
+// offset or negative PTS (e.g. B-frame reordering), so large difference between
+// the two is a sign of muxing issues.
+func FramesDuration(fs []FrameStat) float64 {
+	if len(fs) == 0 {
+		return 0
+	}
+	first, last := fs[0], fs[0]
+	for _, v := range fs[1:] {
+		if v.PtsTime < first.PtsTime {
+			first = v
+		}
+		if v.PtsTime > last.PtsTime {
+			last = v
+		}
+	}
+	span := last.PtsTime - first.PtsTime
+	frameDuration := last.DurationTime
+	// Some containers do not store packet duration, use average frame
+	// interval instead.
+	if frameDuration == 0 && len(fs) > 1 {
+		frameDuration = span / float64(len(fs)-1)
+	}
+	return span + frameDuration
+}
+
+// normalizedPts returns sorted frame PTS-es shifted to start from 0.
+func normalizedPts(fs []FrameStat) []float64 {
+	pts := make([]float64, 0, len(fs))
+	for _, v := range fs {
+		pts = append(pts, v.PtsTime)
+	}
+	// There is no guarantee that PTS-es are in increasing order.
+	sort.Float64s(pts)
+	for i := len(pts) - 1; i >= 0; i-- {
+		pts[i] -= pts[0]
+	}
+	return pts
+}
+
+// nearestIndex returns index of value in sorted values nearest to v.
+func nearestIndex(values []float64, v float64) int {
+	i := sort.SearchFloat64s(values, v)
+	if i == len(values) {
+		return i - 1
+	}
+	if i > 0 && math.Abs(values[i-1]-v) <= math.Abs(values[i]-v) {
+		return i - 1
+	}
+	return i
+}
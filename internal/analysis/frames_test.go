@@ -0,0 +1,107 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// framesAt is a helper to create FrameStats with given PTS-es.
+func framesAt(pts ...float64) []FrameStat {
+	fs := make([]FrameStat, len(pts))
+	for i, v := range pts {
+		fs[i].PtsTime = v
+	}
+	return fs
+}
+
+func Test_CompareFrameTiming(t *testing.T) {
+	tests := map[string]struct {
+		givenSource     []FrameStat
+		givenCompressed []FrameStat
+		want            FrameTimingDiff
+	}{
+		"Identical timing": {
+			givenSource:     framesAt(0, 0.04, 0.08, 0.12),
+			givenCompressed: framesAt(0, 0.04, 0.08, 0.12),
+			want:            FrameTimingDiff{},
+		},
+		"Shifted and unordered PTS": {
+			givenSource:     framesAt(1.0, 1.04, 1.08, 1.12),
+			givenCompressed: framesAt(0.08, 0, 0.12, 0.04),
+			want:            FrameTimingDiff{},
+		},
+		"Dropped frames": {
+			givenSource:     framesAt(0, 0.04, 0.08, 0.12, 0.16),
+			givenCompressed: framesAt(0, 0.08, 0.16),
+			want:            FrameTimingDiff{Dropped: 2},
+		},
+		"Duplicated frames": {
+			givenSource:     framesAt(0, 0.04, 0.08),
+			givenCompressed: framesAt(0, 0.02, 0.04, 0.06, 0.08),
+			want:            FrameTimingDiff{Duplicated: 2},
+		},
+		"Empty source": {
+			givenCompressed: framesAt(0, 0.04),
+			want:            FrameTimingDiff{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := CompareFrameTiming(tc.givenSource, tc.givenCompressed)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("CompareFrameTiming() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_FramesDuration(t *testing.T) {
+	tests := map[string]struct {
+		given []FrameStat
+		want  float64
+	}{
+		"Empty": {
+			want: 0,
+		},
+		"Single frame": {
+			given: []FrameStat{{PtsTime: 0, DurationTime: 0.04}},
+			want:  0.04,
+		},
+		"With frame duration": {
+			given: []FrameStat{
+				{PtsTime: 0, DurationTime: 0.04},
+				{PtsTime: 0.04, DurationTime: 0.04},
+				{PtsTime: 0.08, DurationTime: 0.04},
+			},
+			want: 0.12,
+		},
+		"Without frame duration": {
+			given: framesAt(0, 0.04, 0.08, 0.12),
+			want:  0.16,
+		},
+		"Non-zero start and unordered PTS": {
+			given: framesAt(10.08, 10, 10.12, 10.04),
+			want:  0.16,
+		},
+		"Negative start PTS": {
+			given: framesAt(-0.08, -0.04, 0, 0.04),
+			want:  0.16,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := FramesDuration(tc.given)
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("FramesDuration() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Frame type (I/P/B) distribution statistics.
+
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"runtime"
+	"sort"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/tools"
+)
+
+// FrameType is picture type and size of a single decoded frame.
+type FrameType struct {
+	// PictType is picture type as reported by ffprobe (I, P, B, ...)
+	PictType string `json:"pict_type"`
+	Size     uint64 `json:"pkt_size,string"`
+}
+
+// GetFrameTypes gets picture types and sizes of frames in presentation order
+// using ffprobe.
+//
+// Unlike GetFrameStats this requires decoding video, since picture type is not
+// known on packet level, so it is considerably slower.
+func GetFrameTypes(videoFile string) ([]FrameType, error) {
+	ffprobeArgs := []string{
+		"-threads", fmt.Sprint(runtime.NumCPU()),
+		"-select_streams", "v:0",
+		"-show_entries", "frame=pict_type,pkt_size",
+		"-of", "json=compact=1",
+		videoFile,
+	}
+	c, err := tools.FfprobePath()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(c, ffprobeArgs...) //#nosec G204
+	logging.Debugf("Running: %s\n", cmd)
+	release := tools.AcquireProcess()
+	out, err := cmd.Output()
+	release()
+	if err != nil {
+		return nil, err
+	}
+
+	frames := &struct {
+		Frames []FrameType
+	}{}
+	if err := json.Unmarshal(out, &frames); err != nil {
+		return nil, err
+	}
+
+	return frames.Frames, nil
+}
+
+// FrameTypeStat is statistics of single frame type.
+type FrameTypeStat struct {
+	PictType string
+	Count    int
+	// Percent of all frames
+	Percent float64
+	// AvgSize is average frame size in bytes
+	AvgSize float64
+}
+
+// FrameTypeStats is frame type distribution statistics, which characterize GOP
+// structure.
+type FrameTypeStats struct {
+	Frames int
+	// Per frame type stats, ordered I, P, B followed by other types
+	Types []FrameTypeStat
+	// I-frame interval (distance in frames between consecutive I-frames)
+	// stats, zero for less than two I-frames. Consistent GOP structure has
+	// zero standard deviation.
+	IntervalMean   float64
+	IntervalMin    int
+	IntervalMax    int
+	IntervalStdDev float64
+}
+
+// frameTypeOrder is sort order of well known picture types.
+var frameTypeOrder = map[string]int{"I": 0, "P": 1, "B": 2}
+
+// NewFrameTypeStats calculates frame type distribution statistics.
+func NewFrameTypeStats(frames []FrameType) FrameTypeStats {
+	s := FrameTypeStats{Frames: len(frames)}
+	if len(frames) == 0 {
+		return s
+	}
+
+	byType := make(map[string]*FrameTypeStat)
+	sizes := make(map[string]uint64)
+	var intervals []int
+	lastI := -1
+	for i, f := range frames {
+		t, ok := byType[f.PictType]
+		if !ok {
+			t = &FrameTypeStat{PictType: f.PictType}
+			byType[f.PictType] = t
+		}
+		t.Count++
+		sizes[f.PictType] += f.Size
+		if f.PictType == "I" {
+			if lastI >= 0 {
+				intervals = append(intervals, i-lastI)
+			}
+			lastI = i
+		}
+	}
+
+	for pt, t := range byType {
+		t.Percent = float64(t.Count) / float64(len(frames)) * 100
+		t.AvgSize = float64(sizes[pt]) / float64(t.Count)
+		s.Types = append(s.Types, *t)
+	}
+	sort.Slice(s.Types, func(i, j int) bool {
+		oi, iKnown := frameTypeOrder[s.Types[i].PictType]
+		oj, jKnown := frameTypeOrder[s.Types[j].PictType]
+		switch {
+		case iKnown && jKnown:
+			return oi < oj
+		case iKnown != jKnown:
+			return iKnown
+		}
+		return s.Types[i].PictType < s.Types[j].PictType
+	})
+
+	if len(intervals) == 0 {
+		return s
+	}
+	var sum float64
+	s.IntervalMin, s.IntervalMax = intervals[0], intervals[0]
+	for _, v := range intervals {
+		sum += float64(v)
+		if v < s.IntervalMin {
+			s.IntervalMin = v
+		}
+		if v > s.IntervalMax {
+			s.IntervalMax = v
+		}
+	}
+	s.IntervalMean = sum / float64(len(intervals))
+	var sqSum float64
+	for _, v := range intervals {
+		sqSum += math.Pow(float64(v)-s.IntervalMean, 2)
+	}
+	s.IntervalStdDev = math.Sqrt(sqSum / float64(len(intervals)))
+
+	return s
+}
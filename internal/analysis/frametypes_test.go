@@ -0,0 +1,73 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func Test_NewFrameTypeStats(t *testing.T) {
+	// Frame types given as string, all frames of same type have same size.
+	frames := func(types string) []FrameType {
+		sizes := map[byte]uint64{'I': 1000, 'P': 300, 'B': 100, 'S': 50}
+		fs := make([]FrameType, len(types))
+		for i := range types {
+			fs[i] = FrameType{PictType: string(types[i]), Size: sizes[types[i]]}
+		}
+		return fs
+	}
+	tests := map[string]struct {
+		given []FrameType
+		want  FrameTypeStats
+	}{
+		"Empty": {},
+		"Fixed GOP": {
+			given: frames("IBBPIBBPIBBP"),
+			want: FrameTypeStats{
+				Frames: 12,
+				Types: []FrameTypeStat{
+					{PictType: "I", Count: 3, Percent: 25, AvgSize: 1000},
+					{PictType: "P", Count: 3, Percent: 25, AvgSize: 300},
+					{PictType: "B", Count: 6, Percent: 50, AvgSize: 100},
+				},
+				IntervalMean: 4, IntervalMin: 4, IntervalMax: 4,
+			},
+		},
+		"Variable GOP and unusual type": {
+			given: frames("IPPIPPPPISP"),
+			want: FrameTypeStats{
+				Frames: 11,
+				Types: []FrameTypeStat{
+					{PictType: "I", Count: 3, Percent: 300.0 / 11, AvgSize: 1000},
+					{PictType: "P", Count: 7, Percent: 700.0 / 11, AvgSize: 300},
+					{PictType: "S", Count: 1, Percent: 100.0 / 11, AvgSize: 50},
+				},
+				IntervalMean: 4, IntervalMin: 3, IntervalMax: 5, IntervalStdDev: 1,
+			},
+		},
+		"Single I-frame": {
+			given: frames("IPP"),
+			want: FrameTypeStats{
+				Frames: 3,
+				Types: []FrameTypeStat{
+					{PictType: "I", Count: 1, Percent: 100.0 / 3, AvgSize: 1000},
+					{PictType: "P", Count: 2, Percent: 200.0 / 3, AvgSize: 300},
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := NewFrameTypeStats(tc.given)
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
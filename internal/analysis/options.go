@@ -0,0 +1,368 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Optional plot parameters.
+
+package analysis
+
+import (
+	"fmt"
+	"image/png"
+	"math"
+	"strings"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+)
+
+// Legend positions.
+const (
+	LegendTop    = "top"
+	LegendBottom = "bottom"
+	LegendNone   = "none"
+)
+
+// IsLegendPosition reports whether pos is a valid legend position.
+func IsLegendPosition(pos string) bool {
+	switch pos {
+	case LegendTop, LegendBottom, LegendNone:
+		return true
+	}
+	return false
+}
+
+// Units of bitrate (Kbps, Mbps) and frame size (KB, MB) plots.
+const (
+	UnitsAuto = "auto"
+	UnitsKilo = "kilo"
+	UnitsMega = "mega"
+)
+
+// IsUnits reports whether u is a valid units value.
+func IsUnits(u string) bool {
+	switch u {
+	case UnitsAuto, UnitsKilo, UnitsMega:
+		return true
+	}
+	return false
+}
+
+// PNG compression levels of written plot images.
+const (
+	PNGCompressionDefault = "default"
+	PNGCompressionNone    = "none"
+	PNGCompressionSpeed   = "speed"
+	PNGCompressionBest    = "best"
+)
+
+// IsPNGCompression reports whether c is a valid PNG compression level.
+func IsPNGCompression(c string) bool {
+	switch c {
+	case PNGCompressionDefault, PNGCompressionNone, PNGCompressionSpeed, PNGCompressionBest:
+		return true
+	}
+	return false
+}
+
+// autoMegaThreshold is a value (in kilo units) from which UnitsAuto switches
+// to mega units.
+const autoMegaThreshold = 10000
+
+// PlotOption configures optional plot parameters.
+type PlotOption func(*plotOptions)
+
+// plotOptions holds optional plot parameters.
+type plotOptions struct {
+	// Fixed Y axis range for per-frame VQM plot, NaN means auto-scale.
+	yMin float64
+	yMax float64
+	// X positions (frame numbers) of vertical markers on per-frame VQM plot.
+	markers []float64
+	// Legend position, empty means plot's default.
+	legend string
+	// Legend offsets in points, NaN means plot's default.
+	legendXOffs float64
+	legendYOffs float64
+	// Units of bitrate and frame size plots, empty means UnitsAuto.
+	units string
+	// X axis tick interval in seconds of bitrate and frame size plots, 0
+	// means gonum's default ticker.
+	tickInterval float64
+	// Bitrate computation mode, empty means BitrateModeSecond.
+	bitrateMode string
+	// Jitter annotated on per-frame VQM plot, NaN means no annotation.
+	jitter float64
+	// Tile layout of multi-plots, 0 means subplots stacked in a column.
+	layoutRows int
+	layoutCols int
+	// Color theme, empty means ThemeLight.
+	themeName string
+	// PNG compression level, empty means PNGCompressionDefault.
+	pngCompression string
+	// Leaky bucket size (in Kbits) of cumulative bits plot, 0 means one
+	// second at target rate.
+	bufferSize float64
+	// Logarithmic Y axis of bitrate plot.
+	logScale bool
+	// Font family (builtin or registered typeface), empty means FontSerif.
+	fontFamily string
+	// Font sizes in points of title, axis labels (and legend) and tick
+	// labels, 0 means gonum's default.
+	titleSize float64
+	labelSize float64
+	tickSize  float64
+	// Colors overriding theme's colors.
+	colors Colors
+}
+
+// WithYMin sets fixed lower bound of Y axis for per-frame VQM plot.
+func WithYMin(v float64) PlotOption {
+	return func(o *plotOptions) {
+		o.yMin = v
+	}
+}
+
+// WithYMax sets fixed upper bound of Y axis for per-frame VQM plot.
+func WithYMax(v float64) PlotOption {
+	return func(o *plotOptions) {
+		o.yMax = v
+	}
+}
+
+// WithMarkers adds vertical markers at given frame numbers to per-frame VQM
+// plot (e.g. scene cuts).
+func WithMarkers(frames []float64) PlotOption {
+	return func(o *plotOptions) {
+		o.markers = append(o.markers, frames...)
+	}
+}
+
+// WithLegend sets legend position (one of LegendTop, LegendBottom or
+// LegendNone to hide legend).
+func WithLegend(pos string) PlotOption {
+	return func(o *plotOptions) {
+		o.legend = pos
+	}
+}
+
+// WithLegendOffset sets legend offset (in points) from it's position.
+func WithLegendOffset(x, y float64) PlotOption {
+	return func(o *plotOptions) {
+		o.legendXOffs, o.legendYOffs = x, y
+	}
+}
+
+// WithUnits sets units of bitrate and frame size plots (one of UnitsAuto,
+// UnitsKilo or UnitsMega). UnitsAuto picks mega units for large values (e.g.
+// high bitrate 4K content).
+func WithUnits(u string) PlotOption {
+	return func(o *plotOptions) {
+		o.units = u
+	}
+}
+
+// WithTickInterval sets X axis tick interval (in seconds) of bitrate and frame
+// size plots. By default tick positions are picked by gonum's default ticker
+// based on video duration.
+func WithTickInterval(seconds float64) PlotOption {
+	return func(o *plotOptions) {
+		o.tickInterval = seconds
+	}
+}
+
+// WithBitrateMode sets bitrate computation mode of bitrate plot (one of
+// BitrateModeSecond, BitrateModeGOP or BitrateModeWindow).
+func WithBitrateMode(m string) PlotOption {
+	return func(o *plotOptions) {
+		o.bitrateMode = m
+	}
+}
+
+// WithJitter annotates per-frame VQM plot with given jitter (mean absolute
+// difference between consecutive per frame values).
+func WithJitter(jitter float64) PlotOption {
+	return func(o *plotOptions) {
+		o.jitter = jitter
+	}
+}
+
+// WithLayout sets tile layout (rows by columns) of multi-plots, subplots are
+// placed row by row. By default subplots are stacked in a single column.
+func WithLayout(rows, cols int) PlotOption {
+	return func(o *plotOptions) {
+		o.layoutRows, o.layoutCols = rows, cols
+	}
+}
+
+// WithTheme sets color theme of plots (one of ThemeLight or ThemeDark), e.g.
+// dark theme for dark-mode dashboards and slides.
+func WithTheme(t string) PlotOption {
+	return func(o *plotOptions) {
+		o.themeName = t
+	}
+}
+
+// WithPNGCompression sets compression level of written PNG images (one of
+// PNGCompressionDefault, PNGCompressionNone, PNGCompressionSpeed or
+// PNGCompressionBest), e.g. best compression trades CPU for smaller files.
+func WithPNGCompression(c string) PlotOption {
+	return func(o *plotOptions) {
+		o.pngCompression = c
+	}
+}
+
+// WithBufferSize sets leaky bucket size (in Kbits) of cumulative bits plot,
+// by default it is one second at target rate.
+func WithBufferSize(kbits float64) PlotOption {
+	return func(o *plotOptions) {
+		o.bufferSize = kbits
+	}
+}
+
+// WithLogScale enables logarithmic Y axis of bitrate plot, e.g. for content
+// where bitrate peaks dwarf the baseline.
+func WithLogScale(on bool) PlotOption {
+	return func(o *plotOptions) {
+		o.logScale = on
+	}
+}
+
+// WithFont sets font family of plot text, one of builtin families (FontSerif,
+// FontSans or FontMono) or typeface registered via RegisterFont.
+func WithFont(family string) PlotOption {
+	return func(o *plotOptions) {
+		o.fontFamily = family
+	}
+}
+
+// WithFontSizes sets font sizes (in points) of plot title, axis labels (and
+// legend) and tick labels, 0 keeps default size.
+func WithFontSizes(title, label, tick float64) PlotOption {
+	return func(o *plotOptions) {
+		o.titleSize, o.labelSize, o.tickSize = title, label, tick
+	}
+}
+
+// WithColors overrides colors of theme set via WithTheme, e.g. for branding.
+func WithColors(c Colors) PlotOption {
+	return func(o *plotOptions) {
+		o.colors = c
+	}
+}
+
+// pngCompressionLevel returns png.CompressionLevel according to PNG
+// compression option.
+func (o *plotOptions) pngCompressionLevel() png.CompressionLevel {
+	switch o.pngCompression {
+	case PNGCompressionNone:
+		return png.NoCompression
+	case PNGCompressionSpeed:
+		return png.BestSpeed
+	case PNGCompressionBest:
+		return png.BestCompression
+	}
+	return png.DefaultCompression
+}
+
+// tile will place subplots into rows by columns grid according to layout
+// option, empty tiles are nil.
+func (o *plotOptions) tile(subplots []*plot.Plot) ([][]*plot.Plot, error) {
+	rows, cols := o.layoutRows, o.layoutCols
+	if rows <= 0 || cols <= 0 {
+		rows, cols = len(subplots), 1
+	}
+	if rows*cols < len(subplots) {
+		return nil, fmt.Errorf("layout %dx%d too small for %d plots", rows, cols, len(subplots))
+	}
+	plots := make([][]*plot.Plot, rows)
+	for i := range plots {
+		plots[i] = make([]*plot.Plot, cols)
+	}
+	for i, p := range subplots {
+		plots[i/cols][i%cols] = p
+	}
+	return plots, nil
+}
+
+// timeTicker returns X axis ticker for bitrate and frame size plots according
+// to tick interval option.
+func (o *plotOptions) timeTicker() plot.Ticker {
+	if o.tickInterval <= 0 {
+		return plot.DefaultTicks{}
+	}
+	interval := o.tickInterval
+	return plot.TickerFunc(func(min, max float64) []plot.Tick {
+		var t []plot.Tick
+		for x := min; x <= max; x += interval {
+			t = append(t, plot.Tick{
+				Value: x,
+				Label: fmt.Sprintf("%.1f", x),
+			})
+		}
+		return t
+	})
+}
+
+// unitScale returns divisor and SI prefix to convert values in kilo units
+// according to units option, max is the largest plotted value.
+func (o *plotOptions) unitScale(max float64) (div float64, prefix string) {
+	switch o.units {
+	case UnitsMega:
+		return 1000, "M"
+	case UnitsKilo:
+		return 1, "K"
+	}
+	if max >= autoMegaThreshold {
+		return 1000, "M"
+	}
+	return 1, "K"
+}
+
+// setupLegend will position plot's legend according to options, defaultPos
+// is used in case position is not set via options. Returns false in case
+// legend is hidden, so no entries should be added.
+func (o *plotOptions) setupLegend(p *plot.Plot, defaultPos string) bool {
+	pos := o.legend
+	if pos == "" {
+		pos = defaultPos
+	}
+	if pos == LegendNone {
+		return false
+	}
+	p.Legend.Top = pos == LegendTop
+	if !math.IsNaN(o.legendXOffs) {
+		p.Legend.XOffs = vg.Points(o.legendXOffs)
+	}
+	if !math.IsNaN(o.legendYOffs) {
+		p.Legend.YOffs = vg.Points(o.legendYOffs)
+	}
+	return true
+}
+
+// newPlotOptions creates plotOptions with metric specific defaults and applies opts.
+func newPlotOptions(metric string, opts ...PlotOption) plotOptions {
+	var o plotOptions
+	o.yMin, o.yMax = DefaultYRange(metric)
+	o.legendXOffs, o.legendYOffs = math.NaN(), math.NaN()
+	o.jitter = math.NaN()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// DefaultYRange returns default Y axis range for given metric.
+//
+// VMAF and MS-SSIM have well known bounds, for other metrics (e.g. PSNR) NaN is
+// returned which means Y axis will be auto-scaled.
+func DefaultYRange(metric string) (min, max float64) {
+	switch strings.ToUpper(metric) {
+	case "VMAF":
+		return 0, 100
+	case "MS-SSIM", "MS_SSIM", "SSIM":
+		return 0, 1
+	default:
+		return math.NaN(), math.NaN()
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+)
+
+func Test_newPlotOptions(t *testing.T) {
+	nan := math.NaN()
+	tests := map[string]struct {
+		metric   string
+		opts     []PlotOption
+		wantYMin float64
+		wantYMax float64
+	}{
+		"VMAF defaults":    {metric: "VMAF", wantYMin: 0, wantYMax: 100},
+		"MS-SSIM defaults": {metric: "MS-SSIM", wantYMin: 0, wantYMax: 1},
+		"PSNR defaults":    {metric: "PSNR", wantYMin: nan, wantYMax: nan},
+		"VMAF override min": {
+			metric:   "VMAF",
+			opts:     []PlotOption{WithYMin(60)},
+			wantYMin: 60,
+			wantYMax: 100,
+		},
+		"PSNR override both": {
+			metric:   "PSNR",
+			opts:     []PlotOption{WithYMin(20), WithYMax(60)},
+			wantYMin: 20,
+			wantYMax: 60,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := newPlotOptions(tc.metric, tc.opts...)
+			if diff := cmp.Diff(tc.wantYMin, got.yMin, cmpopts.EquateNaNs()); diff != "" {
+				t.Errorf("yMin mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantYMax, got.yMax, cmpopts.EquateNaNs()); diff != "" {
+				t.Errorf("yMax mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_WithMarkers(t *testing.T) {
+	got := newPlotOptions("VMAF", WithMarkers([]float64{10, 20}), WithMarkers([]float64{30}))
+	if diff := cmp.Diff([]float64{10, 20, 30}, got.markers); diff != "" {
+		t.Errorf("markers mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_plotOptions_setupLegend(t *testing.T) {
+	tests := map[string]struct {
+		opts        []PlotOption
+		defaultPos  string
+		wantVisible bool
+		wantTop     bool
+		wantXOffs   vg.Length
+	}{
+		"Default top":    {defaultPos: LegendTop, wantVisible: true, wantTop: true},
+		"Default hidden": {defaultPos: LegendNone, wantVisible: false},
+		"Override bottom": {
+			opts:        []PlotOption{WithLegend(LegendBottom)},
+			defaultPos:  LegendTop,
+			wantVisible: true,
+			wantTop:     false,
+		},
+		"Override hidden": {
+			opts:        []PlotOption{WithLegend(LegendNone)},
+			defaultPos:  LegendTop,
+			wantVisible: false,
+		},
+		"Override offset": {
+			opts:        []PlotOption{WithLegend(LegendTop), WithLegendOffset(5, 5)},
+			defaultPos:  LegendNone,
+			wantVisible: true,
+			wantTop:     true,
+			wantXOffs:   vg.Points(5),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := newPlotOptions("", tc.opts...)
+			p := plot.New()
+			gotVisible := o.setupLegend(p, tc.defaultPos)
+			if diff := cmp.Diff(tc.wantVisible, gotVisible); diff != "" {
+				t.Fatalf("Visibility mismatch (-want +got):\n%s", diff)
+			}
+			if !gotVisible {
+				return
+			}
+			if diff := cmp.Diff(tc.wantTop, p.Legend.Top); diff != "" {
+				t.Errorf("Legend.Top mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantXOffs, p.Legend.XOffs); diff != "" {
+				t.Errorf("Legend.XOffs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_IsLegendPosition(t *testing.T) {
+	for _, v := range []string{LegendTop, LegendBottom, LegendNone} {
+		if !IsLegendPosition(v) {
+			t.Errorf("Expected %q to be valid legend position", v)
+		}
+	}
+	if IsLegendPosition("left") {
+		t.Error("Expected \"left\" to be invalid legend position")
+	}
+}
+
+func Test_plotOptions_pngCompressionLevel(t *testing.T) {
+	tests := map[string]png.CompressionLevel{
+		"":                    png.DefaultCompression,
+		PNGCompressionDefault: png.DefaultCompression,
+		PNGCompressionNone:    png.NoCompression,
+		PNGCompressionSpeed:   png.BestSpeed,
+		PNGCompressionBest:    png.BestCompression,
+	}
+	for given, want := range tests {
+		t.Run(given, func(t *testing.T) {
+			o := newPlotOptions("", WithPNGCompression(given))
+			if diff := cmp.Diff(want, o.pngCompressionLevel()); diff != "" {
+				t.Errorf("Compression level mismatch (-want +got):\n%s", diff)
+			}
+			if given != "" && !IsPNGCompression(given) {
+				t.Errorf("Expected %q to be valid PNG compression", given)
+			}
+		})
+	}
+	if IsPNGCompression("max") {
+		t.Error("Expected \"max\" to be invalid PNG compression")
+	}
+}
+
+func Test_plotOptions_unitScale(t *testing.T) {
+	tests := map[string]struct {
+		givenOpts  []PlotOption
+		givenMax   float64
+		wantDiv    float64
+		wantPrefix string
+	}{
+		"Auto small values": {
+			givenMax:   5000,
+			wantDiv:    1,
+			wantPrefix: "K",
+		},
+		"Auto large values": {
+			givenMax:   25000,
+			wantDiv:    1000,
+			wantPrefix: "M",
+		},
+		"Forced kilo": {
+			givenOpts:  []PlotOption{WithUnits(UnitsKilo)},
+			givenMax:   25000,
+			wantDiv:    1,
+			wantPrefix: "K",
+		},
+		"Forced mega": {
+			givenOpts:  []PlotOption{WithUnits(UnitsMega)},
+			givenMax:   500,
+			wantDiv:    1000,
+			wantPrefix: "M",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := newPlotOptions("", tc.givenOpts...)
+			gotDiv, gotPrefix := o.unitScale(tc.givenMax)
+			if diff := cmp.Diff(tc.wantDiv, gotDiv); diff != "" {
+				t.Errorf("Divisor mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantPrefix, gotPrefix); diff != "" {
+				t.Errorf("Prefix mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_plotOptions_timeTicker(t *testing.T) {
+	t.Run("Default ticker when unset", func(t *testing.T) {
+		o := newPlotOptions("")
+		if diff := cmp.Diff(plot.DefaultTicks{}, o.timeTicker()); diff != "" {
+			t.Errorf("Ticker mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Fixed interval", func(t *testing.T) {
+		o := newPlotOptions("", WithTickInterval(2))
+		var got []float64
+		for _, tick := range o.timeTicker().Ticks(0, 5) {
+			got = append(got, tick.Value)
+		}
+		if diff := cmp.Diff([]float64{0, 2, 4}, got); diff != "" {
+			t.Errorf("Ticks mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func Test_plotOptions_tile(t *testing.T) {
+	a, b, c := plot.New(), plot.New(), plot.New()
+	tests := map[string]struct {
+		opts []PlotOption
+		want [][]*plot.Plot
+	}{
+		"Default column":  {want: [][]*plot.Plot{{a}, {b}, {c}}},
+		"Single row":      {opts: []PlotOption{WithLayout(1, 3)}, want: [][]*plot.Plot{{a, b, c}}},
+		"Grid with empty": {opts: []PlotOption{WithLayout(2, 2)}, want: [][]*plot.Plot{{a, b}, {c, nil}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := newPlotOptions("", tc.opts...)
+			got, err := o.tile([]*plot.Plot{a, b, c})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// Compare plot identity, not content.
+			if len(got) != len(tc.want) {
+				t.Fatalf("Rows mismatch, want %d got %d", len(tc.want), len(got))
+			}
+			for i := range tc.want {
+				for j := range tc.want[i] {
+					if got[i][j] != tc.want[i][j] {
+						t.Errorf("Tile [%d][%d] mismatch", i, j)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("Layout too small", func(t *testing.T) {
+		o := newPlotOptions("", WithLayout(1, 2))
+		if _, err := o.tile([]*plot.Plot{a, b, c}); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
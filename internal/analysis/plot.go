@@ -7,10 +7,13 @@
 package analysis
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"image/color"
+	"image/png"
+	"io"
 	"log"
 	"math"
 	"os"
@@ -18,8 +21,10 @@ import (
 	"path"
 	"runtime"
 	"sort"
+	"sync"
 
 	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/perm"
 	"github.com/evolution-gaming/ease/internal/tools"
 	"gonum.org/v1/gonum/stat"
 	"gonum.org/v1/plot"
@@ -63,12 +68,73 @@ var ColorPalette = []color.RGBA{
 }
 
 // CreateCDFPlot creates Cumulative Distribution Function plot for given VQM values.
-func CreateCDFPlot(values []float64, name string) (*plot.Plot, error) {
-	p := plot.New()
+func CreateCDFPlot(values []float64, name string, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions(name, opts...)
+	th := o.theme()
+	p := o.newPlot()
 	p.X.Label.Text = name
 	p.Y.Label.Text = "Probability"
 	p.Y.Min = 0
 
+	cdfValues, lValues := cdfXYs(values)
+	cdfLine, err := plotter.NewLine(cdfValues)
+	if err != nil {
+		return p, fmt.Errorf("CreateCDFPlot() creating new Line: %w", err)
+	}
+	cdfLine.Color = th.palette[2]
+
+	p.Add(cdfLine, th.newGrid())
+	p.Add(createQuantileLines(p, th, lValues, 0.01, 0.05, 0.5, 0.95)...)
+
+	return p, nil
+}
+
+// CreateMultiCDFPlot creates Cumulative Distribution Function plot with a line
+// for each series (e.g. VMAF values of an encoding scheme) overlaid, so that
+// quality distributions can be compared.
+func CreateMultiCDFPlot(series map[string][]float64, name string, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions(name, opts...)
+	th := o.theme()
+	p := o.newPlot()
+	p.X.Label.Text = name
+	p.Y.Label.Text = "Probability"
+	p.Y.Min = 0
+
+	if len(series) == 0 {
+		return p, errors.New("CreateMultiCDFPlot() no series to plot")
+	}
+
+	// Iterate series in stable order, so that colors do not change between
+	// runs.
+	names := make([]string, 0, len(series))
+	for n := range series {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	p.Add(th.newGrid())
+	p.Legend.Left = true
+	showLegend := o.setupLegend(p, LegendBottom)
+	for i, n := range names {
+		cdfValues, _ := cdfXYs(series[n])
+		cdfLine, err := plotter.NewLine(cdfValues)
+		if err != nil {
+			return p, fmt.Errorf("CreateMultiCDFPlot() creating new Line for %s: %w", n, err)
+		}
+		// Use only base colors from palette.
+		cdfLine.Color = th.palette[(2*i)%len(th.palette)]
+		p.Add(cdfLine)
+		if showLegend {
+			p.Legend.Add(n, cdfLine)
+		}
+	}
+
+	return p, nil
+}
+
+// cdfXYs returns empirical CDF points of values along with sorted copy of
+// values.
+func cdfXYs(values []float64) (plotter.XYs, []float64) {
 	// We are going to mutate values slice, so make a copy to avoid mangling
 	// underlying array and creating unexpected sideffect in caller's scope.
 	lValues := make([]float64, len(values))
@@ -83,22 +149,42 @@ func CreateCDFPlot(values []float64, name string) (*plot.Plot, error) {
 		cdfValues[i].X = v
 		cdfValues[i].Y = stat.CDF(v, stat.Empirical, lValues, nil)
 	}
+	return cdfValues, lValues
+}
 
-	cdfLine, err := plotter.NewLine(cdfValues)
+// SaveMultiCDFPlot will create overlaid CDF plot of series and save it to a file.
+func SaveMultiCDFPlot(series map[string][]float64, name, title, outFile string, opts ...PlotOption) error {
+	w, err := perm.Create(outFile)
 	if err != nil {
-		return p, fmt.Errorf("CreateCDFPlot() creating new Line: %w", err)
+		return fmt.Errorf("SaveMultiCDFPlot() error from perm.Create(): %w", err)
 	}
-	cdfLine.Color = ColorPalette[2]
+	defer w.Close()
 
-	p.Add(cdfLine, plotter.NewGrid())
-	p.Add(createQuantileLines(p, lValues, 0.01, 0.05, 0.5, 0.95)...)
+	return WriteMultiCDFPlot(w, series, name, title, opts...)
+}
 
-	return p, nil
+// WriteMultiCDFPlot will create overlaid CDF plot of series and write it as
+// PNG to w.
+func WriteMultiCDFPlot(w io.Writer, series map[string][]float64, name, title string, opts ...PlotOption) error {
+	p, err := CreateMultiCDFPlot(series, name, opts...)
+	if err != nil {
+		return fmt.Errorf("WriteMultiCDFPlot() %w", err)
+	}
+	p.Title.Text = title
+
+	plots := [][]*plot.Plot{{p}}
+	if err := writeMultiPlot(w, plots, defaultPlotWidth, defaultPlotHeight*3, opts...); err != nil {
+		return fmt.Errorf("WriteMultiCDFPlot() %w", err)
+	}
+
+	return nil
 }
 
 // CreateHistogramPlot creates histogram plot for given VQM values.
-func CreateHistogramPlot(values []float64, name string) (*plot.Plot, error) {
-	p := plot.New()
+func CreateHistogramPlot(values []float64, name string, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions(name, opts...)
+	th := o.theme()
+	p := o.newPlot()
 	p.X.Label.Text = name
 	p.Y.Label.Text = "N"
 
@@ -118,10 +204,10 @@ func CreateHistogramPlot(values []float64, name string) (*plot.Plot, error) {
 		return p, fmt.Errorf("CreateHistogramPlot() creating new histogram: %w", err)
 	}
 	pHist.Color = color.Transparent
-	pHist.FillColor = ColorPalette[7]
+	pHist.FillColor = th.palette[7]
 
 	p.Add(pHist)
-	p.Add(plotter.NewGrid())
+	p.Add(th.newGrid())
 
 	return p, nil
 }
@@ -129,9 +215,12 @@ func CreateHistogramPlot(values []float64, name string) (*plot.Plot, error) {
 // CreateVqmPlot creates a plot for given VQM values.
 //
 // Since values are specified as a 1D slice - it is assumed that index into
-// slice is a frame number.
-func CreateVqmPlot(values []float64, name string) (*plot.Plot, error) {
-	p := plot.New()
+// slice is a frame number. By default plot has no legend, this can be changed
+// via WithLegend option.
+func CreateVqmPlot(values []float64, name string, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions(name, opts...)
+	th := o.theme()
+	p := o.newPlot()
 	p.X.Label.Text = "Frame #"
 	p.Y.Label.Text = name
 
@@ -146,82 +235,194 @@ func CreateVqmPlot(values []float64, name string) (*plot.Plot, error) {
 		return p, fmt.Errorf("CreateVqmPlot() creating new histogram: %w", err)
 	}
 
-	vqmLine.Color = ColorPalette[0]
+	vqmLine.Color = th.palette[0]
 
 	p.Add(vqmLine)
-	p.Add(plotter.NewGrid())
+	if o.setupLegend(p, LegendNone) {
+		p.Legend.Add(name, vqmLine)
+	}
+	p.Add(th.newGrid())
 
 	return p, nil
 }
 
-// MultiPlotVqm will create VQM metric multi plot and save it to a file.
+// CreateDeltaVqmPlot creates a per-frame plot of difference between VQM values
+// of two encodes (a minus b).
 //
-// Resulting plot will include the provided VQM metric plot, it's histogram plot
-// and CDF plot all in one canvas.
-func MultiPlotVqm(values []float64, metric, title, outFile string) (err error) {
-	// Create a 2D slice to hold subplots. This is the sad state of gonum's API
-	// at this point unfortunately.
-	const rows, cols = 3, 1
-	plots := make([][]*plot.Plot, rows)
-	for i := range plots {
-		plots[i] = make([]*plot.Plot, cols)
+// Values are aligned on frame index, in case of different lengths only frames
+// present in both are plotted. Regions where a is better (positive delta) and
+// where b is better (negative delta) are shaded in different colors.
+func CreateDeltaVqmPlot(a, b []float64, metric string, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions(metric, opts...)
+	th := o.theme()
+	p := o.newPlot()
+	p.X.Label.Text = "Frame #"
+	p.Y.Label.Text = "Δ " + metric
+
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if n == 0 {
+		return p, errors.New("CreateDeltaVqmPlot() no common frames")
+	}
+
+	deltaXY := make(plotter.XYs, n)
+	// Shaded regions are polygons closed on zero line.
+	posXY := make(plotter.XYs, 0, n+2)
+	negXY := make(plotter.XYs, 0, n+2)
+	posXY = append(posXY, plotter.XY{X: 0, Y: 0})
+	negXY = append(negXY, plotter.XY{X: 0, Y: 0})
+	for i := 0; i < n; i++ {
+		d := a[i] - b[i]
+		deltaXY[i].X = float64(i)
+		deltaXY[i].Y = d
+		posXY = append(posXY, plotter.XY{X: float64(i), Y: math.Max(d, 0)})
+		negXY = append(negXY, plotter.XY{X: float64(i), Y: math.Min(d, 0)})
 	}
+	posXY = append(posXY, plotter.XY{X: float64(n - 1), Y: 0})
+	negXY = append(negXY, plotter.XY{X: float64(n - 1), Y: 0})
 
-	plots[0][0], err = CreateVqmPlot(values, metric)
+	deltaLine, err := plotter.NewLine(deltaXY)
 	if err != nil {
-		return err
+		return p, fmt.Errorf("CreateDeltaVqmPlot() creating new Line: %w", err)
 	}
+	deltaLine.Color = th.palette[5]
 
-	plots[1][0], err = CreateHistogramPlot(values, metric)
+	posArea, err := plotter.NewPolygon(posXY)
 	if err != nil {
-		return err
+		return p, fmt.Errorf("CreateDeltaVqmPlot() creating positive area: %w", err)
 	}
+	posArea.Color = color.RGBA{R: 84, G: 184, B: 50, A: 100}
+	posArea.LineStyle.Width = 0
 
-	plots[2][0], err = CreateCDFPlot(values, metric)
+	negArea, err := plotter.NewPolygon(negXY)
 	if err != nil {
-		return err
+		return p, fmt.Errorf("CreateDeltaVqmPlot() creating negative area: %w", err)
 	}
+	negArea.Color = color.RGBA{R: 230, G: 57, B: 70, A: 100}
+	negArea.LineStyle.Width = 0
 
-	// Tweak titles and labels to have better layout and make plots less busy.
-	plots[0][0].Title.Text = title + "\n\nPer frame " + metric
-	plots[1][0].Title.Text = metric + " Histogram"
-	plots[1][0].X.Label.Text = ""
-	plots[2][0].Title.Text = "Cumulative Distribution Function (CDF)"
+	zeroLine := horizontalLine(0, 0, float64(n-1))
+	zeroLine.Color = th.foreground
 
-	img := vgimg.New(defaultPlotWidth, defaultPlotHeight*rows)
-	dc := draw.New(img)
+	p.Add(posArea, negArea, zeroLine, deltaLine, th.newGrid())
 
-	t := draw.Tiles{
-		Rows: rows,
-		Cols: cols,
-		PadY: vg.Points(10),
+	return p, nil
+}
+
+// PlotDeltaVqm will create per-frame VQM delta plot of two encodes and save it
+// to a file.
+func PlotDeltaVqm(a, b []float64, metric, title, outFile string, opts ...PlotOption) error {
+	p, err := CreateDeltaVqmPlot(a, b, metric, opts...)
+	if err != nil {
+		return err
 	}
+	p.Title.Text = title
 
-	canvases := plot.Align(plots, t, dc)
-	for j := 0; j < rows; j++ {
-		for i := 0; i < cols; i++ {
-			if plots[j][i] != nil {
-				plots[j][i].Draw(canvases[j][i])
-			}
-		}
+	w, err := perm.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("PlotDeltaVqm() error from perm.Create(): %w", err)
+	}
+	defer w.Close()
+
+	if err := writeMultiPlot(w, [][]*plot.Plot{{p}}, defaultPlotWidth, defaultPlotHeight*2, opts...); err != nil {
+		return fmt.Errorf("PlotDeltaVqm() %w", err)
 	}
 
-	w, err := os.Create(outFile)
+	return nil
+}
+
+// MultiPlotVqm will create VQM metric multi plot and save it to a file.
+//
+// Resulting plot will include the provided VQM metric plot, it's histogram plot
+// and CDF plot all in one canvas.
+func MultiPlotVqm(values []float64, metric, title, outFile string, opts ...PlotOption) error {
+	w, err := perm.Create(outFile)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("MultiPlotVqm() error from perm.Create(): %w", err)
 	}
 	defer w.Close()
-	png := vgimg.PngCanvas{Canvas: img}
-	if _, err := png.WriteTo(w); err != nil {
-		panic(err)
+
+	return WriteVqmPlot(w, values, metric, title, opts...)
+}
+
+// WriteVqmPlot will create VQM metric multi plot and write it as PNG to w.
+//
+// Resulting plot will include the provided VQM metric plot, it's histogram plot
+// and CDF plot all in one canvas.
+//
+// Per-frame VQM plot's Y axis range is fixed for metrics with well known bounds
+// (see DefaultYRange), this can be overridden via opts.
+func WriteVqmPlot(w io.Writer, values []float64, metric, title string, opts ...PlotOption) (err error) {
+	o := newPlotOptions(metric, opts...)
+
+	// Subplots are independent, so build them concurrently.
+	built, err := buildPlots(
+		func() (*plot.Plot, error) { return CreateVqmPlot(values, metric, opts...) },
+		func() (*plot.Plot, error) { return CreateHistogramPlot(values, metric, opts...) },
+		func() (*plot.Plot, error) { return CreateCDFPlot(values, metric, opts...) },
+	)
+	if err != nil {
+		return err
+	}
+	frames, hist, cdf := built[0], built[1], built[2]
+	if !math.IsNaN(o.yMin) {
+		frames.Y.Min = o.yMin
+	}
+	if !math.IsNaN(o.yMax) {
+		frames.Y.Max = o.yMax
+	}
+	for _, x := range o.markers {
+		mLine := verticalLine(x, frames.Y.Min, frames.Y.Max)
+		mLine.LineStyle.Width = vg.Points(1)
+		mLine.LineStyle.Dashes = []vg.Length{vg.Points(2), vg.Points(2)}
+		mLine.Color = o.theme().palette[9]
+		frames.Add(mLine)
+	}
+
+	// Tweak titles and labels to have better layout and make plots less busy.
+	frames.Title.Text = title + "\n\nPer frame " + metric
+	if !math.IsNaN(o.jitter) {
+		frames.Title.Text += fmt.Sprintf(" (jitter %.2f)", o.jitter)
+	}
+	hist.Title.Text = metric + " Histogram"
+	hist.X.Label.Text = ""
+	cdf.Title.Text = "Cumulative Distribution Function (CDF)"
+
+	// Create a 2D slice to hold subplots. This is the sad state of gonum's API
+	// at this point unfortunately.
+	plots, err := o.tile(built)
+	if err != nil {
+		return fmt.Errorf("WriteVqmPlot() %w", err)
+	}
+	width, height := tiledSize(plots)
+	if err := writeMultiPlot(w, plots, width, height, opts...); err != nil {
+		return fmt.Errorf("WriteVqmPlot() %w", err)
 	}
 
 	return nil
 }
 
 // CreateBitratePlot creates a bitrate plot from given FrameStat slice.
-func CreateBitratePlot(frameStats []FrameStat) (*plot.Plot, error) {
-	p := plot.New()
+//
+// By default legend is placed at the top, this can be changed via WithLegend
+// and WithLegendOffset options. Units (Kbps or Mbps) are picked based on data
+// magnitude, this can be changed via WithUnits option. X axis tick interval can
+// be set via WithTickInterval option.
+//
+// By default bitrate is aggregated into 1 second buckets, per GOP or sliding
+// window bitrate can be plotted instead via WithBitrateMode option.
+//
+// Y axis can be made logarithmic via WithLogScale option, zero buckets are then
+// clamped to a floor below smallest non-zero bucket.
+func CreateBitratePlot(frameStats []FrameStat, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions("", opts...)
+	if o.bitrateMode != "" && o.bitrateMode != BitrateModeSecond {
+		return createBitrateModePlot(frameStats, o)
+	}
+	th := o.theme()
+	p := o.newPlot()
 	p.X.Label.Text = "Time (seconds)"
 	p.Y.Label.Text = "Kbps"
 
@@ -230,31 +431,18 @@ func CreateBitratePlot(frameStats []FrameStat) (*plot.Plot, error) {
 		return p, errors.New("CreateBitratePlot() Video duration is 0")
 	}
 
-	var totSize uint64
-	var curSecond uint64
-
-	// Bucket count should be same as video duration in seconds.
-	bSize := uint64(math.Floor(videoDuration)) + 1
-	// Create buckets for all types of interesting frames.
-	allFrameBuckets := make([]float64, bSize)
-	iFrameBuckets := make([]float64, bSize)
-	pFrameBuckets := make([]float64, bSize)
+	series := SecondBitrates(frameStats)
+	allFrameBuckets, iFrameBuckets, pFrameBuckets := series.Total, series.IFrame, series.PFrame
+	bSize := len(allFrameBuckets)
 
-	// Aggregate frame sizes into 1 second buckets.
-	minPts := frameStats[0].PtsTime
-	for _, p := range frameStats {
-		totSize += p.Size
-		// Use normalized time e.g. deal with negative PTS.
-		curSecond = uint64(math.Floor(p.PtsTime - minPts))
-		// Convert frame size to Kbits.
-		s := float64(p.Size*8) / 1000
-		allFrameBuckets[curSecond] += s
-		if p.KeyFrame {
-			iFrameBuckets[curSecond] += s
-		} else {
-			pFrameBuckets[curSecond] += s
+	// Scale buckets to Kbits or Mbits depending on units.
+	div, prefix := o.unitScale(maxFloat64(allFrameBuckets))
+	for _, buckets := range [][]float64{allFrameBuckets, iFrameBuckets, pFrameBuckets} {
+		for i := range buckets {
+			buckets[i] /= div
 		}
 	}
+	p.Y.Label.Text = prefix + "bps"
 
 	// Prepare XYers of all frame types for plotting.
 	allValues := make(plotter.XYs, len(allFrameBuckets))
@@ -276,64 +464,73 @@ func CreateBitratePlot(frameStats []FrameStat) (*plot.Plot, error) {
 		pValues[i].Y = v
 	}
 
+	var floor float64
+	if o.logScale {
+		floor = logFloor(allFrameBuckets, iFrameBuckets, pFrameBuckets)
+		clampXYs(floor, allValues, iValues, pValues)
+	}
+
 	// Now create all lines to be placed on plot.
 	allLine, err := plotter.NewLine(allValues)
 	if err != nil {
 		return p, fmt.Errorf("CreateBitratePlot() creating new Line: %w", err)
 	}
-	allLine.Color = ColorPalette[1]
+	allLine.Color = th.palette[1]
 	allLine.StepStyle = plotter.PostStep
-	allLine.FillColor = ColorPalette[0]
+	allLine.FillColor = th.palette[0]
 
 	iLine, err := plotter.NewLine(iValues)
 	if err != nil {
 		return p, fmt.Errorf("CreateBitratePlot() creating new I-frame Line: %w", err)
 	}
-	iLine.Color = ColorPalette[3]
+	iLine.Color = th.palette[3]
 	iLine.StepStyle = plotter.PostStep
 
 	pLine, err := plotter.NewLine(pValues)
 	if err != nil {
 		return p, fmt.Errorf("CreateBitratePlot() creating new P-frame Line: %w", err)
 	}
-	pLine.Color = ColorPalette[5]
+	pLine.Color = th.palette[5]
 	pLine.StepStyle = plotter.PostStep
 
 	// Mean and max/peak bitrate value as horizontal line.
 	mean := stat.Mean(allFrameBuckets, nil)
 	max := maxFloat64(allFrameBuckets)
-	meanLine, meanLabel := horizontalLineWithLabel(mean, 0, float64(bSize), fmt.Sprintf("mean=%.2f", mean))
-	maxLine, maxLabel := horizontalLineWithLabel(max, 0, float64(bSize), fmt.Sprintf("max=%.2f", max))
+	meanLine, meanLabel := horizontalLineWithLabel(mean, 0, float64(bSize), fmt.Sprintf("mean=%.2f %s", mean, p.Y.Label.Text))
+	maxLine, maxLabel := horizontalLineWithLabel(max, 0, float64(bSize), fmt.Sprintf("max=%.2f %s", max, p.Y.Label.Text))
+	th.styleLabels(meanLabel)
+	th.styleLabels(maxLabel)
 
 	// Tweak x and y axis limits.
 	p.Y.Min = 0
 	p.Y.Max = max * 1.1
-	// Add ticks with period of 10 seconds.
-	p.X.Tick.Marker = plot.TickerFunc(func(min, max float64) []plot.Tick {
-		var t []plot.Tick
-		for x := min; x <= max; x += 10 {
-			t = append(t, plot.Tick{
-				Value: x,
-				Label: fmt.Sprintf("%.1f", x),
-			})
-		}
-		return t
-	})
+	if o.logScale {
+		setLogScale(p, floor)
+	}
+	p.X.Tick.Marker = o.timeTicker()
 
-	p.Add(allLine, iLine, pLine, meanLine, meanLabel, maxLine, maxLabel, plotter.NewGrid())
+	p.Add(allLine, iLine, pLine, meanLine, meanLabel, maxLine, maxLabel, th.newGrid())
 
-	p.Legend.Add("Total", allLine)
-	p.Legend.Add("I-frame", iLine)
-	p.Legend.Add("P-frame", pLine)
-	p.Legend.Top = true
 	p.Legend.XOffs = -10
 	p.Legend.YOffs = -10
+	if o.setupLegend(p, LegendTop) {
+		p.Legend.Add("Total", allLine)
+		p.Legend.Add("I-frame", iLine)
+		p.Legend.Add("P-frame", pLine)
+	}
 
 	return p, nil
 }
 
-func CreateFrameSizePlot(frameStats []FrameStat) (*plot.Plot, error) {
-	p := plot.New()
+// CreateFrameSizePlot creates a frame size plot from given FrameStat slice.
+//
+// Units (KB or MB) are picked based on data magnitude, this can be changed via
+// WithUnits option. X axis tick interval can be set via WithTickInterval
+// option.
+func CreateFrameSizePlot(frameStats []FrameStat, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions("", opts...)
+	th := o.theme()
+	p := o.newPlot()
 	p.X.Label.Text = "Time (seconds)"
 	p.Y.Label.Text = "KB"
 
@@ -361,31 +558,37 @@ func CreateFrameSizePlot(frameStats []FrameStat) (*plot.Plot, error) {
 		}
 	}
 
+	// Scale sizes to KB or MB depending on units.
+	var maxSize float64
+	for _, xys := range []plotter.XYs{keyFrameSizes, pFrameSizes} {
+		for i := range xys {
+			maxSize = math.Max(maxSize, xys[i].Y)
+		}
+	}
+	div, prefix := o.unitScale(maxSize)
+	for _, xys := range []plotter.XYs{keyFrameSizes, pFrameSizes} {
+		for i := range xys {
+			xys[i].Y /= div
+		}
+	}
+	p.Y.Label.Text = prefix + "B"
+
 	keyFrameLine, err := plotter.NewLine(keyFrameSizes)
 	if err != nil {
 		return p, fmt.Errorf("CreateFrameSizePlot() creating new I-frame Line: %w", err)
 	}
-	keyFrameLine.Color = ColorPalette[3]
+	keyFrameLine.Color = th.palette[3]
 
 	pFrameLine, err := plotter.NewLine(pFrameSizes)
 	if err != nil {
 		return p, fmt.Errorf("CreateFrameSizePlot() creating new P-frame Line: %w", err)
 	}
-	pFrameLine.Color = ColorPalette[5]
+	pFrameLine.Color = th.palette[5]
 
 	p.Y.Min = 0
-	p.X.Tick.Marker = plot.TickerFunc(func(min, max float64) []plot.Tick {
-		var t []plot.Tick
-		for x := min; x <= max; x += 10 {
-			t = append(t, plot.Tick{
-				Value: x,
-				Label: fmt.Sprintf("%.1f", x),
-			})
-		}
-		return t
-	})
+	p.X.Tick.Marker = o.timeTicker()
 
-	p.Add(keyFrameLine, pFrameLine, plotter.NewGrid())
+	p.Add(keyFrameLine, pFrameLine, th.newGrid())
 
 	return p, nil
 }
@@ -394,41 +597,130 @@ func CreateFrameSizePlot(frameStats []FrameStat) (*plot.Plot, error) {
 //
 // Resulting plot will include the bitrate plot aggregated into 1 second buckets
 // and frame size plot all in one canvas.
-func MultiPlotBitrate(videoFile, plotFile string) error {
+func MultiPlotBitrate(videoFile, plotFile string, opts ...PlotOption) error {
 	if _, err := os.Stat(videoFile); os.IsNotExist(err) {
 		return fmt.Errorf("MultiPlotBitrate() video file should exist: %w", err)
 	}
+
+	w, err := perm.Create(plotFile)
+	if err != nil {
+		return fmt.Errorf("MultiPlotBitrate() error from perm.Create(): %w", err)
+	}
+	defer w.Close()
+
+	return WriteBitratePlot(w, videoFile, opts...)
+}
+
+// WriteBitratePlot will create bitrate multi plot and write it as PNG to w.
+//
+// Resulting plot will include the bitrate plot aggregated into 1 second buckets
+// and frame size plot all in one canvas.
+func WriteBitratePlot(w io.Writer, videoFile string, opts ...PlotOption) error {
 	base := path.Base(videoFile)
 
 	fs, err := GetFrameStats(videoFile)
 	if err != nil {
-		return fmt.Errorf("MultiPlotBitrate() failed getting FrameStats: %w", err)
+		return fmt.Errorf("WriteBitratePlot() failed getting FrameStats: %w", err)
 	}
 
-	// Create a 2D slice to hold subplots. This is the state of gonum's API at this point
-	// unfortunately.
-	const rows, cols = 2, 1
-	plots := make([][]*plot.Plot, rows)
-	for i := range plots {
-		plots[i] = make([]*plot.Plot, cols)
+	// Subplots are independent, so build them concurrently.
+	built, err := buildPlots(
+		func() (*plot.Plot, error) {
+			p, err := CreateBitratePlot(fs, opts...)
+			if err != nil {
+				return p, fmt.Errorf("WriteBitratePlot() error creating bitrate plot: %w", err)
+			}
+			return p, nil
+		},
+		func() (*plot.Plot, error) {
+			p, err := CreateFrameSizePlot(fs, opts...)
+			if err != nil {
+				return p, fmt.Errorf("WriteBitratePlot() error creating frame size plot: %w", err)
+			}
+			return p, nil
+		},
+	)
+	if err != nil {
+		return err
 	}
+	bitrate, frameSizes := built[0], built[1]
+
+	// Tweak titles and labels to have better layout and make plots less busy.
+	o := newPlotOptions("", opts...)
+	title := "Bitrate"
+	switch o.bitrateMode {
+	case BitrateModeGOP:
+		title = "Bitrate (per GOP)"
+	case BitrateModeWindow:
+		title = "Bitrate (sliding window)"
+	}
+	bitrate.Title.Text = base + "\n\n" + title
+	bitrate.X.Label.Text = ""
+	frameSizes.Title.Text = "Frame sizes"
 
-	plots[0][0], err = CreateBitratePlot(fs)
+	// Create a 2D slice to hold subplots. This is the state of gonum's API at this point
+	// unfortunately.
+	plots, err := o.tile(built)
 	if err != nil {
-		return fmt.Errorf("MultiPlotBitrate() error creating bitrate plot: %w", err)
+		return fmt.Errorf("WriteBitratePlot() %w", err)
+	}
+	width, height := tiledSize(plots)
+	if err := writeMultiPlot(w, plots, width, height, opts...); err != nil {
+		return fmt.Errorf("WriteBitratePlot() %w", err)
 	}
 
-	plots[1][0], err = CreateFrameSizePlot(fs)
-	if err != nil {
-		return fmt.Errorf("MultiPlotBitrate() error creating frame size plot: %w", err)
+	return nil
+}
+
+// buildPlots will run plot builders concurrently and return resulting plots in
+// builders' order.
+//
+// Each builder must create it's own *plot.Plot, input data may be shared as
+// long as builders do not mutate it. In case of errors first builder's (in
+// order) error is returned.
+func buildPlots(builders ...func() (*plot.Plot, error)) ([]*plot.Plot, error) {
+	plots := make([]*plot.Plot, len(builders))
+	errs := make([]error, len(builders))
+	var wg sync.WaitGroup
+	for i, b := range builders {
+		wg.Add(1)
+		go func(i int, b func() (*plot.Plot, error)) {
+			defer wg.Done()
+			plots[i], errs[i] = b()
+		}(i, b)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
 	}
+	return plots, nil
+}
 
-	// Tweak titles and labels to have better layout and make plots less busy.
-	plots[0][0].Title.Text = base + "\n\nBitrate"
-	plots[0][0].X.Label.Text = ""
-	plots[1][0].Title.Text = "Frame sizes"
+// tiledSize returns canvas size for plots grid, each tile is of default plot size.
+func tiledSize(plots [][]*plot.Plot) (width, height vg.Length) {
+	return defaultPlotWidth * vg.Length(len(plots[0])), defaultPlotHeight * vg.Length(len(plots))
+}
 
-	img := vgimg.New(defaultPlotWidth, defaultPlotHeight*2)
+// writeMultiPlot is helper to align plots on a single canvas and write it as PNG to w.
+func writeMultiPlot(w io.Writer, plots [][]*plot.Plot, width, height vg.Length, opts ...PlotOption) error {
+	rows := len(plots)
+	cols := len(plots[0])
+
+	// Canvas is filled with background of plots, so that padding between
+	// tiles matches plot theme.
+	var bg color.Color = color.White
+findBg:
+	for _, row := range plots {
+		for _, p := range row {
+			if p != nil {
+				bg = p.BackgroundColor
+				break findBg
+			}
+		}
+	}
+	img := vgimg.NewWith(vgimg.UseWH(width, height), vgimg.UseBackgroundColor(bg))
 	dc := draw.New(img)
 
 	t := draw.Tiles{
@@ -446,17 +738,21 @@ func MultiPlotBitrate(videoFile, plotFile string) error {
 		}
 	}
 
-	w, err := os.Create(plotFile)
-	if err != nil {
-		return fmt.Errorf("MultiPlotBitrate() error fro os.Create(): %w", err)
-	}
-	defer w.Close()
+	return writePNG(w, img, opts...)
+}
 
-	png := vgimg.PngCanvas{Canvas: img}
-	if _, err := png.WriteTo(w); err != nil {
-		return fmt.Errorf("MultiPlotBitrate() failed writing png file: %w", err)
+// writePNG will encode canvas as PNG to w with compression level according to
+// opts.
+func writePNG(w io.Writer, img *vgimg.Canvas, opts ...PlotOption) error {
+	o := newPlotOptions("", opts...)
+	enc := png.Encoder{CompressionLevel: o.pngCompressionLevel()}
+	b := bufio.NewWriter(w)
+	if err := enc.Encode(b, img.Image()); err != nil {
+		return fmt.Errorf("failed writing png: %w", err)
+	}
+	if err := b.Flush(); err != nil {
+		return fmt.Errorf("failed writing png: %w", err)
 	}
-
 	return nil
 }
 
@@ -505,9 +801,9 @@ func horizontalLineWithLabel(y, xMin, xMax float64, label string) (*plotter.Line
 }
 
 // createQuantileLines is helper to create vertical Quantile lines.
-func createQuantileLines(p *plot.Plot, values []float64, quantiles ...float64) []plot.Plotter {
+func createQuantileLines(p *plot.Plot, th *theme, values []float64, quantiles ...float64) []plot.Plotter {
 	var plotters []plot.Plotter
-	colorCount := len(ColorPalette)
+	colorCount := len(th.palette)
 	for i, q := range quantiles {
 		qVal := stat.Quantile(q, stat.Empirical, values, nil)
 		qLine := verticalLine(qVal, p.Y.Min, p.Y.Max)
@@ -515,7 +811,7 @@ func createQuantileLines(p *plot.Plot, values []float64, quantiles ...float64) [
 		qLine.LineStyle.Dashes = []vg.Length{vg.Points(5), vg.Points(5)}
 		// Safe index with step=2 into ColorPalette with wrap-around to avoid
 		// panic in case of bounds check fails.
-		qLine.Color = ColorPalette[i*5%colorCount]
+		qLine.Color = th.palette[i*5%colorCount]
 
 		labels, _ := plotter.NewLabels(plotter.XYLabels{
 			XYs: plotter.XYs{
@@ -527,13 +823,14 @@ func createQuantileLines(p *plot.Plot, values []float64, quantiles ...float64) [
 		})
 		labels.Offset.X = 5
 		labels.Offset.Y = -5
+		th.styleLabels(labels)
 
 		plotters = append(plotters, qLine, labels)
 	}
 	// Also add mean/average line.
 	meanVal := stat.Mean(values, nil)
 	meanLine := verticalLine(meanVal, p.Y.Min, p.Y.Max)
-	meanLine.Color = ColorPalette[len(ColorPalette)-1]
+	meanLine.Color = th.palette[len(th.palette)-1]
 	qValMean := stat.CDF(meanVal, stat.Empirical, values, nil)
 	meanLabel, _ := plotter.NewLabels(plotter.XYLabels{
 		XYs: plotter.XYs{
@@ -545,6 +842,7 @@ func createQuantileLines(p *plot.Plot, values []float64, quantiles ...float64) [
 	})
 	meanLabel.Offset.X = 5
 	meanLabel.Offset.Y = -5
+	th.styleLabels(meanLabel)
 	plotters = append(plotters, meanLine, meanLabel)
 
 	return plotters
@@ -552,6 +850,9 @@ func createQuantileLines(p *plot.Plot, values []float64, quantiles ...float64) [
 
 // getDuration calculates video duration based on data from FrameStat slice.
 func getDuration(fs []FrameStat) float64 {
+	if len(fs) == 0 {
+		return 0
+	}
 	pts := make([]float64, 0, len(fs))
 	var acc float64
 	for _, v := range fs {
@@ -582,7 +883,9 @@ func GetFrameStats(videoFile string) ([]FrameStat, error) {
 
 	cmd := exec.Command(c, ffprobeArgs...)
 	logging.Debugf("Running: %s\n", cmd)
+	release := tools.AcquireProcess()
 	out, err := cmd.Output()
+	release()
 	if err != nil {
 		return nil, err
 	}
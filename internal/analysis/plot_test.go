@@ -7,6 +7,9 @@
 package analysis
 
 import (
+	"bytes"
+	"errors"
+	"image/png"
 	"log"
 	"os"
 	"path"
@@ -15,6 +18,9 @@ import (
 	"github.com/evolution-gaming/ease/internal/vqm"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg/vgimg"
 )
 
 var frameMetricsFile = "../../testdata/vqm/frame_metrics.json"
@@ -72,6 +78,53 @@ func Test_CreateVqmPlot(t *testing.T) {
 	})
 }
 
+func Test_CreateDeltaVqmPlot(t *testing.T) {
+	t.Run("Creating delta plot should succeed", func(t *testing.T) {
+		got, err := CreateDeltaVqmPlot([]float64{90, 80, 70}, []float64{85, 85}, "VMAF")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff("Δ VMAF", got.Y.Label.Text); diff != "" {
+			t.Errorf("Plot label mismatch (-want +got):\n%s", diff)
+		}
+		// Only frames present in both are plotted.
+		if diff := cmp.Diff(1.0, got.X.Max); diff != "" {
+			t.Errorf("X axis max mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff([]float64{-5, 5}, []float64{got.Y.Min, got.Y.Max}); diff != "" {
+			t.Errorf("Y axis range mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Creating delta plot without common frames should fail", func(t *testing.T) {
+		if _, err := CreateDeltaVqmPlot([]float64{90}, nil, "VMAF"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func Test_PlotDeltaVqm(t *testing.T) {
+	vmafs := getVmafValues()
+	outFile := path.Join(t.TempDir(), "delta.png")
+
+	shifted := make([]float64, len(vmafs))
+	for i, v := range vmafs {
+		shifted[i] = v - 1
+	}
+	if err := PlotDeltaVqm(vmafs, shifted, "VMAF", "Test plot title", outFile); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fi, err := os.Stat(outFile)
+	if err != nil {
+		t.Fatalf("Unexpected error from os.Stat: %v", err)
+	}
+	if fi.Size() <= 10 {
+		t.Errorf("Resulting plot file size too small: %+v", fi)
+	}
+}
+
 func Test_CreateCDFPlot(t *testing.T) {
 	vmafs := getVmafValues()
 	title := "Test plot title"
@@ -88,6 +141,40 @@ func Test_CreateCDFPlot(t *testing.T) {
 	})
 }
 
+func Test_CreateMultiCDFPlot(t *testing.T) {
+	vmafs := getVmafValues()
+	series := map[string][]float64{
+		"libx264": vmafs,
+		"libx265": vmafs[:len(vmafs)/2],
+	}
+
+	t.Run("Creating multi-series CDF plot should succeed", func(t *testing.T) {
+		got, err := CreateMultiCDFPlot(series, "VMAF")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff("VMAF", got.X.Label.Text); diff != "" {
+			t.Errorf("Plot label mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Creating CDF plot without series should fail", func(t *testing.T) {
+		if _, err := CreateMultiCDFPlot(nil, "VMAF"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+
+	t.Run("Writing multi-series CDF plot should succeed", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteMultiCDFPlot(&buf, series, "VMAF", "Test"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if buf.Len() == 0 {
+			t.Error("Expected non-empty output")
+		}
+	})
+}
+
 func Test_MultiPlotVqm(t *testing.T) {
 	vmafs := getVmafValues()
 	outDir := t.TempDir()
@@ -129,6 +216,16 @@ func Test_CreateBitratePlot(t *testing.T) {
 			t.Errorf("Plot title mismatch (-want +got):\n%s", diff)
 		}
 	})
+	t.Run("Should use mega units if requested", func(t *testing.T) {
+		got, err := CreateBitratePlot(frameStats, WithUnits(UnitsMega))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff("Mbps", got.Y.Label.Text); diff != "" {
+			t.Errorf("Plot title mismatch (-want +got):\n%s", diff)
+		}
+	})
 }
 
 func Test_CreateFrameSizePlot(t *testing.T) {
@@ -148,6 +245,16 @@ func Test_CreateFrameSizePlot(t *testing.T) {
 			t.Errorf("Plot title mismatch (-want +got):\n%s", diff)
 		}
 	})
+	t.Run("Should use mega units if requested", func(t *testing.T) {
+		got, err := CreateFrameSizePlot(frameStats, WithUnits(UnitsMega))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff("MB", got.Y.Label.Text); diff != "" {
+			t.Errorf("Plot title mismatch (-want +got):\n%s", diff)
+		}
+	})
 }
 
 func Test_MultiPlotBitrate(t *testing.T) {
@@ -197,3 +304,150 @@ func Test_GetFrameStats(t *testing.T) {
 		}
 	})
 }
+
+func Test_WriteVqmPlot(t *testing.T) {
+	vmafs := getVmafValues()
+
+	t.Run("Writing VQM multi-plot to io.Writer should succeed", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteVqmPlot(&buf, vmafs, "VMAF", "Test plot title"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// Check for PNG signature.
+		if !bytes.HasPrefix(buf.Bytes(), []byte("\x89PNG")) {
+			t.Errorf("Written data is not a PNG image")
+		}
+	})
+	t.Run("Writing VQM multi-plot with jitter should succeed", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteVqmPlot(&buf, vmafs, "VMAF", "Test plot title", WithJitter(1.5)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// Check for PNG signature.
+		if !bytes.HasPrefix(buf.Bytes(), []byte("\x89PNG")) {
+			t.Errorf("Written data is not a PNG image")
+		}
+	})
+	t.Run("Writing VQM multi-plot with markers should succeed", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteVqmPlot(&buf, vmafs, "VMAF", "Test plot title", WithMarkers([]float64{10, 100})); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// Check for PNG signature.
+		if !bytes.HasPrefix(buf.Bytes(), []byte("\x89PNG")) {
+			t.Errorf("Written data is not a PNG image")
+		}
+	})
+}
+
+func Test_WriteVqmPlot_PNGCompression(t *testing.T) {
+	vmafs := getVmafValues()
+
+	sizes := make(map[string]int)
+	for _, c := range []string{PNGCompressionNone, PNGCompressionBest} {
+		var buf bytes.Buffer
+		if err := WriteVqmPlot(&buf, vmafs, "VMAF", "Test plot title", WithPNGCompression(c)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte("\x89PNG")) {
+			t.Errorf("Written data is not a PNG image")
+		}
+		sizes[c] = buf.Len()
+	}
+	if sizes[PNGCompressionBest] >= sizes[PNGCompressionNone] {
+		t.Errorf("Expected best compression to produce smaller file: %v", sizes)
+	}
+}
+
+func Test_WriteVqmPlot_Layout(t *testing.T) {
+	vmafs := getVmafValues()
+	tests := map[string]struct {
+		opts []PlotOption
+		// Canvas size in tiles
+		wantCols, wantRows int
+	}{
+		"Default 3x1": {wantCols: 1, wantRows: 3},
+		"1x3":         {opts: []PlotOption{WithLayout(1, 3)}, wantCols: 3, wantRows: 1},
+		"2x2":         {opts: []PlotOption{WithLayout(2, 2)}, wantCols: 2, wantRows: 2},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteVqmPlot(&buf, vmafs, "VMAF", "Test plot title", tc.opts...); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			cfg, err := png.DecodeConfig(&buf)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// Canvas is multiple of default plot size, allow for rounding.
+			tileW, tileH := defaultPlotWidth.Dots(vgimg.DefaultDPI), defaultPlotHeight.Dots(vgimg.DefaultDPI)
+			want := []float64{tileW * float64(tc.wantCols), tileH * float64(tc.wantRows)}
+			got := []float64{float64(cfg.Width), float64(cfg.Height)}
+			if diff := cmp.Diff(want, got, cmpopts.EquateApprox(0, 2)); diff != "" {
+				t.Errorf("Canvas size mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("Too small layout should fail", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteVqmPlot(&buf, vmafs, "VMAF", "Test plot title", WithLayout(1, 1)); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_MultiPlotVqm_Negative(t *testing.T) {
+	vmafs := getVmafValues()
+
+	t.Run("Should return error for non-writable output file", func(t *testing.T) {
+		outFile := path.Join(t.TempDir(), "non-existent-dir", "vqm.png")
+		if err := MultiPlotVqm(vmafs, "VMAF", "Test plot title", outFile); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_buildPlots(t *testing.T) {
+	titled := func(title string) func() (*plot.Plot, error) {
+		return func() (*plot.Plot, error) {
+			p := plot.New()
+			p.Title.Text = title
+			return p, nil
+		}
+	}
+	failing := func(msg string) func() (*plot.Plot, error) {
+		return func() (*plot.Plot, error) {
+			return nil, errors.New(msg)
+		}
+	}
+
+	t.Run("Plots should be in builders order", func(t *testing.T) {
+		got, err := buildPlots(titled("a"), titled("b"), titled("c"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var gotTitles []string
+		for _, p := range got {
+			gotTitles = append(gotTitles, p.Title.Text)
+		}
+		if diff := cmp.Diff([]string{"a", "b", "c"}, gotTitles); diff != "" {
+			t.Errorf("Titles mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("First error should be returned", func(t *testing.T) {
+		_, err := buildPlots(titled("a"), failing("first"), failing("second"))
+		if err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+		if diff := cmp.Diff("first", err.Error()); diff != "" {
+			t.Errorf("Error mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Rate-distortion (RD) curve plot related functionality.
+
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// RDPoint is a single rate-distortion point, e.g. an encode of a bitrate ladder.
+type RDPoint struct {
+	// Average bitrate in kbit/s
+	Bitrate float64
+	VMAF    float64
+}
+
+// CreateRDPlot creates rate-distortion (VMAF vs bitrate) plot.
+//
+// Each series (e.g. encoding scheme) is drawn as connected and marked line,
+// points are sorted by bitrate so that lines are monotonic along X axis.
+func CreateRDPlot(points map[string][]RDPoint, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions("VMAF", opts...)
+	th := o.theme()
+	p := o.newPlot()
+	p.X.Label.Text = "Bitrate (kbps)"
+	p.Y.Label.Text = "VMAF"
+
+	if len(points) == 0 {
+		return p, errors.New("CreateRDPlot() no points to plot")
+	}
+
+	// Iterate series in stable order, so that colors do not change between
+	// runs.
+	names := make([]string, 0, len(points))
+	for name := range points {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p.Add(th.newGrid())
+	showLegend := o.setupLegend(p, LegendBottom)
+	for i, name := range names {
+		line, marks, err := plotter.NewLinePoints(rdXYs(points[name]))
+		if err != nil {
+			return p, fmt.Errorf("CreateRDPlot() creating new LinePoints: %w", err)
+		}
+		// Use only base colors from palette.
+		c := th.palette[(2*i)%len(th.palette)]
+		line.Color = c
+		marks.Color = c
+		marks.Shape = draw.CircleGlyph{}
+
+		p.Add(line, marks)
+		if showLegend {
+			p.Legend.Add(name, line, marks)
+		}
+	}
+
+	return p, nil
+}
+
+// rdXYs converts RD points to plotter.XYs sorted by bitrate.
+func rdXYs(points []RDPoint) plotter.XYs {
+	xys := make(plotter.XYs, len(points))
+	for i, v := range points {
+		xys[i].X = v.Bitrate
+		xys[i].Y = v.VMAF
+	}
+	sort.Slice(xys, func(i, j int) bool {
+		return xys[i].X < xys[j].X
+	})
+	return xys
+}
+
+// ConvexHull returns points on upper convex hull of RD points sorted by
+// bitrate, i.e. points giving the best achievable VMAF at their bitrate (e.g.
+// optimal rungs of a bitrate ladder encoded at various resolutions). Points
+// not improving VMAF over lower bitrate points are never on the hull.
+func ConvexHull(points []RDPoint) []RDPoint {
+	sorted := append([]RDPoint(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Bitrate != sorted[j].Bitrate {
+			return sorted[i].Bitrate < sorted[j].Bitrate
+		}
+		return sorted[i].VMAF > sorted[j].VMAF
+	})
+
+	var hull []RDPoint
+	for _, p := range sorted {
+		if len(hull) > 0 && p.VMAF <= hull[len(hull)-1].VMAF {
+			continue
+		}
+		// Drop last hull point while it is not above line from previous hull
+		// point to p (monotone chain).
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) >= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull
+}
+
+// cross returns cross product of vectors o->a and o->b, positive for counter
+// clockwise turn.
+func cross(o, a, b RDPoint) float64 {
+	return (a.Bitrate-o.Bitrate)*(b.VMAF-o.VMAF) - (a.VMAF-o.VMAF)*(b.Bitrate-o.Bitrate)
+}
+
+// SaveRDPlot will create rate-distortion plot and save it to a file.
+func SaveRDPlot(points map[string][]RDPoint, title, outFile string, opts ...PlotOption) error {
+	w, err := perm.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("SaveRDPlot() error from perm.Create(): %w", err)
+	}
+	defer w.Close()
+
+	return WriteRDPlot(w, points, title, opts...)
+}
+
+// WriteRDPlot will create rate-distortion plot and write it as PNG to w.
+func WriteRDPlot(w io.Writer, points map[string][]RDPoint, title string, opts ...PlotOption) error {
+	p, err := CreateRDPlot(points, opts...)
+	if err != nil {
+		return fmt.Errorf("WriteRDPlot() %w", err)
+	}
+	p.Title.Text = title
+
+	plots := [][]*plot.Plot{{p}}
+	if err := writeMultiPlot(w, plots, defaultPlotWidth, defaultPlotHeight*3, opts...); err != nil {
+		return fmt.Errorf("WriteRDPlot() %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"bytes"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gonum.org/v1/plot/plotter"
+)
+
+func Test_rdXYs(t *testing.T) {
+	given := []RDPoint{{Bitrate: 3000, VMAF: 95}, {Bitrate: 1000, VMAF: 80}, {Bitrate: 2000, VMAF: 90}}
+	want := plotter.XYs{{X: 1000, Y: 80}, {X: 2000, Y: 90}, {X: 3000, Y: 95}}
+
+	got := rdXYs(given)
+
+	t.Run("Should sort points by bitrate", func(t *testing.T) {
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("XYs mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should not modify given points", func(t *testing.T) {
+		if diff := cmp.Diff(3000.0, given[0].Bitrate); diff != "" {
+			t.Errorf("Given points modified (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func Test_WriteRDPlot(t *testing.T) {
+	given := map[string][]RDPoint{
+		"x264": {{Bitrate: 1000, VMAF: 80}, {Bitrate: 2000, VMAF: 90}},
+	}
+	var buf bytes.Buffer
+	if err := WriteRDPlot(&buf, given, "RD curves"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Check for PNG signature.
+	if !bytes.HasPrefix(buf.Bytes(), []byte("\x89PNG")) {
+		t.Errorf("Written data is not a PNG image")
+	}
+}
+
+func Test_SaveRDPlot_Negative(t *testing.T) {
+	t.Run("Should return error for non-writable output file", func(t *testing.T) {
+		outFile := path.Join(t.TempDir(), "non-existent-dir", "rd.png")
+		given := map[string][]RDPoint{"x264": {{Bitrate: 1000, VMAF: 80}}}
+		if err := SaveRDPlot(given, "", outFile); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+	t.Run("Should return error for no points", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteRDPlot(&buf, nil, ""); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_ConvexHull(t *testing.T) {
+	given := []RDPoint{
+		{Bitrate: 3000, VMAF: 90},
+		{Bitrate: 500, VMAF: 60},
+		{Bitrate: 1000, VMAF: 85},
+		{Bitrate: 1000, VMAF: 80},
+		{Bitrate: 2000, VMAF: 88},
+		{Bitrate: 3000, VMAF: 95},
+		{Bitrate: 4000, VMAF: 94},
+	}
+	want := []RDPoint{{Bitrate: 500, VMAF: 60}, {Bitrate: 1000, VMAF: 85}, {Bitrate: 3000, VMAF: 95}}
+
+	got := ConvexHull(given)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Convex hull mismatch (-want +got):\n%s", diff)
+	}
+}
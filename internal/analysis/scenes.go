@@ -0,0 +1,101 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Per scene VMAF plot, for pinpointing content encoder handles worst.
+
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// CreateSceneVMAFPlot creates a bar chart of mean VMAF per scene, sceneVMAFs
+// are in scene order (scenes are numbered from 1). The worst scene is
+// highlighted.
+func CreateSceneVMAFPlot(sceneVMAFs []float64, opts ...PlotOption) (*plot.Plot, error) {
+	o := newPlotOptions("", opts...)
+	th := o.theme()
+	p := o.newPlot()
+	p.X.Label.Text = "Scene"
+	p.Y.Label.Text = "VMAF"
+
+	if len(sceneVMAFs) == 0 {
+		return p, errors.New("CreateSceneVMAFPlot() no scenes")
+	}
+
+	worst := 0
+	for i, v := range sceneVMAFs {
+		if v < sceneVMAFs[worst] {
+			worst = i
+		}
+	}
+
+	bars, err := plotter.NewBarChart(plotter.Values(sceneVMAFs), vg.Points(10))
+	if err != nil {
+		return p, fmt.Errorf("CreateSceneVMAFPlot() creating BarChart: %w", err)
+	}
+	bars.Color = th.palette[1]
+	bars.LineStyle.Width = 0
+
+	// Worst scene bar is drawn over the regular one.
+	worstValues := make(plotter.Values, len(sceneVMAFs))
+	worstValues[worst] = sceneVMAFs[worst]
+	worstBars, err := plotter.NewBarChart(worstValues, vg.Points(10))
+	if err != nil {
+		return p, fmt.Errorf("CreateSceneVMAFPlot() creating worst scene BarChart: %w", err)
+	}
+	worstBars.Color = th.palette[0]
+	worstBars.LineStyle.Width = 0
+
+	p.Add(th.newGrid(), bars, worstBars)
+
+	names := make([]string, len(sceneVMAFs))
+	for i := range names {
+		names[i] = strconv.Itoa(i + 1)
+	}
+	p.NominalX(names...)
+	p.Y.Min = 0
+	p.Y.Max = 100
+
+	if o.setupLegend(p, LegendBottom) {
+		p.Legend.Add(fmt.Sprintf("Worst scene %d (VMAF %.2f)", worst+1, sceneVMAFs[worst]), worstBars)
+	}
+
+	return p, nil
+}
+
+// SaveSceneVMAFPlot will create per scene VMAF plot and save it to a file.
+func SaveSceneVMAFPlot(sceneVMAFs []float64, title, outFile string, opts ...PlotOption) error {
+	w, err := perm.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("SaveSceneVMAFPlot() error from perm.Create(): %w", err)
+	}
+	defer w.Close()
+
+	return WriteSceneVMAFPlot(w, sceneVMAFs, title, opts...)
+}
+
+// WriteSceneVMAFPlot will create per scene VMAF plot and write it as PNG to w.
+func WriteSceneVMAFPlot(w io.Writer, sceneVMAFs []float64, title string, opts ...PlotOption) error {
+	p, err := CreateSceneVMAFPlot(sceneVMAFs, opts...)
+	if err != nil {
+		return fmt.Errorf("WriteSceneVMAFPlot() %w", err)
+	}
+	p.Title.Text = title
+
+	plots := [][]*plot.Plot{{p}}
+	if err := writeMultiPlot(w, plots, defaultPlotWidth, defaultPlotHeight*2, opts...); err != nil {
+		return fmt.Errorf("WriteSceneVMAFPlot() %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_CreateSceneVMAFPlot(t *testing.T) {
+	t.Run("Should create plot", func(t *testing.T) {
+		if _, err := CreateSceneVMAFPlot([]float64{85, 50, 95}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := WriteSceneVMAFPlot(&buf, []float64{85, 50, 95}, "test"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if buf.Len() == 0 {
+			t.Error("Expected PNG output, got none")
+		}
+	})
+	t.Run("Should fail for no scenes", func(t *testing.T) {
+		if _, err := CreateSceneVMAFPlot(nil); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
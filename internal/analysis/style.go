@@ -0,0 +1,182 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Reusable plot style.
+
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Colors overrides theme colors, nil (empty) fields keep theme's colors.
+type Colors struct {
+	Background color.Color
+	// Text, axes and tick color
+	Foreground color.Color
+	Grid       color.Color
+	// Series colors, indexed same as ColorPalette, shorter palette is
+	// repeated
+	Palette []color.RGBA
+}
+
+// PlotStyle is plot appearance (theme, colors, fonts and legend) defined once
+// in a JSON file and shared across plotting subcommands, so that teams can
+// standardize their charts. Zero fields keep defaults.
+//
+// Colors are hex strings "#RRGGBB" or "#RRGGBBAA".
+type PlotStyle struct {
+	// Theme is one of ThemeLight or ThemeDark
+	Theme string `json:",omitempty"`
+	// Background, Foreground, Grid and Palette override theme's colors
+	Background string   `json:",omitempty"`
+	Foreground string   `json:",omitempty"`
+	Grid       string   `json:",omitempty"`
+	Palette    []string `json:",omitempty"`
+	// Font is builtin font family or TTF/OTF font file, relative font file
+	// path is relative to style file location
+	Font string `json:",omitempty"`
+	// Font sizes in points
+	TitleSize float64 `json:",omitempty"`
+	LabelSize float64 `json:",omitempty"`
+	TickSize  float64 `json:",omitempty"`
+	// Legend is one of LegendTop, LegendBottom or LegendNone
+	Legend string `json:",omitempty"`
+	// Legend offsets in points, nil means default
+	LegendXOffset *float64 `json:",omitempty"`
+	LegendYOffset *float64 `json:",omitempty"`
+}
+
+// LoadPlotStyle will load and validate plot style from JSON file. Unknown
+// fields are rejected, so that typos do not go unnoticed.
+func LoadPlotStyle(styleFile string) (PlotStyle, error) {
+	var s PlotStyle
+	data, err := os.ReadFile(styleFile)
+	if err != nil {
+		return s, fmt.Errorf("LoadPlotStyle() %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, fmt.Errorf("LoadPlotStyle() parse %s: %w", styleFile, err)
+	}
+	if err := s.Validate(); err != nil {
+		return s, fmt.Errorf("LoadPlotStyle() %s: %w", styleFile, err)
+	}
+	if s.Font != "" && !IsFontFamily(s.Font) && !filepath.IsAbs(s.Font) {
+		s.Font = filepath.Join(filepath.Dir(styleFile), s.Font)
+	}
+	return s, nil
+}
+
+// Validate checks that style values are valid.
+func (s *PlotStyle) Validate() error {
+	if s.Theme != "" && !IsTheme(s.Theme) {
+		return fmt.Errorf("invalid theme: %s", s.Theme)
+	}
+	if s.Legend != "" && !IsLegendPosition(s.Legend) {
+		return fmt.Errorf("invalid legend position: %s", s.Legend)
+	}
+	if s.TitleSize < 0 || s.LabelSize < 0 || s.TickSize < 0 {
+		return errors.New("font sizes should not be negative")
+	}
+	_, err := s.Colors()
+	return err
+}
+
+// Colors returns parsed style colors.
+func (s *PlotStyle) Colors() (Colors, error) {
+	var c Colors
+	for _, v := range []struct {
+		hex string
+		dst *color.Color
+	}{
+		{s.Background, &c.Background},
+		{s.Foreground, &c.Foreground},
+		{s.Grid, &c.Grid},
+	} {
+		if v.hex == "" {
+			continue
+		}
+		rgba, err := parseHexColor(v.hex)
+		if err != nil {
+			return c, err
+		}
+		*v.dst = rgba
+	}
+	for _, hex := range s.Palette {
+		rgba, err := parseHexColor(hex)
+		if err != nil {
+			return c, err
+		}
+		c.Palette = append(c.Palette, rgba)
+	}
+	return c, nil
+}
+
+// Options returns plot options according to style, font which is not builtin
+// is loaded from font file.
+func (s *PlotStyle) Options() ([]PlotOption, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	colors, _ := s.Colors()
+	opts := []PlotOption{
+		WithColors(colors),
+		WithFontSizes(s.TitleSize, s.LabelSize, s.TickSize),
+	}
+	if s.Theme != "" {
+		opts = append(opts, WithTheme(s.Theme))
+	}
+	if s.Legend != "" {
+		opts = append(opts, WithLegend(s.Legend))
+	}
+	if s.LegendXOffset != nil || s.LegendYOffset != nil {
+		// Offset not given keeps default (NaN).
+		x, y := math.NaN(), math.NaN()
+		if s.LegendXOffset != nil {
+			x = *s.LegendXOffset
+		}
+		if s.LegendYOffset != nil {
+			y = *s.LegendYOffset
+		}
+		opts = append(opts, WithLegendOffset(x, y))
+	}
+	if s.Font != "" {
+		family := s.Font
+		if !IsFontFamily(family) {
+			name, err := RegisterFont(family)
+			if err != nil {
+				return nil, err
+			}
+			family = name
+		}
+		opts = append(opts, WithFont(family))
+	}
+	return opts, nil
+}
+
+// parseHexColor will parse color given as "#RRGGBB" or "#RRGGBBAA", alpha is
+// not premultiplied (as in CSS).
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if !strings.HasPrefix(s, "#") || len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, should be #RRGGBB or #RRGGBBAA", s)
+	}
+	c := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(c).(color.RGBA), nil
+}
@@ -0,0 +1,115 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_LoadPlotStyle(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		f := filepath.Join(dir, "style.json")
+		if err := os.WriteFile(f, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		got, err := LoadPlotStyle(write(`{"Theme": "dark", "Palette": ["#e63946", "#3f37c9"], "Font": "fonts/brand.ttf", "LegendYOffset": 0}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		zero := 0.0
+		want := PlotStyle{
+			Theme:         ThemeDark,
+			Palette:       []string{"#e63946", "#3f37c9"},
+			Font:          filepath.Join(dir, "fonts", "brand.ttf"),
+			LegendYOffset: &zero,
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("PlotStyle mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	for name, content := range map[string]string{
+		"Unknown field":  `{"Colour": "#ffffff"}`,
+		"Invalid theme":  `{"Theme": "solarized"}`,
+		"Invalid legend": `{"Legend": "left"}`,
+		"Invalid color":  `{"Palette": ["red"]}`,
+		"Negative size":  `{"TickSize": -1}`,
+		"Malformed JSON": `{"Theme": `,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadPlotStyle(write(content)); err == nil {
+				t.Error("Expected error, got <nil>")
+			}
+		})
+	}
+}
+
+func Test_parseHexColor(t *testing.T) {
+	tests := map[string]struct {
+		given string
+		want  color.RGBA
+	}{
+		"RGB":         {given: "#e63946", want: color.RGBA{R: 230, G: 57, B: 70, A: 255}},
+		"RGBA":        {given: "#FF000080", want: color.RGBA{R: 128, G: 0, B: 0, A: 128}},
+		"Transparent": {given: "#ffffff00", want: color.RGBA{}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseHexColor(tc.given)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("parseHexColor() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	for _, v := range []string{"e63946", "#e6394", "#gg0000", "#e639461"} {
+		if _, err := parseHexColor(v); err == nil {
+			t.Errorf("Expected error for %q", v)
+		}
+	}
+}
+
+func Test_WithColors(t *testing.T) {
+	bg := color.RGBA{R: 16, G: 32, B: 48, A: 255}
+	short := []color.RGBA{{R: 1, A: 255}, {G: 2, A: 255}}
+	o := newPlotOptions("", WithColors(Colors{Background: bg, Palette: short}))
+	th := o.theme()
+	if diff := cmp.Diff(len(ColorPalette), len(th.palette)); diff != "" {
+		t.Errorf("Palette size mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(short[1], th.palette[3]); diff != "" {
+		t.Errorf("Palette wrap-around mismatch (-want +got):\n%s", diff)
+	}
+	if th.foreground != lightTheme.foreground {
+		t.Errorf("Expected theme foreground to be kept")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteVqmPlot(&buf, getVmafValues(), "VMAF", "Test plot title", WithColors(Colors{Background: bg})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Top left corner is always plot background.
+	if diff := cmp.Diff(bg, color.RGBAModel.Convert(img.At(0, 0))); diff != "" {
+		t.Errorf("Background color mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Plot color themes.
+
+package analysis
+
+import (
+	"image/color"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+)
+
+// Plot themes.
+const (
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+)
+
+// IsTheme reports whether t is a valid plot theme.
+func IsTheme(t string) bool {
+	switch t {
+	case ThemeLight, ThemeDark:
+		return true
+	}
+	return false
+}
+
+// theme holds plot colors.
+type theme struct {
+	background color.Color
+	// Text, axes and tick color
+	foreground color.Color
+	grid       color.Color
+	// Series colors, indexed same as ColorPalette
+	palette []color.RGBA
+}
+
+var (
+	// lightTheme is gonum's default look.
+	lightTheme = theme{
+		background: color.White,
+		foreground: color.Black,
+		grid:       color.Gray{Y: 128},
+		palette:    ColorPalette,
+	}
+	// darkTheme uses lightened ColorPalette, so that darker palette colors
+	// stay legible on dark background.
+	darkTheme = theme{
+		background: color.RGBA{R: 30, G: 30, B: 30, A: 255},
+		foreground: color.Gray{Y: 220},
+		grid:       color.Gray{Y: 80},
+		palette:    lighten(ColorPalette, 0.35),
+	}
+)
+
+// lighten returns copy of palette with each color mixed with white in given
+// proportion (0..1).
+func lighten(palette []color.RGBA, amount float64) []color.RGBA {
+	mix := func(c uint8) uint8 {
+		return c + uint8(float64(255-c)*amount)
+	}
+	res := make([]color.RGBA, len(palette))
+	for i, c := range palette {
+		res[i] = color.RGBA{R: mix(c.R), G: mix(c.G), B: mix(c.B), A: c.A}
+	}
+	return res
+}
+
+// theme returns plot theme according to theme option, light theme is default.
+// Colors set via WithColors override theme's colors.
+func (o *plotOptions) theme() *theme {
+	t := lightTheme
+	if o.themeName == ThemeDark {
+		t = darkTheme
+	}
+	if o.colors.Background != nil {
+		t.background = o.colors.Background
+	}
+	if o.colors.Foreground != nil {
+		t.foreground = o.colors.Foreground
+	}
+	if o.colors.Grid != nil {
+		t.grid = o.colors.Grid
+	}
+	if n := len(o.colors.Palette); n != 0 {
+		// Plots pick palette colors by fixed index, so shorter palette is
+		// repeated up to ColorPalette length.
+		size := len(ColorPalette)
+		if n > size {
+			size = n
+		}
+		t.palette = make([]color.RGBA, size)
+		for i := range t.palette {
+			t.palette[i] = o.colors.Palette[i%n]
+		}
+	}
+	return &t
+}
+
+// newPlot creates new plot with theme's background, text and axes colors.
+func (t *theme) newPlot() *plot.Plot {
+	p := plot.New()
+	p.BackgroundColor = t.background
+	p.Title.TextStyle.Color = t.foreground
+	p.Legend.TextStyle.Color = t.foreground
+	for _, a := range []*plot.Axis{&p.X, &p.Y} {
+		a.Color = t.foreground
+		a.Label.TextStyle.Color = t.foreground
+		a.Tick.Color = t.foreground
+		a.Tick.Label.Color = t.foreground
+	}
+	return p
+}
+
+// newGrid creates new grid with theme's grid color.
+func (t *theme) newGrid() *plotter.Grid {
+	g := plotter.NewGrid()
+	g.Vertical.Color = t.grid
+	g.Horizontal.Color = t.grid
+	return g
+}
+
+// styleLabels sets theme's text color to labels.
+func (t *theme) styleLabels(l *plotter.Labels) {
+	for i := range l.TextStyle {
+		l.TextStyle[i].Color = t.foreground
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gonum.org/v1/plot"
+)
+
+func Test_IsTheme(t *testing.T) {
+	for _, v := range []string{ThemeLight, ThemeDark} {
+		if !IsTheme(v) {
+			t.Errorf("Expected %q to be valid theme", v)
+		}
+	}
+	if IsTheme("solarized") {
+		t.Error("Expected invalid theme to be rejected")
+	}
+}
+
+func Test_lighten(t *testing.T) {
+	got := lighten([]color.RGBA{{R: 0, G: 100, B: 255, A: 255}}, 0.5)
+	want := []color.RGBA{{R: 127, G: 177, B: 255, A: 255}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("lighten() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_WriteVqmPlot_Theme(t *testing.T) {
+	vmafs := getVmafValues()
+	tests := map[string]struct {
+		opts []PlotOption
+		want color.Color
+	}{
+		"Default is light": {want: lightTheme.background},
+		"Light":            {opts: []PlotOption{WithTheme(ThemeLight)}, want: lightTheme.background},
+		"Dark":             {opts: []PlotOption{WithTheme(ThemeDark)}, want: darkTheme.background},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteVqmPlot(&buf, vmafs, "VMAF", "Test plot title", tc.opts...); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			img, err := png.Decode(&buf)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// Top left corner is always plot background.
+			got := color.RGBAModel.Convert(img.At(0, 0))
+			want := color.RGBAModel.Convert(tc.want)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Background color mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_CreatePlots_Theme(t *testing.T) {
+	opts := []PlotOption{WithTheme(ThemeDark)}
+	rd, err := CreateRDPlot(map[string][]RDPoint{"x264": {{Bitrate: 1000, VMAF: 80}}}, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cdf, err := CreateMultiCDFPlot(map[string][]float64{"x264": getVmafValues()}, "VMAF", opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for name, p := range map[string]*plot.Plot{"RD": rd, "Multi CDF": cdf} {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(darkTheme.background, p.BackgroundColor); diff != "" {
+				t.Errorf("Background color mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
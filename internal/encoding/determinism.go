@@ -0,0 +1,93 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Encoder determinism check, e.g. for caching and reproducibility decisions.
+
+package encoding
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+)
+
+// determinismSuffix is appended to names of measured run's files while
+// encoding command runs second time.
+const determinismSuffix = ".determinism"
+
+// determinism will check determinism of encoding command and record result
+// in r, failure to check is logged.
+func (s *EncoderCmd) determinism(ctx context.Context, r *RunResult) {
+	logging.Infof("Determinism check encoding %s -> %s", s.SourceFile, s.CompressedFile)
+	same, err := s.checkDeterminism(ctx)
+	if err != nil {
+		logging.Infof("Unable to check determinism of %s: %s", s.CompressedFile, err)
+		return
+	}
+	if !same {
+		logging.Infof("Encoding of %s is not deterministic, second run produced different output", s.CompressedFile)
+	}
+	r.Deterministic = &same
+}
+
+// checkDeterminism will run encoding command second time and compare
+// compressed files of both runs byte for byte. Compressed and output files of
+// measured run are kept.
+//
+// Returned error means determinism could not be checked (e.g. second run
+// failed).
+func (s *EncoderCmd) checkDeterminism(ctx context.Context) (bool, error) {
+	first, err := fileChecksum(s.CompressedFile)
+	if err != nil {
+		return false, fmt.Errorf("checkDeterminism() %w", err)
+	}
+
+	// Move measured run's files aside, so that encoders refusing to
+	// overwrite existing files do not fail second run.
+	kept := []string{s.CompressedFile, s.OutputFile}
+	for i, name := range kept {
+		if err := os.Rename(name, name+determinismSuffix); err != nil {
+			for _, n := range kept[:i] {
+				_ = os.Rename(n+determinismSuffix, n)
+			}
+			return false, fmt.Errorf("checkDeterminism() %w", err)
+		}
+	}
+	defer func() {
+		for _, name := range kept {
+			if err := os.Rename(name+determinismSuffix, name); err != nil {
+				logging.Infof("Unable to restore %s: %s", name, err)
+			}
+		}
+	}()
+
+	r := s.RunContext(ctx)
+	if len(r.Errors) != 0 {
+		return false, fmt.Errorf("checkDeterminism() second run: %v", r.Errors)
+	}
+	second, err := fileChecksum(s.CompressedFile)
+	if err != nil {
+		return false, fmt.Errorf("checkDeterminism() %w", err)
+	}
+	return bytes.Equal(first, second), nil
+}
+
+// fileChecksum returns SHA-256 checksum of file content.
+func fileChecksum(name string) ([]byte, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,81 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEncodingPlanRunDeterminism(t *testing.T) {
+	outDir := t.TempDir()
+	planConfig := PlanConfig{
+		Inputs: []string{"../../testdata/video/testsrc01.mp4"},
+		Schemes: []Scheme{
+			{Name: "copy", CommandTpl: "cp %INPUT% %OUTPUT%.mp4"},
+		},
+		OutDir: outDir,
+	}
+	plan := NewPlan(planConfig)
+	plan.CheckDeterminism = true
+
+	gotResult, err := plan.Run()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := gotResult.RunResults[0].Deterministic
+	if got == nil || !*got {
+		t.Errorf("Expected deterministic encoding, got: %v", got)
+	}
+	if _, err := os.Stat(gotResult.RunResults[0].CompressedFile + determinismSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected no leftover files, got: %v", err)
+	}
+}
+
+func TestEncoderCmd_checkDeterminism(t *testing.T) {
+	outDir := t.TempDir()
+	cmd := EncoderCmd{
+		Name:           "failing",
+		CompressedFile: path.Join(outDir, "clip_failing.mp4"),
+		OutputFile:     path.Join(outDir, "clip_failing.out"),
+		Cmd:            "exit 1",
+	}
+	for _, name := range []string{cmd.CompressedFile, cmd.OutputFile} {
+		if err := os.WriteFile(name, []byte("measured"), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	t.Run("Should fail when second run fails", func(t *testing.T) {
+		if _, err := cmd.checkDeterminism(context.Background()); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+	t.Run("Should keep measured run's files", func(t *testing.T) {
+		for _, name := range []string{cmd.CompressedFile, cmd.OutputFile} {
+			b, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff("measured", string(b)); diff != "" {
+				t.Errorf("%s content mismatch (-want +got):\n%s", name, diff)
+			}
+			if _, err := os.Stat(name + determinismSuffix); !os.IsNotExist(err) {
+				t.Errorf("Expected no leftover files, got: %v", err)
+			}
+		}
+	})
+	t.Run("Should fail without measured run's output", func(t *testing.T) {
+		c := cmd
+		c.CompressedFile = path.Join(outDir, "missing.mp4")
+		if _, err := c.checkDeterminism(context.Background()); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
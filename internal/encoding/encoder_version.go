@@ -0,0 +1,52 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Encoder version detection from encoder output.
+
+package encoding
+
+import (
+	"regexp"
+	"strings"
+)
+
+// encoderVersionPattern maps encoder output line to a version string.
+type encoderVersionPattern struct {
+	// Encoder name prefixed to version
+	name string
+	// Regexp with version as first submatch
+	re *regexp.Regexp
+}
+
+// encoderVersionPatterns are matched in order, first match wins. Library
+// banners are preferred as they carry exact build, Lavc encoder tag from
+// output metadata is the fallback.
+var encoderVersionPatterns = []encoderVersionPattern{
+	{"x264", regexp.MustCompile(`\[libx264 @ [^\]]*\] 264 - (core \d+(?: r\d+ [0-9a-f]+)?)`)},
+	{"x265", regexp.MustCompile(`x265 \[info\]: HEVC encoder version (\S+)`)},
+	{"SVT-AV1", regexp.MustCompile(`SVT-AV1 Encoder Lib (v\S+)`)},
+	{"libaom", regexp.MustCompile(`\[libaom-av1 @ [^\]]*\] (v\S+)`)},
+	{"libvpx", regexp.MustCompile(`\[libvpx(?:-vp9)? @ [^\]]*\] (v\S+)`)},
+}
+
+// lavcEncoderRe matches encoder tag of ffmpeg's stream metadata, e.g.
+// "encoder         : Lavc60.3.100 libx264".
+var lavcEncoderRe = regexp.MustCompile(`(?m)^\s+encoder\s+: (Lavc\S+ \S+)\s*$`)
+
+// parseEncoderVersion will extract encoder version from encoder output, empty
+// string is returned when version is not found (e.g. output is silenced via
+// -loglevel).
+func parseEncoderVersion(output []byte) string {
+	for _, p := range encoderVersionPatterns {
+		if m := p.re.FindSubmatch(output); m != nil {
+			return p.name + " " + string(m[1])
+		}
+	}
+	// Input metadata is printed before output metadata, so last match is
+	// the one describing compressed stream.
+	if m := lavcEncoderRe.FindAllSubmatch(output, -1); m != nil {
+		return strings.TrimSpace(string(m[len(m)-1][1]))
+	}
+	return ""
+}
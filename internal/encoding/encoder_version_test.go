@@ -0,0 +1,52 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import "testing"
+
+func Test_parseEncoderVersion(t *testing.T) {
+	tests := map[string]struct {
+		output string
+		want   string
+	}{
+		"x264": {
+			output: "[libx264 @ 0x55d0c1a3b2c0] using cpu capabilities: MMX2 SSE2Fast\n" +
+				"[libx264 @ 0x55d0c1a3b2c0] profile High, level 4.0, 4:2:0, 8-bit\n" +
+				"[libx264 @ 0x55d0c1a3b2c0] 264 - core 164 r3095 baee400 - H.264/MPEG-4 AVC codec\n",
+			want: "x264 core 164 r3095 baee400",
+		},
+		"x265": {
+			output: "x265 [info]: HEVC encoder version 3.5+1-f0c1022b6\nx265 [info]: build info [Linux][GCC 11.2.0][64 bit] 8bit\n",
+			want:   "x265 3.5+1-f0c1022b6",
+		},
+		"SVT-AV1": {
+			output: "Svt[info]: SVT [version]:\tSVT-AV1 Encoder Lib v1.4.1\n",
+			want:   "SVT-AV1 v1.4.1",
+		},
+		"libvpx-vp9": {
+			output: "[libvpx-vp9 @ 0x5581f0c4e340] v1.13.0\n",
+			want:   "libvpx v1.13.0",
+		},
+		"Lavc fallback uses output stream": {
+			output: "Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'src.mp4':\n" +
+				"      encoder         : Lavc58.134.100 libx264\n" +
+				"Output #0, mp4, to 'out.mp4':\n" +
+				"      encoder         : Lavc60.3.100 libaom-av1\n",
+			want: "Lavc60.3.100 libaom-av1",
+		},
+		"Not found": {
+			output: "frame=  250 fps= 50 q=-1.0 Lsize=    1024kB time=00:00:10.00\n",
+			want:   "",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := parseEncoderVersion([]byte(tc.output))
+			if got != tc.want {
+				t.Errorf("parseEncoderVersion() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
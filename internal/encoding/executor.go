@@ -0,0 +1,230 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/tools"
+)
+
+// Executor executes encoder command lines.
+//
+// This is an extension point for running encodings elsewhere than on local
+// host (e.g. on remote workers).
+type Executor interface {
+	// Execute will run command line cmdLine writing it's stderr to stderr.
+	// Command should be terminated when ctx is done before command completes.
+	//
+	// Returned ExecResult is used for exit code and resource usage stats,
+	// fields that are not available are left zero (ExitCode -1).
+	Execute(ctx context.Context, cmdLine string, stderr io.Writer) (ExecResult, error)
+}
+
+// ExecResult is exit code and resource usage of command executed by Executor.
+type ExecResult struct {
+	// ExitCode of command, -1 in case command did not start or did not
+	// complete
+	ExitCode int
+	// Utime and Stime are user and system CPU time of command's processes
+	Utime time.Duration
+	Stime time.Duration
+	// MaxRss is KB, a peak RSS of the largest process among command's
+	// processes
+	MaxRss int64
+	// PeakRss is KB, a sampled peak of total RSS of all command's processes,
+	// 0 in case it is not sampled
+	PeakRss int64
+}
+
+// newExecResult will create ExecResult from state of finished process, nil
+// state means command did not start.
+func newExecResult(state *os.ProcessState) ExecResult {
+	if state == nil {
+		return ExecResult{ExitCode: -1}
+	}
+	res := ExecResult{ExitCode: state.ExitCode()}
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok && rusage != nil {
+		res.Utime = time.Duration(syscall.TimevalToNsec(rusage.Utime))
+		res.Stime = time.Duration(syscall.TimevalToNsec(rusage.Stime))
+		res.MaxRss = maxRssKB(rusage)
+	}
+	return res
+}
+
+// Make sure LocalExecutor implements Executor interface.
+var _ Executor = LocalExecutor{}
+
+// I/O scheduling classes for encoder processes.
+const (
+	IOClassBestEffort = "best-effort"
+	IOClassIdle       = "idle"
+)
+
+// Shells encoder commands are run with.
+const (
+	// ShellSh runs commands via "sh -c", this is the default
+	ShellSh = "sh"
+	// ShellBash runs commands via "bash -c"
+	ShellBash = "bash"
+	// ShellNone executes commands directly without shell, commands using
+	// shell features (e.g. pipes or redirects) fail
+	ShellNone = "none"
+	// ShellAuto executes commands directly unless they use shell features,
+	// in which case ShellSh is used
+	ShellAuto = "auto"
+)
+
+// LocalExecutor is a default Executor which runs commands on local host via
+// shell.
+//
+// Zero value runs commands via "sh -c" with priority of ease process itself.
+type LocalExecutor struct {
+	// Nice is a niceness (-20..19) of command processes relative to ease
+	// process, 0 means no change
+	Nice int
+	// IOClass is an I/O scheduling class (IOClassBestEffort or IOClassIdle)
+	// of command processes, empty means no change, Linux only
+	IOClass string
+	// Shell commands are run with (e.g. ShellBash or ShellAuto), empty means
+	// ShellSh
+	Shell string
+	// Env is additional environment variables (in "key=value" form) of
+	// commands, commands inherit environment of ease process itself
+	Env []string
+}
+
+// Execute will run cmdLine via shell, on ctx done shell is killed along with
+// all it's child processes. Peak RSS of all command's processes is sampled (see
+// newTreeRssSampler).
+func (e LocalExecutor) Execute(ctx context.Context, cmdLine string, stderr io.Writer) (ExecResult, error) {
+	cmd, err := e.command(cmdLine)
+	if err != nil {
+		return newExecResult(nil), err
+	}
+	if len(e.Env) != 0 {
+		cmd.Env = append(os.Environ(), e.Env...)
+	}
+	// Run command in it's own process group, so that on cancellation we can
+	// kill shell along with all it's child processes.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stderr = stderr
+	tools.SetPriority(cmd, e.Nice, e.IOClass)
+	var sampler *rssSampler
+	err = runContext(ctx, cmd, func(pid int) {
+		sampler = startRssSampler(pid, rssSampleInterval)
+	})
+	res := newExecResult(cmd.ProcessState)
+	if sampler != nil {
+		res.PeakRss = sampler.stop()
+	}
+	return res, err
+}
+
+// command will create exec.Cmd for cmdLine according to Shell setting.
+func (e LocalExecutor) command(cmdLine string) (*exec.Cmd, error) {
+	// Encoder commands come in different flavours and in some cases commands
+	// can make use various commands connected via pipes, this can be supported
+	// by employing shell to execute commands. We trust user to provide safe
+	// encoder command, otherwise this can be a security issue.
+	switch e.Shell {
+	case "", ShellSh:
+		return exec.Command("sh", "-c", cmdLine), nil //#nosec G204
+	case ShellBash:
+		return exec.Command("bash", "-c", cmdLine), nil //#nosec G204
+	}
+
+	args, needsShell := splitCommand(cmdLine)
+	switch {
+	case e.Shell != ShellNone && e.Shell != ShellAuto:
+		return nil, fmt.Errorf("unsupported shell: %s", e.Shell)
+	case needsShell && e.Shell == ShellAuto:
+		logging.Debugf("Command needs shell, running via sh: %s", cmdLine)
+		return exec.Command("sh", "-c", cmdLine), nil //#nosec G204
+	case needsShell:
+		return nil, fmt.Errorf("command needs shell (e.g. uses pipes or redirects): %s", cmdLine)
+	}
+	// Direct execution spares shell process, so that usage stats are those
+	// of encoder itself.
+	return exec.Command(args[0], args[1:]...), nil //#nosec G204
+}
+
+// rssSampleInterval is an interval of process tree RSS sampling.
+const rssSampleInterval = 100 * time.Millisecond
+
+// rssSampler periodically samples RSS of a process tree and keeps the peak
+// value.
+type rssSampler struct {
+	done   chan struct{}
+	result chan int64
+}
+
+// startRssSampler will start sampling RSS of process pid and it's descendants
+// every interval until stopped.
+func startRssSampler(pid int, interval time.Duration) *rssSampler {
+	s := &rssSampler{done: make(chan struct{}), result: make(chan int64, 1)}
+	sample := newTreeRssSampler(pid)
+	go func() {
+		var peak int64
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if rss := sample(); rss > peak {
+				peak = rss
+			}
+			select {
+			case <-s.done:
+				s.result <- peak
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// stop will stop sampling and return peak RSS in KB.
+func (s *rssSampler) stop() int64 {
+	close(s.done)
+	return <-s.result
+}
+
+// runContext will run cmd and kill cmd's process group when ctx is done,
+// started is called with cmd's pid once cmd is started.
+//
+// Cmd is expected to be started as process group leader (Setpgid).
+func runContext(ctx context.Context, cmd *exec.Cmd, started func(pid int)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	started(cmd.Process.Pid)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Negative pid means whole process group.
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %s", ctx.Err(), err)
+	}
+	return err
+}
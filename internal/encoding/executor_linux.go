@@ -0,0 +1,147 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// newTreeRssSampler returns function sampling RSS in KB of process pid and all
+// it's descendants.
+//
+// Descendants are found via parent pid in /proc/<pid>/stat, each process is
+// classified once, so that a sample reads /proc files of tree processes and of
+// processes started since previous sample only. Total of current RSS (VmRSS)
+// is returned unless any of processes had a higher peak RSS (VmHWM) by itself,
+// e.g. short lived process that happened to be between samples.
+func newTreeRssSampler(pid int) func() int64 {
+	// Classified processes, true means process belongs to tree.
+	inTree := map[int]bool{pid: true}
+	return func() int64 {
+		pids, err := listPids()
+		if err != nil {
+			return 0
+		}
+		alive := make(map[int]struct{}, len(pids))
+		parents := make(map[int]int)
+		for _, p := range pids {
+			alive[p] = struct{}{}
+			if _, ok := inTree[p]; ok {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(p), "stat"))
+			if err != nil {
+				// Process is gone already.
+				continue
+			}
+			if ppid, ok := parseStatPpid(data); ok {
+				parents[p] = ppid
+			}
+		}
+		// Parent of new process can be a new process as well.
+		var member func(p int) bool
+		member = func(p int) bool {
+			if v, ok := inTree[p]; ok {
+				return v
+			}
+			ppid, ok := parents[p]
+			if !ok {
+				return false
+			}
+			v := member(ppid)
+			inTree[p] = v
+			return v
+		}
+		for p := range parents {
+			member(p)
+		}
+		var total, hwm int64
+		for p, ok := range inTree {
+			if _, isAlive := alive[p]; !isAlive {
+				// Pid might be reused by unrelated process later on.
+				if p != pid {
+					delete(inTree, p)
+				}
+				continue
+			}
+			if !ok {
+				continue
+			}
+			status, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(p), "status"))
+			if err != nil {
+				continue
+			}
+			total += parseStatusKB(status, "VmRSS:")
+			if v := parseStatusKB(status, "VmHWM:"); v > hwm {
+				hwm = v
+			}
+		}
+		if hwm > total {
+			return hwm
+		}
+		return total
+	}
+}
+
+// listPids returns pids of all running processes.
+func listPids() ([]int, error) {
+	d, err := os.Open("/proc")
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int, 0, len(names))
+	for _, name := range names {
+		if pid, err := strconv.Atoi(name); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// parseStatPpid will parse parent process id from /proc/<pid>/stat content.
+func parseStatPpid(data []byte) (int, bool) {
+	// Command name is in parentheses and can contain spaces, so fields are
+	// counted from the last closing parenthesis: state, ppid, pgrp, ...
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, false
+	}
+	fields := bytes.Fields(data[i+1:])
+	if len(fields) < 2 {
+		return 0, false
+	}
+	ppid, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return 0, false
+	}
+	return ppid, true
+}
+
+// parseStatusKB will parse value of key (e.g. "VmRSS:") in KB from
+// /proc/<pid>/status content, 0 is returned when key is missing.
+func parseStatusKB(data []byte, key string) int64 {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := bytes.Fields(sc.Bytes())
+		if len(fields) < 2 || string(fields[0]) != key {
+			continue
+		}
+		v, err := strconv.ParseInt(string(fields[1]), 10, 64)
+		if err != nil {
+			return 0
+		}
+		return v
+	}
+	return 0
+}
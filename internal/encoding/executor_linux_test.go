@@ -0,0 +1,104 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseStatPpid(t *testing.T) {
+	tests := map[string]struct {
+		given  string
+		want   int
+		wantOk bool
+	}{
+		"Regular stat": {
+			given:  "1234 (ffmpeg) S 1200 1201 1100 0 -1 4194304 100",
+			want:   1200,
+			wantOk: true,
+		},
+		"Command name with spaces and parentheses": {
+			given:  "1234 (my (enc) oder) R 1202 1201 1100 0",
+			want:   1202,
+			wantOk: true,
+		},
+		"Truncated stat": {
+			given:  "1234 (ffmpeg) S",
+			wantOk: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := parseStatPpid([]byte(tc.given))
+			if diff := cmp.Diff(tc.wantOk, ok); diff != "" {
+				t.Fatalf("ok mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("ppid mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_parseStatusKB(t *testing.T) {
+	given := []byte("Name:\tffmpeg\nVmHWM:\t  204800 kB\nVmRSS:\t  102400 kB\n")
+	if diff := cmp.Diff(int64(102400), parseStatusKB(given, "VmRSS:")); diff != "" {
+		t.Errorf("VmRSS mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(int64(204800), parseStatusKB(given, "VmHWM:")); diff != "" {
+		t.Errorf("VmHWM mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(int64(0), parseStatusKB(given, "VmSwap:")); diff != "" {
+		t.Errorf("Missing key mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLocalExecutorPeakRss(t *testing.T) {
+	res, err := LocalExecutor{}.Execute(context.Background(), "sleep 0.3", io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.PeakRss <= 0 {
+		t.Errorf("Expected sampled peak RSS > 0, got %d", res.PeakRss)
+	}
+}
+
+func Test_newTreeRssSampler(t *testing.T) {
+	// Shell waiting for it's children, so that tree has several processes.
+	cmd := exec.Command("sh", "-c", "sleep 2 & sleep 2 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", cmd.Process.Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sampler returns peak RSS of a single process in case it is higher.
+	shellRss := parseStatusKB(status, "VmHWM:")
+
+	sample := newTreeRssSampler(cmd.Process.Pid)
+	// Children are started asynchronously.
+	var got int64
+	for i := 0; i < 20 && got <= shellRss; i++ {
+		time.Sleep(10 * time.Millisecond)
+		got = sample()
+	}
+	if got <= shellRss {
+		t.Errorf("Expected tree RSS > shell RSS %d KB, got %d KB", shellRss, got)
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package encoding
+
+// newTreeRssSampler is not supported on platforms other than Linux, returned
+// function always returns 0.
+func newTreeRssSampler(pid int) func() int64 {
+	return func() int64 { return 0 }
+}
@@ -0,0 +1,106 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Post-encode hook, a user command run after each encoding (e.g. upload to
+// storage or webhook notification).
+
+package encoding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+)
+
+// Hook is a user command run after each encoding.
+//
+// Encoding run result is passed to command via EASE_* environment variables
+// (see HookEnv).
+type Hook struct {
+	// Cmd is command line, it is run the same way as encoder commands (see
+	// PlanConfig.Shell)
+	Cmd string
+	// AfterVQM runs hook after VQM measurement instead of right after
+	// encoding, so that VQMs are passed to hook as well
+	AfterVQM bool `json:",omitempty"`
+	// FailRun makes hook failure fail the run, otherwise failures are only
+	// logged
+	FailRun bool `json:",omitempty"`
+}
+
+// validate checks Hook values, nil Hook is valid.
+func (h *Hook) validate() error {
+	if h == nil {
+		return nil
+	}
+	if strings.TrimSpace(h.Cmd) == "" {
+		return errors.New("Cmd missing")
+	}
+	return nil
+}
+
+// HookEnv returns environment variables describing encoding run result r for
+// post-encode hook.
+func HookEnv(r *RunResult) []string {
+	status := "ok"
+	var errs []string
+	for _, e := range r.Errors {
+		errs = append(errs, e.Error())
+	}
+	if len(errs) != 0 {
+		status = "failed"
+	}
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return []string{
+		"EASE_SCHEME=" + r.Name,
+		"EASE_SOURCE_FILE=" + r.SourceFile,
+		"EASE_COMPRESSED_FILE=" + r.CompressedFile,
+		"EASE_OUTPUT_FILE=" + r.OutputFile,
+		"EASE_STATUS=" + status,
+		"EASE_ERRORS=" + strings.Join(errs, "; "),
+		"EASE_EXIT_CODE=" + strconv.Itoa(r.ExitCode()),
+		"EASE_ELAPSED=" + f(r.Stats.Elapsed.Seconds()),
+		"EASE_VIDEO_DURATION=" + f(r.VideoDuration),
+		"EASE_ENCODING_SPEED=" + f(r.AvgEncodingSpeed),
+	}
+}
+
+// RunHook will run plan's post-encode hook with given environment variables,
+// error is returned in case hook command fails. Plan without hook is a no-op.
+func (s *Plan) RunHook(ctx context.Context, env []string) error {
+	if s.PostEncodeHook == nil {
+		return nil
+	}
+	var stderr bytes.Buffer
+	e := LocalExecutor{Nice: s.Nice, IOClass: s.IOClass, Shell: s.Shell, Env: env}
+	if _, err := e.Execute(ctx, s.PostEncodeHook.Cmd, &stderr); err != nil {
+		if out := lastLines(stderr.Bytes(), outputTailLines); len(out) != 0 {
+			return fmt.Errorf("post-encode hook: %w: %s", err, strings.Join(out, "\n"))
+		}
+		return fmt.Errorf("post-encode hook: %w", err)
+	}
+	return nil
+}
+
+// postEncodeHook will run post-encode hook for encoding run result r unless
+// hook is configured to run after VQM, hook failure is recorded in r if hook
+// is configured to fail the run.
+func (s *Plan) postEncodeHook(ctx context.Context, r *RunResult) {
+	if s.PostEncodeHook == nil || s.PostEncodeHook.AfterVQM {
+		return
+	}
+	if err := s.RunHook(ctx, HookEnv(r)); err != nil {
+		logging.Infof("Hook failed for %s: %s", r.CompressedFile, err)
+		if s.PostEncodeHook.FailRun {
+			r.AddError(err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHookEnv(t *testing.T) {
+	r := &RunResult{
+		EncoderCmd:       EncoderCmd{Name: "x264", SourceFile: "src.mp4", CompressedFile: "out.mp4", OutputFile: "out.out"},
+		VideoDuration:    10,
+		AvgEncodingSpeed: 2.5,
+	}
+	r.AddError(errors.New("boom"))
+	r.Stats.Elapsed = 4e9
+
+	want := []string{
+		"EASE_SCHEME=x264",
+		"EASE_SOURCE_FILE=src.mp4",
+		"EASE_COMPRESSED_FILE=out.mp4",
+		"EASE_OUTPUT_FILE=out.out",
+		"EASE_STATUS=failed",
+		"EASE_ERRORS=boom",
+		"EASE_EXIT_CODE=-1",
+		"EASE_ELAPSED=4",
+		"EASE_VIDEO_DURATION=10",
+		"EASE_ENCODING_SPEED=2.5",
+	}
+	if diff := cmp.Diff(want, HookEnv(r)); diff != "" {
+		t.Errorf("Hook environment mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlanPostEncodeHook(t *testing.T) {
+	outFile := path.Join(t.TempDir(), "hook.out")
+	tests := map[string]struct {
+		hook       *Hook
+		wantErrors int
+	}{
+		"No hook":            {},
+		"Hook after VQM":     {hook: &Hook{Cmd: "false", AfterVQM: true, FailRun: true}},
+		"Hook failure":       {hook: &Hook{Cmd: "false"}},
+		"Hook fails the run": {hook: &Hook{Cmd: "echo $EASE_SCHEME >&2; false", FailRun: true}, wantErrors: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := Plan{PlanConfig: PlanConfig{PostEncodeHook: tc.hook}}
+			r := RunResult{EncoderCmd: EncoderCmd{Name: "sc1", OutputFile: outFile}}
+			p.postEncodeHook(context.Background(), &r)
+			if diff := cmp.Diff(tc.wantErrors, len(r.Errors)); diff != "" {
+				t.Errorf("Errors mismatch (-want +got):\n%s", diff)
+			}
+			if tc.wantErrors != 0 && !strings.Contains(r.Errors[0].Error(), "sc1") {
+				t.Errorf("Expected hook output in error, got: %v", r.Errors[0])
+			}
+		})
+	}
+}
+
+func TestLocalExecutorEnv(t *testing.T) {
+	var stderr strings.Builder
+	e := LocalExecutor{Env: []string{"EASE_TEST=hook"}}
+	if _, err := e.Execute(context.Background(), "echo $EASE_TEST >&2", &stderr); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("hook", strings.TrimSpace(stderr.String())); diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LintIssue is a likely mistake in PlanConfig found by Lint.
+type LintIssue struct {
+	// Fatal issues make plan unusable (e.g. encodings overwriting each
+	// other), others are warnings.
+	Fatal   bool
+	Message string
+}
+
+func (i LintIssue) String() string {
+	if i.Fatal {
+		return "[ERROR] " + i.Message
+	}
+	return "[WARN] " + i.Message
+}
+
+// nondeterministicMatcher matches shell constructs in command template that
+// make command differ between runs (command substitution, random numbers,
+// timestamps).
+var nondeterministicMatcher = regexp.MustCompile("\\$\\(|`|\\$\\{?(RANDOM|SRANDOM|EPOCHSECONDS|EPOCHREALTIME)\\b")
+
+// Lint will statically analyse PlanConfig for likely mistakes, this goes
+// beyond IsValid() which only checks that plan is usable at all.
+//
+// Schemes are expanded the same way as in NewPlan to reason about output file
+// collisions.
+func (p *PlanConfig) Lint() (issues []LintIssue) {
+	fatalf := func(format string, a ...interface{}) {
+		issues = append(issues, LintIssue{Fatal: true, Message: fmt.Sprintf(format, a...)})
+	}
+	warnf := func(format string, a ...interface{}) {
+		issues = append(issues, LintIssue{Message: fmt.Sprintf(format, a...)})
+	}
+
+	// Same name is fine for schemes restricted to different inputs (e.g.
+	// effective plan).
+	reported := make(map[string]bool)
+	for i := range p.Schemes {
+		for j := 0; j < i; j++ {
+			a, b := &p.Schemes[j], &p.Schemes[i]
+			if a.Name == b.Name && !reported[a.Name] && schemesOverlap(a, b) {
+				reported[a.Name] = true
+				fatalf("Scheme name %q used more than once", a.Name)
+			}
+		}
+	}
+
+	// Outputs of all expanded commands (including remuxes) must be unique,
+	// otherwise encodings overwrite each other.
+	plan := NewPlan(*p)
+	var files []string
+	writers := make(map[string][]string)
+	for _, c := range plan.Commands {
+		for _, f := range []string{c.CompressedFile, c.OutputFile} {
+			if _, ok := writers[f]; !ok {
+				files = append(files, f)
+			}
+			writers[f] = append(writers[f], fmt.Sprintf("%s(%s)", c.Name, c.SourceFile))
+		}
+	}
+	for _, f := range files {
+		if len(writers[f]) > 1 {
+			fatalf("Output %s written by: %s", f, strings.Join(writers[f], ", "))
+		}
+	}
+
+	var withY, withoutY []string
+	for _, s := range p.Schemes {
+		if !ffmpegMatcher.MatchString(s.CommandTpl) {
+			continue
+		}
+		args := strings.Fields(s.CommandTpl)
+		if contains(args, "-y") {
+			withY = append(withY, s.Name)
+		} else {
+			withoutY = append(withoutY, s.Name)
+		}
+		// Only video is compared, so encoding audio is wasted effort and
+		// skews encoding time and size figures.
+		if !contains(args, "-an") {
+			warnf("Scheme %s has no -an, audio is encoded although only video is compared", s.Name)
+		}
+	}
+	if len(withY) > 0 && len(withoutY) > 0 {
+		warnf("Option -y used inconsistently, missing in schemes: %s", strings.Join(withoutY, ", "))
+	}
+
+	for _, s := range p.Schemes {
+		if m := nondeterministicMatcher.FindString(s.CommandTpl); m != "" {
+			warnf("Scheme %s command is not deterministic (contains %q)", s.Name, m)
+		}
+	}
+
+	return issues
+}
+
+// schemesOverlap reports whether schemes are applied to any common input.
+func schemesOverlap(a, b *Scheme) bool {
+	if len(a.Inputs) == 0 || len(b.Inputs) == 0 {
+		return true
+	}
+	for _, i := range a.Inputs {
+		if b.AppliesTo(i) {
+			return true
+		}
+	}
+	return false
+}
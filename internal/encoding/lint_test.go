@@ -0,0 +1,105 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlanConfig_Lint(t *testing.T) {
+	tests := map[string]struct {
+		given PlanConfig
+		want  []LintIssue
+	}{
+		"Clean": {
+			given: PlanConfig{
+				OutDir: "out",
+				Inputs: []string{"src/vid1.mp4"},
+				Schemes: []Scheme{
+					{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% -an -y %OUTPUT%.mp4"},
+					{Name: "sc2", CommandTpl: "ffmpeg -i %INPUT% -an -y %OUTPUT%.mp4"},
+				},
+			},
+		},
+		"Non ffmpeg commands are not checked for options": {
+			given: PlanConfig{
+				OutDir:  "out",
+				Inputs:  []string{"src/vid1.mp4"},
+				Schemes: []Scheme{{Name: "sc1", CommandTpl: "cp %INPUT% %OUTPUT%.mp4"}},
+			},
+		},
+		"Duplicate scheme names": {
+			given: PlanConfig{
+				OutDir: "out",
+				Inputs: []string{"src/vid1.mp4"},
+				Schemes: []Scheme{
+					{Name: "sc1", CommandTpl: "cp %INPUT% %OUTPUT%.mp4"},
+					{Name: "sc1", CommandTpl: "cp %INPUT% %OUTPUT%.mp4"},
+				},
+			},
+			want: []LintIssue{
+				{Fatal: true, Message: `Scheme name "sc1" used more than once`},
+				{Fatal: true, Message: "Output out/vid1_sc1.mp4 written by: sc1(src/vid1.mp4), sc1(src/vid1.mp4)"},
+				{Fatal: true, Message: "Output out/vid1_sc1.out written by: sc1(src/vid1.mp4), sc1(src/vid1.mp4)"},
+			},
+		},
+		"Same scheme name for different inputs": {
+			given: PlanConfig{
+				OutDir: "out",
+				Inputs: []string{"src/vid1.mp4", "src/vid2.mp4"},
+				Schemes: []Scheme{
+					{Name: "sc1", CommandTpl: "cp %INPUT% %OUTPUT%.mp4", Inputs: []string{"src/vid1.mp4"}},
+					{Name: "sc1", CommandTpl: "cp %INPUT% %OUTPUT%.mp4", Inputs: []string{"src/vid2.mp4"}},
+				},
+			},
+		},
+		"Inputs with same base name": {
+			given: PlanConfig{
+				OutDir:  "out",
+				Inputs:  []string{"a/vid1.mp4", "b/vid1.mp4"},
+				Schemes: []Scheme{{Name: "sc1", CommandTpl: "cp %INPUT% %OUTPUT%.mp4"}},
+			},
+			want: []LintIssue{
+				{Fatal: true, Message: "Output out/vid1_sc1.mp4 written by: sc1(a/vid1.mp4), sc1(b/vid1.mp4)"},
+				{Fatal: true, Message: "Output out/vid1_sc1.out written by: sc1(a/vid1.mp4), sc1(b/vid1.mp4)"},
+			},
+		},
+		"Inconsistent -y and missing -an": {
+			given: PlanConfig{
+				OutDir: "out",
+				Inputs: []string{"src/vid1.mp4"},
+				Schemes: []Scheme{
+					{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% -an -y %OUTPUT%.mp4"},
+					{Name: "sc2", CommandTpl: "ffmpeg -i %INPUT% %OUTPUT%.mp4"},
+				},
+			},
+			want: []LintIssue{
+				{Message: "Scheme sc2 has no -an, audio is encoded although only video is compared"},
+				{Message: "Option -y used inconsistently, missing in schemes: sc2"},
+			},
+		},
+		"Non-deterministic command": {
+			given: PlanConfig{
+				OutDir:  "out",
+				Inputs:  []string{"src/vid1.mp4"},
+				Schemes: []Scheme{{Name: "sc1", CommandTpl: "cp %INPUT% %OUTPUT%_$RANDOM.mp4"}},
+			},
+			want: []LintIssue{
+				{Message: `Scheme sc1 command is not deterministic (contains "$RANDOM")`},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.given.Lint()
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Lint() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
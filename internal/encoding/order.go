@@ -0,0 +1,101 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/evolution-gaming/ease/internal/tools"
+)
+
+// Command execution orders, see Plan.OrderByCost.
+const (
+	// OrderPlan keeps commands in plan order (schemes by inputs).
+	OrderPlan = "plan"
+	// OrderCostAsc runs cheapest encodes first for faster feedback.
+	OrderCostAsc = "cost-asc"
+	// OrderCostDesc runs most expensive encodes first, which balances
+	// parallel execution better.
+	OrderCostDesc = "cost-desc"
+)
+
+// IsOrder reports whether o is a valid command execution order.
+func IsOrder(o string) bool {
+	switch o {
+	case OrderPlan, OrderCostAsc, OrderCostDesc:
+		return true
+	}
+	return false
+}
+
+// costFunc returns estimated encoding cost of given source file.
+type costFunc func(sourceFile string) (float64, error)
+
+// probeCost estimates encoding cost of source file as total number of pixels
+// to encode (resolution × duration), source file is probed via ffprobe.
+func probeCost(sourceFile string) (float64, error) {
+	vmeta, err := tools.FfprobeExtractMetadata(sourceFile)
+	if err != nil {
+		return 0, err
+	}
+	return float64(vmeta.Width*vmeta.Height) * vmeta.Duration, nil
+}
+
+// OrderByCost will reorder Commands by estimated encoding cost of their
+// source files in given order (one of OrderPlan, OrderCostAsc or
+// OrderCostDesc). Each source file is probed once.
+//
+// Encodes of equal cost keep plan order and remux commands are kept right
+// after command they remux.
+func (p *Plan) OrderByCost(order string) error {
+	return p.orderByCost(order, probeCost)
+}
+
+func (p *Plan) orderByCost(order string, cost costFunc) error {
+	if !IsOrder(order) {
+		return fmt.Errorf("OrderByCost() unknown order %q", order)
+	}
+	if order == OrderPlan {
+		return nil
+	}
+
+	costs := make(map[string]float64)
+	for _, c := range p.Commands {
+		if _, ok := costs[c.SourceFile]; ok {
+			continue
+		}
+		v, err := cost(c.SourceFile)
+		if err != nil {
+			return fmt.Errorf("OrderByCost() cost of %s: %w", c.SourceFile, err)
+		}
+		costs[c.SourceFile] = v
+	}
+
+	// Group remux commands with their encoder command, so groups can be
+	// moved around as a whole.
+	var groups [][]EncoderCmd
+	for _, c := range p.Commands {
+		if c.RemuxOf != "" && len(groups) > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], c)
+			continue
+		}
+		groups = append(groups, []EncoderCmd{c})
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		ci, cj := costs[groups[i][0].SourceFile], costs[groups[j][0].SourceFile]
+		if order == OrderCostDesc {
+			return ci > cj
+		}
+		return ci < cj
+	})
+
+	cmds := make([]EncoderCmd, 0, len(p.Commands))
+	for _, g := range groups {
+		cmds = append(cmds, g...)
+	}
+	p.Commands = cmds
+	return nil
+}
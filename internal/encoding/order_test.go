@@ -0,0 +1,90 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlan_orderByCost(t *testing.T) {
+	pc := PlanConfig{
+		OutDir: "out",
+		Inputs: []string{"src/small.mp4", "src/large.mp4", "src/medium.mp4"},
+		Schemes: []Scheme{
+			{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% %OUTPUT%.mp4", Remux: []string{"mkv"}},
+		},
+	}
+	costs := map[string]float64{"src/small.mp4": 1, "src/large.mp4": 100, "src/medium.mp4": 10}
+	var probed []string
+	cost := func(sourceFile string) (float64, error) {
+		probed = append(probed, sourceFile)
+		return costs[sourceFile], nil
+	}
+
+	tests := map[string]struct {
+		order string
+		want  []string
+	}{
+		"Plan order": {
+			order: OrderPlan,
+			want:  []string{"out/small_sc1.mp4", "out/small_sc1.mkv", "out/large_sc1.mp4", "out/large_sc1.mkv", "out/medium_sc1.mp4", "out/medium_sc1.mkv"},
+		},
+		"Cheapest first": {
+			order: OrderCostAsc,
+			want:  []string{"out/small_sc1.mp4", "out/small_sc1.mkv", "out/medium_sc1.mp4", "out/medium_sc1.mkv", "out/large_sc1.mp4", "out/large_sc1.mkv"},
+		},
+		"Most expensive first": {
+			order: OrderCostDesc,
+			want:  []string{"out/large_sc1.mp4", "out/large_sc1.mkv", "out/medium_sc1.mp4", "out/medium_sc1.mkv", "out/small_sc1.mp4", "out/small_sc1.mkv"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			plan := NewPlan(pc)
+			if err := plan.orderByCost(tc.order, cost); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var got []string
+			for _, c := range plan.Commands {
+				got = append(got, c.CompressedFile)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Command order mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("Each source is probed once", func(t *testing.T) {
+		probed = nil
+		pc := pc
+		pc.Schemes = append(pc.Schemes, Scheme{Name: "sc2", CommandTpl: "ffmpeg -i %INPUT% %OUTPUT%.mp4"})
+		plan := NewPlan(pc)
+		if err := plan.orderByCost(OrderCostAsc, cost); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(3, len(probed)); diff != "" {
+			t.Errorf("Probe count mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Should fail for unknown order", func(t *testing.T) {
+		plan := NewPlan(pc)
+		if err := plan.orderByCost("random", cost); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+
+	t.Run("Should fail when cost is unknown", func(t *testing.T) {
+		plan := NewPlan(pc)
+		failing := func(string) (float64, error) { return 0, errors.New("probe failed") }
+		if err := plan.orderByCost(OrderCostDesc, failing); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
@@ -6,22 +6,24 @@ package encoding
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
-	"os/exec"
-	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
-	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/evolution-gaming/ease/internal/logging"
 	"github.com/evolution-gaming/ease/internal/lw"
+	"github.com/evolution-gaming/ease/internal/perm"
 	"github.com/evolution-gaming/ease/internal/tools"
+	"github.com/evolution-gaming/ease/internal/video"
 )
 
 const (
@@ -29,6 +31,7 @@ const (
 	outputPlaceholder  = "%OUTPUT%"
 	logFilePlaceholder = "%LOGFILE%"
 	outputBufferSize   = 5 * 1024 * 1024 // 5 MiB for output buffer
+	outputTailLines    = 10              // Output lines kept in RunResult on failure
 )
 
 // EncoderCmd defines an encoder command struct.
@@ -47,15 +50,62 @@ type EncoderCmd struct {
 	WorkDir string
 	// Cmd is a actual "executable" encoder commandline with parameters
 	Cmd string
+	// RemuxOf is set for remux commands and refers to CompressedFile of
+	// encoding this remux is created from
+	RemuxOf string `json:",omitempty"`
+	// OutputBufferSize is a limit in bytes for encoder output captured, 0
+	// means default limit
+	OutputBufferSize uint `json:",omitempty"`
+	// TruncateOutput keeps only tail of encoder output captured when it
+	// exceeds OutputBufferSize instead of failing encoding
+	TruncateOutput bool `json:",omitempty"`
+	// AcceptExitCodes are non-zero exit codes not treated as failure
+	AcceptExitCodes []int `json:",omitempty"`
+	// VMAFGeometry is ffmpeg filter chain applied to both compressed and
+	// source videos before VMAF comparison (see Geometry)
+	VMAFGeometry string `json:",omitempty"`
+	// VMAFFeatures are libvmaf features overriding default ones, empty means
+	// default features
+	VMAFFeatures []string `json:",omitempty"`
+	// VMAFUpscale is ffmpeg scaler (e.g. "bicubic") compressed video is
+	// upscaled with to source resolution before VMAF comparison, empty means
+	// no upscale
+	VMAFUpscale string `json:",omitempty"`
+	// OutputTailLines is a number of last output lines kept in RunResult on
+	// failure, 0 means default
+	OutputTailLines uint `json:",omitempty"`
+	// FailOnOutput are regular expressions matched against encoder output, a
+	// match fails encoding regardless of exit code
+	FailOnOutput []string `json:",omitempty"`
+	// TargetVMAF configures search of setting given via %CRF% placeholder in
+	// Cmd, nil means Cmd is run as is
+	TargetVMAF *TargetVMAF `json:",omitempty"`
+	// TargetBitrate is bitrate (in kbit/s) rate control targets, 0 means none
+	TargetBitrate float64 `json:",omitempty"`
+	// Nice and IOClass are priority settings for default LocalExecutor
+	Nice    int    `json:",omitempty"`
+	IOClass string `json:",omitempty"`
+	// Shell is shell default LocalExecutor runs Cmd with, empty means "sh"
+	Shell string `json:",omitempty"`
+	// Executor executes Cmd, nil means LocalExecutor
+	Executor Executor `json:"-"`
 }
 
-// Run will run all encoding commands defined for this Plan.
+// Run will run encoding command.
 //
-// Error is nil if all encoding commands succeed without errors.
+// This is a wrapper around RunContext with background context.
+func (s *EncoderCmd) Run() RunResult {
+	return s.RunContext(context.Background())
+}
+
+// RunContext will run encoding command, command is killed if ctx is done
+// before command completes.
+//
+// Errors are reported via RunResult.Errors.
 //
 // TODO: After refactoring lost the ability to control output io.Writer. Maybe
 // need to add option to pass in own io.Writer (for testing purposes?)
-func (s *EncoderCmd) Run() RunResult {
+func (s *EncoderCmd) RunContext(ctx context.Context) RunResult {
 	// Initialize RunResult from "this" EncoderCmd.
 	r := RunResult{EncoderCmd: *s}
 
@@ -64,9 +114,20 @@ func (s *EncoderCmd) Run() RunResult {
 	var outWriter, memWriter io.Writer
 	// Explicitly limit stderr buffer to certain size to protect ourselves
 	// from some runaway process flooding output.
-	memWriter = lw.LimitWriter(&buf, outputBufferSize)
+	bufSize := uint(outputBufferSize)
+	if s.OutputBufferSize > 0 {
+		bufSize = s.OutputBufferSize
+	}
+	memWriter = lw.LimitWriter(&buf, bufSize)
+	// In truncate mode only tail of output is kept, since verbose output
+	// alone should not fail otherwise successful encoding.
+	var tail *lw.TailWriter
+	if s.TruncateOutput {
+		tail = lw.NewTailWriter(bufSize)
+		memWriter = tail
+	}
 
-	f, err := os.Create(s.OutputFile)
+	f, err := perm.Create(s.OutputFile)
 	if err != nil {
 		logging.Infof("Unable to redirect output to file: %s", err)
 		r.AddError(err)
@@ -77,37 +138,192 @@ func (s *EncoderCmd) Run() RunResult {
 		defer f.Close()
 	}
 
-	// Encoder commands come in different flavours and in some cases commands
-	// can make use various commands connected via pipes, this can be supported
-	// by employing shell to execute commands.We trust user to provide safe
-	// encoder command, otherwise this can be a security issue.
-	r.cmd = exec.Command("sh", "-c", s.Cmd) //#nosec G204
-	// Explicitly limit stderr buffer to certain size to protect ourselves
-	// from some runaway process flooding output.
-	r.cmd.Stderr = outWriter
 	// Time executions to calculate a wall time.
 	start := time.Now()
-	if err = r.cmd.Run(); err != nil {
+	executor := s.Executor
+	if executor == nil {
+		executor = LocalExecutor{Nice: s.Nice, IOClass: s.IOClass, Shell: s.Shell}
+	}
+	res, err := executor.Execute(ctx, s.Cmd, outWriter)
+	r.exec = &res
+	r.stderr = buf.Bytes()
+	if tail != nil {
+		if tail.Truncated() {
+			logging.Infof("Output of %s truncated to last %d bytes", r.Name, bufSize)
+		}
+		r.stderr = tail.Bytes()
+	}
+	r.EncoderVersion = parseEncoderVersion(r.stderr)
+	if err != nil && ctx.Err() == nil && s.acceptsExitCode(r.ExitCode()) {
+		logging.Infof("Accepted exit code %d for %s", r.ExitCode(), r.Name)
+		err = nil
+		// Encoder exited abnormally, so compressed file is always checked
+		// to be decodable regardless of Plan.CheckIntegrity.
+		checkIntegrity(&r)
+	}
+	if err != nil {
 		logging.Infof("Run error for %s: %s", r.Name, err)
-		logging.Debugf("Command: %s", r.cmd)
-		logging.Debugf("Stderr: %s", buf.Bytes())
+		logging.Debugf("Command: %s", s.Cmd)
+		logging.Debugf("Stderr: %s", r.stderr)
 		r.AddError(err)
 	}
-	r.Stats = NewUsageStat(time.Since(start), r.Rusage())
+	r.Stats = NewUsageStat(time.Since(start), r.exec)
+	// Some encoder warnings indicate real problems despite zero exit code.
+	if len(r.Errors) == 0 {
+		if err := matchOutput(r.stderr, s.FailOnOutput); err != nil {
+			logging.Infof("Output of %s: %s", r.Name, err)
+			r.AddError(err)
+		}
+	}
 	// Add VideoDuration and also calculate approximation to average encoding speed.
 	vmeta, err := tools.FfprobeExtractMetadata(r.CompressedFile)
 	if err != nil {
 		logging.Infof("Unable to query compressed video metadata: %v", err)
 		r.AddError(err)
 	} else {
+		r.Metadata = &vmeta
 		r.VideoDuration = vmeta.Duration
 		r.AvgEncodingSpeed = vmeta.Duration / r.Stats.Elapsed.Seconds()
+		r.BelowRealtime = r.AvgEncodingSpeed < 1
+		r.RateControl = newRateControl(s.TargetBitrate, vmeta.BitRate)
 	}
-	r.stderr = buf.Bytes()
+	if len(r.Errors) == 0 {
+		r.checkSize()
+	}
+	// Keep tail of output inline, so failure reason is visible without
+	// opening output file.
+	if len(r.Errors) != 0 {
+		n := uint(outputTailLines)
+		if s.OutputTailLines > 0 {
+			n = s.OutputTailLines
+		}
+		r.OutputTail = lastLines(r.stderr, n)
+	}
+
+	return r
+}
+
+// matchOutput will return error describing first output line matching any of
+// regular expression patterns.
+func matchOutput(output []byte, patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid output pattern %q: %w", p, err)
+		}
+		res[i] = re
+	}
+	lines := strings.FieldsFunc(string(output), func(r rune) bool {
+		return r == '\n' || r == '\r'
+	})
+	for _, l := range lines {
+		for _, re := range res {
+			if re.MatchString(l) {
+				return fmt.Errorf("output matches %q: %s", re, strings.TrimSpace(l))
+			}
+		}
+	}
+	return nil
+}
 
+// lastLines returns up to n last non-empty lines of output, both new line and
+// carriage return (e.g. ffmpeg progress) are treated as line separators.
+func lastLines(output []byte, n uint) []string {
+	lines := strings.FieldsFunc(string(output), func(r rune) bool {
+		return r == '\n' || r == '\r'
+	})
+	var res []string
+	for i := len(lines) - 1; i >= 0 && uint(len(res)) < n; i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		res = append(res, lines[i])
+	}
+	// Restore original order.
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// reuse will create RunResult for already existing compressed file without
+// running encoding command.
+//
+// Since command is not executed, resulting RunResult has no usage stats.
+func (s *EncoderCmd) reuse() RunResult {
+	r := RunResult{EncoderCmd: *s, Reused: true}
+	vmeta, err := tools.FfprobeExtractMetadata(r.CompressedFile)
+	if err != nil {
+		logging.Infof("Unable to query compressed video metadata: %v", err)
+		r.AddError(err)
+		return r
+	}
+	r.Metadata = &vmeta
+	r.VideoDuration = vmeta.Duration
+	r.RateControl = newRateControl(s.TargetBitrate, vmeta.BitRate)
+	r.checkSize()
 	return r
 }
 
+// checkSize will set LargerThanSource when compressed file is larger than
+// source file, which indicates misconfigured scheme (e.g. lossless or way too
+// high bitrate settings).
+func (r *RunResult) checkSize() {
+	if tools.IsURL(r.SourceFile) {
+		return
+	}
+	larger, err := largerThanSource(r.CompressedFile, r.SourceFile)
+	if err != nil {
+		logging.Debugf("Unable to compare file sizes: %s", err)
+		return
+	}
+	r.LargerThanSource = larger
+}
+
+// largerThanSource reports whether compressed file is larger than source
+// file.
+func largerThanSource(compressed, source string) (bool, error) {
+	cfi, err := os.Stat(compressed)
+	if err != nil {
+		return false, fmt.Errorf("largerThanSource() %w", err)
+	}
+	sfi, err := os.Stat(source)
+	if err != nil {
+		return false, fmt.Errorf("largerThanSource() %w", err)
+	}
+	return cfi.Size() > sfi.Size(), nil
+}
+
+// acceptsExitCode reports whether non-zero exit code is configured as
+// acceptable for this command.
+func (s *EncoderCmd) acceptsExitCode(code int) bool {
+	for _, v := range s.AcceptExitCodes {
+		if v != 0 && v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// warmup will run encoding command once discarding it's result, so that
+// following measured run is not skewed by cold caches.
+//
+// Compressed file created by warmup run is removed, so encoders that refuse to
+// overwrite existing files do not fail measured run.
+func (s *EncoderCmd) warmup(ctx context.Context) {
+	r := s.RunContext(ctx)
+	if len(r.Errors) != 0 {
+		logging.Debugf("Warmup run of %s had errors: %v", s.Name, r.Errors)
+	}
+	if err := os.Remove(s.CompressedFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.Debugf("Unable to remove warmup output: %v", err)
+	}
+}
+
 // Scheme is an encoder string with input and output placeholders.
 //
 // For now it is just an encoding command line string with placeholders for input
@@ -115,43 +331,191 @@ func (s *EncoderCmd) Run() RunResult {
 //
 // A Name field will be used when generating output file, so use it sensibly -
 // think of it as as part of some nomenclature scheme.
+//
+// Optional Remux is a list of additional containers (file extensions e.g. "mkv",
+// "ts") compressed stream will be remuxed into without re-encoding.
+//
+// Optional AcceptExitCodes is a list of non-zero encoder exit codes that are
+// not treated as failure, compressed file is still checked to be decodable
+// (even without Plan.CheckIntegrity).
+//
+// Optional VMAFGeometry aligns compressed and source videos geometrically
+// before VMAF comparison (e.g. letterboxed encode vs full-frame source).
+//
+// Optional VMAFFeatures is a list of libvmaf feature names (e.g. "psnr",
+// "cambi") that replaces default features for this scheme's encodes.
+//
+// Optional VMAFUpscale is ffmpeg scaler (e.g. "bicubic", "lanczos") lower
+// resolution encodes (e.g. ABR ladder rungs) are upscaled with to source
+// resolution before VMAF comparison, so that they are scored as viewers see
+// them.
+//
+// Optional TargetVMAF makes it a target VMAF scheme: instead of fixed setting
+// CommandTpl has %CRF% placeholder and CRF achieving target VMAF is searched
+// for each input (see TargetVMAF).
 type Scheme struct {
 	Name       string
 	CommandTpl string
+	// Inputs restricts scheme to given subset of plan inputs, empty means
+	// all inputs
+	Inputs          []string
+	Remux           []string
+	AcceptExitCodes []int
+	VMAFGeometry    *Geometry
+	VMAFFeatures    []string
+	VMAFUpscale     string
+	TargetVMAF      *TargetVMAF
+	// TargetBitrate is bitrate (in kbit/s) scheme's rate control targets, 0
+	// means none. Measured average bitrate is compared against it.
+	TargetBitrate float64
+}
+
+// Geometry holds crop/pad/scale transforms applied symmetrically to both
+// compressed and source videos before VMAF comparison.
+//
+// Fields are ffmpeg filter arguments of respective filter, e.g. Crop
+// "1920:800:0:140", Scale "1920:1080". Empty fields are not applied, filters
+// are applied in crop, pad, scale order.
+type Geometry struct {
+	Crop  string `json:",omitempty"`
+	Pad   string `json:",omitempty"`
+	Scale string `json:",omitempty"`
+}
+
+// Filter returns ffmpeg filter chain for geometry transform, empty string is
+// returned for nil or empty geometry.
+func (g *Geometry) Filter() string {
+	if g == nil {
+		return ""
+	}
+	var filters []string
+	for _, f := range []struct{ name, args string }{
+		{"crop", g.Crop},
+		{"pad", g.Pad},
+		{"scale", g.Scale},
+	} {
+		if f.args != "" {
+			filters = append(filters, f.name+"="+f.args)
+		}
+	}
+	return strings.Join(filters, ",")
+}
+
+// validate checks that geometry filter arguments do not break out of single
+// filter, since filter chain is injected into VMAF filtergraph.
+func (g *Geometry) validate() error {
+	if g == nil {
+		return nil
+	}
+	for _, args := range []string{g.Crop, g.Pad, g.Scale} {
+		if strings.ContainsAny(args, ",;[] \t'\"") {
+			return fmt.Errorf("invalid filter arguments %q", args)
+		}
+	}
+	return nil
+}
+
+// AppliesTo reports whether scheme is applied to given input.
+func (s *Scheme) AppliesTo(input string) bool {
+	return len(s.Inputs) == 0 || contains(s.Inputs, input)
+}
+
+// schemeJSON is JSON representation of Scheme.
+//
+// Since JSON Scheme.CommandTpl is a string array we use this "temporary"
+// struct to decode JSON and construct Scheme fields from it.
+type schemeJSON struct {
+	Name            string
+	CommandTpl      []string
+	Inputs          []string
+	Remux           []string
+	AcceptExitCodes []int
+	VMAFGeometry    *Geometry
+	VMAFFeatures    []string
+	VMAFUpscale     string
+	TargetVMAF      *TargetVMAF
+	TargetBitrate   float64
 }
 
 // UnmarshalJSON implement Unmarshaler interface for Scheme type.
 func (s *Scheme) UnmarshalJSON(data []byte) error {
-	// Since JSON Scheme.CommandTpl is a string array we create a "temporary"
-	// struct that will be used to decode JSON, we will use this struct to
-	// construct Scheme fields.
-	scheme := struct {
-		Name       string
-		CommandTpl []string
-	}{}
+	var scheme schemeJSON
 	if err := json.Unmarshal(data, &scheme); err != nil {
 		return err
 	}
 	s.Name = scheme.Name
+	s.Inputs = scheme.Inputs
+	s.Remux = scheme.Remux
+	s.AcceptExitCodes = scheme.AcceptExitCodes
+	s.VMAFGeometry = scheme.VMAFGeometry
+	s.VMAFFeatures = scheme.VMAFFeatures
+	s.VMAFUpscale = scheme.VMAFUpscale
+	s.TargetVMAF = scheme.TargetVMAF
+	s.TargetBitrate = scheme.TargetBitrate
 	// This is the part that needed the whole custom Unmarshaler for Scheme struct.
 	s.CommandTpl = strings.Join(scheme.CommandTpl, "")
 
 	return nil
 }
 
+// MarshalJSON implement Marshaler interface for Scheme type.
+//
+// CommandTpl is encoded as single element string array so that marshalled
+// Scheme can be unmarshalled back (e.g. plan from run manifest).
+func (s Scheme) MarshalJSON() ([]byte, error) {
+	scheme := struct {
+		Name            string
+		CommandTpl      []string
+		Inputs          []string    `json:",omitempty"`
+		Remux           []string    `json:",omitempty"`
+		AcceptExitCodes []int       `json:",omitempty"`
+		VMAFGeometry    *Geometry   `json:",omitempty"`
+		VMAFFeatures    []string    `json:",omitempty"`
+		VMAFUpscale     string      `json:",omitempty"`
+		TargetVMAF      *TargetVMAF `json:",omitempty"`
+		TargetBitrate   float64     `json:",omitempty"`
+	}{
+		Name:            s.Name,
+		CommandTpl:      []string{s.CommandTpl},
+		Inputs:          s.Inputs,
+		Remux:           s.Remux,
+		AcceptExitCodes: s.AcceptExitCodes,
+		VMAFGeometry:    s.VMAFGeometry,
+		VMAFFeatures:    s.VMAFFeatures,
+		VMAFUpscale:     s.VMAFUpscale,
+		TargetVMAF:      s.TargetVMAF,
+		TargetBitrate:   s.TargetBitrate,
+	}
+	return json.Marshal(scheme)
+}
+
 // Expand will generate complete encoding commands based on provided "context".
 //
-// "Context" being input/source files and output directory.
+// "Context" being input/source files, output directory, global arguments and
+// per source file input-side arguments. Non-empty globalArgs are inserted right
+// after the ffmpeg executable in command template, non-empty inputArgs of
+// source file are inserted right before "-i %INPUT%".
 //
 // TODO: Not sure about the name Expand(). Also, function body looks busy.
-func (s *Scheme) Expand(sourceFiles []string, outDir string) (cmds []EncoderCmd) {
+func (s *Scheme) Expand(sourceFiles []string, outDir, globalArgs string, inputArgs map[string]string) (cmds []EncoderCmd) {
+	cmdTpl := s.CommandTpl
+	if globalArgs != "" {
+		var ok bool
+		if cmdTpl, ok = insertGlobalArgs(cmdTpl, globalArgs); !ok {
+			logging.Infof("Expand() no ffmpeg command found in scheme %s, GlobalArgs ignored", s.Name)
+		}
+	}
+
 	for _, sFile := range sourceFiles {
+		if !s.AppliesTo(sFile) {
+			continue
+		}
 		oFileBase := generateOutputFileNameBase(sFile, outDir, s.Name)
 
 		// Determine compressed file extension (including the dot).
 		var compressedFileExt string
 		extMatcher := regexp.MustCompile(fmt.Sprintf(`%s(\.\w+)*`, outputPlaceholder))
-		m := extMatcher.FindStringSubmatch(string(s.CommandTpl))
+		m := extMatcher.FindStringSubmatch(cmdTpl)
 		if m != nil {
 			compressedFileExt = m[1]
 		}
@@ -162,9 +526,18 @@ func (s *Scheme) Expand(sourceFiles []string, outDir string) (cmds []EncoderCmd)
 		logFile := fmt.Sprintf("%s.log", oFileBase)
 
 		// Replace placeholders in command template.
-		cmdStr := strings.ReplaceAll(string(s.CommandTpl), inputPlaceholder, sFile)
-		cmdStr = strings.ReplaceAll(cmdStr, outputPlaceholder, oFileBase)
-		cmdStr = strings.ReplaceAll(cmdStr, logFilePlaceholder, logFile)
+		cmdStr := cmdTpl
+		if args := inputArgs[sFile]; args != "" {
+			var ok bool
+			if cmdStr, ok = insertInputArgs(cmdStr, args); !ok {
+				logging.Infof("Expand() no \"-i %s\" found in scheme %s, InputOptions ignored", inputPlaceholder, s.Name)
+			}
+		}
+		// Paths are shell quoted, so that paths with spaces and special
+		// characters survive "sh -c".
+		cmdStr = replacePlaceholder(cmdStr, inputPlaceholder, sFile)
+		cmdStr = replacePlaceholder(cmdStr, outputPlaceholder, oFileBase)
+		cmdStr = replacePlaceholder(cmdStr, logFilePlaceholder, logFile)
 
 		cwd, err := os.Getwd()
 		if err != nil {
@@ -177,44 +550,247 @@ func (s *Scheme) Expand(sourceFiles []string, outDir string) (cmds []EncoderCmd)
 		}
 
 		ec := EncoderCmd{
-			Name:           s.Name,
-			SourceFile:     sFile,
-			CompressedFile: compressedFile,
-			OutputFile:     outputFile,
-			LogFile:        logFile,
-			WorkDir:        cwd,
-			Cmd:            cmdStr,
+			Name:            s.Name,
+			SourceFile:      sFile,
+			CompressedFile:  compressedFile,
+			OutputFile:      outputFile,
+			LogFile:         logFile,
+			WorkDir:         cwd,
+			Cmd:             cmdStr,
+			AcceptExitCodes: s.AcceptExitCodes,
+			VMAFGeometry:    s.VMAFGeometry.Filter(),
+			VMAFFeatures:    s.VMAFFeatures,
+			VMAFUpscale:     s.VMAFUpscale,
+			TargetVMAF:      s.TargetVMAF,
+			TargetBitrate:   s.TargetBitrate,
 		}
 		cmds = append(cmds, ec)
+		cmds = append(cmds, s.expandRemux(ec, oFileBase, compressedFileExt)...)
 	}
 
 	return cmds
 }
 
+// expandRemux will generate remux commands for given encoder command.
+//
+// Remux commands copy compressed stream into other containers, so they must run
+// after encoder command.
+func (s *Scheme) expandRemux(ec EncoderCmd, oFileBase, compressedFileExt string) (cmds []EncoderCmd) {
+	// Missing ffmpeg is reported once remux command is run.
+	ffmpeg := "ffmpeg"
+	if p, err := tools.FfmpegPath(); err == nil {
+		ffmpeg = p
+	}
+	for _, ext := range s.Remux {
+		ext = "." + strings.TrimPrefix(ext, ".")
+		if ext == compressedFileExt {
+			logging.Infof("Expand() remux to same container %s skipped for scheme %s", ext, s.Name)
+			continue
+		}
+		remuxFile := oFileBase + ext
+		suffix := strings.TrimPrefix(ext, ".")
+		cmds = append(cmds, EncoderCmd{
+			Name:           ec.Name,
+			SourceFile:     ec.SourceFile,
+			CompressedFile: remuxFile,
+			OutputFile:     fmt.Sprintf("%s_%s.out", oFileBase, suffix),
+			LogFile:        fmt.Sprintf("%s_%s.log", oFileBase, suffix),
+			WorkDir:        ec.WorkDir,
+			Cmd:            fmt.Sprintf("%s -i %s -map 0 -c copy -y %s", shellQuote(ffmpeg), shellQuote(ec.CompressedFile), shellQuote(remuxFile)),
+			RemuxOf:        ec.CompressedFile,
+		})
+	}
+	return cmds
+}
+
+// ffmpegMatcher matches ffmpeg executable (optionally with path) in command line.
+var ffmpegMatcher = regexp.MustCompile(`(^|\s)(\S*/)?ffmpeg(\s|$)`)
+
+// insertGlobalArgs will insert args right after first ffmpeg executable found in
+// command template.
+//
+// This is a literal string insertion and only makes sense for ffmpeg-shaped
+// command templates, false is returned if there is no ffmpeg command.
+func insertGlobalArgs(cmdTpl, args string) (string, bool) {
+	loc := ffmpegMatcher.FindStringSubmatchIndex(cmdTpl)
+	if loc == nil {
+		return cmdTpl, false
+	}
+	// Insert after "ffmpeg" token, e.g. at the start of trailing whitespace group.
+	at := loc[6]
+	return cmdTpl[:at] + " " + strings.TrimSpace(args) + cmdTpl[at:], true
+}
+
+// inputMatcher matches ffmpeg input option with input placeholder.
+var inputMatcher = regexp.MustCompile(`(^|\s)-i\s+` + inputPlaceholder)
+
+// insertInputArgs will insert args right before each "-i %INPUT%" found in
+// command template.
+//
+// Like insertGlobalArgs this only makes sense for ffmpeg-shaped command
+// templates, false is returned if there is no "-i %INPUT%".
+func insertInputArgs(cmdTpl, args string) (string, bool) {
+	if !inputMatcher.MatchString(cmdTpl) {
+		return cmdTpl, false
+	}
+	return inputMatcher.ReplaceAllStringFunc(cmdTpl, func(m string) string {
+		at := strings.Index(m, "-i")
+		return m[:at] + strings.TrimSpace(args) + " " + m[at:]
+	}), true
+}
+
+// ErrMaxDurationExceeded is returned when Plan run exceeds it's time budget.
+var ErrMaxDurationExceeded = errors.New("run time budget exceeded")
+
 type Plan struct {
 	// Embed PlanConfig struct
 	PlanConfig
 	// Executable encoder commands
 	Commands []EncoderCmd
+	// ReuseExisting controls if encoding is skipped for commands which
+	// compressed file already exists
+	ReuseExisting bool
+	// MaxDuration is a wall time budget for the whole run, once exceeded no
+	// new encoding commands are started (zero means no limit)
+	MaxDuration time.Duration
+	// Warmup controls if each encoding command is run once before measured
+	// run, warmup run result is discarded
+	Warmup bool
+	// CheckDeterminism controls if each encoding command is run second time
+	// after measured run to check that it produces byte identical compressed
+	// file (see RunResult.Deterministic)
+	CheckDeterminism bool
+	// CheckIntegrity controls if each compressed file is fully decoded after
+	// encoding to detect corrupt files, this doubles post-encode time
+	CheckIntegrity bool
+	// MeasureVMAF measures VMAF during target VMAF search, required for
+	// plans with target VMAF schemes
+	MeasureVMAF VMAFFunc
 	// Flag to signal if output dir has been created
 	outDirCreated bool
 }
 
 // NewPlan will create Plan instance from given PlanConfig.
 func NewPlan(pc PlanConfig) Plan {
+	// Duplicate inputs are allowed (see PlanConfig.Validate), but encoding
+	// same input twice would overwrite outputs.
+	pc.Inputs = uniqueInputs(pc.Inputs)
 	p := Plan{
 		PlanConfig:    pc,
 		outDirCreated: false,
 	}
+	globalArgs, inputArgs := p.expansionArgs()
 	for _, scheme := range p.Schemes {
-		cmds := scheme.Expand(p.Inputs, p.OutDir)
+		cmds := scheme.Expand(p.Inputs, p.OutDir, globalArgs, inputArgs)
 		p.Commands = append(p.Commands, cmds...)
 	}
+	for i := range p.Commands {
+		p.Commands[i].OutputBufferSize = p.OutputBufferSize
+		p.Commands[i].TruncateOutput = p.TruncateOutput
+		p.Commands[i].OutputTailLines = p.OutputTailLines
+		p.Commands[i].FailOnOutput = p.FailOnOutput
+		p.Commands[i].Nice = p.Nice
+		p.Commands[i].IOClass = p.IOClass
+		p.Commands[i].Shell = p.Shell
+	}
 	return p
 }
 
+// uniqueInputs returns inputs without duplicates, order of first occurrence is
+// kept.
+func uniqueInputs(inputs []string) []string {
+	if !hasDuplicates(inputs) {
+		return inputs
+	}
+	seen := make(map[string]struct{}, len(inputs))
+	unique := make([]string, 0, len(inputs))
+	for _, v := range inputs {
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// EffectivePlanConfig returns PlanConfig with each encoding command of the
+// plan as a separate scheme restricted to it's input, in command order.
+//
+// Inputs and OutDir are concrete (globs and templates resolved) while
+// GlobalArgs, LogLevel and input options are already part of schemes' command
+// templates, so that running returned plan reproduces exactly the same
+// encodings.
+func (s *Plan) EffectivePlanConfig() PlanConfig {
+	globalArgs, inputArgs := s.expansionArgs()
+	pc := s.PlanConfig
+	pc.Schemes = nil
+	pc.GlobalArgs = ""
+	pc.LogLevel = ""
+	pc.InputOptions = nil
+	for i := range s.Commands {
+		c := &s.Commands[i]
+		// Remux commands are part of their encoding's scheme.
+		if c.RemuxOf != "" {
+			continue
+		}
+		if sc, ok := s.oneOffScheme(c, globalArgs, inputArgs[c.SourceFile]); ok {
+			pc.Schemes = append(pc.Schemes, sc)
+		} else {
+			logging.Infof("EffectivePlanConfig() no scheme found for command: %s", c.Cmd)
+		}
+	}
+	return pc
+}
+
+// oneOffScheme returns scheme command c is expanded from, restricted to c's
+// input and with global and input arguments inserted into command template.
+func (s *Plan) oneOffScheme(c *EncoderCmd, globalArgs, inputArgs string) (Scheme, bool) {
+	for _, sc := range s.Schemes {
+		if sc.Name != c.Name || !sc.AppliesTo(c.SourceFile) {
+			continue
+		}
+		if globalArgs != "" {
+			sc.CommandTpl, _ = insertGlobalArgs(sc.CommandTpl, globalArgs)
+		}
+		if inputArgs != "" {
+			sc.CommandTpl, _ = insertInputArgs(sc.CommandTpl, inputArgs)
+		}
+		sc.Inputs = []string{c.SourceFile}
+		// Same name may be shared by schemes applied to different inputs,
+		// make sure this is the one that expands to c.
+		if cmds := sc.Expand(sc.Inputs, s.OutDir, "", nil); len(cmds) > 0 && cmds[0].Cmd == c.Cmd {
+			return sc, true
+		}
+	}
+	return Scheme{}, false
+}
+
+// expansionArgs returns global arguments (including log level) and per input
+// input-side arguments inserted into schemes' command templates.
+func (p *PlanConfig) expansionArgs() (globalArgs string, inputArgs map[string]string) {
+	globalArgs = p.GlobalArgs
+	if p.LogLevel != "" {
+		globalArgs = strings.TrimSpace("-loglevel " + p.LogLevel + " " + globalArgs)
+	}
+	inputArgs = make(map[string]string, len(p.Inputs))
+	for _, i := range p.Inputs {
+		inputArgs[i] = p.InputArgsFor(i)
+	}
+	return globalArgs, inputArgs
+}
+
 // Run executes encoding commands part of this Plan.
+//
+// This is a wrapper around RunContext with background context.
 func (s *Plan) Run() (PlanResult, error) {
+	return s.RunContext(context.Background())
+}
+
+// RunContext executes encoding commands part of this Plan.
+//
+// When ctx is done, currently running command is killed and remaining commands
+// are not started, PlanResult will contain results only for started commands.
+func (s *Plan) RunContext(ctx context.Context) (PlanResult, error) {
 	var runError error
 	result := PlanResult{
 		StartTime:  time.Now(),
@@ -227,11 +803,50 @@ func (s *Plan) Run() (PlanResult, error) {
 	}
 
 	for i := range s.Commands {
+		if err := ctx.Err(); err != nil {
+			result.RunResults = result.RunResults[:i]
+			runError = fmt.Errorf("Plan run interrupted: %w", err)
+			break
+		}
+		if s.MaxDuration > 0 && time.Since(result.StartTime) > s.MaxDuration {
+			logging.Infof("Run time budget of %s exceeded, %d of %d encodings done", s.MaxDuration, i, len(s.Commands))
+			result.RunResults = result.RunResults[:i]
+			runError = fmt.Errorf("Plan run stopped: %w", ErrMaxDurationExceeded)
+			break
+		}
+		if s.ReuseExisting {
+			if _, err := os.Stat(s.Commands[i].CompressedFile); err == nil {
+				logging.Infof("Reusing existing %s", s.Commands[i].CompressedFile)
+				result.RunResults[i] = s.Commands[i].reuse()
+				continue
+			}
+		}
+		// Search encodes of target VMAF command already stabilize timing.
+		if s.Warmup && s.Commands[i].TargetVMAF == nil {
+			logging.Infof("Warmup encoding %s -> %s", s.Commands[i].SourceFile, s.Commands[i].CompressedFile)
+			s.Commands[i].warmup(ctx)
+		}
 		logging.Infof("Start encoding %s -> %s", s.Commands[i].SourceFile, s.Commands[i].CompressedFile)
-		result.RunResults[i] = s.Commands[i].Run()
+		if s.Commands[i].TargetVMAF != nil {
+			result.RunResults[i] = s.Commands[i].runTarget(ctx, s.MeasureVMAF)
+		} else {
+			result.RunResults[i] = s.Commands[i].RunContext(ctx)
+		}
 		logging.Infof("Done encoding %s -> %s", s.Commands[i].SourceFile, s.Commands[i].CompressedFile)
+		// Target VMAF search already runs many encodings, so it is not
+		// checked.
+		if s.CheckDeterminism && s.Commands[i].TargetVMAF == nil && len(result.RunResults[i].Errors) == 0 {
+			s.Commands[i].determinism(ctx, &result.RunResults[i])
+		}
+		if s.CheckIntegrity && !result.RunResults[i].integrityChecked && len(result.RunResults[i].Errors) == 0 {
+			checkIntegrity(&result.RunResults[i])
+		}
+		s.postEncodeHook(ctx, &result.RunResults[i])
 	}
 	result.EndTime = time.Now()
+	if runError != nil {
+		return result, runError
+	}
 
 	for i := range result.RunResults {
 		if len(result.RunResults[i].Errors) != 0 {
@@ -241,13 +856,24 @@ func (s *Plan) Run() (PlanResult, error) {
 	return result, runError
 }
 
+// checkIntegrity will fully decode compressed file of r and record failure in
+// r, encoder might have been killed mid-write or otherwise produce a corrupt
+// file.
+func checkIntegrity(r *RunResult) {
+	r.integrityChecked = true
+	if err := tools.FfmpegCheckIntegrity(r.CompressedFile); err != nil {
+		logging.Infof("Integrity check failed for %s: %s", r.CompressedFile, err)
+		r.AddError(fmt.Errorf("corrupt compressed file %s: %w", r.CompressedFile, err))
+	}
+}
+
 // ensureOutDir will create output directory if it does not exist.
 func (p *Plan) ensureOutDir() error {
 	if p.outDirCreated {
 		return nil
 	}
 	logging.Debugf("Creating output directory: %s", p.OutDir)
-	err := os.MkdirAll(p.OutDir, os.FileMode(0o775))
+	err := perm.MkdirAll(p.OutDir)
 	if err != nil {
 		return fmt.Errorf("ensureOutDir(): %w", err)
 	}
@@ -266,16 +892,92 @@ type PlanResult struct {
 type RunResult struct {
 	EncoderCmd
 	Errors           []error
-	cmd              *exec.Cmd
+	exec             *ExecResult
 	stderr           []byte
+	integrityChecked bool
 	Stats            UsageStat
 	VideoDuration    float64
 	AvgEncodingSpeed float64
+	// BelowRealtime is set when average encoding speed is below realtime (1x),
+	// a red flag for live/streaming use cases
+	BelowRealtime bool `json:",omitempty"`
+	// LargerThanSource is set when compressed file is larger than source
+	// file, a sign of misconfigured scheme
+	LargerThanSource bool `json:",omitempty"`
+	// Reused is set when existing compressed file was reused instead of encoding
+	Reused bool `json:",omitempty"`
+	// DroppedFrames and DuplicatedFrames are counts of source frames missing
+	// from or repeated in compressed file, only set when frame check is done
+	DroppedFrames    int `json:",omitempty"`
+	DuplicatedFrames int `json:",omitempty"`
+	// VQMTagged is set when VQM scores were written into compressed file's
+	// metadata
+	VQMTagged bool `json:",omitempty"`
+	// SceneCuts are timestamps (in seconds) of scene cuts detected in source,
+	// only set when scene cut detection is done
+	SceneCuts []float64 `json:",omitempty"`
+	// FrameDuration is compressed video duration derived from frame
+	// timestamps (VideoDuration is container reported), only set when
+	// duration check is done
+	FrameDuration float64 `json:",omitempty"`
+	// DurationMismatch is set when FrameDuration and VideoDuration differ
+	// beyond tolerance, usually a sign of muxing issues
+	DurationMismatch bool `json:",omitempty"`
+	// TargetSearch is a result of target VMAF search, only set for target
+	// VMAF schemes
+	TargetSearch *TargetSearch `json:",omitempty"`
+	// RateControl is comparison of measured average bitrate with target
+	// bitrate, only set for commands with TargetBitrate
+	RateControl *RateControl `json:",omitempty"`
+	// Deterministic is set when determinism check is done, true means second
+	// run of encoding command produced byte identical compressed file
+	Deterministic *bool `json:",omitempty"`
+	// EncoderVersion is encoder library version parsed from encoder output
+	// (e.g. "x265 3.5+1-f0c1022b6"), empty when not found
+	EncoderVersion string `json:",omitempty"`
+	// OutputTail are last lines of encoder output, only set on failure
+	OutputTail []string `json:",omitempty"`
+	// Metadata of compressed video as probed after encoding, nil in case it
+	// is not known (e.g. report loaded from file)
+	Metadata *video.Metadata `json:"-"`
+}
+
+// RateControl quantifies rate control accuracy: how far measured average
+// bitrate overshot (or undershot) target bitrate.
+type RateControl struct {
+	// TargetBitrate and Bitrate are target and measured average bitrates in
+	// kbit/s
+	TargetBitrate float64
+	Bitrate       float64
+	// Deviation is Bitrate minus TargetBitrate in kbit/s, positive means
+	// overshoot
+	Deviation float64
+	// DeviationPercent is Deviation relative to TargetBitrate in percent
+	DeviationPercent float64
+}
+
+// newRateControl will compare measured bitrate (in bit/s, as reported by
+// ffprobe) with target bitrate (in kbit/s), nil is returned when either of
+// them is not known.
+func newRateControl(target float64, bitRate int) *RateControl {
+	if target <= 0 || bitRate <= 0 {
+		return nil
+	}
+	rc := &RateControl{TargetBitrate: target, Bitrate: float64(bitRate) / 1000}
+	rc.Deviation = rc.Bitrate - rc.TargetBitrate
+	rc.DeviationPercent = rc.Deviation / rc.TargetBitrate * 100
+	return rc
 }
 
 // ExitCode returns exit code of executed encoding run.
+//
+// In case command did not start or did not complete (e.g. context was canceled
+// or encoding was reused) -1 is returned.
 func (s *RunResult) ExitCode() int {
-	return s.cmd.ProcessState.ExitCode()
+	if s.exec == nil {
+		return -1
+	}
+	return s.exec.ExitCode
 }
 
 // Output returns output from encoding run.
@@ -286,11 +988,6 @@ func (s *RunResult) Output() string {
 	return string(s.stderr)
 }
 
-func (s *RunResult) Rusage() *syscall.Rusage {
-	usage, _ := s.cmd.ProcessState.SysUsage().(*syscall.Rusage)
-	return usage
-}
-
 func (s *RunResult) AddError(e error) {
 	s.Errors = append(s.Errors, e)
 }
@@ -305,20 +1002,31 @@ type UsageStat struct {
 	Stime   time.Duration
 	Utime   time.Duration
 	Elapsed time.Duration
-	// MaxRss is KB
+	// MaxRss is KB (normalized across platforms), it is a peak RSS of the
+	// largest process among encoder command's processes (e.g. ffmpeg spawned
+	// by shell)
 	MaxRss int64
+	// PeakRss is KB, a sampled peak of total RSS of all encoder command's
+	// processes, includes all processes of a pipeline (Linux only)
+	PeakRss int64 `json:",omitempty"`
 }
 
-// NewUsageStat will create UsageStat instance.
-func NewUsageStat(elapsed time.Duration, rusage *syscall.Rusage) UsageStat {
+// NewUsageStat will create UsageStat instance from executed command's
+// ExecResult.
+func NewUsageStat(elapsed time.Duration, res *ExecResult) UsageStat {
+	// Missing result is treated as zero resource usage.
+	if res == nil {
+		res = &ExecResult{}
+	}
 	return UsageStat{
-		Stime:    time.Duration(syscall.TimevalToNsec(rusage.Stime)),
-		Utime:    time.Duration(syscall.TimevalToNsec(rusage.Utime)),
+		Stime:    res.Stime,
+		Utime:    res.Utime,
 		Elapsed:  elapsed,
-		HStime:   time.Duration(syscall.TimevalToNsec(rusage.Stime)).String(),
-		HUtime:   time.Duration(syscall.TimevalToNsec(rusage.Utime)).String(),
+		HStime:   res.Stime.String(),
+		HUtime:   res.Utime.String(),
 		HElapsed: elapsed.String(),
-		MaxRss:   rusage.Maxrss,
+		MaxRss:   res.MaxRss,
+		PeakRss:  res.PeakRss,
 	}
 }
 
@@ -327,13 +1035,40 @@ func (s *UsageStat) CPUPercent() float64 {
 	return float64(s.Stime+s.Utime) / float64(s.Elapsed) * 100
 }
 
-// generateOutputFileNameBase will generate a sensible output filename without extension.
+// fileNameReplacer replaces characters that are not valid (or are awkward) in
+// file names on any of target filesystems (Windows, macOS, Linux).
+var fileNameReplacer = strings.NewReplacer(
+	" ", "_", ":", "_", "/", "_", "\\", "_", "*", "_", "?", "_",
+	"\"", "_", "<", "_", ">", "_", "|", "_",
+)
+
+// normalizeFileName will make name a sane file name component: characters not
+// valid in file names on all target filesystems (and spaces) are replaced with
+// underscores, control characters are dropped.
+func normalizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	return fileNameReplacer.Replace(name)
+}
+
+// generateOutputFileNameBase will generate a sensible output filename without
+// extension.
+//
+// Paths are handled with path/filepath, so that input and output directory
+// paths follow conventions of platform ease is run on.
 func generateOutputFileNameBase(inputFile, outDir, postfix string) string {
-	// Normalize filename strings to sane format (no spaces).
-	normalize := func(input string) string {
-		return strings.ReplaceAll(input, " ", "_")
+	// Query string and fragment of URL input (e.g. signed URL) are not part
+	// of the name.
+	if tools.IsURL(inputFile) {
+		if u, err := url.Parse(inputFile); err == nil {
+			inputFile = u.Path
+		}
 	}
-	baseName := path.Base(inputFile)
+	baseName := filepath.Base(inputFile)
 	baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName))
-	return path.Join(outDir, fmt.Sprintf("%s_%s", normalize(baseName), normalize(postfix)))
+	return filepath.Join(outDir, fmt.Sprintf("%s_%s", normalizeFileName(baseName), normalizeFileName(postfix)))
 }
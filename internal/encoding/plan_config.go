@@ -6,10 +6,19 @@
 package encoding
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
+
+	"github.com/evolution-gaming/ease/internal/tools"
+	"github.com/evolution-gaming/ease/internal/vqm"
 )
 
 // PlanConfigError error type defines PlanConfig validation failures.
@@ -40,26 +49,375 @@ type PlanConfig struct {
 	// List of source (mezzanine) video files.
 	Inputs  []string
 	Schemes []Scheme
+	// Global arguments inserted after ffmpeg executable in each scheme's
+	// command (e.g. "-hwaccel cuda").
+	GlobalArgs string `json:",omitempty"`
+	// Per-input libvmaf models, first matching rule wins.
+	VMAFModels []VMAFModelRule `json:",omitempty"`
+	// libvmaf filter options pinned for reproducible VQMs.
+	VMAFOptions *vqm.LibvmafOptions `json:",omitempty"`
+	// Per-input ffmpeg input-side options (e.g. for raw sources), first
+	// matching rule wins.
+	InputOptions []InputOptions `json:",omitempty"`
+	// ffmpeg log level (e.g. "error", "verbose") injected into each scheme's
+	// command as "-loglevel" global argument.
+	LogLevel string `json:",omitempty"`
+	// Limit in bytes for encoder output captured per encoding, 0 means default
+	// limit (5 MiB).
+	OutputBufferSize uint `json:",omitempty"`
+	// Keep only tail of encoder output when it exceeds OutputBufferSize
+	// instead of failing encoding.
+	TruncateOutput bool `json:",omitempty"`
+	// Number of last encoder output lines kept in report for failed
+	// encodings, 0 means default (10 lines).
+	OutputTailLines uint `json:",omitempty"`
+	// Regular expressions matched against encoder output, a match fails
+	// encoding even with zero exit code (e.g. "non monotonically increasing
+	// dts").
+	FailOnOutput []string `json:",omitempty"`
+	// Niceness (-20..19) of encoder processes, 0 means normal priority.
+	Nice int `json:",omitempty"`
+	// I/O scheduling class ("idle" or "best-effort") of encoder processes,
+	// empty means no change. Linux only.
+	IOClass string `json:",omitempty"`
+	// Shell encoder commands are run with: "sh" (default), "bash", "none"
+	// (direct execution) or "auto" (direct execution unless command uses
+	// shell features like pipes or redirects).
+	Shell string `json:",omitempty"`
+	// Command run after each encoding with run result passed via EASE_*
+	// environment variables (e.g. to upload compressed file).
+	PostEncodeHook *Hook `json:",omitempty"`
+}
+
+// ffmpegLogLevels are valid values for ffmpeg's -loglevel option.
+var ffmpegLogLevels = []string{
+	"quiet", "panic", "fatal", "error", "warning", "info", "verbose", "debug", "trace",
+}
+
+// VMAFModelRule associates libvmaf model file with inputs matching a pattern.
+type VMAFModelRule struct {
+	// Input is a glob pattern (see path.Match) matched against input path or
+	// input file base name, relative paths are relative to plan file.
+	Input string
+	// Model is path to libvmaf model file (relative to plan file) or libvmaf
+	// model preset name (e.g. "phone", "4k").
+	Model string
+}
+
+// VMAFModelFor returns libvmaf model for given input, defaultModel is returned
+// if none of VMAFModels rules match.
+func (p *PlanConfig) VMAFModelFor(input, defaultModel string) string {
+	for _, r := range p.VMAFModels {
+		if ok, _ := path.Match(r.Input, input); ok {
+			return r.Model
+		}
+		if ok, _ := path.Match(r.Input, path.Base(input)); ok {
+			return r.Model
+		}
+	}
+	return defaultModel
+}
+
+// InputOptions holds ffmpeg input-side options for inputs matching a pattern.
+//
+// These are needed for inputs without container (e.g. raw YUV files) where
+// ffmpeg can not detect format, resolution, pixel format and frame rate.
+type InputOptions struct {
+	// Input is a glob pattern (see path.Match) matched against input path or
+	// input file base name, relative paths are relative to plan file, empty
+	// pattern matches all inputs.
+	Input string
+	// Format is input format (e.g. "rawvideo"), passed as -f.
+	Format string `json:",omitempty"`
+	// Size is frame size (e.g. "1920x1080"), passed as -video_size.
+	Size string `json:",omitempty"`
+	// PixFmt is pixel format (e.g. "yuv420p"), passed as -pix_fmt.
+	PixFmt string `json:",omitempty"`
+	// FrameRate is frame rate (e.g. "25", "30000/1001"), passed as -framerate.
+	FrameRate string `json:",omitempty"`
+}
+
+// Args returns ffmpeg input-side arguments for options.
+func (o *InputOptions) Args() string {
+	var args []string
+	for _, a := range []struct{ flag, value string }{
+		{"-f", o.Format},
+		{"-video_size", o.Size},
+		{"-pix_fmt", o.PixFmt},
+		{"-framerate", o.FrameRate},
+	} {
+		if a.value != "" {
+			args = append(args, a.flag, a.value)
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// validate checks that option values are single command line tokens.
+func (o *InputOptions) validate() error {
+	for _, v := range []string{o.Format, o.Size, o.PixFmt, o.FrameRate} {
+		if strings.ContainsAny(v, " \t\n'\"") {
+			return fmt.Errorf("invalid option value %q", v)
+		}
+	}
+	if _, err := path.Match(o.Input, ""); err != nil {
+		return fmt.Errorf("invalid pattern %s: %w", o.Input, err)
+	}
+	return nil
+}
+
+// InputArgsFor returns ffmpeg input-side arguments for given input, empty
+// string is returned if none of InputOptions rules match.
+func (p *PlanConfig) InputArgsFor(input string) string {
+	for i := range p.InputOptions {
+		r := &p.InputOptions[i]
+		if r.Input == "" {
+			return r.Args()
+		}
+		if ok, _ := path.Match(r.Input, input); ok {
+			return r.Args()
+		}
+		if ok, _ := path.Match(r.Input, path.Base(input)); ok {
+			return r.Args()
+		}
+	}
+	return ""
 }
 
 // NewPlanConfigFromJSON will unmarshal JSON into PlanConfig instance.
+//
+// Unknown (e.g. misspelled) keys are rejected, since otherwise they silently
+// yield empty configuration fields.
 func NewPlanConfigFromJSON(jdoc []byte) (PlanConfig, error) {
 	var pc PlanConfig
 	err := json.Unmarshal(jdoc, &pc)
 	if err != nil {
 		return pc, err
 	}
+	if err := checkUnknownFields(jdoc); err != nil {
+		return PlanConfig{}, err
+	}
+	return pc, nil
+}
+
+// csvColumns are columns of CSV plan configuration in header order.
+var csvColumns = []string{"Input", "Scheme", "CommandTpl"}
+
+// NewPlanConfigFromCSV will create PlanConfig instance from CSV document.
+//
+// CSV must have "Input,Scheme,CommandTpl" header row, each following row
+// applies scheme to an input. Inputs and Schemes are listed in order of first
+// appearance, scheme that is not applied to all inputs is restricted to its
+// inputs via Scheme.Inputs. Other settings (e.g. OutDir) are not expressible
+// in CSV and are expected to come from other plan merged in (see
+// MergePlanConfigs).
+func NewPlanConfigFromCSV(doc []byte) (PlanConfig, error) {
+	var pc PlanConfig
+	r := csv.NewReader(bytes.NewReader(doc))
+	r.FieldsPerRecord = len(csvColumns)
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return pc, err
+	}
+	if len(records) == 0 {
+		return pc, &PlanConfigError{msg: "CSV header missing"}
+	}
+	for i, c := range records[0] {
+		if !strings.EqualFold(strings.TrimSpace(c), csvColumns[i]) {
+			return pc, &PlanConfigError{msg: fmt.Sprintf(
+				"CSV header invalid, expected %s", strings.Join(csvColumns, ","))}
+		}
+	}
+
+	errPlanConfig := &PlanConfigError{msg: "CSV error"}
+	schemeInputs := make(map[string][]string)
+	for i, rec := range records[1:] {
+		input, name, tpl := strings.TrimSpace(rec[0]), strings.TrimSpace(rec[1]), rec[2]
+		line := i + 2
+		if input == "" || name == "" || strings.TrimSpace(tpl) == "" {
+			errPlanConfig.addReason(fmt.Sprintf("line %d: empty field", line))
+			continue
+		}
+		if !contains(pc.Inputs, input) {
+			pc.Inputs = append(pc.Inputs, input)
+		}
+		inputs, ok := schemeInputs[name]
+		if !ok {
+			pc.Schemes = append(pc.Schemes, Scheme{Name: name, CommandTpl: tpl})
+		}
+		for _, s := range pc.Schemes {
+			if s.Name == name && s.CommandTpl != tpl {
+				errPlanConfig.addReason(fmt.Sprintf("line %d: scheme %s has different CommandTpl", line, name))
+			}
+		}
+		if contains(inputs, input) {
+			errPlanConfig.addReason(fmt.Sprintf("line %d: scheme %s applied to %s more than once", line, name, input))
+		}
+		schemeInputs[name] = append(inputs, input)
+	}
+	if len(errPlanConfig.reasons) != 0 {
+		return PlanConfig{}, errPlanConfig
+	}
+
+	for i := range pc.Schemes {
+		s := &pc.Schemes[i]
+		if len(schemeInputs[s.Name]) < len(pc.Inputs) {
+			s.Inputs = schemeInputs[s.Name]
+		}
+	}
 	return pc, nil
 }
 
+// checkUnknownFields will return PlanConfigError in case JSON document has
+// keys not known to PlanConfig.
+func checkUnknownFields(jdoc []byte) error {
+	// Scheme has custom Unmarshaler which is not affected by decoder's
+	// DisallowUnknownFields, so shadow Schemes with plain struct.
+	var strict struct {
+		PlanConfig
+		Schemes []schemeJSON
+	}
+	dec := json.NewDecoder(bytes.NewReader(jdoc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&strict); err != nil {
+		errPlanConfig := &PlanConfigError{msg: "unknown key"}
+		errPlanConfig.addReason(fmt.Sprintf("%s (misspelled key?)", strings.TrimPrefix(err.Error(), "json: ")))
+		return errPlanConfig
+	}
+	return nil
+}
+
+// ResolvePaths will make relative Inputs, OutDir and VMAFModels model paths
+// relative to baseDir (e.g. directory of plan configuration file), absolute
+// paths are left as is. Input patterns of VMAFModels and InputOptions rules
+// containing a directory part are resolved the same way, so that they keep
+// matching resolved inputs, base name only patterns are left as is.
+func (p *PlanConfig) ResolvePaths(baseDir string) {
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) || tools.IsURL(p) {
+			return p
+		}
+		return filepath.Join(baseDir, p)
+	}
+	resolvePattern := func(p string) string {
+		if !strings.Contains(p, "/") || path.IsAbs(p) || tools.IsURL(p) {
+			return p
+		}
+		return path.Join(escapePattern(filepath.ToSlash(baseDir)), p)
+	}
+	for i := range p.VMAFModels {
+		r := &p.VMAFModels[i]
+		r.Input = resolvePattern(r.Input)
+		if !vqm.IsModelPreset(r.Model) {
+			r.Model = resolve(r.Model)
+		}
+	}
+	for i := range p.InputOptions {
+		p.InputOptions[i].Input = resolvePattern(p.InputOptions[i].Input)
+	}
+	for i := range p.Inputs {
+		p.Inputs[i] = resolve(p.Inputs[i])
+	}
+	for i := range p.Schemes {
+		for j := range p.Schemes[i].Inputs {
+			p.Schemes[i].Inputs[j] = resolve(p.Schemes[i].Inputs[j])
+		}
+	}
+	p.OutDir = resolve(p.OutDir)
+}
+
+// escapePattern escapes path.Match meta characters in s, so that it matches
+// itself only.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// MergePlanConfigs merges plan fragments (e.g. inputs list and scheme
+// library) into a single PlanConfig. Inputs, Schemes and other list settings
+// are concatenated in given order, scalar settings (OutDir, LogLevel etc.) are
+// taken from the first fragment that sets them. Scheme names must be unique
+// across fragments.
+func MergePlanConfigs(pcs ...PlanConfig) (PlanConfig, error) {
+	var m PlanConfig
+	names := make(map[string]struct{})
+	for i := range pcs {
+		pc := &pcs[i]
+		for _, s := range pc.Schemes {
+			if _, ok := names[s.Name]; ok {
+				return m, fmt.Errorf("scheme %q defined in more than one plan", s.Name)
+			}
+			names[s.Name] = struct{}{}
+		}
+		m.Inputs = append(m.Inputs, pc.Inputs...)
+		m.Schemes = append(m.Schemes, pc.Schemes...)
+		m.VMAFModels = append(m.VMAFModels, pc.VMAFModels...)
+		m.InputOptions = append(m.InputOptions, pc.InputOptions...)
+		m.FailOnOutput = append(m.FailOnOutput, pc.FailOnOutput...)
+
+		if m.OutDir == "" {
+			m.OutDir = pc.OutDir
+		}
+		if m.GlobalArgs == "" {
+			m.GlobalArgs = pc.GlobalArgs
+		}
+		if m.VMAFOptions == nil {
+			m.VMAFOptions = pc.VMAFOptions
+		}
+		if m.LogLevel == "" {
+			m.LogLevel = pc.LogLevel
+		}
+		if m.OutputBufferSize == 0 {
+			m.OutputBufferSize = pc.OutputBufferSize
+		}
+		if m.OutputTailLines == 0 {
+			m.OutputTailLines = pc.OutputTailLines
+		}
+		if m.Nice == 0 {
+			m.Nice = pc.Nice
+		}
+		if m.IOClass == "" {
+			m.IOClass = pc.IOClass
+		}
+		if m.Shell == "" {
+			m.Shell = pc.Shell
+		}
+		if m.PostEncodeHook == nil {
+			m.PostEncodeHook = pc.PostEncodeHook
+		}
+		m.TruncateOutput = m.TruncateOutput || pc.TruncateOutput
+	}
+	return m, nil
+}
+
+// IsValid checks that PlanConfig is usable, warnings are not reported (see
+// Validate).
 func (p *PlanConfig) IsValid() (bool, error) {
+	_, err := p.Validate()
+	return err == nil, err
+}
+
+// Validate checks PlanConfig and returns warnings along with PlanConfigError
+// in case of errors.
+//
+// Errors make plan unusable (e.g. missing inputs), while warnings flag things
+// that might be intentional (e.g. duplicate inputs, which are run once) and do
+// not prevent plan from running.
+func (p *PlanConfig) Validate() (warnings []string, err error) {
 	errPlanConfig := &PlanConfigError{msg: "validation error"}
 
 	if len(p.Inputs) == 0 {
 		errPlanConfig.addReason("Inputs missing")
 	}
 	if hasDuplicates(p.Inputs) {
-		errPlanConfig.addReason("Duplicate inputs detected")
+		warnings = append(warnings, "Duplicate inputs detected, each input is encoded once")
 	}
 	if len(p.Schemes) == 0 {
 		errPlanConfig.addReason("Schemes missing")
@@ -69,16 +427,128 @@ func (p *PlanConfig) IsValid() (bool, error) {
 	}
 
 	for _, i := range p.Inputs {
+		// URL inputs are fetched by ffmpeg, ProbeInputs still checks them
+		// via ffprobe.
+		if tools.IsURL(i) {
+			continue
+		}
 		if _, err := os.Stat(i); err != nil {
 			errPlanConfig.addReason(err.Error())
 		}
 	}
 
+	if p.LogLevel != "" && !contains(ffmpegLogLevels, p.LogLevel) {
+		errPlanConfig.addReason(fmt.Sprintf("LogLevel invalid: %s", p.LogLevel))
+	}
+
+	if p.Nice < -20 || p.Nice > 19 {
+		errPlanConfig.addReason(fmt.Sprintf("Nice out of range -20..19: %d", p.Nice))
+	}
+	if p.IOClass != "" && !contains([]string{IOClassBestEffort, IOClassIdle}, p.IOClass) {
+		errPlanConfig.addReason(fmt.Sprintf("IOClass invalid: %s", p.IOClass))
+	}
+	if p.Shell != "" && !contains([]string{ShellSh, ShellBash, ShellNone, ShellAuto}, p.Shell) {
+		errPlanConfig.addReason(fmt.Sprintf("Shell invalid: %s", p.Shell))
+	}
+	if err := p.PostEncodeHook.validate(); err != nil {
+		errPlanConfig.addReason(fmt.Sprintf("PostEncodeHook: %s", err))
+	}
+
+	for _, s := range p.Schemes {
+		if err := s.VMAFGeometry.validate(); err != nil {
+			errPlanConfig.addReason(fmt.Sprintf("Scheme %s VMAFGeometry: %s", s.Name, err))
+		}
+		for _, f := range s.VMAFFeatures {
+			if !vqm.IsFeatureName(f) {
+				errPlanConfig.addReason(fmt.Sprintf("Scheme %s VMAFFeatures invalid: %q", s.Name, f))
+			}
+		}
+		if s.VMAFUpscale != "" && !vqm.IsUpscaleMethod(s.VMAFUpscale) {
+			errPlanConfig.addReason(fmt.Sprintf("Scheme %s VMAFUpscale invalid: %s", s.Name, s.VMAFUpscale))
+		}
+		if err := s.TargetVMAF.validate(); err != nil {
+			errPlanConfig.addReason(fmt.Sprintf("Scheme %s TargetVMAF: %s", s.Name, err))
+		}
+		if s.TargetBitrate < 0 {
+			errPlanConfig.addReason(fmt.Sprintf("Scheme %s TargetBitrate negative: %g", s.Name, s.TargetBitrate))
+		}
+		for _, i := range s.Inputs {
+			if !contains(p.Inputs, i) {
+				errPlanConfig.addReason(fmt.Sprintf("Scheme %s Inputs: %s not in plan Inputs", s.Name, i))
+			}
+		}
+		if s.TargetVMAF != nil && !strings.Contains(s.CommandTpl, crfPlaceholder) {
+			errPlanConfig.addReason(fmt.Sprintf("Scheme %s TargetVMAF: %s placeholder missing in CommandTpl", s.Name, crfPlaceholder))
+		}
+	}
+
+	if p.VMAFOptions != nil {
+		if err := p.VMAFOptions.Validate(); err != nil {
+			errPlanConfig.addReason(fmt.Sprintf("VMAFOptions: %s", err))
+		}
+	}
+
+	for _, v := range p.FailOnOutput {
+		if _, err := regexp.Compile(v); err != nil {
+			errPlanConfig.addReason(fmt.Sprintf("FailOnOutput invalid pattern %q: %s", v, err))
+		}
+	}
+
+	for i := range p.InputOptions {
+		if err := p.InputOptions[i].validate(); err != nil {
+			errPlanConfig.addReason(fmt.Sprintf("InputOptions: %s", err))
+		}
+	}
+
+	for _, r := range p.VMAFModels {
+		if _, err := path.Match(r.Input, ""); err != nil {
+			errPlanConfig.addReason(fmt.Sprintf("VMAFModels invalid pattern %s: %s", r.Input, err))
+		}
+		if vqm.IsModelPreset(r.Model) {
+			continue
+		}
+		if _, err := os.Stat(r.Model); err != nil {
+			errPlanConfig.addReason(fmt.Sprintf("VMAFModels model: %s", err))
+			continue
+		}
+		if err := tools.ValidateLibvmafModel(r.Model); err != nil {
+			errPlanConfig.addReason(fmt.Sprintf("VMAFModels model: %s", err))
+		}
+	}
+
 	// Check if there were any validation errors?
 	if len(errPlanConfig.reasons) != 0 {
-		return false, errPlanConfig
+		return warnings, errPlanConfig
 	}
-	return true, nil
+	return warnings, nil
+}
+
+// ProbeInputs checks that all Inputs are video files.
+//
+// Each input is probed via ffprobe, inputs without video stream or with zero
+// frames are rejected. This is a more expensive check than IsValid() since it
+// requires running external tool for each input.
+func (p *PlanConfig) ProbeInputs() error {
+	errPlanConfig := &PlanConfigError{msg: "input probe error"}
+
+	for _, i := range p.Inputs {
+		// Raw inputs are probed with the same input-side options they are
+		// encoded with.
+		vmeta, err := tools.FfprobeExtractMetadata(i, tools.WithInputArgs(strings.Fields(p.InputArgsFor(i))...))
+		switch {
+		case errors.Is(err, tools.ErrNoVideoStream):
+			errPlanConfig.addReason(fmt.Sprintf("input %s has no video stream", i))
+		case err != nil:
+			errPlanConfig.addReason(fmt.Sprintf("input %s is not a valid video file: %s", i, err))
+		case vmeta.FrameCount == 0:
+			errPlanConfig.addReason(fmt.Sprintf("input %s has zero frames", i))
+		}
+	}
+
+	if len(errPlanConfig.reasons) != 0 {
+		return errPlanConfig
+	}
+	return nil
 }
 
 // hasDuplicates checks if slice has duplicate elements.
@@ -94,3 +564,13 @@ func hasDuplicates(items []string) bool {
 	}
 	return false
 }
+
+// contains reports whether item is present in items.
+func contains(items []string, item string) bool {
+	for _, v := range items {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
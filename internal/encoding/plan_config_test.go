@@ -7,12 +7,15 @@
 package encoding
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/evolution-gaming/ease/internal/vqm"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -47,8 +50,8 @@ func TestNewPlanConfigFromJSON(t *testing.T) {
 					"src/vid2.mp4",
 				},
 				Schemes: []Scheme{
-					{"sc1", "sc1 command template"},
-					{"sc2", "sc2 command template"},
+					{Name: "sc1", CommandTpl: "sc1 command template"},
+					{Name: "sc2", CommandTpl: "sc2 command template"},
 				},
 			},
 			err: nil,
@@ -59,6 +62,26 @@ func TestNewPlanConfigFromJSON(t *testing.T) {
 			want:  PlanConfig{OutDir: "out"},
 			err:   nil,
 		},
+		"Negative misspelled key": {
+			given: []byte(`{"OutDir": "out", "Scheme": []}`),
+			want:  PlanConfig{},
+			err:   &PlanConfigError{},
+		},
+		"Negative misspelled Scheme key": {
+			given: []byte(`{"OutDir": "out", "Schemes": [{"Name": "sc1", "CommandTemplate": ["a"]}]}`),
+			want:  PlanConfig{},
+			err:   &PlanConfigError{},
+		},
+		"Positive VMAFOptions": {
+			given: []byte(`{"OutDir": "out", "VMAFOptions": {"Pool": "harmonic_mean", "NSubsample": 1}}`),
+			want:  PlanConfig{OutDir: "out", VMAFOptions: &vqm.LibvmafOptions{Pool: "harmonic_mean", NSubsample: 1}},
+			err:   nil,
+		},
+		"Negative unknown VMAFOptions key": {
+			given: []byte(`{"OutDir": "out", "VMAFOptions": {"Motion": true}}`),
+			want:  PlanConfig{},
+			err:   &PlanConfigError{},
+		},
 		"Negative invalid JSON": {
 			given: []byte("]"),
 			want:  PlanConfig{},
@@ -85,13 +108,84 @@ func TestNewPlanConfigFromJSON(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("Unknown key error should name the key", func(t *testing.T) {
+		_, err := NewPlanConfigFromJSON([]byte(`{"OutDir": "out", "Scheme": []}`))
+		want := `unknown key with reasons:
+unknown field "Scheme" (misspelled key?)`
+		if diff := cmp.Diff(want, err.Error()); diff != "" {
+			t.Errorf("Error message mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestNewPlanConfigFromCSV(t *testing.T) {
+	tests := map[string]struct {
+		err   error
+		want  PlanConfig
+		given string
+	}{
+		"Positive": {
+			given: "Input,Scheme,CommandTpl\n" +
+				"vid1.mp4,sc1,sc1 %INPUT% %OUTPUT%\n" +
+				"vid2.mp4,sc1,sc1 %INPUT% %OUTPUT%\n" +
+				"vid2.mp4,sc2,\"sc2 -vf scale=1280:-2,fps=25 %INPUT% %OUTPUT%\"\n",
+			want: PlanConfig{
+				Inputs: []string{"vid1.mp4", "vid2.mp4"},
+				Schemes: []Scheme{
+					{Name: "sc1", CommandTpl: "sc1 %INPUT% %OUTPUT%"},
+					{Name: "sc2", CommandTpl: "sc2 -vf scale=1280:-2,fps=25 %INPUT% %OUTPUT%", Inputs: []string{"vid2.mp4"}},
+				},
+			},
+		},
+		"Negative header missing": {
+			given: "vid1.mp4,sc1,sc1 %INPUT% %OUTPUT%\n",
+			err:   &PlanConfigError{},
+		},
+		"Negative empty field": {
+			given: "Input,Scheme,CommandTpl\nvid1.mp4,,sc1 %INPUT% %OUTPUT%\n",
+			err:   &PlanConfigError{},
+		},
+		"Negative conflicting CommandTpl": {
+			given: "Input,Scheme,CommandTpl\nvid1.mp4,sc1,a\nvid2.mp4,sc1,b\n",
+			err:   &PlanConfigError{},
+		},
+		"Negative duplicate row": {
+			given: "Input,Scheme,CommandTpl\nvid1.mp4,sc1,a\nvid1.mp4,sc1,a\n",
+			err:   &PlanConfigError{},
+		},
+		"Negative wrong number of fields": {
+			given: "Input,Scheme,CommandTpl\nvid1.mp4,sc1\n",
+			err:   &csv.ParseError{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewPlanConfigFromCSV([]byte(tc.given))
+
+			if tc.err == nil {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			} else {
+				if gotE, wantE := reflect.TypeOf(err), reflect.TypeOf(tc.err); gotE != wantE {
+					t.Errorf("Error type mismatch want: %v, got: %v\n", wantE, gotE)
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("PlanConfig mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
 }
 
 func TestPlanConfigIsValid(t *testing.T) {
 	pc := PlanConfig{
-		OutDir:  ".",
-		Inputs:  []string{"../../testdata/video/testsrc01.mp4"},
-		Schemes: []Scheme{{}},
+		OutDir:     ".",
+		Inputs:     []string{"../../testdata/video/testsrc01.mp4"},
+		Schemes:    []Scheme{{}},
+		VMAFModels: []VMAFModelRule{{Input: "*", Model: "4k"}},
 	}
 	got, err := pc.IsValid()
 
@@ -110,6 +204,44 @@ func TestPlanConfigIsValid(t *testing.T) {
 	})
 }
 
+func TestPlanConfigValidate(t *testing.T) {
+	t.Run("Should warn about duplicate inputs", func(t *testing.T) {
+		pc := PlanConfig{
+			OutDir:  ".",
+			Inputs:  []string{"../../testdata/video/testsrc01.mp4", "../../testdata/video/testsrc01.mp4"},
+			Schemes: []Scheme{{}},
+		}
+		warnings, err := pc.Validate()
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		want := []string{"Duplicate inputs detected, each input is encoded once"}
+		if diff := cmp.Diff(want, warnings); diff != "" {
+			t.Errorf("Warnings mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should not stat URL inputs", func(t *testing.T) {
+		pc := PlanConfig{
+			OutDir:  ".",
+			Inputs:  []string{"https://storage.example.com/mezz/clip01.mp4"},
+			Schemes: []Scheme{{}},
+		}
+		if _, err := pc.Validate(); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+	t.Run("Should return warnings along with errors", func(t *testing.T) {
+		pc := PlanConfig{Inputs: []string{"no_existent_file", "no_existent_file"}}
+		warnings, err := pc.Validate()
+		if err == nil {
+			t.Error("Expected validation error")
+		}
+		if diff := cmp.Diff(1, len(warnings)); diff != "" {
+			t.Errorf("Warning count mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
 func TestNegativePlanConfigIsValid(t *testing.T) {
 	wantErrorMsg := "validation error"
 	tests := map[string]struct {
@@ -140,14 +272,23 @@ func TestNegativePlanConfigIsValid(t *testing.T) {
 				"Inputs missing",
 			},
 		},
-		"Negative duplicate Inputs": {
+		"Negative duplicate Inputs are not an error": {
 			given: PlanConfig{
-				OutDir:  ".",
 				Schemes: []Scheme{{}},
 				Inputs:  []string{"../../testdata/video/testsrc01.mp4", "../../testdata/video/testsrc01.mp4"},
 			},
 			wantReasons: []string{
-				"Duplicate inputs detected",
+				"OutDir missing",
+			},
+		},
+		"Negative scheme Inputs not in plan": {
+			given: PlanConfig{
+				OutDir:  ".",
+				Inputs:  []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes: []Scheme{{Name: "sc1", Inputs: []string{"other.mp4"}}},
+			},
+			wantReasons: []string{
+				"Scheme sc1 Inputs: other.mp4 not in plan Inputs",
 			},
 		},
 		"Negative empty OutDir": {
@@ -160,6 +301,151 @@ func TestNegativePlanConfigIsValid(t *testing.T) {
 				"OutDir missing",
 			},
 		},
+		"Negative wrong VMAFModels": {
+			given: PlanConfig{
+				OutDir:     ".",
+				Inputs:     []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes:    []Scheme{{}},
+				VMAFModels: []VMAFModelRule{{Input: "[", Model: "no_existent_model"}},
+			},
+			wantReasons: []string{
+				"VMAFModels invalid pattern [: syntax error in pattern",
+				"VMAFModels model: stat no_existent_model: no such file or directory",
+			},
+		},
+		"Negative wrong LogLevel": {
+			given: PlanConfig{
+				OutDir:   ".",
+				Inputs:   []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes:  []Scheme{{}},
+				LogLevel: "loud",
+			},
+			wantReasons: []string{
+				"LogLevel invalid: loud",
+			},
+		},
+		"Negative wrong VMAFGeometry": {
+			given: PlanConfig{
+				OutDir:  ".",
+				Inputs:  []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes: []Scheme{{Name: "sc1", VMAFGeometry: &Geometry{Crop: "1920:800,hflip"}}},
+			},
+			wantReasons: []string{
+				`Scheme sc1 VMAFGeometry: invalid filter arguments "1920:800,hflip"`,
+			},
+		},
+		"Negative wrong VMAFFeatures": {
+			given: PlanConfig{
+				OutDir:  ".",
+				Inputs:  []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes: []Scheme{{Name: "sc1", VMAFFeatures: []string{"psnr", "cambi:tmax=1"}}},
+			},
+			wantReasons: []string{
+				`Scheme sc1 VMAFFeatures invalid: "cambi:tmax=1"`,
+			},
+		},
+		"Negative wrong priority": {
+			given: PlanConfig{
+				OutDir:  ".",
+				Inputs:  []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes: []Scheme{{}},
+				Nice:    20,
+				IOClass: "realtime",
+			},
+			wantReasons: []string{
+				"Nice out of range -20..19: 20",
+				"IOClass invalid: realtime",
+			},
+		},
+		"Negative wrong VMAFUpscale": {
+			given: PlanConfig{
+				OutDir:  ".",
+				Inputs:  []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes: []Scheme{{Name: "sc1", VMAFUpscale: "bicubic"}, {Name: "sc2", VMAFUpscale: "cubic"}},
+			},
+			wantReasons: []string{
+				"Scheme sc2 VMAFUpscale invalid: cubic",
+			},
+		},
+		"Negative TargetBitrate": {
+			given: PlanConfig{
+				OutDir:  ".",
+				Inputs:  []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes: []Scheme{{Name: "sc1", TargetBitrate: -1}},
+			},
+			wantReasons: []string{
+				"Scheme sc1 TargetBitrate negative: -1",
+			},
+		},
+		"Negative wrong shell": {
+			given: PlanConfig{
+				OutDir:  ".",
+				Inputs:  []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes: []Scheme{{}},
+				Shell:   "zsh",
+			},
+			wantReasons: []string{
+				"Shell invalid: zsh",
+			},
+		},
+		"Negative empty PostEncodeHook": {
+			given: PlanConfig{
+				OutDir:         ".",
+				Inputs:         []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes:        []Scheme{{}},
+				PostEncodeHook: &Hook{Cmd: " "},
+			},
+			wantReasons: []string{
+				"PostEncodeHook: Cmd missing",
+			},
+		},
+		"Negative wrong FailOnOutput": {
+			given: PlanConfig{
+				OutDir:       ".",
+				Inputs:       []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes:      []Scheme{{}},
+				FailOnOutput: []string{"dts", "[a-"},
+			},
+			wantReasons: []string{
+				"FailOnOutput invalid pattern \"[a-\": error parsing regexp: missing closing ]: `[a-`",
+			},
+		},
+		"Negative wrong TargetVMAF": {
+			given: PlanConfig{
+				OutDir: ".",
+				Inputs: []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes: []Scheme{
+					{Name: "a", CommandTpl: "ffmpeg -crf %CRF%", TargetVMAF: &TargetVMAF{VMAF: 93, MinCRF: 30, MaxCRF: 20}},
+					{Name: "b", CommandTpl: "ffmpeg -crf 23", TargetVMAF: &TargetVMAF{VMAF: 93, MaxCRF: 51}},
+				},
+			},
+			wantReasons: []string{
+				"Scheme a TargetVMAF: invalid CRF range 30..20",
+				"Scheme b TargetVMAF: %CRF% placeholder missing in CommandTpl",
+			},
+		},
+		"Negative wrong InputOptions": {
+			given: PlanConfig{
+				OutDir:       ".",
+				Inputs:       []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes:      []Scheme{{}},
+				InputOptions: []InputOptions{{Input: "*.yuv", Size: "1920x1080 -y"}},
+			},
+			wantReasons: []string{
+				`InputOptions: invalid option value "1920x1080 -y"`,
+			},
+		},
+		"Negative wrong VMAFOptions": {
+			given: PlanConfig{
+				OutDir:      ".",
+				Inputs:      []string{"../../testdata/video/testsrc01.mp4"},
+				Schemes:     []Scheme{{}},
+				VMAFOptions: &vqm.LibvmafOptions{Pool: "max"},
+			},
+			wantReasons: []string{
+				`VMAFOptions: invalid pool "max"`,
+			},
+		},
 		"Negative wrong file in Inputs": {
 			given: PlanConfig{
 				OutDir:  ".",
@@ -226,3 +512,202 @@ func TestHasDuplicatesTable(t *testing.T) {
 		})
 	}
 }
+
+func TestPlanConfigProbeInputs_Negative(t *testing.T) {
+	pc := PlanConfig{
+		OutDir:  ".",
+		Inputs:  []string{"../../testdata/encoding_artifacts/report.json"},
+		Schemes: []Scheme{{}},
+	}
+
+	err := pc.ProbeInputs()
+	if err == nil {
+		t.Fatal("Expected error for non-video input, but got <nil>")
+	}
+	gotErr, ok := err.(*PlanConfigError)
+	if !ok {
+		t.Fatalf("Unexpected error type, want PlanConfigError, got %T", err)
+	}
+	if diff := cmp.Diff(1, len(gotErr.Reasons())); diff != "" {
+		t.Errorf("PlanConfigError reasons count mismatch (-want +got):\n%s", diff)
+	}
+	if !strings.Contains(gotErr.Reasons()[0], "report.json") {
+		t.Errorf("Reason should mention input file, got: %s", gotErr.Reasons()[0])
+	}
+}
+
+func TestPlanConfigVMAFModelFor(t *testing.T) {
+	pc := PlanConfig{
+		VMAFModels: []VMAFModelRule{
+			{Input: "anime_*", Model: "anime.json"},
+			{Input: "videos/film/*", Model: "film.json"},
+			{Input: "*", Model: "catch_all.json"},
+		},
+	}
+	tests := map[string]struct {
+		given string
+		want  string
+	}{
+		"Match by base name":       {given: "videos/anime_01.mp4", want: "anime.json"},
+		"Match by path":            {given: "videos/film/clip.mp4", want: "film.json"},
+		"Fallback to catch all":    {given: "other/clip.mp4", want: "catch_all.json"},
+		"First matching rule wins": {given: "videos/film/anime_02.mp4", want: "anime.json"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := pc.VMAFModelFor(tc.given, "default.json")
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Model mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("Default model when no rules", func(t *testing.T) {
+		var empty PlanConfig
+		if diff := cmp.Diff("default.json", empty.VMAFModelFor("clip.mp4", "default.json")); diff != "" {
+			t.Errorf("Model mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestPlanConfigInputArgsFor(t *testing.T) {
+	pc := PlanConfig{
+		InputOptions: []InputOptions{
+			{Input: "*.yuv", Format: "rawvideo", Size: "1920x1080", PixFmt: "yuv420p"},
+			{Input: "", FrameRate: "25"},
+		},
+	}
+	tests := map[string]struct {
+		given string
+		want  string
+	}{
+		"Match by base name":  {given: "videos/clip.yuv", want: "-f rawvideo -video_size 1920x1080 -pix_fmt yuv420p"},
+		"Empty pattern match": {given: "videos/clip.y4m", want: "-framerate 25"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := pc.InputArgsFor(tc.given)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Args mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("No args when no rules", func(t *testing.T) {
+		var empty PlanConfig
+		if diff := cmp.Diff("", empty.InputArgsFor("clip.yuv")); diff != "" {
+			t.Errorf("Args mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestPlanConfigResolvePaths(t *testing.T) {
+	given := PlanConfig{
+		OutDir: "out",
+		Inputs: []string{"videos/clip01.mp4", "/abs/clip02.mp4", "https://example.com/clip03.mp4"},
+		VMAFModels: []VMAFModelRule{
+			{Input: "videos/film/*", Model: "models/film.json"},
+			{Input: "*_phone.mp4", Model: "phone"},
+			{Input: "/abs/*", Model: "/models/abs.json"},
+		},
+		InputOptions: []InputOptions{
+			{Input: "raw/*.yuv", Format: "rawvideo"},
+			{Input: "*.y4m"},
+			{},
+		},
+	}
+	want := PlanConfig{
+		OutDir: "/plans/out",
+		Inputs: []string{"/plans/videos/clip01.mp4", "/abs/clip02.mp4", "https://example.com/clip03.mp4"},
+		VMAFModels: []VMAFModelRule{
+			{Input: "/plans/videos/film/*", Model: "/plans/models/film.json"},
+			{Input: "*_phone.mp4", Model: "phone"},
+			{Input: "/abs/*", Model: "/models/abs.json"},
+		},
+		InputOptions: []InputOptions{
+			{Input: "/plans/raw/*.yuv", Format: "rawvideo"},
+			{Input: "*.y4m"},
+			{},
+		},
+	}
+
+	given.ResolvePaths("/plans")
+
+	if diff := cmp.Diff(want, given); diff != "" {
+		t.Errorf("PlanConfig.ResolvePaths() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlanConfigResolvePathsPatternMatching(t *testing.T) {
+	pc := PlanConfig{
+		Inputs: []string{"videos/film/clip01.mp4"},
+		VMAFModels: []VMAFModelRule{
+			{Input: "videos/film/*", Model: "film.json"},
+		},
+		InputOptions: []InputOptions{
+			{Input: "videos/film/*", Format: "rawvideo"},
+		},
+	}
+	// Meta characters in base directory must not affect matching.
+	baseDir := "/plans/[x]"
+
+	pc.ResolvePaths(baseDir)
+
+	if diff := cmp.Diff(filepath.Join(baseDir, "film.json"), pc.VMAFModelFor(pc.Inputs[0], "default.json")); diff != "" {
+		t.Errorf("PlanConfig.VMAFModelFor() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("-f rawvideo", pc.InputArgsFor(pc.Inputs[0])); diff != "" {
+		t.Errorf("PlanConfig.InputArgsFor() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePlanConfigs(t *testing.T) {
+	inputs := PlanConfig{
+		OutDir:   "out",
+		Inputs:   []string{"clip01.mp4"},
+		LogLevel: "error",
+	}
+	library := PlanConfig{
+		OutDir:  "other",
+		Inputs:  []string{"clip02.mp4"},
+		Schemes: []Scheme{{Name: "sc1"}, {Name: "sc2"}},
+		Nice:    10,
+	}
+	want := PlanConfig{
+		OutDir:   "out",
+		Inputs:   []string{"clip01.mp4", "clip02.mp4"},
+		Schemes:  []Scheme{{Name: "sc1"}, {Name: "sc2"}},
+		LogLevel: "error",
+		Nice:     10,
+	}
+
+	got, err := MergePlanConfigs(inputs, library)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("MergePlanConfigs() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePlanConfigs_DuplicateSchemes(t *testing.T) {
+	a := PlanConfig{Schemes: []Scheme{{Name: "sc1"}}}
+	b := PlanConfig{Schemes: []Scheme{{Name: "sc2"}, {Name: "sc1"}}}
+
+	_, err := MergePlanConfigs(a, b)
+	if err == nil || !strings.Contains(err.Error(), `scheme "sc1"`) {
+		t.Errorf("Expected duplicate scheme error, got: %v", err)
+	}
+}
+
+func TestPlanConfig_MarshalJSON_OmitsDefaults(t *testing.T) {
+	given := PlanConfig{OutDir: "out", Inputs: []string{"a.mp4"}}
+	got, err := json.Marshal(given)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `{"OutDir":"out","Inputs":["a.mp4"],"Schemes":null}`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshalled PlanConfig mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -7,13 +7,20 @@
 package encoding
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/evolution-gaming/ease/internal/lw"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -23,8 +30,8 @@ func TestCreatePlanFromConfig(t *testing.T) {
 		planConfig := PlanConfig{
 			Inputs: []string{"videos/clip01.mp4", "videos/clip02.mp4"},
 			Schemes: []Scheme{
-				{"x264 param1 x", "ffmpeg -i %INPUT% -param1 x -y %OUTPUT%.mp4"},
-				{"x264_param1_y", "ffmpeg -i %INPUT% -param1 y -y %OUTPUT%.mp4"},
+				{Name: "x264 param1 x", CommandTpl: "ffmpeg -i %INPUT% -param1 x -y %OUTPUT%.mp4"},
+				{Name: "x264_param1_y", CommandTpl: "ffmpeg -i %INPUT% -param1 y -y %OUTPUT%.mp4"},
 			},
 			OutDir: "out",
 		}
@@ -66,6 +73,30 @@ func TestCreatePlanFromConfig(t *testing.T) {
 	})
 }
 
+func TestCreatePlanFromConfigWithSchemeInputs(t *testing.T) {
+	planConfig := PlanConfig{
+		Inputs: []string{"videos/clip01.mp4", "videos/clip02.mp4"},
+		Schemes: []Scheme{
+			{Name: "sc1", CommandTpl: "cp %INPUT% %OUTPUT%.mp4"},
+			{Name: "sc2", CommandTpl: "cp %INPUT% %OUTPUT%.mp4", Inputs: []string{"videos/clip02.mp4"}},
+		},
+		OutDir: "out",
+	}
+	plan := NewPlan(planConfig)
+	var got []string
+	for _, c := range plan.Commands {
+		got = append(got, c.Cmd)
+	}
+	want := []string{
+		"cp videos/clip01.mp4 out/clip01_sc1.mp4",
+		"cp videos/clip02.mp4 out/clip02_sc1.mp4",
+		"cp videos/clip02.mp4 out/clip02_sc2.mp4",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Command mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func Test_HappyPathPlanExecution(t *testing.T) {
 	var plan Plan
 	var pc PlanConfig
@@ -78,12 +109,12 @@ func Test_HappyPathPlanExecution(t *testing.T) {
 		},
 		Schemes: []Scheme{
 			{
-				"libx264 scheme1",
-				`ffmpeg -i %INPUT% -an -c:v copy -y %OUTPUT%.mp4`,
+				Name:       "libx264 scheme1",
+				CommandTpl: `ffmpeg -i %INPUT% -an -c:v copy -y %OUTPUT%.mp4`,
 			},
 			{
-				"libx264 scheme2",
-				"ffmpeg -i %INPUT% -an -c:v copy -y %OUTPUT%.mkv",
+				Name:       "libx264 scheme2",
+				CommandTpl: "ffmpeg -i %INPUT% -an -c:v copy -y %OUTPUT%.mkv",
 			},
 		},
 		OutDir: outDir,
@@ -276,7 +307,7 @@ func TestNegativeEncodingPlanRunWitOutputOverflow(t *testing.T) {
 		Inputs: []string{"not_important"},
 		Schemes: []Scheme{
 			// Unix yes should be fast enough to generate output that overflows
-			{"large output", "../../testdata/helpers/stderr yes"},
+			{Name: "large output", CommandTpl: "../../testdata/helpers/stderr yes"},
 		},
 		OutDir: outDir,
 	}
@@ -305,9 +336,9 @@ func TestNegativeEncodingPlanResults(t *testing.T) {
 	planConfig := PlanConfig{
 		Inputs: []string{"../../testdata/video/testsrc01.mp4"},
 		Schemes: []Scheme{
-			{"failing", "ls some_gibberish %INPUT% %OUTPUT%"},
+			{Name: "failing", CommandTpl: "ls some_gibberish %INPUT% %OUTPUT%"},
 			// For the sake of completeness - have a successful run also
-			{"passing", "../../testdata/helpers/stderr cp -v %INPUT% %OUTPUT%.mp4"},
+			{Name: "passing", CommandTpl: "../../testdata/helpers/stderr cp -v %INPUT% %OUTPUT%.mp4"},
 		},
 		OutDir: outDir,
 	}
@@ -375,6 +406,22 @@ func TestSchemeUnmarshalJSON(t *testing.T) {
 			given: []byte(`{"Name": "name", "CommandTpl": ["aa", "bbb", " ccc ", "ddd"]}`),
 			want:  Scheme{Name: "name", CommandTpl: "aabbb ccc ddd"},
 		},
+		"With Remux": {
+			given: []byte(`{"Name": "name", "CommandTpl": ["a"], "Remux": ["mkv", "ts"]}`),
+			want:  Scheme{Name: "name", CommandTpl: "a", Remux: []string{"mkv", "ts"}},
+		},
+		"With AcceptExitCodes": {
+			given: []byte(`{"Name": "name", "CommandTpl": ["a"], "AcceptExitCodes": [1, 2]}`),
+			want:  Scheme{Name: "name", CommandTpl: "a", AcceptExitCodes: []int{1, 2}},
+		},
+		"With VMAFGeometry": {
+			given: []byte(`{"Name": "name", "CommandTpl": ["a"], "VMAFGeometry": {"Crop": "1920:800:0:140"}}`),
+			want:  Scheme{Name: "name", CommandTpl: "a", VMAFGeometry: &Geometry{Crop: "1920:800:0:140"}},
+		},
+		"With VMAFFeatures": {
+			given: []byte(`{"Name": "name", "CommandTpl": ["a"], "VMAFFeatures": ["psnr", "cambi"]}`),
+			want:  Scheme{Name: "name", CommandTpl: "a", VMAFFeatures: []string{"psnr", "cambi"}},
+		},
 	}
 
 	for name, tc := range tests {
@@ -390,3 +437,799 @@ func TestSchemeUnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestGeometryFilter(t *testing.T) {
+	tests := map[string]struct {
+		given *Geometry
+		want  string
+	}{
+		"Nil geometry": {
+			given: nil,
+			want:  "",
+		},
+		"Empty geometry": {
+			given: &Geometry{},
+			want:  "",
+		},
+		"Scale only": {
+			given: &Geometry{Scale: "1920:1080"},
+			want:  "scale=1920:1080",
+		},
+		"All transforms in order": {
+			given: &Geometry{Scale: "1920:1080", Pad: "1920:1080:0:140", Crop: "1920:800:0:140"},
+			want:  "crop=1920:800:0:140,pad=1920:1080:0:140,scale=1920:1080",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.given.Filter()); diff != "" {
+				t.Errorf("Geometry.Filter() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSchemeMarshalJSON(t *testing.T) {
+	given := Scheme{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% %OUTPUT%.mp4", Remux: []string{"mkv"}, TargetBitrate: 2500}
+
+	b, err := json.Marshal(given)
+	if err != nil {
+		t.Fatalf("No error expected, got %v", err)
+	}
+	var got Scheme
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("No error expected, got %v", err)
+	}
+	if diff := cmp.Diff(given, got); diff != "" {
+		t.Errorf("Scheme JSON round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_newRateControl(t *testing.T) {
+	tests := map[string]struct {
+		target  float64
+		bitRate int
+		want    *RateControl
+	}{
+		"Overshoot": {
+			target: 2000, bitRate: 2200000,
+			want: &RateControl{TargetBitrate: 2000, Bitrate: 2200, Deviation: 200, DeviationPercent: 10},
+		},
+		"Undershoot": {
+			target: 2000, bitRate: 1500000,
+			want: &RateControl{TargetBitrate: 2000, Bitrate: 1500, Deviation: -500, DeviationPercent: -25},
+		},
+		"No target":         {bitRate: 1500000},
+		"Bitrate not known": {target: 2000},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := newRateControl(tc.target, tc.bitRate)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("newRateControl() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_insertGlobalArgs(t *testing.T) {
+	tests := map[string]struct {
+		given  string
+		want   string
+		wantOk bool
+	}{
+		"Plain ffmpeg": {
+			given:  "ffmpeg -i %INPUT% -c:v libx264 %OUTPUT%.mp4",
+			want:   "ffmpeg -hwaccel cuda -i %INPUT% -c:v libx264 %OUTPUT%.mp4",
+			wantOk: true,
+		},
+		"ffmpeg with path": {
+			given:  "/usr/bin/ffmpeg -i %INPUT% %OUTPUT%.mp4",
+			want:   "/usr/bin/ffmpeg -hwaccel cuda -i %INPUT% %OUTPUT%.mp4",
+			wantOk: true,
+		},
+		"ffmpeg in pipe": {
+			given:  "cat %INPUT% | ffmpeg -i - %OUTPUT%.mp4",
+			want:   "cat %INPUT% | ffmpeg -hwaccel cuda -i - %OUTPUT%.mp4",
+			wantOk: true,
+		},
+		"Not ffmpeg": {
+			given:  "x264 --input %INPUT% -o %OUTPUT%.264",
+			want:   "x264 --input %INPUT% -o %OUTPUT%.264",
+			wantOk: false,
+		},
+		"ffmpeg as part of other word": {
+			given:  "myffmpeg -i %INPUT% %OUTPUT%.mp4",
+			want:   "myffmpeg -i %INPUT% %OUTPUT%.mp4",
+			wantOk: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, gotOk := insertGlobalArgs(tc.given, "-hwaccel cuda")
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Command mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantOk, gotOk); diff != "" {
+				t.Errorf("Ok mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_insertInputArgs(t *testing.T) {
+	tests := map[string]struct {
+		given  string
+		want   string
+		wantOk bool
+	}{
+		"Plain ffmpeg": {
+			given:  "ffmpeg -i %INPUT% -c:v libx264 %OUTPUT%.mp4",
+			want:   "ffmpeg -f rawvideo -video_size 1920x1080 -i %INPUT% -c:v libx264 %OUTPUT%.mp4",
+			wantOk: true,
+		},
+		"Two pass": {
+			given:  "ffmpeg -i %INPUT% -pass 1 -f null /dev/null && ffmpeg -i %INPUT% -pass 2 %OUTPUT%.mp4",
+			want:   "ffmpeg -f rawvideo -video_size 1920x1080 -i %INPUT% -pass 1 -f null /dev/null && ffmpeg -f rawvideo -video_size 1920x1080 -i %INPUT% -pass 2 %OUTPUT%.mp4",
+			wantOk: true,
+		},
+		"No input option": {
+			given:  "x264 --input %INPUT% -o %OUTPUT%.264",
+			want:   "x264 --input %INPUT% -o %OUTPUT%.264",
+			wantOk: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, gotOk := insertInputArgs(tc.given, "-f rawvideo -video_size 1920x1080")
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Command mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantOk, gotOk); diff != "" {
+				t.Errorf("Ok mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCreatePlanFromConfigWithInputOptions(t *testing.T) {
+	planConfig := PlanConfig{
+		Inputs: []string{"videos/clip01.yuv", "videos/clip02.mp4"},
+		Schemes: []Scheme{
+			{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% -y %OUTPUT%.mp4"},
+		},
+		OutDir: "out",
+		InputOptions: []InputOptions{
+			{Input: "*.yuv", Format: "rawvideo", Size: "1920x1080", PixFmt: "yuv420p", FrameRate: "25"},
+		},
+	}
+	plan := NewPlan(planConfig)
+
+	want := []string{
+		"ffmpeg -f rawvideo -video_size 1920x1080 -pix_fmt yuv420p -framerate 25 -i videos/clip01.yuv -y out/clip01_sc1.mp4",
+		"ffmpeg -i videos/clip02.mp4 -y out/clip02_sc1.mp4",
+	}
+	var got []string
+	for _, c := range plan.Commands {
+		got = append(got, c.Cmd)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCreatePlanFromConfigWithGlobalArgs(t *testing.T) {
+	planConfig := PlanConfig{
+		Inputs: []string{"videos/clip01.mp4"},
+		Schemes: []Scheme{
+			{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% -y %OUTPUT%.mp4"},
+		},
+		OutDir:     "out",
+		GlobalArgs: "-hwaccel cuda",
+	}
+	plan := NewPlan(planConfig)
+	want := "ffmpeg -hwaccel cuda -i videos/clip01.mp4 -y out/clip01_sc1.mp4"
+	if diff := cmp.Diff(want, plan.Commands[0].Cmd); diff != "" {
+		t.Errorf("Command mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCreatePlanFromConfigWithLogLevel(t *testing.T) {
+	planConfig := PlanConfig{
+		Inputs: []string{"videos/clip01.mp4"},
+		Schemes: []Scheme{
+			{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% -y %OUTPUT%.mp4"},
+		},
+		OutDir:           "out",
+		GlobalArgs:       "-hwaccel cuda",
+		LogLevel:         "verbose",
+		OutputBufferSize: 1024,
+	}
+	plan := NewPlan(planConfig)
+
+	t.Run("Should inject -loglevel global argument", func(t *testing.T) {
+		want := "ffmpeg -loglevel verbose -hwaccel cuda -i videos/clip01.mp4 -y out/clip01_sc1.mp4"
+		if diff := cmp.Diff(want, plan.Commands[0].Cmd); diff != "" {
+			t.Errorf("Command mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should set output buffer size", func(t *testing.T) {
+		if diff := cmp.Diff(uint(1024), plan.Commands[0].OutputBufferSize); diff != "" {
+			t.Errorf("OutputBufferSize mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestEncoderCmdRunOutputBufferSize(t *testing.T) {
+	outDir := t.TempDir()
+	given := EncoderCmd{
+		Name:             "overflow",
+		OutputFile:       outDir + "/overflow.out",
+		Cmd:              "printf '%0100d' 0 >&2",
+		OutputBufferSize: 10,
+	}
+	got := given.Run()
+
+	var overflow bool
+	for _, err := range got.Errors {
+		if errors.Is(err, lw.ErrLimitedWriterOverflow) {
+			overflow = true
+		}
+	}
+	if !overflow {
+		t.Errorf("Expected lw.ErrLimitedWriterOverflow for output exceeding OutputBufferSize, got: %v", got.Errors)
+	}
+}
+
+func TestEncoderCmdRunTruncateOutput(t *testing.T) {
+	outDir := t.TempDir()
+	given := EncoderCmd{
+		Name:             "truncate",
+		OutputFile:       outDir + "/truncate.out",
+		Cmd:              "printf '%0100d' 1 >&2",
+		OutputBufferSize: 10,
+		TruncateOutput:   true,
+	}
+	got := given.Run()
+
+	t.Run("Should not have exit code error", func(t *testing.T) {
+		if diff := cmp.Diff(0, got.ExitCode()); diff != "" {
+			t.Errorf("ExitCode mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should not have overflow error", func(t *testing.T) {
+		// Other errors are expected, since command does not create
+		// compressed file.
+		for _, err := range got.Errors {
+			if errors.Is(err, lw.ErrLimitedWriterOverflow) {
+				t.Errorf("Unexpected overflow error: %v", err)
+			}
+		}
+	})
+	t.Run("Should keep tail of output", func(t *testing.T) {
+		if diff := cmp.Diff("0000000001", got.Output()); diff != "" {
+			t.Errorf("Output mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should write full output to OutputFile", func(t *testing.T) {
+		b, err := os.ReadFile(given.OutputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(100, len(b)); diff != "" {
+			t.Errorf("OutputFile size mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestEncoderCmdRunOutputTail(t *testing.T) {
+	outDir := t.TempDir()
+	given := EncoderCmd{
+		Name:            "failing",
+		OutputFile:      outDir + "/failing.out",
+		Cmd:             "printf 'frame=1\\rframe=2\\nline1\\nline2\\nfatal error\\n' >&2; exit 1",
+		OutputTailLines: 2,
+	}
+	got := given.Run()
+
+	if diff := cmp.Diff([]string{"line2", "fatal error"}, got.OutputTail); diff != "" {
+		t.Errorf("OutputTail mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEncoderCmdRunFailOnOutput(t *testing.T) {
+	tests := map[string]struct {
+		givenPatterns []string
+		wantMatchErr  bool
+	}{
+		"No patterns":       {},
+		"Matching pattern":  {givenPatterns: []string{"foo", "non monotonically increasing dts"}, wantMatchErr: true},
+		"No matching lines": {givenPatterns: []string{"Past duration .* too large"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			outDir := t.TempDir()
+			given := EncoderCmd{
+				Name:         "warning",
+				OutputFile:   path.Join(outDir, "warning.out"),
+				Cmd:          "printf 'frame=1\\nApplication provided invalid, non monotonically increasing dts to muxer\\n' >&2",
+				FailOnOutput: tc.givenPatterns,
+			}
+			got := given.Run()
+			var gotMatchErr bool
+			for _, err := range got.Errors {
+				if strings.Contains(err.Error(), "output matches") {
+					gotMatchErr = true
+				}
+			}
+			if diff := cmp.Diff(tc.wantMatchErr, gotMatchErr); diff != "" {
+				t.Errorf("Output match error mismatch (-want +got):\n%s\nErrors: %v", diff, got.Errors)
+			}
+		})
+	}
+}
+
+func Test_matchOutput(t *testing.T) {
+	output := []byte("frame=1\rframe=2\n[mp4 @ 0x1] Past duration 0.999 too large\n")
+	tests := map[string]struct {
+		patterns []string
+		want     string
+	}{
+		"No patterns": {},
+		"Match":       {patterns: []string{"Past duration .* too large"}, want: `output matches "Past duration .* too large": [mp4 @ 0x1] Past duration 0.999 too large`},
+		"No match":    {patterns: []string{"dts"}},
+		"Invalid":     {patterns: []string{"("}, want: `invalid output pattern "(": error parsing regexp: missing closing ): ` + "`(`"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got string
+			if err := matchOutput(output, tc.patterns); err != nil {
+				got = err.Error()
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_lastLines(t *testing.T) {
+	tests := map[string]struct {
+		given string
+		n     uint
+		want  []string
+	}{
+		"Fewer lines than n": {given: "a\nb\n", n: 10, want: []string{"a", "b"}},
+		"More lines than n":  {given: "a\nb\nc\n", n: 2, want: []string{"b", "c"}},
+		"Carriage returns":   {given: "frame=1\rframe=2\rerror\n", n: 2, want: []string{"frame=2", "error"}},
+		"Blank lines":        {given: "a\n\n  \nb\n\n", n: 2, want: []string{"a", "b"}},
+		"Empty output":       {given: "", n: 2, want: nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := lastLines([]byte(tc.given), tc.n)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_largerThanSource(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, size int) string {
+		f := filepath.Join(dir, name)
+		if err := os.WriteFile(f, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	src := write("src.y4m", 100)
+	tests := map[string]struct {
+		compressed string
+		want       bool
+	}{
+		"Smaller":   {compressed: write("small.mp4", 10), want: false},
+		"Same size": {compressed: write("same.mp4", 100), want: false},
+		"Larger":    {compressed: write("large.mp4", 200), want: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := largerThanSource(tc.compressed, src)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("largerThanSource() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := largerThanSource(filepath.Join(dir, "missing.mp4"), src); err == nil {
+		t.Error("Expected error for missing compressed file")
+	}
+}
+
+func Test_generateOutputFileNameBase(t *testing.T) {
+	tests := map[string]struct {
+		input, postfix string
+		want           string
+	}{
+		"Plain":             {input: "src/clip01.mp4", postfix: "sc1", want: filepath.Join("out", "clip01_sc1")},
+		"Spaces":            {input: "src/my clip.mp4", postfix: "x264 fast", want: filepath.Join("out", "my_clip_x264_fast")},
+		"Invalid in scheme": {input: "clip01.mp4", postfix: "crf:23/hq", want: filepath.Join("out", "clip01_crf_23_hq")},
+		"Invalid in input":  {input: `src/a<b>|c?*".mp4`, postfix: "sc1", want: filepath.Join("out", "a_b__c____sc1")},
+		"Control chars":     {input: "clip\t01.mp4", postfix: "sc\n1", want: filepath.Join("out", "clip01_sc1")},
+		"URL":               {input: "https://example.com/mezz/clip01.mp4?sig=a%2Fb#t=10", postfix: "sc1", want: filepath.Join("out", "clip01_sc1")},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := generateOutputFileNameBase(tc.input, "out", tc.postfix)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEncodingPlanRunContextCanceled(t *testing.T) {
+	planConfig := PlanConfig{
+		Inputs: []string{"not_important"},
+		Schemes: []Scheme{
+			{Name: "sleep1", CommandTpl: "sleep 10"},
+			{Name: "sleep2", CommandTpl: "sleep 10"},
+		},
+		OutDir: t.TempDir(),
+	}
+	plan := NewPlan(planConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	gotResult, err := plan.RunContext(ctx)
+
+	t.Run("Should have error for canceled Run", func(t *testing.T) {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled error, got: %v", err)
+		}
+	})
+	t.Run("Should not start any commands", func(t *testing.T) {
+		if diff := cmp.Diff(0, len(gotResult.RunResults)); diff != "" {
+			t.Errorf("RunResults count mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestEncoderCmdRunContextTimeout(t *testing.T) {
+	outDir := t.TempDir()
+	cmd := EncoderCmd{
+		Name:           "sleep",
+		CompressedFile: outDir + "/sleep.mp4",
+		OutputFile:     outDir + "/sleep.out",
+		Cmd:            "sleep 10",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	got := cmd.RunContext(ctx)
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Command was not killed on context timeout, elapsed: %s", elapsed)
+	}
+	if len(got.Errors) == 0 {
+		t.Error("Expected errors for killed command, got none")
+	}
+}
+
+func TestCreatePlanFromConfigWithRemux(t *testing.T) {
+	// Remux commands should use configured ffmpeg.
+	ffmpeg := path.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(ffmpeg, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FFMPEG_EXE_PATH", ffmpeg)
+	planConfig := PlanConfig{
+		Inputs: []string{"videos/clip01.mp4"},
+		Schemes: []Scheme{
+			{
+				Name:       "sc1",
+				CommandTpl: "ffmpeg -i %INPUT% -y %OUTPUT%.mp4",
+				Remux:      []string{"mkv", ".ts", "mp4"},
+			},
+		},
+		OutDir: "out",
+	}
+	plan := NewPlan(planConfig)
+
+	var gotCommands, gotCompressed, gotRemuxOf []string
+	for _, c := range plan.Commands {
+		gotCommands = append(gotCommands, c.Cmd)
+		gotCompressed = append(gotCompressed, c.CompressedFile)
+		gotRemuxOf = append(gotRemuxOf, c.RemuxOf)
+	}
+
+	// Remux into same container as encoded file should be skipped.
+	wantCommands := []string{
+		"ffmpeg -i videos/clip01.mp4 -y out/clip01_sc1.mp4",
+		ffmpeg + " -i out/clip01_sc1.mp4 -map 0 -c copy -y out/clip01_sc1.mkv",
+		ffmpeg + " -i out/clip01_sc1.mp4 -map 0 -c copy -y out/clip01_sc1.ts",
+	}
+	wantCompressed := []string{"out/clip01_sc1.mp4", "out/clip01_sc1.mkv", "out/clip01_sc1.ts"}
+	wantRemuxOf := []string{"", "out/clip01_sc1.mp4", "out/clip01_sc1.mp4"}
+
+	if diff := cmp.Diff(wantCommands, gotCommands); diff != "" {
+		t.Errorf("Command mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantCompressed, gotCompressed); diff != "" {
+		t.Errorf("CompressedFile mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantRemuxOf, gotRemuxOf); diff != "" {
+		t.Errorf("RemuxOf mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEncodingPlanRunReuseExisting(t *testing.T) {
+	outDir := t.TempDir()
+	planConfig := PlanConfig{
+		Inputs: []string{"../../testdata/video/testsrc01.mp4"},
+		Schemes: []Scheme{
+			// Command would fail if executed.
+			{Name: "failing", CommandTpl: "false %INPUT% %OUTPUT%.mp4"},
+		},
+		OutDir: outDir,
+	}
+	plan := NewPlan(planConfig)
+	plan.ReuseExisting = true
+
+	// Pre-create compressed file.
+	src, err := os.ReadFile("../../testdata/video/testsrc01.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plan.Commands[0].CompressedFile, src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	gotResult, err := plan.Run()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !gotResult.RunResults[0].Reused {
+		t.Errorf("Expected RunResult to be marked as reused: %+v", gotResult.RunResults[0])
+	}
+	if diff := cmp.Diff(float64(1), gotResult.RunResults[0].VideoDuration); diff != "" {
+		t.Errorf("VideoDuration mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEncodingPlanRunMaxDuration(t *testing.T) {
+	planConfig := PlanConfig{
+		Inputs: []string{"not_important"},
+		Schemes: []Scheme{
+			{Name: "sleep1", CommandTpl: "sleep 0.2"},
+			{Name: "sleep2", CommandTpl: "sleep 0.2"},
+			{Name: "sleep3", CommandTpl: "sleep 0.2"},
+		},
+		OutDir: t.TempDir(),
+	}
+	plan := NewPlan(planConfig)
+	plan.MaxDuration = 100 * time.Millisecond
+
+	gotResult, err := plan.Run()
+
+	t.Run("Should have budget exceeded error", func(t *testing.T) {
+		if !errors.Is(err, ErrMaxDurationExceeded) {
+			t.Errorf("Expected ErrMaxDurationExceeded, got: %v", err)
+		}
+	})
+	t.Run("Should stop starting new commands", func(t *testing.T) {
+		if diff := cmp.Diff(1, len(gotResult.RunResults)); diff != "" {
+			t.Errorf("RunResults count mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestEncodingPlanRunWarmup(t *testing.T) {
+	outDir := t.TempDir()
+	counterFile := path.Join(outDir, "runs.txt")
+	planConfig := PlanConfig{
+		Inputs: []string{"not_important"},
+		Schemes: []Scheme{
+			{Name: "count", CommandTpl: "echo run >> " + counterFile},
+		},
+		OutDir: outDir,
+	}
+	plan := NewPlan(planConfig)
+	plan.Warmup = true
+
+	gotResult, _ := plan.Run()
+
+	t.Run("Should run command twice", func(t *testing.T) {
+		b, err := os.ReadFile(counterFile)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(2, strings.Count(string(b), "run")); diff != "" {
+			t.Errorf("Run count mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should report only measured run", func(t *testing.T) {
+		if diff := cmp.Diff(1, len(gotResult.RunResults)); diff != "" {
+			t.Errorf("RunResults count mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+// fakeExecutor is an Executor recording executed command lines.
+type fakeExecutor struct {
+	cmdLines []string
+	result   ExecResult
+	err      error
+}
+
+func (e *fakeExecutor) Execute(ctx context.Context, cmdLine string, stderr io.Writer) (ExecResult, error) {
+	e.cmdLines = append(e.cmdLines, cmdLine)
+	fmt.Fprintf(stderr, "fake run: %s", cmdLine)
+	return e.result, e.err
+}
+
+func TestLocalExecutorNice(t *testing.T) {
+	var stderr strings.Builder
+	_, err := LocalExecutor{Nice: 5}.Execute(context.Background(), "nice >&2", &stderr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("5", strings.TrimSpace(stderr.String())); diff != "" {
+		t.Errorf("Niceness mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLocalExecutorShell(t *testing.T) {
+	tests := map[string]struct {
+		shell   string
+		cmdLine string
+		want    string
+		wantErr bool
+	}{
+		"Default shell":         {cmdLine: "echo a >&2", want: "a"},
+		"Bash":                  {shell: ShellBash, cmdLine: `echo "${BASH_VERSION:+bash}" >&2`, want: "bash"},
+		"Direct":                {shell: ShellNone, cmdLine: "sh -c 'echo $0 >&2' direct", want: "direct"},
+		"Direct needs shell":    {shell: ShellNone, cmdLine: "echo a >&2", wantErr: true},
+		"Auto direct":           {shell: ShellAuto, cmdLine: "sh -c 'echo $0 >&2' direct", want: "direct"},
+		"Auto falls back to sh": {shell: ShellAuto, cmdLine: "echo a >&2", want: "a"},
+		"Unsupported shell":     {shell: "zsh", cmdLine: "true", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stderr strings.Builder
+			_, err := LocalExecutor{Shell: tc.shell}.Execute(context.Background(), tc.cmdLine, &stderr)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error mismatch: wantErr=%v, got %v", tc.wantErr, err)
+			}
+			if diff := cmp.Diff(tc.want, strings.TrimSpace(stderr.String())); diff != "" {
+				t.Errorf("Output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEncoderCmdRunWithExecutor(t *testing.T) {
+	outDir := t.TempDir()
+	executor := &fakeExecutor{
+		result: ExecResult{ExitCode: 3, Utime: time.Second, MaxRss: 2048, PeakRss: 4096},
+		err:    errors.New("remote failure"),
+	}
+	cmd := EncoderCmd{
+		Name:           "fake",
+		Cmd:            "encode something",
+		CompressedFile: path.Join(outDir, "fake.mp4"),
+		OutputFile:     path.Join(outDir, "fake.out"),
+		Executor:       executor,
+	}
+
+	got := cmd.Run()
+
+	t.Run("Should delegate to Executor", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"encode something"}, executor.cmdLines); diff != "" {
+			t.Errorf("Executed command lines mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should capture Executor output", func(t *testing.T) {
+		if diff := cmp.Diff("fake run: encode something", got.Output()); diff != "" {
+			t.Errorf("Output mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should report Executor error", func(t *testing.T) {
+		if len(got.Errors) == 0 || !strings.Contains(got.Errors[0].Error(), "remote failure") {
+			t.Errorf("Expected Executor error, got: %v", got.Errors)
+		}
+		if diff := cmp.Diff(3, got.ExitCode()); diff != "" {
+			t.Errorf("ExitCode() mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should report Executor resource usage", func(t *testing.T) {
+		want := []int64{int64(time.Second), 2048, 4096}
+		if diff := cmp.Diff(want, []int64{int64(got.Stats.Utime), got.Stats.MaxRss, got.Stats.PeakRss}); diff != "" {
+			t.Errorf("Usage stats mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestEncoderCmdRunAcceptExitCodes(t *testing.T) {
+	tests := map[string]struct {
+		givenAccept []int
+		wantExitErr bool
+		// Compressed file of accepted exit code is checked for integrity,
+		// it is not created here, so check fails.
+		wantIntegrityErr bool
+	}{
+		"Not accepted exit code": {
+			givenAccept: nil,
+			wantExitErr: true,
+		},
+		"Other accepted exit code": {
+			givenAccept: []int{1},
+			wantExitErr: true,
+		},
+		"Accepted exit code": {
+			givenAccept:      []int{3},
+			wantExitErr:      false,
+			wantIntegrityErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			outDir := t.TempDir()
+			cmd := EncoderCmd{
+				Name:            "exit3",
+				Cmd:             "exit 3",
+				CompressedFile:  path.Join(outDir, "exit3.mp4"),
+				OutputFile:      path.Join(outDir, "exit3.out"),
+				AcceptExitCodes: tc.givenAccept,
+			}
+			got := cmd.Run()
+			if diff := cmp.Diff(3, got.ExitCode()); diff != "" {
+				t.Errorf("ExitCode() mismatch (-want +got):\n%s", diff)
+			}
+			var gotExitErr, gotIntegrityErr bool
+			for _, err := range got.Errors {
+				if strings.Contains(err.Error(), "exit status 3") {
+					gotExitErr = true
+				}
+				if strings.Contains(err.Error(), "corrupt compressed file") {
+					gotIntegrityErr = true
+				}
+			}
+			if diff := cmp.Diff(tc.wantExitErr, gotExitErr); diff != "" {
+				t.Errorf("Exit error mismatch (-want +got):\n%s\nErrors: %v", diff, got.Errors)
+			}
+			if diff := cmp.Diff(tc.wantIntegrityErr, gotIntegrityErr); diff != "" {
+				t.Errorf("Integrity error mismatch (-want +got):\n%s\nErrors: %v", diff, got.Errors)
+			}
+		})
+	}
+}
+
+func TestRunResultNotStarted(t *testing.T) {
+	// RunResult of command that never started has no ExecResult.
+	var given RunResult
+
+	t.Run("ExitCode() should return -1", func(t *testing.T) {
+		if diff := cmp.Diff(-1, given.ExitCode()); diff != "" {
+			t.Errorf("ExitCode() mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("NewUsageStat() should handle nil ExecResult", func(t *testing.T) {
+		got := NewUsageStat(time.Second, given.exec)
+		if diff := cmp.Diff(time.Duration(0), got.Stime+got.Utime); diff != "" {
+			t.Errorf("CPU time mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Shell quoting of file paths substituted into command templates.
+
+package encoding
+
+import (
+	"regexp"
+	"strings"
+)
+
+// shellSafe matches strings that need no quoting in POSIX shell.
+var shellSafe = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+// shellQuote will quote s for POSIX shell, strings consisting only of safe
+// characters are returned as is, so that commands for ordinary paths stay
+// readable.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// replacePlaceholder will replace each placeholder occurrence in command
+// template with value quoted according to shell quoting context of that
+// occurrence: unquoted placeholder gets value single quoted (see shellQuote),
+// while inside single or double quotes value is escaped to be a literal part
+// of already quoted string. This keeps templates that quote placeholders
+// themselves (e.g. "%INPUT%") working.
+func replacePlaceholder(cmdTpl, placeholder, value string) string {
+	var b strings.Builder
+	// Current quote character, zero when not quoted.
+	var quote byte
+	for i := 0; i < len(cmdTpl); {
+		if strings.HasPrefix(cmdTpl[i:], placeholder) {
+			b.WriteString(quoteIn(quote, value))
+			i += len(placeholder)
+			continue
+		}
+		c := cmdTpl[i]
+		switch {
+		case c == '\\' && quote != '\'' && i+1 < len(cmdTpl):
+			// Escaped character, copy both.
+			b.WriteString(cmdTpl[i : i+2])
+			i += 2
+			continue
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote != 0 && c == quote:
+			quote = 0
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+// quoteIn will escape s for given shell quoting context.
+func quoteIn(quote byte, s string) string {
+	switch quote {
+	case '\'':
+		return strings.ReplaceAll(s, "'", `'\''`)
+	case '"':
+		return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(s)
+	}
+	return shellQuote(s)
+}
+
+// shellMeta are characters with special meaning to POSIX shell outside of
+// quotes (pipes, redirects, command lists, substitutions, globs etc.).
+const shellMeta = "|&;<>()$`*?[]{}~#!\n"
+
+// splitCommand will split command line into arguments the way POSIX shell
+// does for simple commands: words are separated by unquoted blanks, quotes are
+// removed and backslash escapes are resolved.
+//
+// needsShell is set when command line uses shell features beyond that (e.g.
+// pipes, redirects or variables) or is malformed, such command line can only
+// be run via shell.
+func splitCommand(cmdLine string) (args []string, needsShell bool) {
+	var word strings.Builder
+	// inWord distinguishes empty quoted word ('') from no word.
+	var inWord bool
+	// Current quote character, zero when not quoted.
+	var quote byte
+	for i := 0; i < len(cmdLine); i++ {
+		c := cmdLine[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(cmdLine) && strings.IndexByte("\\\"$`", cmdLine[i+1]) >= 0:
+				i++
+				word.WriteByte(cmdLine[i])
+			case c == '$' || c == '`':
+				return nil, true
+			default:
+				word.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\':
+			if i+1 == len(cmdLine) || cmdLine[i+1] == '\n' {
+				return nil, true
+			}
+			i++
+			word.WriteByte(cmdLine[i])
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case strings.IndexByte(shellMeta, c) >= 0:
+			return nil, true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, true
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	// Variable assignment in front of command (e.g. "FOO=bar cmd") needs
+	// shell too.
+	if len(args) == 0 || strings.Contains(args[0], "=") {
+		return nil, true
+	}
+	return args, false
+}
@@ -0,0 +1,155 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_shellQuote(t *testing.T) {
+	tests := map[string]struct {
+		given string
+		want  string
+	}{
+		"Safe path":        {given: "/videos/clip_01-a.mp4", want: "/videos/clip_01-a.mp4"},
+		"Spaces":           {given: "/my videos/clip 01.mp4", want: "'/my videos/clip 01.mp4'"},
+		"Single quote":     {given: "/videos/it's.mp4", want: `'/videos/it'\''s.mp4'`},
+		"Shell characters": {given: "/videos/$(rm -rf x);`a`&b.mp4", want: "'/videos/$(rm -rf x);`a`&b.mp4'"},
+		"Empty":            {given: "", want: "''"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, shellQuote(tc.given)); diff != "" {
+				t.Errorf("shellQuote() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_replacePlaceholder(t *testing.T) {
+	tests := map[string]struct {
+		givenTpl   string
+		givenValue string
+		want       string
+	}{
+		"Unquoted": {
+			givenTpl:   "ffmpeg -i %INPUT% out.mp4",
+			givenValue: "/my videos/a.mp4",
+			want:       "ffmpeg -i '/my videos/a.mp4' out.mp4",
+		},
+		"Unquoted safe": {
+			givenTpl:   "ffmpeg -i %INPUT% out.mp4",
+			givenValue: "/videos/a.mp4",
+			want:       "ffmpeg -i /videos/a.mp4 out.mp4",
+		},
+		"Double quoted": {
+			givenTpl:   `ffmpeg -i "%INPUT%" out.mp4`,
+			givenValue: `/my "videos"/$a.mp4`,
+			want:       `ffmpeg -i "/my \"videos\"/\$a.mp4" out.mp4`,
+		},
+		"Single quoted": {
+			givenTpl:   "ffmpeg -i '%INPUT%' out.mp4",
+			givenValue: "/my videos/it's.mp4",
+			want:       `ffmpeg -i '/my videos/it'\''s.mp4' out.mp4`,
+		},
+		"Mixed with escaped quote": {
+			givenTpl:   `echo \" %INPUT% "%INPUT%"`,
+			givenValue: "a b",
+			want:       `echo \" 'a b' "a b"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := replacePlaceholder(tc.givenTpl, inputPlaceholder, tc.givenValue)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("replacePlaceholder() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSchemeExpand_SpecialCharacterPaths(t *testing.T) {
+	baseDir := t.TempDir()
+	srcDir := path.Join(baseDir, "my videos")
+	outDir := path.Join(baseDir, "out $dir (1)")
+	for _, d := range []string{srcDir, outDir} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srcFile := path.Join(srcDir, "it's clip.mp4")
+	if err := os.WriteFile(srcFile, []byte("payload"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	templates := []string{
+		"cp %INPUT% %OUTPUT%.mp4",
+		`cp "%INPUT%" "%OUTPUT%.mp4"`,
+	}
+	for _, tpl := range templates {
+		t.Run(tpl, func(t *testing.T) {
+			s := Scheme{Name: "copy", CommandTpl: tpl}
+			cmds := s.Expand([]string{srcFile}, outDir, "", nil)
+			if len(cmds) != 1 {
+				t.Fatalf("Expected single command, got: %v", cmds)
+			}
+			out, err := exec.Command("sh", "-c", cmds[0].Cmd).CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command %q failed: %v: %s", cmds[0].Cmd, err, out)
+			}
+			got, err := os.ReadFile(cmds[0].CompressedFile)
+			if err != nil {
+				t.Fatalf("Compressed file not written: %v", err)
+			}
+			if diff := cmp.Diff("payload", string(got)); diff != "" {
+				t.Errorf("Compressed file content mismatch (-want +got):\n%s", diff)
+			}
+			os.Remove(cmds[0].CompressedFile)
+		})
+	}
+}
+
+func Test_splitCommand(t *testing.T) {
+	tests := map[string]struct {
+		given          string
+		want           []string
+		wantNeedsShell bool
+	}{
+		"Simple":           {given: "ffmpeg -i in.mp4  out.mp4", want: []string{"ffmpeg", "-i", "in.mp4", "out.mp4"}},
+		"Single quoted":    {given: `ffmpeg -i '/my videos/it'\''s.mp4'`, want: []string{"ffmpeg", "-i", "/my videos/it's.mp4"}},
+		"Double quoted":    {given: `ffmpeg -i "/my \"videos\"/\$a.mp4"`, want: []string{"ffmpeg", "-i", `/my "videos"/$a.mp4`}},
+		"Escaped space":    {given: `ffmpeg -i my\ video.mp4`, want: []string{"ffmpeg", "-i", "my video.mp4"}},
+		"Empty quoted":     {given: `x264 '' out.264`, want: []string{"x264", "", "out.264"}},
+		"Pipe":             {given: "ffmpeg -i in.mp4 -f yuv4mpegpipe - | x264 -o out.264 -", wantNeedsShell: true},
+		"Redirect":         {given: "ffmpeg -i in.mp4 out.mp4 2>/dev/null", wantNeedsShell: true},
+		"Command list":     {given: "ffmpeg -i in.mp4 out.mp4; echo done", wantNeedsShell: true},
+		"Variable":         {given: "ffmpeg -i $IN out.mp4", wantNeedsShell: true},
+		"Quoted variable":  {given: `ffmpeg -i "$IN" out.mp4`, wantNeedsShell: true},
+		"Assignment":       {given: "FFREPORT=file=x.log ffmpeg -i in.mp4 out.mp4", wantNeedsShell: true},
+		"Unterminated":     {given: "ffmpeg -i 'in.mp4", wantNeedsShell: true},
+		"Empty":            {given: "  ", wantNeedsShell: true},
+		"Option with =":    {given: "x264 --preset=slow -o out.264 in.y4m", want: []string{"x264", "--preset=slow", "-o", "out.264", "in.y4m"}},
+		"Quoted meta char": {given: `ffmpeg -vf 'scale=1280:-2,fps=30' out.mp4`, want: []string{"ffmpeg", "-vf", "scale=1280:-2,fps=30", "out.mp4"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, needsShell := splitCommand(tc.given)
+			if diff := cmp.Diff(tc.wantNeedsShell, needsShell); diff != "" {
+				t.Errorf("needsShell mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("splitCommand() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+)
+
+const (
+	// crfPlaceholder in command template of target VMAF scheme is replaced
+	// with searched CRF value.
+	crfPlaceholder = "%CRF%"
+	// defaultMaxIterations is enough for binary search over 0..255 range.
+	defaultMaxIterations = 8
+)
+
+// TargetVMAF configures search of encoder setting achieving target VMAF
+// instead of encoding with fixed setting.
+//
+// Setting is given in scheme's command template via %CRF% placeholder and is
+// searched via binary search in MinCRF..MaxCRF range (lower value means
+// higher quality), highest value with VMAF mean at or above target wins e.g.
+// smallest file meeting target. Each search step is a full encode followed by
+// VMAF measurement.
+type TargetVMAF struct {
+	// VMAF is target VMAF mean
+	VMAF float64
+	// MinCRF and MaxCRF are bounds of searched range
+	MinCRF int
+	MaxCRF int
+	// MaxBitrate is bitrate budget in kbit/s, 0 means no budget
+	MaxBitrate float64 `json:",omitempty"`
+	// MaxIterations limits number of search encodes, 0 means default
+	MaxIterations int `json:",omitempty"`
+}
+
+// validate checks that target VMAF parameters are sane.
+func (t *TargetVMAF) validate() error {
+	if t == nil {
+		return nil
+	}
+	if t.VMAF <= 0 || t.VMAF > 100 {
+		return fmt.Errorf("VMAF out of range 0..100: %g", t.VMAF)
+	}
+	if t.MinCRF < 0 || t.MinCRF > t.MaxCRF {
+		return fmt.Errorf("invalid CRF range %d..%d", t.MinCRF, t.MaxCRF)
+	}
+	if t.MaxBitrate < 0 {
+		return fmt.Errorf("negative MaxBitrate: %g", t.MaxBitrate)
+	}
+	if t.MaxIterations < 0 {
+		return fmt.Errorf("negative MaxIterations: %d", t.MaxIterations)
+	}
+	return nil
+}
+
+// TargetSearch is a result of target VMAF search.
+type TargetSearch struct {
+	// Target is target VMAF mean
+	Target float64
+	// CRF and VMAF are final setting and it's VMAF mean
+	CRF  int
+	VMAF float64
+	// Bitrate of final encode in kbit/s
+	Bitrate float64
+	// TargetMet is set when final VMAF is at or above target
+	TargetMet bool
+	// OverBudget is set when final bitrate exceeds MaxBitrate
+	OverBudget bool `json:",omitempty"`
+	// Steps are search encodes in order
+	Steps []SearchStep
+}
+
+// SearchStep is a single target VMAF search encode.
+type SearchStep struct {
+	CRF  int
+	VMAF float64
+}
+
+// VMAFFunc measures VMAF mean of encoding run's compressed file.
+type VMAFFunc func(ctx context.Context, r *RunResult) (float64, error)
+
+// errNoVMAFFunc is returned for target VMAF search without VMAF measurement.
+var errNoVMAFFunc = errors.New("target VMAF search requires VMAF measurement")
+
+// searchCRF will binary search for highest CRF in t.MinCRF..t.MaxCRF range
+// where eval returns VMAF at or above target. In case target is not reached
+// t.MinCRF (highest quality) is returned.
+func searchCRF(t TargetVMAF, eval func(crf int) (float64, error)) (crf int, met bool, steps []SearchStep, err error) {
+	maxIter := t.MaxIterations
+	if maxIter == 0 {
+		maxIter = defaultMaxIterations
+	}
+	crf = t.MinCRF
+	lo, hi := t.MinCRF, t.MaxCRF
+	for lo <= hi && len(steps) < maxIter {
+		mid := (lo + hi) / 2
+		vmaf, err := eval(mid)
+		if err != nil {
+			return crf, met, steps, err
+		}
+		steps = append(steps, SearchStep{CRF: mid, VMAF: vmaf})
+		if vmaf >= t.VMAF {
+			crf, met = mid, true
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+	return crf, met, steps, nil
+}
+
+// withCRF returns copy of encoder command with CRF placeholder replaced by
+// given value.
+func (s *EncoderCmd) withCRF(crf int) EncoderCmd {
+	c := *s
+	c.Cmd = strings.ReplaceAll(c.Cmd, crfPlaceholder, strconv.Itoa(crf))
+	return c
+}
+
+// runTarget will search for CRF achieving target VMAF, each step encodes
+// and measures VMAF via measure. Resulting RunResult is of final encode with
+// search result attached.
+func (s *EncoderCmd) runTarget(ctx context.Context, measure VMAFFunc) RunResult {
+	if measure == nil {
+		r := RunResult{EncoderCmd: *s}
+		r.AddError(errNoVMAFFunc)
+		return r
+	}
+
+	var last RunResult
+	lastCRF := -1
+	eval := func(crf int) (float64, error) {
+		logging.Infof("Target VMAF search for %s: encoding with CRF %d", s.CompressedFile, crf)
+		cmd := s.withCRF(crf)
+		last, lastCRF = cmd.RunContext(ctx), crf
+		if len(last.Errors) != 0 {
+			return 0, fmt.Errorf("encoding with CRF %d failed", crf)
+		}
+		return measure(ctx, &last)
+	}
+	crf, met, steps, err := searchCRF(*s.TargetVMAF, eval)
+	if err != nil {
+		if len(last.Errors) == 0 {
+			last.AddError(fmt.Errorf("target VMAF search: %w", err))
+		}
+		return last
+	}
+
+	search := &TargetSearch{Target: s.TargetVMAF.VMAF, CRF: crf, TargetMet: met, Steps: steps}
+	vmaf, measured := stepVMAF(steps, crf)
+	// Compressed file is of the last search step, re-encode with final CRF.
+	if lastCRF != crf {
+		cmd := s.withCRF(crf)
+		last = cmd.RunContext(ctx)
+		if len(last.Errors) != 0 {
+			last.TargetSearch = search
+			return last
+		}
+	}
+	if !measured {
+		if vmaf, err = measure(ctx, &last); err != nil {
+			last.AddError(fmt.Errorf("target VMAF search: %w", err))
+		}
+	}
+	search.VMAF = vmaf
+	if fi, err := os.Stat(last.CompressedFile); err == nil && last.VideoDuration > 0 {
+		search.Bitrate = float64(fi.Size()*8) / last.VideoDuration / 1000
+	}
+	if max := s.TargetVMAF.MaxBitrate; max > 0 && search.Bitrate > max {
+		search.OverBudget = true
+		logging.Infof("Target VMAF search for %s: bitrate %.0f kbit/s at CRF %d exceeds budget of %.0f kbit/s",
+			s.CompressedFile, search.Bitrate, crf, max)
+	}
+	if !met {
+		logging.Infof("Target VMAF search for %s: target %.2f not reached, best VMAF %.2f at CRF %d",
+			s.CompressedFile, search.Target, vmaf, crf)
+	}
+	last.TargetSearch = search
+	return last
+}
+
+// stepVMAF returns VMAF measured for given CRF during search, if any.
+func stepVMAF(steps []SearchStep, crf int) (float64, bool) {
+	for _, v := range steps {
+		if v.CRF == crf {
+			return v.VMAF, true
+		}
+	}
+	return 0, false
+}
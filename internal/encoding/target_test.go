@@ -0,0 +1,110 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// linearVMAF is a fake VMAF model decreasing by one per CRF step.
+func linearVMAF(crf int) (float64, error) {
+	return 100 - float64(crf), nil
+}
+
+func Test_searchCRF(t *testing.T) {
+	tests := map[string]struct {
+		given     TargetVMAF
+		wantCRF   int
+		wantMet   bool
+		wantSteps []SearchStep
+	}{
+		"Target reached": {
+			given:   TargetVMAF{VMAF: 75.5, MinCRF: 0, MaxCRF: 51},
+			wantCRF: 24,
+			wantMet: true,
+			wantSteps: []SearchStep{
+				{CRF: 25, VMAF: 75},
+				{CRF: 12, VMAF: 88},
+				{CRF: 18, VMAF: 82},
+				{CRF: 21, VMAF: 79},
+				{CRF: 23, VMAF: 77},
+				{CRF: 24, VMAF: 76},
+			},
+		},
+		"Target not reachable": {
+			given:   TargetVMAF{VMAF: 95, MinCRF: 10, MaxCRF: 20},
+			wantCRF: 10,
+			wantMet: false,
+			wantSteps: []SearchStep{
+				{CRF: 15, VMAF: 85},
+				{CRF: 12, VMAF: 88},
+				{CRF: 10, VMAF: 90},
+			},
+		},
+		"Limited iterations": {
+			given:   TargetVMAF{VMAF: 75.5, MinCRF: 0, MaxCRF: 51, MaxIterations: 2},
+			wantCRF: 12,
+			wantMet: true,
+			wantSteps: []SearchStep{
+				{CRF: 25, VMAF: 75},
+				{CRF: 12, VMAF: 88},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotCRF, gotMet, gotSteps, err := searchCRF(tc.given, linearVMAF)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantCRF, gotCRF); diff != "" {
+				t.Errorf("CRF mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantMet, gotMet); diff != "" {
+				t.Errorf("TargetMet mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantSteps, gotSteps); diff != "" {
+				t.Errorf("Steps mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_searchCRF_Error(t *testing.T) {
+	wantErr := errors.New("measurement failed")
+	_, _, steps, err := searchCRF(TargetVMAF{VMAF: 90, MaxCRF: 51}, func(crf int) (float64, error) {
+		return 0, wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Errorf("Expected measurement error, got: %v", err)
+	}
+	if len(steps) != 0 {
+		t.Errorf("Expected no steps, got: %v", steps)
+	}
+}
+
+func TestEncoderCmd_withCRF(t *testing.T) {
+	given := EncoderCmd{Cmd: "ffmpeg -i in.mp4 -crf %CRF% out.mp4"}
+	got := given.withCRF(23)
+	if diff := cmp.Diff("ffmpeg -i in.mp4 -crf 23 out.mp4", got.Cmd); diff != "" {
+		t.Errorf("Cmd mismatch (-want +got):\n%s", diff)
+	}
+	if given.Cmd == got.Cmd {
+		t.Error("Original EncoderCmd should not be modified")
+	}
+}
+
+func TestEncoderCmdRunTargetWithoutMeasure(t *testing.T) {
+	given := EncoderCmd{Cmd: "true %CRF%", TargetVMAF: &TargetVMAF{VMAF: 90, MaxCRF: 51}}
+	got := given.runTarget(context.Background(), nil)
+	if len(got.Errors) != 1 || !errors.Is(got.Errors[0], errNoVMAFFunc) {
+		t.Errorf("Expected missing VMAF measurement error, got: %v", got.Errors)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package encoding
+
+import "syscall"
+
+// maxRssKB returns rusage max RSS in KB, on macOS it is reported in bytes.
+func maxRssKB(rusage *syscall.Rusage) int64 {
+	return rusage.Maxrss / 1024
+}
@@ -0,0 +1,14 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin
+
+package encoding
+
+import "syscall"
+
+// maxRssKB returns rusage max RSS in KB, on Linux it is reported in KB.
+func maxRssKB(rusage *syscall.Rusage) int64 {
+	return rusage.Maxrss
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
 )
 
 var (
@@ -32,6 +33,11 @@ func EnableInfoLogger() {
 	InfoLogger.SetOutput(defaultOutput)
 }
 
+// DisableInfoLogger helper function to explicitly disable InfoLogger.
+func DisableInfoLogger() {
+	InfoLogger.SetOutput(io.Discard)
+}
+
 // EnableDebugLogger helper function to explicitly enable DebugLogger.
 func EnableDebugLogger() {
 	DebugLogger.SetOutput(defaultOutput)
@@ -52,3 +58,48 @@ func Debug(v ...interface{}) {
 func Debugf(format string, v ...interface{}) {
 	DebugLogger.Output(calldepth, fmt.Sprintf(format, v...))
 }
+
+// Logger logs via InfoLogger and DebugLogger with fields prefixed to each
+// message, e.g. to attribute output of concurrent workers. Zero value logs
+// messages as is.
+type Logger struct {
+	fields []string
+}
+
+// WithField returns Logger prefixing messages with given field, e.g.
+// WithField("worker", 2) prefixes messages with "[worker=2] ".
+func WithField(key string, value interface{}) Logger {
+	return Logger{}.WithField(key, value)
+}
+
+// WithField returns copy of l with given field added.
+func (l Logger) WithField(key string, value interface{}) Logger {
+	fields := make([]string, len(l.fields), len(l.fields)+1)
+	copy(fields, l.fields)
+	l.fields = append(fields, fmt.Sprintf("%s=%v", key, value))
+	return l
+}
+
+// prefix returns fields formatted as message prefix.
+func (l Logger) prefix() string {
+	if len(l.fields) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(l.fields, " ") + "] "
+}
+
+func (l Logger) Info(v ...interface{}) {
+	InfoLogger.Output(calldepth, l.prefix()+fmt.Sprint(v...))
+}
+
+func (l Logger) Infof(format string, v ...interface{}) {
+	InfoLogger.Output(calldepth, l.prefix()+fmt.Sprintf(format, v...))
+}
+
+func (l Logger) Debug(v ...interface{}) {
+	DebugLogger.Output(calldepth, l.prefix()+fmt.Sprint(v...))
+}
+
+func (l Logger) Debugf(format string, v ...interface{}) {
+	DebugLogger.Output(calldepth, l.prefix()+fmt.Sprintf(format, v...))
+}
@@ -116,3 +116,46 @@ func Test_EnableDebugLogger(t *testing.T) {
 		}
 	})
 }
+
+func TestLoggerWithField(t *testing.T) {
+	worker := WithField("worker", 2)
+	tests := map[string]struct {
+		logger Logger
+		want   *regexp.Regexp
+	}{
+		"No fields": {
+			logger: Logger{},
+			want:   regexp.MustCompile(`INFO: .*\d message\n$`),
+		},
+		"Single field": {
+			logger: worker,
+			want:   regexp.MustCompile(`INFO: .*\[worker=2\] message`),
+		},
+		"Multiple fields": {
+			logger: worker.WithField("encode", "a.mp4"),
+			want:   regexp.MustCompile(`INFO: .*\[worker=2 encode=a\.mp4\] message`),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out strings.Builder
+			InfoLogger.SetOutput(&out)
+			tc.logger.Infof("%s", "message")
+			got := out.String()
+			if !tc.want.MatchString(got) {
+				t.Errorf("Log message not found (-want/+got)\n\t-%s\n\t+%s", tc.want.String(), got)
+			}
+		})
+	}
+
+	t.Run("Adding field should not change original logger", func(t *testing.T) {
+		a := worker.WithField("a", 1)
+		b := worker.WithField("b", 2)
+		if got := a.prefix(); got != "[worker=2 a=1] " {
+			t.Errorf("Unexpected prefix %q", got)
+		}
+		if got := b.prefix(); got != "[worker=2 b=2] " {
+			t.Errorf("Unexpected prefix %q", got)
+		}
+	})
+}
@@ -34,3 +34,41 @@ func (s *LimitedWriter) Write(b []byte) (int, error) {
 func LimitWriter(w io.Writer, n uint) io.Writer {
 	return &LimitedWriter{w, n}
 }
+
+// TailWriter is a ring buffer like io.Writer that never overflows, instead
+// only last N written bytes are kept.
+type TailWriter struct {
+	buf       []byte
+	truncated bool
+	// Limit value, number of last bytes to keep
+	N uint
+}
+
+// Write implements io.Writer for *TailWriter.
+func (s *TailWriter) Write(b []byte) (int, error) {
+	s.buf = append(s.buf, b...)
+	// Compact only once buffer holds twice the limit, to keep writes cheap.
+	if l := uint(len(s.buf)); l > 2*s.N {
+		n := copy(s.buf, s.buf[l-s.N:])
+		s.buf = s.buf[:n]
+		s.truncated = true
+	}
+	return len(b), nil
+}
+
+// Bytes returns last N (or less) written bytes.
+func (s *TailWriter) Bytes() []byte {
+	if l := uint(len(s.buf)); l > s.N {
+		return s.buf[l-s.N:]
+	}
+	return s.buf
+}
+
+// Truncated reports if any written bytes were discarded.
+func (s *TailWriter) Truncated() bool {
+	return s.truncated || uint(len(s.buf)) > s.N
+}
+
+func NewTailWriter(n uint) *TailWriter {
+	return &TailWriter{N: n}
+}
@@ -116,3 +116,36 @@ func TestLimitedWriterProp(t *testing.T) {
 			}
 		})
 }
+
+func TestTailWriterImplementsWriter(t *testing.T) {
+	var _ io.Writer = &lw.TailWriter{}
+}
+
+func TestTailWriterProp(t *testing.T) {
+	iterations := 1 * 1000
+	qCfg := &quick.Config{MaxCount: iterations}
+
+	t.Run(
+		"Should keep tail of written data and never fail",
+		func(t *testing.T) {
+			fn := func(b []byte, c uint8, size uint8) bool {
+				w := lw.NewTailWriter(uint(size))
+				var all []byte
+				for i := c; i > 0; i-- {
+					n, err := w.Write(b)
+					if err != nil || n != len(b) {
+						return false
+					}
+					all = append(all, b...)
+				}
+				want := all
+				if len(all) > int(size) {
+					want = all[len(all)-int(size):]
+				}
+				return bytes.Equal(want, w.Bytes()) && w.Truncated() == (len(all) > int(size))
+			}
+			if err := quick.Check(fn, qCfg); err != nil {
+				t.Error(err)
+			}
+		})
+}
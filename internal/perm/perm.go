@@ -0,0 +1,40 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Centralized permissions for output files and directories created by ease.
+// Modes are subject to process umask as usual.
+package perm
+
+import (
+	"os"
+)
+
+var (
+	// DirMode is used for created output directories.
+	DirMode os.FileMode = 0o775
+	// FileMode is used for created output files (same as os.Create).
+	FileMode os.FileMode = 0o666
+)
+
+// MkdirAll creates a directory along with any necessary parents using DirMode.
+func MkdirAll(path string) error {
+	return os.MkdirAll(path, DirMode)
+}
+
+// Create creates or truncates the named file using FileMode.
+func Create(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, FileMode)
+}
+
+// Append opens the named file for appending, creating it with FileMode if
+// necessary.
+func Append(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, FileMode)
+}
+
+// WriteFile writes data to the named file, creating it with FileMode if
+// necessary.
+func WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, FileMode)
+}
@@ -0,0 +1,93 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package perm
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestModes(t *testing.T) {
+	// Make sure umask does not interfere with checks.
+	oldMask := syscall.Umask(0)
+	defer syscall.Umask(oldMask)
+
+	oldDirMode, oldFileMode := DirMode, FileMode
+	defer func() { DirMode, FileMode = oldDirMode, oldFileMode }()
+	DirMode, FileMode = 0o750, 0o640
+
+	tmpDir := t.TempDir()
+	t.Run("MkdirAll should use DirMode", func(t *testing.T) {
+		dir := path.Join(tmpDir, "a", "b")
+		if err := MkdirAll(dir); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fi, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(os.FileMode(0o750), fi.Mode().Perm()); diff != "" {
+			t.Errorf("Directory mode mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Create should use FileMode", func(t *testing.T) {
+		f, err := Create(path.Join(tmpDir, "created"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(os.FileMode(0o640), fi.Mode().Perm()); diff != "" {
+			t.Errorf("File mode mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Append should use FileMode and append", func(t *testing.T) {
+		name := path.Join(tmpDir, "appended")
+		for _, data := range []string{"a", "b"} {
+			f, err := Append(name)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, err := f.WriteString(data); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			f.Close()
+		}
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff("ab", string(got)); diff != "" {
+			t.Errorf("File content mismatch (-want +got):\n%s", diff)
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(os.FileMode(0o640), fi.Mode().Perm()); diff != "" {
+			t.Errorf("File mode mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("WriteFile should use FileMode", func(t *testing.T) {
+		name := path.Join(tmpDir, "written")
+		if err := WriteFile(name, []byte("data")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(os.FileMode(0o640), fi.Mode().Perm()); diff != "" {
+			t.Errorf("File mode mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -7,11 +7,17 @@ package tools
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/evolution-gaming/ease/internal/logging"
 	"github.com/evolution-gaming/ease/internal/video"
@@ -34,6 +40,9 @@ var (
 	}
 )
 
+// ErrNoVideoStream is returned when media file does not contain a video stream.
+var ErrNoVideoStream = errors.New("no video stream")
+
 // FfmpegPath will return path to ffmpeg binary and error if path is not found.
 func FfmpegPath() (string, error) {
 	p, err := FindTool(ffmpegCmd, ffmpegEnvOverride)
@@ -52,21 +61,92 @@ func FfprobePath() (string, error) {
 	return p, nil
 }
 
+// ProbeOption is a functional option for FfprobeExtractMetadata.
+type ProbeOption func(*probeOptions)
+
+type probeOptions struct {
+	countFrames bool
+	// Number of ffprobe execution attempts
+	attempts int
+	// Delay before first retry, doubled for each next retry
+	backoff time.Duration
+	// ffprobe input-side arguments inserted right before video file
+	inputArgs []string
+}
+
+// Defaults for ffprobe execution retries. Right after encoder exits compressed
+// file might not be fully flushed yet, so transient failures are retried.
+const (
+	DefaultProbeAttempts = 3
+	defaultProbeBackoff  = 200 * time.Millisecond
+)
+
+var (
+	probeMu sync.Mutex
+	// probeAttempts is a number of ffprobe execution attempts unless set via
+	// WithRetries
+	probeAttempts = DefaultProbeAttempts
+)
+
+// SetProbeAttempts sets number of ffprobe execution attempts of metadata
+// probing (see FfprobeExtractMetadata) across the tool, n < 1 means default
+// number of attempts.
+//
+// It is meant to be called once on startup, e.g. to retry more on slow network
+// storage.
+func SetProbeAttempts(n int) {
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	if n < 1 {
+		n = DefaultProbeAttempts
+	}
+	probeAttempts = n
+}
+
+// WithFrameCounting will make ffprobe decode the whole video stream to count
+// frames exactly (-count_frames). This is slow, by default frame count is taken
+// from container or estimated from duration and frame rate.
+func WithFrameCounting() ProbeOption {
+	return func(o *probeOptions) {
+		o.countFrames = true
+	}
+}
+
+// WithInputArgs sets ffprobe input-side arguments (e.g. "-f", "rawvideo") for
+// inputs that can not be probed as is, like raw video.
+func WithInputArgs(args ...string) ProbeOption {
+	return func(o *probeOptions) {
+		o.inputArgs = args
+	}
+}
+
+// WithRetries sets number of ffprobe execution attempts and delay before
+// first retry (doubled for each next retry).
+func WithRetries(attempts int, backoff time.Duration) ProbeOption {
+	return func(o *probeOptions) {
+		o.attempts = attempts
+		o.backoff = backoff
+	}
+}
+
 // FfprobeExtractMetadata will query vide file metadata via ffprobe.
-func FfprobeExtractMetadata(videoFile string) (video.Metadata, error) {
+//
+// Failed ffprobe execution is retried with backoff (see WithRetries and
+// SetProbeAttempts).
+func FfprobeExtractMetadata(videoFile string, opts ...ProbeOption) (video.Metadata, error) {
 	var vmeta video.Metadata
-
-	type metadata struct {
-		CodecName string  `json:"codec_name,omitempty"`
-		FrameRate string  `json:"r_frame_rate,omitempty"`
-		Duration  float64 `json:"duration,omitempty,string"`
-		Width     int     `json:"width,omitempty"`
-		Height    int     `json:"height,omitempty"`
-		BitRate   int     `json:"bit_rate,omitempty,string"`
+	probeMu.Lock()
+	o := probeOptions{attempts: probeAttempts, backoff: defaultProbeBackoff}
+	probeMu.Unlock()
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	if _, err := os.Stat(videoFile); os.IsNotExist(err) {
-		return vmeta, fmt.Errorf("FfprobeExtractMetadata() os.Stat: %w", err)
+	// URLs are probed by ffprobe directly.
+	if !IsURL(videoFile) {
+		if _, err := os.Stat(videoFile); os.IsNotExist(err) {
+			return vmeta, fmt.Errorf("FfprobeExtractMetadata() os.Stat: %w", err)
+		}
 	}
 
 	ffprobeArgs := []string{
@@ -75,17 +155,74 @@ func FfprobeExtractMetadata(videoFile string) (video.Metadata, error) {
 		"-of", "json",
 		"-show_format",
 		"-show_streams",
-		videoFile,
 	}
+	if o.countFrames {
+		ffprobeArgs = append(ffprobeArgs, "-count_frames")
+	}
+	ffprobeArgs = append(ffprobeArgs, o.inputArgs...)
+	ffprobeArgs = append(ffprobeArgs, videoFile)
 	ffprobePath, err := FfprobePath()
 	if err != nil {
 		return vmeta, err
 	}
-	cmd := exec.Command(ffprobePath, ffprobeArgs...)
-	logging.Debugf("Running: %s\n", cmd)
-	out, err := cmd.Output()
+	var out []byte
+	backoff := o.backoff
+	for attempt := 1; ; attempt++ {
+		cmd := exec.Command(ffprobePath, ffprobeArgs...)
+		logging.Debugf("Running: %s\n", cmd)
+		release := AcquireProcess()
+		out, err = cmd.Output()
+		release()
+		if err == nil {
+			break
+		}
+		if attempt >= o.attempts {
+			return vmeta, fmt.Errorf("FfprobeExtractMetadata() exec error after %d attempt(s): %w", attempt, err)
+		}
+		logging.Debugf("ffprobe attempt %d for %s failed, retrying in %s: %s", attempt, videoFile, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	vmeta, err = parseFfprobeMetadata(out)
 	if err != nil {
-		return vmeta, fmt.Errorf("FfprobeExtractMetadata() exec error: %w", err)
+		return vmeta, fmt.Errorf("FfprobeExtractMetadata() %s: %w", videoFile, err)
+	}
+	return vmeta, nil
+}
+
+// parseFfprobeMetadata will parse ffprobe's -show_format -show_streams JSON
+// output into video.Metadata.
+//
+// Parsing is lenient: numeric fields can be missing or be non-numeric (e.g.
+// "N/A") and missing stream fields are looked up in format or derived from
+// other fields where possible.
+func parseFfprobeMetadata(data []byte) (video.Metadata, error) {
+	var vmeta video.Metadata
+
+	// All numeric values are strings in ffprobe JSON output.
+	type metadata struct {
+		CodecName    string `json:"codec_name"`
+		FrameRate    string `json:"r_frame_rate"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		Duration     string `json:"duration"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		BitRate      string `json:"bit_rate"`
+		NbFrames     string `json:"nb_frames"`
+		NbReadFrames string `json:"nb_read_frames"`
+		PixFmt       string `json:"pix_fmt"`
+		ColorRange   string `json:"color_range"`
+		ColorPrim    string `json:"color_primaries"`
+		ColorTrc     string `json:"color_transfer"`
+		// Rotation is in display matrix side data (newer ffmpeg) or in
+		// "rotate" tag (older ffmpeg)
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+		Tags struct {
+			Rotate string `json:"rotate"`
+		} `json:"tags"`
 	}
 
 	// Unmarshal metadata from both "streams" and "format" JSON objects.
@@ -94,17 +231,398 @@ func FfprobeExtractMetadata(videoFile string) (video.Metadata, error) {
 		Format  metadata
 	}{}
 
-	if err := json.Unmarshal(out, &meta); err != nil {
-		return vmeta, fmt.Errorf("FfprobeExtractMetadata() json.Unmarshal: %w", err)
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return vmeta, fmt.Errorf("json.Unmarshal: %w", err)
 	}
-	logging.Debugf("%s %+v", videoFile, meta)
-	vmeta = video.Metadata(meta.Streams[0])
+	logging.Debugf("%+v", meta)
+	if len(meta.Streams) == 0 {
+		return vmeta, ErrNoVideoStream
+	}
+	s := meta.Streams[0]
+
+	vmeta.CodecName = s.CodecName
+	vmeta.Width = s.Width
+	vmeta.Height = s.Height
+	// Real base frame rate might be unknown ("0/0"), fall back to average.
+	vmeta.FrameRate = s.FrameRate
+	if _, err := video.ParseFrameRate(s.FrameRate); err != nil || strings.HasPrefix(s.FrameRate, "0/") {
+		vmeta.FrameRate = s.AvgFrameRate
+	}
+	vmeta.AvgFrameRate = s.AvgFrameRate
+	vmeta.Color = video.Color{PixFmt: s.PixFmt, Range: s.ColorRange, Primaries: s.ColorPrim, Transfer: s.ColorTrc}
 	// For mkv container Streams does not contain duration, so we have to look into Format.
-	vmeta.Duration = math.Max(vmeta.Duration, meta.Format.Duration)
+	vmeta.Duration = math.Max(parseFloat(s.Duration), parseFloat(meta.Format.Duration))
+	vmeta.BitRate = int(parseFloat(s.BitRate))
+	if vmeta.BitRate == 0 {
+		vmeta.BitRate = int(parseFloat(meta.Format.BitRate))
+	}
+
+	// Display matrix rotation is counterclockwise, rotate tag is clockwise.
+	var rotation float64
+	for _, sd := range s.SideDataList {
+		if sd.Rotation != 0 {
+			rotation = -sd.Rotation
+		}
+	}
+	if rotation == 0 {
+		rotation = parseFloat(s.Tags.Rotate)
+	}
+	vmeta.Rotation = ((int(math.Round(rotation))%360 + 360) % 360)
+
+	// Prefer exactly counted frames, then container reported frame count.
+	// Some containers (e.g. mkv) do not report frame count, in that case
+	// estimate it from duration and frame rate.
+	vmeta.FrameCount = int(parseFloat(s.NbReadFrames))
+	if vmeta.FrameCount == 0 {
+		vmeta.FrameCount = int(parseFloat(s.NbFrames))
+	}
+	if vmeta.FrameCount == 0 {
+		rate := s.AvgFrameRate
+		if _, err := video.ParseFrameRate(rate); err != nil || strings.HasPrefix(rate, "0/") {
+			rate = vmeta.FrameRate
+		}
+		if fps, err := video.ParseFrameRate(rate); err == nil {
+			vmeta.FrameCount = int(math.Round(vmeta.Duration * fps))
+		}
+	}
 
 	return vmeta, nil
 }
 
+// parseFloat is a lenient float parser, unparsable values are treated as 0.
+func parseFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// FfmpegCheckIntegrity will decode whole video file via ffmpeg and report any
+// decoding errors.
+//
+// This is useful to detect truncated or otherwise corrupt files which still can
+// be probed via ffprobe.
+func FfmpegCheckIntegrity(videoFile string) error {
+	if _, err := os.Stat(videoFile); os.IsNotExist(err) {
+		return fmt.Errorf("FfmpegCheckIntegrity() os.Stat: %w", err)
+	}
+
+	ffmpegPath, err := FfmpegPath()
+	if err != nil {
+		return err
+	}
+	ffmpegArgs := []string{
+		"-v", "error",
+		"-i", videoFile,
+		"-f", "null",
+		"-",
+	}
+	cmd := exec.Command(ffmpegPath, ffmpegArgs...)
+	logging.Debugf("Running: %s\n", cmd)
+	release := AcquireProcess()
+	out, err := cmd.CombinedOutput()
+	release()
+	if err != nil {
+		return fmt.Errorf("FfmpegCheckIntegrity() decoding failed: %w: %s", err, out)
+	}
+	// With "-v error" any output means there were decoding errors.
+	if len(out) != 0 {
+		return fmt.Errorf("FfmpegCheckIntegrity() decoding errors: %s", out)
+	}
+
+	return nil
+}
+
+// FfmpegSceneCuts will detect scene changes in video file and return their
+// timestamps (in seconds).
+//
+// Detection is done via ffmpeg's scene change score, frames with score above
+// threshold (in range 0..1, typical value is 0.3-0.4) are scene cuts.
+func FfmpegSceneCuts(videoFile string, threshold float64) ([]float64, error) {
+	if !IsURL(videoFile) {
+		if _, err := os.Stat(videoFile); err != nil {
+			return nil, fmt.Errorf("FfmpegSceneCuts() os.Stat: %w", err)
+		}
+	}
+
+	ffmpegPath, err := FfmpegPath()
+	if err != nil {
+		return nil, err
+	}
+	ffmpegArgs := []string{
+		"-hide_banner",
+		"-i", videoFile,
+		"-an",
+		"-vf", fmt.Sprintf("select='gt(scene,%g)',showinfo", threshold),
+		"-f", "null",
+		"-",
+	}
+	cmd := exec.Command(ffmpegPath, ffmpegArgs...) //#nosec G204
+	logging.Debugf("Running: %s\n", cmd)
+	release := AcquireProcess()
+	out, err := cmd.CombinedOutput()
+	release()
+	if err != nil {
+		return nil, fmt.Errorf("FfmpegSceneCuts() exec: %w: %s", err, out)
+	}
+
+	return parseSceneCuts(out), nil
+}
+
+// showinfoPtsTime matches frame timestamp in showinfo filter output line.
+var showinfoPtsTime = regexp.MustCompile(`Parsed_showinfo.*\spts_time:\s*([0-9.]+)`)
+
+// parseSceneCuts extracts timestamps of frames reported by showinfo filter.
+func parseSceneCuts(output []byte) []float64 {
+	var cuts []float64
+	for _, m := range showinfoPtsTime.FindAllSubmatch(output, -1) {
+		if v, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+			cuts = append(cuts, v)
+		}
+	}
+	return cuts
+}
+
+// FfmpegSetMetadata will set container level metadata key to value in video
+// file.
+//
+// Video file is remuxed (stream copy) into temporary file which then replaces
+// original one. In case container does not support metadata original file is
+// left intact and error is returned.
+func FfmpegSetMetadata(videoFile, key, value string) error {
+	if _, err := os.Stat(videoFile); err != nil {
+		return fmt.Errorf("FfmpegSetMetadata() os.Stat: %w", err)
+	}
+
+	ffmpegPath, err := FfmpegPath()
+	if err != nil {
+		return err
+	}
+	ext := path.Ext(videoFile)
+	tmpFile := strings.TrimSuffix(videoFile, ext) + "_tagged" + ext
+	ffmpegArgs := []string{
+		"-v", "error",
+		"-i", videoFile,
+		"-map", "0",
+		"-c", "copy",
+		"-metadata", key + "=" + value,
+	}
+	// MP4 family muxers drop arbitrary metadata keys unless asked otherwise.
+	switch ext {
+	case ".mp4", ".mov", ".m4v":
+		ffmpegArgs = append(ffmpegArgs, "-movflags", "use_metadata_tags")
+	}
+	ffmpegArgs = append(ffmpegArgs, "-y", tmpFile)
+
+	cmd := exec.Command(ffmpegPath, ffmpegArgs...)
+	logging.Debugf("Running: %s\n", cmd)
+	release := AcquireProcess()
+	out, err := cmd.CombinedOutput()
+	release()
+	if err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("FfmpegSetMetadata() remux failed: %w: %s", err, out)
+	}
+	if err := os.Rename(tmpFile, videoFile); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("FfmpegSetMetadata() os.Rename: %w", err)
+	}
+
+	return nil
+}
+
+// Synthetic video sources of ffmpeg's lavfi virtual input device supported by
+// FfmpegGenerateSample.
+const (
+	SampleSourceTestsrc    = "testsrc"
+	SampleSourceTestsrc2   = "testsrc2"
+	SampleSourceMandelbrot = "mandelbrot"
+)
+
+// IsSampleSource reports whether s is a supported synthetic video source.
+func IsSampleSource(s string) bool {
+	switch s {
+	case SampleSourceTestsrc, SampleSourceTestsrc2, SampleSourceMandelbrot:
+		return true
+	}
+	return false
+}
+
+// SampleSpec describes synthetic sample video generated by
+// FfmpegGenerateSample.
+type SampleSpec struct {
+	// Source is synthetic video source (e.g. "testsrc")
+	Source string
+	// Size is frame size as WIDTHxHEIGHT (e.g. "1920x1080")
+	Size string
+	// FrameRate is frame rate, integer or rational (e.g. "25", "30000/1001")
+	FrameRate string
+	// Duration is video duration in seconds
+	Duration float64
+}
+
+var (
+	sampleSizeMatcher      = regexp.MustCompile(`^[1-9][0-9]*x[1-9][0-9]*$`)
+	sampleFrameRateMatcher = regexp.MustCompile(`^[1-9][0-9]*(/[1-9][0-9]*)?$`)
+)
+
+// validate checks that spec values are supported and are safe to be put into
+// ffmpeg filter graph.
+func (s *SampleSpec) validate() error {
+	if !IsSampleSource(s.Source) {
+		return fmt.Errorf("unsupported source %q", s.Source)
+	}
+	if !sampleSizeMatcher.MatchString(s.Size) {
+		return fmt.Errorf("invalid size %q, should be WIDTHxHEIGHT", s.Size)
+	}
+	if !sampleFrameRateMatcher.MatchString(s.FrameRate) {
+		return fmt.Errorf("invalid frame rate %q", s.FrameRate)
+	}
+	if s.Duration <= 0 {
+		return fmt.Errorf("invalid duration %g, should be positive", s.Duration)
+	}
+	return nil
+}
+
+// args returns ffmpeg arguments to generate sample into outFile.
+//
+// Sample is encoded losslessly (libx264 with zero QP) in yuv420p, so that it
+// is a pristine mezzanine for encoding experiments.
+func (s *SampleSpec) args(outFile string) []string {
+	return []string{
+		"-v", "error",
+		"-f", "lavfi",
+		"-i", fmt.Sprintf("%s=size=%s:rate=%s", s.Source, s.Size, s.FrameRate),
+		"-t", strconv.FormatFloat(s.Duration, 'f', -1, 64),
+		"-pix_fmt", "yuv420p",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-qp", "0",
+		"-y", outFile,
+	}
+}
+
+// FfmpegGenerateSample will generate synthetic sample video according to spec
+// into outFile via ffmpeg's lavfi virtual input device, no media files are
+// needed.
+func FfmpegGenerateSample(outFile string, spec SampleSpec) error {
+	if err := spec.validate(); err != nil {
+		return fmt.Errorf("FfmpegGenerateSample() %w", err)
+	}
+
+	ffmpegPath, err := FfmpegPath()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(ffmpegPath, spec.args(outFile)...) //#nosec G204
+	logging.Debugf("Running: %s\n", cmd)
+	release := AcquireProcess()
+	out, err := cmd.CombinedOutput()
+	release()
+	if err != nil {
+		return fmt.Errorf("FfmpegGenerateSample() exec: %w: %s", err, out)
+	}
+
+	return nil
+}
+
+// FfmpegVersion will return ffmpeg version string (first line of "ffmpeg
+// -version" output).
+func FfmpegVersion() (string, error) {
+	ffmpegPath, err := FfmpegPath()
+	if err != nil {
+		return "", err
+	}
+	v, err := toolVersion(ffmpegPath)
+	if err != nil {
+		return "", fmt.Errorf("FfmpegVersion() %w", err)
+	}
+	return v, nil
+}
+
+// FfprobeVersion returns ffprobe version string (first line of "ffprobe
+// -version" output).
+func FfprobeVersion() (string, error) {
+	ffprobePath, err := FfprobePath()
+	if err != nil {
+		return "", err
+	}
+	v, err := toolVersion(ffprobePath)
+	if err != nil {
+		return "", fmt.Errorf("FfprobeVersion() %w", err)
+	}
+	return v, nil
+}
+
+// toolVersion returns first line of "<exePath> -version" output.
+func toolVersion(exePath string) (string, error) {
+	out, err := exec.Command(exePath, "-version").Output() //#nosec G204
+	if err != nil {
+		return "", fmt.Errorf("exec: %w", err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+// FfmpegHasFilter reports whether ffmpeg was built with given filter (e.g.
+// "libvmaf" requires ffmpeg built with --enable-libvmaf).
+func FfmpegHasFilter(name string) (bool, error) {
+	ffmpegPath, err := FfmpegPath()
+	if err != nil {
+		return false, err
+	}
+	out, err := exec.Command(ffmpegPath, "-hide_banner", "-filters").Output() //#nosec G204
+	if err != nil {
+		return false, fmt.Errorf("FfmpegHasFilter() exec: %w", err)
+	}
+	return hasFilter(out, name), nil
+}
+
+// hasFilter looks for filter name in "ffmpeg -filters" output.
+//
+// Filter lines consist of flags, filter name, in/out pads and description,
+// e.g. " ... libvmaf           VV->V      Calculate the VMAF between two video streams."
+func hasFilter(filtersOutput []byte, name string) bool {
+	for _, line := range strings.Split(string(filtersOutput), "\n") {
+		fields := strings.Fields(line)
+		// Legend lines have no in/out pads column.
+		if len(fields) > 2 && fields[1] == name && strings.Contains(fields[2], "->") {
+			return true
+		}
+	}
+	return false
+}
+
+// FfmpegHasHWAccel reports whether ffmpeg supports given hardware
+// acceleration method (e.g. "cuda").
+func FfmpegHasHWAccel(name string) (bool, error) {
+	ffmpegPath, err := FfmpegPath()
+	if err != nil {
+		return false, err
+	}
+	out, err := exec.Command(ffmpegPath, "-hide_banner", "-hwaccels").Output() //#nosec G204
+	if err != nil {
+		return false, fmt.Errorf("FfmpegHasHWAccel() exec: %w", err)
+	}
+	return hasHWAccel(out, name), nil
+}
+
+// hasHWAccel looks for method name in "ffmpeg -hwaccels" output, which is a
+// header line followed by a method per line.
+func hasHWAccel(hwaccelsOutput []byte, name string) bool {
+	_, methods, found := strings.Cut(string(hwaccelsOutput), ":")
+	if !found {
+		return false
+	}
+	for _, m := range strings.Fields(methods) {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
 // FindLibvmafModel will return path to libvmaf model file.
 //
 // XXX: Although not specifically related to ffmpeg family tools, but for time
@@ -126,3 +644,35 @@ func FindLibvmafModel() (string, error) {
 
 	return "", fmt.Errorf("libvmaf model file %s not found in any of %s", libvmafModel, libvmafModelLocations)
 }
+
+// libvmafModelKeys are top-level keys expected in libvmaf JSON model file.
+var libvmafModelKeys = []string{"model_dict"}
+
+// ValidateLibvmafModel will check that libvmaf model file is a JSON object with
+// expected top-level keys, so that broken model file (e.g. truncated download)
+// is detected before VQM measurement rather than by cryptic ffmpeg failure.
+//
+// Validation is best-effort to not depend on model schema details which differ
+// between libvmaf versions: only presence of top-level keys is checked and
+// model files of other formats (by file extension, e.g. legacy .pkl) are not
+// checked at all.
+func ValidateLibvmafModel(modelFile string) error {
+	if !strings.EqualFold(path.Ext(modelFile), ".json") {
+		logging.Debugf("libvmaf model %s is not JSON, not validated", modelFile)
+		return nil
+	}
+	b, err := os.ReadFile(modelFile)
+	if err != nil {
+		return fmt.Errorf("ValidateLibvmafModel() %w", err)
+	}
+	var model map[string]json.RawMessage
+	if err := json.Unmarshal(b, &model); err != nil {
+		return fmt.Errorf("libvmaf model %s is not valid JSON: %w", modelFile, err)
+	}
+	for _, k := range libvmafModelKeys {
+		if _, ok := model[k]; !ok {
+			return fmt.Errorf("libvmaf model %s has no %q key", modelFile, k)
+		}
+	}
+	return nil
+}
@@ -5,9 +5,13 @@
 package tools
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/evolution-gaming/ease/internal/video"
 	"github.com/google/go-cmp/cmp"
@@ -98,12 +102,14 @@ func Test_FfprobeExtractMetadata(t *testing.T) {
 	videoFile := "../../testdata/video/testsrc02.mp4"
 	t.Run("Should extract VideoMetadata from video file", func(t *testing.T) {
 		want := video.Metadata{
-			Duration:  10,
-			Width:     1280,
-			Height:    720,
-			BitRate:   86740,
-			CodecName: "h264",
-			FrameRate: "24/1",
+			Duration:     10,
+			Width:        1280,
+			Height:       720,
+			BitRate:      86740,
+			CodecName:    "h264",
+			FrameRate:    "24/1",
+			FrameCount:   240,
+			AvgFrameRate: "24/1",
 		}
 
 		got, err := FfprobeExtractMetadata(videoFile)
@@ -135,6 +141,310 @@ func Test_FfprobeExtractMetadata_Negative(t *testing.T) {
 	})
 }
 
+func Test_parseFfprobeMetadata(t *testing.T) {
+	tests := map[string]struct {
+		given string
+		want  video.Metadata
+	}{
+		"mp4 with frame count": {
+			given: `{"streams": [{"codec_name": "h264", "r_frame_rate": "25/1", "avg_frame_rate": "25/1",
+				"duration": "9.6", "width": 1280, "height": 720, "bit_rate": "1000", "nb_frames": "240"}],
+				"format": {"duration": "9.6", "bit_rate": "1200"}}`,
+			want: video.Metadata{
+				CodecName: "h264", FrameRate: "25/1", AvgFrameRate: "25/1", Duration: 9.6, Width: 1280,
+				Height: 720, BitRate: 1000, FrameCount: 240,
+			},
+		},
+		"mkv with duration only in format": {
+			given: `{"streams": [{"codec_name": "h264", "r_frame_rate": "25/1", "avg_frame_rate": "25/1",
+				"width": 1280, "height": 720}],
+				"format": {"duration": "10.000000", "bit_rate": "1200"}}`,
+			want: video.Metadata{
+				CodecName: "h264", FrameRate: "25/1", AvgFrameRate: "25/1", Duration: 10, Width: 1280,
+				Height: 720, BitRate: 1200, FrameCount: 250,
+			},
+		},
+		"Exactly counted frames and unknown values": {
+			given: `{"streams": [{"codec_name": "hevc", "r_frame_rate": "0/0", "avg_frame_rate": "30000/1001",
+				"duration": "N/A", "width": 640, "height": 360, "bit_rate": "N/A", "nb_read_frames": "299"}],
+				"format": {"duration": "10.0"}}`,
+			want: video.Metadata{
+				CodecName: "hevc", FrameRate: "30000/1001", AvgFrameRate: "30000/1001", Duration: 10, Width: 640,
+				Height: 360, FrameCount: 299,
+			},
+		},
+		"Rotation in display matrix": {
+			given: `{"streams": [{"codec_name": "h264", "r_frame_rate": "30/1", "avg_frame_rate": "30/1",
+				"duration": "1.0", "width": 1920, "height": 1080, "nb_frames": "30",
+				"side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]}],
+				"format": {"duration": "1.0"}}`,
+			want: video.Metadata{
+				CodecName: "h264", FrameRate: "30/1", AvgFrameRate: "30/1", Duration: 1, Width: 1920,
+				Height: 1080, FrameCount: 30, Rotation: 90,
+			},
+		},
+		"Rotation in rotate tag": {
+			given: `{"streams": [{"codec_name": "h264", "r_frame_rate": "30/1", "avg_frame_rate": "30/1",
+				"duration": "1.0", "width": 1920, "height": 1080, "nb_frames": "30",
+				"tags": {"rotate": "270"}}],
+				"format": {"duration": "1.0"}}`,
+			want: video.Metadata{
+				CodecName: "h264", FrameRate: "30/1", AvgFrameRate: "30/1", Duration: 1, Width: 1920,
+				Height: 1080, FrameCount: 30, Rotation: 270,
+			},
+		},
+		"Variable frame rate": {
+			given: `{"streams": [{"codec_name": "h264", "r_frame_rate": "1000/1", "avg_frame_rate": "30/1",
+				"duration": "1.0", "width": 1920, "height": 1080, "nb_frames": "30"}],
+				"format": {"duration": "1.0"}}`,
+			want: video.Metadata{
+				CodecName: "h264", FrameRate: "1000/1", AvgFrameRate: "30/1", Duration: 1, Width: 1920,
+				Height: 1080, FrameCount: 30,
+			},
+		},
+		"HDR color metadata": {
+			given: `{"streams": [{"codec_name": "hevc", "r_frame_rate": "25/1", "avg_frame_rate": "25/1",
+				"duration": "1.0", "width": 3840, "height": 2160, "nb_frames": "25", "pix_fmt": "yuv420p10le",
+				"color_range": "tv", "color_primaries": "bt2020", "color_transfer": "smpte2084"}],
+				"format": {"duration": "1.0"}}`,
+			want: video.Metadata{
+				CodecName: "hevc", FrameRate: "25/1", AvgFrameRate: "25/1", Duration: 1, Width: 3840,
+				Height: 2160, FrameCount: 25,
+				Color: video.Color{PixFmt: "yuv420p10le", Range: "tv", Primaries: "bt2020", Transfer: "smpte2084"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseFfprobeMetadata([]byte(tc.given))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Metadata mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_FfprobeExtractMetadata_Retry(t *testing.T) {
+	tmpDir := t.TempDir()
+	marker := path.Join(tmpDir, "failed_once")
+	// Fake ffprobe failing on first execution only.
+	fakeFfprobe := path.Join(tmpDir, "ffprobe")
+	script := fmt.Sprintf(`#!/bin/sh
+if [ ! -f %[1]s ]; then touch %[1]s; exit 1; fi
+echo '{"streams": [{"codec_name": "h264", "r_frame_rate": "25/1", "nb_frames": "10"}], "format": {"duration": "0.4"}}'
+`, marker)
+	if err := os.WriteFile(fakeFfprobe, []byte(script), 0o755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Setenv(ffprobeEnvOverride, fakeFfprobe)
+
+	t.Run("Should fail without retries", func(t *testing.T) {
+		os.Remove(marker)
+		_, err := FfprobeExtractMetadata("../../testdata/video/testsrc01.mp4", WithRetries(1, 0))
+		if err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+	t.Run("Should fail with single attempt set for the tool", func(t *testing.T) {
+		t.Cleanup(func() { SetProbeAttempts(0) })
+		os.Remove(marker)
+		SetProbeAttempts(1)
+		_, err := FfprobeExtractMetadata("../../testdata/video/testsrc01.mp4")
+		if err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+	t.Run("Should succeed on retry", func(t *testing.T) {
+		os.Remove(marker)
+		got, err := FfprobeExtractMetadata("../../testdata/video/testsrc01.mp4", WithRetries(2, time.Millisecond))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(10, got.FrameCount); diff != "" {
+			t.Errorf("FrameCount mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func Test_parseFfprobeMetadata_Negative(t *testing.T) {
+	t.Run("Should return ErrNoVideoStream for no streams", func(t *testing.T) {
+		_, err := parseFfprobeMetadata([]byte(`{"streams": [], "format": {}}`))
+		if !errors.Is(err, ErrNoVideoStream) {
+			t.Errorf("Expected ErrNoVideoStream, got: %v", err)
+		}
+	})
+	t.Run("Should fail for invalid JSON", func(t *testing.T) {
+		if _, err := parseFfprobeMetadata([]byte(`{`)); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_FfmpegCheckIntegrity(t *testing.T) {
+	t.Run("Should pass for valid video file", func(t *testing.T) {
+		if err := FfmpegCheckIntegrity("../../testdata/video/testsrc02.mp4"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func Test_FfmpegSetMetadata_Negative(t *testing.T) {
+	t.Run("Should fail for non-existent media file", func(t *testing.T) {
+		if err := FfmpegSetMetadata("/non/existent/path/to/file.mp4", "comment", "VMAF=90"); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func Test_FfmpegVersion(t *testing.T) {
+	got, err := FfmpegVersion()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(got, "ffmpeg version") {
+		t.Errorf("Unexpected version string: %s", got)
+	}
+}
+
+func Test_parseSceneCuts(t *testing.T) {
+	given := []byte(`Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'clip.mp4':
+[Parsed_showinfo_1 @ 0x55d5c8a3c6c0] config in time_base: 1/12800, frame_rate: 25/1
+[Parsed_showinfo_1 @ 0x55d5c8a3c6c0] n:   0 pts:  51200 pts_time:4       duration:    512 duration_time:0.04    pos:   123 fmt:yuv420p
+[Parsed_showinfo_1 @ 0x55d5c8a3c6c0] n:   1 pts: 115712 pts_time:9.04    duration:    512 duration_time:0.04    pos:   456 fmt:yuv420p
+frame=    2 fps=0.0 q=-0.0 Lsize=N/A time=00:00:10.00 bitrate=N/A speed=  50x
+`)
+	want := []float64{4, 9.04}
+
+	got := parseSceneCuts(given)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Scene cuts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_FfmpegSceneCuts_Negative(t *testing.T) {
+	if _, err := FfmpegSceneCuts("/non/existent/path/to/file", 0.4); err == nil {
+		t.Error("Expected error, but got <nil>")
+	}
+}
+
+func Test_SampleSpec_args(t *testing.T) {
+	spec := SampleSpec{Source: SampleSourceMandelbrot, Size: "1280x720", FrameRate: "30000/1001", Duration: 2.5}
+	if err := spec.validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "-v error -f lavfi -i mandelbrot=size=1280x720:rate=30000/1001 -t 2.5 " +
+		"-pix_fmt yuv420p -c:v libx264 -preset veryfast -qp 0 -y out.mp4"
+	if diff := cmp.Diff(want, strings.Join(spec.args("out.mp4"), " ")); diff != "" {
+		t.Errorf("Arguments mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_FfmpegGenerateSample_Negative(t *testing.T) {
+	valid := SampleSpec{Source: SampleSourceTestsrc, Size: "640x360", FrameRate: "25", Duration: 1}
+	tests := map[string]func(s *SampleSpec){
+		"Unsupported source": func(s *SampleSpec) { s.Source = "smptebars" },
+		"Invalid size":       func(s *SampleSpec) { s.Size = "640x360:rate=1" },
+		"Invalid frame rate": func(s *SampleSpec) { s.FrameRate = "0" },
+		"Zero duration":      func(s *SampleSpec) { s.Duration = 0 },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			spec := valid
+			modify(&spec)
+			if err := FfmpegGenerateSample(path.Join(t.TempDir(), "out.mp4"), spec); err == nil {
+				t.Error("Expected error, but got <nil>")
+			}
+		})
+	}
+}
+
+func Test_FfmpegGenerateSample(t *testing.T) {
+	outFile := path.Join(t.TempDir(), "sample.mp4")
+	spec := SampleSpec{Source: SampleSourceTestsrc2, Size: "320x240", FrameRate: "25", Duration: 1}
+	if err := FfmpegGenerateSample(outFile, spec); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	vmeta, err := FfprobeExtractMetadata(outFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(25, vmeta.FrameCount); diff != "" {
+		t.Errorf("Frame count mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_hasFilter(t *testing.T) {
+	given := []byte(`Filters:
+  T.. = Timeline support
+  --- = Source or sink filter
+ ... libvmaf           VV->V      Calculate the VMAF between two video streams.
+ TSC psnr              VV->V      Calculate the PSNR between two video streams.
+`)
+	tests := map[string]struct {
+		name string
+		want bool
+	}{
+		"Existing filter":     {name: "libvmaf", want: true},
+		"Other filter":        {name: "psnr", want: true},
+		"Missing filter":      {name: "libvmaf_cuda", want: false},
+		"Not a filter name":   {name: "Calculate", want: false},
+		"Legend is no filter": {name: "=", want: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, hasFilter(given, tc.name)); diff != "" {
+				t.Errorf("hasFilter() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_hasHWAccel(t *testing.T) {
+	given := []byte("Hardware acceleration methods:\nvdpau\ncuda\nvaapi\n\n")
+	tests := map[string]struct {
+		output []byte
+		name   string
+		want   bool
+	}{
+		"Existing method":   {output: given, name: "cuda", want: true},
+		"Missing method":    {output: given, name: "qsv", want: false},
+		"Header is ignored": {output: given, name: "methods", want: false},
+		"No methods":        {output: []byte("Hardware acceleration methods:\n\n"), name: "cuda", want: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, hasHWAccel(tc.output, tc.name)); diff != "" {
+				t.Errorf("hasHWAccel() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_FfmpegCheckIntegrity_Negative(t *testing.T) {
+	t.Run("Should fail for non-existent media file", func(t *testing.T) {
+		if err := FfmpegCheckIntegrity("/non/existent/path/to/file"); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+	t.Run("Should fail for truncated media file", func(t *testing.T) {
+		src, err := os.ReadFile("../../testdata/video/testsrc02.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		truncated := path.Join(t.TempDir(), "truncated.mp4")
+		if err := os.WriteFile(truncated, src[:len(src)/2], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := FfmpegCheckIntegrity(truncated); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
 func Test_FindLibvmafModel(t *testing.T) {
 	t.Run("Model path should be valid", func(t *testing.T) {
 		checkModelFile := func(t *testing.T, fPath string) {
@@ -170,3 +480,37 @@ func Test_FindLibvmafModel(t *testing.T) {
 		}
 	})
 }
+
+func TestValidateLibvmafModel(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]struct {
+		file    string
+		content string
+		wantErr bool
+	}{
+		"Valid model":     {file: "model.json", content: `{"param_dict": {}, "model_dict": {"model_type": "LIBSVMNUSVR"}}`},
+		"Truncated model": {file: "truncated.json", content: `{"param_dict": {}, "model_di`, wantErr: true},
+		"Wrong format":    {file: "wrong.json", content: `[1, 2, 3]`, wantErr: true},
+		"Missing key":     {file: "missing.json", content: `{"param_dict": {}}`, wantErr: true},
+		"Not JSON model":  {file: "model.pkl", content: "legacy"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := path.Join(dir, tc.file)
+			if err := os.WriteFile(f, []byte(tc.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := ValidateLibvmafModel(f)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Error mismatch: wantErr=%v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("Should fail for non-existent model", func(t *testing.T) {
+		if err := ValidateLibvmafModel(path.Join(dir, "non-existent.json")); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
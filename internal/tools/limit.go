@@ -0,0 +1,59 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Limit of concurrently running ffmpeg family child processes.
+
+package tools
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	procMu sync.Mutex
+	// procSlots is a semaphore of child process slots, nil means no limit
+	procSlots chan struct{}
+)
+
+// SetProcessLimit limits number of concurrently running ffmpeg and ffprobe
+// child processes (probing, VQM measurement, analysis) across the tool, n <= 0
+// means no limit which is the default.
+//
+// It is meant to be called once on startup, processes already holding a slot
+// are not affected.
+func SetProcessLimit(n int) {
+	procMu.Lock()
+	defer procMu.Unlock()
+	if n <= 0 {
+		procSlots = nil
+		return
+	}
+	procSlots = make(chan struct{}, n)
+}
+
+// AcquireProcess will block until child process slot is available, returned
+// function releases the slot and must be called once process exits.
+func AcquireProcess() (release func()) {
+	release, _ = AcquireProcessContext(context.Background())
+	return release
+}
+
+// AcquireProcessContext is AcquireProcess which gives up waiting for slot when
+// ctx is done, in that case ctx error is returned along with no-op release
+// function.
+func AcquireProcessContext(ctx context.Context) (release func(), err error) {
+	procMu.Lock()
+	slots := procSlots
+	procMu.Unlock()
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return func() {}, ctx.Err()
+	}
+}
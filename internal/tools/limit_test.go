@@ -0,0 +1,43 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProcessLimit(t *testing.T) {
+	t.Cleanup(func() { SetProcessLimit(0) })
+
+	t.Run("Should not block without limit", func(t *testing.T) {
+		SetProcessLimit(0)
+		for i := 0; i < 10; i++ {
+			AcquireProcess()
+		}
+	})
+
+	t.Run("Should block when all slots are taken", func(t *testing.T) {
+		SetProcessLimit(2)
+		r1 := AcquireProcess()
+		r2 := AcquireProcess()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := AcquireProcessContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+		}
+
+		r1()
+		release, err := AcquireProcessContext(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		release()
+		r2()
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Priority of child processes.
+
+package tools
+
+import (
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+)
+
+// SetPriority will make cmd run with niceness adjusted by nice and with I/O
+// scheduling class ioClass ("best-effort" or "idle", Linux only). Zero nice and
+// empty ioClass mean no change.
+//
+// Priority is applied before command is executed by wrapping it with nice(1)
+// and ionice(1), so there is no window where command runs with priority of
+// ease process and all processes it spawns inherit it. Wrappers exec into
+// command, so command still runs as the same process. Must be called before
+// cmd is started.
+//
+// Missing wrapper tool is logged and respective setting is skipped, since
+// priority does not affect command result.
+func SetPriority(cmd *exec.Cmd, nice int, ioClass string) {
+	if ioClass != "" {
+		if runtime.GOOS == "linux" {
+			// Failure to set I/O class is ignored (-t) in the same way as nice
+			// failure, command is run anyway.
+			wrapCommand(cmd, "ionice", "-t", "-c", ioClass)
+		} else {
+			logging.Infof("Unable to set I/O class %s: only supported on Linux", ioClass)
+		}
+	}
+	if nice != 0 {
+		wrapCommand(cmd, "nice", "-n", strconv.Itoa(nice))
+	}
+}
+
+// wrapCommand will make cmd run via wrapper tool name with given args.
+func wrapCommand(cmd *exec.Cmd, name string, args ...string) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		logging.Infof("Unable to set priority via %s: %s", name, err)
+		return
+	}
+	wrapped := append([]string{name}, args...)
+	wrapped = append(wrapped, cmd.Path)
+	cmd.Args = append(wrapped, cmd.Args[1:]...)
+	cmd.Path = path
+}
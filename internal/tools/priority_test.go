@@ -0,0 +1,53 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSetPriority(t *testing.T) {
+	t.Run("Should start command with given nice", func(t *testing.T) {
+		cmd := exec.Command("sh", "-c", "nice")
+		SetPriority(cmd, 5, "")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff("5", strings.TrimSpace(string(out))); diff != "" {
+			t.Errorf("Niceness mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should start command with given I/O class", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("I/O class is only supported on Linux")
+		}
+		if _, err := exec.LookPath("ionice"); err != nil {
+			t.Skip("ionice not available")
+		}
+		cmd := exec.Command("sh", "-c", "ionice")
+		SetPriority(cmd, 0, "idle")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff("idle", strings.TrimSpace(string(out))); diff != "" {
+			t.Errorf("I/O class mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should keep command unchanged without priority settings", func(t *testing.T) {
+		cmd := exec.Command("sh", "-c", "true")
+		want := cmd.String()
+		SetPriority(cmd, 0, "")
+		if diff := cmp.Diff(want, cmd.String()); diff != "" {
+			t.Errorf("Command mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
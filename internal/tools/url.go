@@ -0,0 +1,18 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tools
+
+import "regexp"
+
+// urlSchemeRe matches URL scheme prefix (e.g. "https://"), as per RFC 3986
+// scheme is a letter followed by letters, digits, "+", "-" or ".".
+var urlSchemeRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+
+// IsURL reports whether input is a URL (e.g. HTTP(S) link to object storage)
+// rather than local file path. URL inputs are read by ffmpeg directly, so they
+// can not be checked via local file system.
+func IsURL(input string) bool {
+	return urlSchemeRe.MatchString(input)
+}
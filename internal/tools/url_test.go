@@ -0,0 +1,30 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tools
+
+import "testing"
+
+func TestIsURL(t *testing.T) {
+	tests := map[string]struct {
+		given string
+		want  bool
+	}{
+		"HTTPS":          {given: "https://bucket.example.com/mezz/clip01.mp4?sig=abc", want: true},
+		"HTTP":           {given: "http://localhost:8080/clip01.mp4", want: true},
+		"S3":             {given: "s3://bucket/clip01.mp4", want: true},
+		"Absolute path":  {given: "/data/clip01.mp4", want: false},
+		"Relative path":  {given: "mezz/clip01.mp4", want: false},
+		"Windows path":   {given: `C:\data\clip01.mp4`, want: false},
+		"Colon in name":  {given: "clip:01.mp4", want: false},
+		"Missing scheme": {given: "://clip01.mp4", want: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := IsURL(tc.given); got != tc.want {
+				t.Errorf("IsURL(%q) = %v, want %v", tc.given, got, tc.want)
+			}
+		})
+	}
+}
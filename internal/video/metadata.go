@@ -6,6 +6,12 @@
 
 package video
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // Metadata type contains useful video stream metadata.
 type Metadata struct {
 	CodecName string  `json:"codec_name,omitempty"`
@@ -14,9 +20,123 @@ type Metadata struct {
 	Width     int     `json:"width,omitempty"`
 	Height    int     `json:"height,omitempty"`
 	BitRate   int     `json:"bit_rate,omitempty,string"`
+	// AvgFrameRate is average frame rate (total frames divided by duration)
+	AvgFrameRate string `json:"avg_frame_rate,omitempty"`
+	// FrameCount is a number of frames in video stream
+	FrameCount int `json:"nb_frames,omitempty,string"`
+	// Rotation is display rotation in degrees clockwise (0, 90, 180 or 270),
+	// Width and Height are dimensions before rotation
+	Rotation int `json:"rotation,omitempty"`
+	Color
+}
+
+// Color contains color characteristics of video stream, values are as named
+// by ffprobe (e.g. "bt709", "smpte2084", "tv"), empty when unknown.
+type Color struct {
+	PixFmt    string `json:"pix_fmt,omitempty"`
+	Range     string `json:"color_range,omitempty"`
+	Primaries string `json:"color_primaries,omitempty"`
+	Transfer  string `json:"color_transfer,omitempty"`
+}
+
+// IsHDR reports whether transfer characteristics are HDR ones (PQ or HLG).
+func (c Color) IsHDR() bool {
+	return c.Transfer == "smpte2084" || c.Transfer == "arib-std-b67"
+}
+
+// Mismatch returns descriptions of color characteristics which differ
+// between c and o (e.g. "transfer smpte2084 vs bt709"). Characteristics
+// unknown for either of them are not compared. Pixel formats are not compared
+// either, since VQM tools convert between them.
+func (c Color) Mismatch(o Color) []string {
+	var diffs []string
+	compare := func(name, a, b string) {
+		if isKnownColor(a) && isKnownColor(b) && a != b {
+			diffs = append(diffs, fmt.Sprintf("%s %s vs %s", name, a, b))
+		}
+	}
+	compare("primaries", c.Primaries, o.Primaries)
+	compare("transfer", c.Transfer, o.Transfer)
+	compare("range", c.Range, o.Range)
+	return diffs
+}
+
+// isKnownColor reports whether color characteristic value is known.
+func isKnownColor(v string) bool {
+	return v != "" && v != "unknown" && v != "unspecified"
+}
+
+// DisplaySize returns frame dimensions with display rotation applied.
+func (m Metadata) DisplaySize() (width, height int) {
+	if m.Rotation == 90 || m.Rotation == 270 {
+		return m.Height, m.Width
+	}
+	return m.Width, m.Height
 }
 
 // MetadataExtractor is the interface that wraps ExtractMetadata method.
 type MetadataExtractor interface {
 	ExtractMetadata(videoFile string) (Metadata, error)
 }
+
+// Frame rate sources, see Metadata.FrameRateFrom.
+const (
+	// FrameRateAuto uses average frame rate with fallback to base frame rate.
+	FrameRateAuto = "auto"
+	// FrameRateBase uses base frame rate (ffprobe's r_frame_rate).
+	FrameRateBase = "base"
+	// FrameRateAvg uses average frame rate (ffprobe's avg_frame_rate).
+	FrameRateAvg = "avg"
+)
+
+// IsFrameRateSource reports whether s is a valid frame rate source.
+func IsFrameRateSource(s string) bool {
+	switch s {
+	case FrameRateAuto, FrameRateBase, FrameRateAvg:
+		return true
+	}
+	return false
+}
+
+// FrameRateFrom returns frame rate (in frames per second) from given source
+// (one of FrameRateAuto, FrameRateBase or FrameRateAvg).
+//
+// Base frame rate is the lowest rate all timestamps can be represented with,
+// for some containers it is misleading (e.g. 1000/1), while average frame rate
+// is representative for variable frame rate content as well. Hence
+// FrameRateAuto prefers average frame rate.
+func (m Metadata) FrameRateFrom(source string) (float64, error) {
+	switch source {
+	case FrameRateBase:
+		return ParseFrameRate(m.FrameRate)
+	case FrameRateAvg:
+		return ParseFrameRate(m.AvgFrameRate)
+	case FrameRateAuto, "":
+		if fps, err := ParseFrameRate(m.AvgFrameRate); err == nil && fps > 0 {
+			return fps, nil
+		}
+		return ParseFrameRate(m.FrameRate)
+	}
+	return 0, fmt.Errorf("FrameRateFrom() unknown frame rate source %q", source)
+}
+
+// ParseFrameRate will parse frame rate in ffprobe's rational form (e.g. "30000/1001")
+// into a float.
+func ParseFrameRate(rate string) (float64, error) {
+	num, den, found := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ParseFrameRate() numerator: %w", err)
+	}
+	if !found {
+		return n, nil
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ParseFrameRate() denominator: %w", err)
+	}
+	if d == 0 {
+		return 0, fmt.Errorf("ParseFrameRate() zero denominator in %q", rate)
+	}
+	return n / d, nil
+}
@@ -0,0 +1,144 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package video
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFrameRate(t *testing.T) {
+	tests := map[string]struct {
+		given   string
+		want    float64
+		wantErr bool
+	}{
+		"Integer rational": {given: "24/1", want: 24},
+		"NTSC rational":    {given: "30000/1001", want: 30000.0 / 1001},
+		"Plain number":     {given: "25", want: 25},
+		"Zero denominator": {given: "0/0", wantErr: true},
+		"Garbage":          {given: "abc", wantErr: true},
+		"Empty":            {given: "", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseFrameRate(tc.given)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, but got <nil>")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Frame rate mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMetadataFrameRateFrom(t *testing.T) {
+	vfr := Metadata{FrameRate: "1000/1", AvgFrameRate: "30/1"}
+	tests := map[string]struct {
+		given  Metadata
+		source string
+		want   float64
+	}{
+		"Auto prefers average":    {given: vfr, source: FrameRateAuto, want: 30},
+		"Empty source is auto":    {given: vfr, source: "", want: 30},
+		"Base":                    {given: vfr, source: FrameRateBase, want: 1000},
+		"Average":                 {given: vfr, source: FrameRateAvg, want: 30},
+		"Auto falls back to base": {given: Metadata{FrameRate: "25/1"}, source: FrameRateAuto, want: 25},
+		"Auto skips zero average": {given: Metadata{FrameRate: "25/1", AvgFrameRate: "0/0"}, source: FrameRateAuto, want: 25},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.given.FrameRateFrom(tc.source)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Frame rate mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("Unknown source", func(t *testing.T) {
+		if _, err := vfr.FrameRateFrom("bogus"); err == nil {
+			t.Error("Expected error, but got <nil>")
+		}
+	})
+}
+
+func TestMetadataDisplaySize(t *testing.T) {
+	tests := map[string]struct {
+		given      Metadata
+		wantWidth  int
+		wantHeight int
+	}{
+		"No rotation": {given: Metadata{Width: 1920, Height: 1080}, wantWidth: 1920, wantHeight: 1080},
+		"Rotated 90":  {given: Metadata{Width: 1920, Height: 1080, Rotation: 90}, wantWidth: 1080, wantHeight: 1920},
+		"Rotated 180": {given: Metadata{Width: 1920, Height: 1080, Rotation: 180}, wantWidth: 1920, wantHeight: 1080},
+		"Rotated 270": {given: Metadata{Width: 1920, Height: 1080, Rotation: 270}, wantWidth: 1080, wantHeight: 1920},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotWidth, gotHeight := tc.given.DisplaySize()
+			if diff := cmp.Diff([]int{tc.wantWidth, tc.wantHeight}, []int{gotWidth, gotHeight}); diff != "" {
+				t.Errorf("Display size mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestColorMismatch(t *testing.T) {
+	sdr := Color{PixFmt: "yuv420p", Range: "tv", Primaries: "bt709", Transfer: "bt709"}
+	hdr := Color{PixFmt: "yuv420p10le", Range: "tv", Primaries: "bt2020", Transfer: "smpte2084"}
+	tests := map[string]struct {
+		given Color
+		other Color
+		want  []string
+	}{
+		"Same":                 {given: sdr, other: sdr},
+		"Pixel format ignored": {given: sdr, other: Color{PixFmt: "yuv420p10le", Range: "tv", Primaries: "bt709", Transfer: "bt709"}},
+		"Unknown ignored":      {given: sdr, other: Color{Primaries: "unknown"}},
+		"HDR vs SDR":           {given: hdr, other: sdr, want: []string{"primaries bt2020 vs bt709", "transfer smpte2084 vs bt709"}},
+		"Range":                {given: sdr, other: Color{Range: "pc"}, want: []string{"range tv vs pc"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.given.Mismatch(tc.other)); diff != "" {
+				t.Errorf("Color differences mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestColorIsHDR(t *testing.T) {
+	tests := map[string]struct {
+		given Color
+		want  bool
+	}{
+		"PQ":      {given: Color{Transfer: "smpte2084"}, want: true},
+		"HLG":     {given: Color{Transfer: "arib-std-b67"}, want: true},
+		"SDR":     {given: Color{Transfer: "bt709"}},
+		"Unknown": {given: Color{}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.given.IsHDR(); got != tc.want {
+				t.Errorf("IsHDR() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
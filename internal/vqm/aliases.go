@@ -0,0 +1,115 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Mapping of libvmaf JSON keys to metrics, libvmaf tends to rename metrics
+// between versions and depending on options.
+
+package vqm
+
+import "fmt"
+
+// FieldAliases maps metric names (VMAF, PSNR, PSNR_CB, PSNR_CR, MS_SSIM) to
+// libvmaf JSON keys accepted for metric. Keys are tried in order and first key
+// present in libvmaf JSON wins, built-in keys are tried after configured ones.
+type FieldAliases map[string][]string
+
+// defaultFieldAliases are built-in libvmaf JSON keys of metrics, luma PSNR is
+// reported either as "psnr_y" or as "psnr" depending on libvmaf version.
+var defaultFieldAliases = FieldAliases{
+	"VMAF":    {"vmaf"},
+	"PSNR":    {"psnr_y", "psnr"},
+	"PSNR_CB": {"psnr_cb"},
+	"PSNR_CR": {"psnr_cr"},
+	"MS_SSIM": {"ms_ssim", "float_ms_ssim"},
+}
+
+// Validate checks that aliases are given for known metrics only and keys are
+// not empty.
+func (a FieldAliases) Validate() error {
+	for name, keys := range a {
+		if _, ok := defaultFieldAliases[name]; !ok {
+			return fmt.Errorf("unknown metric %q in field aliases", name)
+		}
+		for _, k := range keys {
+			if k == "" {
+				return fmt.Errorf("empty field alias for metric %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+// keys returns libvmaf JSON keys accepted for metric: configured ones followed
+// by built-in ones.
+func (a FieldAliases) keys(name string) []string {
+	keys := make([]string, 0, len(a[name])+len(defaultFieldAliases[name]))
+	keys = append(keys, a[name]...)
+	return append(keys, defaultFieldAliases[name]...)
+}
+
+// metric returns per frame metrics from raw libvmaf frame metrics.
+func (a FieldAliases) metric(raw map[string]float64) metric {
+	get := func(name string) float64 {
+		for _, k := range a.keys(name) {
+			if v, ok := raw[k]; ok {
+				return v
+			}
+		}
+		return 0
+	}
+	return metric{
+		VMAF:    get("VMAF"),
+		PSNR:    get("PSNR"),
+		PSNR_CB: get("PSNR_CB"),
+		PSNR_CR: get("PSNR_CR"),
+		MS_SSIM: get("MS_SSIM"),
+	}
+}
+
+// pooledMetrics returns pooled metrics from raw libvmaf pooled metrics.
+func (a FieldAliases) pooledMetrics(raw map[string]pMetric) pooledMetrics {
+	get := func(name string) pMetric {
+		for _, k := range a.keys(name) {
+			if v, ok := raw[k]; ok {
+				return v
+			}
+		}
+		return pMetric{}
+	}
+	return pooledMetrics{
+		VMAF:    get("VMAF"),
+		PSNR:    get("PSNR"),
+		PSNR_CB: get("PSNR_CB"),
+		PSNR_CR: get("PSNR_CR"),
+		MS_SSIM: get("MS_SSIM"),
+	}
+}
+
+// absent returns names of VMAF, PSNR and MS_SSIM metrics missing from raw
+// libvmaf pooled metrics.
+func (a FieldAliases) absent(raw map[string]pMetric) []string {
+	var names []string
+	for _, name := range []string{"VMAF", "PSNR", "MS_SSIM"} {
+		found := false
+		for _, k := range a.keys(name) {
+			if _, ok := raw[k]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// frames returns per frame metrics from raw libvmaf frames.
+func (a FieldAliases) frames(raw []rawFrame) []frame {
+	frames := make([]frame, len(raw))
+	for i, f := range raw {
+		frames[i] = frame{FrameNum: f.FrameNum, Metrics: a.metric(f.Metrics)}
+	}
+	return frames
+}
@@ -0,0 +1,75 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package vqm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFieldAliases_Validate(t *testing.T) {
+	tests := map[string]struct {
+		given   FieldAliases
+		wantErr bool
+	}{
+		"Empty":          {given: nil},
+		"Known metrics":  {given: FieldAliases{"VMAF": {"vmaf_v2"}, "MS_SSIM": {"ms_ssim_v2"}}},
+		"Unknown metric": {given: FieldAliases{"SSIM": {"ssim"}}, wantErr: true},
+		"Empty key":      {given: FieldAliases{"PSNR": {""}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.given.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Error mismatch: wantErr=%v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFieldAliases_metric(t *testing.T) {
+	given := map[string]float64{"vmaf": 90, "vmaf_v2": 91, "psnr": 42, "psnr_y": 40, "float_ms_ssim": 0.98}
+	tests := map[string]struct {
+		aliases FieldAliases
+		want    metric
+	}{
+		"Built-in": {
+			want: metric{VMAF: 90, PSNR: 40, MS_SSIM: 0.98},
+		},
+		"Configured first": {
+			aliases: FieldAliases{"VMAF": {"vmaf_v2"}, "PSNR": {"psnr"}},
+			want:    metric{VMAF: 91, PSNR: 42, MS_SSIM: 0.98},
+		},
+		"Missing configured falls back to built-in": {
+			aliases: FieldAliases{"VMAF": {"vmaf_v3"}},
+			want:    metric{VMAF: 90, PSNR: 40, MS_SSIM: 0.98},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.aliases.metric(given)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("metric mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFrameMetrics_FromFfmpegVMAFWithAliases(t *testing.T) {
+	given := `{"version": "9.9.9", "frames": [{"frameNum": 0, "metrics": {"vmaf_v2": 80, "psnr_luma": 40}}]}`
+	want := FrameMetrics{{FrameNum: 0, VMAF: 80, PSNR: 40}}
+
+	var got FrameMetrics
+	aliases := FieldAliases{"VMAF": {"vmaf_v2"}, "PSNR": {"psnr_luma"}}
+	if err := got.FromFfmpegVMAFWithAliases(strings.NewReader(given), aliases); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FrameMetrics mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Exclusion of frames (e.g. intro or black frames) from aggregate metrics.
+
+package vqm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// lumaKey is ffmpeg signalstats metadata key of average luma.
+const lumaKey = "lavfi.signalstats.YAVG="
+
+// readLumaFile will read per frame average luma from ffmpeg metadata filter
+// output file.
+func readLumaFile(name string) ([]float64, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("readLumaFile() %w", err)
+	}
+	defer fd.Close()
+	return parseLumaStats(fd)
+}
+
+// parseLumaStats will parse ffmpeg metadata filter output, which for every
+// frame is a "frame:N ..." line followed by "key=value" lines, into per frame
+// average luma values.
+func parseLumaStats(r io.Reader) ([]float64, error) {
+	var luma []float64
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if !strings.HasPrefix(line, lumaKey) {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimPrefix(line, lumaKey), 64)
+		if err != nil {
+			return nil, fmt.Errorf("parseLumaStats() invalid luma in %q: %w", line, err)
+		}
+		luma = append(luma, v)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("parseLumaStats() %w", err)
+	}
+	return luma, nil
+}
+
+// excludedFrames returns which of total frames are excluded from aggregates:
+// leading and trailing frames and frames with luma below threshold (zero
+// threshold disables luma check). Frames without known luma are kept.
+func excludedFrames(total, leading, trailing int, luma []float64, threshold float64) []bool {
+	excluded := make([]bool, total)
+	for i := range excluded {
+		switch {
+		case i < leading, i >= total-trailing:
+			excluded[i] = true
+		case threshold > 0 && i < len(luma) && luma[i] < threshold:
+			excluded[i] = true
+		}
+	}
+	return excluded
+}
+
+// poolFrames will replace aggregate metrics in vqm with means of frames that
+// are not excluded and record number of excluded frames.
+func poolFrames(vqm *VideoQualityMetrics, frames []frame, excluded []bool) error {
+	var n int
+	var sum VideoQualityMetrics
+	for i := range frames {
+		if excluded[i] {
+			continue
+		}
+		m := &frames[i].Metrics
+		n++
+		sum.VMAF += m.VMAF
+		sum.PSNR += m.PSNR
+		sum.PSNR_CB += m.PSNR_CB
+		sum.PSNR_CR += m.PSNR_CR
+		sum.MS_SSIM += m.MS_SSIM
+	}
+	if n == 0 {
+		return errors.New("all frames excluded from aggregates")
+	}
+	vqm.VMAF = sum.VMAF / float64(n)
+	vqm.PSNR = sum.PSNR / float64(n)
+	vqm.PSNR_CB = sum.PSNR_CB / float64(n)
+	vqm.PSNR_CR = sum.PSNR_CR / float64(n)
+	vqm.MS_SSIM = sum.MS_SSIM / float64(n)
+	vqm.ExcludedFrames = len(frames) - n
+	return nil
+}
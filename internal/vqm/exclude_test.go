@@ -0,0 +1,138 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package vqm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func Test_parseLumaStats(t *testing.T) {
+	given := `frame:0    pts:0       pts_time:0
+lavfi.signalstats.YAVG=16.0
+frame:1    pts:512     pts_time:0.04
+lavfi.signalstats.YAVG=120.5
+`
+	got, err := parseLumaStats(strings.NewReader(given))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]float64{16, 120.5}, got); diff != "" {
+		t.Errorf("Luma mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("Should fail on invalid luma value", func(t *testing.T) {
+		if _, err := parseLumaStats(strings.NewReader("lavfi.signalstats.YAVG=abc\n")); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func Test_excludedFrames(t *testing.T) {
+	tests := map[string]struct {
+		leading, trailing int
+		luma              []float64
+		threshold         float64
+		want              []bool
+	}{
+		"Nothing excluded": {
+			want: []bool{false, false, false, false, false},
+		},
+		"Leading and trailing": {
+			leading:  2,
+			trailing: 1,
+			want:     []bool{true, true, false, false, true},
+		},
+		"Dark frames": {
+			luma:      []float64{16, 100, 17, 100, 100},
+			threshold: 20,
+			want:      []bool{true, false, true, false, false},
+		},
+		"Unknown luma is kept": {
+			luma:      []float64{16},
+			threshold: 20,
+			want:      []bool{true, false, false, false, false},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := excludedFrames(5, tc.leading, tc.trailing, tc.luma, tc.threshold)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Excluded frames mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFfmpegVMAF_unmarshalResultJSON_ExcludedFrames(t *testing.T) {
+	given := `{"frames": [
+		{"frameNum": 0, "metrics": {"vmaf": 10, "psnr_y": 20, "ms_ssim": 0.5}},
+		{"frameNum": 1, "metrics": {"vmaf": 90, "psnr_y": 40, "ms_ssim": 0.9}},
+		{"frameNum": 2, "metrics": {"vmaf": 80, "psnr_y": 42, "ms_ssim": 0.95}},
+		{"frameNum": 3, "metrics": {"vmaf": 20, "psnr_y": 25, "ms_ssim": 0.6}}],
+		"pooled_metrics": {"vmaf": {"mean": 50}, "psnr_y": {"mean": 31.75}, "ms_ssim": {"mean": 0.7375}}}`
+
+	t.Run("Leading and trailing frames", func(t *testing.T) {
+		want := VideoQualityMetrics{VMAF: 85, PSNR: 41, PSNRFromMSE: 40.885874, MS_SSIM: 0.925, ExcludedFrames: 2}
+		got, err := (&ffmpegVMAF{excludeLeading: 1, excludeTrailing: 1}).unmarshalResultJSON([]byte(given))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(want, got, cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+			t.Errorf("VideoQualityMetrics mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Dark frames", func(t *testing.T) {
+		want := VideoQualityMetrics{VMAF: 90, PSNR: 40, PSNRFromMSE: 40, MS_SSIM: 0.9, ExcludedFrames: 3}
+		f := &ffmpegVMAF{lumaThreshold: 20, luma: []float64{16, 100, 16, 16}}
+		got, err := f.unmarshalResultJSON([]byte(given))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(want, got, cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+			t.Errorf("VideoQualityMetrics mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Should fail when all frames excluded", func(t *testing.T) {
+		if _, err := (&ffmpegVMAF{excludeLeading: 4}).unmarshalResultJSON([]byte(given)); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func TestNewFfmpegVMAF_WithLumaThreshold(t *testing.T) {
+	tests := map[string]struct {
+		opts []FfmpegVMAFOption
+		want string
+	}{
+		"Without prefilter": {
+			opts: []FfmpegVMAFOption{WithLumaThreshold(20)},
+			want: "-lavfi [0:v]null[dis];[1:v]signalstats,metadata=mode=print:key=lavfi.signalstats.YAVG:file=result_luma.log[ref];[dis][ref]libvmaf=",
+		},
+		"With geometry": {
+			opts: []FfmpegVMAFOption{WithLumaThreshold(20), WithGeometry("scale=1920:1080")},
+			want: "-lavfi [0:v]scale=1920:1080[dis];[1:v]scale=1920:1080,signalstats,metadata=mode=print:key=lavfi.signalstats.YAVG:file=result_luma.log[ref];[dis][ref]libvmaf=",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json", tc.opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+			if !strings.Contains(args, tc.want) {
+				t.Errorf("ffmpeg args do not contain %q: %s", tc.want, args)
+			}
+		})
+	}
+}
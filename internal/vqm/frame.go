@@ -7,9 +7,15 @@
 package vqm
 
 import (
+	"bufio"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
 )
 
 // FrameMetric contains VQMs for a single frame.
@@ -17,6 +23,8 @@ type FrameMetric struct {
 	FrameNum uint
 	VMAF     float64
 	PSNR     float64
+	PSNR_CB  float64 `json:",omitempty"`
+	PSNR_CR  float64 `json:",omitempty"`
 	MS_SSIM  float64
 }
 
@@ -40,28 +48,247 @@ func (fm *FrameMetrics) Get() []FrameMetric {
 }
 
 // FromFfmpegVMAF will Unmarshal libvmaf's JSON into FrameMetrics.
+//
+// This is a thin wrapper around FromFfmpegVMAFStream.
 func (fm *FrameMetrics) FromFfmpegVMAF(jsonReader io.Reader) error {
-	b, err := io.ReadAll(jsonReader)
-	if err != nil {
-		return fmt.Errorf("FromFfmpegVMAF() reading: %w", err)
+	return fm.FromFfmpegVMAFStream(jsonReader)
+}
+
+// FromFfmpegVMAFWithAliases is the same as FromFfmpegVMAF, but metrics are
+// picked from libvmaf JSON according to given field aliases.
+func (fm *FrameMetrics) FromFfmpegVMAFWithAliases(jsonReader io.Reader, aliases FieldAliases) error {
+	return fm.decodeFfmpegVMAF(jsonReader, aliases)
+}
+
+// FromFfmpegVMAFStream will decode libvmaf's JSON into FrameMetrics.
+//
+// Unlike unmarshalling the whole document at once, "frames" array is decoded
+// element by element, so there is no need to hold entire libvmaf JSON in memory
+// which matters for long clips.
+func (fm *FrameMetrics) FromFfmpegVMAFStream(jsonReader io.Reader) error {
+	return fm.decodeFfmpegVMAF(jsonReader, nil)
+}
+
+// decodeFfmpegVMAF is streaming decoder behind FromFfmpegVMAFStream and
+// FromFfmpegVMAFWithAliases.
+func (fm *FrameMetrics) decodeFfmpegVMAF(jsonReader io.Reader, aliases FieldAliases) error {
+	dec := json.NewDecoder(jsonReader)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return fmt.Errorf("FromFfmpegVMAFStream() document start: %w", err)
 	}
-	res := &ffmpegVMAFResult{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("FromFfmpegVMAFStream() reading key: %w", err)
+		}
+		// Skip everything except frames array.
+		if key, _ := t.(string); key != "frames" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("FromFfmpegVMAFStream() skipping %v: %w", t, err)
+			}
+			continue
+		}
 
-	if err := json.Unmarshal(b, res); err != nil {
-		return fmt.Errorf("FromFfmpegVMAF() unmarshal JSON: %w", err)
+		if err := expectDelim(dec, '['); err != nil {
+			return fmt.Errorf("FromFfmpegVMAFStream() frames start: %w", err)
+		}
+		for dec.More() {
+			var v rawFrame
+			if err := dec.Decode(&v); err != nil {
+				return fmt.Errorf("FromFfmpegVMAFStream() decode frame: %w", err)
+			}
+			m := aliases.metric(v.Metrics)
+			*fm = append(*fm, FrameMetric{
+				FrameNum: v.FrameNum,
+				VMAF:     m.VMAF,
+				PSNR:     m.PSNR,
+				PSNR_CB:  m.PSNR_CB,
+				PSNR_CR:  m.PSNR_CR,
+				MS_SSIM:  m.MS_SSIM,
+			})
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return fmt.Errorf("FromFfmpegVMAFStream() frames end: %w", err)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return fmt.Errorf("FromFfmpegVMAFStream() document end: %w", err)
 	}
 
-	for _, v := range res.Frames {
-		*fm = append(*fm, FrameMetric{
-			FrameNum: v.FrameNum,
-			VMAF:     v.Metrics.VMAF,
-			PSNR:     v.Metrics.PSNR,
-			MS_SSIM:  v.Metrics.MS_SSIM,
-		})
+	return nil
+}
+
+// expectDelim is a helper to consume next JSON token and check it is expected delimiter.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %v, got %v", want, t)
 	}
 	return nil
 }
 
+// VMAFJitter returns mean absolute difference between consecutive per frame
+// VMAF values (see Jitter).
+func (fm *FrameMetrics) VMAFJitter() float64 {
+	values := make([]float64, len(*fm))
+	for i, v := range *fm {
+		values[i] = v.VMAF
+	}
+	return Jitter(values)
+}
+
+// Jitter returns mean absolute difference between consecutive values, this is
+// a measure of temporal (frame to frame) stability that aggregate stats miss:
+// encodes with the same mean can have very different frame to frame swings.
+// Zero is returned for less than two values.
+func Jitter(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	var sum float64
+	for i := 1; i < len(values); i++ {
+		sum += math.Abs(values[i] - values[i-1])
+	}
+	return sum / float64(len(values)-1)
+}
+
+// VMAFMeanCI returns 95% confidence interval of VMAF mean estimated by
+// bootstrapping per frame VMAF values (see BootstrapMeanCI).
+func (fm *FrameMetrics) VMAFMeanCI(resamples int, rng *rand.Rand) (lo, hi float64) {
+	values := make([]float64, len(*fm))
+	for i, v := range *fm {
+		values[i] = v.VMAF
+	}
+	return BootstrapMeanCI(values, resamples, rng)
+}
+
+// BootstrapMeanCI returns 95% confidence interval of values' mean using
+// percentile bootstrap: values are resampled with replacement given number of
+// times and 2.5th and 97.5th percentiles of resample means are returned. This
+// quantifies how much aggregate of a short clip can be trusted. Zeros are
+// returned for empty values or non-positive number of resamples.
+func BootstrapMeanCI(values []float64, resamples int, rng *rand.Rand) (lo, hi float64) {
+	n := len(values)
+	if n == 0 || resamples <= 0 {
+		return 0, 0
+	}
+	means := make([]float64, resamples)
+	for i := range means {
+		var sum float64
+		for j := 0; j < n; j++ {
+			sum += values[rng.Intn(n)]
+		}
+		means[i] = sum / float64(n)
+	}
+	sort.Float64s(means)
+	at := func(q float64) float64 {
+		return means[int(math.Round(q*float64(resamples-1)))]
+	}
+	return at(0.025), at(0.975)
+}
+
+// PooledPSNR returns PSNR pooled in MSE domain: per frame PSNR values are
+// converted to relative MSE, averaged and converted back to dB. Since PSNR is
+// logarithmic, arithmetic mean of per frame PSNR overestimates quality of
+// clips with uneven quality, this is what PSNR of whole clip is. Zero is
+// returned for no values.
+func PooledPSNR(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	// Peak signal value cancels out, so MSE is relative to it.
+	var sum float64
+	for _, v := range values {
+		sum += math.Pow(10, -v/10)
+	}
+	return -10 * math.Log10(sum/float64(len(values)))
+}
+
+// WindowedMinVMAF will calculate VMAF average over each sliding window of given
+// size (in frames) and return the worst (minimum) window average.
+//
+// Unlike per frame minimum this captures sustained quality degradation rather
+// than isolated bad frames. In case window is not positive or larger than
+// number of frames, average over all frames is returned.
+func (fm *FrameMetrics) WindowedMinVMAF(window int) float64 {
+	frames := *fm
+	if len(frames) == 0 {
+		return 0
+	}
+	if window <= 0 || window > len(frames) {
+		window = len(frames)
+	}
+
+	var sum float64
+	for _, v := range frames[:window] {
+		sum += v.VMAF
+	}
+	minSum := sum
+	for i := window; i < len(frames); i++ {
+		sum += frames[i].VMAF - frames[i-window].VMAF
+		if sum < minSum {
+			minSum = sum
+		}
+	}
+
+	return minSum / float64(window)
+}
+
+// SceneMetric contains aggregate VMAF of a single scene.
+type SceneMetric struct {
+	// Scene is scene number in temporal order, starting from 1
+	Scene int
+	// StartFrame and EndFrame are frame range of scene, EndFrame exclusive
+	StartFrame int
+	EndFrame   int
+	// VMAF is mean and MinVMAF is minimum of per frame VMAF within scene
+	VMAF    float64
+	MinVMAF float64
+}
+
+// SceneVMAF will split frames into scenes at given scene cut frame indices
+// and calculate aggregate VMAF of each scene.
+//
+// Cuts are frame indices of first frames of scenes (except the first scene),
+// they do not need to be sorted and cuts outside of frame range are ignored.
+func (fm *FrameMetrics) SceneVMAF(cuts []int) []SceneMetric {
+	frames := *fm
+	if len(frames) == 0 {
+		return nil
+	}
+	bounds := []int{0}
+	sorted := append([]int(nil), cuts...)
+	sort.Ints(sorted)
+	for _, c := range sorted {
+		if c > bounds[len(bounds)-1] && c < len(frames) {
+			bounds = append(bounds, c)
+		}
+	}
+	bounds = append(bounds, len(frames))
+
+	scenes := make([]SceneMetric, 0, len(bounds)-1)
+	for i := 1; i < len(bounds); i++ {
+		s := SceneMetric{Scene: i, StartFrame: bounds[i-1], EndFrame: bounds[i], MinVMAF: math.Inf(1)}
+		for _, v := range frames[s.StartFrame:s.EndFrame] {
+			s.VMAF += v.VMAF
+			s.MinVMAF = math.Min(s.MinVMAF, v.VMAF)
+		}
+		s.VMAF /= float64(s.EndFrame - s.StartFrame)
+		scenes = append(scenes, s)
+	}
+	return scenes
+}
+
+// RankScenes will sort scenes by mean VMAF, worst scene first.
+func RankScenes(scenes []SceneMetric) {
+	sort.SliceStable(scenes, func(i, j int) bool { return scenes[i].VMAF < scenes[j].VMAF })
+}
+
 func (fm *FrameMetrics) ToJSON(w io.Writer) error {
 	jDoc, err := json.MarshalIndent(fm, "", "  ")
 	if err != nil {
@@ -74,3 +301,60 @@ func (fm *FrameMetrics) ToJSON(w io.Writer) error {
 
 	return nil
 }
+
+// Precision is a number of decimal places metrics are formatted with,
+// negative means as many as needed to represent value exactly.
+type Precision struct {
+	VMAF    int
+	PSNR    int
+	MS_SSIM int
+}
+
+// FullPrecision formats metrics without rounding.
+var FullPrecision = Precision{VMAF: -1, PSNR: -1, MS_SSIM: -1}
+
+// ToCSV will write FrameMetrics as CSV with header row, one row per frame.
+// Metrics are formatted with given precision.
+func (fm *FrameMetrics) ToCSV(w io.Writer, p Precision) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"FrameNum", "VMAF", "PSNR", "PSNR_CB", "PSNR_CR", "MS_SSIM"}); err != nil {
+		return fmt.Errorf("ToCSV() write header: %w", err)
+	}
+	f := func(v float64, prec int) string {
+		return strconv.FormatFloat(v, 'f', prec, 64)
+	}
+	for _, v := range *fm {
+		row := []string{
+			strconv.FormatUint(uint64(v.FrameNum), 10),
+			f(v.VMAF, p.VMAF),
+			f(v.PSNR, p.PSNR),
+			f(v.PSNR_CB, p.PSNR),
+			f(v.PSNR_CR, p.PSNR),
+			f(v.MS_SSIM, p.MS_SSIM),
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("ToCSV() write row: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("ToCSV() flush: %w", err)
+	}
+	return nil
+}
+
+// ToJSONLines will write FrameMetrics as JSON Lines, one JSON document per
+// frame.
+func (fm *FrameMetrics) ToJSONLines(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, v := range *fm {
+		if err := enc.Encode(v); err != nil {
+			return fmt.Errorf("ToJSONLines() encode: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("ToJSONLines() write to Writer: %w", err)
+	}
+	return nil
+}
@@ -6,12 +6,16 @@ package vqm
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"log"
+	"math/rand"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 var (
@@ -62,6 +66,19 @@ func TestFrameMetrics_FromFfmpegVMAF(t *testing.T) {
 	})
 }
 
+func TestFrameMetrics_FromFfmpegVMAF_ChromaPSNR(t *testing.T) {
+	given := `{"frames": [{"frameNum": 0, "metrics": {"vmaf": 90, "psnr_y": 40, "psnr_cb": 45, "psnr_cr": 46}}]}`
+	want := FrameMetrics{{FrameNum: 0, VMAF: 90, PSNR: 40, PSNR_CB: 45, PSNR_CR: 46}}
+
+	var got FrameMetrics
+	if err := got.FromFfmpegVMAF(strings.NewReader(given)); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FrameMetrics mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestFrameMetrics_ToJSON(t *testing.T) {
 	// Check To/FromJSON round trip.
 	var (
@@ -94,6 +111,54 @@ func TestFrameMetrics_ToJSON(t *testing.T) {
 	})
 }
 
+func TestFrameMetrics_ToCSV(t *testing.T) {
+	given := FrameMetrics{
+		{FrameNum: 0, VMAF: 97.5, PSNR: 43.8, MS_SSIM: 0.99},
+		{FrameNum: 1, VMAF: 96, PSNR: 42.25, PSNR_CB: 45, PSNR_CR: 46.5, MS_SSIM: 0.985},
+	}
+	want := "FrameNum,VMAF,PSNR,PSNR_CB,PSNR_CR,MS_SSIM\n" +
+		"0,97.5,43.8,0,0,0.99\n" +
+		"1,96,42.25,45,46.5,0.985\n"
+
+	var got bytes.Buffer
+	if err := given.ToCSV(&got, FullPrecision); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got.String()); diff != "" {
+		t.Errorf("CSV mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("Rounded", func(t *testing.T) {
+		want := "FrameNum,VMAF,PSNR,PSNR_CB,PSNR_CR,MS_SSIM\n" +
+			"0,97.5,44,0,0,0.99\n" +
+			"1,96.0,42,45,46,0.98\n"
+		var got bytes.Buffer
+		if err := given.ToCSV(&got, Precision{VMAF: 1, PSNR: 0, MS_SSIM: 2}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(want, got.String()); diff != "" {
+			t.Errorf("CSV mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestFrameMetrics_ToJSONLines(t *testing.T) {
+	given := FrameMetrics{
+		{FrameNum: 0, VMAF: 97.5, PSNR: 43.8, MS_SSIM: 0.99},
+		{FrameNum: 1, VMAF: 96, PSNR: 42.25, PSNR_CB: 45, PSNR_CR: 46.5, MS_SSIM: 0.985},
+	}
+	want := `{"FrameNum":0,"VMAF":97.5,"PSNR":43.8,"MS_SSIM":0.99}` + "\n" +
+		`{"FrameNum":1,"VMAF":96,"PSNR":42.25,"PSNR_CB":45,"PSNR_CR":46.5,"MS_SSIM":0.985}` + "\n"
+
+	var got bytes.Buffer
+	if err := given.ToJSONLines(&got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got.String()); diff != "" {
+		t.Errorf("JSON Lines mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestFrameMetrics_FromJSON(t *testing.T) {
 	t.Run("Should Unmarshal from valid JSON into FrameMetrics", func(t *testing.T) {
 		var fm FrameMetrics
@@ -123,3 +188,224 @@ func TestFrameMetrics_FromJSON(t *testing.T) {
 		}
 	})
 }
+
+func TestFrameMetrics_FromFfmpegVMAF_Negative(t *testing.T) {
+	tests := map[string]string{
+		"Empty":            "",
+		"Not an object":    "[]",
+		"Frames not array": `{"frames": {}}`,
+		"Truncated":        `{"version": "2.3.0", "frames": [{"frameNum": 0}`,
+	}
+
+	for name, given := range tests {
+		t.Run(name, func(t *testing.T) {
+			var fm FrameMetrics
+			if err := fm.FromFfmpegVMAF(strings.NewReader(given)); err == nil {
+				t.Error("Expecting error, got <nil>")
+			}
+		})
+	}
+}
+
+func TestFrameMetrics_WindowedMinVMAF(t *testing.T) {
+	given := FrameMetrics{
+		{FrameNum: 0, VMAF: 90},
+		{FrameNum: 1, VMAF: 10},
+		{FrameNum: 2, VMAF: 90},
+		{FrameNum: 3, VMAF: 90},
+		{FrameNum: 4, VMAF: 40},
+		{FrameNum: 5, VMAF: 40},
+		{FrameNum: 6, VMAF: 40},
+	}
+	tests := map[string]struct {
+		window int
+		want   float64
+	}{
+		"Single frame window is per frame min":   {window: 1, want: 10},
+		"Sustained dip outweighs isolated frame": {window: 3, want: 40},
+		"Window larger than frame count":         {window: 10, want: 400.0 / 7},
+		"Zero window":                            {window: 0, want: 400.0 / 7},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := given.WindowedMinVMAF(tc.window)
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("WindowedMinVMAF() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFrameMetrics_SceneVMAF(t *testing.T) {
+	given := FrameMetrics{
+		{FrameNum: 0, VMAF: 90},
+		{FrameNum: 1, VMAF: 80},
+		{FrameNum: 2, VMAF: 40},
+		{FrameNum: 3, VMAF: 60},
+		{FrameNum: 4, VMAF: 95},
+	}
+	tests := map[string]struct {
+		cuts []int
+		want []SceneMetric
+	}{
+		"No cuts": {
+			want: []SceneMetric{{Scene: 1, StartFrame: 0, EndFrame: 5, VMAF: 73, MinVMAF: 40}},
+		},
+		"Unsorted cuts": {
+			cuts: []int{4, 2},
+			want: []SceneMetric{
+				{Scene: 1, StartFrame: 0, EndFrame: 2, VMAF: 85, MinVMAF: 80},
+				{Scene: 2, StartFrame: 2, EndFrame: 4, VMAF: 50, MinVMAF: 40},
+				{Scene: 3, StartFrame: 4, EndFrame: 5, VMAF: 95, MinVMAF: 95},
+			},
+		},
+		"Out of range and duplicate cuts ignored": {
+			cuts: []int{0, 2, 2, 5, 10},
+			want: []SceneMetric{
+				{Scene: 1, StartFrame: 0, EndFrame: 2, VMAF: 85, MinVMAF: 80},
+				{Scene: 2, StartFrame: 2, EndFrame: 5, VMAF: 65, MinVMAF: 40},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := given.SceneVMAF(tc.cuts)
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("SceneVMAF() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRankScenes(t *testing.T) {
+	given := []SceneMetric{{Scene: 1, VMAF: 85}, {Scene: 2, VMAF: 50}, {Scene: 3, VMAF: 95}}
+	want := []SceneMetric{{Scene: 2, VMAF: 50}, {Scene: 1, VMAF: 85}, {Scene: 3, VMAF: 95}}
+	RankScenes(given)
+	if diff := cmp.Diff(want, given); diff != "" {
+		t.Errorf("RankScenes() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func BenchmarkFrameMetrics_FromFfmpegVMAFStream(b *testing.B) {
+	given, err := os.ReadFile(metricsFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var fm FrameMetrics
+		if err := fm.FromFfmpegVMAFStream(bytes.NewReader(given)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFrameMetrics_UnmarshalWhole serves as a baseline for streaming
+// decoder: whole document is read into memory and unmarshalled at once.
+func BenchmarkFrameMetrics_UnmarshalWhole(b *testing.B) {
+	given, err := os.ReadFile(metricsFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, err := io.ReadAll(bytes.NewReader(given))
+		if err != nil {
+			b.Fatal(err)
+		}
+		res := &ffmpegVMAFResult{}
+		if err := json.Unmarshal(data, res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := map[string]struct {
+		given []float64
+		want  float64
+	}{
+		"Empty":        {given: nil, want: 0},
+		"Single value": {given: []float64{90}, want: 0},
+		"Constant":     {given: []float64{90, 90, 90}, want: 0},
+		"Swings":       {given: []float64{90, 80, 90, 95}, want: 25.0 / 3},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := Jitter(tc.given)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Jitter() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFrameMetrics_VMAFJitter(t *testing.T) {
+	given := FrameMetrics{
+		{FrameNum: 0, VMAF: 90},
+		{FrameNum: 1, VMAF: 10},
+		{FrameNum: 2, VMAF: 90},
+	}
+	if diff := cmp.Diff(80.0, given.VMAFJitter()); diff != "" {
+		t.Errorf("VMAFJitter() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBootstrapMeanCI(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	lo, hi := BootstrapMeanCI(nil, 100, rng)
+	if lo != 0 || hi != 0 {
+		t.Errorf("Expected zero interval for no values, got %v..%v", lo, hi)
+	}
+
+	lo, hi = BootstrapMeanCI([]float64{95, 95, 95}, 100, rng)
+	if diff := cmp.Diff([]float64{95, 95}, []float64{lo, hi}); diff != "" {
+		t.Errorf("Constant values interval mismatch (-want +got):\n%s", diff)
+	}
+
+	values := make([]float64, 100)
+	for i := range values {
+		values[i] = 80 + float64(i%20)
+	}
+	// Mean is 89.5
+	lo, hi = BootstrapMeanCI(values, 1000, rng)
+	if !(lo < 89.5 && 89.5 < hi) {
+		t.Errorf("Expected interval to contain mean 89.5, got %v..%v", lo, hi)
+	}
+	if hi-lo > 5 {
+		t.Errorf("Interval too wide: %v..%v", lo, hi)
+	}
+}
+
+func TestFrameMetrics_VMAFMeanCI(t *testing.T) {
+	given := FrameMetrics{{VMAF: 90}, {VMAF: 90}}
+	lo, hi := given.VMAFMeanCI(10, rand.New(rand.NewSource(1)))
+	if diff := cmp.Diff([]float64{90, 90}, []float64{lo, hi}); diff != "" {
+		t.Errorf("VMAFMeanCI() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPooledPSNR(t *testing.T) {
+	tests := map[string]struct {
+		given []float64
+		want  float64
+	}{
+		"Empty":    {want: 0},
+		"Constant": {given: []float64{40, 40, 40}, want: 40},
+		// MSE of 20 dB frame dominates: -10*log10((0.01+0.0001)/2)
+		"Uneven": {given: []float64{20, 40}, want: 22.967086},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := PooledPSNR(tc.given)
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+				t.Errorf("PooledPSNR() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// VQM measurement progress reporting based on ffmpeg output.
+
+package vqm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+var (
+	progressFrameRe = regexp.MustCompile(`frame=\s*(\d+)`)
+	progressTimeRe  = regexp.MustCompile(`time=\s*(\S+)`)
+)
+
+// progressWriter is an io.Writer that parses ffmpeg progress lines (e.g.
+// "frame= 120 fps= 30 ... time=00:00:04.00 ...") and renders progress
+// indicator into w.
+//
+// ffmpeg separates progress updates with carriage return, so incomplete
+// lines are buffered until terminated.
+type progressWriter struct {
+	w io.Writer
+	// Total number of frames, 0 when unknown
+	total int
+	line  []byte
+}
+
+// Write implements io.Writer for *progressWriter.
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.line = append(p.line, b...)
+	for {
+		i := bytes.IndexAny(p.line, "\r\n")
+		if i < 0 {
+			break
+		}
+		p.render(p.line[:i])
+		p.line = p.line[i+1:]
+	}
+	return len(b), nil
+}
+
+// render writes progress indicator for single ffmpeg output line, lines that
+// are not progress lines are ignored.
+func (p *progressWriter) render(line []byte) {
+	m := progressFrameRe.FindSubmatch(line)
+	if m == nil {
+		return
+	}
+	frame, err := strconv.Atoi(string(m[1]))
+	if err != nil {
+		return
+	}
+	var ts string
+	if t := progressTimeRe.FindSubmatch(line); t != nil {
+		ts = string(t[1])
+	}
+	if p.total > 0 {
+		fmt.Fprintf(p.w, "\rVQM progress: %d/%d frames (%.0f%%) time=%s",
+			frame, p.total, 100*float64(frame)/float64(p.total), ts)
+		return
+	}
+	fmt.Fprintf(p.w, "\rVQM progress: %d frames time=%s", frame, ts)
+}
@@ -0,0 +1,62 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package vqm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProgressWriter(t *testing.T) {
+	tests := map[string]struct {
+		givenTotal  int
+		givenWrites []string
+		want        string
+	}{
+		"Known total": {
+			givenTotal:  200,
+			givenWrites: []string{"frame=   50 fps= 25 q=-0.0 size=N/A time=00:00:02.00 bitrate=N/A\r"},
+			want:        "\rVQM progress: 50/200 frames (25%) time=00:00:02.00",
+		},
+		"Unknown total": {
+			givenTotal:  0,
+			givenWrites: []string{"frame=   50 fps= 25 q=-0.0 size=N/A time=00:00:02.00 bitrate=N/A\r"},
+			want:        "\rVQM progress: 50 frames time=00:00:02.00",
+		},
+		"Line split across writes": {
+			givenTotal:  100,
+			givenWrites: []string{"fra", "me=  10 fps=5 time=00:00:00.40", "\r"},
+			want:        "\rVQM progress: 10/100 frames (10%) time=00:00:00.40",
+		},
+		"Non progress lines ignored": {
+			givenTotal:  100,
+			givenWrites: []string{"Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'a.mp4':\n", "[Parsed_libvmaf_0 @ 0x1] VMAF score: 95.1\n"},
+			want:        "",
+		},
+		"Incomplete line not rendered": {
+			givenTotal:  100,
+			givenWrites: []string{"frame=  10 fps=5 time=00:00:00.40"},
+			want:        "",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out strings.Builder
+			p := &progressWriter{w: &out, total: tc.givenTotal}
+			for _, w := range tc.givenWrites {
+				n, err := p.Write([]byte(w))
+				if err != nil || n != len(w) {
+					t.Fatalf("Unexpected Write() result: n=%d err=%v", n, err)
+				}
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("Progress output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Secondary (non libvmaf) PSNR and SSIM measurement via ffmpeg psnr and ssim
+// filters.
+
+package vqm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/tools"
+)
+
+// maxPSNR is PSNR value reported for identical frames (infinite PSNR), same as
+// libvmaf's cap for 8-bit content.
+const maxPSNR = 60
+
+// MeasurePSNRSSIM will calculate per frame luma PSNR and SSIM of compressed
+// file against source file in a dedicated ffmpeg pass using psnr and ssim
+// filters (no libvmaf), e.g. for metrics libvmaf was not asked to compute.
+//
+// Optional geometry is ffmpeg filter chain applied to both inputs before
+// comparison (same as WithGeometry).
+func MeasurePSNRSSIM(compressedFile, sourceFile, geometry string) (psnr, ssim []float64, err error) {
+	ffmpegPath, err := tools.FfmpegPath()
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpDir, err := os.MkdirTemp("", "ease-psnr-ssim-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("MeasurePSNRSSIM() %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	psnrFile := filepath.Join(tmpDir, "psnr.log")
+	ssimFile := filepath.Join(tmpDir, "ssim.log")
+
+	prefilter := "null"
+	if geometry != "" {
+		prefilter = geometry
+	}
+	lavfi := fmt.Sprintf("[0:v]%[1]s,split[dis1][dis2];[1:v]%[1]s,split[ref1][ref2];"+
+		"[dis1][ref1]psnr=stats_file=%[2]s;[dis2][ref2]ssim=stats_file=%[3]s",
+		prefilter, psnrFile, ssimFile)
+	ffmpegArgs := []string{
+		"-hide_banner",
+		"-i", compressedFile,
+		"-i", sourceFile,
+		"-lavfi", lavfi,
+		"-f", "null",
+		"-",
+	}
+	cmd := exec.Command(ffmpegPath, ffmpegArgs...) //#nosec G204
+	logging.Debugf("Running: %s\n", cmd)
+	release := tools.AcquireProcess()
+	out, err := cmd.CombinedOutput()
+	release()
+	if err != nil {
+		return nil, nil, fmt.Errorf("MeasurePSNRSSIM() exec: %w: %s", err, out)
+	}
+
+	if psnr, err = readStatsFile(psnrFile, "psnr_y"); err != nil {
+		return nil, nil, fmt.Errorf("MeasurePSNRSSIM() %w", err)
+	}
+	if ssim, err = readStatsFile(ssimFile, "Y"); err != nil {
+		return nil, nil, fmt.Errorf("MeasurePSNRSSIM() %w", err)
+	}
+	for i := range psnr {
+		if math.IsInf(psnr[i], 1) {
+			psnr[i] = maxPSNR
+		}
+	}
+	return psnr, ssim, nil
+}
+
+// readStatsFile will read values of given key from ffmpeg psnr or ssim filter
+// stats file.
+func readStatsFile(name, key string) ([]float64, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("readStatsFile() %w", err)
+	}
+	defer fd.Close()
+	return parseStats(fd, key)
+}
+
+// parseStats will parse ffmpeg psnr or ssim filter stats, which for every frame
+// is a line of space separated "key:value" pairs, into per frame values of
+// given key.
+func parseStats(r io.Reader, key string) ([]float64, error) {
+	var values []float64
+	prefix := key + ":"
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		found := false
+		for _, field := range strings.Fields(line) {
+			if !strings.HasPrefix(field, prefix) {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimPrefix(field, prefix), 64)
+			if err != nil {
+				return nil, fmt.Errorf("parseStats() invalid %s in %q: %w", key, line, err)
+			}
+			values = append(values, v)
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("parseStats() no %s in %q", key, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("parseStats() %w", err)
+	}
+	return values, nil
+}
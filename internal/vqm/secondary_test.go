@@ -0,0 +1,52 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package vqm
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseStats(t *testing.T) {
+	psnrStats := `n:1 mse_avg:0.47 mse_y:0.52 mse_u:0.38 mse_v:0.36 psnr_avg:51.39 psnr_y:50.97 psnr_u:52.30 psnr_v:52.55
+n:2 mse_avg:0.00 mse_y:0.00 mse_u:0.00 mse_v:0.00 psnr_avg:inf psnr_y:inf psnr_u:inf psnr_v:inf
+`
+	ssimStats := `n:1 Y:0.995012 U:0.993218 V:0.992965 All:0.994339 (22.471349)
+n:2 Y:1.000000 U:1.000000 V:1.000000 All:1.000000 (inf)
+`
+	tests := map[string]struct {
+		given   string
+		key     string
+		want    []float64
+		wantErr bool
+	}{
+		"PSNR":           {given: psnrStats, key: "psnr_y", want: []float64{50.97, math.Inf(1)}},
+		"SSIM":           {given: ssimStats, key: "Y", want: []float64{0.995012, 1}},
+		"Empty":          {given: "", key: "Y"},
+		"Missing key":    {given: ssimStats, key: "psnr_y", wantErr: true},
+		"Invalid number": {given: "n:1 Y:abc\n", key: "Y", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseStats(strings.NewReader(tc.given), tc.key)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Values mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -8,16 +8,28 @@
 package vqm
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/tools"
+	"github.com/evolution-gaming/ease/internal/video"
 	"github.com/google/shlex"
 )
 
@@ -26,77 +38,620 @@ import (
 type Measurer interface {
 	// Measure should run actual VQM measuring process
 	Measure() error
+	// MeasureContext should run actual VQM measuring process, process should
+	// be terminated when ctx is done
+	MeasureContext(ctx context.Context) error
 	// GetResult will retrieve VQM measurement Result
 	GetResult() (Result, error)
 }
 
+// Resumer is implemented by Measurer capable of reusing result file of an
+// earlier (e.g. interrupted run's) measurement instead of measuring again.
+type Resumer interface {
+	// Resume should load existing result file in place of Measure, error
+	// means result is missing or stale and measurement is needed
+	Resume() error
+}
+
 // Result represents Measurer tool execution result.
 type Result struct {
 	SourceFile     string
 	CompressedFile string
 	ResultFile     string
 	Metrics        VideoQualityMetrics
+	// SourceColor and CompressedColor are color characteristics of inputs,
+	// only set when inputs' metadata is known (see WithMetadata)
+	SourceColor     *video.Color `json:",omitempty"`
+	CompressedColor *video.Color `json:",omitempty"`
+	// FrameRateConversion is ffmpeg fps filter compressed video was
+	// resampled with to source frame rate before comparison, only set when
+	// frame rates differ
+	FrameRateConversion string `json:",omitempty"`
+	// Upscale is ffmpeg scale filter compressed video was upscaled with to
+	// source resolution before comparison (see WithUpscale), scores depend
+	// on scaler used
+	Upscale string `json:",omitempty"`
+	// FieldAliases are libvmaf JSON keys configured for metrics (see
+	// LibvmafOptions), needed to read per frame metrics from ResultFile
+	FieldAliases FieldAliases `json:",omitempty"`
 }
 
 // VideoQualityMetrics is a struct of meaningful Video Quality Metrics.
 type VideoQualityMetrics struct {
-	PSNR    float64
+	// PSNR is luma (Y) PSNR
+	PSNR float64
+	// PSNRFromMSE is luma PSNR pooled from mean MSE across frames (see
+	// PooledPSNR), statistically correct alternative to PSNR which is pooled
+	// from per frame PSNR values
+	PSNRFromMSE float64 `json:",omitempty"`
+	// PSNR_CB and PSNR_CR are chroma PSNRs, only set when reported by libvmaf
+	PSNR_CB float64 `json:",omitempty"`
+	PSNR_CR float64 `json:",omitempty"`
 	MS_SSIM float64
 	VMAF    float64
+	// VMAFWindowedMin is the worst VMAF average over sliding window of frames
+	// (see FrameMetrics.WindowedMinVMAF), only set when requested.
+	VMAFWindowedMin float64 `json:",omitempty"`
+	// VMAFJitter is mean absolute difference between consecutive per frame
+	// VMAF values (see FrameMetrics.VMAFJitter), lower is more stable.
+	VMAFJitter float64 `json:",omitempty"`
+	// VMAFMeanCILow and VMAFMeanCIHigh are bounds of 95% confidence
+	// interval of VMAF mean estimated by bootstrapping per frame VMAF, only
+	// set when requested.
+	VMAFMeanCILow  float64 `json:",omitempty"`
+	VMAFMeanCIHigh float64 `json:",omitempty"`
+	// VMAFReverse is VMAF measured with reference and distorted videos
+	// swapped, only set when requested (diagnostics).
+	VMAFReverse float64 `json:",omitempty"`
+	// SampledFrames are per frame VMAF scores, only set when measuring
+	// explicitly selected frames (see WithFrames).
+	SampledFrames []SampledFrame `json:",omitempty"`
+	// ExcludedFrames is number of frames excluded from aggregate metrics
+	// (see WithExcludedFrames and WithLumaThreshold).
+	ExcludedFrames int `json:",omitempty"`
+	// IdenticalInputs is set when compressed and source files are the same
+	// file or have identical content (e.g. pass-through scheme), so metrics
+	// are trivially perfect and meaningless.
+	IdenticalInputs bool `json:",omitempty"`
+	// Absent lists metrics (VMAF, PSNR, MS_SSIM) libvmaf did not report (e.g.
+	// PSNR and MS-SSIM on CUDA path), their zero values are not measurements.
+	Absent []string `json:",omitempty"`
 }
 
-// NewFfmpegVMAF will initialize VQM Measurer based on ffmpeg and libvmaf.
-func NewFfmpegVMAF(exePath, modelPath, compressedFile, sourceFile, resultFile string) (Measurer, error) {
-	var vqt *ffmpegVMAF
+// IsAbsent reports whether metric (VMAF, PSNR or MS_SSIM) was not measured.
+func (m VideoQualityMetrics) IsAbsent(metric string) bool {
+	for _, a := range m.Absent {
+		if a == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// SampledFrame is VMAF score of a single explicitly selected frame.
+type SampledFrame struct {
+	// Index is a frame number in source (0 based)
+	Index int
+	VMAF  float64
+}
+
+// VMAFAsymmetry returns absolute difference between VMAF and reverse VMAF.
+//
+// For correct setup (no scaling, cropping or alignment issues) this should be
+// near zero.
+func (m VideoQualityMetrics) VMAFAsymmetry() float64 {
+	return math.Abs(m.VMAF - m.VMAFReverse)
+}
+
+// libvmafModelPresets maps model preset names to libvmaf built-in model
+// definitions (a value for libvmaf "model" option). Note that ":" has to be
+// escaped for ffmpeg filtergraph.
+var libvmafModelPresets = map[string]string{
+	"phone": `version=vmaf_v0.6.1\\:enable_transform=true`,
+	"4k":    "version=vmaf_4k_v0.6.1",
+}
+
+// IsModelPreset reports whether name is a known libvmaf model preset.
+func IsModelPreset(name string) bool {
+	_, ok := libvmafModelPresets[name]
+	return ok
+}
+
+// FfmpegVMAFOption configures optional ffmpeg/libvmaf Measurer parameters.
+type FfmpegVMAFOption func(*ffmpegVMAF)
+
+// WithFrameCountTolerance enables check that compressed and source videos
+// have the same number of frames before VQMs are measured.
+//
+// Differences up to tolerance frames are allowed (with a warning), e.g. for
+// workflows that add a fade or trim a black frame. Negative tolerance disables
+// the check which is the default.
+func WithFrameCountTolerance(tolerance int) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.frameCountTolerance = tolerance
+	}
+}
+
+// WithGeometry applies ffmpeg filter chain (e.g. "crop=1920:800,scale=1920:1080")
+// to both compressed and source videos before VMAF comparison, so that frames
+// are aligned geometrically. Empty filter chain is ignored.
+func WithGeometry(filter string) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.geometry = filter
+	}
+}
+
+// upscaleMethods are ffmpeg scaler algorithms (scale filter flags) accepted by
+// WithUpscale.
+var upscaleMethods = []string{
+	"fast_bilinear", "bilinear", "bicubic", "neighbor", "area", "bicublin",
+	"gauss", "sinc", "lanczos", "spline",
+}
+
+// IsUpscaleMethod reports whether method is a known ffmpeg scaler algorithm.
+func IsUpscaleMethod(method string) bool {
+	for _, m := range upscaleMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// WithUpscale upscales compressed video to source resolution with given ffmpeg
+// scaler (e.g. "bicubic") before comparison, so that lower resolution encodes
+// (e.g. ABR ladder rungs) are scored as viewers see them. Upscale is applied
+// before geometry transform. Empty method is ignored.
+func WithUpscale(method string) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.upscaleMethod = method
+	}
+}
+
+// WithNice runs ffmpeg measurement process with given niceness (-20..19)
+// relative to ease process, e.g. lower priority (positive value) keeps VQM
+// measurement from starving encodes running at the same time. Zero keeps
+// priority of ease process.
+func WithNice(nice int) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.nice = nice
+	}
+}
+
+// WithNoAutorotate disables ffmpeg's automatic rotation of inputs according to
+// their rotation metadata, so both compressed and source videos are compared
+// in stored orientation. This is needed when encoder ignored source's rotation
+// metadata (e.g. non-ffmpeg encoders).
+func WithNoAutorotate() FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.noAutorotate = true
+	}
+}
+
+// WithSourceInputArgs sets ffmpeg input-side arguments of source (reference)
+// video, e.g. format, size and pixel format of raw video (see
+// encoding.PlanConfig.InputArgsFor). Arguments are used for probing source as
+// well.
+func WithSourceInputArgs(args []string) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.sourceInputArgs = args
+	}
+}
+
+// WithCUDA requests CUDA accelerated libvmaf (libvmaf_cuda filter), inputs
+// are decoded and compared on GPU, which is much faster for long content.
+// Measurement falls back to CPU when ffmpeg lacks CUDA support, CPU filters
+// are needed (frame selection, geometry, upscale, frame rate conversion or
+// luma threshold) or GPU measurement fails (e.g. no CUDA device), used path is
+// logged.
+//
+// Note that default PSNR and MS-SSIM features have no CUDA implementation, so
+// only VMAF is reported on GPU path unless features are given explicitly,
+// metrics not measured are listed in VideoQualityMetrics.Absent.
+func WithCUDA() FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.cuda = true
+	}
+}
+
+// WithFeatures replaces default libvmaf features (PSNR and MS-SSIM) with
+// given features, e.g. "cambi" for HDR content. Empty list is ignored.
+//
+// Note that only metrics of computed features are reported, e.g. MS_SSIM is
+// zero unless "float_ms_ssim" feature is given.
+func WithFeatures(features []string) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.features = features
+	}
+}
+
+// WithProgress enables rendering of measurement progress into w, progress is
+// parsed from ffmpeg output against compressed file's frame count.
+func WithProgress(w io.Writer) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.progress = w
+	}
+}
+
+// WithMetadata provides already known compressed and source video metadata
+// (e.g. probed during encoding), so that frame rate comparison, frame count
+// check and progress do not probe videos again.
+func WithMetadata(compressed, source video.Metadata) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.compressedMeta, f.sourceMeta = &compressed, &source
+	}
+}
+
+// WithFrames limits measurement to explicitly selected frames (0 based frame
+// indices), e.g. known hard frames. Frames are selected from both compressed
+// and source videos and per frame VMAF scores are reported in
+// VideoQualityMetrics.SampledFrames. Empty list is ignored.
+func WithFrames(indices []int) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.frames = uniqueSorted(indices)
+	}
+}
+
+// WithExcludedFrames excludes given number of leading and trailing frames
+// (e.g. intro or slate) from aggregate metrics, excluded frames are still kept
+// in per frame result file.
+func WithExcludedFrames(leading, trailing int) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.excludeLeading, f.excludeTrailing = leading, trailing
+	}
+}
+
+// WithLumaThreshold excludes frames with source average luma (8-bit scale,
+// 0..255) below threshold (e.g. black frames) from aggregate metrics, excluded
+// frames are still kept in per frame result file. Luma is measured during VQM
+// measurement via ffmpeg signalstats filter. Zero threshold is ignored.
+func WithLumaThreshold(threshold float64) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.lumaThreshold = threshold
+	}
+}
+
+// Pooling methods of per frame scores, see LibvmafOptions.
+const (
+	PoolMean         = "mean"
+	PoolHarmonicMean = "harmonic_mean"
+	PoolMin          = "min"
+)
+
+// LibvmafOptions are libvmaf filter options. Defaults differ between libvmaf
+// versions, so pinning them keeps VQMs reproducible. Zero values keep ease
+// defaults.
+type LibvmafOptions struct {
+	// Pool is pooling method of per frame scores into aggregate metrics:
+	// mean (default), harmonic_mean or min.
+	Pool string `json:",omitempty"`
+	// NSubsample computes scores only for every n-th frame, 0 means every
+	// frame.
+	NSubsample int `json:",omitempty"`
+	// Shortest ends measurement with the shortest input.
+	Shortest bool `json:",omitempty"`
+	// TSSyncMode is timestamp synchronization mode of inputs: default or
+	// nearest.
+	TSSyncMode string `json:",omitempty"`
+	// MaxThreads caps libvmaf n_threads, which is otherwise number of CPUs.
+	// Too many threads are also bad: on 128 threaded AMD EPYC ffmpeg was
+	// deadlocking at some point during VMAF calculations, hence the default
+	// cap of 32 threads. On other hardware it can be raised for faster VMAF.
+	// 0 means LIBVMAF_MAX_THREADS environment variable or the default.
+	MaxThreads int `json:",omitempty"`
+	// FieldAliases are additional libvmaf JSON keys accepted for metrics, so
+	// that renamed fields of newer libvmaf can be read without waiting for
+	// a new release.
+	FieldAliases FieldAliases `json:",omitempty"`
+}
+
+const (
+	// defaultMaxThreads is default cap of libvmaf n_threads (see
+	// LibvmafOptions.MaxThreads).
+	defaultMaxThreads = 32
+	// maxThreadsEnv is environment variable overriding default cap of libvmaf
+	// n_threads.
+	maxThreadsEnv = "LIBVMAF_MAX_THREADS"
+)
+
+// maxThreads returns cap of libvmaf n_threads: MaxThreads if set, otherwise
+// value of LIBVMAF_MAX_THREADS environment variable if valid, otherwise the
+// default.
+func (o *LibvmafOptions) maxThreads() int {
+	if o.MaxThreads > 0 {
+		return o.MaxThreads
+	}
+	if v := os.Getenv(maxThreadsEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+		logging.Infof("Invalid %s value %q ignored, using default %d", maxThreadsEnv, v, defaultMaxThreads)
+	}
+	return defaultMaxThreads
+}
+
+// nThreads returns number of libvmaf threads for given number of CPUs and
+// cap, capped is set when cap is applied.
+func nThreads(numCPU, max int) (n int, capped bool) {
+	if numCPU > max {
+		return max, true
+	}
+	return numCPU, false
+}
+
+// Validate checks LibvmafOptions values.
+func (o *LibvmafOptions) Validate() error {
+	switch o.Pool {
+	case "", PoolMean, PoolHarmonicMean, PoolMin:
+	default:
+		return fmt.Errorf("invalid pool %q", o.Pool)
+	}
+	if o.NSubsample < 0 {
+		return fmt.Errorf("negative n_subsample %d", o.NSubsample)
+	}
+	if o.MaxThreads < 0 {
+		return fmt.Errorf("negative max threads %d", o.MaxThreads)
+	}
+	if err := o.FieldAliases.Validate(); err != nil {
+		return err
+	}
+	switch o.TSSyncMode {
+	case "", "default", "nearest":
+	default:
+		return fmt.Errorf("invalid ts_sync_mode %q", o.TSSyncMode)
+	}
+	return nil
+}
+
+// filterOptions renders options as libvmaf filter options, n_subsample is
+// always set since libvmaf default differs between versions.
+func (o *LibvmafOptions) filterOptions() string {
+	n := o.NSubsample
+	if n == 0 {
+		n = 1
+	}
+	opts := []string{fmt.Sprintf("n_subsample=%d", n)}
+	if o.Pool != "" {
+		opts = append(opts, "pool="+o.Pool)
+	}
+	if o.Shortest {
+		opts = append(opts, "shortest=1")
+	}
+	if o.TSSyncMode != "" {
+		opts = append(opts, "ts_sync_mode="+o.TSSyncMode)
+	}
+	return strings.Join(opts, ":")
+}
+
+// WithLibvmafOptions sets libvmaf filter options, aggregate metrics are
+// pooled according to LibvmafOptions.Pool.
+func WithLibvmafOptions(o LibvmafOptions) FfmpegVMAFOption {
+	return func(f *ffmpegVMAF) {
+		f.libvmafOptions = o
+	}
+}
+
+// uniqueSorted returns sorted copy of values with duplicates removed.
+func uniqueSorted(values []int) []int {
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	res := sorted[:1]
+	for _, v := range sorted[1:] {
+		if v != res[len(res)-1] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// selectFilter returns ffmpeg select filter for given frame indices. Commas
+// are escaped for filtergraph (and once more for shlex).
+func selectFilter(frames []int) string {
+	exprs := make([]string, len(frames))
+	for i, n := range frames {
+		exprs[i] = fmt.Sprintf(`eq(n\\,%d)`, n)
+	}
+	return "select=" + strings.Join(exprs, "+")
+}
+
+// filterValueEscaper escapes filter option value (first level, see "Quoting
+// and escaping" in ffmpeg-filters(1)), filtergraphEscaper escapes the result
+// once more for filtergraph description (second level).
+var (
+	filterValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	filtergraphEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`)
+)
+
+// filterPath returns path escaped to be used as filter option value in
+// filtergraph and quoted for shlex, so that paths with spaces, colons, quotes
+// etc. are passed to filter as is.
+func filterPath(path string) string {
+	return shlexQuote(filtergraphEscaper.Replace(filterValueEscaper.Replace(path)))
+}
+
+// shlexQuote will single quote s, so that shlex.Split yields s as is. Single
+// quotes in s are closed, double quoted and reopened.
+func shlexQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
 
-	// Too much CPU threads are also bad. This was an issue on 128 threaded AMD
-	// EPYC, ffmpeg was deadlocking at some point during VMAF calculations.
-	nThreads := 32
+// featureNameRe matches valid libvmaf feature name.
+var featureNameRe = regexp.MustCompile(`^\w+$`)
+
+// IsFeatureName reports whether name is a valid libvmaf feature name, which
+// is safe to inject into libvmaf filter options.
+func IsFeatureName(name string) bool {
+	return featureNameRe.MatchString(name)
+}
 
-	if runtime.NumCPU() < nThreads {
-		nThreads = runtime.NumCPU()
+// NewFfmpegVMAF will initialize VQM Measurer based on ffmpeg and libvmaf.
+//
+// The modelPath is either a libvmaf model preset name (see IsModelPreset) or a
+// path to libvmaf model file.
+func NewFfmpegVMAF(exePath, modelPath, compressedFile, sourceFile, resultFile string, opts ...FfmpegVMAFOption) (Measurer, error) {
+	vqt := &ffmpegVMAF{
+		exePath:        exePath,
+		sourceFile:     sourceFile,
+		compressedFile: compressedFile,
+		resultFile:     resultFile,
+		output:         []byte{},
+		measured:       false,
+		// Frame count check is disabled by default.
+		frameCountTolerance: -1,
+	}
+	for _, opt := range opts {
+		opt(vqt)
+	}
+
+	// Too much CPU threads are also bad (see LibvmafOptions.MaxThreads).
+	maxThreads := vqt.libvmafOptions.maxThreads()
+	threads, capped := nThreads(runtime.NumCPU(), maxThreads)
+	if capped {
+		logging.Debugf("libvmaf n_threads capped at %d (%d CPUs)", threads, runtime.NumCPU())
+	} else {
+		logging.Debugf("libvmaf n_threads set to number of CPUs %d (cap %d)", threads, maxThreads)
 	}
 
 	// Template requires a struct with exported fields.
 	tplContext := struct {
-		SourceFile     string
-		CompressedFile string
-		ResultFile     string
-		ModelPath      string
-		NThreads       int
+		SourceFile      string
+		SourceInputArgs []string
+		CompressedFile  string
+		ResultFile      string
+		ModelPath       string
+		Model           string
+		NThreads        int
+		Prefilter       string
+		RefFilter       string
+		Options         string
+		Features        string
+		NoAutorotate    bool
+		CUDA            bool
 	}{
-		SourceFile:     sourceFile,
-		CompressedFile: compressedFile,
-		ResultFile:     resultFile,
-		ModelPath:      modelPath,
-		NThreads:       nThreads,
+		SourceFile:      sourceFile,
+		SourceInputArgs: vqt.sourceInputArgs,
+		CompressedFile:  compressedFile,
+		ResultFile:      resultFile,
+		ModelPath:       modelPath,
+		NThreads:        threads,
+		Features:        "ms_ssim=1:feature=name=psnr",
+		NoAutorotate:    vqt.noAutorotate,
+		Options:         vqt.libvmafOptions.filterOptions(),
+	}
+	if len(vqt.features) > 0 {
+		names := make([]string, len(vqt.features))
+		for i, name := range vqt.features {
+			names[i] = "name=" + name
+		}
+		tplContext.Features = "feature=" + strings.Join(names, "|")
+	}
+	// Use libvmaf built-in model in case of preset.
+	if m, ok := libvmafModelPresets[modelPath]; ok {
+		tplContext.ModelPath = ""
+		tplContext.Model = m
+	}
+
+	// Frame rates must match for frame by frame comparison, inputs are probed
+	// unless their metadata is known (see WithMetadata).
+	if err := vqt.probeMetadata(); err != nil {
+		logging.Infof("Unable to compare frame rates of %s and %s: %s", compressedFile, sourceFile, err)
+	} else {
+		vqt.initFrameRateConversion()
+	}
+	if vqt.upscaleMethod != "" {
+		if err := vqt.initUpscale(); err != nil {
+			return nil, fmt.Errorf("NewFfmpegVQM() %w", err)
+		}
+	}
+
+	// Frame selection and geometry transform are applied symmetrically to
+	// distorted (first) and reference (second) inputs, frame rate conversion
+	// and upscale only to distorted one. Frame rate is converted first, so
+	// that selected frame indices match.
+	var prefilters, disFilters []string
+	if vqt.fpsFilter != "" {
+		disFilters = append(disFilters, vqt.fpsFilter)
+	}
+	if len(vqt.frames) > 0 {
+		prefilters = append(prefilters, selectFilter(vqt.frames))
+	}
+	disFilters = append(disFilters, prefilters...)
+	if vqt.upscale != "" {
+		disFilters = append(disFilters, vqt.upscale)
+	}
+	if vqt.geometry != "" {
+		prefilters = append(prefilters, vqt.geometry)
+		disFilters = append(disFilters, vqt.geometry)
+	}
+	tplContext.Prefilter = strings.Join(disFilters, ",")
+	tplContext.RefFilter = strings.Join(prefilters, ",")
+	if tplContext.Prefilter != "" && tplContext.RefFilter == "" {
+		tplContext.RefFilter = "null"
+	}
+	// Source luma is measured on reference input after prefilters, so that
+	// luma values line up with libvmaf frames.
+	if vqt.lumaThreshold > 0 {
+		vqt.lumaFile = strings.TrimSuffix(resultFile, filepath.Ext(resultFile)) + "_luma.log"
+		if tplContext.Prefilter == "" {
+			tplContext.Prefilter = "null"
+		}
+		tplContext.RefFilter = strings.Join(append(prefilters,
+			"signalstats",
+			"metadata=mode=print:key=lavfi.signalstats.YAVG:file="+filterPath(vqt.lumaFile)), ",")
 	}
 
 	ffmpegArgTpl := `-hide_banner
-		-i {{.CompressedFile}} -i {{.SourceFile}}
+		{{if .CUDA}}-hwaccel cuda -hwaccel_output_format cuda {{end}}{{if .NoAutorotate}}-noautorotate {{end}}-i {{quote .CompressedFile}} {{if .CUDA}}-hwaccel cuda -hwaccel_output_format cuda {{end}}{{if .NoAutorotate}}-noautorotate {{end}}{{range .SourceInputArgs}}{{quote .}} {{end}}-i {{quote .SourceFile}}
 		-lavfi
-		libvmaf=n_subsample=1:log_path={{.ResultFile}}:ms_ssim=1:psnr=1:log_fmt=json:model_path={{.ModelPath}}:n_threads={{.NThreads}}
+		{{if .CUDA}}[0:v]scale_cuda=format=yuv420p[dis];[1:v]scale_cuda=format=yuv420p[ref];[dis][ref]libvmaf_cuda={{else}}{{if .Prefilter}}[0:v]{{.Prefilter}}[dis];[1:v]{{.RefFilter}}[ref];[dis][ref]{{end}}libvmaf={{end}}{{.Options}}:log_path={{filterPath .ResultFile}}:{{if .Features}}{{.Features}}:{{end}}log_fmt=json:{{if .Model}}model={{.Model}}{{else}}model_path={{filterPath .ModelPath}}{{end}}:n_threads={{.NThreads}}
 		-f null -`
 
-	var cmd strings.Builder
-	tpl := template.Must(template.New("ffmpeg").Parse(ffmpegArgTpl))
-	err := tpl.Execute(&cmd, tplContext)
-	if err != nil {
-		return vqt, fmt.Errorf("NewFfmpegVQM() execute template: %w", err)
+	// Paths are quoted (and escaped for filtergraph), since they may contain
+	// spaces and other special characters.
+	funcs := template.FuncMap{"quote": shlexQuote, "filterPath": filterPath}
+	tpl := template.Must(template.New("ffmpeg").Funcs(funcs).Parse(ffmpegArgTpl))
+	render := func() ([]string, error) {
+		var cmd strings.Builder
+		if err := tpl.Execute(&cmd, tplContext); err != nil {
+			return nil, fmt.Errorf("NewFfmpegVQM() execute template: %w", err)
+		}
+		ffmpegArgs, err := shlex.Split(cmd.String())
+		if err != nil {
+			return nil, fmt.Errorf("NewFfmpegVQM() prepare command: %w", err)
+		}
+		return ffmpegArgs, nil
 	}
-	ffmpegArgs, err := shlex.Split(cmd.String())
+	ffmpegArgs, err := render()
 	if err != nil {
-		return vqt, fmt.Errorf("NewFfmpegVQM() prepare command: %w", err)
+		return nil, err
 	}
+	vqt.ffmpegArgs = ffmpegArgs
 
-	vqt = &ffmpegVMAF{
-		exePath:        exePath,
-		ffmpegArgs:     ffmpegArgs,
-		sourceFile:     sourceFile,
-		compressedFile: compressedFile,
-		resultFile:     resultFile,
-		output:         []byte{},
-		measured:       false,
+	// CUDA frames stay in GPU memory, so CPU filters can not be applied.
+	if vqt.cuda {
+		reason := cudaUnavailable()
+		if reason == "" && tplContext.Prefilter != "" {
+			reason = "CPU filters needed"
+		}
+		if reason != "" {
+			logging.Infof("VMAF of %s is measured on CPU, CUDA path unavailable: %s", compressedFile, reason)
+			return vqt, nil
+		}
+		tplContext.CUDA = true
+		if len(vqt.features) == 0 {
+			tplContext.Features = ""
+		}
+		if vqt.ffmpegArgs, err = render(); err != nil {
+			return nil, err
+		}
+		// ffmpeg lists compiled in hwaccels only, so GPU may still be
+		// unusable (e.g. no CUDA device), CPU command is kept as fallback.
+		vqt.cpuArgs = ffmpegArgs
+		logging.Infof("VMAF of %s is measured on GPU (libvmaf_cuda)", compressedFile)
 	}
 
 	return vqt, nil
@@ -116,22 +671,420 @@ type ffmpegVMAF struct {
 	resultFile string
 	output     []byte
 	measured   bool
+	// Allowed frame count difference, negative disables frame count check
+	frameCountTolerance int
+	// ffmpeg filter chain applied to both inputs before comparison
+	geometry string
+	// libvmaf features overriding default ones
+	features []string
+	// Explicitly selected frame indices (sorted), empty means all frames
+	frames []int
+	// Measurement progress is rendered here, nil disables progress
+	progress io.Writer
+	// Disable automatic rotation of inputs
+	noAutorotate bool
+	// ffmpeg input-side arguments of source video
+	sourceInputArgs []string
+	// Known compressed and source video metadata, nil means probe on demand
+	compressedMeta *video.Metadata
+	sourceMeta     *video.Metadata
+	// Number of leading and trailing frames excluded from aggregates
+	excludeLeading  int
+	excludeTrailing int
+	// Frames with source average luma below threshold are excluded from
+	// aggregates, zero disables
+	lumaThreshold float64
+	// ffmpeg signalstats output file and parsed per frame source luma
+	lumaFile string
+	luma     []float64
+	// libvmaf filter options
+	libvmafOptions LibvmafOptions
+	// Compressed and source files are identical
+	identicalInputs bool
+	// ffmpeg scaler compressed video is upscaled with to source resolution,
+	// empty disables, and resulting scale filter
+	upscaleMethod string
+	upscale       string
+	// Niceness of ffmpeg process, 0 means no change
+	nice int
+	// Use CUDA accelerated libvmaf if available
+	cuda bool
+	// ffmpeg command arguments of CPU path in case ffmpegArgs are those of
+	// CUDA path, nil otherwise
+	cpuArgs []string
+	// ffmpeg fps filter converting compressed video to source frame rate,
+	// empty if frame rates match, and ratio of source to compressed frame
+	// rate
+	fpsFilter      string
+	frameRateRatio float64
 }
 
+// Measure runs VQM measurement, this is a wrapper around MeasureContext with
+// background context.
 func (f *ffmpegVMAF) Measure() error {
+	return f.MeasureContext(context.Background())
+}
+
+// MeasureContext runs VQM measurement, ffmpeg process is killed if ctx is
+// done before measurement completes.
+func (f *ffmpegVMAF) MeasureContext(ctx context.Context) error {
 	if f.measured {
 		return errors.New("Measure() already executed")
 	}
-	cmd := exec.Command(f.exePath, f.ffmpegArgs...) //#nosec G204
+	if f.frameCountTolerance >= 0 {
+		if err := f.checkFrameCount(); err != nil {
+			return err
+		}
+	}
+	if same, err := identicalFiles(f.compressedFile, f.sourceFile); err != nil {
+		logging.Debugf("Unable to compare %s and %s: %s", f.compressedFile, f.sourceFile, err)
+	} else if same {
+		f.identicalInputs = true
+		logging.Infof("Compressed file %s is identical to source %s, VMAF is trivially 100 (pass-through scheme?)",
+			f.compressedFile, f.sourceFile)
+	}
+	release, err := tools.AcquireProcessContext(ctx)
+	if err != nil {
+		return fmt.Errorf("VQM calculation interrupted: %w", err)
+	}
+	defer release()
+	err = f.execute(ctx, f.ffmpegArgs)
+	if err != nil && f.cpuArgs != nil && ctx.Err() == nil {
+		logging.Infof("VQM measurement of %s on GPU failed, retrying on CPU", f.compressedFile)
+		err = f.execute(ctx, f.cpuArgs)
+	}
+	if err != nil {
+		if noLibvmaf(f.output) {
+			return fmt.Errorf("VQM calculation error: %w: ffmpeg must be built with libvmaf support (--enable-libvmaf), run \"ease doctor\" to check dependencies", ErrNoLibvmaf)
+		}
+		return fmt.Errorf("VQM calculation error: %w", err)
+	}
+	if f.lumaFile != "" {
+		if f.luma, err = readLumaFile(f.lumaFile); err != nil {
+			return fmt.Errorf("VQM calculation error: %w", err)
+		}
+		// Luma values are only needed for aggregates, no need to keep them.
+		if err := os.Remove(f.lumaFile); err != nil {
+			logging.Debugf("Unable to remove luma file: %s", err)
+		}
+	}
+	f.measured = true
+	return nil
+}
+
+// Resume will use existing result file instead of running measurement, result
+// must be newer than compressed file and have a frame per compressed video
+// frame. Subsequent GetResult parses existing result.
+func (f *ffmpegVMAF) Resume() error {
+	if f.measured {
+		return errors.New("Resume() measurement already done")
+	}
+	// Per frame source luma is not kept, so excluded frames can not be
+	// restored.
+	if f.lumaThreshold > 0 {
+		return errors.New("Resume() not supported with luma threshold")
+	}
+	resInfo, err := os.Stat(f.resultFile)
+	if err != nil {
+		return fmt.Errorf("Resume() %w", err)
+	}
+	compInfo, err := os.Stat(f.compressedFile)
+	if err != nil {
+		return fmt.Errorf("Resume() %w", err)
+	}
+	if resInfo.ModTime().Before(compInfo.ModTime()) {
+		return fmt.Errorf("Resume() result %s is older than compressed file", f.resultFile)
+	}
+	data, err := os.ReadFile(f.resultFile)
+	if err != nil {
+		return fmt.Errorf("Resume() %w", err)
+	}
+	// Result of interrupted measurement is truncated, hence invalid JSON.
+	res := &ffmpegVMAFResult{}
+	if err := json.Unmarshal(data, res); err != nil {
+		return fmt.Errorf("Resume() unmarshal JSON: %w", err)
+	}
+	want, err := f.expectedFrameCount()
+	if err != nil {
+		return fmt.Errorf("Resume() %w", err)
+	}
+	if len(res.Frames) != want {
+		return fmt.Errorf("Resume() frame count mismatch: result %d, expected %d", len(res.Frames), want)
+	}
+	if same, err := identicalFiles(f.compressedFile, f.sourceFile); err == nil {
+		f.identicalInputs = same
+	}
+	f.measured = true
+	return nil
+}
+
+// expectedFrameCount returns number of frames libvmaf measures: selected
+// frames or all compressed video frames after frame rate conversion.
+func (f *ffmpegVMAF) expectedFrameCount() (int, error) {
+	if len(f.frames) > 0 {
+		return len(f.frames), nil
+	}
+	meta, err := f.metadata(f.compressedFile, f.compressedMeta)
+	if err != nil {
+		return 0, err
+	}
+	if f.fpsFilter != "" {
+		return int(math.Round(float64(meta.FrameCount) * f.frameRateRatio)), nil
+	}
+	return meta.FrameCount, nil
+}
+
+// cudaUnavailable returns reason why CUDA accelerated libvmaf can not be used,
+// empty means it can. It is a variable so that tests can stub it.
+var cudaUnavailable = func() string {
+	cudaOnce.Do(func() {
+		cudaReason = checkCUDA()
+	})
+	return cudaReason
+}
+
+// ffmpeg capabilities do not change during a run, so CUDA support is checked
+// once.
+var (
+	cudaOnce   sync.Once
+	cudaReason string
+)
+
+// checkCUDA will check ffmpeg's hwaccels and filters for CUDA accelerated
+// libvmaf support, returns reason in case it is unavailable.
+func checkCUDA() string {
+	ok, err := tools.FfmpegHasHWAccel("cuda")
+	if err != nil {
+		return err.Error()
+	}
+	if !ok {
+		return "ffmpeg has no cuda hwaccel"
+	}
+	ok, err = tools.FfmpegHasFilter("libvmaf_cuda")
+	if err != nil {
+		return err.Error()
+	}
+	if !ok {
+		return "ffmpeg has no libvmaf_cuda filter"
+	}
+	return ""
+}
+
+// ErrNoLibvmaf is returned when ffmpeg is built without libvmaf filter.
+var ErrNoLibvmaf = errors.New("ffmpeg has no libvmaf filter")
+
+// noLibvmafMatcher matches ffmpeg error messages for missing libvmaf filter.
+var noLibvmafMatcher = regexp.MustCompile(`No such filter: '?libvmaf'?|Unknown filter '?libvmaf'?`)
+
+// noLibvmaf reports whether ffmpeg output indicates missing libvmaf filter.
+func noLibvmaf(output []byte) bool {
+	return noLibvmafMatcher.Match(output)
+}
+
+// execute will run ffmpeg with given arguments capturing its output, failure
+// is logged along with the output.
+func (f *ffmpegVMAF) execute(ctx context.Context, args []string) error {
+	cmd := exec.CommandContext(ctx, f.exePath, args...) //#nosec G204
 	logging.Debugf("VQM tool command: %v", cmd.Args)
 	var err error
-	f.output, err = cmd.CombinedOutput()
+	if f.progress != nil {
+		err = f.runWithProgress(cmd)
+	} else {
+		var buf bytes.Buffer
+		cmd.Stdout = &buf
+		cmd.Stderr = &buf
+		err = f.run(cmd)
+		f.output = buf.Bytes()
+	}
 	if err != nil {
 		logging.Infof("VQM tool execution failure:\n%s", cmd.String())
 		logging.Infof("VQM tool output:\n%s", f.output)
-		return fmt.Errorf("VQM calculation error: %w", err)
 	}
-	f.measured = true
+	return err
+}
+
+// run will run cmd with priority settings applied before it starts (see
+// tools.SetPriority).
+func (f *ffmpegVMAF) run(cmd *exec.Cmd) error {
+	tools.SetPriority(cmd, f.nice, "")
+	return cmd.Run()
+}
+
+// runWithProgress will run cmd streaming its output through progressWriter,
+// full output is still captured for error reporting.
+func (f *ffmpegVMAF) runWithProgress(cmd *exec.Cmd) error {
+	var total int
+	if meta, err := f.metadata(f.compressedFile, f.compressedMeta); err == nil {
+		total = meta.FrameCount
+	} else {
+		logging.Debugf("Unable to get frame count for progress: %s", err)
+	}
+	var buf bytes.Buffer
+	out := io.MultiWriter(&buf, &progressWriter{w: f.progress, total: total})
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := f.run(cmd)
+	// Terminate progress line.
+	fmt.Fprintln(f.progress)
+	f.output = buf.Bytes()
+	return err
+}
+
+// checkFrameCount will compare compressed and source video frame counts.
+func (f *ffmpegVMAF) checkFrameCount() error {
+	cMeta, err := f.metadata(f.compressedFile, f.compressedMeta)
+	if err != nil {
+		return fmt.Errorf("checkFrameCount() compressed file: %w", err)
+	}
+	sMeta, err := f.metadata(f.sourceFile, f.sourceMeta)
+	if err != nil {
+		return fmt.Errorf("checkFrameCount() source file: %w", err)
+	}
+	frameCount := cMeta.FrameCount
+	// Frame rate conversion drops or duplicates frames.
+	if f.fpsFilter != "" {
+		frameCount = int(math.Round(float64(frameCount) * f.frameRateRatio))
+	}
+	return compareFrameCount(frameCount, sMeta.FrameCount, f.frameCountTolerance)
+}
+
+// frameRateTolerance is maximum difference (in frames per second) of frame
+// rates considered equal, e.g. rounding of average frame rate.
+const frameRateTolerance = 0.01
+
+// initFrameRateConversion will prepare fps filter converting compressed video
+// to source frame rate in case frame rates differ. Unknown frame rates are not
+// converted.
+func (f *ffmpegVMAF) initFrameRateConversion() {
+	cFps, err := f.compressedMeta.FrameRateFrom(video.FrameRateAuto)
+	if err != nil || cFps <= 0 {
+		return
+	}
+	sFps, err := f.sourceMeta.FrameRateFrom(video.FrameRateAuto)
+	if err != nil || sFps <= 0 {
+		return
+	}
+	if math.Abs(cFps-sFps) <= frameRateTolerance {
+		return
+	}
+	// Rational form keeps rates like 30000/1001 exact.
+	rate := f.sourceMeta.AvgFrameRate
+	if fps, err := video.ParseFrameRate(rate); err != nil || fps <= 0 {
+		rate = f.sourceMeta.FrameRate
+	}
+	f.fpsFilter = "fps=" + rate
+	f.frameRateRatio = sFps / cFps
+	logging.Infof("Frame rates of %s (%.3f fps) and %s (%.3f fps) differ, compressed video is resampled with %s",
+		f.compressedFile, cFps, f.sourceFile, sFps, f.fpsFilter)
+}
+
+// identicalFiles reports whether a and b are the same file or files with
+// identical content, content is only compared (via SHA-256 checksums) for files
+// of equal size.
+func identicalFiles(a, b string) (bool, error) {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(aInfo, bInfo) {
+		return true, nil
+	}
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+	aSum, err := fileChecksum(a)
+	if err != nil {
+		return false, err
+	}
+	bSum, err := fileChecksum(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aSum, bSum), nil
+}
+
+// fileChecksum returns SHA-256 checksum of file content.
+func fileChecksum(name string) ([]byte, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// metadata returns known metadata in case it is given, otherwise videoFile is
+// probed (source with its input-side arguments).
+func (f *ffmpegVMAF) metadata(videoFile string, known *video.Metadata) (video.Metadata, error) {
+	if known != nil {
+		return *known, nil
+	}
+	if videoFile == f.sourceFile {
+		return tools.FfprobeExtractMetadata(videoFile, tools.WithInputArgs(f.sourceInputArgs...))
+	}
+	return tools.FfprobeExtractMetadata(videoFile)
+}
+
+// probeMetadata will probe compressed and source files unless their metadata
+// is known, probed metadata is kept for later checks.
+func (f *ffmpegVMAF) probeMetadata() error {
+	if f.compressedMeta == nil {
+		meta, err := f.metadata(f.compressedFile, nil)
+		if err != nil {
+			return fmt.Errorf("probeMetadata() compressed file: %w", err)
+		}
+		f.compressedMeta = &meta
+	}
+	if f.sourceMeta == nil {
+		meta, err := f.metadata(f.sourceFile, nil)
+		if err != nil {
+			return fmt.Errorf("probeMetadata() source file: %w", err)
+		}
+		f.sourceMeta = &meta
+	}
+	return nil
+}
+
+// initUpscale will prepare scale filter upscaling compressed video to source
+// resolution, source is probed unless its metadata is known.
+func (f *ffmpegVMAF) initUpscale() error {
+	meta, err := f.metadata(f.sourceFile, f.sourceMeta)
+	if err != nil {
+		return fmt.Errorf("initUpscale() source file: %w", err)
+	}
+	// Decoded frames are rotated unless autorotation is disabled.
+	w, h := meta.DisplaySize()
+	if f.noAutorotate {
+		w, h = meta.Width, meta.Height
+	}
+	if w == 0 || h == 0 {
+		return fmt.Errorf("initUpscale() unknown source resolution: %s", f.sourceFile)
+	}
+	f.upscale = fmt.Sprintf("scale=%dx%d:flags=%s", w, h, f.upscaleMethod)
+	return nil
+}
+
+// compareFrameCount will return error if frame counts differ by more than
+// tolerance, smaller differences are logged.
+func compareFrameCount(compressed, source, tolerance int) error {
+	diff := compressed - source
+	if diff < 0 {
+		diff = -diff
+	}
+	switch {
+	case diff > tolerance:
+		return fmt.Errorf("frame count mismatch: compressed %d, source %d (tolerance %d)", compressed, source, tolerance)
+	case diff > 0:
+		logging.Infof("Frame count differs within tolerance: compressed %d, source %d", compressed, source)
+	}
 	return nil
 }
 
@@ -151,11 +1104,20 @@ func (f *ffmpegVMAF) GetResult() (Result, error) {
 	if err != nil {
 		return vqr, fmt.Errorf("VideoQualityTool.GetResult() in resultParser(): %w", err)
 	}
+	vqm.IdenticalInputs = f.identicalInputs
 	vqr = Result{
 		Metrics:        vqm,
 		SourceFile:     f.sourceFile,
 		CompressedFile: f.compressedFile,
 		ResultFile:     f.resultFile,
+		Upscale:        f.upscale,
+		FieldAliases:   f.libvmafOptions.FieldAliases,
+		// Set only when frame rates differ.
+		FrameRateConversion: f.fpsFilter,
+	}
+	if f.sourceMeta != nil && f.compressedMeta != nil {
+		src, comp := f.sourceMeta.Color, f.compressedMeta.Color
+		vqr.SourceColor, vqr.CompressedColor = &src, &comp
 	}
 	return vqr, nil
 }
@@ -168,36 +1130,81 @@ func (f *ffmpegVMAF) unmarshalResultJSON(data []byte) (VideoQualityMetrics, erro
 	if err := json.Unmarshal(data, res); err != nil {
 		return vqm, fmt.Errorf("parseResult() unmarshal JSON: %w", err)
 	}
+	aliases := f.libvmafOptions.FieldAliases
+	pooled := aliases.pooledMetrics(res.PooledMetrics)
+	frames := aliases.frames(res.Frames)
+	pool := f.libvmafOptions.Pool
 	vqm = VideoQualityMetrics{
-		VMAF:    res.PooledMetrics.VMAF.Mean,
-		PSNR:    res.PooledMetrics.PSNR.Mean,
-		MS_SSIM: res.PooledMetrics.MS_SSIM.Mean,
+		VMAF:    pooled.VMAF.pooled(pool),
+		PSNR:    pooled.PSNR.pooled(pool),
+		PSNR_CB: pooled.PSNR_CB.pooled(pool),
+		PSNR_CR: pooled.PSNR_CR.pooled(pool),
+		MS_SSIM: pooled.MS_SSIM.pooled(pool),
+		Absent:  aliases.absent(res.PooledMetrics),
+	}
+	excluded := make([]bool, len(frames))
+	if f.excludeLeading > 0 || f.excludeTrailing > 0 || f.lumaThreshold > 0 {
+		excluded = excludedFrames(len(frames), f.excludeLeading, f.excludeTrailing, f.luma, f.lumaThreshold)
+		if err := poolFrames(&vqm, frames, excluded); err != nil {
+			return vqm, fmt.Errorf("parseResult() %w", err)
+		}
+	}
+	psnr := make([]float64, 0, len(frames))
+	for i := range frames {
+		if !excluded[i] {
+			psnr = append(psnr, frames[i].Metrics.PSNR)
+		}
+	}
+	if !vqm.IsAbsent("PSNR") {
+		vqm.PSNRFromMSE = PooledPSNR(psnr)
+	}
+	// Selected frames are renumbered by libvmaf, map them back to indices.
+	if len(f.frames) > 0 {
+		for i := range frames {
+			if i >= len(f.frames) {
+				break
+			}
+			vqm.SampledFrames = append(vqm.SampledFrames, SampledFrame{
+				Index: f.frames[i],
+				VMAF:  frames[i].Metrics.VMAF,
+			})
+		}
 	}
 	return vqm, nil
 }
 
-// This and following are helper structs for libvmaf JSON result.
+// This and following are helper structs for libvmaf JSON result, metrics are
+// picked from raw ones according to FieldAliases.
 type ffmpegVMAFResult struct {
-	Version       string        `json:"version"`
-	Frames        []frame       `json:"frames"`
-	PooledMetrics pooledMetrics `json:"pooled_metrics"`
+	Version       string             `json:"version"`
+	Frames        []rawFrame         `json:"frames"`
+	PooledMetrics map[string]pMetric `json:"pooled_metrics"`
+}
+
+type rawFrame struct {
+	FrameNum uint               `json:"frameNum"`
+	Metrics  map[string]float64 `json:"metrics"`
 }
 
 type frame struct {
-	FrameNum uint   `json:"frameNum"`
-	Metrics  metric `json:"metrics"`
+	FrameNum uint
+	Metrics  metric
 }
 
 type metric struct {
-	VMAF    float64 `json:"vmaf"`
-	PSNR    float64 `json:"psnr"`
-	MS_SSIM float64 `json:"ms_ssim"`
+	VMAF    float64
+	PSNR    float64
+	PSNR_CB float64
+	PSNR_CR float64
+	MS_SSIM float64
 }
 
 type pooledMetrics struct {
-	VMAF    pMetric `json:"vmaf"`
-	PSNR    pMetric `json:"psnr"`
-	MS_SSIM pMetric `json:"ms_ssim"`
+	VMAF    pMetric
+	PSNR    pMetric
+	PSNR_CB pMetric
+	PSNR_CR pMetric
+	MS_SSIM pMetric
 }
 
 type pMetric struct {
@@ -206,3 +1213,14 @@ type pMetric struct {
 	Mean         float64 `json:"mean"`
 	HarmonicMean float64 `json:"harmonic_mean"`
 }
+
+// pooled returns aggregate value for given pooling method, mean is default.
+func (m pMetric) pooled(pool string) float64 {
+	switch pool {
+	case PoolHarmonicMean:
+		return m.HarmonicMean
+	case PoolMin:
+		return m.Min
+	}
+	return m.Mean
+}
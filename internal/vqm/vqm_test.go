@@ -5,9 +5,17 @@
 package vqm
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/evolution-gaming/ease/internal/tools"
+	"github.com/evolution-gaming/ease/internal/video"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -126,3 +134,802 @@ func TestFfmpegVMAF_Negative(t *testing.T) {
 		}
 	})
 }
+
+func TestFfmpegVMAF_NoLibvmaf(t *testing.T) {
+	// Fake ffmpeg built without libvmaf.
+	fakeFfmpeg := path.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\necho \"[AVFilterGraph @ 0x1] No such filter: 'libvmaf'\" >&2\nexit 1\n"
+	if err := os.WriteFile(fakeFfmpeg, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tool, err := NewFfmpegVMAF(fakeFfmpeg, "model.json", "compressed.mp4", "source.mp4", t.TempDir()+"/result.json")
+	if err != nil {
+		t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+	}
+
+	err = tool.Measure()
+	if !errors.Is(err, ErrNoLibvmaf) {
+		t.Fatalf("Expected ErrNoLibvmaf, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "ease doctor") {
+		t.Errorf("Expected pointer to doctor command in error: %v", err)
+	}
+}
+
+func TestFfmpegVMAF_CUDAFailureFallsBackToCPU(t *testing.T) {
+	orig := cudaUnavailable
+	t.Cleanup(func() { cudaUnavailable = orig })
+	cudaUnavailable = func() string { return "" }
+
+	// Fake ffmpeg with CUDA support compiled in, but without usable GPU.
+	dir := t.TempDir()
+	fakeFfmpeg := path.Join(dir, "ffmpeg")
+	calls := path.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$*\" >> " + calls + "\ncase \"$*\" in *libvmaf_cuda*) echo 'No CUDA device' >&2; exit 1;; esac\n"
+	if err := os.WriteFile(fakeFfmpeg, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tool, err := NewFfmpegVMAF(fakeFfmpeg, "4k", "compressed.mp4", "source.mp4", path.Join(dir, "result.json"), WithCUDA())
+	if err != nil {
+		t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+	}
+
+	if err := tool.Measure(); err != nil {
+		t.Fatalf("Unexpected error when calling Measure(): %v", err)
+	}
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(got) != 2 || !strings.Contains(got[0], "libvmaf_cuda") || !strings.Contains(got[1], "libvmaf=") {
+		t.Errorf("Expected GPU run followed by CPU run, got:\n%s", data)
+	}
+}
+
+func Test_noLibvmaf(t *testing.T) {
+	tests := map[string]struct {
+		given string
+		want  bool
+	}{
+		"No such filter": {given: "[AVFilterGraph @ 0x1] No such filter: 'libvmaf'\nError initializing complex filters.", want: true},
+		"Unknown filter": {given: "Unknown filter 'libvmaf'", want: true},
+		"Other filter":   {given: "No such filter: 'zscale'", want: false},
+		"Other error":    {given: "source.mp4: No such file or directory", want: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, noLibvmaf([]byte(tc.given))); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewFfmpegVMAF_ModelPreset(t *testing.T) {
+	tests := map[string]struct {
+		givenModel string
+		want       string
+	}{
+		"Phone preset": {
+			givenModel: "phone",
+			want:       `:model=version=vmaf_v0.6.1\:enable_transform=true:`,
+		},
+		"4k preset": {
+			givenModel: "4k",
+			want:       ":model=version=vmaf_4k_v0.6.1:",
+		},
+		"Model path": {
+			givenModel: "/path/to/model.json",
+			want:       ":model_path=/path/to/model.json:",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tool, err := NewFfmpegVMAF("ffmpeg", tc.givenModel, "compressed.mp4", "source.mp4", "result.json")
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+			if !strings.Contains(args, tc.want) {
+				t.Errorf("ffmpeg args do not contain %q: %s", tc.want, args)
+			}
+		})
+	}
+}
+
+func TestNewFfmpegVMAF_WithGeometry(t *testing.T) {
+	tests := map[string]struct {
+		givenGeometry string
+		want          string
+	}{
+		"No geometry": {
+			givenGeometry: "",
+			want:          "-lavfi libvmaf=",
+		},
+		"Crop and scale": {
+			givenGeometry: "crop=1920:800:0:140,scale=1920:1080",
+			want:          "-lavfi [0:v]crop=1920:800:0:140,scale=1920:1080[dis];[1:v]crop=1920:800:0:140,scale=1920:1080[ref];[dis][ref]libvmaf=",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json", WithGeometry(tc.givenGeometry))
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+			if !strings.Contains(args, tc.want) {
+				t.Errorf("ffmpeg args do not contain %q: %s", tc.want, args)
+			}
+		})
+	}
+}
+
+func TestNewFfmpegVMAF_WithCUDA(t *testing.T) {
+	tests := map[string]struct {
+		givenReason string
+		givenOpts   []FfmpegVMAFOption
+		want        string
+		wantCUDA    bool
+	}{
+		"CUDA available": {
+			want:     "-lavfi [0:v]scale_cuda=format=yuv420p[dis];[1:v]scale_cuda=format=yuv420p[ref];[dis][ref]libvmaf_cuda=n_subsample=1:log_path=result.json:log_fmt=json:",
+			wantCUDA: true,
+		},
+		"CUDA available with features": {
+			givenOpts: []FfmpegVMAFOption{WithFeatures([]string{"psnr_cuda"})},
+			want:      "libvmaf_cuda=n_subsample=1:log_path=result.json:feature=name=psnr_cuda:log_fmt=json:",
+			wantCUDA:  true,
+		},
+		"Fallback when CUDA unavailable": {
+			givenReason: "ffmpeg has no cuda hwaccel",
+			want:        "-lavfi libvmaf=n_subsample=1:log_path=result.json:ms_ssim=1:feature=name=psnr:log_fmt=json:",
+		},
+		"Fallback when CPU filters needed": {
+			givenOpts: []FfmpegVMAFOption{WithGeometry("scale=1920:1080")},
+			want:      "[dis][ref]libvmaf=",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			orig := cudaUnavailable
+			t.Cleanup(func() { cudaUnavailable = orig })
+			cudaUnavailable = func() string { return tc.givenReason }
+
+			opts := append([]FfmpegVMAFOption{WithCUDA()}, tc.givenOpts...)
+			tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json", opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+			if !strings.Contains(args, tc.want) {
+				t.Errorf("ffmpeg args do not contain %q: %s", tc.want, args)
+			}
+			hwaccel := "-hwaccel cuda -hwaccel_output_format cuda -i compressed.mp4 -hwaccel cuda -hwaccel_output_format cuda -i source.mp4"
+			if got := strings.Contains(args, hwaccel); got != tc.wantCUDA {
+				t.Errorf("Expected CUDA decoding %v, got args: %s", tc.wantCUDA, args)
+			}
+			// CPU command is kept as fallback for GPU path only.
+			if got := tool.(*ffmpegVMAF).cpuArgs != nil; got != tc.wantCUDA {
+				t.Errorf("Expected CPU fallback command %v", tc.wantCUDA)
+			}
+		})
+	}
+}
+
+func TestNewFfmpegVMAF_WithNoAutorotate(t *testing.T) {
+	tests := map[string]struct {
+		givenOpts []FfmpegVMAFOption
+		want      string
+	}{
+		"Autorotate": {
+			want: "-hide_banner -i compressed.mp4 -i source.mp4 -lavfi",
+		},
+		"No autorotate": {
+			givenOpts: []FfmpegVMAFOption{WithNoAutorotate()},
+			want:      "-hide_banner -noautorotate -i compressed.mp4 -noautorotate -i source.mp4 -lavfi",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json", tc.givenOpts...)
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+			if !strings.Contains(args, tc.want) {
+				t.Errorf("ffmpeg args do not contain %q: %s", tc.want, args)
+			}
+		})
+	}
+}
+
+func TestNewFfmpegVMAF_SpecialPaths(t *testing.T) {
+	tests := map[string]struct {
+		givenDir string
+		// Expected directory in filter option values, escaped twice: for
+		// filter options and for filtergraph.
+		wantFilterDir string
+	}{
+		"Spaces": {
+			givenDir:      "/tmp/my videos",
+			wantFilterDir: "/tmp/my videos",
+		},
+		"Working directory with spaces": {
+			givenDir:      "/home/user/My Documents/ease out",
+			wantFilterDir: "/home/user/My Documents/ease out",
+		},
+		"Colon": {
+			givenDir:      "/tmp/a:b",
+			wantFilterDir: `/tmp/a\\:b`,
+		},
+		"Quote": {
+			givenDir:      "/tmp/it's",
+			wantFilterDir: `/tmp/it\\\'s`,
+		},
+		"Filtergraph special characters": {
+			givenDir:      "/tmp/[a,b];c",
+			wantFilterDir: `/tmp/\[a\,b\]\;c`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			compressed := path.Join(tc.givenDir, "compressed.mp4")
+			source := path.Join(tc.givenDir, "source.mp4")
+			result := path.Join(tc.givenDir, "result.json")
+			model := path.Join(tc.givenDir, "model.json")
+			tool, err := NewFfmpegVMAF("ffmpeg", model, compressed, source, result)
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			args := tool.(*ffmpegVMAF).ffmpegArgs
+			want := []string{"-hide_banner", "-i", compressed, "-i", source, "-lavfi"}
+			if diff := cmp.Diff(want, args[:len(want)]); diff != "" {
+				t.Errorf("ffmpeg args mismatch (-want +got):\n%s", diff)
+			}
+			filter := args[len(want)]
+			for _, opt := range []string{"log_path=", "model_path="} {
+				wantOpt := opt + tc.wantFilterDir + "/"
+				if !strings.Contains(filter, wantOpt) {
+					t.Errorf("libvmaf filter does not contain %q: %s", wantOpt, filter)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFfmpegVMAF_WithSourceInputArgs(t *testing.T) {
+	// Metadata is given, since raw source could not be probed.
+	meta := video.Metadata{Width: 1920, Height: 1080, FrameRate: "25/1"}
+	tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.yuv", "result.json",
+		WithMetadata(meta, meta),
+		WithSourceInputArgs([]string{"-f", "rawvideo", "-video_size", "1920x1080"}))
+	if err != nil {
+		t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+	}
+	args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+	want := "-i compressed.mp4 -f rawvideo -video_size 1920x1080 -i source.yuv -lavfi"
+	if !strings.Contains(args, want) {
+		t.Errorf("ffmpeg args do not contain %q: %s", want, args)
+	}
+}
+
+func TestNewFfmpegVMAF_WithFeatures(t *testing.T) {
+	tests := map[string]struct {
+		givenFeatures []string
+		want          string
+	}{
+		"Default features": {
+			givenFeatures: nil,
+			want:          ":ms_ssim=1:feature=name=psnr:",
+		},
+		"Single feature": {
+			givenFeatures: []string{"cambi"},
+			want:          ":feature=name=cambi:",
+		},
+		"Multiple features": {
+			givenFeatures: []string{"psnr", "float_ms_ssim", "cambi"},
+			want:          ":feature=name=psnr|name=float_ms_ssim|name=cambi:",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json", WithFeatures(tc.givenFeatures))
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+			if !strings.Contains(args, tc.want) {
+				t.Errorf("ffmpeg args do not contain %q: %s", tc.want, args)
+			}
+			if tc.givenFeatures != nil && strings.Contains(args, "ms_ssim=1") {
+				t.Errorf("ffmpeg args should not contain default features: %s", args)
+			}
+		})
+	}
+}
+
+func TestIsFeatureName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"psnr":          true,
+		"float_ms_ssim": true,
+		"":              false,
+		"psnr:x=1":      false,
+		"psnr|cambi":    false,
+	} {
+		if got := IsFeatureName(name); got != want {
+			t.Errorf("IsFeatureName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestVideoQualityMetrics_VMAFAsymmetry(t *testing.T) {
+	given := VideoQualityMetrics{VMAF: 90.5, VMAFReverse: 92}
+	if diff := cmp.Diff(1.5, given.VMAFAsymmetry()); diff != "" {
+		t.Errorf("VMAFAsymmetry() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFfmpegVMAF_unmarshalResultJSON(t *testing.T) {
+	tests := map[string]struct {
+		given   string
+		aliases FieldAliases
+		want    VideoQualityMetrics
+	}{
+		"Luma only PSNR": {
+			given: `{"pooled_metrics": {"vmaf": {"mean": 90}, "psnr": {"mean": 40}, "ms_ssim": {"mean": 0.99}}}`,
+			want:  VideoQualityMetrics{VMAF: 90, PSNR: 40, MS_SSIM: 0.99},
+		},
+		"Per plane PSNR": {
+			given: `{"pooled_metrics": {"vmaf": {"mean": 90}, "psnr_y": {"mean": 40}, "psnr_cb": {"mean": 45}, "psnr_cr": {"mean": 46}, "ms_ssim": {"mean": 0.99}}}`,
+			want:  VideoQualityMetrics{VMAF: 90, PSNR: 40, PSNR_CB: 45, PSNR_CR: 46, MS_SSIM: 0.99},
+		},
+		"Luma PSNR should not be clobbered by overall PSNR": {
+			given: `{"pooled_metrics": {"vmaf": {"mean": 90}, "psnr": {"mean": 42}, "psnr_y": {"mean": 40}, "psnr_cb": {"mean": 45}, "psnr_cr": {"mean": 46}}}`,
+			want:  VideoQualityMetrics{VMAF: 90, PSNR: 40, PSNR_CB: 45, PSNR_CR: 46, Absent: []string{"MS_SSIM"}},
+		},
+		"Float MS-SSIM": {
+			given: `{"pooled_metrics": {"vmaf": {"mean": 90}, "float_ms_ssim": {"mean": 0.98}}}`,
+			want:  VideoQualityMetrics{VMAF: 90, MS_SSIM: 0.98, Absent: []string{"PSNR"}},
+		},
+		"Configured aliases": {
+			given:   `{"pooled_metrics": {"vmaf_v2": {"mean": 91}, "vmaf": {"mean": 90}, "psnr_luma": {"mean": 41}}}`,
+			aliases: FieldAliases{"VMAF": {"vmaf_v2"}, "PSNR": {"psnr_luma"}},
+			want:    VideoQualityMetrics{VMAF: 91, PSNR: 41, Absent: []string{"MS_SSIM"}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &ffmpegVMAF{libvmafOptions: LibvmafOptions{FieldAliases: tc.aliases}}
+			got, err := f.unmarshalResultJSON([]byte(tc.given))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("VideoQualityMetrics mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFfmpegVMAF_unmarshalResultJSON_SampledFrames(t *testing.T) {
+	given := `{"frames": [{"frameNum": 0, "metrics": {"vmaf": 80}}, {"frameNum": 1, "metrics": {"vmaf": 70}}],
+		"pooled_metrics": {"vmaf": {"mean": 75}}}`
+	want := VideoQualityMetrics{
+		VMAF:          75,
+		SampledFrames: []SampledFrame{{Index: 10, VMAF: 80}, {Index: 250, VMAF: 70}},
+		Absent:        []string{"PSNR", "MS_SSIM"},
+	}
+	got, err := (&ffmpegVMAF{frames: []int{10, 250}}).unmarshalResultJSON([]byte(given))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("VideoQualityMetrics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewFfmpegVMAF_WithFrames(t *testing.T) {
+	tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json",
+		WithFrames([]int{250, 10, 10}), WithGeometry("scale=1920:1080"))
+	if err != nil {
+		t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+	}
+	args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+	want := `-lavfi [0:v]select=eq(n\,10)+eq(n\,250),scale=1920:1080[dis];[1:v]select=eq(n\,10)+eq(n\,250),scale=1920:1080[ref];[dis][ref]libvmaf=`
+	if !strings.Contains(args, want) {
+		t.Errorf("ffmpeg args do not contain %q: %s", want, args)
+	}
+}
+
+func TestNewFfmpegVMAF_WithUpscale(t *testing.T) {
+	src := video.Metadata{Width: 1080, Height: 1920, Rotation: 90}
+	tests := map[string]struct {
+		givenOpts []FfmpegVMAFOption
+		want      string
+	}{
+		"Upscale only": {
+			givenOpts: []FfmpegVMAFOption{WithUpscale("bicubic")},
+			want:      "-lavfi [0:v]scale=1920x1080:flags=bicubic[dis];[1:v]null[ref];[dis][ref]libvmaf=",
+		},
+		"Upscale before geometry": {
+			givenOpts: []FfmpegVMAFOption{WithUpscale("lanczos"), WithGeometry("crop=1920:800")},
+			want:      "-lavfi [0:v]scale=1920x1080:flags=lanczos,crop=1920:800[dis];[1:v]crop=1920:800[ref];[dis][ref]libvmaf=",
+		},
+		"No autorotate": {
+			givenOpts: []FfmpegVMAFOption{WithUpscale("bicubic"), WithNoAutorotate()},
+			want:      "[0:v]scale=1080x1920:flags=bicubic[dis]",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := append([]FfmpegVMAFOption{WithMetadata(video.Metadata{}, src)}, tc.givenOpts...)
+			tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json", opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+			if !strings.Contains(args, tc.want) {
+				t.Errorf("ffmpeg args do not contain %q: %s", tc.want, args)
+			}
+		})
+	}
+
+	t.Run("Should fail for unknown source resolution", func(t *testing.T) {
+		_, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json",
+			WithMetadata(video.Metadata{}, video.Metadata{}), WithUpscale("bicubic"))
+		if err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func Test_compareFrameCount(t *testing.T) {
+	tests := map[string]struct {
+		compressed int
+		source     int
+		tolerance  int
+		wantErr    bool
+	}{
+		"Equal":                  {compressed: 100, source: 100, tolerance: 0},
+		"Within tolerance":       {compressed: 99, source: 100, tolerance: 2},
+		"More within tolerance":  {compressed: 102, source: 100, tolerance: 2},
+		"Exceeds zero tolerance": {compressed: 101, source: 100, tolerance: 0, wantErr: true},
+		"Exceeds tolerance":      {compressed: 90, source: 100, tolerance: 2, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := compareFrameCount(tc.compressed, tc.source, tc.tolerance)
+			if diff := cmp.Diff(tc.wantErr, err != nil); diff != "" {
+				t.Errorf("Error mismatch (-want +got):\n%s\nerr: %v", diff, err)
+			}
+		})
+	}
+}
+
+func TestFfmpegVMAF_FrameCountToleranceNegative(t *testing.T) {
+	// Frame count check fails since files do not exist, ffmpeg is never run.
+	tool, err := NewFfmpegVMAF("ffmpeg", "4k", "nonexistent_compressed.mp4", "nonexistent_source.mp4", "result.json", WithFrameCountTolerance(0))
+	if err != nil {
+		t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+	}
+	if err := tool.Measure(); err == nil || !strings.Contains(err.Error(), "checkFrameCount()") {
+		t.Errorf("Expected frame count check error, got: %v", err)
+	}
+}
+
+func TestFfmpegVMAF_FrameCountWithMetadata(t *testing.T) {
+	// Known metadata is used instead of probing (files do not exist), frame
+	// count mismatch is reported before ffmpeg is run.
+	tool, err := NewFfmpegVMAF("ffmpeg", "4k", "nonexistent_compressed.mp4", "nonexistent_source.mp4", "result.json",
+		WithFrameCountTolerance(0),
+		WithMetadata(video.Metadata{FrameCount: 240}, video.Metadata{FrameCount: 250}))
+	if err != nil {
+		t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+	}
+	if err := tool.Measure(); err == nil || !strings.Contains(err.Error(), "frame count mismatch") {
+		t.Errorf("Expected frame count mismatch error, got: %v", err)
+	}
+}
+
+func TestNewFfmpegVMAF_FrameRateConversion(t *testing.T) {
+	tests := map[string]struct {
+		compressed video.Metadata
+		source     video.Metadata
+		want       string
+	}{
+		"Same frame rate": {
+			compressed: video.Metadata{AvgFrameRate: "30/1", FrameCount: 300},
+			source:     video.Metadata{AvgFrameRate: "30/1", FrameCount: 300},
+			want:       "",
+		},
+		"Unknown frame rate": {
+			compressed: video.Metadata{FrameCount: 600},
+			source:     video.Metadata{AvgFrameRate: "60/1", FrameCount: 600},
+			want:       "",
+		},
+		"Lower frame rate": {
+			compressed: video.Metadata{AvgFrameRate: "30/1", FrameCount: 300},
+			source:     video.Metadata{AvgFrameRate: "60000/1001", FrameCount: 599},
+			want:       "fps=60000/1001",
+		},
+		"Fallback to base frame rate": {
+			compressed: video.Metadata{AvgFrameRate: "50/1", FrameCount: 500},
+			source:     video.Metadata{AvgFrameRate: "0/0", FrameRate: "25/1", FrameCount: 250},
+			want:       "fps=25/1",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json",
+				WithMetadata(tc.compressed, tc.source), WithFrameCountTolerance(1), WithFrames([]int{10}))
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			f := tool.(*ffmpegVMAF)
+			if diff := cmp.Diff(tc.want, f.fpsFilter); diff != "" {
+				t.Errorf("fps filter mismatch (-want +got):\n%s", diff)
+			}
+			if tc.want != "" {
+				args := strings.Join(f.ffmpegArgs, " ")
+				want := fmt.Sprintf(`[0:v]%s,select=eq(n\,10)[dis];[1:v]select=eq(n\,10)[ref]`, tc.want)
+				if !strings.Contains(args, want) {
+					t.Errorf("ffmpeg args do not contain %q: %s", want, args)
+				}
+			}
+			// Frame counts match once compressed video is resampled.
+			if err := f.checkFrameCount(); err != nil {
+				t.Errorf("Unexpected frame count check error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFfmpegVMAF_run(t *testing.T) {
+	var out strings.Builder
+	f := &ffmpegVMAF{nice: 5}
+	cmd := exec.Command("sh", "-c", "nice")
+	cmd.Stdout = &out
+	if err := f.run(cmd); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("5", strings.TrimSpace(out.String())); diff != "" {
+		t.Errorf("Niceness mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLibvmafOptions_Validate(t *testing.T) {
+	tests := map[string]struct {
+		given   LibvmafOptions
+		wantErr bool
+	}{
+		"Defaults":              {given: LibvmafOptions{}},
+		"All set":               {given: LibvmafOptions{Pool: PoolHarmonicMean, NSubsample: 2, Shortest: true, TSSyncMode: "nearest"}},
+		"Invalid pool":          {given: LibvmafOptions{Pool: "max"}, wantErr: true},
+		"Negative subsample":    {given: LibvmafOptions{NSubsample: -1}, wantErr: true},
+		"Invalid sync mode":     {given: LibvmafOptions{TSSyncMode: "exact"}, wantErr: true},
+		"Negative max threads":  {given: LibvmafOptions{MaxThreads: -1}, wantErr: true},
+		"Invalid field aliases": {given: LibvmafOptions{FieldAliases: FieldAliases{"SSIM": {"ssim"}}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.given.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Error mismatch: wantErr=%v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLibvmafOptions_maxThreads(t *testing.T) {
+	tests := map[string]struct {
+		given LibvmafOptions
+		env   string
+		want  int
+	}{
+		"Default":          {want: defaultMaxThreads},
+		"Option":           {given: LibvmafOptions{MaxThreads: 64}, env: "8", want: 64},
+		"Environment":      {env: "8", want: 8},
+		"Invalid env":      {env: "many", want: defaultMaxThreads},
+		"Non-positive env": {env: "0", want: defaultMaxThreads},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(maxThreadsEnv, tc.env)
+			if got := tc.given.maxThreads(); got != tc.want {
+				t.Errorf("maxThreads() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func Test_nThreads(t *testing.T) {
+	tests := map[string]struct {
+		numCPU, max int
+		want        int
+		wantCapped  bool
+	}{
+		"Below cap": {numCPU: 8, max: 32, want: 8},
+		"At cap":    {numCPU: 32, max: 32, want: 32},
+		"Above cap": {numCPU: 128, max: 32, want: 32, wantCapped: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, capped := nThreads(tc.numCPU, tc.max)
+			if got != tc.want || capped != tc.wantCapped {
+				t.Errorf("nThreads() = (%d, %v), want (%d, %v)", got, capped, tc.want, tc.wantCapped)
+			}
+		})
+	}
+}
+
+func TestNewFfmpegVMAF_WithLibvmafOptions(t *testing.T) {
+	tests := map[string]struct {
+		given LibvmafOptions
+		want  string
+	}{
+		"Defaults": {
+			given: LibvmafOptions{},
+			want:  "libvmaf=n_subsample=1:log_path=",
+		},
+		"All set": {
+			given: LibvmafOptions{Pool: PoolHarmonicMean, NSubsample: 5, Shortest: true, TSSyncMode: "nearest"},
+			want:  "libvmaf=n_subsample=5:pool=harmonic_mean:shortest=1:ts_sync_mode=nearest:log_path=",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tool, err := NewFfmpegVMAF("ffmpeg", "4k", "compressed.mp4", "source.mp4", "result.json", WithLibvmafOptions(tc.given))
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			args := strings.Join(tool.(*ffmpegVMAF).ffmpegArgs, " ")
+			if !strings.Contains(args, tc.want) {
+				t.Errorf("ffmpeg args do not contain %q: %s", tc.want, args)
+			}
+		})
+	}
+}
+
+func TestFfmpegVMAF_unmarshalResultJSON_Pool(t *testing.T) {
+	given := `{"pooled_metrics": {"vmaf": {"min": 60, "mean": 90, "harmonic_mean": 88}, "psnr": {"min": 30, "mean": 40, "harmonic_mean": 39}}}`
+	tests := map[string]struct {
+		pool string
+		want VideoQualityMetrics
+	}{
+		"Default":       {pool: "", want: VideoQualityMetrics{VMAF: 90, PSNR: 40, Absent: []string{"MS_SSIM"}}},
+		"Harmonic mean": {pool: PoolHarmonicMean, want: VideoQualityMetrics{VMAF: 88, PSNR: 39, Absent: []string{"MS_SSIM"}}},
+		"Min":           {pool: PoolMin, want: VideoQualityMetrics{VMAF: 60, PSNR: 30, Absent: []string{"MS_SSIM"}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &ffmpegVMAF{libvmafOptions: LibvmafOptions{Pool: tc.pool}}
+			got, err := f.unmarshalResultJSON([]byte(given))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("VideoQualityMetrics mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_identicalFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := path.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	src := write("src.mp4", "video")
+	cpy := write("copy.mp4", "video")
+	other := write("other.mp4", "audio")
+	shorter := write("short.mp4", "vid")
+
+	tests := map[string]struct {
+		a, b string
+		want bool
+	}{
+		"Same path":         {a: src, b: src, want: true},
+		"Identical content": {a: src, b: cpy, want: true},
+		"Same size differs": {a: src, b: other, want: false},
+		"Different size":    {a: src, b: shorter, want: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := identicalFiles(tc.a, tc.b)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("identicalFiles() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Should fail for non-existent file", func(t *testing.T) {
+		if _, err := identicalFiles(src, path.Join(dir, "missing.mp4")); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func TestFfmpegVMAF_Resume(t *testing.T) {
+	validResult := `{"frames": [{"frameNum": 0, "metrics": {"vmaf": 80}}, {"frameNum": 1, "metrics": {"vmaf": 70}}],
+		"pooled_metrics": {"vmaf": {"mean": 75}}}`
+	tests := map[string]struct {
+		result     string
+		frameCount int
+		stale      bool
+		wantErr    string
+	}{
+		"Valid result":           {result: validResult, frameCount: 2},
+		"Frame count mismatch":   {result: validResult, frameCount: 3, wantErr: "frame count mismatch"},
+		"Truncated result":       {result: validResult[:40], frameCount: 2, wantErr: "unmarshal JSON"},
+		"Result older than file": {result: validResult, frameCount: 2, stale: true, wantErr: "older than compressed file"},
+		"Missing result":         {frameCount: 2, wantErr: "no such file"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			compressed := path.Join(dir, "compressed.mp4")
+			if err := os.WriteFile(compressed, []byte("compressed"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			resFile := path.Join(dir, "compressed_vqm.json")
+			if tc.result != "" {
+				if err := os.WriteFile(resFile, []byte(tc.result), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.stale {
+				future := time.Now().Add(time.Hour)
+				if err := os.Chtimes(compressed, future, future); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tool, err := NewFfmpegVMAF("ffmpeg", "4k", compressed, path.Join(dir, "source.mp4"), resFile,
+				WithMetadata(video.Metadata{FrameCount: tc.frameCount}, video.Metadata{FrameCount: tc.frameCount}))
+			if err != nil {
+				t.Fatalf("Unexpected error when calling NewFfmpegVMAF(): %v", err)
+			}
+			err = tool.(Resumer).Resume()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			res, err := tool.GetResult()
+			if err != nil {
+				t.Fatalf("Unexpected error from GetResult(): %v", err)
+			}
+			if res.Metrics.VMAF != 75 {
+				t.Errorf("Expected VMAF 75 from existing result, got %v", res.Metrics.VMAF)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// ease tool's ladder subcommand implementation.
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/evolution-gaming/ease/internal/analysis"
+	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/perm"
+	"github.com/evolution-gaming/ease/internal/tools"
+)
+
+// CreateLadderCommand will create Commander instance from LadderApp.
+func CreateLadderCommand() Commander {
+	longHelp := `Subcommand "ladder" will pivot report generated by "encode" stage into a
+quality ladder table: rows are bitrate targets, columns are resolutions and
+cells are VMAF (averaged across inputs). Rungs on the rate-distortion convex
+hull (best VMAF for their bitrate) are marked with "*".
+
+Bitrate target is scheme's TargetBitrate or "<n>k" tag in scheme name,
+resolution is "<w>x<h>" or "<h>p" tag in scheme name, otherwise they are
+derived from compressed file.
+
+Examples:
+
+  ease ladder -report encode_report.json
+  ease ladder -report encode_report.json -delimiter , -o ladder.csv`
+
+	app := &LadderApp{
+		fs: flag.NewFlagSet("ladder", flag.ContinueOnError),
+	}
+	app.fs.StringVar(&app.flSrcReport, "report", "", "Encoding report file (output from encoding stage, mandatory)")
+	app.fs.StringVar(&app.flOutFile, "o", "", "File to write ladder table to, default is stdout")
+	app.fs.Var(delimiterFlag{&app.flDelimiter}, "delimiter", `Write ladder table as delimiter separated values (e.g. "," or "tab") instead of aligned text`)
+
+	app.fs.Usage = func() {
+		printSubCommandUsage(longHelp, app.fs)
+	}
+
+	return app
+}
+
+// Make sure LadderApp implements Commander interface.
+var _ Commander = (*LadderApp)(nil)
+
+// LadderApp is ladder subcommand context that implements Commander interface.
+type LadderApp struct {
+	// FlagSet instance
+	fs *flag.FlagSet
+	// Encoding report file
+	flSrcReport string
+	// Ladder table output file
+	flOutFile string
+	// Field delimiter of delimited output, 0 means aligned text table
+	flDelimiter rune
+}
+
+func (a *LadderApp) Name() string {
+	return a.fs.Name()
+}
+
+func (a *LadderApp) Help() {
+	a.fs.Usage()
+}
+
+// Run is entry point to LadderApp command execution.
+func (a *LadderApp) Run(args []string) error {
+	if err := a.fs.Parse(args); err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      "usage error",
+		}
+	}
+
+	if a.flSrcReport == "" {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "mandatory option -report is missing",
+		}
+	}
+
+	if _, err := os.Stat(a.flSrcReport); err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("report file does not exist? %s", err),
+		}
+	}
+
+	l := newLadder(parseReportFile(a.flSrcReport), probeResolution)
+	if len(l.Targets) == 0 {
+		return &AppError{
+			exitCode: 1,
+			msg:      "no encodes with VMAF and bitrate in report",
+		}
+	}
+
+	out := io.Writer(os.Stdout)
+	if a.flOutFile != "" {
+		fd, err := perm.Create(a.flOutFile)
+		if err != nil {
+			return &AppError{
+				exitCode: 1,
+				msg:      err.Error(),
+			}
+		}
+		defer fd.Close()
+		out = fd
+	}
+
+	write := writeLadder
+	switch {
+	case a.flDelimiter != 0:
+		write = delimitedLadderWriter(a.flDelimiter)
+	case porcelain:
+		write = func(w io.Writer, l ladder) error { return writePorcelain(w, ladderRungs(l)) }
+	}
+	if err := write(out, l); err != nil {
+		return &AppError{
+			exitCode: 1,
+			msg:      err.Error(),
+		}
+	}
+	if a.flOutFile != "" {
+		logging.Infof("Ladder table done: %s", a.flOutFile)
+	}
+
+	return nil
+}
+
+// ladderResolution is a ladder column.
+type ladderResolution struct {
+	// Label is resolution as shown in table header (e.g. "1280x720" or "720p")
+	Label string
+	// Height is frame height used to order columns
+	Height int
+}
+
+// ladderKey identifies ladder cell.
+type ladderKey struct {
+	Target     float64
+	Resolution string
+}
+
+// ladderCell holds metrics of encodes in ladder cell averaged across inputs.
+type ladderCell struct {
+	// Bitrate is average measured bitrate in kbit/s
+	Bitrate float64
+	VMAF    float64
+	// Optimal is set for cells on rate-distortion convex hull
+	Optimal bool
+	// Encodes is a number of encodes averaged
+	Encodes int
+}
+
+// ladder is quality ladder matrix, rows are bitrate targets (kbit/s) and
+// columns are resolutions.
+type ladder struct {
+	// Targets are sorted in ascending order
+	Targets []float64
+	// Resolutions are sorted by height in descending order
+	Resolutions []ladderResolution
+	Cells       map[ladderKey]*ladderCell
+}
+
+var (
+	// reLadderSize matches "<width>x<height>" tag in scheme name.
+	reLadderSize = regexp.MustCompile(`(?:^|[^0-9A-Za-z])((\d{2,5})x(\d{2,5}))(?:$|[^0-9A-Za-z])`)
+	// reLadderHeight matches "<height>p" tag in scheme name, tags are
+	// delimited by non-alphanumeric characters (e.g. "x264_720p_1500k").
+	reLadderHeight = regexp.MustCompile(`(?i)(?:^|[^0-9A-Za-z])(\d{3,4})p(?:$|[^0-9A-Za-z])`)
+	// reLadderBitrate matches "<kbps>k" tag in scheme name.
+	reLadderBitrate = regexp.MustCompile(`(?i)(?:^|[^0-9A-Za-z])(\d+(?:\.\d+)?)k(?:bps)?(?:$|[^0-9A-Za-z])`)
+)
+
+// resolutionProbe returns frame dimensions of given video file.
+type resolutionProbe func(videoFile string) (width, height int, err error)
+
+// probeResolution is resolutionProbe using ffprobe.
+func probeResolution(videoFile string) (width, height int, err error) {
+	vmeta, err := tools.FfprobeExtractMetadata(videoFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	width, height = vmeta.DisplaySize()
+	return width, height, nil
+}
+
+// ladderResolutionOf returns ladder resolution from scheme name tag, falling
+// back to probing compressed file.
+func ladderResolutionOf(name, compressedFile string, probe resolutionProbe) (ladderResolution, error) {
+	if m := reLadderSize.FindStringSubmatch(name); m != nil {
+		h, _ := strconv.Atoi(m[3])
+		return ladderResolution{Label: m[1], Height: h}, nil
+	}
+	if m := reLadderHeight.FindStringSubmatch(name); m != nil {
+		h, _ := strconv.Atoi(m[1])
+		return ladderResolution{Label: m[1] + "p", Height: h}, nil
+	}
+	w, h, err := probe(compressedFile)
+	if err != nil {
+		return ladderResolution{}, err
+	}
+	return ladderResolution{Label: fmt.Sprintf("%dx%d", w, h), Height: h}, nil
+}
+
+// ladderTargetOf returns ladder bitrate target from scheme's TargetBitrate or
+// scheme name tag, falling back to measured bitrate rounded to kbit/s.
+func ladderTargetOf(name string, targetBitrate, bitrate float64) float64 {
+	if targetBitrate > 0 {
+		return targetBitrate
+	}
+	if m := reLadderBitrate.FindStringSubmatch(name); m != nil {
+		if v, err := strconv.ParseFloat(m[1], 64); err == nil && v > 0 {
+			return v
+		}
+	}
+	return float64(int64(bitrate + 0.5))
+}
+
+// newLadder pivots report into quality ladder.
+//
+// Remuxes and encodes without VMAF or bitrate (e.g. failed encodes) are
+// skipped, as are encodes whose resolution can not be determined.
+func newLadder(r *report, probe resolutionProbe) ladder {
+	rows := newSummary(r)
+	byFile := make(map[string]*summaryRow, len(rows))
+	for i := range rows {
+		byFile[rows[i].CompressedFile] = &rows[i]
+	}
+
+	l := ladder{Cells: make(map[ladderKey]*ladderCell)}
+	targets := make(map[float64]bool)
+	resolutions := make(map[string]ladderResolution)
+	for i := range r.EncodingResult.RunResults {
+		v := &r.EncodingResult.RunResults[i]
+		row := byFile[v.CompressedFile]
+		if v.RemuxOf != "" || row == nil || row.VMAF == 0 || row.Bitrate == 0 {
+			continue
+		}
+		compressedFile := v.CompressedFile
+		if !path.IsAbs(compressedFile) {
+			compressedFile = path.Join(v.WorkDir, compressedFile)
+		}
+		res, err := ladderResolutionOf(v.Name, compressedFile, probe)
+		if err != nil {
+			logging.Debugf("Skipping %s from ladder, unknown resolution: %s", v.CompressedFile, err)
+			continue
+		}
+		target := ladderTargetOf(v.Name, v.TargetBitrate, row.Bitrate)
+
+		key := ladderKey{Target: target, Resolution: res.Label}
+		c, ok := l.Cells[key]
+		if !ok {
+			c = &ladderCell{}
+			l.Cells[key] = c
+		}
+		// Running averages across inputs.
+		c.Encodes++
+		c.Bitrate += (row.Bitrate - c.Bitrate) / float64(c.Encodes)
+		c.VMAF += (row.VMAF - c.VMAF) / float64(c.Encodes)
+
+		targets[target] = true
+		resolutions[res.Label] = res
+	}
+
+	for t := range targets {
+		l.Targets = append(l.Targets, t)
+	}
+	sort.Float64s(l.Targets)
+	for _, res := range resolutions {
+		l.Resolutions = append(l.Resolutions, res)
+	}
+	sort.Slice(l.Resolutions, func(i, j int) bool {
+		if l.Resolutions[i].Height != l.Resolutions[j].Height {
+			return l.Resolutions[i].Height > l.Resolutions[j].Height
+		}
+		return l.Resolutions[i].Label < l.Resolutions[j].Label
+	})
+
+	// Mark cells on convex hull of all cells' RD points.
+	points := make([]analysis.RDPoint, 0, len(l.Cells))
+	for _, c := range l.Cells {
+		points = append(points, analysis.RDPoint{Bitrate: c.Bitrate, VMAF: c.VMAF})
+	}
+	optimal := make(map[analysis.RDPoint]bool)
+	for _, p := range analysis.ConvexHull(points) {
+		optimal[p] = true
+	}
+	for _, c := range l.Cells {
+		c.Optimal = optimal[analysis.RDPoint{Bitrate: c.Bitrate, VMAF: c.VMAF}]
+	}
+
+	return l
+}
+
+// ladderRung is a ladder cell along with its row and column.
+type ladderRung struct {
+	// Target is bitrate target in kbit/s
+	Target     float64
+	Resolution string
+	Bitrate    float64
+	VMAF       float64
+	Optimal    bool
+	Encodes    int
+}
+
+// ladderRungs returns non-empty ladder cells ordered by target and then
+// resolution (same order as in ladder table).
+func ladderRungs(l ladder) []ladderRung {
+	var rungs []ladderRung
+	for _, t := range l.Targets {
+		for _, res := range l.Resolutions {
+			if c, ok := l.Cells[ladderKey{Target: t, Resolution: res.Label}]; ok {
+				rungs = append(rungs, ladderRung{
+					Target:     t,
+					Resolution: res.Label,
+					Bitrate:    c.Bitrate,
+					VMAF:       c.VMAF,
+					Optimal:    c.Optimal,
+					Encodes:    c.Encodes,
+				})
+			}
+		}
+	}
+	return rungs
+}
+
+// ladderRecords returns ladder as table records including header, missing
+// cells are "-" and optimal cells are suffixed with "*".
+func ladderRecords(l ladder, targetHeader string) [][]string {
+	header := []string{targetHeader}
+	for _, res := range l.Resolutions {
+		header = append(header, res.Label)
+	}
+	records := [][]string{header}
+	for _, t := range l.Targets {
+		record := []string{strconv.FormatFloat(t, 'f', -1, 64)}
+		for _, res := range l.Resolutions {
+			c, ok := l.Cells[ladderKey{Target: t, Resolution: res.Label}]
+			if !ok {
+				record = append(record, "-")
+				continue
+			}
+			cell := strconv.FormatFloat(c.VMAF, 'f', 2, 64)
+			if c.Optimal {
+				cell += "*"
+			}
+			record = append(record, cell)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// ladderWriter writes ladder in some format.
+type ladderWriter func(w io.Writer, l ladder) error
+
+// writeLadder writes ladder as aligned text table.
+func writeLadder(w io.Writer, l ladder) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, record := range ladderRecords(l, "TARGET (kbps)") {
+		for i, f := range record {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, f)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// delimitedLadderWriter returns ladderWriter that writes ladder as delimiter
+// separated values (CSV) with given field delimiter.
+func delimitedLadderWriter(comma rune) ladderWriter {
+	return func(w io.Writer, l ladder) error {
+		cw := csv.NewWriter(w)
+		cw.Comma = comma
+		if err := cw.WriteAll(ladderRecords(l, "Target")); err != nil {
+			return fmt.Errorf("delimitedLadderWriter() %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tests for quality ladder table.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/vqm"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_newLadder(t *testing.T) {
+	dir := t.TempDir()
+	var results []encoding.RunResult
+	var vqms []namedVqmResult
+	// add creates 1 second long compressed file of given bitrate with VMAF.
+	add := func(ec encoding.EncoderCmd, kbps int, vmaf float64) {
+		ec.WorkDir = dir
+		if err := os.WriteFile(path.Join(dir, ec.CompressedFile), make([]byte, kbps*1000/8), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, encoding.RunResult{EncoderCmd: ec, VideoDuration: 1})
+		vqms = append(vqms, namedVqmResult{Result: vqm.Result{CompressedFile: ec.CompressedFile, Metrics: vqm.VideoQualityMetrics{VMAF: vmaf}}})
+	}
+	add(encoding.EncoderCmd{Name: "x264_1080p_1000k", SourceFile: "a.mp4", CompressedFile: "1.mp4"}, 1000, 80)
+	add(encoding.EncoderCmd{Name: "x264_720p_1000k", SourceFile: "a.mp4", CompressedFile: "2.mp4"}, 1000, 85)
+	add(encoding.EncoderCmd{Name: "x264_1080p_3000k", SourceFile: "a.mp4", CompressedFile: "3.mp4"}, 3000, 95)
+	add(encoding.EncoderCmd{Name: "x264_1080p_3000k", SourceFile: "b.mp4", CompressedFile: "4.mp4"}, 3000, 93)
+	add(encoding.EncoderCmd{Name: "x264_720p_3000k", SourceFile: "a.mp4", CompressedFile: "5.mp4"}, 3000, 90)
+	add(encoding.EncoderCmd{Name: "x264_360p", SourceFile: "a.mp4", CompressedFile: "6.mp4", TargetBitrate: 500}, 500, 60)
+	// Resolution from compressed file.
+	add(encoding.EncoderCmd{Name: "x264 2000k", SourceFile: "a.mp4", CompressedFile: "7.mp4"}, 2000, 88)
+	// Remux and encode of unknown resolution are skipped.
+	add(encoding.EncoderCmd{Name: "x264_720p_1000k", SourceFile: "a.mp4", CompressedFile: "2.mkv", RemuxOf: "2.mp4"}, 1000, 85)
+	add(encoding.EncoderCmd{Name: "unknown", SourceFile: "a.mp4", CompressedFile: "8.mp4"}, 1000, 99)
+
+	probe := func(videoFile string) (int, int, error) {
+		if videoFile == path.Join(dir, "7.mp4") {
+			return 640, 360, nil
+		}
+		return 0, 0, errors.New("probe failed")
+	}
+	l := newLadder(&report{
+		EncodingResult: encoding.PlanResult{RunResults: results},
+		VQMResults:     vqms,
+	}, probe)
+
+	want := `TARGET (kbps)  1080p   720p    360p    640x360
+500            -       -       60.00*  -
+1000           80.00   85.00*  -       -
+2000           -       -       -       88.00
+3000           94.00*  90.00   -       -
+`
+	var buf bytes.Buffer
+	if err := writeLadder(&buf, l); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Ladder table mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("Should list ladder rungs", func(t *testing.T) {
+		want := []ladderRung{
+			{Target: 500, Resolution: "360p", Bitrate: 500, VMAF: 60, Optimal: true, Encodes: 1},
+			{Target: 1000, Resolution: "1080p", Bitrate: 1000, VMAF: 80, Encodes: 1},
+			{Target: 1000, Resolution: "720p", Bitrate: 1000, VMAF: 85, Optimal: true, Encodes: 1},
+			{Target: 2000, Resolution: "640x360", Bitrate: 2000, VMAF: 88, Encodes: 1},
+			{Target: 3000, Resolution: "1080p", Bitrate: 3000, VMAF: 94, Optimal: true, Encodes: 2},
+			{Target: 3000, Resolution: "720p", Bitrate: 3000, VMAF: 90, Encodes: 1},
+		}
+		if diff := cmp.Diff(want, ladderRungs(l)); diff != "" {
+			t.Errorf("Ladder rungs mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Should write delimited ladder table", func(t *testing.T) {
+		want := `Target;1080p;720p;360p;640x360
+500;-;-;60.00*;-
+1000;80.00;85.00*;-;-
+2000;-;-;-;88.00
+3000;94.00*;90.00;-;-
+`
+		var buf bytes.Buffer
+		if err := delimitedLadderWriter(';')(&buf, l); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(want, buf.String()); diff != "" {
+			t.Errorf("Delimited ladder table mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func Test_ladderTargetOf(t *testing.T) {
+	tests := map[string]struct {
+		name          string
+		targetBitrate float64
+		bitrate       float64
+		want          float64
+	}{
+		"TargetBitrate":      {name: "x264_500k", targetBitrate: 800, bitrate: 750.4, want: 800},
+		"Name tag":           {name: "x264_720p_1500k", bitrate: 1402.1, want: 1500},
+		"Name tag with kbps": {name: "hevc 2500kbps", bitrate: 2444, want: 2500},
+		"Measured bitrate":   {name: "x264_720p", bitrate: 1402.6, want: 1403},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := ladderTargetOf(tc.name, tc.targetBitrate, tc.bitrate)
+			if got != tc.want {
+				t.Errorf("Target mismatch, want %v got %v", tc.want, got)
+			}
+		})
+	}
+}
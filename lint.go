@@ -0,0 +1,139 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// ease tool's lint subcommand implementation.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+)
+
+// CreateLintCommand will create Commander instance from LintApp.
+func CreateLintCommand() Commander {
+	longHelp := `Subcommand "lint" will check encoding plan for likely mistakes without
+running it. Warnings (e.g. missing -an) are reported but do not fail, errors
+(e.g. schemes writing to the same output file) do.
+
+Examples:
+
+  ease lint -plan plan.json`
+
+	app := &LintApp{
+		fs: flag.NewFlagSet("lint", flag.ContinueOnError),
+	}
+	app.fs.StringVar(&app.flPlan, "plan", "", "Encoding plan configuration file")
+
+	app.fs.Usage = func() {
+		printSubCommandUsage(longHelp, app.fs)
+	}
+
+	return app
+}
+
+// Make sure LintApp implements Commander interface.
+var _ Commander = (*LintApp)(nil)
+
+// LintApp is lint subcommand context that implements Commander interface.
+type LintApp struct {
+	// FlagSet instance
+	fs *flag.FlagSet
+	// Encoding plan config file
+	flPlan string
+}
+
+func (a *LintApp) Name() string {
+	return a.fs.Name()
+}
+
+func (a *LintApp) Help() {
+	a.fs.Usage()
+}
+
+// Run is entry point to LintApp command execution.
+func (a *LintApp) Run(args []string) error {
+	if err := a.fs.Parse(args); err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      "usage error",
+		}
+	}
+
+	if a.flPlan == "" {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "mandatory option -plan is missing",
+		}
+	}
+
+	pc, err := loadPlanConfig(a.flPlan)
+	if err != nil {
+		return &AppError{exitCode: exitConfig, msg: err.Error()}
+	}
+
+	var errCount int
+	if porcelain {
+		issues := lintIssues(pc)
+		if err := writePorcelain(os.Stdout, issues); err != nil {
+			return &AppError{exitCode: 1, msg: err.Error()}
+		}
+		errCount = lintErrors(issues)
+	} else {
+		errCount = writeLintReport(os.Stdout, pc)
+	}
+	if errCount > 0 {
+		return &AppError{
+			exitCode: exitConfig,
+			msg:      fmt.Sprintf("lint found %d error(s)", errCount),
+		}
+	}
+
+	return nil
+}
+
+// lintIssues returns validation errors (as fatal issues), validation warnings
+// and lint issues of pc.
+func lintIssues(pc encoding.PlanConfig) (issues []encoding.LintIssue) {
+	warnings, err := pc.Validate()
+	if err != nil {
+		ev := &encoding.PlanConfigError{}
+		if !errors.As(err, &ev) {
+			return []encoding.LintIssue{{Fatal: true, Message: err.Error()}}
+		}
+		for _, r := range ev.Reasons() {
+			issues = append(issues, encoding.LintIssue{Fatal: true, Message: r})
+		}
+	}
+	for _, w := range warnings {
+		issues = append(issues, encoding.LintIssue{Message: w})
+	}
+	return append(issues, pc.Lint()...)
+}
+
+// lintErrors returns number of fatal issues.
+func lintErrors(issues []encoding.LintIssue) (errCount int) {
+	for _, i := range issues {
+		if i.Fatal {
+			errCount++
+		}
+	}
+	return errCount
+}
+
+// writeLintReport will write validation failures and lint issues of pc to w,
+// returns number of errors (validation failures are errors too).
+func writeLintReport(w io.Writer, pc encoding.PlanConfig) (errCount int) {
+	issues := lintIssues(pc)
+	for _, i := range issues {
+		fmt.Fprintln(w, i)
+	}
+	return lintErrors(issues)
+}
@@ -11,8 +11,11 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"syscall"
 
 	"github.com/evolution-gaming/ease/internal/logging"
+	"github.com/evolution-gaming/ease/internal/perm"
+	"github.com/evolution-gaming/ease/internal/tools"
 )
 
 var commandName = "ease"
@@ -29,6 +32,15 @@ func root() error {
 	fs := flag.NewFlagSet(commandName, flag.ExitOnError)
 	fs.BoolVar(&flVersion, "version", false, "Print version")
 	fs.BoolVar(&flDebug, "debug", false, "Run in debug mode")
+	fs.Var(fileModeFlag{&perm.DirMode}, "dir-mode", "Permissions (octal) for created output directories")
+	fs.Var(fileModeFlag{&perm.FileMode}, "file-mode", "Permissions (octal) for created output files")
+	var flUmask string
+	fs.StringVar(&flUmask, "umask", "", "Process umask (octal), also applies to files created by encoder commands")
+	var flMaxProcs int
+	fs.IntVar(&flMaxProcs, "max-procs", 0, "Maximum number of concurrently running ffmpeg/ffprobe child processes, 0 means no limit")
+	var flProbeAttempts int
+	fs.IntVar(&flProbeAttempts, "probe-attempts", tools.DefaultProbeAttempts, "Number of ffprobe attempts when probing video metadata, failed attempts are retried with backoff")
+	registerPorcelainFlag(fs)
 
 	// Register all subcommands here.
 	subCmds := []Commander{
@@ -36,6 +48,12 @@ func root() error {
 		CreateAnalyseCommand(),
 		CreateBitrateCommand(),
 		CreateVQMPlotCommand(),
+		CreateRDPlotCommand(),
+		CreateLadderCommand(),
+		CreateDoctorCommand(),
+		CreateLintCommand(),
+		CreateHistoryCommand(),
+		CreateGenSampleCommand(),
 	}
 
 	// Custom Usage function that also calls into subcommand help output.
@@ -83,6 +101,40 @@ func root() error {
 		return nil
 	}
 
+	// Set umask early, so that it applies to all created files including ones
+	// created by encoder commands.
+	if flUmask != "" {
+		mask, err := parseFileMode(flUmask)
+		if err != nil {
+			return &AppError{
+				msg:      fmt.Sprintf("-umask: %s", err),
+				exitCode: 2,
+			}
+		}
+		syscall.Umask(int(mask))
+	}
+
+	if flMaxProcs < 0 {
+		return &AppError{
+			msg:      fmt.Sprintf("-max-procs negative: %d", flMaxProcs),
+			exitCode: 2,
+		}
+	}
+	tools.SetProcessLimit(flMaxProcs)
+
+	if flProbeAttempts < 1 {
+		return &AppError{
+			msg:      fmt.Sprintf("-probe-attempts should be positive: %d", flProbeAttempts),
+			exitCode: 2,
+		}
+	}
+	tools.SetProbeAttempts(flProbeAttempts)
+
+	// Only structured results and errors are wanted in porcelain mode.
+	if porcelain {
+		logging.DisableInfoLogger()
+	}
+
 	// Set debug mode. For now it only means enabling debug logging.
 	if flDebug {
 		logging.EnableDebugLogger()
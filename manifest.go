@@ -0,0 +1,88 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Encoding run reproducibility manifest related functionality.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/perm"
+)
+
+// manifestFile is a file name of manifest written into plan's OutDir.
+const manifestFile = "manifest.json"
+
+// manifest captures everything needed to reproduce an encoding run.
+type manifest struct {
+	CreatedAt time.Time
+	Ease      manifestEase
+	Tools     manifestTools
+	// Plan is encoding plan configuration as used for this run
+	Plan encoding.PlanConfig
+	// Commands are expanded encoder commands executed for this run
+	Commands []encoding.EncoderCmd
+}
+
+// manifestEase holds ease tool version information.
+type manifestEase struct {
+	Version  string
+	Revision string `json:",omitempty"`
+}
+
+// manifestTools holds resolved external tool dependencies.
+type manifestTools struct {
+	FfmpegPath    string
+	FfmpegVersion string
+	// Default libvmaf model, per input models are part of Plan
+	LibvmafModel string
+}
+
+// newManifest creates manifest for given plan and tools.
+func newManifest(plan *encoding.Plan, tools manifestTools) manifest {
+	return manifest{
+		CreatedAt: time.Now(),
+		Ease: manifestEase{
+			Version:  vInfo.version,
+			Revision: vInfo.revision,
+		},
+		Tools:    tools,
+		Plan:     plan.PlanConfig,
+		Commands: plan.Commands,
+	}
+}
+
+// writeManifest will write manifest as JSON into outDir.
+func writeManifest(m manifest, outDir string) error {
+	if err := perm.MkdirAll(outDir); err != nil {
+		return fmt.Errorf("writeManifest() perm.MkdirAll: %w", err)
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("writeManifest() json.MarshalIndent: %w", err)
+	}
+	if err := perm.WriteFile(path.Join(outDir, manifestFile), b); err != nil {
+		return fmt.Errorf("writeManifest() perm.WriteFile: %w", err)
+	}
+	return nil
+}
+
+// writeEffectivePlan will write effective plan (see
+// encoding.Plan.EffectivePlanConfig) as JSON plan configuration file, so that
+// exactly the same encodings can be re-run later via "encode -plan".
+func writeEffectivePlan(plan *encoding.Plan, name string) error {
+	b, err := json.MarshalIndent(plan.EffectivePlanConfig(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("writeEffectivePlan() json.MarshalIndent: %w", err)
+	}
+	if err := perm.WriteFile(name, b); err != nil {
+		return fmt.Errorf("writeEffectivePlan() perm.WriteFile: %w", err)
+	}
+	return nil
+}
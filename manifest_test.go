@@ -0,0 +1,150 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tests for encoding run reproducibility manifest.
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_writeManifest(t *testing.T) {
+	outDir := path.Join(t.TempDir(), "out")
+	plan := encoding.NewPlan(encoding.PlanConfig{
+		OutDir:  outDir,
+		Inputs:  []string{"clip01.mp4"},
+		Schemes: []encoding.Scheme{{Name: "sc1", CommandTpl: "ffmpeg -i %INPUT% %OUTPUT%.mp4"}},
+	})
+	given := newManifest(&plan, manifestTools{FfmpegPath: "/usr/bin/ffmpeg", LibvmafModel: "/model.json"})
+
+	if err := writeManifest(given, outDir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	b, err := os.ReadFile(path.Join(outDir, manifestFile))
+	if err != nil {
+		t.Fatalf("Unexpected error reading manifest: %v", err)
+	}
+	var got manifest
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unexpected error parsing manifest: %v", err)
+	}
+	if diff := cmp.Diff(given, got); diff != "" {
+		t.Errorf("Manifest mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_manifestPlanRoundTrip(t *testing.T) {
+	planDir := t.TempDir()
+	if err := os.WriteFile(path.Join(planDir, "clip01.mp4"), nil, 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	planFile := path.Join(planDir, "plan.json")
+	payload := []byte(`{
+		"OutDir": "out",
+		"Inputs": ["clip01.mp4"],
+		"Schemes": [{"Name": "sc1", "CommandTpl": ["cp %INPUT% %OUTPUT%.mp4"]}]
+	}`)
+	if err := os.WriteFile(planFile, payload, 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Plan file given relative to working directory should not matter.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if planFile, err = filepath.Rel(wd, planFile); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	plan, err := createPlanFromJSONConfig(planFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Plan section of manifest written elsewhere should load back into the
+	// same effective plan configuration.
+	b, err := json.Marshal(newManifest(&plan, manifestTools{}).Plan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dumpFile := path.Join(t.TempDir(), "nested", "plan.json")
+	if err := os.MkdirAll(path.Dir(dumpFile), 0o755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.WriteFile(dumpFile, b, 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := createPlanFromJSONConfig(dumpFile)
+	if err != nil {
+		t.Fatalf("Unexpected error loading dumped plan: %v", err)
+	}
+	if diff := cmp.Diff(plan.PlanConfig, got.PlanConfig); diff != "" {
+		t.Errorf("PlanConfig mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(plan.Commands, got.Commands); diff != "" {
+		t.Errorf("Commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_writeEffectivePlan(t *testing.T) {
+	planDir := t.TempDir()
+	for _, f := range []string{"clip01.mp4", "clip02.y4m"} {
+		if err := os.WriteFile(path.Join(planDir, f), nil, 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	planFile := path.Join(planDir, "plan.json")
+	payload := []byte(`{
+		"OutDir": "out",
+		"Inputs": ["clip01.mp4", "clip02.y4m"],
+		"GlobalArgs": "-threads 2",
+		"LogLevel": "error",
+		"InputOptions": [{"Input": "*.y4m", "FrameRate": "25"}],
+		"Schemes": [
+			{"Name": "sc1", "CommandTpl": ["ffmpeg -i %INPUT% -an %OUTPUT%.mp4"], "Remux": ["mkv"]},
+			{"Name": "sc2", "CommandTpl": ["ffmpeg -i %INPUT% -an -crf 30 %OUTPUT%.mp4"]}
+		]
+	}`)
+	if err := os.WriteFile(planFile, payload, 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	plan, err := createPlanFromJSONConfig(planFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dumpFile := path.Join(t.TempDir(), "effective.json")
+	if err := writeEffectivePlan(&plan, dumpFile); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := createPlanFromJSONConfig(dumpFile)
+	if err != nil {
+		t.Fatalf("Unexpected error loading effective plan: %v", err)
+	}
+
+	t.Run("Should have scheme per encoder command", func(t *testing.T) {
+		if diff := cmp.Diff(4, len(got.Schemes)); diff != "" {
+			t.Errorf("Scheme count mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should have global and input arguments in templates", func(t *testing.T) {
+		want := "ffmpeg -loglevel error -threads 2 -framerate 25 -i %INPUT% -an %OUTPUT%.mp4"
+		if diff := cmp.Diff(want, got.Schemes[1].CommandTpl); diff != "" {
+			t.Errorf("CommandTpl mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Should expand to the same commands", func(t *testing.T) {
+		if diff := cmp.Diff(plan.Commands, got.Commands); diff != "" {
+			t.Errorf("Commands mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
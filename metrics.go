@@ -0,0 +1,127 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Encoding run metrics in Prometheus text exposition format.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+	"github.com/evolution-gaming/ease/internal/vqm"
+)
+
+// metricSample is a single labeled sample of per encode metric.
+type metricSample struct {
+	scheme, input string
+	value         float64
+}
+
+// metricFamily is a named gauge with per encode samples.
+type metricFamily struct {
+	name, help string
+	samples    []metricSample
+}
+
+// newMetricFamilies creates metric families from report, samples are labeled
+// by scheme name and input (source file base name).
+func newMetricFamilies(r *report) []metricFamily {
+	metrics := make(map[string]vqm.VideoQualityMetrics, len(r.VQMResults))
+	for i := range r.VQMResults {
+		v := &r.VQMResults[i]
+		metrics[v.CompressedFile] = v.Metrics
+	}
+
+	rows := newSummary(r)
+	// Keep output stable between runs.
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Name != rows[j].Name {
+			return rows[i].Name < rows[j].Name
+		}
+		return rows[i].SourceFile < rows[j].SourceFile
+	})
+
+	families := []metricFamily{
+		{name: "ease_vmaf_mean", help: "Mean VMAF of encode."},
+		{name: "ease_psnr_mean", help: "Mean luma PSNR of encode."},
+		{name: "ease_ms_ssim_mean", help: "Mean MS-SSIM of encode."},
+		{name: "ease_bitrate_kbps", help: "Average bitrate of encode in kbit/s."},
+		{name: "ease_size_bytes", help: "Compressed file size in bytes."},
+		{name: "ease_encoding_speed", help: "Average encoding speed (x realtime)."},
+	}
+	for i := range rows {
+		row := &rows[i]
+		m, ok := metrics[row.CompressedFile]
+		values := []float64{m.VMAF, m.PSNR, m.MS_SSIM, row.Bitrate, float64(row.Size), row.Speed}
+		for j := range families {
+			// Encodes without VQMs have no quality samples.
+			if j < 3 && !ok {
+				continue
+			}
+			families[j].samples = append(families[j].samples, metricSample{
+				scheme: row.Name,
+				input:  path.Base(row.SourceFile),
+				value:  values[j],
+			})
+		}
+	}
+	return families
+}
+
+// writeMetrics will write report metrics to w in Prometheus text exposition
+// format.
+func writeMetrics(w io.Writer, r *report) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range newMetricFamilies(r) {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", f.name)
+		for _, s := range f.samples {
+			fmt.Fprintf(bw, "%s{scheme=\"%s\",input=\"%s\"} %s\n",
+				f.name, escapeLabelValue(s.scheme), escapeLabelValue(s.input),
+				strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	return bw.Flush()
+}
+
+// labelValueEscaper escapes label value as required by Prometheus text format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+// writeMetricsFile will write report metrics into file. File is written
+// atomically (via temporary file and rename), so that collectors (e.g.
+// node_exporter textfile collector) never see partially written file.
+func writeMetricsFile(r *report, name string) error {
+	tmp := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	fd, err := perm.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("writeMetricsFile() perm.Create: %w", err)
+	}
+	if err := writeMetrics(fd, r); err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("writeMetricsFile() %w", err)
+	}
+	if err := fd.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writeMetricsFile() %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writeMetricsFile() os.Rename: %w", err)
+	}
+	return nil
+}
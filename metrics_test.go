@@ -0,0 +1,68 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tests for Prometheus metrics output.
+package main
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/vqm"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_writeMetrics(t *testing.T) {
+	given := &report{
+		EncodingResult: encoding.PlanResult{
+			RunResults: []encoding.RunResult{
+				{EncoderCmd: encoding.EncoderCmd{Name: "x264", SourceFile: "/src/clip01.mp4", CompressedFile: "a.mp4"}, AvgEncodingSpeed: 2},
+				{EncoderCmd: encoding.EncoderCmd{Name: `x"265`, SourceFile: "/src/clip01.mp4", CompressedFile: "b.mp4"}},
+			},
+		},
+		VQMResults: []namedVqmResult{
+			{Result: vqm.Result{CompressedFile: "a.mp4", Metrics: vqm.VideoQualityMetrics{VMAF: 93.2, PSNR: 40, MS_SSIM: 0.99}}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, given); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		"# TYPE ease_vmaf_mean gauge\n",
+		`ease_vmaf_mean{scheme="x264",input="clip01.mp4"} 93.2` + "\n",
+		`ease_ms_ssim_mean{scheme="x264",input="clip01.mp4"} 0.99` + "\n",
+		`ease_encoding_speed{scheme="x264",input="clip01.mp4"} 2` + "\n",
+		`ease_size_bytes{scheme="x\"265",input="clip01.mp4"} 0` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Metrics output missing %q:\n%s", want, got)
+		}
+	}
+	t.Run("Encodes without VQMs should have no quality samples", func(t *testing.T) {
+		if strings.Contains(got, `ease_vmaf_mean{scheme="x\"265"`) {
+			t.Errorf("Unexpected VMAF sample for encode without VQMs:\n%s", got)
+		}
+	})
+
+	t.Run("Should write metrics file", func(t *testing.T) {
+		name := path.Join(t.TempDir(), "ease.prom")
+		if err := writeMetricsFile(given, name); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, string(b)); diff != "" {
+			t.Errorf("Metrics file mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
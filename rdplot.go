@@ -0,0 +1,154 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// ease tool's rd-plot subcommand implementation.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/evolution-gaming/ease/internal/analysis"
+	"github.com/evolution-gaming/ease/internal/logging"
+)
+
+// CreateRDPlotCommand will create Commander instance from RDPlotApp.
+func CreateRDPlotCommand() Commander {
+	longHelp := `Subcommand "rd-plot" will create rate-distortion (VMAF vs bitrate) plot from
+report generated by "encode" stage, encodes are grouped by scheme name into a
+curve per scheme (and per input file when report has more than one input).
+
+Examples:
+
+  ease rd-plot -report encode_report.json -o rd.png`
+
+	app := &RDPlotApp{
+		fs: flag.NewFlagSet("rd-plot", flag.ContinueOnError),
+	}
+	app.fs.StringVar(&app.flSrcReport, "report", "", "Encoding report file (output from encoding stage, mandatory)")
+	app.fs.StringVar(&app.flOutFile, "o", "rd.png", "File to save plot to")
+	app.fs.StringVar(&app.flPNGCompression, "png-compression", analysis.PNGCompressionDefault, "PNG compression level of plot images (default, none, speed, best), best trades CPU for smaller files")
+	app.fs.StringVar(&app.flStyle, "style", "", "Plot style JSON file (theme, colors, fonts, legend)")
+
+	app.fs.Usage = func() {
+		printSubCommandUsage(longHelp, app.fs)
+	}
+
+	return app
+}
+
+// Make sure RDPlotApp implements Commander interface.
+var _ Commander = (*RDPlotApp)(nil)
+
+// RDPlotApp is rd-plot subcommand context that implements Commander interface.
+type RDPlotApp struct {
+	// FlagSet instance
+	fs *flag.FlagSet
+	// Encoding report file
+	flSrcReport string
+	// Plot output file
+	flOutFile string
+	// PNG compression level of plot images
+	flPNGCompression string
+	// Plot style file
+	flStyle string
+}
+
+func (a *RDPlotApp) Name() string {
+	return a.fs.Name()
+}
+
+func (a *RDPlotApp) Help() {
+	a.fs.Usage()
+}
+
+// Run is entry point to RDPlotApp command execution.
+func (a *RDPlotApp) Run(args []string) error {
+	if err := a.fs.Parse(args); err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      "usage error",
+		}
+	}
+
+	if a.flSrcReport == "" {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "mandatory option -report is missing",
+		}
+	}
+
+	if !analysis.IsPNGCompression(a.flPNGCompression) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid PNG compression: %s", a.flPNGCompression),
+		}
+	}
+
+	if _, err := os.Stat(a.flSrcReport); err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("report file does not exist? %s", err),
+		}
+	}
+
+	style, err := plotStyle(a.fs, a.flStyle)
+	if err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      err.Error(),
+		}
+	}
+	styleOpts, err := style.Options()
+	if err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      err.Error(),
+		}
+	}
+
+	points := rdPoints(newSummary(parseReportFile(a.flSrcReport)))
+	opts := append(styleOpts, analysis.WithPNGCompression(a.flPNGCompression))
+	if err := analysis.SaveRDPlot(points, "Rate-distortion", a.flOutFile, opts...); err != nil {
+		return &AppError{
+			exitCode: 1,
+			msg:      err.Error(),
+		}
+	}
+	logging.Infof("RD plot done: %s", a.flOutFile)
+
+	return nil
+}
+
+// rdPoints groups summary rows by input and scheme name into RD points.
+//
+// Curves are labeled by scheme name, when report has more than one input file
+// the input file name is added to label, so that encodings of different
+// sources do not end up on the same curve. Rows without VMAF or bitrate (e.g.
+// remuxes or failed encodes) are skipped.
+func rdPoints(rows []summaryRow) map[string][]analysis.RDPoint {
+	inputs := make(map[string]bool)
+	for i := range rows {
+		inputs[rows[i].SourceFile] = true
+	}
+
+	points := make(map[string][]analysis.RDPoint)
+	for i := range rows {
+		r := &rows[i]
+		if r.VMAF == 0 || r.Bitrate == 0 {
+			continue
+		}
+		label := r.Name
+		if len(inputs) > 1 {
+			label = fmt.Sprintf("%s (%s)", r.Name, filepath.Base(r.SourceFile))
+		}
+		points[label] = append(points[label], analysis.RDPoint{Bitrate: r.Bitrate, VMAF: r.VMAF})
+	}
+	return points
+}
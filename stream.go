@@ -0,0 +1,69 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Streaming of per encode results as JSON Lines.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/perm"
+	"github.com/evolution-gaming/ease/internal/vqm"
+)
+
+// resultRecord is a single encode result, a line in results stream.
+type resultRecord struct {
+	RunResult encoding.RunResult
+	// VQMResult is not set in case VQMs were not calculated or VQM
+	// measurement failed
+	VQMResult *vqm.Result `json:",omitempty"`
+}
+
+// resultStream writes resultRecords as JSON Lines (one JSON document per
+// line).
+type resultStream struct {
+	enc *json.Encoder
+	// closer is set when stream owns underlying writer
+	closer io.Closer
+}
+
+// newResultStream creates resultStream writing to given file, "-" stands for
+// stdout.
+func newResultStream(file string) (*resultStream, error) {
+	if file == "-" {
+		return &resultStream{enc: json.NewEncoder(os.Stdout)}, nil
+	}
+	fd, err := perm.Create(file)
+	if err != nil {
+		return nil, fmt.Errorf("newResultStream() perm.Create: %w", err)
+	}
+	return &resultStream{enc: json.NewEncoder(fd), closer: fd}, nil
+}
+
+// Write will write a single record as JSON line.
+//
+// Nil resultStream is valid and does nothing, this is the case when results
+// streaming is not enabled.
+func (s *resultStream) Write(r resultRecord) error {
+	if s == nil {
+		return nil
+	}
+	if err := s.enc.Encode(r); err != nil {
+		return fmt.Errorf("resultStream.Write() %w", err)
+	}
+	return nil
+}
+
+// Close will close underlying writer if stream owns it.
+func (s *resultStream) Close() error {
+	if s == nil || s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
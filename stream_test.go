@@ -0,0 +1,74 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tests for streaming of per encode results.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/vqm"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_resultStream(t *testing.T) {
+	outFile := path.Join(t.TempDir(), "results.jsonl")
+	given := []resultRecord{
+		{
+			RunResult: encoding.RunResult{EncoderCmd: encoding.EncoderCmd{Name: "sc1", CompressedFile: "out/clip_sc1.mp4"}},
+			VQMResult: &vqm.Result{CompressedFile: "out/clip_sc1.mp4", Metrics: vqm.VideoQualityMetrics{VMAF: 95}},
+		},
+		{
+			RunResult: encoding.RunResult{EncoderCmd: encoding.EncoderCmd{Name: "sc2", CompressedFile: "out/clip_sc2.mp4"}},
+		},
+	}
+
+	stream, err := newResultStream(outFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, r := range given {
+		if err := stream.Write(r); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fd, err := os.Open(outFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer fd.Close()
+
+	var got []resultRecord
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		var r resultRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("Line is not a valid JSON: %v", err)
+		}
+		got = append(got, r)
+	}
+
+	if diff := cmp.Diff(given, got, cmp.AllowUnexported(encoding.RunResult{})); diff != "" {
+		t.Errorf("Streamed records mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_resultStream_Nil(t *testing.T) {
+	var stream *resultStream
+	if err := stream.Write(resultRecord{}); err != nil {
+		t.Errorf("Unexpected error from nil stream Write(): %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("Unexpected error from nil stream Close(): %v", err)
+	}
+}
@@ -0,0 +1,572 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Encoding run summary table related functionality.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/evolution-gaming/ease/internal/perm"
+	"github.com/evolution-gaming/ease/internal/vqm"
+)
+
+// summaryRow holds aggregated data for a single encoded file.
+type summaryRow struct {
+	Name           string
+	SourceFile     string
+	CompressedFile string
+	// Compressed file size in bytes
+	Size int64
+	// Average bitrate in kbit/s
+	Bitrate float64
+	VMAF    float64
+	// Mean absolute difference between consecutive per frame VMAF values
+	Jitter float64
+	// Average encoding speed (x realtime)
+	Speed float64
+	// Bitrate efficiency, VMAF per Mbit/s (derived from VMAF and Bitrate)
+	Efficiency float64
+	// Composite score (0..100) of VMAF, Bitrate and Speed, see scoreSummary
+	Score float64
+	// Encoder version as parsed from encoder output, empty if unknown
+	EncoderVersion string
+}
+
+// newSummary creates summary rows from report, one row per encoding run.
+//
+// Rows are sorted by VMAF in descending order.
+func newSummary(r *report) []summaryRow {
+	metrics := make(map[string]vqm.VideoQualityMetrics, len(r.VQMResults))
+	for i := range r.VQMResults {
+		v := &r.VQMResults[i]
+		metrics[v.CompressedFile] = v.Metrics
+	}
+
+	rows := make([]summaryRow, 0, len(r.EncodingResult.RunResults))
+	for i := range r.EncodingResult.RunResults {
+		v := &r.EncodingResult.RunResults[i]
+		row := summaryRow{
+			Name:           v.Name,
+			SourceFile:     v.SourceFile,
+			CompressedFile: v.CompressedFile,
+			VMAF:           metrics[v.CompressedFile].VMAF,
+			Jitter:         metrics[v.CompressedFile].VMAFJitter,
+			Speed:          v.AvgEncodingSpeed,
+			EncoderVersion: v.EncoderVersion,
+		}
+		// In case compressed file path in not absolute we assume it must be
+		// relative to WorkDir.
+		compressedFile := v.CompressedFile
+		if !path.IsAbs(compressedFile) {
+			compressedFile = path.Join(v.WorkDir, compressedFile)
+		}
+		if fi, err := os.Stat(compressedFile); err == nil {
+			row.Size = fi.Size()
+		}
+		if v.VideoDuration > 0 {
+			row.Bitrate = float64(row.Size*8) / v.VideoDuration / 1000
+		}
+		row.Efficiency = bitrateEfficiency(row.VMAF, row.Bitrate)
+		rows = append(rows, row)
+	}
+	scoreSummary(rows, defaultScoreWeights)
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].VMAF > rows[j].VMAF
+	})
+
+	return rows
+}
+
+// Summary sort keys for -sort-by.
+const (
+	summarySortVMAF    = "vmaf"
+	summarySortBitrate = "bitrate"
+	summarySortSpeed   = "speed"
+	summarySortName    = "name"
+	summarySortScore   = "score"
+)
+
+// isSummarySortKey reports whether s is a supported summary sort key.
+func isSummarySortKey(s string) bool {
+	switch s {
+	case summarySortVMAF, summarySortBitrate, summarySortSpeed, summarySortName, summarySortScore:
+		return true
+	}
+	return false
+}
+
+// summaryLess returns less function for summary rows sorted by given key, nil
+// is returned for unknown key.
+func summaryLess(rows []summaryRow, by string) func(i, j int) bool {
+	switch by {
+	case summarySortVMAF:
+		return func(i, j int) bool { return rows[i].VMAF < rows[j].VMAF }
+	case summarySortBitrate:
+		return func(i, j int) bool { return rows[i].Bitrate < rows[j].Bitrate }
+	case summarySortSpeed:
+		return func(i, j int) bool { return rows[i].Speed < rows[j].Speed }
+	case summarySortScore:
+		return func(i, j int) bool { return rows[i].Score < rows[j].Score }
+	case summarySortName:
+		return func(i, j int) bool {
+			if rows[i].Name != rows[j].Name {
+				return rows[i].Name < rows[j].Name
+			}
+			return rows[i].CompressedFile < rows[j].CompressedFile
+		}
+	}
+	return nil
+}
+
+// sortSummary will sort summary rows by given key in ascending order (e.g.
+// worst VMAF first) or descending order when desc is set. Sort is stable, so
+// rows with equal keys keep their order.
+func sortSummary(rows []summaryRow, by string, desc bool) {
+	less := summaryLess(rows, by)
+	if less == nil {
+		return
+	}
+	if desc {
+		sort.SliceStable(rows, func(i, j int) bool { return less(j, i) })
+		return
+	}
+	sort.SliceStable(rows, less)
+}
+
+// bitrateEfficiency returns VMAF per Mbit/s for given VMAF and bitrate in
+// kbit/s, zero is returned in case bitrate is unknown.
+func bitrateEfficiency(vmaf, bitrate float64) float64 {
+	if bitrate <= 0 {
+		return 0
+	}
+	return vmaf / (bitrate / 1000)
+}
+
+// scoreWeights are weights of normalized VMAF, bitrate and speed in composite
+// score.
+type scoreWeights struct {
+	VMAF    float64
+	Bitrate float64
+	Speed   float64
+}
+
+// defaultScoreWeights balance quality against bitrate, speed is ignored.
+var defaultScoreWeights = scoreWeights{VMAF: 1, Bitrate: 1}
+
+// parseScoreWeights will parse score weights given as comma separated
+// key=weight pairs (e.g. "vmaf=2,bitrate=1,speed=0.5"), keys not given have
+// zero weight. Weights must be non-negative and at least one must be positive.
+func parseScoreWeights(s string) (scoreWeights, error) {
+	var w scoreWeights
+	for _, item := range strings.Split(s, ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(item), "=")
+		weight, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if !found || err != nil || weight < 0 {
+			return w, fmt.Errorf("invalid score weight %q, should be KEY=WEIGHT with non-negative WEIGHT", item)
+		}
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case summarySortVMAF:
+			w.VMAF = weight
+		case summarySortBitrate:
+			w.Bitrate = weight
+		case summarySortSpeed:
+			w.Speed = weight
+		default:
+			return w, fmt.Errorf("unknown score weight key %q, should be one of: vmaf, bitrate, speed", k)
+		}
+	}
+	if w.VMAF+w.Bitrate+w.Speed == 0 {
+		return w, errors.New("at least one score weight should be positive")
+	}
+	return w, nil
+}
+
+// scoreWeightsFlag is a flag.Value for composite score weights.
+type scoreWeightsFlag struct {
+	weights *scoreWeights
+}
+
+func (f scoreWeightsFlag) String() string {
+	if f.weights == nil {
+		return ""
+	}
+	return fmt.Sprintf("vmaf=%g,bitrate=%g,speed=%g", f.weights.VMAF, f.weights.Bitrate, f.weights.Speed)
+}
+
+func (f scoreWeightsFlag) Set(s string) error {
+	w, err := parseScoreWeights(s)
+	if err != nil {
+		return err
+	}
+	*f.weights = w
+	return nil
+}
+
+// scoreSummary will set composite score of summary rows as weighted average of
+// VMAF, bitrate and speed normalized to 0..1 range across rows (min-max
+// normalization, lower bitrate is better), scaled to 0..100.
+//
+// Rows without VMAF or bitrate (failed encodes, VQMs not calculated) are
+// excluded from normalization and get zero score.
+func scoreSummary(rows []summaryRow, w scoreWeights) {
+	var scored []*summaryRow
+	for i := range rows {
+		rows[i].Score = 0
+		if rows[i].VMAF > 0 && rows[i].Bitrate > 0 {
+			scored = append(scored, &rows[i])
+		}
+	}
+	total := w.VMAF + w.Bitrate + w.Speed
+	if len(scored) == 0 || total <= 0 {
+		return
+	}
+
+	type bounds struct{ min, max float64 }
+	vmaf := bounds{math.Inf(1), math.Inf(-1)}
+	bitrate, speed := vmaf, vmaf
+	for _, r := range scored {
+		vmaf.min, vmaf.max = math.Min(vmaf.min, r.VMAF), math.Max(vmaf.max, r.VMAF)
+		bitrate.min, bitrate.max = math.Min(bitrate.min, r.Bitrate), math.Max(bitrate.max, r.Bitrate)
+		speed.min, speed.max = math.Min(speed.min, r.Speed), math.Max(speed.max, r.Speed)
+	}
+	// normalize maps v into 0..1 range, all equal values are deemed best.
+	normalize := func(v float64, b bounds) float64 {
+		if b.max == b.min {
+			return 1
+		}
+		return (v - b.min) / (b.max - b.min)
+	}
+	for _, r := range scored {
+		sum := w.VMAF*normalize(r.VMAF, vmaf) +
+			w.Bitrate*(1-normalize(r.Bitrate, bitrate)) +
+			w.Speed*normalize(r.Speed, speed)
+		r.Score = sum / total * 100
+	}
+}
+
+// metricPrecision is a number of decimal places metrics are formatted with in
+// summary, CSV and log output.
+type metricPrecision struct {
+	VMAF    int
+	PSNR    int
+	MS_SSIM int
+	Bitrate int
+	// Other is precision of derived values (jitter, speed, efficiency and
+	// score)
+	Other int
+}
+
+// defaultMetricPrecision is plenty for reports, full precision is kept in
+// report JSON.
+var defaultMetricPrecision = metricPrecision{VMAF: 2, PSNR: 2, MS_SSIM: 4, Bitrate: 0, Other: 2}
+
+// maxMetricPrecision is maximum number of decimal places, float64 has no more
+// significant digits anyway.
+const maxMetricPrecision = 15
+
+// parseMetricPrecision will parse precision given as comma separated
+// key=places pairs (e.g. "vmaf=3,bitrate=1"), keys not given keep default
+// precision.
+func parseMetricPrecision(s string) (metricPrecision, error) {
+	p := defaultMetricPrecision
+	for _, item := range strings.Split(s, ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(item), "=")
+		places, err := strconv.Atoi(strings.TrimSpace(v))
+		if !found || err != nil || places < 0 || places > maxMetricPrecision {
+			return p, fmt.Errorf("invalid precision %q, should be KEY=PLACES with PLACES in 0..%d", item, maxMetricPrecision)
+		}
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "vmaf":
+			p.VMAF = places
+		case "psnr":
+			p.PSNR = places
+		case "ms-ssim", "ms_ssim":
+			p.MS_SSIM = places
+		case "bitrate":
+			p.Bitrate = places
+		case "other":
+			p.Other = places
+		default:
+			return p, fmt.Errorf("unknown precision key %q, should be one of: vmaf, psnr, ms-ssim, bitrate, other", k)
+		}
+	}
+	return p, nil
+}
+
+// vqm returns precision of VQMs for vqm package formatting.
+func (p metricPrecision) vqm() vqm.Precision {
+	return vqm.Precision{VMAF: p.VMAF, PSNR: p.PSNR, MS_SSIM: p.MS_SSIM}
+}
+
+// metricPrecisionFlag is a flag.Value for metric precision.
+type metricPrecisionFlag struct {
+	precision *metricPrecision
+}
+
+func (f metricPrecisionFlag) String() string {
+	if f.precision == nil {
+		return ""
+	}
+	p := f.precision
+	return fmt.Sprintf("vmaf=%d,psnr=%d,ms-ssim=%d,bitrate=%d,other=%d", p.VMAF, p.PSNR, p.MS_SSIM, p.Bitrate, p.Other)
+}
+
+func (f metricPrecisionFlag) Set(s string) error {
+	p, err := parseMetricPrecision(s)
+	if err != nil {
+		return err
+	}
+	*f.precision = p
+	return nil
+}
+
+// formatFloat formats v with given number of decimal places.
+func formatFloat(v float64, places int) string {
+	return strconv.FormatFloat(v, 'f', places, 64)
+}
+
+// summaryWriter writes summary rows in some format.
+type summaryWriter func(w io.Writer, rows []summaryRow) error
+
+// textSummaryWriter returns summaryWriter that writes summary rows as aligned
+// text table with numbers formatted according to given precision.
+func textSummaryWriter(p metricPrecision) summaryWriter {
+	return func(w io.Writer, rows []summaryRow) error {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tFILE\tSIZE (bytes)\tBITRATE (kbps)\tVMAF\tJITTER\tSPEED\tVMAF/Mbps\tSCORE")
+		for i := range rows {
+			r := &rows[i]
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%sx\t%s\t%s\n",
+				r.Name, path.Base(r.CompressedFile), r.Size,
+				formatFloat(r.Bitrate, p.Bitrate),
+				formatFloat(r.VMAF, p.VMAF),
+				formatFloat(r.Jitter, p.Other),
+				formatFloat(r.Speed, p.Other),
+				formatFloat(r.Efficiency, p.Other),
+				formatFloat(r.Score, p.Other))
+		}
+		return tw.Flush()
+	}
+}
+
+// delimitedSummaryWriter returns summaryWriter that writes summary rows as
+// delimiter separated values (CSV) with given field delimiter.
+//
+// Numbers are formatted with fixed precision p, so that output is easy to
+// import into spreadsheets. Rows are not streamed, since run results they are
+// derived from are held in memory by the run anyway.
+func delimitedSummaryWriter(comma rune, p metricPrecision) summaryWriter {
+	return func(w io.Writer, rows []summaryRow) error {
+		cw := csv.NewWriter(w)
+		cw.Comma = comma
+		if err := cw.Write([]string{"Name", "File", "Size", "Bitrate", "VMAF", "Jitter", "Speed", "Efficiency", "Score", "EncoderVersion"}); err != nil {
+			return fmt.Errorf("delimitedSummaryWriter() %w", err)
+		}
+		// Record slice is reused for all rows.
+		record := make([]string, 0, 10)
+		for i := range rows {
+			r := &rows[i]
+			record = append(record[:0],
+				r.Name,
+				path.Base(r.CompressedFile),
+				strconv.FormatInt(r.Size, 10),
+				formatFloat(r.Bitrate, p.Bitrate),
+				formatFloat(r.VMAF, p.VMAF),
+				formatFloat(r.Jitter, p.Other),
+				formatFloat(r.Speed, p.Other),
+				formatFloat(r.Efficiency, p.Other),
+				formatFloat(r.Score, p.Other),
+				r.EncoderVersion,
+			)
+			if err := cw.Write(record); err != nil {
+				return fmt.Errorf("delimitedSummaryWriter() %w", err)
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("delimitedSummaryWriter() %w", err)
+		}
+		return nil
+	}
+}
+
+// summaryGroupByInput is a -group-by value to group summary rows by input.
+const summaryGroupByInput = "input"
+
+// groupSummaryByInput splits summary rows into per input (source file)
+// groups, groups are ordered by input and rows keep their order within group.
+func groupSummaryByInput(rows []summaryRow) (inputs []string, groups map[string][]summaryRow) {
+	groups = make(map[string][]summaryRow)
+	for i := range rows {
+		src := rows[i].SourceFile
+		if _, ok := groups[src]; !ok {
+			inputs = append(inputs, src)
+		}
+		groups[src] = append(groups[src], rows[i])
+	}
+	sort.Strings(inputs)
+	return inputs, groups
+}
+
+// writeGroupedSummary writes summary rows as a section per input using given
+// summaryWriter, each section is a table of schemes applied to that input so
+// that schemes are compared side by side.
+func writeGroupedSummary(w io.Writer, rows []summaryRow, write summaryWriter) error {
+	inputs, groups := groupSummaryByInput(rows)
+	for i, input := range inputs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "INPUT: %s\n", input)
+		if err := write(w, groups[input]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggregateSummaryFile is a file name of aggregate summary written into plan's
+// OutDir.
+const aggregateSummaryFile = "summary.json"
+
+// aggregateSummary holds cross-encode figures for the whole run, useful to
+// track regressions of an entire plan over time.
+type aggregateSummary struct {
+	// Encodes is a number of encoding runs
+	Encodes int
+	// AvgVMAF is average VMAF across encodes that have VQMs calculated
+	AvgVMAF float64
+	// Human friendly representation of TotalEncodeTime
+	HTotalEncodeTime string
+	// TotalEncodeTime is a sum of encoding elapsed times (nanoseconds)
+	TotalEncodeTime time.Duration
+	// TotalSize is a sum of compressed file sizes in bytes
+	TotalSize int64
+	// Stages is wall clock time spent in each stage of the run
+	Stages []stageTiming `json:",omitempty"`
+}
+
+// Encoding run stages timed by stageTimer.
+const (
+	stageEncode   = "encode"
+	stageAnalysis = "analysis"
+	stageVQM      = "vqm"
+	stageReport   = "report"
+)
+
+// stageTiming is wall clock time spent in a stage of encoding run.
+type stageTiming struct {
+	Stage string
+	// Human friendly representation of Elapsed
+	HElapsed string
+	// Elapsed is stage wall clock time (nanoseconds)
+	Elapsed time.Duration
+}
+
+// stageTimer measures wall clock time of consecutive encoding run stages.
+type stageTimer struct {
+	timings []stageTiming
+	stage   string
+	start   time.Time
+	// now returns current time, nil means time.Now
+	now func() time.Time
+}
+
+func (t *stageTimer) clock() time.Time {
+	if t.now == nil {
+		return time.Now()
+	}
+	return t.now()
+}
+
+// begin will end current stage (if any) and start timing given stage.
+func (t *stageTimer) begin(stage string) {
+	t.end()
+	t.stage, t.start = stage, t.clock()
+}
+
+// end will record timing of current stage, it is a no-op if no stage is being
+// timed.
+func (t *stageTimer) end() {
+	if t.stage == "" {
+		return
+	}
+	elapsed := t.clock().Sub(t.start)
+	t.timings = append(t.timings, stageTiming{Stage: t.stage, HElapsed: elapsed.String(), Elapsed: elapsed})
+	t.stage = ""
+}
+
+// String returns recorded stage timings along with share of total time, e.g.
+// "encode 1m0s (75.0%), vqm 20s (25.0%)".
+func (t *stageTimer) String() string {
+	var total time.Duration
+	for _, v := range t.timings {
+		total += v.Elapsed
+	}
+	parts := make([]string, 0, len(t.timings))
+	for _, v := range t.timings {
+		var share float64
+		if total > 0 {
+			share = float64(v.Elapsed) / float64(total) * 100
+		}
+		parts = append(parts, fmt.Sprintf("%s %s (%.1f%%)", v.Stage, v.Elapsed.Round(time.Millisecond), share))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// newAggregateSummary creates aggregate summary from report.
+func newAggregateSummary(r *report) aggregateSummary {
+	var agg aggregateSummary
+	for i := range r.EncodingResult.RunResults {
+		agg.TotalEncodeTime += r.EncodingResult.RunResults[i].Stats.Elapsed
+	}
+	agg.HTotalEncodeTime = agg.TotalEncodeTime.String()
+
+	rows := newSummary(r)
+	agg.Encodes = len(rows)
+	var vmafSum float64
+	var vmafCount int
+	for i := range rows {
+		agg.TotalSize += rows[i].Size
+		// Zero VMAF means VQMs were not calculated for this encode.
+		if rows[i].VMAF > 0 {
+			vmafSum += rows[i].VMAF
+			vmafCount++
+		}
+	}
+	if vmafCount > 0 {
+		agg.AvgVMAF = vmafSum / float64(vmafCount)
+	}
+	return agg
+}
+
+// writeAggregateSummary will write aggregate summary as JSON into outDir.
+func writeAggregateSummary(agg aggregateSummary, outDir string) error {
+	if err := perm.MkdirAll(outDir); err != nil {
+		return fmt.Errorf("writeAggregateSummary() perm.MkdirAll: %w", err)
+	}
+	b, err := json.MarshalIndent(agg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("writeAggregateSummary() json.MarshalIndent: %w", err)
+	}
+	if err := perm.WriteFile(path.Join(outDir, aggregateSummaryFile), b); err != nil {
+		return fmt.Errorf("writeAggregateSummary() perm.WriteFile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+// Copyright ©2022 Evolution. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tests for encoding run summary table.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evolution-gaming/ease/internal/encoding"
+	"github.com/evolution-gaming/ease/internal/vqm"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func Test_newSummary(t *testing.T) {
+	given := parseReportFile("testdata/encoding_artifacts/report.json")
+	got := newSummary(given)
+
+	t.Run("Should have row for each encoding run", func(t *testing.T) {
+		if diff := cmp.Diff(len(given.EncodingResult.RunResults), len(got)); diff != "" {
+			t.Errorf("Summary row count mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Rows should be sorted by VMAF", func(t *testing.T) {
+		for i := 1; i < len(got); i++ {
+			if got[i-1].VMAF < got[i].VMAF {
+				t.Errorf("Rows not sorted by VMAF: %v < %v", got[i-1].VMAF, got[i].VMAF)
+			}
+		}
+	})
+}
+
+func Test_sortSummary(t *testing.T) {
+	given := []summaryRow{
+		{Name: "b", VMAF: 90, Bitrate: 3000, Speed: 2, Score: 50},
+		{Name: "a", VMAF: 95, Bitrate: 5000, Speed: 1, Score: 60},
+		{Name: "c", VMAF: 80, Bitrate: 1000, Speed: 3, Score: 70},
+	}
+	tests := map[string]struct {
+		givenBy   string
+		givenDesc bool
+		want      []string
+	}{
+		"VMAF ascending":      {givenBy: summarySortVMAF, want: []string{"c", "b", "a"}},
+		"VMAF descending":     {givenBy: summarySortVMAF, givenDesc: true, want: []string{"a", "b", "c"}},
+		"Bitrate ascending":   {givenBy: summarySortBitrate, want: []string{"c", "b", "a"}},
+		"Speed descending":    {givenBy: summarySortSpeed, givenDesc: true, want: []string{"c", "b", "a"}},
+		"Name ascending":      {givenBy: summarySortName, want: []string{"a", "b", "c"}},
+		"Score descending":    {givenBy: summarySortScore, givenDesc: true, want: []string{"c", "a", "b"}},
+		"Unknown keeps order": {givenBy: "size", want: []string{"b", "a", "c"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rows := append([]summaryRow(nil), given...)
+			sortSummary(rows, tc.givenBy, tc.givenDesc)
+			var got []string
+			for _, r := range rows {
+				got = append(got, r.Name)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Sorted rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_writeSummary(t *testing.T) {
+	rows := []summaryRow{
+		{Name: "sc1", CompressedFile: "out/clip_sc1.mp4", Size: 1000, Bitrate: 8, VMAF: 95.5, Jitter: 0.75, Speed: 2, Efficiency: 11937.5, Score: 87.25},
+	}
+	var buf bytes.Buffer
+	if err := textSummaryWriter(defaultMetricPrecision)(&buf, rows); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if diff := cmp.Diff(2, len(lines)); diff != "" {
+		t.Fatalf("Line count mismatch (-want +got):\n%s", diff)
+	}
+	for _, want := range []string{"sc1", "clip_sc1.mp4", "1000", " 8 ", "95.50", "0.75", "2.00x", "11937.50", "87.25"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("Summary row missing %q: %s", want, lines[1])
+		}
+	}
+}
+
+func Test_parseMetricPrecision(t *testing.T) {
+	got, err := parseMetricPrecision("VMAF=3, bitrate=1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := defaultMetricPrecision
+	want.VMAF, want.Bitrate = 3, 1
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Precision mismatch (-want +got):\n%s", diff)
+	}
+	for _, v := range []string{"vmaf", "vmaf=-1", "vmaf=16", "vmaf=2.5", "ssim=2"} {
+		if _, err := parseMetricPrecision(v); err == nil {
+			t.Errorf("Expected error for %q", v)
+		}
+	}
+}
+
+func Test_bitrateEfficiency(t *testing.T) {
+	tests := map[string]struct {
+		vmaf    float64
+		bitrate float64
+		want    float64
+	}{
+		"Nominal": {
+			vmaf:    90,
+			bitrate: 3000,
+			want:    30,
+		},
+		"Unknown bitrate": {
+			vmaf:    90,
+			bitrate: 0,
+			want:    0,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := bitrateEfficiency(tc.vmaf, tc.bitrate)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("bitrateEfficiency() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_scoreSummary(t *testing.T) {
+	given := []summaryRow{
+		{Name: "best quality", VMAF: 96, Bitrate: 5000, Speed: 1},
+		{Name: "cheapest", VMAF: 86, Bitrate: 1000, Speed: 3},
+		{Name: "balanced", VMAF: 94, Bitrate: 2000, Speed: 2},
+		{Name: "failed"},
+	}
+	tests := map[string]struct {
+		weights scoreWeights
+		want    []float64
+	}{
+		"VMAF only":    {weights: scoreWeights{VMAF: 1}, want: []float64{100, 0, 80, 0}},
+		"Bitrate only": {weights: scoreWeights{Bitrate: 1}, want: []float64{0, 100, 75, 0}},
+		"Default":      {weights: defaultScoreWeights, want: []float64{50, 50, 77.5, 0}},
+		"Speed only":   {weights: scoreWeights{Speed: 2}, want: []float64{0, 100, 50, 0}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rows := append([]summaryRow(nil), given...)
+			scoreSummary(rows, tc.weights)
+			var got []float64
+			for _, r := range rows {
+				got = append(got, r.Score)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("Scores mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_parseScoreWeights(t *testing.T) {
+	got, err := parseScoreWeights("VMAF=2, bitrate=0.5")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(scoreWeights{VMAF: 2, Bitrate: 0.5}, got); diff != "" {
+		t.Errorf("Weights mismatch (-want +got):\n%s", diff)
+	}
+	for _, v := range []string{"", "vmaf", "vmaf=-1", "size=1", "vmaf=0,speed=0"} {
+		if _, err := parseScoreWeights(v); err == nil {
+			t.Errorf("Expected error for %q", v)
+		}
+	}
+}
+
+func Test_stageTimer(t *testing.T) {
+	now := time.Date(2022, 6, 30, 15, 45, 12, 0, time.UTC)
+	timer := stageTimer{now: func() time.Time { return now }}
+	timer.end()
+	for _, v := range []struct {
+		stage   string
+		elapsed time.Duration
+	}{
+		{stageEncode, 3 * time.Minute},
+		{stageVQM, time.Minute},
+	} {
+		timer.begin(v.stage)
+		now = now.Add(v.elapsed)
+	}
+	timer.end()
+	timer.end()
+
+	want := []stageTiming{
+		{Stage: stageEncode, HElapsed: "3m0s", Elapsed: 3 * time.Minute},
+		{Stage: stageVQM, HElapsed: "1m0s", Elapsed: time.Minute},
+	}
+	if diff := cmp.Diff(want, timer.timings); diff != "" {
+		t.Errorf("Stage timings mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("encode 3m0s (75.0%), vqm 1m0s (25.0%)", timer.String()); diff != "" {
+		t.Errorf("Stage timings string mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_writeGroupedSummary(t *testing.T) {
+	rows := []summaryRow{
+		{Name: "sc1", SourceFile: "src/b.mp4", CompressedFile: "out/b_sc1.mp4", VMAF: 95},
+		{Name: "sc1", SourceFile: "src/a.mp4", CompressedFile: "out/a_sc1.mp4", VMAF: 94},
+		{Name: "sc2", SourceFile: "src/b.mp4", CompressedFile: "out/b_sc2.mp4", VMAF: 93},
+	}
+	var buf bytes.Buffer
+	if err := writeGroupedSummary(&buf, rows, textSummaryWriter(defaultMetricPrecision)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sections := strings.Split(strings.TrimSpace(buf.String()), "\n\n")
+	if diff := cmp.Diff(2, len(sections)); diff != "" {
+		t.Fatalf("Section count mismatch (-want +got):\n%s", diff)
+	}
+	want := []struct {
+		header string
+		files  []string
+	}{
+		{"INPUT: src/a.mp4", []string{"a_sc1.mp4"}},
+		{"INPUT: src/b.mp4", []string{"b_sc1.mp4", "b_sc2.mp4"}},
+	}
+	for i, w := range want {
+		lines := strings.Split(sections[i], "\n")
+		if diff := cmp.Diff(w.header, lines[0]); diff != "" {
+			t.Errorf("Section header mismatch (-want +got):\n%s", diff)
+		}
+		// Header, table header and a line per row.
+		if diff := cmp.Diff(len(w.files)+2, len(lines)); diff != "" {
+			t.Errorf("Section line count mismatch (-want +got):\n%s", diff)
+		}
+		for j, f := range w.files {
+			if !strings.Contains(lines[j+2], f) {
+				t.Errorf("Section row missing %q: %s", f, lines[j+2])
+			}
+		}
+	}
+}
+
+func Test_delimitedSummaryWriter(t *testing.T) {
+	rows := []summaryRow{
+		{Name: "sc1", CompressedFile: "out/clip_sc1.mp4", Size: 1000, Bitrate: 8, VMAF: 95.123456, Jitter: 1.234, Speed: 2, Efficiency: 11890.432, Score: 100, EncoderVersion: "x264 core 164"},
+	}
+	var buf bytes.Buffer
+	if err := delimitedSummaryWriter(';', defaultMetricPrecision)(&buf, rows); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "Name;File;Size;Bitrate;VMAF;Jitter;Speed;Efficiency;Score;EncoderVersion\n" +
+		"sc1;clip_sc1.mp4;1000;8;95.12;1.23;2.00;11890.43;100.00;x264 core 164\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Delimited summary mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("Custom precision", func(t *testing.T) {
+		var buf bytes.Buffer
+		p := metricPrecision{VMAF: 4, Bitrate: 1, Other: 0}
+		if err := delimitedSummaryWriter(',', p)(&buf, rows); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want := "Name,File,Size,Bitrate,VMAF,Jitter,Speed,Efficiency,Score,EncoderVersion\n" +
+			"sc1,clip_sc1.mp4,1000,8.0,95.1235,1,2,11890,100,x264 core 164\n"
+		if diff := cmp.Diff(want, buf.String()); diff != "" {
+			t.Errorf("Delimited summary mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+// countingWriter counts Write calls and fails once limit is reached.
+type countingWriter struct {
+	writes, limit int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.limit > 0 && w.writes >= w.limit {
+		return 0, errors.New("write failed")
+	}
+	return len(p), nil
+}
+
+func Test_delimitedSummaryWriter_WriteError(t *testing.T) {
+	// Enough rows to overflow csv.Writer buffer more than once.
+	rows := make([]summaryRow, 300)
+	for i := range rows {
+		rows[i] = summaryRow{Name: "sc1", CompressedFile: "out/clip_sc1.mp4"}
+	}
+
+	w := &countingWriter{limit: 1}
+	if err := delimitedSummaryWriter(',', defaultMetricPrecision)(w, rows); err == nil {
+		t.Error("Expected error, got nil")
+	}
+	if w.writes != 1 {
+		t.Errorf("Expected writing to stop after error, got %d writes", w.writes)
+	}
+}
+
+func Test_newAggregateSummary(t *testing.T) {
+	given := &report{
+		EncodingResult: encoding.PlanResult{
+			RunResults: []encoding.RunResult{
+				{EncoderCmd: encoding.EncoderCmd{CompressedFile: "a.mp4"}, Stats: encoding.UsageStat{Elapsed: time.Second}},
+				{EncoderCmd: encoding.EncoderCmd{CompressedFile: "b.mp4"}, Stats: encoding.UsageStat{Elapsed: 2 * time.Second}},
+				{EncoderCmd: encoding.EncoderCmd{CompressedFile: "c.mp4"}, Stats: encoding.UsageStat{Elapsed: 3 * time.Second}},
+			},
+		},
+		VQMResults: []namedVqmResult{
+			{Result: vqm.Result{CompressedFile: "a.mp4", Metrics: vqm.VideoQualityMetrics{VMAF: 90}}},
+			{Result: vqm.Result{CompressedFile: "b.mp4", Metrics: vqm.VideoQualityMetrics{VMAF: 80}}},
+		},
+	}
+	want := aggregateSummary{
+		Encodes:          3,
+		AvgVMAF:          85,
+		HTotalEncodeTime: "6s",
+		TotalEncodeTime:  6 * time.Second,
+	}
+	got := newAggregateSummary(given)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("aggregateSummary mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("Should write summary.json", func(t *testing.T) {
+		outDir := t.TempDir()
+		if err := writeAggregateSummary(got, outDir); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b, err := os.ReadFile(path.Join(outDir, aggregateSummaryFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gotFile aggregateSummary
+		if err := json.Unmarshal(b, &gotFile); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, gotFile); diff != "" {
+			t.Errorf("summary.json mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/evolution-gaming/ease/internal/analysis"
@@ -20,6 +21,9 @@ import (
 // Support these metrics for plotting.
 var supportedMetrics = "VMAF, PSNR, MS-SSIM"
 
+// metricAll is special -m value to plot all metrics present in libvmaf JSON.
+const metricAll = "all"
+
 // CreateVQMPlotCommand will create Commander instance from VQMPlotApp.
 func CreateVQMPlotCommand() Commander {
 	longHelp := `Subcommand "vqmplot" will create plot for given metric from JSON report as
@@ -28,14 +32,30 @@ generated by libvmaf.
 Examples:
 
   ease vqmplot -i libvmaf.json -o vmaf.png
-  ease vqmplot -m PSNR -i libvmaf.json -o psnr.png`
+  ease vqmplot -m PSNR -i libvmaf.json -o psnr.png
+  ease vqmplot -m all -i libvmaf.json -o plot.png
+  ease vqmplot -layout 1x3 -i libvmaf.json -o vmaf.png
+  ease vqmplot -delta -o vmaf_delta.png a_libvmaf.json b_libvmaf.json`
 
 	app := &VQMPlotApp{
 		fs: flag.NewFlagSet("vqmplot", flag.ContinueOnError),
 	}
 	app.fs.StringVar(&app.flSrcFile, "i", "", "Input libvmaf JSON file (mandatory)")
 	app.fs.StringVar(&app.flOutFile, "o", "", "Output file")
-	app.fs.StringVar(&app.flMetric, "m", "VMAF", fmt.Sprintf("Metric to plot (%s)", supportedMetrics))
+	app.fs.StringVar(&app.flMetric, "m", "VMAF", fmt.Sprintf("Metric to plot (%s) or \"all\" to plot each metric present to <output base>_<metric>.png", supportedMetrics))
+	app.fs.Float64Var(&app.flYMin, "ymin", 0, "Per-frame plot Y axis lower bound (default depends on metric)")
+	app.fs.Float64Var(&app.flYMax, "ymax", 0, "Per-frame plot Y axis upper bound (default depends on metric)")
+	app.fs.StringVar(&app.flLegend, "legend", analysis.LegendNone, "Per-frame plot legend position (top, bottom, none)")
+	app.fs.Float64Var(&app.flLegendXOffs, "legend-x-offset", 0, "Legend horizontal offset in points")
+	app.fs.Float64Var(&app.flLegendYOffs, "legend-y-offset", 0, "Legend vertical offset in points")
+	app.fs.BoolVar(&app.flJitter, "jitter", false, "Annotate per-frame plot with jitter (mean absolute difference between consecutive frames)")
+	app.fs.Var(layoutFlag{&app.flLayoutRows, &app.flLayoutCols}, "layout", "Multi-plot tile layout as ROWSxCOLS, e.g. 1x3 (default 3x1)")
+	app.fs.StringVar(&app.flTheme, "theme", analysis.ThemeLight, "Plot color theme (light, dark)")
+	app.fs.StringVar(&app.flPNGCompression, "png-compression", analysis.PNGCompressionDefault, "PNG compression level of plot images (default, none, speed, best), best trades CPU for smaller files")
+	app.fs.BoolVar(&app.flDelta, "delta", false, "Plot per-frame difference of two libvmaf JSON files given as arguments (first minus second)")
+	app.flFont.register(app.fs)
+	app.fs.StringVar(&app.flStyle, "style", "", "Plot style JSON file (theme, colors, fonts, legend), flags given explicitly take precedence")
+	app.fs.Var(fieldAliasesFlag{&app.flFieldAliases}, "field-alias", "Additional libvmaf JSON key of metric as METRIC=KEY (e.g. MS_SSIM=float_ms_ssim_v2), can be repeated, same as plan's VMAFOptions.FieldAliases")
 
 	app.fs.Usage = func() {
 		printSubCommandUsage(longHelp, app.fs)
@@ -57,6 +77,30 @@ type VQMPlotApp struct {
 	flOutFile string
 	// Selected metric to plot
 	flMetric string
+	// Y axis bounds overrides
+	flYMin float64
+	flYMax float64
+	// Legend position and offsets
+	flLegend      string
+	flLegendXOffs float64
+	flLegendYOffs float64
+	// Plot delta of two libvmaf JSON files given as positional arguments
+	flDelta bool
+	// Annotate per-frame plot with jitter flag
+	flJitter bool
+	// Multi-plot tile layout
+	flLayoutRows int
+	flLayoutCols int
+	// Plot color theme
+	flTheme string
+	// PNG compression level of plot images
+	flPNGCompression string
+	// Plot font flags
+	flFont fontFlags
+	// Plot style file
+	flStyle string
+	// Additional libvmaf JSON keys of metrics
+	flFieldAliases vqm.FieldAliases
 }
 
 func (a *VQMPlotApp) Name() string {
@@ -76,6 +120,41 @@ func (a *VQMPlotApp) Run(args []string) error {
 		}
 	}
 
+	if !analysis.IsTheme(a.flTheme) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid theme: %s", a.flTheme),
+		}
+	}
+
+	if !analysis.IsPNGCompression(a.flPNGCompression) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid PNG compression: %s", a.flPNGCompression),
+		}
+	}
+
+	style, err := plotStyle(a.fs, a.flStyle)
+	if err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      err.Error(),
+		}
+	}
+	styleOpts, err := style.Options()
+	if err != nil {
+		return &AppError{
+			exitCode: 2,
+			msg:      err.Error(),
+		}
+	}
+
+	if a.flDelta {
+		return a.runDelta(styleOpts)
+	}
+
 	// Flag specifying libvmaf JSON metrics is mandatory.
 	if a.flSrcFile == "" {
 		a.Help()
@@ -100,35 +179,194 @@ func (a *VQMPlotApp) Run(args []string) error {
 		a.flOutFile = base + ".png"
 	}
 
-	if !strings.Contains(supportedMetrics, a.flMetric) {
+	if a.flMetric != metricAll && !strings.Contains(supportedMetrics, a.flMetric) {
 		a.Help()
 		return &AppError{
 			exitCode: 2,
-			msg:      fmt.Sprintf("unsupported metric, should be one of: %s\n", supportedMetrics),
+			msg:      fmt.Sprintf("unsupported metric, should be one of: %s, %s\n", supportedMetrics, metricAll),
+		}
+	}
+
+	if !analysis.IsLegendPosition(a.flLegend) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("invalid legend position: %s", a.flLegend),
 		}
 	}
 
 	logging.Info("Starting...")
 
-	jsonFd, err := os.Open(a.flSrcFile)
+	// Only override Y axis bounds if explicitly set via flags.
+	plotOpts := append([]analysis.PlotOption{
+		analysis.WithPNGCompression(a.flPNGCompression),
+	}, styleOpts...)
+	a.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "ymin":
+			plotOpts = append(plotOpts, analysis.WithYMin(a.flYMin))
+		case "ymax":
+			plotOpts = append(plotOpts, analysis.WithYMax(a.flYMax))
+		case "layout":
+			plotOpts = append(plotOpts, analysis.WithLayout(a.flLayoutRows, a.flLayoutCols))
+		}
+	})
+
+	if a.flMetric == metricAll {
+		return a.runAll(plotOpts)
+	}
+
+	vqms, err := loadMetricValues(a.flSrcFile, a.flMetric, a.flFieldAliases)
+	if err != nil {
+		return &AppError{
+			exitCode: 1,
+			msg:      err.Error(),
+		}
+	}
+	if a.flJitter {
+		plotOpts = append(plotOpts, analysis.WithJitter(vqm.Jitter(vqms)))
+	}
+
+	if err := analysis.MultiPlotVqm(vqms, a.flMetric, path.Base(a.flSrcFile), a.flOutFile, plotOpts...); err != nil {
+		return &AppError{
+			exitCode: 1,
+			msg:      err.Error(),
+		}
+	}
+	logging.Info("Done")
+	return nil
+}
+
+// runAll will create multi-plot for each metric present in libvmaf JSON file,
+// file is read only once. Output file names are derived from -o value as
+// <base>_<metric>.png.
+func (a *VQMPlotApp) runAll(plotOpts []analysis.PlotOption) error {
+	// Y axis bounds differ per metric, single override makes no sense here.
+	var yBounds bool
+	a.fs.Visit(func(f *flag.Flag) {
+		yBounds = yBounds || f.Name == "ymin" || f.Name == "ymax"
+	})
+	if yBounds {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "options -ymin and -ymax can not be used with -m all",
+		}
+	}
+
+	frameMetrics, err := loadFrameMetrics(a.flSrcFile, a.flFieldAliases)
 	if err != nil {
 		return &AppError{
 			exitCode: 1,
 			msg:      err.Error(),
 		}
 	}
-	defer jsonFd.Close()
 
-	var frameMetrics vqm.FrameMetrics
-	if err := frameMetrics.FromFfmpegVMAF(jsonFd); err != nil {
+	outBase := strings.TrimSuffix(a.flOutFile, path.Ext(a.flOutFile))
+	var plotted int
+	for _, metric := range strings.Split(supportedMetrics, ", ") {
+		vqms := metricValues(frameMetrics, metric)
+		if len(vqms) == 0 || allZero(vqms) {
+			logging.Infof("No %s values in %s, skipping", metric, a.flSrcFile)
+			continue
+		}
+		opts := plotOpts
+		if a.flJitter {
+			opts = append(opts[:len(opts):len(opts)], analysis.WithJitter(vqm.Jitter(vqms)))
+		}
+		outFile := fmt.Sprintf("%s_%s.png", outBase, strings.ToLower(metric))
+		logging.Infof("Writing %s plot to %s", metric, outFile)
+		if err := analysis.MultiPlotVqm(vqms, metric, path.Base(a.flSrcFile), outFile, opts...); err != nil {
+			return &AppError{
+				exitCode: 1,
+				msg:      err.Error(),
+			}
+		}
+		plotted++
+	}
+	if plotted == 0 {
+		return &AppError{
+			exitCode: 1,
+			msg:      fmt.Sprintf("no metrics to plot in %s", a.flSrcFile),
+		}
+	}
+	logging.Info("Done")
+	return nil
+}
+
+// runDelta will create per-frame delta plot of two libvmaf JSON files given as
+// positional arguments, styleOpts (theme, fonts, legend and colors) are
+// applied to plot.
+func (a *VQMPlotApp) runDelta(styleOpts []analysis.PlotOption) error {
+	if a.fs.NArg() != 2 {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      "-delta requires exactly two libvmaf JSON files as arguments",
+		}
+	}
+	fileA, fileB := a.fs.Arg(0), a.fs.Arg(1)
+
+	if !strings.Contains(supportedMetrics, a.flMetric) {
+		a.Help()
+		return &AppError{
+			exitCode: 2,
+			msg:      fmt.Sprintf("unsupported metric, should be one of: %s\n", supportedMetrics),
+		}
+	}
+
+	// Output file will be constructed if not specified.
+	if a.flOutFile == "" {
+		base := path.Base(fileA)
+		base = strings.TrimSuffix(base, path.Ext(base))
+		a.flOutFile = base + "_delta.png"
+	}
+
+	logging.Info("Starting...")
+
+	vqmsA, err := loadMetricValues(fileA, a.flMetric, a.flFieldAliases)
+	if err != nil {
+		return &AppError{exitCode: 1, msg: err.Error()}
+	}
+	vqmsB, err := loadMetricValues(fileB, a.flMetric, a.flFieldAliases)
+	if err != nil {
+		return &AppError{exitCode: 1, msg: err.Error()}
+	}
+	if len(vqmsA) != len(vqmsB) {
+		logging.Infof("Frame count differs (%d vs %d), plotting common frames only", len(vqmsA), len(vqmsB))
+	}
+
+	title := fmt.Sprintf("%s - %s", path.Base(fileA), path.Base(fileB))
+	if err := analysis.PlotDeltaVqm(vqmsA, vqmsB, a.flMetric, title, a.flOutFile,
+		append(styleOpts, analysis.WithPNGCompression(a.flPNGCompression))...); err != nil {
 		return &AppError{
 			exitCode: 1,
 			msg:      err.Error(),
 		}
 	}
+	logging.Info("Done")
+	return nil
+}
+
+// loadMetricValues will read per-frame values of given metric from libvmaf
+// JSON file.
+func loadMetricValues(file, metric string, aliases vqm.FieldAliases) ([]float64, error) {
+	frameMetrics, err := loadFrameMetrics(file, aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	vqms := metricValues(frameMetrics, metric)
+	if len(vqms) == 0 {
+		return nil, fmt.Errorf("no records for %s in %s", metric, file)
+	}
+	return vqms, nil
+}
 
+// metricValues will extract per-frame values of given metric.
+func metricValues(frameMetrics vqm.FrameMetrics, metric string) []float64 {
 	var vqms []float64
-	switch a.flMetric {
+	switch metric {
 	case "VMAF":
 		for _, v := range frameMetrics {
 			vqms = append(vqms, v.VMAF)
@@ -142,19 +380,41 @@ func (a *VQMPlotApp) Run(args []string) error {
 			vqms = append(vqms, v.MS_SSIM)
 		}
 	}
-	if len(vqms) == 0 {
-		return &AppError{
-			exitCode: 1,
-			msg:      fmt.Sprintf("no records for %s in %s", a.flMetric, a.flSrcFile),
+	return vqms
+}
+
+// fieldAliasesFlag is a flag.Value for libvmaf JSON field aliases given as
+// METRIC=KEY, each occurrence adds a key.
+type fieldAliasesFlag struct {
+	aliases *vqm.FieldAliases
+}
+
+func (f fieldAliasesFlag) String() string {
+	if f.aliases == nil {
+		return ""
+	}
+	var pairs []string
+	for metric, keys := range *f.aliases {
+		for _, k := range keys {
+			pairs = append(pairs, metric+"="+k)
 		}
 	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
 
-	if err := analysis.MultiPlotVqm(vqms, a.flMetric, path.Base(a.flSrcFile), a.flOutFile); err != nil {
-		return &AppError{
-			exitCode: 1,
-			msg:      err.Error(),
-		}
+func (f fieldAliasesFlag) Set(s string) error {
+	metric, key, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid field alias %q, want METRIC=KEY", s)
 	}
-	logging.Info("Done")
+	a := vqm.FieldAliases{metric: {key}}
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	if *f.aliases == nil {
+		*f.aliases = make(vqm.FieldAliases)
+	}
+	(*f.aliases)[metric] = append((*f.aliases)[metric], key)
 	return nil
 }